@@ -0,0 +1,712 @@
+package vc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+
+	"github.com/tehmaze/vc/client"
+)
+
+// AgentSocket is the default socket of the agent
+const AgentSocket = "$HOME/.vc-agent.sock"
+
+// AgentSocketEnv is the environment variable with the socket of the agent;
+// if set, commands use the token of the agent instead of logging in
+const AgentSocketEnv = "VC_AGENT_SOCK"
+
+// Defaults for the agent
+const (
+	agentCacheTTL = 5 * time.Minute
+	agentTick     = 10 * time.Second
+	agentTimeout  = 5 * time.Second
+)
+
+// agentLoginMethods are the login methods the agent can use to log in again,
+// they don't prompt
+var agentLoginMethods = map[string]bool{
+	"approle":    true,
+	"aws":        true,
+	"cert":       true,
+	"kubernetes": true,
+}
+
+// agentEntry is a cached secret
+type agentEntry struct {
+	secret  *api.Secret
+	expires time.Time
+
+	// renew is when the lease of the secret is renewed, zero if the secret
+	// has no renewable lease
+	renew time.Time
+}
+
+// agentServer holds the token, renews it and the leases of the cached secrets, and
+// serves secrets to local processes
+type agentServer struct {
+	client   *Client
+	cacheTTL time.Duration
+
+	// login logs in again when the token can't be renewed, may be nil
+	login func() (*api.Secret, error)
+
+	mutex      sync.Mutex
+	cache      map[string]*agentEntry
+	renewToken time.Time
+}
+
+func newAgent(c *Client, cacheTTL time.Duration, login func() (*api.Secret, error)) *agentServer {
+	return &agentServer{
+		client:   c,
+		cacheTTL: cacheTTL,
+		login:    login,
+		cache:    make(map[string]*agentEntry),
+	}
+}
+
+// start looks up the token, or logs in if it is not valid
+func (a *agentServer) start() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	secret, err := a.client.Auth().Token().LookupSelf()
+	if err != nil && a.login != nil {
+		Debugf("agent: token lookup failed, logging in: %v", err)
+		return a.relogin(time.Now())
+	} else if err != nil {
+		return err
+	}
+	return a.scheduleToken(secret, time.Now())
+}
+
+// scheduleToken schedules the renewal of the token at two thirds of its TTL
+func (a *agentServer) scheduleToken(secret *api.Secret, now time.Time) error {
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		return err
+	}
+	observeTokenTTL(ttl)
+	if ttl == 0 {
+		a.renewToken = time.Time{}
+	} else {
+		a.renewToken = now.Add(ttl * 2 / 3)
+	}
+	return nil
+}
+
+// relogin logs in again, and drops the cached secrets, as their leases are
+// revoked with the old token
+func (a *agentServer) relogin(now time.Time) error {
+	secret, err := a.login()
+	if err != nil {
+		return err
+	}
+	token, err := secret.TokenID()
+	if err != nil {
+		return err
+	}
+	a.client.SetToken(token)
+	a.cache = make(map[string]*agentEntry)
+	return a.scheduleToken(secret, now)
+}
+
+// degraded checks if Vault is unreachable, see agentBreaker
+func (a *agentServer) degraded() bool {
+	if a.client.Breaker == nil {
+		return false
+	}
+	open, _ := a.client.Breaker.Open()
+	return open
+}
+
+// maintain renews the token and the leases that are due, and removes the
+// expired secrets from the cache; while Vault is unreachable, nothing is
+// renewed, and secrets without a lease are kept
+func (a *agentServer) maintain(now time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	degraded := a.degraded()
+	if !degraded && !a.renewToken.IsZero() && !now.Before(a.renewToken) {
+		secret, err := a.client.Auth().Token().RenewSelf(0)
+		if err == nil && a.login != nil {
+			if ttl, _ := secret.TokenTTL(); ttl < agentTick*3 {
+				err = errors.New("token is close to its max TTL")
+			}
+		}
+		if err != nil && a.login != nil {
+			Debugf("agent: token renewal failed, logging in: %v", err)
+			err = a.relogin(now)
+		} else if err == nil {
+			Debug("agent: renewed token")
+			err = a.scheduleToken(secret, now)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: agent: token: %v\n", err)
+			health.token(0, err)
+			a.renewToken = now.Add(agentTick * 3)
+		}
+	}
+	health.schedule(now.Add(agentTick))
+
+	for key, entry := range a.cache {
+		if !degraded && !entry.renew.IsZero() && !now.Before(entry.renew) {
+			secret, err := a.client.Sys().Renew(entry.secret.LeaseID, 0)
+			if err != nil {
+				Debugf("agent: renew %s: %v", key, err)
+				entry.renew = time.Time{}
+			} else {
+				Debugf("agent: renewed lease of %s", key)
+				ttl := time.Duration(secret.LeaseDuration) * time.Second
+				entry.expires = now.Add(ttl)
+				entry.renew = now.Add(ttl * 2 / 3)
+			}
+		}
+		if !now.Before(entry.expires) && !(degraded && entry.secret.LeaseID == "") {
+			Debugf("agent: %s expired", key)
+			delete(a.cache, key)
+		}
+	}
+}
+
+// read returns the secret at path, from the cache if possible; version is 0
+// for the current version
+func (a *agentServer) read(path string, version int) (*api.Secret, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	key := path
+	if version > 0 {
+		key += "@" + strconv.Itoa(version)
+	}
+	now := time.Now()
+	if entry, ok := a.cache[key]; ok && now.Before(entry.expires) {
+		Debugf("agent: %s from cache", key)
+		return entry.secret, nil
+	}
+
+	var (
+		secret *api.Secret
+		err    error
+	)
+	if version > 0 {
+		secret, err = a.client.ReadVersion(path, version)
+	} else {
+		secret, err = a.client.ReadSecret(path)
+	}
+	if entry, ok := a.cache[key]; ok && err != nil && entry.secret.LeaseID == "" && a.degraded() {
+		Debugf("agent: %s from cache, Vault is unreachable: %v", key, err)
+		metrics.add(cacheReads, 1)
+		return entry.secret, nil
+	}
+	if err != nil || secret == nil {
+		delete(a.cache, key)
+		return secret, err
+	}
+
+	// Secrets with a lease are kept until the lease expires, other secrets
+	// for the cache TTL
+	entry := &agentEntry{secret: secret, expires: now.Add(a.cacheTTL)}
+	if secret.LeaseID != "" && secret.LeaseDuration > 0 {
+		ttl := time.Duration(secret.LeaseDuration) * time.Second
+		entry.expires = now.Add(ttl)
+		if secret.Renewable {
+			entry.renew = now.Add(ttl * 2 / 3)
+		}
+	}
+	a.cache[key] = entry
+	return secret, nil
+}
+
+// revoke revokes the leases of the cached secrets
+func (a *agentServer) revoke() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for key, entry := range a.cache {
+		if entry.secret.LeaseID == "" {
+			continue
+		}
+		if err := a.client.Sys().Revoke(entry.secret.LeaseID); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: agent: revoke %s: %v\n", key, err)
+			continue
+		}
+		Debugf("agent: revoked lease of %s", key)
+		delete(a.cache, key)
+	}
+}
+
+// token returns the current token
+func (a *agentServer) token() string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.client.Token()
+}
+
+// handler returns the API of the agent:
+//
+//	GET /v1/token             the token of the agent
+//	GET /v1/secret/<path>     the secret at path (?version=n for a version)
+//	GET /metrics              the metrics, in the Prometheus text format
+//	GET /health               the health, see healthStatus
+func (a *agentServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			agentError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		agentRespond(w, map[string]string{"token": a.token()})
+	})
+	mux.HandleFunc("/v1/secret/", func(w http.ResponseWriter, r *http.Request) {
+		a.serveSecret(w, r, nil)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.WriteTo(w)
+	})
+	mux.Handle("/health", health)
+	return mux
+}
+
+// serveSecret serves the secret at the path of the request below /v1/secret/;
+// if allowed is not nil, only the paths it allows are served
+func (a *agentServer) serveSecret(w http.ResponseWriter, r *http.Request, allowed func(string) bool) {
+	if r.Method != "GET" {
+		agentError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	path := "/" + strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/secret/"), "/")
+	if path == "/" {
+		agentError(w, http.StatusBadRequest, errors.New("missing path"))
+		return
+	}
+	var version int
+	if v := r.URL.Query().Get("version"); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			agentError(w, http.StatusBadRequest, fmt.Errorf("invalid version %q", v))
+			return
+		}
+	}
+	if allowed != nil && !allowed(path) {
+		agentError(w, http.StatusForbidden, errors.New(strings.TrimLeft(path, "/")+": permission denied"))
+		return
+	}
+	secret, err := a.read(path, version)
+	switch {
+	case err != nil && ErrorKind(err) == ErrNotFound:
+		agentError(w, http.StatusNotFound, err)
+	case err != nil && ErrorKind(err) == ErrPermissionDenied:
+		agentError(w, http.StatusForbidden, err)
+	case err != nil:
+		agentError(w, http.StatusBadGateway, err)
+	case secret == nil:
+		agentError(w, http.StatusNotFound, errors.New(path+": not found"))
+	default:
+		agentRespond(w, secret)
+	}
+}
+
+func agentRespond(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// agentError responds with an error, in the format of the Vault API
+func agentError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": {err.Error()}})
+}
+
+// agentSocket returns the socket of the agent
+func agentSocket() string {
+	if socket := os.Getenv(AgentSocketEnv); socket != "" {
+		return socket
+	}
+	return os.ExpandEnv(AgentSocket)
+}
+
+// agentClient returns an HTTP client that connects to the agent at socket
+func agentClient(socket string) *http.Client {
+	return &http.Client{
+		Timeout: agentTimeout,
+		Transport: &http.Transport{
+			Dial: func(_, _ string) (net.Conn, error) {
+				return net.DialTimeout("unix", socket, agentTimeout)
+			},
+		},
+	}
+}
+
+// agentToken requests the token from the agent at socket
+func agentToken(socket string) (string, error) {
+	res, err := agentClient(socket).Get("http://agent/v1/token")
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("agent: %s", res.Status)
+	}
+	var response struct {
+		Token string `json:"token"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("agent: %v", err)
+	}
+	return response.Token, nil
+}
+
+// agentBreaker returns the circuit breaker of the agent, that backs off while
+// Vault is unreachable; the changes are logged once, and recorded in the
+// vc_vault_up metric
+func agentBreaker() *client.Breaker {
+	b := client.NewBreaker()
+	b.OnChange = func(open bool, err error) {
+		if open {
+			metrics.set(vaultUp, 0)
+			fmt.Fprintf(os.Stderr, "warning: agent: Vault is unreachable, serving cached secrets: %v\n", err)
+		} else {
+			metrics.set(vaultUp, 1)
+			fmt.Fprintln(os.Stderr, "agent: Vault is reachable again")
+		}
+	}
+	return b
+}
+
+// listenAgent listens on socket, replacing a stale socket file, with the file
+// mode of the socket set to mode
+func listenAgent(socket string, mode os.FileMode) (net.Listener, error) {
+	if _, err := os.Stat(socket); err == nil {
+		if conn, err := net.DialTimeout("unix", socket, agentTimeout); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: agent is already running", socket)
+		}
+		Debugf("agent: removing stale socket %s", socket)
+		if err = os.Remove(socket); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(socket, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// checkPprofAddr checks that addr is on a loopback interface: the profiles
+// aren't authenticated, and include the command line of the agent
+func checkPprofAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("pprof address %s: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("pprof address %s: not a loopback address, use localhost, 127.0.0.1 or [::1]", addr)
+	}
+	return nil
+}
+
+// servePprof serves the CPU and heap profiles of the agent on addr, for go
+// tool pprof; addr must be a loopback address, see checkPprofAddr
+func servePprof(addr string) error {
+	if err := checkPprofAddr(addr); err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	Debugf("agent: serving profiles on http://%s/debug/pprof/", l.Addr())
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: agent: profiles: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// AgentCommand runs the agent
+type AgentCommand struct {
+	baseCommand
+	fs        *flag.FlagSet
+	socket    string
+	cacheTTL  time.Duration
+	method    string
+	path      string
+	role      string
+	revoke    bool
+	apiSocket string
+	apiMod    string
+	pprofAddr string
+}
+
+func (cmd *AgentCommand) Help() string {
+	return `Usage: vc agent [<options>]
+
+Runs the agent, a long-running process that holds the Vault token, renews it
+and the leases of the secrets it read, and caches secrets for other processes.
+The agent listens on a unix socket (-socket), that only the user can connect
+to; commands with ` + AgentSocketEnv + ` set use the token of the agent.
+
+The token is the one vc would use (see vc login); with -method, the agent
+logs in again if the token expires or can't be renewed.
+
+API:
+  GET /v1/token             the token of the agent, as {"token": "..."}
+  GET /v1/secret/<path>     the secret at path, as returned by Vault; add
+                            ?version=n for a version of a KV v2 secret
+  GET /metrics              the metrics, in the Prometheus text format
+  GET /health               the health of the agent: whether its token is
+                            valid, and it renews it and checks Vault on
+                            schedule; 503 if not
+
+With --health-addr, the health is also served on that address, for probes.
+Under systemd with Type=notify, the agent reports when it is ready, and with
+WatchdogSec it notifies the watchdog while it is healthy.
+
+With -api-socket, the agent also serves an API for the clients in the agent
+section of the configuration file, that authenticate with their key as a
+bearer token and can only read the secrets at or below their paths:
+  GET  /v1/secret/<path>    the secret at path, as above
+  POST /v1/render           the template in the body, rendered; add
+                            ?templating=html for the html mode
+
+Secrets with a lease are cached until the lease expires, other secrets for the
+-cache-ttl. If Vault can't be reached, the agent backs off: requests fail fast
+and Vault is probed with an increasing interval, leases are not renewed, and
+cached secrets without a lease are served after their TTL.
+
+On SIGTERM, the agent stops accepting connections, lets the requests in flight
+finish for the --drain-timeout, and revokes the leases of the cached secrets
+with -revoke.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *AgentCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) != 0 {
+		return Help
+	}
+	if cmd.method != "" && !agentLoginMethods[cmd.method] {
+		cmd.ui.Error(fmt.Sprintf("error: unsupported login method %q for the agent", cmd.method))
+		return SyntaxError
+	}
+
+	var (
+		clients []AgentClient
+		apiMode os.FileMode
+	)
+	if cmd.apiSocket != "" {
+		mode, err := strconv.ParseInt(cmd.apiMod, 8, 32)
+		if err != nil {
+			cmd.ui.Error("error: invalid mode: " + err.Error())
+			return SyntaxError
+		}
+		apiMode = os.FileMode(mode)
+		config, err := cmd.Config()
+		if err != nil {
+			cmd.ui.Error(err.Error())
+			return ClientError
+		}
+		if config.Agent != nil {
+			clients = config.Agent.Clients
+		}
+		if len(clients) == 0 {
+			cmd.ui.Error("error: -api-socket needs clients in the agent section of the configuration file")
+			return SyntaxError
+		} else if err = checkAgentClients(clients); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SyntaxError
+		}
+	}
+
+	// The agent doesn't use another agent
+	os.Unsetenv(AgentSocketEnv)
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	var login func() (*api.Secret, error)
+	if cmd.method != "" {
+		factory, _ := LoginCommandFactory(cmd.ui)()
+		lc := factory.(*LoginCommand)
+		lc.fs.Parse(nil)
+		lc.role = cmd.role
+		mount := strings.Trim(cmd.path, "/")
+		if mount == "" {
+			mount = cmd.method
+		}
+		login = func() (*api.Secret, error) {
+			client.ClearToken()
+			return loginMethods[cmd.method](lc, client, mount)
+		}
+	}
+
+	if err = client.SetBreaker(agentBreaker()); err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	a := newAgent(client, cmd.cacheTTL, login)
+	if err = a.start(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+
+	l, err := listenAgent(cmd.socket, 0600)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	defer os.Remove(cmd.socket)
+
+	var (
+		apiServer *http.Server
+		done      = make(chan error, 2)
+	)
+	if cmd.apiSocket != "" {
+		al, err := listenAgent(cmd.apiSocket, apiMode)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+		defer os.Remove(cmd.apiSocket)
+		apiServer = &http.Server{Handler: a.apiHandler(clients)}
+		go func() {
+			done <- apiServer.Serve(al)
+		}()
+		cmd.ui.Info(fmt.Sprintf("agent: serving the API for %d clients on %s", len(clients), cmd.apiSocket))
+	}
+
+	if cmd.pprofAddr != "" {
+		if err = checkPprofAddr(cmd.pprofAddr); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SyntaxError
+		}
+		if err = servePprof(cmd.pprofAddr); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	}
+
+	server := &http.Server{Handler: a.handler()}
+	go func() {
+		done <- server.Serve(l)
+	}()
+	cmd.ui.Info(fmt.Sprintf("agent: listening on %s", cmd.socket))
+	metrics.set(vaultUp, 1)
+	health.degraded = a.degraded
+	health.schedule(time.Now().Add(agentTick))
+	stopHealth, err := startHealth()
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	defer stopHealth()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	ticker := time.NewTicker(agentTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			a.maintain(now)
+		case <-interrupt:
+			server.Close()
+			if apiServer != nil {
+				apiServer.Close()
+			}
+			cmd.ui.Info("agent: stopped")
+			return Success
+		case <-shuttingDown():
+			// Finish the requests that are in flight, then stop
+			ctx, cancel := context.WithTimeout(context.Background(), DrainTimeout)
+			err = server.Shutdown(ctx)
+			if apiServer != nil {
+				if apiErr := apiServer.Shutdown(ctx); err == nil {
+					err = apiErr
+				}
+			}
+			cancel()
+			if err != nil {
+				cmd.ui.Warn(fmt.Sprintf("warning: agent: %v", err))
+			}
+			if cmd.revoke {
+				a.revoke()
+			}
+			cmd.ui.Info("agent: stopped")
+			return Success
+		case err = <-done:
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	}
+}
+
+func (cmd *AgentCommand) Synopsis() string {
+	return "run the agent"
+}
+
+func AgentCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &AgentCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("agent", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.socket, "socket", agentSocket(), "socket to listen on")
+		cmd.fs.DurationVar(&cmd.cacheTTL, "cache-ttl", agentCacheTTL, "time to cache secrets without a lease")
+		cmd.fs.StringVar(&cmd.method, "method", "", "login method to log in again (approle, aws, cert or kubernetes)")
+		cmd.fs.StringVar(&cmd.path, "path", "", "mount path of the auth method (default: method)")
+		cmd.fs.StringVar(&cmd.role, "role", "", "role (aws, cert, kubernetes)")
+		cmd.fs.StringVar(&cmd.apiSocket, "api-socket", "", "socket to serve the API for the clients in the configuration on (default: disabled)")
+		cmd.fs.StringVar(&cmd.apiMod, "api-mode", "0666", "mode of the API socket, clients authenticate with their key")
+		cmd.fs.BoolVar(&cmd.revoke, "revoke", false, "revoke the leases of the cached secrets on SIGTERM")
+		// Hidden, see servePprof
+		cmd.fs.StringVar(&cmd.pprofAddr, "pprof-addr", "", "")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
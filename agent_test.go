@@ -0,0 +1,266 @@
+package vc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgent(t *testing.T) {
+	requests := make(map[string]int)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method+" "+r.URL.Path]++
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/auth/token/lookup-self":
+			response = map[string]interface{}{"data": map[string]interface{}{"ttl": 3600, "renewable": true}}
+		case "PUT /v1/auth/token/renew-self", "POST /v1/auth/token/renew-self":
+			response = map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.test", "lease_duration": 3600, "renewable": true}}
+		case "GET /v1/secret/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "secret"}}
+		case "GET /v1/database/creds/app":
+			response = map[string]interface{}{"lease_id": "database/creds/app/1", "lease_duration": 60, "renewable": true,
+				"data": map[string]interface{}{"username": "v-app"}}
+		case "PUT /v1/sys/leases/renew", "POST /v1/sys/leases/renew":
+			response = map[string]interface{}{"lease_id": "database/creds/app/1", "lease_duration": 60, "renewable": true}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv", "database/": "database"})
+
+	a := newAgent(c, time.Minute, nil)
+	if err := a.start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := a.read("/secret/db", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := requests["GET /v1/secret/db"]; n != 1 {
+		t.Fatalf("expected 1 read of secret/db, got %d", n)
+	}
+	if _, err := a.read("/database/creds/app", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lease is renewed at two thirds of its duration, secrets without a
+	// lease expire after the cache TTL
+	a.maintain(time.Now().Add(45 * time.Second))
+	if requests["PUT /v1/sys/leases/renew"]+requests["POST /v1/sys/leases/renew"] != 1 {
+		t.Fatalf("expected lease renewal, got requests %v", requests)
+	}
+	a.maintain(time.Now().Add(90 * time.Second))
+	if _, ok := a.cache["/secret/db"]; ok {
+		t.Fatal("expected secret/db to expire")
+	}
+	if _, ok := a.cache["/database/creds/app"]; !ok {
+		t.Fatal("expected database/creds/app to be cached")
+	}
+	a.maintain(time.Now().Add(time.Hour))
+	if requests["PUT /v1/auth/token/renew-self"]+requests["POST /v1/auth/token/renew-self"] != 1 {
+		t.Fatalf("expected token renewal, got requests %v", requests)
+	}
+
+	dir, err := ioutil.TempDir(os.TempDir(), "agent")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := listenAgent(socket, 0600)
+	if err != nil {
+		t.Skip(err)
+	}
+	go http.Serve(l, a.handler())
+	defer l.Close()
+
+	if _, err = listenAgent(socket, 0600); err == nil {
+		t.Fatal("expected error for running agent")
+	}
+	token, err := agentToken(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "s.test" {
+		t.Fatalf("expected token s.test, got %q", token)
+	}
+
+	for path, want := range map[string]int{
+		"/v1/secret/secret/db":           http.StatusOK,
+		"/v1/secret/secret/missing":      http.StatusNotFound,
+		"/v1/secret/secret/db?version=x": http.StatusBadRequest,
+		"/metrics":                       http.StatusOK,
+	} {
+		res, err := agentClient(socket).Get("http://agent" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != want {
+			t.Fatalf("%s: expected status %d, got %s: %s", path, want, res.Status, b)
+		}
+		if path == "/v1/secret/secret/db" && !strings.Contains(string(b), `"password":"secret"`) {
+			t.Fatalf("%s: unexpected response %s", path, b)
+		}
+	}
+}
+
+func TestAgentDegraded(t *testing.T) {
+	var (
+		down  bool
+		reads int
+	)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/secret/db":
+			reads++
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "secret"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+	if err := c.SetBreaker(agentBreaker()); err != nil {
+		t.Fatal(err)
+	}
+
+	a := newAgent(c, time.Minute, nil)
+	if _, err := a.read("/secret/db", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// While Vault is unreachable, secrets are kept after their TTL
+	down = true
+	for i := 0; i < 3; i++ {
+		a.client.Read("secret/other")
+	}
+	if !a.degraded() {
+		t.Fatal("expected agent to be degraded")
+	}
+	a.maintain(time.Now().Add(2 * time.Minute))
+	a.cache["/secret/db"].expires = time.Now()
+	secret, err := a.read("/secret/db", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Data["password"] != "secret" {
+		t.Fatalf("expected cached secret, got %v", secret.Data)
+	}
+	if reads != 1 {
+		t.Fatalf("expected 1 read, got %d", reads)
+	}
+}
+
+func TestAgentAPI(t *testing.T) {
+	ReplaceCodec("agent-test", testCodec{})
+	var issued int
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/secret/app/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "secret"}}
+		case "GET /v1/secret/other":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "other"}}
+		case "GET /v1/secret/app/env":
+			response = map[string]interface{}{"data": map[string]interface{}{CodecTypeKey: "agent-test", "user": "app"}}
+		case "PUT /v1/pki/issue/web", "POST /v1/pki/issue/web":
+			issued++
+			response = map[string]interface{}{"data": map[string]interface{}{"serial_number": "01:02"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	sum := sha256.Sum256([]byte("app-key"))
+	certsSum := sha256.Sum256([]byte("certs-key"))
+	clients := []AgentClient{
+		{Name: "app", KeySHA256: hex.EncodeToString(sum[:]), Paths: []string{"secret/app"}},
+		{Name: "certs", KeySHA256: hex.EncodeToString(certsSum[:]), Paths: []string{"pki/issue/web"}},
+	}
+	if err := checkAgentClients(clients); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAgentClients([]AgentClient{{Name: "app", KeySHA256: "app-key", Paths: []string{"secret/app"}}}); err == nil {
+		t.Fatal("expected error for invalid key_sha256")
+	}
+	h := newAgent(c, time.Minute, nil).apiHandler(clients)
+
+	tests := []struct {
+		method, path, key, body string
+		want                    int
+		contains                string
+	}{
+		{"GET", "/v1/secret/secret/app/db", "", "", http.StatusUnauthorized, "invalid key"},
+		{"GET", "/v1/secret/secret/app/db", "other-key", "", http.StatusUnauthorized, "invalid key"},
+		{"GET", "/v1/secret/secret/app/db", "app-key", "", http.StatusOK, `"password":"secret"`},
+		{"GET", "/v1/secret/secret/other", "app-key", "", http.StatusForbidden, "permission denied"},
+		{"GET", "/v1/token", "app-key", "", http.StatusNotFound, ""},
+		{"GET", "/v1/render", "app-key", "", http.StatusMethodNotAllowed, ""},
+		{"POST", "/v1/render", "app-key", `password={{ secret "secret/app/db" "password" }}`, http.StatusOK, "password=secret"},
+		{"POST", "/v1/render", "app-key", `{{ secret "secret/app/../other" "password" }}`, http.StatusForbidden, "permission denied"},
+		{"POST", "/v1/render", "app-key", `{{ secret "secret/app/missing" "password" }}`, http.StatusNotFound, ""},
+		{"POST", "/v1/render", "app-key", `{{ secret`, http.StatusBadRequest, ""},
+		{"POST", "/v1/render", "app-key", `{{ env "HOME" }}`, http.StatusBadRequest, "not available"},
+		{"POST", "/v1/render", "app-key", `{{ (pkiCert "web" "web.example.com").serial_number }}`, http.StatusForbidden, "permission denied"},
+		{"POST", "/v1/render", "certs-key", `{{ (pkiCert "web" "web.example.com").serial_number }}`, http.StatusOK, "01:02"},
+		{"POST", "/v1/render", "certs-key", `{{ (pkiCert "pki/web/../db" "db.example.com").serial_number }}`, http.StatusForbidden, "permission denied"},
+		// Templates don't change the secrets in the cache
+		{"POST", "/v1/render", "app-key", `{{ decode "secret/app/env" }}`, http.StatusOK, `"user"`},
+		{"POST", "/v1/render", "app-key", `{{ decode "secret/app/env" }}`, http.StatusOK, `"user"`},
+		{"GET", "/v1/secret/secret/app/env", "app-key", "", http.StatusOK, CodecTypeKey},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.key != "" {
+			r.Header.Set("Authorization", "Bearer "+test.key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", test.method, test.path, test.want, w.Code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), test.contains) {
+			t.Fatalf("%s %s: expected %q in response %s", test.method, test.path, test.contains, w.Body)
+		}
+	}
+	if issued != 1 {
+		t.Fatalf("expected 1 certificate to be issued, got %d", issued)
+	}
+}
+
+func TestCheckPprofAddr(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"localhost:6060": true,
+		"127.0.0.1:6060": true,
+		"[::1]:6060":     true,
+		":6060":          false,
+		"0.0.0.0:6060":   false,
+		"10.0.0.1:6060":  false,
+		"vault:6060":     false,
+		"localhost":      false,
+	} {
+		if err := checkPprofAddr(addr); (err == nil) != ok {
+			t.Errorf("%s: expected ok %t, got %v", addr, ok, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package vc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// agentMaxTemplate is the maximum size of a template posted to the local API
+const agentMaxTemplate = 1 << 20
+
+// AgentConfig configures vc agent
+type AgentConfig struct {
+	// Clients are the applications that can use the local API of the agent,
+	// see AgentCommand
+	Clients []AgentClient `yaml:"clients,omitempty"`
+}
+
+// AgentClient is an application that can use the local API of the agent; it
+// authenticates with a key, and can read the secrets at or below Paths
+type AgentClient struct {
+	Name string `yaml:"name"`
+
+	// KeySHA256 is the SHA-256 hash of the key, hex encoded
+	KeySHA256 string `yaml:"key_sha256"`
+
+	// Paths are the secret paths the client can read, they may have glob
+	// patterns; secrets below the paths can be read too
+	Paths []string `yaml:"paths"`
+}
+
+// allowed checks if the client can read the secret at p
+func (c *AgentClient) allowed(p string) bool {
+	return matchPathPrefix(c.Paths, p)
+}
+
+// checkAgentClients checks the configuration of the clients of the local API
+func checkAgentClients(clients []AgentClient) error {
+	names := make(map[string]bool)
+	for i, c := range clients {
+		if c.Name == "" {
+			return fmt.Errorf("agent: client %d: name is required", i+1)
+		} else if names[c.Name] {
+			return fmt.Errorf("agent: client %s: duplicate name", c.Name)
+		}
+		names[c.Name] = true
+		if b, err := hex.DecodeString(c.KeySHA256); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("agent: client %s: key_sha256 is not a hex encoded SHA-256 hash", c.Name)
+		}
+		if len(c.Paths) == 0 {
+			return fmt.Errorf("agent: client %s: paths are required", c.Name)
+		}
+	}
+	return nil
+}
+
+// agentAuthenticate returns the client with the bearer token of the request as
+// its key, or nil
+func agentAuthenticate(clients []AgentClient, r *http.Request) *AgentClient {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(auth[7:])))
+	for i := range clients {
+		want, err := hex.DecodeString(clients[i].KeySHA256)
+		if err == nil && subtle.ConstantTimeCompare(sum[:], want) == 1 {
+			return &clients[i]
+		}
+	}
+	return nil
+}
+
+// apiHandler returns the local API of the agent, for the clients; unlike the
+// API on the socket of the agent, it doesn't expose the token:
+//
+//	GET  /v1/secret/<path>    the secret at path (?version=n for a version)
+//	POST /v1/render           the template in the body, rendered
+func (a *agentServer) apiHandler(clients []AgentClient) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/secret/", func(w http.ResponseWriter, r *http.Request) {
+		c := agentAuthenticate(clients, r)
+		if c == nil {
+			agentError(w, http.StatusUnauthorized, errors.New("invalid key"))
+			return
+		}
+		a.serveSecret(w, r, c.allowed)
+	})
+	mux.HandleFunc("/v1/render", func(w http.ResponseWriter, r *http.Request) {
+		c := agentAuthenticate(clients, r)
+		if c == nil {
+			agentError(w, http.StatusUnauthorized, errors.New("invalid key"))
+			return
+		} else if r.Method != "POST" {
+			agentError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		templating := r.URL.Query().Get("templating")
+		if templating == "" {
+			templating = "text"
+		}
+		text, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, agentMaxTemplate))
+		if err != nil {
+			agentError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+
+		content, err := a.render(c, string(text), templating)
+		switch {
+		case err != nil && ErrorKind(err) == ErrNotFound:
+			agentError(w, http.StatusNotFound, err)
+		case err != nil && ErrorKind(err) == ErrPermissionDenied:
+			agentError(w, http.StatusForbidden, err)
+		case err != nil && ErrorKind(err) != nil:
+			agentError(w, http.StatusBadGateway, err)
+		case err != nil:
+			agentError(w, http.StatusBadRequest, err)
+		default:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(content))
+		}
+		Debugf("agent: %s rendered a template: %v", c.Name, err)
+	})
+	return mux
+}
+
+// render renders the template text for the client, with the secrets the
+// client can read from the cache of the agent; certificates are issued only
+// for the roles in the paths of the client, such as pki/issue/web
+func (a *agentServer) render(c *AgentClient, text, templating string) (string, error) {
+	t := &TemplateCommand{baseCommand: baseCommand{c: a.client, config: new(Config)}, noEnv: true}
+	t.read = func(p string) (*api.Secret, error) {
+		p = path.Clean("/" + p)
+		if !c.allowed(p) {
+			return nil, &Error{Kind: ErrPermissionDenied, Err: fmt.Errorf("%s: permission denied", strings.TrimLeft(p, "/"))}
+		}
+		secret, err := a.read(p, 0)
+		if err != nil || secret == nil {
+			return secret, err
+		}
+
+		// A copy, because templates modify the data
+		copied := *secret
+		copied.Data = make(map[string]interface{}, len(secret.Data))
+		for key, value := range secret.Data {
+			copied.Data[key] = value
+		}
+		return &copied, nil
+	}
+	t.issue = func(p string, data map[string]interface{}) (*api.Secret, error) {
+		p = path.Clean("/" + p)
+		if !c.allowed(p) {
+			return nil, &Error{Kind: ErrPermissionDenied, Err: fmt.Errorf("%s: permission denied", strings.TrimLeft(p, "/"))}
+		}
+		return a.client.Write(strings.TrimLeft(p, "/"), data)
+	}
+	tmpl, err := t.parseTemplateText("render", text, templating)
+	if err != nil {
+		return "", err
+	}
+	return t.executeTemplate(tmpl)
+}
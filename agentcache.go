@@ -0,0 +1,25 @@
+package vc
+
+import (
+	"time"
+
+	"github.com/tehmaze/vc/client"
+)
+
+// Refresh makes reads through the cache of a Vault Agent reach Vault, see
+// client.AgentCache
+var Refresh bool
+
+// MaxAge is the maximum age of the responses from the cache of a Vault Agent,
+// zero accepts any age; see client.AgentCache
+var MaxAge time.Duration
+
+// setupAgentCache makes the reads of the client as fresh as --refresh and
+// --max-age require, if set
+func (cmd *baseCommand) setupAgentCache() error {
+	if !Refresh && MaxAge <= 0 {
+		return nil
+	}
+	Debugf("client: Vault Agent cache with refresh %t, max age %s", Refresh, MaxAge)
+	return cmd.c.SetAgentCache(client.AgentCache{MaxAge: MaxAge, Refresh: Refresh})
+}
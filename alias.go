@@ -0,0 +1,121 @@
+package vc
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mitchellh/cli"
+)
+
+// AliasCommand manages path aliases in the configuration file
+type AliasCommand struct {
+	baseCommand
+	fs  *flag.FlagSet
+	sub string
+}
+
+func (cmd *AliasCommand) Help() string {
+	switch cmd.sub {
+	case "add":
+		return "Usage: vc alias add <name> <secret path>"
+	case "rm":
+		return "Usage: vc alias rm <name>"
+	default:
+		return "Usage: vc alias list"
+	}
+}
+
+func (cmd *AliasCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	args = cmd.fs.Args()
+
+	config, err := cmd.Config()
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+
+	switch cmd.sub {
+	case "add":
+		if len(args) != 2 {
+			return Help
+		}
+		if args[0] == "" || strings.ContainsAny(args[0], "/@") {
+			cmd.ui.Error(fmt.Sprintf("error: invalid alias name %q", args[0]))
+			return SyntaxError
+		}
+		if config.Aliases == nil {
+			config.Aliases = make(map[string]string)
+		}
+		config.Aliases[args[0]] = args[1]
+
+	case "rm":
+		if len(args) != 1 {
+			return Help
+		}
+		if _, ok := config.Aliases[args[0]]; !ok {
+			cmd.ui.Error(fmt.Sprintf("error: no alias %q", args[0]))
+			return SyntaxError
+		}
+		delete(config.Aliases, args[0])
+
+	default:
+		if len(args) != 0 {
+			return Help
+		}
+		var names []string
+		for name := range config.Aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		w := tabwriter.NewWriter(cmd, 0, 8, 2, ' ', 0)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\n", name, config.Aliases[name])
+		}
+		if err = w.Flush(); err != nil {
+			cmd.ui.Error(err.Error())
+			return SystemError
+		}
+		return Success
+	}
+
+	if err = config.Save(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SystemError)
+	}
+	return Success
+}
+
+func (cmd *AliasCommand) Synopsis() string {
+	switch cmd.sub {
+	case "add":
+		return "add a path alias"
+	case "rm":
+		return "remove a path alias"
+	default:
+		return "list path aliases"
+	}
+}
+
+func AliasCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &AliasCommand{
+			sub: sub,
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("alias "+sub, flag.ContinueOnError)
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,376 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/tehmaze/vc/client"
+)
+
+// AppRoleCommand generates, lists and destroys the secret_ids of an AppRole
+// role
+type AppRoleCommand struct {
+	baseCommand
+	fs          *flag.FlagSet
+	sub         string
+	mount       string
+	metadata    stringsValue
+	cidr        string
+	ttl         time.Duration
+	numUses     int
+	wrapTTL     time.Duration
+	deliver     string
+	deliverPath string
+	force       bool
+}
+
+func (cmd *AppRoleCommand) Help() string {
+	switch cmd.sub {
+	case "generate":
+		return `Usage: vc approle generate [<options>] <role>
+
+Generate a secret_id for the AppRole role. The secret_id and its accessor are
+written to the output; with -wrap-ttl, the response is wrapped by Vault and
+only the wrapping token is written.
+
+With -deliver, the role_id and secret_id (or the wrapping token) are written to
+the cubbyhole of the token in the file instead, so only that token can read
+them; "-" reads the token from stdin.
+
+Options:
+` + defaults(cmd.fs)
+	case "list":
+		return `Usage: vc approle list [<options>] <role>
+
+List the secret_ids of the AppRole role by their accessor, with their creation
+and expiration time, remaining uses, CIDRs and metadata.
+
+Options:
+` + defaults(cmd.fs)
+	case "destroy":
+		return `Usage: vc approle destroy [<options>] <role> <accessor>...
+
+Destroy the secret_ids of the AppRole role with the accessors, after
+confirmation.
+
+Options:
+` + defaults(cmd.fs)
+	}
+	return `Usage: vc approle <generate|list|destroy> [<options>] <role>`
+}
+
+func (cmd *AppRoleCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	args = cmd.fs.Args()
+	if (cmd.sub == "destroy" && len(args) < 2) || (cmd.sub != "destroy" && len(args) != 1) {
+		return Help
+	}
+	if cmd.deliver != "" && cmd.out != "" {
+		cmd.ui.Error("error: -deliver and -o can't be combined")
+		return SyntaxError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	switch cmd.sub {
+	case "generate":
+		err = cmd.generate(client, args[0])
+	case "list":
+		err = cmd.list(client, args[0])
+	case "destroy":
+		err = cmd.destroy(client, args[0], args[1:])
+	default:
+		return Help
+	}
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	return Success
+}
+
+// rolePath returns the path of the role in the AppRole auth method
+func (cmd *AppRoleCommand) rolePath(role string) string {
+	return "auth/" + strings.Trim(cmd.mount, "/") + "/role/" + role
+}
+
+func (cmd *AppRoleCommand) generate(c *Client, role string) error {
+	data := map[string]interface{}{}
+	if len(cmd.metadata) > 0 {
+		metadata := make(map[string]string, len(cmd.metadata))
+		for _, pair := range cmd.metadata {
+			i := strings.IndexByte(pair, '=')
+			if i < 1 {
+				return fmt.Errorf("invalid -metadata %q, expected key=value", pair)
+			}
+			metadata[pair[:i]] = pair[i+1:]
+		}
+		b, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+		data["metadata"] = string(b)
+	}
+	if cmd.cidr != "" {
+		data["cidr_list"] = cmd.cidr
+	}
+	if cmd.ttl > 0 {
+		data["ttl"] = cmd.ttl.String()
+	}
+	if cmd.numUses > 0 {
+		data["num_uses"] = cmd.numUses
+	}
+
+	var target string
+	if cmd.deliver != "" {
+		var err error
+		if target, err = readDeliverToken(cmd.deliver); err != nil {
+			return err
+		}
+	}
+	if DryRun {
+		cmd.ui.Output("dry run: generate a secret_id for role " + role)
+		return nil
+	}
+
+	path := cmd.rolePath(role) + "/secret-id"
+	if cmd.wrapTTL > 0 {
+		c.SetWrappingLookupFunc(func(operation, p string) string {
+			if p == path {
+				return cmd.wrapTTL.String()
+			}
+			return ""
+		})
+		defer c.SetWrappingLookupFunc(nil)
+	}
+	secret, err := c.Write(path, data)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{})
+	if cmd.wrapTTL > 0 {
+		if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+			return errors.New("no wrapping token returned")
+		}
+		values["wrapping_token"] = secret.WrapInfo.Token
+		values["secret_id_accessor"] = secret.WrapInfo.WrappedAccessor
+	} else {
+		if secret == nil || secret.Data["secret_id"] == nil {
+			return errors.New("no secret_id returned")
+		}
+		values["secret_id"] = secret.Data["secret_id"]
+		values["secret_id_accessor"] = secret.Data["secret_id_accessor"]
+	}
+	defer func() {
+		for key := range values {
+			delete(values, key)
+		}
+	}()
+
+	if target != "" {
+		return cmd.deliverTo(c, role, target, values)
+	}
+
+	b := new(secureBuffer)
+	defer b.Wipe()
+	if cmd.wrapTTL > 0 {
+		fmt.Fprintf(b, "Wrapping token: %s\n", values["wrapping_token"])
+		fmt.Fprintf(b, "\nThe wrapping token expires in %s, unwrap with: vault unwrap <token>\n", cmd.wrapTTL)
+	} else {
+		fmt.Fprintf(b, "Secret ID: %s\n", values["secret_id"])
+		fmt.Fprintf(b, "Secret ID accessor: %s\n", values["secret_id_accessor"])
+	}
+	if _, err = cmd.Write(b.Bytes()); err != nil {
+		cmd.abort()
+		return err
+	}
+	return cmd.Close()
+}
+
+// deliverTo writes the role_id and the values to the cubbyhole of the target
+// token
+func (cmd *AppRoleCommand) deliverTo(c *Client, role, target string, values map[string]interface{}) error {
+	secret, err := c.Read(cmd.rolePath(role) + "/role-id")
+	if err != nil {
+		return err
+	} else if secret == nil || secret.Data["role_id"] == nil {
+		return notFound("no role_id for role " + role)
+	}
+	values["role_id"] = secret.Data["role_id"]
+
+	path := cmd.deliverPath
+	if path == "" {
+		path = "approle/" + role
+	}
+	path = "cubbyhole/" + strings.Trim(path, "/")
+	delivery, err := c.Clone()
+	if err != nil {
+		return err
+	}
+	delivery.SetToken(target)
+	if _, err = delivery.Logical().Write(path, values); err != nil {
+		return client.Classify(err)
+	}
+	cmd.ui.Output(cmd.colors(os.Stdout).change(fmt.Sprintf("+ %s (accessor %s)", path, values["secret_id_accessor"])))
+	return nil
+}
+
+// readDeliverToken reads the token to deliver to from the file name, or from
+// stdin for "-"
+func readDeliverToken(name string) (string, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if name == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("no token in %s", name)
+	}
+	return token, nil
+}
+
+func (cmd *AppRoleCommand) list(c *Client, role string) error {
+	secret, err := c.List(cmd.rolePath(role) + "/secret-id")
+	if err != nil {
+		return err
+	} else if secret == nil {
+		return nil
+	}
+	accessors := identityStrings(secret.Data["keys"])
+
+	var (
+		b = new(bytes.Buffer)
+		w = tabwriter.NewWriter(b, 0, 8, 2, ' ', 0)
+	)
+	fmt.Fprintln(w, "ACCESSOR\tCREATED\tEXPIRES\tUSES\tCIDR\tMETADATA")
+	for _, accessor := range accessors {
+		secret, err := c.Write(cmd.rolePath(role)+"/secret-id-accessor/lookup", map[string]interface{}{
+			"secret_id_accessor": accessor,
+		})
+		if err != nil {
+			return err
+		} else if secret == nil {
+			continue
+		}
+		uses := "unlimited"
+		if n, _ := parseInt(secret.Data["secret_id_num_uses"]); n > 0 {
+			uses = fmt.Sprint(n)
+		}
+		metadata, _ := secret.Data["metadata"].(map[string]interface{})
+		pairs := make([]string, 0, len(metadata))
+		for _, key := range sortedKeys(metadata) {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", key, metadata[key]))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", accessor,
+			approleTime(secret.Data["creation_time"]), approleTime(secret.Data["expiration_time"]),
+			uses, identityList(identityStrings(secret.Data["cidr_list"])), identityList(pairs))
+	}
+	w.Flush()
+	cmd.ui.Output(strings.TrimSuffix(b.String(), "\n"))
+	return nil
+}
+
+// approleTime formats a time in a secret_id lookup; the zero time is never
+func approleTime(v interface{}) string {
+	s, _ := v.(string)
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil || t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func (cmd *AppRoleCommand) destroy(c *Client, role string, accessors []string) error {
+	changes := make([]string, len(accessors))
+	for i, accessor := range accessors {
+		changes[i] = "- " + accessor
+	}
+	if ok, err := cmd.confirmChanges(cmd.force, changes, "Destroy %d secret_id(s) of role %s?", len(accessors), role); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("not confirmed, no secret_ids are destroyed")
+	}
+	for _, accessor := range accessors {
+		if DryRun {
+			cmd.ui.Output("dry run: destroy secret_id " + accessor)
+			continue
+		}
+		if _, err := c.Write(cmd.rolePath(role)+"/secret-id-accessor/destroy", map[string]interface{}{
+			"secret_id_accessor": accessor,
+		}); err != nil {
+			return fmt.Errorf("%s: %v", accessor, err)
+		}
+		cmd.ui.Output(cmd.colors(os.Stdout).change("- " + accessor))
+	}
+	return nil
+}
+
+func (cmd *AppRoleCommand) Synopsis() string {
+	switch cmd.sub {
+	case "generate":
+		return "generate a secret_id for an AppRole role"
+	case "list":
+		return "list the secret_ids of an AppRole role"
+	case "destroy":
+		return "destroy secret_ids of an AppRole role"
+	}
+	return "manage the secret_ids of AppRole roles"
+}
+
+func AppRoleCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &AppRoleCommand{
+			baseCommand: baseCommand{
+				ui:   ui,
+				mode: 0600,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("approle "+sub, flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.mount, "mount", "approle", "mount path of the AppRole auth method")
+		switch sub {
+		case "generate":
+			cmd.fs.Var(&cmd.metadata, "metadata", "key=value metadata of the secret_id, can be repeated")
+			cmd.fs.StringVar(&cmd.cidr, "cidr", "", "CIDRs that can use the secret_id, separated by commas")
+			cmd.fs.DurationVar(&cmd.ttl, "ttl", 0, "TTL of the secret_id (default: the TTL of the role)")
+			cmd.fs.IntVar(&cmd.numUses, "num-uses", 0, "number of uses of the secret_id (default: the uses of the role)")
+			cmd.fs.DurationVar(&cmd.wrapTTL, "wrap-ttl", 0, "response wrap the secret_id, for ttl")
+			cmd.fs.StringVar(&cmd.deliver, "deliver", "", "file with the token to deliver the secret_id to, in its cubbyhole")
+			cmd.fs.StringVar(&cmd.deliverPath, "deliver-path", "", "cubbyhole path to deliver to (default: approle/<role>)")
+			cmd.fs.StringVar(&cmd.out, "o", "", "output (default: stdout)")
+		case "destroy":
+			cmd.fs.BoolVar(&cmd.force, "f", false, "don't ask for confirmation")
+		}
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,116 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestAppRoleCommand(t *testing.T) {
+	var (
+		destroyed []string
+		delivered map[string]interface{}
+	)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			request  map[string]interface{}
+			response interface{}
+		)
+		json.NewDecoder(r.Body).Decode(&request)
+		switch r.Method + " " + r.URL.Path {
+		case "PUT /v1/auth/approle/role/ci/secret-id", "POST /v1/auth/approle/role/ci/secret-id":
+			if r.Header.Get("X-Vault-Wrap-TTL") != "" {
+				response = map[string]interface{}{"wrap_info": map[string]interface{}{
+					"token": "s.wrapped", "wrapped_accessor": "acc1", "ttl": 300,
+				}}
+			} else {
+				response = map[string]interface{}{"data": map[string]interface{}{
+					"secret_id": "sid1", "secret_id_accessor": "acc1",
+				}}
+			}
+		case "GET /v1/auth/approle/role/ci/role-id":
+			response = map[string]interface{}{"data": map[string]interface{}{"role_id": "rid"}}
+		case "LIST /v1/auth/approle/role/ci/secret-id", "GET /v1/auth/approle/role/ci/secret-id":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"acc1"}}}
+		case "PUT /v1/auth/approle/role/ci/secret-id-accessor/lookup", "POST /v1/auth/approle/role/ci/secret-id-accessor/lookup":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"creation_time":      "2020-01-02T03:04:05Z",
+				"expiration_time":    "0001-01-01T00:00:00Z",
+				"secret_id_num_uses": 3,
+				"cidr_list":          []string{"10.0.0.0/8"},
+				"metadata":           map[string]string{"team": "ops"},
+			}}
+		case "PUT /v1/auth/approle/role/ci/secret-id-accessor/destroy", "POST /v1/auth/approle/role/ci/secret-id-accessor/destroy":
+			destroyed = append(destroyed, request["secret_id_accessor"].(string))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "PUT /v1/cubbyhole/approle/ci", "POST /v1/cubbyhole/approle/ci":
+			if r.Header.Get("X-Vault-Token") != "s.target" {
+				w.WriteHeader(http.StatusForbidden)
+				response = map[string]interface{}{"errors": []string{"permission denied"}}
+				break
+			}
+			delivered = request
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), nil)
+
+	dir, err := ioutil.TempDir("", "vc-approle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "token")
+	if err = ioutil.WriteFile(target, []byte("s.target\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(sub string, args ...string) string {
+		ui := cli.NewMockUi()
+		command, _ := AppRoleCommandFactory(ui, sub)()
+		cmd := command.(*AppRoleCommand)
+		cmd.c, cmd.config = c, new(Config)
+		if code := cmd.Run(args); code != Success {
+			t.Fatalf("%s %v: expected success, got %d: %s", sub, args, code, ui.ErrorWriter.String())
+		}
+		return ui.OutputWriter.String()
+	}
+
+	out := filepath.Join(dir, "secret-id")
+	run("generate", "-metadata", "team=ops", "-o", out, "ci")
+	if b, _ := ioutil.ReadFile(out); string(b) != "Secret ID: sid1\nSecret ID accessor: acc1\n" {
+		t.Fatalf("generate: unexpected output %q", b)
+	}
+	run("generate", "-wrap-ttl", "5m", "-o", out, "ci")
+	if b, _ := ioutil.ReadFile(out); string(b) != "Wrapping token: s.wrapped\n\nThe wrapping token expires in 5m0s, unwrap with: vault unwrap <token>\n" {
+		t.Fatalf("generate -wrap-ttl: unexpected output %q", b)
+	}
+
+	if got := run("generate", "-deliver", target, "ci"); got != "+ cubbyhole/approle/ci (accessor acc1)\n" {
+		t.Fatalf("generate -deliver: unexpected output %q", got)
+	}
+	if delivered["role_id"] != "rid" || delivered["secret_id"] != "sid1" {
+		t.Fatalf("generate -deliver: unexpected delivery %v", delivered)
+	}
+
+	if got, expect := run("list", "ci"), "ACCESSOR  CREATED"; len(got) < len(expect) || got[:len(expect)] != expect {
+		t.Fatalf("list: unexpected output %q", got)
+	} else if want := "  never    3     10.0.0.0/8  team=ops\n"; got[len(got)-len(want):] != want {
+		t.Fatalf("list: unexpected output %q", got)
+	}
+
+	run("destroy", "-f", "ci", "acc1", "acc2")
+	if len(destroyed) != 2 || destroyed[0] != "acc1" || destroyed[1] != "acc2" {
+		t.Fatalf("destroy: unexpected %v", destroyed)
+	}
+}
@@ -0,0 +1,433 @@
+package vc
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// auditHMACPrefix prefixes the values that Vault hashes in audit logs
+const auditHMACPrefix = "hmac-sha256:"
+
+// auditPollInterval is how often a followed audit log is checked for new
+// entries
+var auditPollInterval = 250 * time.Millisecond
+
+// auditEntry is an entry of a Vault audit log, without the parts vc doesn't
+// show
+type auditEntry struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	Auth struct {
+		Accessor    string   `json:"accessor"`
+		DisplayName string   `json:"display_name"`
+		Policies    []string `json:"policies"`
+		EntityID    string   `json:"entity_id"`
+	} `json:"auth"`
+	Request struct {
+		Operation     string `json:"operation"`
+		Path          string `json:"path"`
+		RemoteAddress string `json:"remote_address"`
+		Namespace     struct {
+			Path string `json:"path"`
+		} `json:"namespace"`
+	} `json:"request"`
+	Error string `json:"error"`
+}
+
+// path returns the path of the request, with its namespace
+func (entry *auditEntry) path() string {
+	if ns := strings.Trim(entry.Request.Namespace.Path, "/"); ns != "" {
+		return ns + "/" + entry.Request.Path
+	}
+	return entry.Request.Path
+}
+
+// AuditCommand streams and filters the entries of a Vault audit device
+type AuditCommand struct {
+	baseCommand
+	fs         *flag.FlagSet
+	sub        string
+	follow     bool
+	listen     string
+	path       string
+	accessor   string
+	operations string
+	device     string
+	requests   bool
+	raw        bool
+
+	// hashed is the accessor hashed by the audit device, see matchHMAC
+	hashed string
+}
+
+func (cmd *AuditCommand) Help() string {
+	return `Usage: vc audit tail [<options>] [<file>]
+
+Print the entries of a Vault audit log, from a file device (or stdin if no
+file is given, or "-"), or received as a socket device with -listen, filtered
+by path, token accessor and operation. With -f, the file is followed for new
+entries, like tail -f.
+
+Path patterns match a single path element with * and ?; paths of KV v2
+secrets include data/ or metadata/ after the mount. Vault hashes token
+accessors in the audit log, unless the device has hmac_accessor=false; hashed
+accessors are matched by hashing -accessor with the audit device -device,
+which needs a token with access to sys/audit-hash.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *AuditCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.fs.Args(); len(args) > 1 || cmd.sub != "tail" {
+		return Help
+	}
+	if cmd.listen != "" && len(args) > 0 {
+		cmd.ui.Error("error: -listen and a file are exclusive")
+		return SyntaxError
+	}
+	if cmd.path != "" {
+		if _, err := path.Match(cmd.path, ""); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: invalid path pattern %q: %v", cmd.path, err))
+			return SyntaxError
+		}
+	}
+
+	if cmd.listen != "" {
+		return cmd.serve()
+	}
+
+	var name string
+	if len(args) == 1 {
+		name = args[0]
+	}
+	if err := cmd.tail(name); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SystemError)
+	}
+	return Success
+}
+
+// tail prints the entries of the audit log file name, or stdin
+func (cmd *AuditCommand) tail(name string) error {
+	if name == "" || name == "-" {
+		return cmd.read(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if !cmd.follow {
+		return cmd.read(f)
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A partial line is read again once it is complete
+			if _, err = f.Seek(-int64(len(line)), io.SeekCurrent); err != nil {
+				return err
+			}
+			select {
+			case <-shuttingDown():
+				return nil
+			case <-time.After(auditPollInterval):
+			}
+			if f, err = cmd.reopen(f, name); err != nil {
+				return err
+			}
+			r.Reset(f)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err = cmd.print(line); err != nil {
+			return err
+		}
+	}
+}
+
+// reopen opens the audit log again if it was rotated or truncated
+func (cmd *AuditCommand) reopen(f *os.File, name string) (*os.File, error) {
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	current, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		// Rotated, but not created yet
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if os.SameFile(current, fi) {
+		if fi.Size() < offset {
+			Debugf("audit: %s was truncated", name)
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		return f, err
+	}
+
+	Debugf("audit: %s was rotated", name)
+	next, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	// This may miss the last entries written to the rotated file
+	f.Close()
+	return next, nil
+}
+
+// serve receives the entries as a socket audit device, until shutdown
+func (cmd *AuditCommand) serve() int {
+	network := "tcp"
+	if strings.Contains(cmd.listen, "/") {
+		network = "unix"
+	}
+	l, err := net.Listen(network, cmd.listen)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	defer l.Close()
+	cmd.ui.Info(fmt.Sprintf("audit: listening on %s, enable the device with: vault audit enable socket address=%s socket_type=%s", l.Addr(), l.Addr(), network))
+
+	entries := make(chan []byte)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				Debugf("audit: %v", err)
+				return
+			}
+			Debugf("audit: connection from %s", conn.RemoteAddr())
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadBytes('\n')
+					if len(line) > 0 {
+						entries <- line
+					}
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	// Entries are printed one at a time, as they arrive
+	for {
+		select {
+		case <-shuttingDown():
+			return Success
+		case line := <-entries:
+			if err := cmd.print(line); err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %v", err))
+				return exitCode(err, ServerError)
+			}
+		}
+	}
+}
+
+// read prints the entries read from r
+func (cmd *AuditCommand) read(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	// Responses with large secrets are on a single line
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for s.Scan() {
+		if stopping() {
+			return nil
+		}
+		if err := cmd.print(s.Bytes()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// print prints the entry in line, if it matches the filters; lines that are
+// not entries are skipped
+func (cmd *AuditCommand) print(line []byte) error {
+	line = []byte(strings.TrimSpace(string(line)))
+	if len(line) == 0 {
+		return nil
+	}
+	var entry auditEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		Debugf("audit: skipping invalid entry: %v", err)
+		return nil
+	}
+	if ok, err := cmd.match(&entry); err != nil || !ok {
+		return err
+	}
+	if cmd.raw {
+		cmd.ui.Output(string(line))
+		return nil
+	}
+	cmd.ui.Output(cmd.format(&entry))
+	return nil
+}
+
+// match checks if the entry matches the filters
+func (cmd *AuditCommand) match(entry *auditEntry) (bool, error) {
+	if entry.Type != "response" && !(cmd.requests && entry.Type == "request") {
+		return false, nil
+	}
+	if cmd.operations != "" && !auditOperation(cmd.operations, entry.Request.Operation) {
+		return false, nil
+	}
+	if cmd.path != "" && !auditPath(cmd.path, entry.path()) {
+		return false, nil
+	}
+	if cmd.accessor != "" {
+		return cmd.matchHMAC(entry.Auth.Accessor)
+	}
+	return true, nil
+}
+
+// matchHMAC checks if the accessor in the audit log is the -accessor; hashed
+// accessors are compared with the -accessor hashed by the audit device
+func (cmd *AuditCommand) matchHMAC(accessor string) (bool, error) {
+	if !strings.HasPrefix(accessor, auditHMACPrefix) {
+		return accessor == cmd.accessor, nil
+	}
+	if cmd.hashed == "" {
+		client, err := cmd.Client()
+		if err != nil {
+			return false, err
+		}
+		if cmd.hashed, err = auditHash(client, cmd.device, cmd.accessor); err != nil {
+			return false, fmt.Errorf("hashing the accessor with audit device %s: %v", cmd.device, err)
+		}
+		Debugf("audit: accessor %s is %s", cmd.accessor, cmd.hashed)
+	}
+	return accessor == cmd.hashed, nil
+}
+
+// auditHash hashes input with the HMAC key of the audit device, the way the
+// device hashes the values it logs
+func auditHash(client *Client, device, input string) (string, error) {
+	secret, err := client.Write("sys/audit-hash/"+strings.Trim(device, "/"), map[string]interface{}{
+		"input": input,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("no hash returned")
+	}
+	hash, _ := secret.Data["hash"].(string)
+	if hash == "" {
+		return "", fmt.Errorf("no hash returned")
+	}
+	return hash, nil
+}
+
+// auditOperation checks if operation is one of the operations, separated by
+// commas
+func auditOperation(operations, operation string) bool {
+	for _, name := range strings.Split(operations, ",") {
+		if strings.TrimSpace(name) == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// auditPath checks if the path of a request matches the pattern, or is below
+// it
+func auditPath(pattern, p string) bool {
+	pattern, p = strings.Trim(pattern, "/"), strings.Trim(p, "/")
+	for {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			return false
+		}
+		p = p[:i]
+	}
+}
+
+// format formats an entry as a single line
+func (cmd *AuditCommand) format(entry *auditEntry) string {
+	var (
+		colors = cmd.colors(os.Stdout)
+		fields = []string{entry.Time.UTC().Format(time.RFC3339), entry.Request.Operation, entry.path()}
+	)
+	if entry.Type == "request" {
+		fields[1] = "request " + fields[1]
+	}
+	if entry.Auth.DisplayName != "" {
+		fields = append(fields, "name="+entry.Auth.DisplayName)
+	}
+	if entry.Auth.Accessor != "" {
+		fields = append(fields, "accessor="+entry.Auth.Accessor)
+	}
+	if entry.Auth.EntityID != "" {
+		fields = append(fields, "entity="+entry.Auth.EntityID)
+	}
+	if len(entry.Auth.Policies) > 0 {
+		fields = append(fields, "policies="+strings.Join(entry.Auth.Policies, ","))
+	}
+	if entry.Request.RemoteAddress != "" {
+		fields = append(fields, "remote="+entry.Request.RemoteAddress)
+	}
+	line := strings.Join(fields, " ")
+	if entry.Error != "" {
+		line += " " + colors.paint("error", "error="+strings.Join(strings.Fields(entry.Error), " "))
+	}
+	return line
+}
+
+func (cmd *AuditCommand) Synopsis() string {
+	return "print the entries of a Vault audit log"
+}
+
+func AuditCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &AuditCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("audit "+sub, flag.ContinueOnError)
+		cmd.fs.BoolVar(&cmd.follow, "f", false, "follow the file for new entries")
+		cmd.fs.StringVar(&cmd.listen, "listen", "", "receive entries as a socket audit device on address (host:port, or a unix socket path)")
+		cmd.fs.StringVar(&cmd.path, "path", "", "only entries for paths matching the pattern, or below it")
+		cmd.fs.StringVar(&cmd.accessor, "accessor", "", "only entries for the token accessor")
+		cmd.fs.StringVar(&cmd.operations, "op", "", "only entries for the operations, separated by commas (such as read,list,update,delete)")
+		cmd.fs.StringVar(&cmd.device, "device", "file", "audit device that hashes -accessor")
+		cmd.fs.BoolVar(&cmd.requests, "requests", false, "include request entries, not only responses")
+		cmd.fs.BoolVar(&cmd.raw, "json", false, "print the entries as JSON")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,82 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+const testAuditLog = `{"time":"2018-06-01T12:00:00Z","type":"request","auth":{"accessor":"hmac-sha256:ci"},"request":{"operation":"read","path":"secret/data/app/db"}}
+{"time":"2018-06-01T12:00:00Z","type":"response","auth":{"accessor":"hmac-sha256:ci","display_name":"approle-ci","policies":["ci"]},"request":{"operation":"read","path":"secret/data/app/db","remote_address":"10.0.0.1"}}
+{"time":"2018-06-01T12:01:00Z","type":"response","auth":{"accessor":"hmac-sha256:dev","display_name":"oidc-dev"},"request":{"operation":"list","path":"secret/metadata/app"}}
+not an entry
+{"time":"2018-06-01T12:02:00Z","type":"response","auth":{"accessor":"hmac-sha256:dev","display_name":"oidc-dev"},"request":{"operation":"update","path":"secret/data/app/db","namespace":{"path":"team/"}},"error":"1 error occurred:\n\t* permission denied\n\n"}
+`
+
+func TestAuditCommand(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "audit")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "audit.log")
+	if err = ioutil.WriteFile(name, []byte(testAuditLog), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake audit device, that hashes the accessors
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/audit-hash/file" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var data map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+			"hash": auditHMACPrefix + strings.TrimPrefix(data["input"], "accessor-"),
+		}})
+	}), nil)
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{
+			"2018-06-01T12:00:00Z read secret/data/app/db name=approle-ci accessor=hmac-sha256:ci policies=ci remote=10.0.0.1",
+			"2018-06-01T12:01:00Z list secret/metadata/app name=oidc-dev accessor=hmac-sha256:dev",
+			"2018-06-01T12:02:00Z update team/secret/data/app/db name=oidc-dev accessor=hmac-sha256:dev error=1 error occurred: * permission denied",
+		}},
+		{[]string{"-path", "secret/data/app"}, []string{
+			"2018-06-01T12:00:00Z read secret/data/app/db name=approle-ci accessor=hmac-sha256:ci policies=ci remote=10.0.0.1",
+		}},
+		{[]string{"-path", "*/secret/data/*/db", "-op", "update,delete"}, []string{
+			"2018-06-01T12:02:00Z update team/secret/data/app/db name=oidc-dev accessor=hmac-sha256:dev error=1 error occurred: * permission denied",
+		}},
+		{[]string{"-accessor", "accessor-ci", "-requests"}, []string{
+			"2018-06-01T12:00:00Z request read secret/data/app/db accessor=hmac-sha256:ci",
+			"2018-06-01T12:00:00Z read secret/data/app/db name=approle-ci accessor=hmac-sha256:ci policies=ci remote=10.0.0.1",
+		}},
+	}
+	for _, test := range tests {
+		ui := cli.NewMockUi()
+		factory := AuditCommandFactory(ui, "tail")
+		command, _ := factory()
+		cmd := command.(*AuditCommand)
+		cmd.c, cmd.config = c, new(Config)
+		if code := cmd.Run(append(test.args, name)); code != Success {
+			t.Fatalf("%v: expected success, got %d: %s", test.args, code, ui.ErrorWriter.String())
+		}
+		if got := strings.Split(strings.TrimSuffix(ui.OutputWriter.String(), "\n"), "\n"); !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("%v: expected\n%s\ngot\n%s", test.args, strings.Join(test.want, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package vc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// awsCredentials are the access keys used to sign requests to AWS
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"Token"`
+}
+
+// awsClient talks to an AWS service using the JSON protocol
+type awsClient struct {
+	service  string
+	target   string
+	region   string
+	endpoint string
+	creds    awsCredentials
+	client   *http.Client
+}
+
+// newAWSClient configures a client for service in region; target is the
+// prefix of the X-Amz-Target header, such as "secretsmanager". The profile
+// and region default to the environment and the shared configuration files.
+func newAWSClient(service, target, profile, region string) (*awsClient, error) {
+	if profile == "" {
+		if profile = os.Getenv("AWS_PROFILE"); profile == "" {
+			profile = "default"
+		}
+	}
+	if region == "" {
+		region = awsRegion(profile)
+	}
+	if region == "" {
+		return nil, errors.New("aws: no region, use -region or set AWS_REGION")
+	}
+	creds, err := loadAWSCredentials(profile)
+	if err != nil {
+		return nil, fmt.Errorf("aws: %v", err)
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = "https://" + service + "." + region + ".amazonaws.com"
+	}
+	return &awsClient{
+		service:  service,
+		target:   target,
+		region:   region,
+		endpoint: strings.TrimRight(endpoint, "/") + "/",
+		creds:    creds,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// awsConfigFile returns the name of a shared configuration file, name is
+// "config" or "credentials"
+func awsConfigFile(name string) string {
+	env := "AWS_CONFIG_FILE"
+	if name == "credentials" {
+		env = "AWS_SHARED_CREDENTIALS_FILE"
+	}
+	if file := os.Getenv(env); file != "" {
+		return file
+	}
+	return os.ExpandEnv("$HOME/.aws/" + name)
+}
+
+// readAWSConfig returns the settings in section of the ini file name; missing
+// files result in no settings
+func readAWSConfig(name, section string) map[string]string {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var (
+		values  = make(map[string]string)
+		current string
+		scanner = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[':
+			current = strings.TrimSpace(strings.Trim(line, "[]"))
+		case current == section:
+			if i := strings.IndexByte(line, '='); i != -1 {
+				values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	return values
+}
+
+// awsRegion returns the region from the environment or the configuration of
+// profile
+func awsRegion(profile string) string {
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(env); region != "" {
+			return region
+		}
+	}
+	section := "profile " + profile
+	if profile == "default" {
+		section = profile
+	}
+	return readAWSConfig(awsConfigFile("config"), section)["region"]
+}
+
+// loadAWSCredentials returns the credentials from the environment, the shared
+// credentials file or the EC2 instance role, in that order
+func loadAWSCredentials(profile string) (awsCredentials, error) {
+	creds := awsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID != "" && creds.SecretAccessKey != "" {
+		return creds, nil
+	}
+
+	if values := readAWSConfig(awsConfigFile("credentials"), profile); values["aws_access_key_id"] != "" {
+		Debugf("aws: using credentials of profile %s", profile)
+		return awsCredentials{
+			AccessKeyID:     values["aws_access_key_id"],
+			SecretAccessKey: values["aws_secret_access_key"],
+			SessionToken:    values["aws_session_token"],
+		}, nil
+	}
+
+	role, err := ec2Metadata(ec2CredentialsURL)
+	if err != nil {
+		return creds, fmt.Errorf("no credentials found: %v", err)
+	}
+	Debugf("aws: using credentials of instance role %s", role)
+	b, err := ec2Metadata(ec2CredentialsURL + strings.TrimSpace(string(role)))
+	if err != nil {
+		return creds, err
+	}
+	err = json.Unmarshal(b, &creds)
+	return creds, err
+}
+
+// call invokes action with input in, and decodes the output into out
+func (c *awsClient) call(action string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	r.Header.Set("X-Amz-Target", c.target+"."+action)
+	signAWS(r, body, c.creds, c.region, c.service, time.Now())
+
+	Debugf("aws: %s %s", c.service, action)
+	res, err := c.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode/100 == 2 {
+		if out == nil || len(b) == 0 {
+			return nil
+		}
+		return json.Unmarshal(b, out)
+	}
+
+	var status struct {
+		Type         string `json:"__type"`
+		Message      string `json:"message"`
+		MessageUpper string `json:"Message"`
+	}
+	json.Unmarshal(b, &status)
+	if status.Message == "" {
+		status.Message = status.MessageUpper
+	}
+	// Types may be prefixed with a namespace, such as "com.amazon.coral.service#"
+	if i := strings.LastIndexByte(status.Type, '#'); i != -1 {
+		status.Type = status.Type[i+1:]
+	}
+	err = fmt.Errorf("%s: %s: %s: %s", c.service, action, status.Type, status.Message)
+	switch status.Type {
+	case "ResourceNotFoundException", "ParameterNotFound":
+		return &Error{Kind: ErrNotFound, Err: err}
+	case "AccessDeniedException", "UnrecognizedClientException", "ExpiredTokenException":
+		return &Error{Kind: ErrPermissionDenied, Err: err}
+	case "ResourceExistsException", "ParameterAlreadyExists":
+		return &Error{Kind: ErrVersionConflict, Err: err}
+	}
+	return err
+}
+
+// signAWS signs the request with Signature Version 4, see
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func signAWS(r *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	var (
+		amzDate = now.UTC().Format("20060102T150405Z")
+		date    = amzDate[:8]
+		scope   = date + "/" + region + "/" + service + "/aws4_request"
+	)
+	r.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Canonical headers: host, content-type and all x-amz-* headers
+	headers := map[string]string{"host": r.URL.Host}
+	if r.Host != "" {
+		headers["host"] = r.Host
+	}
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// Canonical query string, sorted by key and value
+	query := r.URL.Query()
+	var params []string
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(params)
+
+	uri := r.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	payload := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		r.Method,
+		uri,
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = awsHMAC(key, part)
+	}
+	signature := hex.EncodeToString(awsHMAC(key, toSign))
+
+	r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func awsHMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape percent-encodes s, leaving only the unreserved characters of
+// RFC 3986
+func awsEscape(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,135 @@
+package vc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAWS(t *testing.T) {
+	// Example from the AWS General Reference, signing a ListUsers request
+	r, err := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signAWS(r, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := r.Header.Get("Authorization"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestAWSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "aws")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "config")
+	if err = ioutil.WriteFile(name, []byte(strings.Join([]string{
+		"[default]",
+		"region = eu-west-1",
+		"",
+		"; comment",
+		"[profile prod]",
+		"region=us-east-2",
+	}, "\n")), 0600); err != nil {
+		t.Skip(err)
+	}
+
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_CONFIG_FILE"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Unsetenv(env)
+	}
+	os.Setenv("AWS_CONFIG_FILE", name)
+
+	if region := awsRegion("default"); region != "eu-west-1" {
+		t.Fatalf("expected region eu-west-1, got %q", region)
+	}
+	if region := awsRegion("prod"); region != "us-east-2" {
+		t.Fatalf("expected region us-east-2, got %q", region)
+	}
+	os.Setenv("AWS_REGION", "ap-south-1")
+	if region := awsRegion("prod"); region != "ap-south-1" {
+		t.Fatalf("expected region ap-south-1, got %q", region)
+	}
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDTEST/") {
+			t.Errorf("expected signed request, got %q", r.Header.Get("Authorization"))
+		}
+		var in map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&in)
+		switch r.Header.Get("X-Amz-Target") {
+		case "secretsmanager.ListSecrets":
+			if in["NextToken"] == nil {
+				fmt.Fprint(w, `{"SecretList":[{"Name":"app/db"}],"NextToken":"next"}`)
+			} else {
+				fmt.Fprint(w, `{"SecretList":[{"Name":"app/api"}]}`)
+			}
+		case "secretsmanager.GetSecretValue":
+			if in["SecretId"] != "app/db" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`)
+				return
+			}
+			fmt.Fprint(w, `{"Name":"app/db","SecretString":"{\"password\":\"secret\"}"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type":"InvalidRequestException","message":"unexpected"}`)
+		}
+	}))
+	defer server.Close()
+
+	for key, value := range map[string]string{
+		"AWS_ENDPOINT_URL":      server.URL,
+		"AWS_ACCESS_KEY_ID":     "AKIDTEST",
+		"AWS_SECRET_ACCESS_KEY": "test",
+		"AWS_REGION":            "eu-west-1",
+	} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Setenv(key, value)
+	}
+
+	s, err := newAWSSecretsManager("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := s.List("app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"app/api", "app/db"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+	if value, err := s.Get("app/db"); err != nil {
+		t.Fatal(err)
+	} else if value != `{"password":"secret"}` {
+		t.Fatalf("unexpected value %q", value)
+	}
+	if _, err = s.Get("app/missing"); ErrorKind(err) != ErrNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if err = s.Put("app/new", "{}", nil, false); err == nil {
+		t.Fatal("expected error")
+	}
+}
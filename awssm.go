@@ -0,0 +1,103 @@
+package vc
+
+import "sort"
+
+// awsSecretsManager is the AWS Secrets Manager bridge store
+type awsSecretsManager struct {
+	*awsClient
+}
+
+type awsTag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+func newAWSSecretsManager(profile, region string) (*awsSecretsManager, error) {
+	client, err := newAWSClient("secretsmanager", "secretsmanager", profile, region)
+	if err != nil {
+		return nil, err
+	}
+	return &awsSecretsManager{client}, nil
+}
+
+// awsTags converts tags to a sorted list of AWS tags
+func awsTags(tags map[string]string) []awsTag {
+	list := make([]awsTag, 0, len(tags))
+	for key, value := range tags {
+		list = append(list, awsTag{Key: key, Value: value})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+func (s *awsSecretsManager) List(prefix string) ([]string, error) {
+	type filter struct {
+		Key    string   `json:"Key"`
+		Values []string `json:"Values"`
+	}
+	var (
+		names []string
+		in    = struct {
+			MaxResults int      `json:"MaxResults"`
+			NextToken  string   `json:"NextToken,omitempty"`
+			Filters    []filter `json:"Filters,omitempty"`
+		}{MaxResults: 100}
+	)
+	if prefix != "" {
+		in.Filters = []filter{{Key: "name", Values: []string{prefix}}}
+	}
+	for {
+		var out struct {
+			SecretList []struct {
+				Name string `json:"Name"`
+			} `json:"SecretList"`
+			NextToken string `json:"NextToken"`
+		}
+		if err := s.call("ListSecrets", in, &out); err != nil {
+			return nil, err
+		}
+		for _, secret := range out.SecretList {
+			names = append(names, secret.Name)
+		}
+		if in.NextToken = out.NextToken; in.NextToken == "" {
+			break
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *awsSecretsManager) Get(name string) (string, error) {
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	err := s.call("GetSecretValue", map[string]string{"SecretId": name}, &out)
+	return out.SecretString, err
+}
+
+func (s *awsSecretsManager) Put(name, value string, tags map[string]string, create bool) error {
+	if create {
+		return s.call("CreateSecret", map[string]interface{}{
+			"Name":         name,
+			"SecretString": value,
+			"Tags":         awsTags(tags),
+		}, nil)
+	}
+	if err := s.call("PutSecretValue", map[string]string{
+		"SecretId":     name,
+		"SecretString": value,
+	}, nil); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return s.call("TagResource", map[string]interface{}{
+		"SecretId": name,
+		"Tags":     awsTags(tags),
+	}, nil)
+}
+
+func (s *awsSecretsManager) String() string {
+	return "AWS Secrets Manager (" + s.region + ")"
+}
@@ -3,12 +3,11 @@ package vc
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 	"reflect"
 	"strings"
 
@@ -24,6 +23,14 @@ const (
 	ServerError
 	SystemError
 	CodecError
+	NotFoundError
+	PermissionError
+	SealedError
+	ConflictError
+	DriftError
+	LintError
+	ExpiryError
+	SchemaError
 	Help = cli.RunResultHelp
 )
 
@@ -33,15 +40,22 @@ var (
 		"/etc/vault-client/token",
 		os.ExpandEnv("$VAULT_TOKEN_FILE"),
 	}
+
+	// profileTokenFile keeps the tokens of the profiles, see profileTokenStore
+	profileTokenFile = os.ExpandEnv("$HOME/.vc-tokens")
 )
 
 // DebugLogFunc is our debug log function, defaults to nil (no debug logging)
 var DebugLogFunc func(string)
 
+// DryRun reports the changes commands would make to Vault or to files,
+// without making them
+var DryRun bool
+
 // Debug is a debug message
 func Debug(message string) {
 	if DebugLogFunc != nil {
-		DebugLogFunc(strings.TrimRight(message, " \r\n\t"))
+		DebugLogFunc(redactText(strings.TrimRight(message, " \r\n\t")))
 	}
 }
 
@@ -51,91 +65,302 @@ func Debugf(format string, v ...interface{}) {
 }
 
 type baseCommand struct {
-	ui cli.Ui
-	c  *Client
+	ui     cli.Ui
+	c      *Client
+	config *Config
+
+	mode   os.FileMode
+	owner  *fileOwner
+	xattrs map[string]string
+	out    string
+	w      io.WriteCloser
 
-	mode os.FileMode
-	out  string
-	tmp  *os.File
-	w    io.WriteCloser
+	// relogin is set for commands that log in again, they work in locked
+	// sessions, see checkSession
+	relogin bool
+
+	// useProfile selects a profile instead of --profile, for commands that
+	// work with more than one Vault cluster; its client only uses the token
+	// stored for the profile
+	useProfile string
 }
 
 func (cmd *baseCommand) Client() (*Client, error) {
 	var err error
+	if cmd.c == nil && shellClient != nil && cmd.useProfile == "" {
+		cmd.c = shellClient
+	}
 	if cmd.c == nil {
 		config := api.DefaultConfig()
 		if err = config.ReadEnvironment(); err != nil {
 			return nil, err
 		}
+		p, err := cmd.profile()
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			Debugf("client: using profile %s at %s", cmd.profileName(), p.Address)
+			if err = p.apply(config); err != nil {
+				return nil, err
+			}
+		}
 
 		if cmd.c, err = NewClient(config); err != nil {
 			return nil, err
 		}
+		if p != nil && p.Namespace != "" {
+			cmd.c.SetNamespace(p.Namespace)
+		} else if p != nil {
+			cmd.c.ClearNamespace()
+		}
+		if path := os.Getenv(WorkingPathEnv); path != "" {
+			cmd.c.SetPath(path)
+		}
+		if err = cmd.setHeaders(cmd.c, p); err != nil {
+			return nil, err
+		}
+		if err = cmd.setupCache(); err != nil {
+			return nil, err
+		}
+		if err = cmd.setupAgentCache(); err != nil {
+			return nil, err
+		}
+		if readOnly, err := cmd.readOnly(); err != nil {
+			return nil, err
+		} else if readOnly {
+			Debug("client: read-only mode")
+			if err = cmd.c.SetReadOnly(); err != nil {
+				return nil, err
+			}
+		}
 
 		// Token from environment
-		if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		if token := os.Getenv("VAULT_TOKEN"); token != "" && cmd.useProfile == "" {
 			Debug("client: using VAULT_TOKEN from environment")
 			cmd.c.SetToken(token)
 			return cmd.c, nil
 		}
 
-		// Token from token file
-		for _, tokenFile := range tokenFiles {
-			if tokenFile == "" {
-				continue
+		// Token from the agent
+		if socket := os.Getenv(AgentSocketEnv); socket != "" && cmd.useProfile == "" {
+			token, err := agentToken(socket)
+			if err == nil {
+				Debugf("client: using token of the agent at %s", socket)
+				cmd.c.SetToken(token)
+				return cmd.c, nil
 			}
-			if fi, serr := os.Stat(tokenFile); serr == nil && !fi.IsDir() {
-				b, berr := ioutil.ReadFile(tokenFile)
-				if berr != nil {
-					return nil, fmt.Errorf("unable to read token: %v", berr)
-				}
-				Debugf("client: using VAULT_TOKEN_FILE %s", tokenFile)
-				cmd.c.SetToken(strings.TrimSpace(string(b)))
-				break
-			} else if serr != nil {
-				Debugf("client: error VAULT_TOKEN_FILE %s: %v", tokenFile, serr)
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+
+		// Token from token store
+		var (
+			store TokenStore
+			token string
+		)
+		if !cmd.relogin {
+			if err = cmd.checkSession(); err != nil {
+				return nil, err
+			}
+		}
+		if store, err = cmd.tokenStore(); err != nil {
+			return nil, err
+		}
+		if token, err = store.Token(); err != nil {
+			return nil, err
+		}
+		if token != "" {
+			cmd.c.SetToken(token)
+			if !cmd.relogin {
+				cmd.limitTokenTTL()
 			}
 		}
 	}
 	return cmd.c, err
 }
 
+// setupCache configures the cache of the client, if any
+func (cmd *baseCommand) setupCache() error {
+	config, err := cmd.Config()
+	if err != nil {
+		return err
+	}
+	if config.Cache == nil {
+		if Offline {
+			return errors.New("--offline requires a cache, see cache in the configuration")
+		}
+		return nil
+	}
+	var key *storeKey
+	if config.Cache.SecurityKey {
+		if key, err = loadStoreKey(config.SecurityKey); err != nil {
+			return err
+		}
+	}
+	cache, err := newSecretCache(config.Cache, cmd.c.Address(), cmd.c.Namespace(), key)
+	if err != nil {
+		return err
+	}
+	cmd.c.Cache = cache
+	cmd.c.Offline = Offline
+	return nil
+}
+
+// Config loads the configuration file
+func (cmd *baseCommand) Config() (*Config, error) {
+	if cmd.config == nil {
+		config, err := LoadConfig(configName())
+		if err != nil {
+			return nil, err
+		}
+		cmd.config = config
+	}
+	return cmd.config, nil
+}
+
+// resolve expands aliases in a secret path, and resolves relative paths
+// against the working path (see WorkingPathEnv); paths with a scheme (see
+// splitScheme) are returned as-is
+func (cmd *baseCommand) resolve(path string) string {
+	if _, _, ok := splitScheme(path); ok {
+		return path
+	}
+	config, err := cmd.Config()
+	if err != nil {
+		Debugf("config: %v", err)
+	} else if expanded, ok := config.expandAlias(path); ok {
+		return expanded
+	}
+	return workingPath(path)
+}
+
+// resolveAll resolves secret paths, see resolve
+func (cmd *baseCommand) resolveAll(paths []string) []string {
+	for i, path := range paths {
+		paths[i] = cmd.resolve(path)
+	}
+	return paths
+}
+
 // Close the output file (if any) and rename it to cmd.out
 func (cmd *baseCommand) Close() error {
-	if cmd.w != nil && cmd.w != os.Stdout {
-		if cmd.tmp != nil {
-			tmp := cmd.tmp.Name()
-			if err := cmd.w.Close(); err != nil {
-				return err
-			}
-			return os.Rename(tmp, cmd.out)
-		}
+	if cmd.w != nil && cmd.w != os.Stdout && cmd.w != os.Stderr {
 		return cmd.w.Close()
 	}
 	return nil
 }
 
-// writerOpen opens a file in the directory of cmd.out; with the correct mode;
-// if the caller calls .Close(), the file gets renamed to cmd.out
+// abort discards the output file (if any), leaving cmd.out untouched
+func (cmd *baseCommand) abort() {
+	if w, ok := cmd.w.(interface {
+		abort()
+	}); ok {
+		w.abort()
+	}
+}
+
+// writerOpen opens a SafeOutputWriter for cmd.out with the correct mode; if
+// the caller calls .Close(), the file gets renamed to cmd.out
 func (cmd *baseCommand) writerOpen() error {
-	if cmd.out == "" || cmd.out == "-" {
-		if cmd.w == nil {
-			cmd.w = os.Stdout
+	if cmd.w == nil {
+		cmd.w = cmd.outputWriter(cmd.out, cmd.mode)
+	}
+	return nil
+}
+
+// outputWriter returns a SafeOutputWriter, owned by cmd.owner and with
+// cmd.xattrs if set and encrypting if EncryptTo is set, or a DiffOutputWriter
+// for dry runs; in read-only mode, writes of files that are not writable fail
+// (see checkWritable)
+func (cmd *baseCommand) outputWriter(name string, mode os.FileMode) io.WriteCloser {
+	if DryRun {
+		Debugf("dry run: diff for %s", name)
+		w := DiffOutputWriter(name, mode, os.Stderr)
+		if dw, ok := w.(*diffOutputWriter); ok {
+			dw.colors = cmd.colors(os.Stderr)
+		}
+		return w
+	}
+	if err := cmd.checkWritable(name); err != nil {
+		return refusedWriter{err}
+	}
+	Debugf("writing to %s", name)
+	w := SafeOutputWriter(name, mode)
+	if sw, ok := w.(*safeOutputWriter); ok {
+		sw.changed = outputChanged
+		if cmd.owner != nil {
+			sw.SetOwner(cmd.owner.uid, cmd.owner.gid)
+		}
+		if cmd.xattrs != nil {
+			sw.SetXattrs(cmd.xattrs)
+		}
+	}
+	if len(EncryptTo) > 0 {
+		return EncryptingOutputWriter(w, EncryptTo)
+	}
+	return w
+}
+
+// writeSecret writes data to the secret at path, after validating it against
+// its schemas (see Schema); for dry runs, the changes are reported instead
+func (cmd *baseCommand) writeSecret(client *Client, path string, data map[string]interface{}) error {
+	path = strings.TrimLeft(path, "/")
+	if err := cmd.validateWrite(client, path, data); err != nil {
+		return err
+	}
+	if DryRun {
+		var old map[string]interface{}
+		if secret, err := client.ReadSecret(path); err != nil {
+			return err
+		} else if secret != nil {
+			old = secret.Data
+		}
+		cmd.ui.Output("dry run: write secret at " + path)
+		colors := cmd.colors(os.Stdout)
+		for _, change := range describeChanges(old, data) {
+			cmd.ui.Output(colors.change(change))
 		}
 		return nil
 	}
 
-	dir, base := filepath.Split(cmd.out)
-	base = "." + base + "."
+	return client.WriteSecret(path, data)
+}
 
-	var err error
-	if cmd.tmp, err = ioutil.TempFile(dir, base); err == nil {
-		Debugf("writing to %s\n", cmd.tmp.Name())
-		cmd.w = cmd.tmp
-		err = cmd.tmp.Chmod(cmd.mode)
+// readForUpdate reads the secret at path, for writeUpdate; for KV v2 secrets
+// the version that was read is returned, otherwise -1
+func (cmd *baseCommand) readForUpdate(client *Client, path string) (*api.Secret, int, error) {
+	path = strings.TrimLeft(path, "/")
+	if client.IsKV2(path) {
+		return client.ReadSecretWithVersion(path)
 	}
+	secret, err := client.Read(path)
+	return secret, -1, err
+}
 
-	return err
+// writeUpdate writes data to the secret at path with check-and-set: the write
+// fails with ErrVersionConflict if the current version is not cas, because
+// the secret changed since it was read (see readForUpdate). A cas of -1 writes
+// without the check.
+func (cmd *baseCommand) writeUpdate(client *Client, path string, data map[string]interface{}, cas int) error {
+	if cas < 0 || DryRun {
+		return cmd.writeSecret(client, path, data)
+	}
+	if err := cmd.validateWrite(client, strings.TrimLeft(path, "/"), data); err != nil {
+		return err
+	}
+	return client.WriteSecretCAS(strings.TrimLeft(path, "/"), data, cas)
+}
+
+// deleteSecret removes the secret at path; for dry runs, the deletion is
+// reported instead
+func (cmd *baseCommand) deleteSecret(client *Client, path string) error {
+	path = strings.TrimLeft(path, "/")
+	if DryRun {
+		cmd.ui.Output("dry run: remove secret at " + path)
+		return nil
+	}
+
+	return client.DeleteSecret(path)
 }
 
 func (cmd *baseCommand) Write(p []byte) (int, error) {
@@ -159,9 +384,26 @@ func (s *stringValue) Get() interface{} { return string(*s) }
 
 func (s *stringValue) String() string { return string(*s) }
 
+// stringsValue is a flag.Value that can be repeated
+type stringsValue []string
+
+func (s *stringsValue) Set(val string) error {
+	*s = append(*s, val)
+	return nil
+}
+
+func (s *stringsValue) Get() interface{} { return []string(*s) }
+
+func (s *stringsValue) String() string { return strings.Join(*s, ",") }
+
+// defaults returns the usage of the flags in fs; flags without a usage are
+// hidden
 func defaults(fs *flag.FlagSet) string {
 	b := new(bytes.Buffer)
 	fs.VisitAll(func(f *flag.Flag) {
+		if f.Usage == "" {
+			return
+		}
 		s := fmt.Sprintf("  -%s", f.Name) // Two spaces before -; see next two comments.
 		name, usage := flag.UnquoteUsage(f)
 		if len(name) > 0 {
@@ -239,24 +481,88 @@ func confirm(prompt string) bool {
 	}
 }
 
-// confirmf like confirm with formatting
-func confirmf(format string, v ...interface{}) bool {
-	return confirm(fmt.Sprintf(format, v...))
-}
-
 // DefaultCommands returns a map of default commands
 func DefaultCommands(ui cli.Ui) map[string]cli.CommandFactory {
 	return map[string]cli.CommandFactory{
-		"cat":      CatCommandFactory(ui),
-		"cp":       CopyCommandFactory(ui),
-		"edit":     EditCommandFactory(ui),
-		"file get": FileCommandFactory(ui, "get"),
-		"file put": FileCommandFactory(ui, "put"),
-		"ls":       ListCommandFactory(ui),
-		"mv":       MoveCommandFactory(ui),
-		"rm":       DeleteCommandFactory(ui),
-		"template": TemplateCommandFactory(ui),
-		"shell":    ShellCommandFactory(ui),
+		"agent":                   AgentCommandFactory(ui),
+		"alias add":               AliasCommandFactory(ui, "add"),
+		"alias list":              AliasCommandFactory(ui, "list"),
+		"alias rm":                AliasCommandFactory(ui, "rm"),
+		"approle destroy":         AppRoleCommandFactory(ui, "destroy"),
+		"approle generate":        AppRoleCommandFactory(ui, "generate"),
+		"approle list":            AppRoleCommandFactory(ui, "list"),
+		"audit tail":              AuditCommandFactory(ui, "tail"),
+		"batch":                   BatchCommandFactory(ui),
+		"bench":                   BenchCommandFactory(ui),
+		"bridge aws-sm export":    BridgeCommandFactory(ui, "aws-sm", "export"),
+		"bridge aws-sm import":    BridgeCommandFactory(ui, "aws-sm", "import"),
+		"bridge gcp-sm export":    BridgeCommandFactory(ui, "gcp-sm", "export"),
+		"bridge ssm export":       BridgeCommandFactory(ui, "ssm", "export"),
+		"bundle apply":            BundleCommandFactory(ui, "apply"),
+		"bundle create":           BundleCommandFactory(ui, "create"),
+		"cat":                     CatCommandFactory(ui),
+		"certs check":             CertsCommandFactory(ui, "check"),
+		"cp":                      CopyCommandFactory(ui),
+		"docker-credential erase": DockerCredentialCommandFactory(ui, "erase"),
+		"docker-credential get":   DockerCredentialCommandFactory(ui, "get"),
+		"docker-credential list":  DockerCredentialCommandFactory(ui, "list"),
+		"docker-credential store": DockerCredentialCommandFactory(ui, "store"),
+		"edit":                    EditCommandFactory(ui),
+		"export":                  ExportCommandFactory(ui),
+		"file get":                FileCommandFactory(ui, "get"),
+		"file put":                FileCommandFactory(ui, "put"),
+		"generate password":       GenerateCommandFactory(ui, "password"),
+		"generate passphrase":     GenerateCommandFactory(ui, "passphrase"),
+		"git-credential erase":    GitCredentialCommandFactory(ui, "erase"),
+		"git-credential get":      GitCredentialCommandFactory(ui, "get"),
+		"git-credential store":    GitCredentialCommandFactory(ui, "store"),
+		"handoff":                 HandoffCommandFactory(ui),
+		"history":                 HistoryCommandFactory(ui),
+		"identity":                IdentityCommandFactory(ui),
+		"import 1password":        ImportCommandFactory(ui, "1password"),
+		"import bitwarden":        ImportCommandFactory(ui, "bitwarden"),
+		"k8s externalsecret":      KubeCommandFactory(ui, "externalsecret"),
+		"k8s secret":              KubeCommandFactory(ui, "secret"),
+		"k8s secretproviderclass": KubeCommandFactory(ui, "secretproviderclass"),
+		"keygen ssh":              KeygenCommandFactory(ui, "ssh"),
+		"keystore":                KeystoreCommandFactory(ui),
+		"lint":                    LintCommandFactory(ui),
+		"lock":                    LockCommandFactory(ui, true),
+		"login":                   LoginCommandFactory(ui),
+		"ls":                      ListCommandFactory(ui),
+		"merge":                   MergeCommandFactory(ui),
+		"mounts disable":          MountsCommandFactory(ui, "disable"),
+		"mounts enable":           MountsCommandFactory(ui, "enable"),
+		"mounts list":             MountsCommandFactory(ui, "list"),
+		"mounts tune":             MountsCommandFactory(ui, "tune"),
+		"mv":                      MoveCommandFactory(ui),
+		"operator generate-root":  OperatorCommandFactory(ui, "generate-root"),
+		"operator rekey":          OperatorCommandFactory(ui, "rekey"),
+		"operator seal":           OperatorCommandFactory(ui, "seal"),
+		"operator unseal":         OperatorCommandFactory(ui, "unseal"),
+		"receive":                 ReceiveCommandFactory(ui),
+		"replicate":               ReplicateCommandFactory(ui),
+		"rm":                      DeleteCommandFactory(ui),
+		"rollback":                RollbackCommandFactory(ui),
+		"rotate":                  RotateCommandFactory(ui),
+		"tf-external":             TFExternalCommandFactory(ui),
+		"token accessors":         TokenCommandFactory(ui, "accessors"),
+		"token revoke":            TokenCommandFactory(ui, "revoke"),
+		"unlock":                  LockCommandFactory(ui, false),
+		"use":                     UseCommandFactory(ui),
+		"verify":                  VerifyCommandFactory(ui),
+		"template":                TemplateCommandFactory(ui),
+		"self-update":             SelfUpdateCommandFactory(ui),
+		"shell":                   ShellCommandFactory(ui),
+		"ssh add":                 SSHCommandFactory(ui, "add"),
+		"stats":                   StatsCommandFactory(ui),
+		"sync":                    SyncCommandFactory(ui, ""),
+		"sync apply":              SyncCommandFactory(ui, "apply"),
+		"sync plan":               SyncCommandFactory(ui, "plan"),
+		"sops":                    SopsCommandFactory(ui),
+		"systemd creds":           SystemdCommandFactory(ui, "creds"),
+		"systemd unit":            SystemdCommandFactory(ui, "unit"),
+		"write":                   WriteCommandFactory(ui),
 	}
 }
 
@@ -264,6 +570,6 @@ func DefaultCommands(ui cli.Ui) map[string]cli.CommandFactory {
 func DefaultApp(ui cli.Ui, args []string) *cli.CLI {
 	app := cli.NewCLI("vc", "")
 	app.Args = args
-	app.Commands = DefaultCommands(ui)
+	app.Commands = DefaultCommands(redactUi(colorUi(ui), args))
 	return app
 }
@@ -1,11 +1,15 @@
 package vc
 
 import (
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/hashicorp/vault/api"
 	"github.com/mitchellh/cli"
 )
 
@@ -56,3 +60,53 @@ func testCommandRun(t *testing.T, test testCommand) {
 		t.Fatalf("expected %q return code %d; got %d", strings.Join(app.Args, " "), test.Code, code)
 	}
 }
+
+// testMounts are the secrets engines of the fake Vault of newTestClient, by
+// mount path, such as "secret/": "kv" for KV version 1, "kv-v2" for KV
+// version 2, or any other type
+type testMounts map[string]string
+
+// ServeHTTP answers the mounts lookup
+func (mounts testMounts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := make(map[string]interface{})
+	for p, kind := range mounts {
+		switch kind {
+		case "kv":
+			response[p] = map[string]interface{}{"type": "kv", "options": map[string]string{"version": "1"}}
+		case "kv-v2":
+			response[p] = map[string]interface{}{"type": "kv", "options": map[string]string{"version": "2"}}
+		default:
+			response[p] = map[string]interface{}{"type": kind}
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// newTestClient returns a client with token s.test, without retries, for a
+// fake Vault that serves handler until the end of the test; with mounts, GET
+// sys/mounts is answered from them instead of by handler
+func newTestClient(t *testing.T, handler http.Handler, mounts testMounts) *Client {
+	t.Helper()
+	if mounts != nil {
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && r.URL.Path == "/v1/sys/mounts" {
+				mounts.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	config.MaxRetries = 0
+	c, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetToken("s.test")
+	return c
+}
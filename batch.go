@@ -0,0 +1,243 @@
+package vc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+)
+
+// batchMaxLine is the maximum length of a line of vc batch input
+const batchMaxLine = 16 << 20
+
+// batchRequest is a line of vc batch input
+type batchRequest struct {
+	// ID is copied to the result, to match results with requests
+	ID interface{} `json:"id,omitempty"`
+
+	// Op is the operation: read, write or delete
+	Op string `json:"op"`
+
+	// Path is the secret path; for read, it may have an @<version>
+	Path string `json:"path"`
+
+	// Data is the data to write
+	Data map[string]interface{} `json:"data,omitempty"`
+
+	// CAS writes with check-and-set against the version, for KV v2
+	CAS *int `json:"cas,omitempty"`
+}
+
+// batchResult is a line of vc batch output
+type batchResult struct {
+	ID     interface{}            `json:"id,omitempty"`
+	Line   int                    `json:"line"`
+	Op     string                 `json:"op,omitempty"`
+	Path   string                 `json:"path,omitempty"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+	DryRun bool                   `json:"dry_run,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+
+	// Code is the exit code of the operation, see the exit codes
+	Code int `json:"code"`
+}
+
+// batchJob is a request to be done by a worker
+type batchJob struct {
+	line    int
+	request batchRequest
+}
+
+// BatchCommand does the operations read from stdin
+type BatchCommand struct {
+	baseCommand
+	fs          *flag.FlagSet
+	in          io.Reader
+	concurrency int
+}
+
+func (cmd *BatchCommand) Help() string {
+	return `Usage: vc batch [<options>]
+
+Reads operations from stdin, one JSON object per line, and does them with
+-c requests in flight over one connection to Vault. The result of each
+operation is written to stdout as a JSON object on a line, in the order the
+operations complete; the line number and the id of the request are copied to
+its result.
+
+  {"id": 1, "op": "read", "path": "secret/app/db"}
+  {"id": 2, "op": "write", "path": "secret/app/api", "data": {"token": "..."}}
+  {"id": 3, "op": "delete", "path": "secret/app/old"}
+
+Results have the data that was read, or an error and the exit code of the
+operation; the exit code of vc batch is the highest exit code of all
+operations.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *BatchCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) != 0 {
+		return Help
+	}
+	if cmd.concurrency < 1 {
+		cmd.ui.Error("error: -c must be at least 1")
+		return SyntaxError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	var (
+		jobs    = make(chan batchJob)
+		results = make(chan batchResult)
+		wait    sync.WaitGroup
+		readErr error
+	)
+	for n := 0; n < cmd.concurrency; n++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for job := range jobs {
+				results <- cmd.do(client, job)
+			}
+		}()
+	}
+	go func() {
+		scanner := bufio.NewScanner(cmd.in)
+		scanner.Buffer(make([]byte, 64<<10), batchMaxLine)
+		for line := 1; !stopping() && scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var request batchRequest
+			if err := json.Unmarshal([]byte(text), &request); err != nil {
+				results <- batchResult{Line: line, Error: fmt.Sprintf("invalid request: %v", err), Code: SyntaxError}
+				continue
+			}
+			jobs <- batchJob{line: line, request: request}
+		}
+		readErr = scanner.Err()
+		close(jobs)
+		wait.Wait()
+		close(results)
+	}()
+
+	var ret int
+	for result := range results {
+		b, err := json.Marshal(result)
+		if err != nil {
+			b, _ = json.Marshal(batchResult{ID: result.ID, Line: result.Line, Op: result.Op, Path: result.Path, Error: err.Error(), Code: CodecError})
+			result.Code = CodecError
+		}
+		cmd.ui.Output(string(b))
+		if result.Code > ret {
+			ret = result.Code
+		}
+	}
+	if readErr != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", readErr))
+		return SystemError
+	}
+	return ret
+}
+
+// do does the operation of the job with client
+func (cmd *BatchCommand) do(client *Client, job batchJob) batchResult {
+	var (
+		request = job.request
+		result  = batchResult{ID: request.ID, Line: job.line, Op: request.Op, Path: request.Path}
+		path    = strings.TrimLeft(cmd.resolve(request.Path), "/")
+		err     error
+	)
+	fail := func(err error, code int) batchResult {
+		result.Error = err.Error()
+		result.Code = code
+		return result
+	}
+	if request.Path == "" {
+		return fail(errors.New("no path"), SyntaxError)
+	}
+	Debugf("batch: %d: %s %s", job.line, request.Op, path)
+
+	switch request.Op {
+	case "read":
+		var secret *api.Secret
+		if name, version, ok := splitVersion(path); ok {
+			secret, err = client.ReadVersion(name, version)
+		} else {
+			secret, err = cmd.readSource(path, client.ReadSecret)
+		}
+		if err != nil {
+			return fail(err, exitCode(err, ServerError))
+		} else if secret == nil {
+			return fail(errors.New("secret not found"), NotFoundError)
+		}
+		result.Data = secret.Data
+	case "write":
+		if len(request.Data) == 0 {
+			return fail(errors.New("no data to write"), SyntaxError)
+		} else if DryRun {
+			result.DryRun = true
+			break
+		}
+		if request.CAS != nil {
+			err = client.WriteSecretCAS(path, request.Data, *request.CAS)
+		} else {
+			err = client.WriteSecret(path, request.Data)
+		}
+		if err != nil {
+			return fail(err, exitCode(err, ServerError))
+		}
+	case "delete":
+		if DryRun {
+			result.DryRun = true
+			break
+		}
+		if err = client.DeleteSecret(path); err != nil {
+			return fail(err, exitCode(err, ServerError))
+		}
+	default:
+		return fail(fmt.Errorf("unknown operation %q, expected read, write or delete", request.Op), SyntaxError)
+	}
+	return result
+}
+
+func (cmd *BatchCommand) Synopsis() string {
+	return "do operations read from stdin"
+}
+
+func BatchCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &BatchCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			in: os.Stdin,
+		}
+
+		cmd.fs = flag.NewFlagSet("batch", flag.ContinueOnError)
+		cmd.fs.IntVar(&cmd.concurrency, "c", 4, "number of requests in flight")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,97 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestBatchCommand(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		written = make(map[string]map[string]interface{})
+		deleted []string
+	)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch request := r.Method + " " + r.URL.Path; {
+		case request == "GET /v1/secret/app/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "s3cr3t"}}
+		case strings.HasPrefix(request, "PUT /v1/secret/"):
+			var data map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&data)
+			mutex.Lock()
+			written[r.URL.Path] = data
+			mutex.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case request == "DELETE /v1/secret/app/old":
+			mutex.Lock()
+			deleted = append(deleted, r.URL.Path)
+			mutex.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case request == "GET /v1/secret/denied":
+			w.WriteHeader(http.StatusForbidden)
+			response = map[string]interface{}{"errors": []string{"1 error occurred:\n\t* permission denied"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	ui := cli.NewMockUi()
+	command, _ := BatchCommandFactory(ui)()
+	cmd := command.(*BatchCommand)
+	cmd.c, cmd.config = c, new(Config)
+	cmd.in = strings.NewReader(`{"id": "db", "op": "read", "path": "secret/app/db"}
+{"id": 2, "op": "write", "path": "secret/app/api", "data": {"token": "s.test"}}
+
+{"op": "delete", "path": "secret/app/old"}
+{"op": "read", "path": "secret/app/missing"}
+{"op": "read", "path": "secret/denied"}
+{"op": "list", "path": "secret/app"}
+not json
+`)
+	if code := cmd.Run(nil); code != PermissionError {
+		t.Fatalf("expected exit code %d, got %d: %s", PermissionError, code, ui.ErrorWriter.String())
+	}
+
+	var results []batchResult
+	for _, line := range strings.Split(strings.TrimSpace(ui.OutputWriter.String()), "\n") {
+		var result batchResult
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Line < results[j].Line })
+	want := []struct {
+		line, code int
+	}{
+		{1, Success}, {2, Success}, {4, Success}, {5, NotFoundError}, {6, PermissionError}, {7, SyntaxError}, {8, SyntaxError},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), results)
+	}
+	for i, w := range want {
+		if results[i].Line != w.line || results[i].Code != w.code {
+			t.Errorf("expected line %d with code %d, got %+v", w.line, w.code, results[i])
+		}
+	}
+	if results[0].ID != "db" || results[0].Data["password"] != "s3cr3t" {
+		t.Errorf("expected the password of db, got %+v", results[0])
+	}
+	if results[1].ID != float64(2) || written["/v1/secret/app/api"]["token"] != "s.test" {
+		t.Errorf("expected secret/app/api to be written, got %+v", written)
+	}
+	if len(deleted) != 1 {
+		t.Errorf("expected secret/app/old to be deleted, got %v", deleted)
+	}
+}
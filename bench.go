@@ -0,0 +1,272 @@
+package vc
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// benchOperations are the operations vc bench can time, sorted
+var benchOperations = []string{"list", "read", "render"}
+
+// BenchCommand times the throughput of Vault operations
+type BenchCommand struct {
+	baseCommand
+	fs          *flag.FlagSet
+	concurrency int
+	requests    int
+	duration    time.Duration
+	operations  string
+	template    string
+	templating  string
+}
+
+// benchResult are the timings of an operation
+type benchResult struct {
+	operation string
+	elapsed   time.Duration
+	latencies []time.Duration
+	errors    int
+	err       error
+}
+
+// percentile returns the latency below which p percent of the requests were
+// done
+func (r *benchResult) percentile(p int) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := (len(r.latencies)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return r.latencies[i]
+}
+
+func (cmd *BenchCommand) Help() string {
+	return `Usage: vc bench [<options>] <path>
+
+Time the throughput of Vault operations below path, with -c requests in
+flight: list lists the directories below path, read reads the secrets below
+path, and render renders the template -t (which is required for render). Each
+operation is done -n times, or for -d if set, and its requests per second and
+latencies are printed.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *BenchCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) != 1 {
+		return Help
+	}
+	if cmd.concurrency < 1 || (cmd.requests < 1 && cmd.duration <= 0) {
+		cmd.ui.Error("error: -c and -n must be at least 1")
+		return SyntaxError
+	}
+	operations := strings.Split(cmd.operations, ",")
+	for _, operation := range operations {
+		if i := sort.SearchStrings(benchOperations, operation); i == len(benchOperations) || benchOperations[i] != operation {
+			cmd.ui.Error(fmt.Sprintf("error: unknown operation %q, expected one of %s", operation, strings.Join(benchOperations, ", ")))
+			return SyntaxError
+		}
+		if operation == "render" && cmd.template == "" {
+			cmd.ui.Error("error: render needs a template (-t)")
+			return SyntaxError
+		}
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	// The tree is listed once, to find the directories and secrets to use
+	dirs, secrets, err := cmd.discover(client, args[0])
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: %v", args[0], err))
+		return exitCode(err, ServerError)
+	}
+	Debugf("bench: %s: %d directories, %d secrets", args[0], len(dirs), len(secrets))
+
+	// The response cache is not used, to time Vault only
+	client.Cache = nil
+	var results []*benchResult
+	for _, operation := range operations {
+		var do func(*Client, int) error
+		switch operation {
+		case "list":
+			do = func(c *Client, i int) error {
+				_, err := c.ReadDir(dirs[i%len(dirs)])
+				return err
+			}
+		case "read":
+			if len(secrets) == 0 {
+				cmd.ui.Warn(fmt.Sprintf("warning: bench: no secrets below %s, skipping read", args[0]))
+				continue
+			}
+			do = func(c *Client, i int) error {
+				_, err := c.ReadSecret(secrets[i%len(secrets)])
+				return err
+			}
+		case "render":
+			do = cmd.render
+		}
+		if stopping() {
+			break
+		}
+		results = append(results, cmd.bench(client, operation, do))
+	}
+	releaseLeases()
+
+	var (
+		b = new(bytes.Buffer)
+		w = tabwriter.NewWriter(b, 0, 8, 2, ' ', 0)
+	)
+	fmt.Fprintln(w, "OPERATION\tREQUESTS\tERRORS\tREQ/S\tP50\tP90\tP99\tMAX")
+	for _, r := range results {
+		var rate float64
+		if r.elapsed > 0 {
+			rate = float64(len(r.latencies)) / r.elapsed.Seconds()
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\n", r.operation, len(r.latencies), r.errors, rate,
+			benchRound(r.percentile(50)), benchRound(r.percentile(90)), benchRound(r.percentile(99)), benchRound(r.percentile(100)))
+	}
+	w.Flush()
+	cmd.ui.Output(strings.TrimSuffix(b.String(), "\n"))
+
+	var ret int
+	for _, r := range results {
+		if r.errors > 0 {
+			cmd.ui.Warn(fmt.Sprintf("warning: bench: %s: %d errors, the last: %v", r.operation, r.errors, r.err))
+			if r.errors == len(r.latencies) {
+				ret = exitCode(r.err, ServerError)
+			}
+		}
+	}
+	return ret
+}
+
+// discover returns the directories and the secrets below path
+func (cmd *BenchCommand) discover(client *Client, path string) (dirs, secrets []string, err error) {
+	dirs = []string{path}
+	it := client.ListIter(path, true)
+	for it.Next() && !stopping() {
+		if it.Info().IsDir() {
+			dirs = append(dirs, it.Info().Name())
+		} else {
+			secrets = append(secrets, it.Info().Name())
+		}
+	}
+	return dirs, secrets, it.Err()
+}
+
+// bench does the operation with cmd.concurrency workers
+func (cmd *BenchCommand) bench(client *Client, operation string, do func(*Client, int) error) *benchResult {
+	var (
+		r        = &benchResult{operation: operation}
+		next     = make(chan int)
+		mutex    sync.Mutex
+		wait     sync.WaitGroup
+		deadline time.Time
+	)
+	if cmd.duration > 0 {
+		deadline = time.Now().Add(cmd.duration)
+	}
+
+	start := time.Now()
+	for n := 0; n < cmd.concurrency; n++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := range next {
+				t := time.Now()
+				err := do(client, i)
+				latency := time.Since(t)
+
+				mutex.Lock()
+				r.latencies = append(r.latencies, latency)
+				if err != nil {
+					Debugf("bench: %s: %v", operation, err)
+					r.errors++
+					r.err = err
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for i := 0; !stopping(); i++ {
+		if deadline.IsZero() && i >= cmd.requests {
+			break
+		} else if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wait.Wait()
+	r.elapsed = time.Since(start)
+
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	return r
+}
+
+// render renders the template with client
+func (cmd *BenchCommand) render(client *Client, _ int) error {
+	t := &TemplateCommand{baseCommand: baseCommand{ui: cmd.ui, c: client, config: cmd.config}}
+	tmpl, err := t.parseTemplate(cmd.template, cmd.templating)
+	if err != nil {
+		return err
+	}
+	_, err = t.executeTemplate(tmpl)
+	return err
+}
+
+// benchRound rounds latencies for display
+func benchRound(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+func (cmd *BenchCommand) Synopsis() string {
+	return "time the throughput of Vault operations"
+}
+
+func BenchCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &BenchCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("bench", flag.ContinueOnError)
+		cmd.fs.IntVar(&cmd.concurrency, "c", 4, "number of requests in flight")
+		cmd.fs.IntVar(&cmd.requests, "n", 100, "number of requests per operation")
+		cmd.fs.DurationVar(&cmd.duration, "d", 0, "duration per operation, instead of -n")
+		cmd.fs.StringVar(&cmd.operations, "op", "list,read", "operations to time, separated by commas ("+strings.Join(benchOperations, ", ")+")")
+		cmd.fs.StringVar(&cmd.template, "t", "", "template to render")
+		cmd.fs.StringVar(&cmd.templating, "templating", "html", "templating mode (text or html)")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
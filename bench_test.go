@@ -0,0 +1,71 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestBenchCommand(t *testing.T) {
+	var (
+		mutex sync.Mutex
+		reads = make(map[string]int)
+	)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		reads[r.URL.Path]++
+		mutex.Unlock()
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/secret/app":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"db", "api"}}}
+		case "/v1/secret/app/db", "/v1/secret/app/api":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "secret"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	ui := cli.NewMockUi()
+	command, _ := BenchCommandFactory(ui)()
+	cmd := command.(*BenchCommand)
+	cmd.c, cmd.config = c, new(Config)
+	if code := cmd.Run([]string{"-c", "3", "-n", "10", "secret/app"}); code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if n := reads["/v1/secret/app/db"] + reads["/v1/secret/app/api"]; n != 10 {
+		t.Fatalf("expected 10 reads, got %d", n)
+	}
+	lines := strings.Split(strings.TrimSpace(ui.OutputWriter.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", lines)
+	}
+	for i, want := range []string{"list", "read"} {
+		if fields := strings.Fields(lines[i+1]); fields[0] != want || fields[1] != "10" || fields[2] != "0" {
+			t.Fatalf("unexpected result %q", lines[i+1])
+		}
+	}
+
+	if code := cmd.Run([]string{"-op", "render", "secret/app"}); code != SyntaxError {
+		t.Fatalf("expected exit code %d without a template, got %d", SyntaxError, code)
+	}
+}
+
+func TestBenchResultPercentile(t *testing.T) {
+	r := &benchResult{}
+	for i := 1; i <= 100; i++ {
+		r.latencies = append(r.latencies, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[int]time.Duration{50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond} {
+		if got := r.percentile(p); got != want {
+			t.Fatalf("p%d: expected %s, got %s", p, want, got)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+package vc
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Conflict policies, for secrets that exist in the target with other values
+const (
+	conflictFail      = "fail"
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+)
+
+// bridgeValueKey holds the value of external secrets that are not a JSON
+// object when imported
+const bridgeValueKey = "value"
+
+// bridgeManifest maps Vault paths to the names of secrets in an external
+// secret store
+type bridgeManifest struct {
+	// Path is the Vault tree
+	Path string `yaml:"path"`
+
+	// Prefix is prepended to paths relative to Path that match no rule
+	Prefix string `yaml:"prefix"`
+
+	// Rules replace path prefixes, the first matching rule is used
+	Rules []bridgeRule `yaml:"rules"`
+
+	// Exclude lists patterns of relative paths that are not copied
+	Exclude []string `yaml:"exclude"`
+
+	// Tags are set on the external secrets
+	Tags map[string]string `yaml:"tags"`
+
+	exclude []*regexp.Regexp
+}
+
+// bridgeRule replaces the prefix From of a relative path with To
+type bridgeRule struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// loadBridgeManifest reads the manifest file name
+func loadBridgeManifest(name string) (*bridgeManifest, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	m := new(bridgeManifest)
+	if err = yaml.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return m, nil
+}
+
+// compile prepares the exclude patterns
+func (m *bridgeManifest) compile() error {
+	m.exclude = m.exclude[:0]
+	for _, pattern := range m.Exclude {
+		re, err := regexp.Compile(globExpression(strings.Trim(pattern, "/")))
+		if err != nil {
+			return fmt.Errorf("exclude %q: %v", pattern, err)
+		}
+		m.exclude = append(m.exclude, re)
+	}
+	return nil
+}
+
+// excluded checks if the relative path is excluded
+func (m *bridgeManifest) excluded(rel string) bool {
+	for _, re := range m.exclude {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// name returns the external name for the relative path rel
+func (m *bridgeManifest) name(rel string) string {
+	for _, rule := range m.Rules {
+		if strings.HasPrefix(rel, rule.From) {
+			return rule.To + rel[len(rule.From):]
+		}
+	}
+	return m.Prefix + rel
+}
+
+// path returns the relative path for the external name, the inverse of name;
+// it returns false if name is not mapped
+func (m *bridgeManifest) path(name string) (string, bool) {
+	for _, rule := range m.Rules {
+		if strings.HasPrefix(name, rule.To) {
+			return rule.From + name[len(rule.To):], true
+		}
+	}
+	if strings.HasPrefix(name, m.Prefix) && len(name) > len(m.Prefix) {
+		return name[len(m.Prefix):], true
+	}
+	return "", false
+}
+
+// bridgeStore is an external secret store
+type bridgeStore interface {
+	// Get the value of a secret, returns an ErrNotFound error if the secret
+	// does not exist
+	Get(name string) (string, error)
+
+	// Put creates (if create is set) or updates a secret
+	Put(name, value string, tags map[string]string, create bool) error
+
+	// String describes the store
+	String() string
+}
+
+// bridgeSource is an external secret store that secrets can be imported from
+type bridgeSource interface {
+	bridgeStore
+
+	// List the names of the secrets starting with prefix
+	List(prefix string) ([]string, error)
+}
+
+// bridgeEncode encodes the data of a secret as a JSON object
+func bridgeEncode(data map[string]interface{}) (string, error) {
+	values := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if key != CodecTypeKey {
+			values[key] = value
+		}
+	}
+	b, err := json.Marshal(values)
+	return string(b), err
+}
+
+// bridgeDecode decodes the value of an external secret, values that are not
+// a JSON object are stored in key bridgeValueKey
+func bridgeDecode(value string) map[string]interface{} {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &data); err != nil || data == nil {
+		return map[string]interface{}{bridgeValueKey: value}
+	}
+	return data
+}
+
+// bridgeEqual compares the data of secrets, ignoring differences in number
+// representations
+func bridgeEqual(a, b map[string]interface{}) bool {
+	normalize := func(data map[string]interface{}) interface{} {
+		s, err := bridgeEncode(data)
+		if err != nil {
+			return data
+		}
+		var v interface{}
+		json.Unmarshal([]byte(s), &v)
+		return v
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// bridgeAction is a planned copy of a secret
+type bridgeAction struct {
+	source string
+	target string
+	data   map[string]interface{}
+	create bool
+}
+
+// BridgeCommand copies secrets between Vault and an external secret store
+type BridgeCommand struct {
+	baseCommand
+	fs       *flag.FlagSet
+	store    string
+	sub      string
+	manifest string
+	prefix   string
+	rules    stringsValue
+	exclude  stringsValue
+	tags     stringsValue
+	conflict string
+	profile  string
+	region   string
+	project  string
+	keyID    string
+	force    bool
+}
+
+func (cmd *BridgeCommand) Help() string {
+	if cmd.sub == "import" {
+		return `Usage: vc bridge ` + cmd.store + ` import [<options>] [<secret path>]
+
+Copies the secrets in the external store to the tree at path, mapping names
+to paths with the reverse of the rules used by export; secrets that are not
+mapped are ignored. Values that are not a JSON object are stored in key
+"` + bridgeValueKey + `".
+
+Options:
+` + defaults(cmd.fs)
+	}
+	return `Usage: vc bridge ` + cmd.store + ` export [<options>] [<secret path>]
+
+Copies the secrets in the tree at path to the external store, as JSON objects.
+Names are the paths relative to the tree, with the -prefix prepended; use
+-map from=to to replace path prefixes instead. The path, rules, excluded paths
+and tags can also be read from a manifest file (-manifest).
+
+Secrets that exist with other values are conflicts, which fail the copy
+before any changes are made (-conflict fail), are skipped or are overwritten.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *BridgeCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.fs.Args(); len(args) > 1 {
+		return Help
+	}
+	switch cmd.conflict {
+	case conflictFail, conflictSkip, conflictOverwrite:
+	default:
+		cmd.ui.Error(fmt.Sprintf("error: invalid conflict policy %q", cmd.conflict))
+		return SyntaxError
+	}
+
+	m, err := cmd.loadManifest()
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	if len(args) == 1 {
+		m.Path = args[0]
+	}
+	if m.Path == "" {
+		return Help
+	}
+	m.Path = strings.Trim(cmd.resolve(m.Path), "/")
+
+	store, err := cmd.newStore()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	var actions, conflicts []bridgeAction
+	if cmd.sub == "import" {
+		actions, conflicts, err = cmd.planImport(client, store, m)
+	} else {
+		actions, conflicts, err = cmd.planExport(client, store, m)
+	}
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+	if len(conflicts) > 0 && cmd.conflict == conflictFail {
+		for _, action := range conflicts {
+			cmd.ui.Error(fmt.Sprintf("conflict: %s has other values than %s", action.target, action.source))
+		}
+		cmd.ui.Error(fmt.Sprintf("error: %d conflicts; use -conflict skip or -conflict overwrite", len(conflicts)))
+		return ConflictError
+	} else if len(conflicts) > 0 && cmd.conflict == conflictOverwrite {
+		actions = append(actions, conflicts...)
+	} else if len(conflicts) > 0 {
+		cmd.ui.Warn(fmt.Sprintf("skipping %d conflicts", len(conflicts)))
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].target < actions[j].target })
+
+	if len(actions) == 0 {
+		cmd.ui.Info("nothing to copy")
+		return Success
+	}
+	var changes []string
+	for _, action := range actions {
+		if action.create {
+			changes = append(changes, "+ "+action.target)
+		} else {
+			changes = append(changes, "~ "+action.target)
+		}
+	}
+	target := store.String()
+	if cmd.sub == "import" {
+		target = "Vault"
+	}
+	ok, err := cmd.confirmChanges(cmd.force, changes, "copy %d secrets to %s?", len(actions), target)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return SystemError
+	} else if !ok {
+		return Success
+	}
+
+	progress := cmd.progress("copying", len(actions))
+	defer progress.Done()
+	for _, action := range actions {
+		if cmd.sub == "import" {
+			err = cmd.writeSecret(client, action.target, action.data)
+		} else if DryRun && action.create {
+			cmd.ui.Output(fmt.Sprintf("dry run: create %s in %s", action.target, store))
+		} else if DryRun {
+			cmd.ui.Output(fmt.Sprintf("dry run: update %s in %s", action.target, store))
+		} else {
+			var value string
+			if value, err = bridgeEncode(action.data); err == nil {
+				err = store.Put(action.target, value, m.Tags, action.create)
+			}
+		}
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", action.target, err))
+			return exitCode(err, ServerError)
+		}
+		progress.Add(1)
+	}
+
+	if !DryRun {
+		cmd.ui.Info(fmt.Sprintf("copied %d secrets to %s", len(actions), target))
+	}
+	return Success
+}
+
+// loadManifest reads the manifest, if any, and adds the rules from the flags
+func (cmd *BridgeCommand) loadManifest() (*bridgeManifest, error) {
+	m := new(bridgeManifest)
+	if cmd.manifest != "" {
+		var err error
+		if m, err = loadBridgeManifest(cmd.manifest); err != nil {
+			return nil, err
+		}
+	}
+	if cmd.prefix != "" {
+		m.Prefix = cmd.prefix
+	}
+	for _, rule := range cmd.rules {
+		i := strings.IndexByte(rule, '=')
+		if i < 1 {
+			return nil, fmt.Errorf("invalid mapping %q, expected from=to", rule)
+		}
+		m.Rules = append(m.Rules, bridgeRule{From: rule[:i], To: rule[i+1:]})
+	}
+	m.Exclude = append(m.Exclude, cmd.exclude...)
+	for _, tag := range cmd.tags {
+		i := strings.IndexByte(tag, '=')
+		if i < 1 {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", tag)
+		}
+		if m.Tags == nil {
+			m.Tags = make(map[string]string)
+		}
+		m.Tags[tag[:i]] = tag[i+1:]
+	}
+	return m, m.compile()
+}
+
+// newStore connects to the external store
+func (cmd *BridgeCommand) newStore() (bridgeStore, error) {
+	switch cmd.store {
+	case "aws-sm":
+		return newAWSSecretsManager(cmd.profile, cmd.region)
+	case "gcp-sm":
+		return newGCPSecretManager(cmd.project)
+	case "ssm":
+		return newSSMParameterStore(cmd.profile, cmd.region, cmd.keyID)
+	}
+	return nil, fmt.Errorf("unsupported store %q", cmd.store)
+}
+
+// planExport returns the secrets in the tree that are copied, and the ones
+// that conflict with existing secrets
+func (cmd *BridgeCommand) planExport(client *Client, store bridgeStore, m *bridgeManifest) (actions, conflicts []bridgeAction, err error) {
+	info, err := client.Stat(m.Path)
+	if err == os.ErrNotExist {
+		return nil, nil, notFound(m.Path + ": not found")
+	} else if err != nil {
+		return nil, nil, err
+	}
+	paths := []string{m.Path}
+	if info.IsDir() {
+		if paths, err = client.walk(m.Path); err != nil {
+			return
+		}
+	}
+
+	root := strings.Trim(m.Path, "/")
+	for _, p := range paths {
+		p = strings.Trim(p, "/")
+		rel := strings.TrimPrefix(p, root+"/")
+		if rel == p {
+			rel = p[strings.LastIndexByte(p, '/')+1:]
+		}
+		if m.excluded(rel) {
+			Debugf("bridge: %s excluded", p)
+			continue
+		}
+		secret, err := client.ReadSecret(p)
+		if err != nil {
+			return nil, nil, err
+		} else if secret == nil {
+			continue
+		}
+
+		action := bridgeAction{source: p, target: m.name(rel), data: secret.Data}
+		value, err := store.Get(action.target)
+		if ErrorKind(err) == ErrNotFound {
+			action.create = true
+			actions = append(actions, action)
+		} else if err != nil {
+			return nil, nil, err
+		} else if !bridgeEqual(bridgeDecode(value), secret.Data) {
+			conflicts = append(conflicts, action)
+		}
+	}
+	return
+}
+
+// planImport returns the external secrets that are copied to the tree, and
+// the ones that conflict with existing secrets
+func (cmd *BridgeCommand) planImport(client *Client, store bridgeStore, m *bridgeManifest) (actions, conflicts []bridgeAction, err error) {
+	source, ok := store.(bridgeSource)
+	if !ok {
+		return nil, nil, fmt.Errorf("can't import from %s", store)
+	}
+	prefix := m.Prefix
+	if len(m.Rules) > 0 {
+		prefix = ""
+	}
+	names, err := source.List(prefix)
+	if err != nil {
+		return
+	}
+
+	for _, name := range names {
+		rel, ok := m.path(name)
+		if !ok || m.excluded(rel) {
+			Debugf("bridge: %s not mapped or excluded", name)
+			continue
+		}
+		value, err := store.Get(name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		action := bridgeAction{source: name, target: m.Path + "/" + rel, data: bridgeDecode(value)}
+		secret, err := client.ReadSecret(action.target)
+		if err != nil {
+			return nil, nil, err
+		} else if secret == nil {
+			action.create = true
+			actions = append(actions, action)
+		} else if !bridgeEqual(secret.Data, action.data) {
+			conflicts = append(conflicts, action)
+		}
+	}
+	return
+}
+
+func (cmd *BridgeCommand) Synopsis() string {
+	if cmd.sub == "import" {
+		return "copy secrets from " + cmd.store + " to Vault"
+	}
+	return "copy secrets from Vault to " + cmd.store
+}
+
+func BridgeCommandFactory(ui cli.Ui, store, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &BridgeCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			store: store,
+			sub:   sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("bridge "+store+" "+sub, flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.manifest, "manifest", "", "mapping manifest file")
+		cmd.fs.StringVar(&cmd.prefix, "prefix", "", "name prefix")
+		cmd.fs.Var(&cmd.rules, "map", "map a path prefix to a name prefix, as from=to (can be repeated)")
+		cmd.fs.Var(&cmd.exclude, "exclude", "exclude relative paths matching pattern (can be repeated)")
+		cmd.fs.StringVar(&cmd.conflict, "conflict", conflictFail, "conflict policy (fail, skip or overwrite)")
+		cmd.fs.BoolVar(&cmd.force, "f", false, "copy without confirmation")
+		if sub == "export" {
+			cmd.fs.Var(&cmd.tags, "tag", "tag the secrets, as key=value (can be repeated)")
+		}
+		switch store {
+		case "aws-sm", "ssm":
+			cmd.fs.StringVar(&cmd.profile, "profile", "", "AWS profile (default: $AWS_PROFILE or default)")
+			cmd.fs.StringVar(&cmd.region, "region", "", "AWS region (default: $AWS_REGION or from profile)")
+			if store == "ssm" {
+				cmd.fs.StringVar(&cmd.keyID, "kms-key", "", "KMS key to encrypt the parameters (default: AWS managed key)")
+			}
+		case "gcp-sm":
+			cmd.fs.StringVar(&cmd.project, "project", "", "GCP project (default: $GOOGLE_CLOUD_PROJECT or from credentials)")
+		}
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,70 @@
+package vc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestBridgeManifest(t *testing.T) {
+	m := &bridgeManifest{
+		Prefix: "app/",
+		Rules: []bridgeRule{
+			{From: "prod/", To: "production/app/"},
+		},
+		Exclude: []string{"*/tmp", "dev/*"},
+	}
+	if err := m.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Path     string
+		Name     string
+		Excluded bool
+	}{
+		{"db", "app/db", false},
+		{"prod/db", "production/app/db", false},
+		{"staging/tmp", "app/staging/tmp", true},
+		{"dev/db", "app/dev/db", true},
+	}
+	for _, test := range tests {
+		if got := m.name(test.Path); got != test.Name {
+			t.Fatalf("name(%q): expected %q, got %q", test.Path, test.Name, got)
+		}
+		if got, ok := m.path(test.Name); !ok || got != test.Path {
+			t.Fatalf("path(%q): expected %q, got %q", test.Name, test.Path, got)
+		}
+		if got := m.excluded(test.Path); got != test.Excluded {
+			t.Fatalf("excluded(%q): expected %t, got %t", test.Path, test.Excluded, got)
+		}
+	}
+	if _, ok := m.path("other/db"); ok {
+		t.Fatal("expected other/db not to be mapped")
+	}
+}
+
+func TestBridgeEncode(t *testing.T) {
+	data := map[string]interface{}{
+		CodecTypeKey: "json",
+		"username":   "test",
+		"port":       json.Number("5432"),
+	}
+	value, err := bridgeEncode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"port":5432,"username":"test"}`; value != want {
+		t.Fatalf("expected %s, got %s", want, value)
+	}
+	if !bridgeEqual(bridgeDecode(value), data) {
+		t.Fatalf("expected %s to equal %v", value, data)
+	}
+	if bridgeEqual(bridgeDecode(`{"username":"other"}`), data) {
+		t.Fatal("expected other values not to be equal")
+	}
+
+	if got, want := bridgeDecode("plain"), map[string]interface{}{bridgeValueKey: "plain"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
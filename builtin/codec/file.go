@@ -27,6 +27,18 @@ func (c fileCodec) Marshal(_ string, data map[string]interface{}) ([]byte, error
 	return base64.StdEncoding.DecodeString(contents)
 }
 
+// MarshalTo implements vc.StreamMarshaler, large files are decoded as they
+// are written
+func (c fileCodec) MarshalTo(w io.Writer, _ string, data map[string]interface{}) error {
+	contents, ok := data[fileContentsKey].(string)
+	if !ok {
+		return ErrFileContentsMissing
+	}
+
+	_, err := io.Copy(w, vc.Base64Reader(contents))
+	return err
+}
+
 func (c fileCodec) Unmarshal(p []byte) (map[string]interface{}, error) {
 	out := new(bytes.Buffer)
 	if len(p) > 0 {
@@ -3,6 +3,7 @@ package codec
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 
 	"github.com/tehmaze/vc"
 )
@@ -20,6 +21,13 @@ func (c jsonCodec) Marshal(_ string, data map[string]interface{}) ([]byte, error
 	return buf.Bytes(), nil
 }
 
+// MarshalTo implements vc.StreamMarshaler
+func (c jsonCodec) MarshalTo(w io.Writer, _ string, data map[string]interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
 func (c jsonCodec) Unmarshal(p []byte) (map[string]interface{}, error) {
 	var data map[string]interface{}
 	if err := json.Unmarshal(p, &data); err != nil {
@@ -0,0 +1,441 @@
+package vc
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// bundleManifestName is the name of the first entry of a bundle
+const bundleManifestName = "MANIFEST.json"
+
+// bundleVersion is the version of the bundle format
+const bundleVersion = 1
+
+// bundleManifest lists the secrets in a bundle, with the SHA-256 hash of
+// their entries; paths are relative to Root
+type bundleManifest struct {
+	Version int           `json:"version"`
+	Created time.Time     `json:"created"`
+	Source  string        `json:"source"`
+	Root    string        `json:"root"`
+	Secrets []bundleEntry `json:"secrets"`
+}
+
+// bundleEntry is a secret in a bundle, stored in File as an exportRecord
+type bundleEntry struct {
+	Path   string `json:"path"`
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+// writeBundle writes the tar archive with the manifest and the records
+func writeBundle(w io.Writer, m *bundleManifest, records [][]byte) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	add := func(name string, b []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(b)), ModTime: m.Created}); err != nil {
+			return err
+		}
+		_, err := tw.Write(b)
+		return err
+	}
+	if err = add(bundleManifestName, append(b, '\n')); err != nil {
+		return err
+	}
+	for i, entry := range m.Secrets {
+		if err = add(entry.File, records[i]); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// readBundle reads the tar archive of a bundle, and verifies that it has all
+// the secrets in the manifest, with their hashes, and nothing else
+func readBundle(r io.Reader) (*bundleManifest, []exportRecord, error) {
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a bundle: %v", err)
+	} else if header.Name != bundleManifestName {
+		return nil, nil, fmt.Errorf("not a bundle: %s is missing", bundleManifestName)
+	}
+	m := new(bundleManifest)
+	if err = json.NewDecoder(tr).Decode(m); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", bundleManifestName, err)
+	} else if m.Version != bundleVersion {
+		return nil, nil, fmt.Errorf("unsupported bundle version %d", m.Version)
+	}
+
+	var (
+		entries = make(map[string]bundleEntry, len(m.Secrets))
+		paths   = make(map[string]bool, len(m.Secrets))
+	)
+	for _, entry := range m.Secrets {
+		if !bundlePath(entry.Path) {
+			return nil, nil, fmt.Errorf("%s: invalid path %q", bundleManifestName, entry.Path)
+		} else if _, ok := entries[entry.File]; ok {
+			return nil, nil, fmt.Errorf("%s: duplicate entry %s", bundleManifestName, entry.File)
+		} else if paths[entry.Path] {
+			return nil, nil, fmt.Errorf("%s: duplicate path %s", bundleManifestName, entry.Path)
+		}
+		entries[entry.File] = entry
+		paths[entry.Path] = true
+	}
+	records := make(map[string]exportRecord, len(m.Secrets))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		entry, ok := entries[header.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s is not in the manifest", header.Name)
+		} else if _, ok = records[header.Name]; ok {
+			return nil, nil, fmt.Errorf("duplicate entry %s", header.Name)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hash := hashBytes(b); hash != entry.SHA256 {
+			wipe(b)
+			return nil, nil, fmt.Errorf("%s: hash mismatch, expected %s, got %s", entry.Path, entry.SHA256, hash)
+		}
+		var record exportRecord
+		decoder := json.NewDecoder(bytes.NewReader(b))
+		decoder.UseNumber()
+		err = decoder.Decode(&record)
+		wipe(b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", entry.Path, err)
+		} else if record.Path != entry.Path {
+			return nil, nil, fmt.Errorf("%s: has path %s", entry.Path, record.Path)
+		}
+		records[header.Name] = record
+	}
+
+	ordered := make([]exportRecord, 0, len(m.Secrets))
+	for _, entry := range m.Secrets {
+		record, ok := records[entry.File]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: missing from the bundle", entry.Path)
+		}
+		ordered = append(ordered, record)
+	}
+	return m, ordered, nil
+}
+
+// bundlePath checks if p is a clean relative path below the root of a bundle
+func bundlePath(p string) bool {
+	switch {
+	case p == "", p == ".", p == "..", path.IsAbs(p):
+		return false
+	case strings.HasPrefix(p, "../"), path.Clean(p) != p:
+		return false
+	}
+	return true
+}
+
+// BundleCommand packages secrets in an encrypted bundle, and applies bundles,
+// for transfers to Vault clusters without a network connection
+type BundleCommand struct {
+	baseCommand
+	fs         *flag.FlagSet
+	sub        string
+	recipients stringsValue
+	identity   string
+	force      bool
+}
+
+func (cmd *BundleCommand) Help() string {
+	switch cmd.sub {
+	case "create":
+		return `Usage: vc bundle create [<options>] -recipient <recipient> -o <bundle> <path>
+
+Package the secret at path, or the secrets below it, in a bundle: a tar archive
+with a manifest of the secrets and the SHA-256 hashes of their entries, and one
+entry per secret; the archive is encrypted with age to the recipients. age
+authenticates the archive, vc bundle apply verifies the hashes; the bundle can
+be carried to a Vault cluster without a network connection, and applied there.
+
+Options:
+` + defaults(cmd.fs)
+	case "apply":
+		return `Usage: vc bundle apply [<options>] -identity <file> <bundle> [<path>]
+
+Decrypt the bundle with the age identity, verify it against its manifest, and
+write its secrets below path (default: the path the bundle was created from,
+or its parent for a single secret), after confirmation. Nothing is written if any entry is missing, doesn't match
+its hash, or isn't in the manifest. Secrets with the same values are left
+alone.
+
+Options:
+` + defaults(cmd.fs)
+	}
+	return `Usage: vc bundle <create|apply> [<options>]`
+}
+
+func (cmd *BundleCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	args = cmd.fs.Args()
+
+	switch cmd.sub {
+	case "create":
+		if len(args) != 1 {
+			return Help
+		} else if len(cmd.recipients) == 0 {
+			cmd.ui.Error("error: -recipient is required")
+			return SyntaxError
+		} else if cmd.out == "" || cmd.out == "-" {
+			cmd.ui.Error("error: -o is required")
+			return SyntaxError
+		}
+		for _, recipient := range cmd.recipients {
+			if !isAgeRecipient(recipient) {
+				cmd.ui.Error(fmt.Sprintf("error: %s is not an age recipient", recipient))
+				return SyntaxError
+			}
+		}
+	case "apply":
+		if len(args) < 1 || len(args) > 2 {
+			return Help
+		} else if cmd.identity == "" {
+			cmd.ui.Error("error: -identity is required")
+			return SyntaxError
+		}
+	default:
+		return Help
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	if cmd.sub == "create" {
+		err = cmd.create(client, cmd.resolve(args[0]))
+	} else {
+		var (
+			m       *bundleManifest
+			records []exportRecord
+		)
+		if m, records, err = cmd.load(args[0]); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v; nothing was written", args[0], err))
+			return CodecError
+		}
+		root := m.Root
+		if len(args) > 1 {
+			root = cmd.resolve(args[1])
+		}
+		Debugf("bundle: %d secrets of %s from %s, created %s", len(records), m.Root, m.Source, m.Created.Format(time.RFC3339))
+		err = cmd.apply(client, records, strings.Trim(root, "/"))
+	}
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	return Success
+}
+
+// create writes the bundle of the secrets at or below root
+func (cmd *BundleCommand) create(client *Client, root string) error {
+	if !DryRun {
+		if err := cmd.checkWritable(cmd.out); err != nil {
+			return err
+		}
+	}
+	paths, err := client.secretsBelow(root)
+	if err != nil {
+		return err
+	}
+	m := &bundleManifest{
+		Version: bundleVersion,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Source:  client.Address(),
+		Root:    strings.Trim(client.Abs(root), "/"),
+	}
+	if len(paths) == 1 && strings.Trim(paths[0], "/") == m.Root {
+		// A single secret, relative to its parent
+		m.Root = path.Dir(m.Root)
+		if m.Root == "." {
+			m.Root = ""
+		}
+	}
+	prefix := m.Root + "/"
+	if m.Root == "" {
+		prefix = ""
+	}
+	var records [][]byte
+	defer func() {
+		for _, b := range records {
+			wipe(b)
+		}
+	}()
+	progress := cmd.progress("reading", len(paths))
+	for _, p := range paths {
+		p = strings.TrimLeft(p, "/")
+		secret, err := client.ReadSecret(p)
+		if err != nil {
+			progress.Done()
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		progress.Add(1)
+		if secret == nil {
+			continue
+		}
+		record := exportRecord{Path: strings.TrimPrefix(p, prefix), Data: secret.Data}
+		b, err := exportMarshal(record)
+		if err != nil {
+			progress.Done()
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		records = append(records, b)
+		m.Secrets = append(m.Secrets, bundleEntry{
+			Path:   record.Path,
+			File:   fmt.Sprintf("secrets/%06d.json", len(records)),
+			SHA256: hashBytes(b),
+		})
+	}
+	progress.Done()
+	if len(m.Secrets) == 0 {
+		return notFound(root + ": no secrets")
+	}
+
+	if DryRun {
+		cmd.ui.Output(fmt.Sprintf("dry run: write a bundle of %d secrets to %s", len(m.Secrets), cmd.out))
+		return nil
+	}
+	w := EncryptingOutputWriter(SafeOutputWriter(cmd.out, 0600), cmd.recipients)
+	if err = writeBundle(w, m, records); err != nil {
+		w.(*encryptingOutputWriter).abort()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	cmd.ui.Info(fmt.Sprintf("bundle: %d secrets of %s written to %s", len(m.Secrets), m.Root, cmd.out))
+	return nil
+}
+
+// load decrypts and verifies the bundle name
+func (cmd *BundleCommand) load(name string) (*bundleManifest, []exportRecord, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, err := pipeCommand([]string{ageCommand, "--decrypt", "--identity", cmd.identity}, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer wipe(plain)
+	return readBundle(bytes.NewReader(plain))
+}
+
+// apply writes the secrets of a bundle below root
+func (cmd *BundleCommand) apply(client *Client, records []exportRecord, root string) error {
+	var (
+		actions   []bridgeAction
+		unchanged int
+	)
+	for _, record := range records {
+		action := bridgeAction{source: record.Path, target: path.Join(root, record.Path), data: record.Data}
+		secret, err := client.ReadSecret(action.target)
+		if err != nil {
+			return fmt.Errorf("%s: %v", action.target, err)
+		} else if secret == nil {
+			action.create = true
+		} else if bridgeEqual(secret.Data, action.data) {
+			unchanged++
+			continue
+		}
+		actions = append(actions, action)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].target < actions[j].target })
+	if len(actions) == 0 {
+		cmd.ui.Info(fmt.Sprintf("nothing to apply, %d secrets unchanged", unchanged))
+		return nil
+	}
+
+	var changes []string
+	for _, action := range actions {
+		if action.create {
+			changes = append(changes, "+ "+action.target)
+		} else {
+			changes = append(changes, "~ "+action.target)
+		}
+	}
+	if ok, err := cmd.confirmChanges(cmd.force, changes, "Apply %d secrets of the bundle to %s?", len(actions), root); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("not confirmed, nothing was written")
+	}
+
+	progress := cmd.progress("applying", len(actions))
+	defer progress.Done()
+	for _, action := range actions {
+		if err := cmd.writeSecret(client, action.target, action.data); err != nil {
+			return fmt.Errorf("%s: %v", action.target, err)
+		}
+		progress.Add(1)
+	}
+	if !DryRun {
+		cmd.ui.Info(fmt.Sprintf("applied %d secrets to %s, %d unchanged", len(actions), root, unchanged))
+	}
+	return nil
+}
+
+func (cmd *BundleCommand) Synopsis() string {
+	switch cmd.sub {
+	case "create":
+		return "package secrets in an encrypted bundle"
+	case "apply":
+		return "verify and write the secrets in a bundle"
+	}
+	return "transfer secrets in encrypted bundles"
+}
+
+func BundleCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &BundleCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("bundle "+sub, flag.ContinueOnError)
+		switch sub {
+		case "create":
+			cmd.fs.Var(&cmd.recipients, "recipient", "age recipient, can be repeated")
+			cmd.fs.StringVar(&cmd.out, "o", "", "bundle file")
+		case "apply":
+			cmd.fs.StringVar(&cmd.identity, "identity", "", "age identity file")
+			cmd.fs.BoolVar(&cmd.force, "f", false, "don't ask for confirmation")
+		}
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
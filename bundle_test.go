@@ -0,0 +1,154 @@
+package vc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestBundleCommand(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "bundle")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake age that "encrypts" and "decrypts" by copying stdin
+	script := filepath.Join(dir, "age")
+	if err = ioutil.WriteFile(script, []byte("#!/bin/sh\ncat\n"), 0755); err != nil {
+		t.Skip(err)
+	}
+	defer func(saved string) { ageCommand = saved }(ageCommand)
+	ageCommand = script
+
+	source := newReplicateServer("s.test", map[string]string{
+		"app/db":  `{"password": "secret", "port": 5432}`,
+		"app/web": `{"key": "k"}`,
+	}, nil)
+	defer source.Close()
+	target := newReplicateServer("s.test", map[string]string{
+		"app/web": `{"key": "k"}`,
+	}, nil)
+	defer target.Close()
+
+	// The clients share the handlers, and so the secrets and writes, of the servers
+	sourceClient := newTestClient(t, source.Config.Handler, nil)
+	targetClient := newTestClient(t, target.Config.Handler, nil)
+	run := func(c *Client, sub string, args ...string) (*cli.MockUi, int) {
+		ui := cli.NewMockUi()
+		command, _ := BundleCommandFactory(ui, sub)()
+		cmd := command.(*BundleCommand)
+		cmd.c, cmd.config = c, new(Config)
+		return ui, cmd.Run(args)
+	}
+
+	bundle := filepath.Join(dir, "app.bundle")
+	if ui, code := run(sourceClient, "create", "-o", bundle, "kv/app"); code != SyntaxError {
+		t.Fatalf("create: expected syntax error without -recipient, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if ui, code := run(sourceClient, "create", "-recipient", "age1test", "-o", bundle, "kv/app"); code != Success {
+		t.Fatalf("create: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if info, err := os.Stat(bundle); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("create: expected mode 0600 for the bundle, got %v (%v)", info, err)
+	}
+
+	// Only secrets with other values are written
+	if ui, code := run(targetClient, "apply", "-identity", "key.txt", "-f", bundle); code != Success {
+		t.Fatalf("apply: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	want := []string{`app/db {"password":"secret","port":5432}`}
+	if !reflect.DeepEqual(target.writes, want) {
+		t.Fatalf("apply: expected writes %q, got %q", want, target.writes)
+	}
+	target.writes = nil
+	if ui, code := run(targetClient, "apply", "-identity", "key.txt", "-f", bundle, "kv/mirror"); code != Success {
+		t.Fatalf("apply: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	sort.Strings(target.writes)
+	if len(target.writes) != 2 || !strings.HasPrefix(target.writes[0], "mirror/db ") {
+		t.Fatalf("apply: expected writes below kv/mirror, got %q", target.writes)
+	}
+
+	// A single secret is applied at its own path
+	single := filepath.Join(dir, "db.bundle")
+	if ui, code := run(sourceClient, "create", "-recipient", "age1test", "-o", single, "kv/app/db"); code != Success {
+		t.Fatalf("create: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	target.writes = nil
+	if ui, code := run(targetClient, "apply", "-identity", "key.txt", "-f", single); code != Success {
+		t.Fatalf("apply: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if !reflect.DeepEqual(target.writes, want) {
+		t.Fatalf("apply: expected writes %q, got %q", want, target.writes)
+	}
+
+	// Tampered bundles are not applied
+	b, err := ioutil.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := filepath.Join(dir, "tampered.bundle")
+	if err = ioutil.WriteFile(tampered, []byte(strings.Replace(string(b), `"secret"`, `"s3cret"`, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	target.writes = nil
+	ui, code := run(targetClient, "apply", "-identity", "key.txt", "-f", tampered, "kv/other")
+	if code != CodecError {
+		t.Fatalf("apply: expected codec error for a tampered bundle, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if got := ui.ErrorWriter.String(); !strings.Contains(got, "db: hash mismatch") {
+		t.Fatalf("apply: expected a hash mismatch, got %q", got)
+	}
+	if len(target.writes) != 0 {
+		t.Fatalf("apply: expected no writes, got %q", target.writes)
+	}
+}
+
+func TestReadBundle(t *testing.T) {
+	for _, p := range []string{"", ".", "..", "../db", "/db", "app/../../db", "app//db"} {
+		record, err := exportMarshal(exportRecord{Path: p, Data: map[string]interface{}{"key": "k"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &bundleManifest{Version: bundleVersion, Root: "kv/app", Secrets: []bundleEntry{
+			{Path: p, File: "secrets/000001.json", SHA256: hashBytes(record)},
+		}}
+		b := new(bytes.Buffer)
+		if err = writeBundle(b, m, [][]byte{record}); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = readBundle(b); err == nil || !strings.Contains(err.Error(), "invalid path") {
+			t.Errorf("%q: expected an invalid path, got %v", p, err)
+		}
+	}
+
+	// A path can't be in the bundle twice, the last would win
+	var (
+		m       = &bundleManifest{Version: bundleVersion, Root: "kv/app"}
+		records [][]byte
+	)
+	for i, password := range []string{"old", "new"} {
+		record, err := exportMarshal(exportRecord{Path: "db", Data: map[string]interface{}{"password": password}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Secrets = append(m.Secrets, bundleEntry{Path: "db", File: fmt.Sprintf("secrets/%06d.json", i+1), SHA256: hashBytes(record)})
+		records = append(records, record)
+	}
+	b := new(bytes.Buffer)
+	if err := writeBundle(b, m, records); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readBundle(b); err == nil || !strings.Contains(err.Error(), "duplicate path db") {
+		t.Errorf("expected a duplicate path, got %v", err)
+	}
+}
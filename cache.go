@@ -0,0 +1,238 @@
+package vc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Offline serves reads from the cache when Vault can't be reached, see Cache
+var Offline bool
+
+// Defaults for the cache
+const (
+	DefaultCacheDir = "$HOME/.cache/vc"
+	DefaultCacheTTL = 24 * time.Hour
+)
+
+// ageKeygenCommand derives the recipient of an age identity
+var ageKeygenCommand = "age-keygen"
+
+// Cache configures the cache of the secrets that were read; entries are
+// encrypted with age, with systemd-creds, or with the store key of the
+// security key
+type Cache struct {
+	// Dir is the cache directory, see DefaultCacheDir
+	Dir string `yaml:"dir,omitempty"`
+
+	// TTL is how long entries are used, see DefaultCacheTTL; secrets with a
+	// lease are used until the lease expires, if that is sooner
+	TTL time.Duration `yaml:"ttl,omitempty"`
+
+	// Identity is the age identity file that decrypts the entries
+	Identity string `yaml:"identity,omitempty"`
+
+	// Recipient encrypts the entries, derived from Identity if not set
+	Recipient string `yaml:"recipient,omitempty"`
+
+	// SystemdCreds encrypts the entries with systemd-creds, with the host key
+	// or the TPM, instead of age
+	SystemdCreds bool `yaml:"systemd_creds,omitempty"`
+
+	// SecurityKey encrypts the entries with the store key of the security
+	// key, see SecurityKey, instead of age
+	SecurityKey bool `yaml:"security_key,omitempty"`
+}
+
+// cacheEntry is a cached response
+type cacheEntry struct {
+	Address   string      `json:"address"`
+	Namespace string      `json:"namespace,omitempty"`
+	Path      string      `json:"path"`
+	Stored    time.Time   `json:"stored"`
+	Expires   time.Time   `json:"expires"`
+	Secret    *api.Secret `json:"secret"`
+}
+
+// secretCache implements client.Cache with encrypted files, one per path
+type secretCache struct {
+	config    Cache
+	dir       string
+	address   string
+	namespace string
+	key       *storeKey
+
+	recipientOnce sync.Once
+	recipient     string
+	recipientErr  error
+}
+
+func newSecretCache(config *Cache, address, namespace string, key *storeKey) (*secretCache, error) {
+	c := &secretCache{config: *config, address: address, namespace: namespace}
+	if c.config.TTL <= 0 {
+		c.config.TTL = DefaultCacheTTL
+	}
+	if c.dir = c.config.Dir; c.dir == "" {
+		c.dir = DefaultCacheDir
+	}
+	c.dir = os.ExpandEnv(c.dir)
+	if c.config.SecurityKey {
+		if key == nil {
+			return nil, errors.New("cache: security_key requires security_key in the configuration")
+		}
+		c.key = key
+		return c, nil
+	}
+	if c.config.Identity == "" && !c.config.SystemdCreds {
+		return nil, errors.New("cache: identity, systemd_creds or security_key is required")
+	}
+	c.config.Identity = os.ExpandEnv(c.config.Identity)
+	return c, nil
+}
+
+// name returns the file of the entry for path; the same path in another
+// namespace is another entry
+func (c *secretCache) name(path string) string {
+	hash := sha256.Sum256([]byte(c.address + "\x00" + c.namespace + "\x00" + path))
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:])+".cache")
+}
+
+// Get implements client.Cache; cached responses are stale, which is shown in
+// a warning
+func (c *secretCache) Get(path string) *api.Secret {
+	b, err := ioutil.ReadFile(c.name(path))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cache: %v\n", err)
+		return nil
+	}
+	if b, err = c.decrypt(b); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cache: %s: %v\n", path, err)
+		return nil
+	}
+	var entry cacheEntry
+	if err = json.Unmarshal(b, &entry); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cache: %s: %v\n", path, err)
+		return nil
+	}
+	if entry.Address != c.address || entry.Namespace != c.namespace || entry.Path != path || time.Now().After(entry.Expires) {
+		Debugf("cache: %s expired", path)
+		return nil
+	}
+	metrics.add(cacheReads, 1)
+	fmt.Fprintf(os.Stderr, "warning: Vault is unreachable, using stale %s from %s\n", path, entry.Stored.Format(time.RFC3339))
+	return entry.Secret
+}
+
+// Put implements client.Cache; errors are reported as warnings, they don't
+// fail the read
+func (c *secretCache) Put(path string, secret *api.Secret) {
+	if DryRun {
+		return
+	}
+	name := c.name(path)
+	if secret == nil {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "warning: cache: %v\n", err)
+		}
+		return
+	}
+	if err := c.put(name, path, secret); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: cache: %s: %v\n", path, err)
+	}
+}
+
+func (c *secretCache) put(name, path string, secret *api.Secret) error {
+	now := time.Now()
+	entry := cacheEntry{
+		Address:   c.address,
+		Namespace: c.namespace,
+		Path:      path,
+		Stored:    now,
+		Expires:   now.Add(c.config.TTL),
+		Secret:    secret,
+	}
+	if lease := time.Duration(secret.LeaseDuration) * time.Second; secret.LeaseID != "" && lease < c.config.TTL {
+		entry.Expires = now.Add(lease)
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if b, err = c.encrypt(b); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	w := SafeOutputWriter(name, 0600)
+	if _, err = w.Write(b); err != nil {
+		w.(*safeOutputWriter).abort()
+		return err
+	}
+	return w.Close()
+}
+
+func (c *secretCache) encrypt(b []byte) ([]byte, error) {
+	if c.key != nil {
+		return c.key.seal(b)
+	}
+	if c.config.SystemdCreds {
+		return pipeCommand([]string{systemdCreds, "encrypt", "--name=vc-cache", "-", "-"}, b)
+	}
+	c.recipientOnce.Do(func() {
+		if c.recipient = c.config.Recipient; c.recipient == "" {
+			var out []byte
+			out, c.recipientErr = pipeCommand([]string{ageKeygenCommand, "-y", c.config.Identity}, nil)
+			c.recipient = strings.TrimSpace(string(out))
+		}
+	})
+	if c.recipientErr != nil {
+		return nil, c.recipientErr
+	}
+	return pipeCommand([]string{ageCommand, "--encrypt", "--recipient", c.recipient}, b)
+}
+
+func (c *secretCache) decrypt(b []byte) ([]byte, error) {
+	if c.key != nil {
+		if !bytes.HasPrefix(b, []byte(sealedPrefix)) {
+			return nil, errors.New("entry isn't sealed with the security key")
+		}
+		return c.key.open(b)
+	}
+	if c.config.SystemdCreds {
+		return pipeCommand([]string{systemdCreds, "decrypt", "--name=vc-cache", "-", "-"}, b)
+	}
+	return pipeCommand([]string{ageCommand, "--decrypt", "--identity", c.config.Identity}, b)
+}
+
+// pipeCommand runs the command line args with in on stdin, and returns its
+// output
+func pipeCommand(args []string, in []byte) ([]byte, error) {
+	var stderr bytes.Buffer
+	c := exec.Command(args[0], args[1:]...)
+	c.Stdin = bytes.NewReader(in)
+	c.Stderr = &stderr
+	Debugf("cache: %s", strings.Join(args, " "))
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("%s: %v", args[0], err)
+	}
+	return out, nil
+}
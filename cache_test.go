@@ -0,0 +1,78 @@
+package vc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestSecretCache(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "cache")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake age that "encrypts" by copying stdin, and saves its arguments
+	script := filepath.Join(dir, "age")
+	if err = ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > \"$0.args\"\ncat\n"), 0755); err != nil {
+		t.Skip(err)
+	}
+	keygen := filepath.Join(dir, "age-keygen")
+	if err = ioutil.WriteFile(keygen, []byte("#!/bin/sh\necho age1test\n"), 0755); err != nil {
+		t.Skip(err)
+	}
+	defer func(saved, savedKeygen string) { ageCommand, ageKeygenCommand = saved, savedKeygen }(ageCommand, ageKeygenCommand)
+	ageCommand, ageKeygenCommand = script, keygen
+
+	if _, err = newSecretCache(&Cache{}, "https://vault:8200", "", nil); err == nil {
+		t.Fatal("expected error without identity")
+	}
+	c, err := newSecretCache(&Cache{Dir: filepath.Join(dir, "cache"), Identity: "key.txt"}, "https://vault:8200", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Get("secret/db") != nil {
+		t.Fatal("expected no entry")
+	}
+	c.Put("secret/db", &api.Secret{Data: map[string]interface{}{"password": "secret"}})
+	if b, _ := ioutil.ReadFile(script + ".args"); string(b) != "--encrypt --recipient age1test\n" {
+		t.Fatalf("unexpected age arguments %q", b)
+	}
+	secret := c.Get("secret/db")
+	if secret == nil || secret.Data["password"] != "secret" {
+		t.Fatalf("expected cached secret, got %+v", secret)
+	}
+	if b, _ := ioutil.ReadFile(script + ".args"); string(b) != "--decrypt --identity key.txt\n" {
+		t.Fatalf("unexpected age arguments %q", b)
+	}
+
+	// Entries are for one Vault server and namespace
+	other, _ := newSecretCache(&Cache{Dir: filepath.Join(dir, "cache"), Identity: "key.txt"}, "https://other:8200", "", nil)
+	if other.Get("secret/db") != nil {
+		t.Fatal("expected no entry for other server")
+	}
+	other, _ = newSecretCache(&Cache{Dir: filepath.Join(dir, "cache"), Identity: "key.txt"}, "https://vault:8200", "team", nil)
+	if other.Get("secret/db") != nil {
+		t.Fatal("expected no entry for other namespace")
+	}
+
+	// Leases expire the entry
+	c.Put("database/creds/app", &api.Secret{LeaseID: "database/creds/app/1", LeaseDuration: 1, Data: map[string]interface{}{"username": "v-app"}})
+	if c.Get("database/creds/app") == nil {
+		t.Fatal("expected cached secret")
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if c.Get("database/creds/app") != nil {
+		t.Fatal("expected lease to expire the entry")
+	}
+
+	c.Put("secret/db", nil)
+	if c.Get("secret/db") != nil {
+		t.Fatal("expected entry to be removed")
+	}
+}
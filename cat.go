@@ -1,14 +1,14 @@
 package vc
 
 import (
-	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/mitchellh/cli"
@@ -19,12 +19,19 @@ type CatCommand struct {
 	baseCommand
 	fs            *flag.FlagSet
 	key           string
+	query         string
 	mod           string
 	ignoreMissing bool
+	decode        bool
+	clip          bool
+	qr            bool
+	dir           string
+	clean         bool
+	clipTimeout   time.Duration
 }
 
 func (cmd *CatCommand) Help() string {
-	return "Usage: vc cat [<options>] <secret path> [... <secret path>]\n\nOptions:\n" + defaults(cmd.fs)
+	return "Usage: vc cat [<options>] <secret path>[@<version>] [... <secret path>]\n\nOptions:\n" + defaults(cmd.fs)
 }
 
 func (cmd *CatCommand) Run(args []string) int {
@@ -35,11 +42,42 @@ func (cmd *CatCommand) Run(args []string) int {
 		return Help
 	}
 
-	if mode, err := strconv.ParseInt(cmd.mod, 8, 32); err != nil {
-		cmd.ui.Error("error: invalid mode: " + err.Error())
+	if mode, err := cmd.outputMode(cmd.fs, cmd.mod); err != nil {
+		cmd.ui.Error("error: " + err.Error())
 		return SyntaxError
 	} else {
-		cmd.mode = os.FileMode(mode)
+		cmd.mode = mode
+	}
+
+	var (
+		steps  []queryStep
+		single = len(args) == 1 && ((cmd.key != "" && cmd.key != CodecTypeKey) || cmd.query != "")
+	)
+	if cmd.decode && (cmd.key == "" || cmd.key == CodecTypeKey) {
+		cmd.ui.Error("error: -decode requires a key (-k)")
+		return SyntaxError
+	}
+	if cmd.clip && !single {
+		cmd.ui.Error("error: -clip requires a single secret path and a key (-k) or query")
+		return SyntaxError
+	}
+	if cmd.qr && (!single || (cmd.out != "" && cmd.out != "-")) {
+		cmd.ui.Error("error: -qr requires a single secret path and a key (-k) or query, and can only write to stdout")
+		return SyntaxError
+	}
+	if cmd.dir != "" && (len(args) != 1 || cmd.key != "" || cmd.query != "" || cmd.clip || cmd.qr || cmd.out != "") {
+		cmd.ui.Error("error: -dir requires a single secret path, and can't be used with -k, -query, -clip, -qr or -o")
+		return SyntaxError
+	} else if cmd.clean && cmd.dir == "" {
+		cmd.ui.Error("error: -clean requires -dir")
+		return SyntaxError
+	}
+	if cmd.query != "" {
+		var err error
+		if steps, err = parseQuery(cmd.query); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SyntaxError
+		}
 	}
 
 	c, err := cmd.Client()
@@ -47,54 +85,91 @@ func (cmd *CatCommand) Run(args []string) int {
 		cmd.ui.Error(err.Error())
 		return ClientError
 	}
+	if err = cmd.checkWritable(cmd.out); err != nil && !DryRun {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SystemError)
+	}
 
-	// Expand globs (if any)
-	if args, err = cmd.globs(c, args); err != nil {
+	// Expand aliases and globs (if any)
+	args = cmd.resolveAll(args)
+	if args, err = c.expand(args, isSecret); err != nil {
 		cmd.ui.Error(fmt.Sprintf("error: %v", err))
 		return SyntaxError
 	}
+	if cmd.dir != "" && len(args) != 1 {
+		cmd.ui.Error("error: -dir requires a single secret path")
+		return SyntaxError
+	}
 
-	buf := new(bytes.Buffer)
+	// Output is streamed to the output file, unless it is copied to the
+	// clipboard or shown as a QR code; then the value is wiped afterwards
+	var (
+		buf = new(secureBuffer)
+		out io.Writer
+	)
+	defer buf.Wipe()
+	if cmd.clip || cmd.qr {
+		out = buf
+	} else {
+		out = cmd
+	}
 	for _, path := range args {
-		Debugf("cat: read %q", strings.TrimLeft(path, "/"))
-		s, err := c.Logical().Read(strings.TrimLeft(path, "/"))
+		var s *api.Secret
+		if name, version, ok := splitVersion(path); ok {
+			s, err = c.ReadVersion(name, version)
+		} else {
+			Debugf("cat: read %q", strings.TrimLeft(path, "/"))
+			s, err = c.Read(path)
+		}
 		if err != nil {
+			cmd.abort()
 			cmd.ui.Error(err.Error())
-			return ServerError
+			return exitCode(err, ServerError)
 		}
 		if s == nil {
+			cmd.abort()
 			cmd.ui.Error(fmt.Sprintf("error: %s: secret not found", path))
-			return SyntaxError
+			return NotFoundError
 		}
 		var ret int
-		if cmd.key == "" {
+		if cmd.dir != "" {
+			ret = cmd.runDir(path, s)
+		} else if cmd.query != "" {
+			ret = cmd.runQuery(path, s, steps, out)
+		} else if cmd.key == "" {
 			// No explicit key given
 			if _, ok := s.Data[CodecTypeKey]; ok {
 				// But the __TYPE__ key is available
-				ret = cmd.runTyped(path, s, buf)
+				ret = cmd.runTyped(path, s, out)
 			} else {
-				ret = cmd.run(path, s, buf)
+				ret = cmd.run(path, s, out)
 			}
 		} else if cmd.key == CodecTypeKey {
 			// Key explicitly set to CodecTypeKey
-			ret = cmd.runTyped(path, s, buf)
+			ret = cmd.runTyped(path, s, out)
 		} else {
 			// Default, keyed item
-			ret = cmd.runKeyed(path, s, buf)
+			ret = cmd.runKeyed(path, s, out)
 		}
 		if ret != Success {
+			cmd.abort()
 			return ret
 		}
 	}
 
-	// Close output file that gets opened with Write
-	defer func() {
-		if cerr := cmd.Close(); cerr != nil {
-			cmd.ui.Error(fmt.Sprintf("error: %v", cerr))
+	if cmd.clip {
+		return cmd.runClip(buf.Bytes())
+	}
+	if cmd.qr {
+		if err = renderQR(os.Stdout, string(buf.Bytes())); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
 		}
-	}()
+		return Success
+	}
 
-	if _, err = io.Copy(cmd, buf); err != nil {
+	// Close output file that gets opened with Write
+	if err = cmd.Close(); err != nil {
 		cmd.ui.Error(fmt.Sprintf("error: %v", err))
 		return SystemError
 	}
@@ -102,26 +177,6 @@ func (cmd *CatCommand) Run(args []string) int {
 	return Success
 }
 
-// globs expands one or more paths containing glob(s)
-func (cmd *CatCommand) globs(c *Client, patterns []string) (expanded []string, err error) {
-	for _, pattern := range patterns {
-		var infos []os.FileInfo
-		if c.isGlob(pattern) {
-			if infos, err = c.Glob(pattern); err != nil {
-				return
-			}
-		} else {
-			expanded = append(expanded, pattern)
-		}
-		if len(infos) > 0 {
-			for _, info := range infos {
-				expanded = append(expanded, info.Name())
-			}
-		}
-	}
-	return
-}
-
 func (cmd *CatCommand) run(path string, s *api.Secret, buf io.Writer) int {
 	enc := json.NewEncoder(buf)
 	enc.SetIndent("", "  ")
@@ -133,22 +188,81 @@ func (cmd *CatCommand) run(path string, s *api.Secret, buf io.Writer) int {
 	return Success
 }
 
+func (cmd *CatCommand) runQuery(path string, s *api.Secret, steps []queryStep, buf io.Writer) int {
+	results, err := evalQuery(steps, s.Data)
+	if err != nil {
+		if cmd.ignoreMissing {
+			return Success
+		}
+		cmd.ui.Error(fmt.Sprintf("error: %s: query %q: %v", path, cmd.query, err))
+		return SyntaxError
+	}
+
+	for i, result := range results {
+		if i > 0 {
+			buf.Write(nl)
+		}
+		if val, ok := result.(string); ok {
+			_, err = io.WriteString(buf, val)
+		} else {
+			var b []byte
+			if b, err = json.Marshal(result); err == nil {
+				_, err = buf.Write(b)
+			}
+		}
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: query %q: %v", path, cmd.query, err))
+			return CodecError
+		}
+	}
+	// Scripts expect line terminated output, unless a single value is copied
+	if !cmd.clip && !cmd.qr {
+		buf.Write(nl)
+	}
+
+	return Success
+}
+
 func (cmd *CatCommand) runKeyed(path string, s *api.Secret, buf io.Writer) int {
-	val, ok := s.Data[cmd.key]
+	key := cmd.key
+	val, ok := s.Data[key]
+	if !ok && cmd.decode {
+		// Binary values are stored with a suffix, see WriteCommand
+		key = cmd.key + binaryKeySuffix
+		val, ok = s.Data[key]
+	}
 	if !ok {
 		if cmd.ignoreMissing {
 			return Success
 		}
-		cmd.ui.Error(fmt.Sprintf("error: %s: key %q not found\n", path, cmd.key))
+		if _, binary := s.Data[cmd.key+binaryKeySuffix]; binary {
+			cmd.ui.Error(fmt.Sprintf("error: %s: key %q not found; maybe decode %s%s with -decode?\n", path, cmd.key, cmd.key, binaryKeySuffix))
+		} else {
+			cmd.ui.Error(fmt.Sprintf("error: %s: key %q not found\n", path, cmd.key))
+		}
 		return SyntaxError
 	}
 
 	var err error
+	if cmd.decode {
+		encoded, isString := val.(string)
+		if !isString {
+			cmd.ui.Error(fmt.Sprintf("error: %s: key %q: can't decode type %T", path, key, val))
+			return CodecError
+		}
+		// Large values are decoded as they are written
+		if _, err = io.Copy(buf, Base64Reader(encoded)); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: key %q: %v", path, key, err))
+			return CodecError
+		}
+		return Success
+	}
+
 	switch val := val.(type) {
 	case []byte:
 		_, err = buf.Write(val)
 	case string:
-		_, err = buf.Write([]byte(val))
+		_, err = io.WriteString(buf, val)
 	default:
 		err = fmt.Errorf("vc: can't cat type %T", val)
 	}
@@ -178,17 +292,43 @@ func (cmd *CatCommand) runTyped(path string, s *api.Secret, buf io.Writer) int {
 		return CodecError
 	}
 
-	var b []byte
-	if b, err = c.Marshal(path, s.Data); err != nil {
+	if err = marshalTo(buf, c, path, s.Data); err != nil {
 		cmd.ui.Error(err.Error())
 		return SystemError
 	}
 
-	if _, err = buf.Write(b); err != nil {
-		cmd.ui.Error(err.Error())
+	return Success
+}
+
+// runClip copies the value to the clipboard and clears it after the timeout
+func (cmd *CatCommand) runClip(value []byte) int {
+	if err := copyToClipboard(value); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
 		return SystemError
 	}
+	if cmd.clipTimeout <= 0 {
+		cmd.ui.Info("copied to clipboard")
+		return Success
+	}
+
+	cmd.ui.Info(fmt.Sprintf("copied to clipboard, clearing in %s", cmd.clipTimeout))
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	select {
+	case <-time.After(cmd.clipTimeout):
+	case <-interrupt:
+	}
 
+	cleared, err := clearClipboard(value)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	} else if !cleared {
+		cmd.ui.Info("clipboard changed since, not cleared")
+		return Success
+	}
+	cmd.ui.Info("clipboard cleared")
 	return Success
 }
 
@@ -205,10 +345,18 @@ func CatCommandFactory(ui cli.Ui) cli.CommandFactory {
 		}
 
 		cmd.fs = flag.NewFlagSet("cat", flag.ContinueOnError)
+		cmd.fs.BoolVar(&cmd.clip, "clip", false, "copy the value of key to the clipboard")
+		cmd.fs.DurationVar(&cmd.clipTimeout, "clip-timeout", 45*time.Second, "clear the clipboard after timeout (0 to disable)")
 		cmd.fs.BoolVar(&cmd.ignoreMissing, "i", false, "ingore missing key")
+		cmd.fs.BoolVar(&cmd.clean, "clean", false, "with -dir, remove the files of keys that no longer exist")
+		cmd.fs.StringVar(&cmd.dir, "dir", "", "write each key to its own file in directory")
+		cmd.fs.BoolVar(&cmd.decode, "decode", false, "base64 decode the value of key (or key"+binaryKeySuffix+")")
+		cmd.fs.StringVar(&cmd.key, "f", "", "field (alias for -k)")
 		cmd.fs.StringVar(&cmd.key, "k", "", "key")
 		cmd.fs.StringVar(&cmd.mod, "m", "0600", "output mode")
 		cmd.fs.StringVar(&cmd.out, "o", "", "output (default stdout)")
+		cmd.fs.BoolVar(&cmd.qr, "qr", false, "show the value of key as QR code")
+		cmd.fs.StringVar(&cmd.query, "query", "", "query expression, such as .database.hosts[0]")
 		cmd.fs.Usage = func() {
 			fmt.Print(cmd.Help())
 		}
@@ -0,0 +1,233 @@
+package vc
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// certInfo is a certificate found in a secret
+type certInfo struct {
+	Path     string    `json:"path"`
+	Key      string    `json:"key"`
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	Serial   string    `json:"serial"`
+	NotAfter time.Time `json:"not_after"`
+	Days     int       `json:"days"`
+	Status   string    `json:"status"`
+}
+
+// Status of a certificate, see certInfo
+const (
+	certValid    = "ok"
+	certExpiring = "expiring"
+	certExpired  = "expired"
+)
+
+// pemCertificates parses the PEM encoded certificates in s; certificates that
+// can't be parsed are returned as errors
+func pemCertificates(s string) ([]*x509.Certificate, []error) {
+	var (
+		certs []*x509.Certificate
+		errs  []error
+	)
+	if !strings.Contains(s, "-----BEGIN CERTIFICATE-----") {
+		return nil, nil
+	}
+	for rest := []byte(s); ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		} else if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	return certs, errs
+}
+
+// secretCertificates returns the certificates in the values of data, and in
+// lists of values (such as ca_chain), by key
+func secretCertificates(path string, data map[string]interface{}, now time.Time, warn time.Duration) ([]certInfo, []error) {
+	var (
+		infos []certInfo
+		errs  []error
+	)
+	for _, key := range sortedKeys(data) {
+		var values []string
+		switch v := data[key].(type) {
+		case string:
+			values = []string{v}
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+		for _, value := range values {
+			certs, bad := pemCertificates(value)
+			for _, err := range bad {
+				errs = append(errs, fmt.Errorf("%s: %s: %v", path, key, err))
+			}
+			for _, cert := range certs {
+				info := certInfo{
+					Path:     path,
+					Key:      key,
+					Subject:  cert.Subject.String(),
+					Issuer:   cert.Issuer.String(),
+					Serial:   fmt.Sprintf("%x", cert.SerialNumber),
+					NotAfter: cert.NotAfter.UTC(),
+					Days:     int(cert.NotAfter.Sub(now).Hours() / 24),
+					Status:   certValid,
+				}
+				if now.After(cert.NotAfter) {
+					info.Status = certExpired
+				} else if now.Add(warn).After(cert.NotAfter) {
+					info.Status = certExpiring
+				}
+				infos = append(infos, info)
+			}
+		}
+	}
+	return infos, errs
+}
+
+// CertsCommand checks the certificates stored in secrets
+type CertsCommand struct {
+	baseCommand
+	fs       *flag.FlagSet
+	sub      string
+	warnDays int
+	raw      bool
+}
+
+func (cmd *CertsCommand) Help() string {
+	return `Usage: vc certs check [<options>] <path> [... <path>]
+
+Find the PEM encoded certificates in the values of the secrets at the paths,
+and below directories, and report their subject and the days until they
+expire. If a certificate expires within -warn-days, or expired, the exit code
+is 12.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *CertsCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) == 0 || cmd.sub != "check" {
+		return Help
+	}
+	if cmd.warnDays < 0 {
+		cmd.ui.Error("error: -warn-days can't be negative")
+		return SyntaxError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	paths, err := client.secretsAt(args)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+
+	var (
+		certs = []certInfo{}
+		now   = time.Now()
+		warn  = time.Duration(cmd.warnDays) * 24 * time.Hour
+		ret   int
+	)
+	for _, path := range paths {
+		path = strings.TrimLeft(path, "/")
+		secret, err := client.ReadSecret(path)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", path, err))
+			return exitCode(err, ServerError)
+		} else if secret == nil {
+			continue
+		}
+		found, errs := secretCertificates(path, secret.Data, now, warn)
+		for _, err := range errs {
+			cmd.ui.Warn(fmt.Sprintf("warning: %v", err))
+		}
+		for _, cert := range found {
+			if cert.Status != certValid {
+				ret = ExpiryError
+			}
+		}
+		certs = append(certs, found...)
+	}
+
+	if cmd.raw {
+		b, err := json.MarshalIndent(certs, "", "  ")
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return CodecError
+		}
+		cmd.ui.Output(string(b))
+		return ret
+	}
+
+	var (
+		b        = new(bytes.Buffer)
+		w        = tabwriter.NewWriter(b, 0, 8, 2, ' ', 0)
+		expiring int
+	)
+	fmt.Fprintln(w, "PATH\tKEY\tSUBJECT\tEXPIRES\tDAYS\tSTATUS")
+	for _, cert := range certs {
+		if cert.Status != certValid {
+			expiring++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", cert.Path, cert.Key, cert.Subject, cert.NotAfter.Format("2006-01-02"), cert.Days, cert.Status)
+	}
+	w.Flush()
+	if len(certs) > 0 {
+		cmd.ui.Output(strings.TrimSuffix(b.String(), "\n"))
+	}
+	cmd.ui.Info(fmt.Sprintf("certs: %d certificates in %d secrets, %d expiring within %d days or expired", len(certs), len(paths), expiring, cmd.warnDays))
+	return ret
+}
+
+func (cmd *CertsCommand) Synopsis() string {
+	return "report the expiry of certificates stored in secrets"
+}
+
+func CertsCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &CertsCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("certs "+sub, flag.ContinueOnError)
+		cmd.fs.BoolVar(&cmd.raw, "json", false, "print the certificates as JSON")
+		cmd.fs.IntVar(&cmd.warnDays, "warn-days", 30, "report certificates expiring within days")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
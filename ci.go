@@ -0,0 +1,159 @@
+package vc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// CI enables masking of secret values in CI job logs even if no CI system is
+// detected; the GitHub Actions format is used in that case
+var CI bool
+
+// ciMasker registers values with the masking mechanism of the CI system, so
+// they are redacted in job logs
+type ciMasker struct {
+	provider string
+	out      io.Writer
+	mutex    sync.Mutex
+	masked   map[string]bool
+	warned   bool
+}
+
+var (
+	masker     *ciMasker
+	maskerOnce sync.Once
+)
+
+// ciProvider detects the CI system we're running in
+func ciProvider() string {
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		return "github"
+	case os.Getenv("GITLAB_CI") != "":
+		return "gitlab"
+	case os.Getenv("TF_BUILD") != "":
+		return "azure"
+	case os.Getenv("BUILDKITE") != "":
+		return "buildkite"
+	case CI:
+		return "github"
+	}
+	return ""
+}
+
+// ciMask registers the values in secret with the CI masking mechanism, if
+// running in CI. Only values are masked, keys and KV v2 metadata are not.
+func ciMask(path string, secret *api.Secret) {
+	maskerOnce.Do(func() {
+		if provider := ciProvider(); provider != "" {
+			Debugf("ci: masking values for %s", provider)
+			masker = &ciMasker{
+				provider: provider,
+				out:      os.Stderr,
+				masked:   make(map[string]bool),
+			}
+		}
+	})
+	if masker != nil {
+		masker.maskSecret(path, secret)
+	}
+}
+
+// maskSecret masks the values and tokens in secret
+func (m *ciMasker) maskSecret(path string, secret *api.Secret) {
+	eachSecretValue(path, secret, m.mask)
+}
+
+// eachSecretValue calls fn with the values and tokens in the response secret
+// for path; keys and KV v2 metadata are skipped
+func eachSecretValue(path string, secret *api.Secret, fn func(string)) {
+	if secret == nil {
+		return
+	}
+
+	if secret.Auth != nil {
+		fn(secret.Auth.ClientToken)
+		fn(secret.Auth.Accessor)
+	}
+	if secret.WrapInfo != nil {
+		fn(secret.WrapInfo.Token)
+	}
+	if strings.Contains(path, "/metadata/") {
+		return
+	}
+	data := secret.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok = data["metadata"]; ok {
+			data = inner
+		}
+	}
+	if _, ok := data["created_time"]; ok {
+		// KV v2 write response, only has metadata
+		return
+	}
+	for key, value := range data {
+		if key != CodecTypeKey {
+			eachValue(value, fn)
+		}
+	}
+}
+
+// eachValue calls fn with the strings in value
+func eachValue(value interface{}, fn func(string)) {
+	switch v := value.(type) {
+	case string:
+		fn(v)
+	case map[string]interface{}:
+		for _, item := range v {
+			eachValue(item, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			eachValue(item, fn)
+		}
+	case fmt.Stringer:
+		fn(v.String())
+	}
+}
+
+// mask registers value, multi-line values are masked line by line
+func (m *ciMasker) mask(value string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line == "" || m.masked[line] {
+			continue
+		}
+		m.masked[line] = true
+
+		switch m.provider {
+		case "github":
+			fmt.Fprintf(m.out, "::add-mask::%s\n", line)
+		case "azure":
+			fmt.Fprintf(m.out, "##vso[task.setsecret]%s\n", line)
+		case "buildkite":
+			c := exec.Command("buildkite-agent", "redactor", "add")
+			c.Stdin = strings.NewReader(line)
+			if err := c.Run(); err != nil {
+				m.warn(fmt.Sprintf("ci: buildkite-agent redactor: %v", err))
+			}
+		default:
+			m.warn("ci: " + m.provider + " has no runtime masking, values are not masked")
+		}
+	}
+}
+
+// warn writes message once
+func (m *ciMasker) warn(message string) {
+	if !m.warned {
+		m.warned = true
+		fmt.Fprintln(m.out, "warning: "+message)
+	}
+}
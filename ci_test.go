@@ -0,0 +1,63 @@
+package vc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestCIMask(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		m   = &ciMasker{provider: "github", out: &buf, masked: make(map[string]bool)}
+	)
+
+	m.maskSecret("secret/data/test", &api.Secret{
+		Data: map[string]interface{}{
+			"data": map[string]interface{}{
+				"password": "hunter2",
+				"key":      "line1\nline2\n",
+			},
+			"metadata": map[string]interface{}{
+				"created_time": "2018-03-22T02:24:06.945319214Z",
+			},
+		},
+	})
+	m.maskSecret("auth/token/create", &api.Secret{
+		Auth: &api.SecretAuth{ClientToken: "s.token"},
+		Data: map[string]interface{}{
+			"again": "hunter2",
+		},
+	})
+	m.maskSecret("secret/data/test", &api.Secret{
+		Data: map[string]interface{}{
+			"created_time": "2018-03-22T02:24:06.945319214Z",
+			"version":      1,
+		},
+	})
+
+	out := buf.String()
+	for _, want := range []string{"::add-mask::hunter2\n", "::add-mask::line1\n", "::add-mask::line2\n", "::add-mask::s.token\n"} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Fatalf("expected %q in %q", want, out)
+		}
+	}
+	if bytes.Count(buf.Bytes(), []byte("hunter2")) != 1 {
+		t.Fatalf("expected hunter2 to be masked once, got %q", out)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("2018")) {
+		t.Fatalf("expected metadata not to be masked, got %q", out)
+	}
+}
+
+func TestCIMaskAzure(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		m   = &ciMasker{provider: "azure", out: &buf, masked: make(map[string]bool)}
+	)
+	m.mask("hunter2")
+	if want := "##vso[task.setsecret]hunter2\n"; buf.String() != want {
+		t.Fatalf("expected %q, got %q", want, buf.String())
+	}
+}
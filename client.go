@@ -1,25 +1,26 @@
 package vc
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chzyer/readline"
 	"github.com/hashicorp/vault/api"
-)
 
-const (
-	genericType  = "generic"
-	mountRefresh = time.Minute
+	"github.com/tehmaze/vc/client"
 )
 
+// genericType is the type of the KV v1 secrets engine in older Vault versions
+const genericType = "generic"
+
 func isPermissionDenied(err error) bool {
-	return strings.Contains(err.Error(), "* permission denied")
+	return ErrorKind(classifyError(err)) == ErrPermissionDenied
 }
 
 type completionFilter func(os.FileInfo) bool
@@ -32,6 +33,10 @@ func isDir(i os.FileInfo) bool {
 	return i.IsDir()
 }
 
+func isSecret(i os.FileInfo) bool {
+	return !i.IsDir()
+}
+
 func matchesFilters(i os.FileInfo, filters ...completionFilter) bool {
 	for _, filter := range filters {
 		if !filter(i) {
@@ -41,49 +46,64 @@ func matchesFilters(i os.FileInfo, filters ...completionFilter) bool {
 	return true
 }
 
-// Client for the Vault API
+// Client for the Vault API, with the helpers for paths, globs and completion
+// used by the commands
 type Client struct {
-	*api.Client
-
-	// Path we are operating on, defaults to the root
-	Path string
-
-	// cachedMounts is a cached mounts lookup
-	cachedMounts     map[string]*api.MountOutput
-	cachedMountsTime time.Time
+	client.Client
 }
 
 // NewClient builds a new Client
 func NewClient(config *api.Config) (*Client, error) {
-	var (
-		c   = &Client{Path: "/"}
-		err error
-	)
-
-	c.Client, err = api.NewClient(config)
-	return c, err
+	c, err := client.New(config)
+	if err != nil {
+		return nil, err
+	}
+	c.Observer = requestObserver{}
+	c.WarningFunc = vaultWarning
+	return &Client{Client: *c}, nil
 }
 
-// abspath resolves the absolute path
-func (c *Client) abspath(path string) string {
-	if filepath.IsAbs(path) {
-		return filepath.Clean(path)
+// vaultWarnings are the warnings of Vault that were shown
+var vaultWarnings = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: make(map[string]bool)}
+
+// vaultWarning shows the warnings Vault returned for path; each warning is
+// shown once, as deprecation notices are often repeated for every request
+func vaultWarning(path string, warnings []string) {
+	vaultWarnings.Lock()
+	defer vaultWarnings.Unlock()
+	for _, warning := range warnings {
+		if vaultWarnings.seen[warning] {
+			Debugf("vault: %s: warning: %s", path, warning)
+			continue
+		}
+		vaultWarnings.seen[warning] = true
+		fmt.Fprintf(os.Stderr, "warning: vault: %s: %s\n", path, warning)
 	}
-	return filepath.Clean(filepath.Join(c.Path, path))
 }
 
-// mounts updates Client.cachedMounts if applicable
-func (c *Client) mounts() (mounts map[string]*api.MountOutput, err error) {
-	if time.Now().Add(-mountRefresh).After(c.cachedMountsTime) {
-		mounts, err = c.Sys().ListMounts()
-		if err == nil {
-			c.cachedMounts = mounts
-			c.cachedMountsTime = time.Now()
+// requestObserver records metrics and tracing spans for Vault requests, masks
+// the values in CI job logs (see CI), redacts them (see Redaction), and
+// explains permission errors (see Explain)
+type requestObserver struct{}
+
+func (requestObserver) Begin(c *client.Client, operation, path string) func(*api.Secret, error) {
+	span := startSpan("vault."+operation, spanClient, "vault.path", path)
+	span.inject(c.Client)
+	start := time.Now()
+	return func(secret *api.Secret, err error) {
+		observeRequest(operation, start, err)
+		span.finish(err)
+		if operation == "read" || operation == "write" {
+			ciMask(path, secret)
+			redactor.addSecret(path, secret)
+		}
+		if Explain && err != nil && ErrorKind(classifyError(err)) == ErrPermissionDenied {
+			explainDenied(c, operation, path)
 		}
-	} else {
-		mounts = c.cachedMounts
 	}
-	return
 }
 
 // Complete returns completer suggestions
@@ -97,7 +117,7 @@ func (c *Client) Complete(filters ...completionFilter) readline.DynamicCompleteF
 		}
 
 		// Make absolute
-		full := c.abspath(path)
+		full := c.Abs(path)
 		if strings.HasSuffix(path, "/") {
 			full += "/*"
 		} else {
@@ -150,7 +170,7 @@ func (c *Client) Complete(filters ...completionFilter) readline.DynamicCompleteF
 // Stat mimicks an os.Stat call on Vault
 func (c *Client) Stat(path string) (os.FileInfo, error) {
 	// Make absolute
-	path = c.abspath(path)
+	path = c.Abs(path)
 	Debugf("stat: %q", path)
 
 	// Fast path for root
@@ -159,7 +179,7 @@ func (c *Client) Stat(path string) (os.FileInfo, error) {
 	}
 
 	// Check if the path is a file
-	secret, err := c.Logical().Read(strings.TrimLeft(path, "/"))
+	secret, err := c.Read(path)
 	// Directories would get a permission denied error on Read(). So ignore it.
 	if err != nil && !isPermissionDenied(err) {
 		return nil, err
@@ -177,7 +197,7 @@ func (c *Client) Stat(path string) (os.FileInfo, error) {
 	if dir != "/" {
 		// All folders in / are mounts, so skip this unless we're not in the root
 		Debugf("stat: list %q", strings.TrimLeft(path, "/"))
-		secret, err = c.Logical().List(strings.TrimLeft(path, "/"))
+		secret, err = c.List(path)
 		if err != nil {
 			return nil, err
 		}
@@ -191,7 +211,7 @@ func (c *Client) Stat(path string) (os.FileInfo, error) {
 	}
 
 	// Finally check if our path is a mount
-	mounts, err := c.mounts()
+	mounts, err := c.Mounts()
 	if err != nil && !isPermissionDenied(err) {
 		return nil, err
 	}
@@ -220,10 +240,10 @@ func (c *Client) ReadDir(path string) ([]os.FileInfo, error) {
 	var infos []os.FileInfo
 
 	// Resolve path
-	path = c.abspath(path)
+	path = c.Abs(path)
 
 	// Check mounts
-	mounts, err := c.mounts()
+	mounts, err := c.Mounts()
 	if err != nil && !isPermissionDenied(err) {
 		return nil, err
 	}
@@ -253,7 +273,7 @@ func (c *Client) ReadDir(path string) ([]os.FileInfo, error) {
 	}
 
 	// Check secrets
-	secret, err := c.Logical().List(strings.TrimLeft(path, "/"))
+	secret, err := c.List(path)
 	if err != nil {
 		return nil, err
 	}
@@ -270,17 +290,89 @@ func (c *Client) ReadDir(path string) ([]os.FileInfo, error) {
 	return infos, nil
 }
 
+// globExpression converts a glob pattern for a single path element to a
+// regular expression
 func globExpression(pattern string) string {
-	return strings.Replace(strings.Replace(pattern, "?", ".", -1), "*", ".*", -1)
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, `\?`, "[^/]", -1)
+	expr = strings.Replace(expr, `\*`, "[^/]*", -1)
+	return "^" + expr + "$"
+}
+
+// matchPathPrefix checks if path, or one of its parent directories, matches
+// one of the glob patterns
+func matchPathPrefix(patterns []string, path string) bool {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := len(parts); i > 0; i-- {
+		prefix := strings.Join(parts[:i], "/")
+		for _, pattern := range patterns {
+			if ok, _ := regexp.MatchString(globExpression(strings.Trim(pattern, "/")), prefix); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandBraces expands brace expressions, such as secret/{stage,prod}/db
+func expandBraces(pattern string) []string {
+	// Find the first top level brace expression
+	start, depth := -1, 0
+	for i, c := range pattern {
+		switch c {
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			if depth--; depth == 0 {
+				var (
+					prefix, suffix = pattern[:start], pattern[i+1:]
+					alternatives   []string
+					level, last    = 0, start + 1
+				)
+				for j := start + 1; j < i; j++ {
+					switch pattern[j] {
+					case '{':
+						level++
+					case '}':
+						level--
+					case ',':
+						if level == 0 {
+							alternatives = append(alternatives, pattern[last:j])
+							last = j + 1
+						}
+					}
+				}
+				alternatives = append(alternatives, pattern[last:i])
+				if len(alternatives) == 1 {
+					// Not an expression, such as {foo}
+					break
+				}
+
+				var expanded []string
+				for _, alternative := range alternatives {
+					expanded = append(expanded, expandBraces(prefix+alternative+suffix)...)
+				}
+				return expanded
+			}
+		}
+	}
+	return []string{pattern}
 }
 
 func (c *Client) isGlob(pattern string) bool {
-	return strings.ContainsAny(pattern, "*?")
+	return strings.ContainsAny(pattern, "*?") || len(expandBraces(pattern)) > 1
 }
 
 // Glob is a shortcut to list generic secrets and mounts by glob pattern. The
-// wildcards "*" and "?" are supported. Currently only globbing the base of the
-// path is supported, globbing on directory names is not.
+// wildcards "*" and "?" are supported in any element of the path, as well as
+// brace expressions, such as secret/{stage,prod}/*/db. Expansions that don't
+// match any secret are skipped.
 func (c *Client) Glob(pattern string) ([]os.FileInfo, error) {
 	Debugf("glob: %q", pattern)
 
@@ -290,49 +382,248 @@ func (c *Client) Glob(pattern string) ([]os.FileInfo, error) {
 		return []os.FileInfo{info}, err
 	}
 
-	Debugf("glob abs: %q", c.abspath(pattern))
-	dir, base := filepath.Split(c.abspath(pattern))
-	if strings.ContainsAny(dir, "*?") {
-		return nil, errors.New("directory globbing not supported")
-	}
-	if dir != "/" {
-		dir = strings.TrimRight(dir, "/")
+	var (
+		infos []os.FileInfo
+		seen  = make(map[string]bool)
+	)
+	for _, expanded := range expandBraces(pattern) {
+		items, err := c.glob(c.Abs(expanded))
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if !seen[item.Name()] {
+				seen[item.Name()] = true
+				infos = append(infos, item)
+			}
+		}
 	}
 
+	return infos, nil
+}
+
+// glob expands the wildcards in an absolute path, element by element
+func (c *Client) glob(path string) ([]os.FileInfo, error) {
+	Debugf("glob abs: %q", path)
+
 	var (
-		filter *regexp.Regexp
-		err    error
+		elements = strings.Split(strings.Trim(path, "/"), "/")
+		dirs     = []string{"/"}
+		infos    []os.FileInfo
 	)
-	if dir == "/" {
-		filter, err = regexp.Compile(`^/` + globExpression(base))
-	} else {
-		filter, err = regexp.Compile(fmt.Sprintf("^%s/%s$", regexp.QuoteMeta(dir), globExpression(base)))
+	for i, element := range elements {
+		last := i == len(elements)-1
+		if !strings.ContainsAny(element, "*?") {
+			for j, dir := range dirs {
+				dirs[j] = filepath.Join(dir, element)
+			}
+			if last {
+				for _, dir := range dirs {
+					if info, err := c.Stat(dir); err == nil {
+						infos = append(infos, info)
+					} else if err != os.ErrNotExist {
+						return nil, err
+					}
+				}
+			}
+			continue
+		}
+
+		filter, err := regexp.Compile(globExpression(element))
+		if err != nil {
+			return nil, err
+		}
+
+		var next []string
+		for _, dir := range dirs {
+			items, err := c.ReadDir(dir)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				name := filepath.Clean(item.Name())
+				Debugf("filter: %q =~ %s", name, filter)
+				if !filter.MatchString(filepath.Base(name)) {
+					continue
+				}
+				if last {
+					infos = append(infos, item)
+				} else if item.IsDir() {
+					next = append(next, name)
+				}
+			}
+		}
+		dirs = next
 	}
-	if err != nil {
-		return nil, err
+
+	return infos, nil
+}
+
+// expand expands globs in patterns, returning the matching paths that pass all
+// filters; patterns without globs are returned as-is
+func (c *Client) expand(patterns []string, filters ...completionFilter) (expanded []string, err error) {
+	for _, pattern := range patterns {
+		if _, _, ok := splitScheme(pattern); ok || !c.isGlob(pattern) {
+			expanded = append(expanded, pattern)
+			continue
+		}
+
+		var infos []os.FileInfo
+		if infos, err = c.Glob(pattern); err != nil {
+			return
+		}
+		for _, info := range infos {
+			if matchesFilters(info, filters...) {
+				expanded = append(expanded, info.Name())
+			}
+		}
 	}
+	return
+}
 
-	var infos []os.FileInfo
-	items, err := c.ReadDir(dir)
+// ListIter iterates over the entries below a directory, listing one directory
+// at a time, see Client.ListIter
+type ListIter struct {
+	c       *Client
+	recurse bool
+	stack   [][]os.FileInfo
+	info    os.FileInfo
+	err     error
+}
+
+// ListIter returns an iterator over the entries of the directory at path, in
+// order, and over the entries of its subdirectories if recurse is set. Entries
+// are returned as their directory is listed, and subdirectories are listed
+// after they are returned; memory use depends on the depth of the tree, not on
+// the number of entries.
+func (c *Client) ListIter(path string, recurse bool) *ListIter {
+	it := &ListIter{c: c, recurse: recurse}
+	it.push(path)
+	return it
+}
+
+func (it *ListIter) push(path string) {
+	infos, err := it.c.ReadDir(path)
 	if err != nil {
-		return nil, err
+		it.err = err
+		return
 	}
-	for _, item := range items {
-		Debugf("filter: %q =~ %s", item.Name(), filter)
-		if filter.MatchString(item.Name()) {
-			infos = append(infos, item)
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	it.stack = append(it.stack, infos)
+}
+
+// Next advances to the next entry; it returns false when there are no more
+// entries, or when listing a directory failed, see Err
+func (it *ListIter) Next() bool {
+	if it.info != nil && it.recurse && it.info.IsDir() {
+		it.push(it.info.Name())
+	}
+	it.info = nil
+	for it.err == nil && len(it.stack) > 0 {
+		top := len(it.stack) - 1
+		if len(it.stack[top]) == 0 {
+			it.stack[top] = nil
+			it.stack = it.stack[:top]
+			continue
 		}
+		it.info, it.stack[top] = it.stack[top][0], it.stack[top][1:]
+		return true
 	}
+	return false
+}
 
-	return infos, nil
+// Info returns the current entry
+func (it *ListIter) Info() os.FileInfo {
+	return it.info
 }
 
-// SetPath updates our working path
-func (c *Client) SetPath(path string) {
-	if !strings.HasPrefix(path, "/") {
-		path = "/" + path
+// Err returns the error that stopped the iteration, if any
+func (it *ListIter) Err() error {
+	return it.err
+}
+
+// walk returns the paths of all secrets below the directory at path
+func (c *Client) walk(path string) ([]string, error) {
+	var (
+		paths []string
+		it    = c.ListIter(path, true)
+	)
+	for it.Next() {
+		if !it.Info().IsDir() {
+			paths = append(paths, it.Info().Name())
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// secretsAt returns the paths of the secrets at paths, and of all secrets
+// below the paths that are directories, sorted
+func (c *Client) secretsAt(paths []string) ([]string, error) {
+	var secrets []string
+	for _, path := range paths {
+		info, err := c.Stat(path)
+		if os.IsNotExist(err) {
+			return nil, notFound(path + ": not found")
+		} else if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			secrets = append(secrets, info.Name())
+			continue
+		}
+		below, err := c.walk(info.Name())
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, below...)
+	}
+	sort.Strings(secrets)
+	return secrets, nil
+}
+
+// secretsBelow returns the paths of the secret at root, or of the secrets
+// below it if it is a directory, sorted; unlike secretsAt, KV v2 directories
+// are listed with their metadata
+func (c *Client) secretsBelow(root string) ([]string, error) {
+	if !c.IsKV2(root) {
+		return c.secretsAt([]string{root})
+	}
+	var (
+		paths []string
+		dirs  = []string{strings.Trim(c.Abs(root), "/")}
+	)
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+		metadataPath, err := c.KV2Path(dir, "metadata")
+		if err != nil {
+			return nil, err
+		}
+		secret, err := c.List(metadataPath)
+		if err != nil {
+			return nil, err
+		} else if secret == nil {
+			// Not a directory
+			paths = append(paths, dir)
+			continue
+		}
+		keys, _ := secret.Data["keys"].([]interface{})
+		for _, key := range keys {
+			name, _ := key.(string)
+			if strings.HasSuffix(name, "/") {
+				dirs = append(dirs, dir+"/"+strings.TrimSuffix(name, "/"))
+			} else {
+				paths = append(paths, dir+"/"+name)
+			}
+		}
 	}
-	c.Path = filepath.Clean(path)
+	sort.Strings(paths)
+	return paths, nil
 }
 
 // rootInfo mimick the root folder
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// AgentCache controls the freshness of reads through the cache of a Vault
+// Agent, see SetAgentCache. Vault Agent marks the responses it serves from its
+// cache with "X-Cache: HIT" and their Age, and evicts cached responses on
+// request (POST /agent/v1/cache-clear); there is no way to bypass the cache
+// for a single request.
+type AgentCache struct {
+	// MaxAge is the maximum age of cached responses; older responses are
+	// evicted from the cache and read again. Zero accepts any age.
+	MaxAge time.Duration
+
+	// Refresh evicts the response from the cache before each read, so reads
+	// always reach Vault
+	Refresh bool
+}
+
+// agentCacheTransport makes the reads of a Client through a Vault Agent cache
+// as fresh as the AgentCache requires
+type agentCacheTransport struct {
+	cache AgentCache
+	next  http.RoundTripper
+
+	// notAgent is set when Vault isn't a Vault Agent with a cache, so reads
+	// aren't evicted again
+	notAgent int32
+}
+
+func (t *agentCacheTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, "/v1/") {
+		return t.next.RoundTrip(r)
+	}
+	if t.cache.Refresh {
+		t.evict(r)
+		return t.next.RoundTrip(r)
+	}
+
+	res, err := t.next.RoundTrip(r)
+	if err != nil || res.Header.Get("X-Cache") != "HIT" {
+		return res, err
+	}
+	age, _ := strconv.Atoi(res.Header.Get("Age"))
+	if t.cache.MaxAge <= 0 || time.Duration(age)*time.Second <= t.cache.MaxAge {
+		debugf("client: %s from the Vault Agent cache, %ds old", r.URL.Path, age)
+		return res, nil
+	}
+	res.Body.Close()
+	debugf("client: %s from the Vault Agent cache is %ds old, reading it again", r.URL.Path, age)
+	t.evict(r)
+	return t.next.RoundTrip(r)
+}
+
+// evict asks Vault Agent to evict the cached responses for the path of r;
+// failures are logged, the read then may be served from the cache
+func (t *agentCacheTransport) evict(r *http.Request) {
+	if atomic.LoadInt32(&t.notAgent) != 0 {
+		return
+	}
+	body, _ := json.Marshal(map[string]string{
+		"type":      "request_path",
+		"value":     r.URL.Path,
+		"namespace": r.Header.Get(api.NamespaceHeaderName),
+	})
+	u := *r.URL
+	u.Path, u.RawPath, u.RawQuery = "/agent/v1/cache-clear", "", ""
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		debugf("client: evict %s from the Vault Agent cache: %v", r.URL.Path, err)
+		return
+	}
+	req = req.WithContext(r.Context())
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		debugf("client: evict %s from the Vault Agent cache: %v", r.URL.Path, err)
+		return
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusMethodNotAllowed:
+		// Vault, or an agent without a cache
+		debugf("client: no Vault Agent cache at %s: %s", u.Host, res.Status)
+		atomic.StoreInt32(&t.notAgent, 1)
+	case res.StatusCode >= 300:
+		debugf("client: evict %s from the Vault Agent cache: %s", r.URL.Path, res.Status)
+	default:
+		debugf("client: evicted %s from the Vault Agent cache", r.URL.Path)
+	}
+}
+
+// SetAgentCache makes the reads of the client through a Vault Agent cache as
+// fresh as cache requires, including the reads made with the API client
+// directly; against Vault itself, the client works as before
+func (c *Client) SetAgentCache(cache AgentCache) error {
+	config := c.CloneConfig()
+	next := config.HttpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	config.HttpClient.Transport = &agentCacheTransport{cache: cache, next: next}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return err
+	}
+	client.SetToken(c.Token())
+	client.SetHeaders(c.Headers())
+	c.Client = client
+	return nil
+}
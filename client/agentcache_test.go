@@ -0,0 +1,76 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAgentCache(t *testing.T) {
+	var (
+		cached  bool
+		reads   int
+		evicted []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /agent/v1/cache-clear":
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			evicted = append(evicted, req["type"]+" "+req["value"])
+			cached = false
+		case "GET /v1/secret/db":
+			// Served from the cache of the agent, 2 minutes old
+			if cached {
+				w.Header().Set("X-Cache", "HIT")
+				w.Header().Set("Age", "120")
+			} else {
+				w.Header().Set("X-Cache", "MISS")
+				reads++
+				cached = true
+			}
+			w.Write([]byte(`{"data": {"password": "secret"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		cache AgentCache
+		reads int
+	}{
+		{AgentCache{}, 0},
+		{AgentCache{MaxAge: 5 * time.Minute}, 0},
+		{AgentCache{MaxAge: time.Minute}, 2},
+		{AgentCache{Refresh: true}, 2},
+	} {
+		c := testClient(t, server.URL)
+		if err := c.SetAgentCache(test.cache); err != nil {
+			t.Fatal(err)
+		}
+		if c.Token() != "s.test" {
+			t.Fatal("expected token to be kept")
+		}
+
+		cached, reads, evicted = true, 0, nil
+		for i := 0; i < 2; i++ {
+			if _, err := c.Read("secret/db"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if reads != test.reads {
+			t.Fatalf("%+v: expected %d reads from Vault, got %d", test.cache, test.reads, reads)
+		}
+		if len(evicted) != test.reads {
+			t.Fatalf("%+v: expected %d evictions, got %v", test.cache, test.reads, evicted)
+		}
+		for _, e := range evicted {
+			if e != "request_path /v1/secret/db" {
+				t.Fatalf("%+v: unexpected eviction %q", test.cache, e)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Auth is an authentication method
+type Auth interface {
+	// Login authenticates to Vault, and returns the secret with the token
+	Login(c *Client) (*Secret, error)
+}
+
+// Login authenticates with auth, and uses the resulting token for subsequent
+// requests
+func (c *Client) Login(auth Auth) error {
+	secret, err := auth.Login(c)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return errors.New("login: no token returned")
+	}
+	token, err := secret.TokenID()
+	if err != nil {
+		return err
+	} else if token == "" {
+		return errors.New("login: no token returned")
+	}
+	c.SetToken(token)
+	return nil
+}
+
+// mountPath returns the auth mount, defaulting to method
+func mountPath(mount, method string) string {
+	if mount = strings.Trim(mount, "/"); mount == "" {
+		return method
+	}
+	return mount
+}
+
+// Token authenticates with a token, it's looked up to verify it's valid
+type Token struct {
+	Token string
+}
+
+// Login implements Auth
+func (auth *Token) Login(c *Client) (*Secret, error) {
+	c.SetToken(auth.Token)
+	return c.Auth().Token().LookupSelf()
+}
+
+// AppRole authenticates with the approle auth method
+type AppRole struct {
+	// Mount is the path of the auth method, defaults to approle
+	Mount    string
+	RoleID   string
+	SecretID string
+}
+
+// Login implements Auth
+func (auth *AppRole) Login(c *Client) (*Secret, error) {
+	if auth.RoleID == "" {
+		return nil, errors.New("approle: role ID is required")
+	}
+	data := map[string]interface{}{"role_id": auth.RoleID}
+	if auth.SecretID != "" {
+		data["secret_id"] = auth.SecretID
+	}
+	return c.Write("auth/"+mountPath(auth.Mount, "approle")+"/login", data)
+}
+
+// Kubernetes authenticates with the kubernetes auth method, using a service
+// account token
+type Kubernetes struct {
+	// Mount is the path of the auth method, defaults to kubernetes
+	Mount string
+	Role  string
+
+	// JWTFile is the file with the service account token
+	JWTFile string
+}
+
+// Login implements Auth
+func (auth *Kubernetes) Login(c *Client) (*Secret, error) {
+	if auth.Role == "" {
+		return nil, errors.New("kubernetes: role is required")
+	}
+	jwt, err := ioutil.ReadFile(auth.JWTFile)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: %v", err)
+	}
+	return c.Write("auth/"+mountPath(auth.Mount, "kubernetes")+"/login", map[string]interface{}{
+		"role": auth.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// ErrUnavailable is returned while a Breaker is open
+var ErrUnavailable = errors.New("vault is unavailable")
+
+// Defaults for NewBreaker
+const (
+	DefaultBreakerThreshold  = 3
+	DefaultBreakerBackoff    = time.Second
+	DefaultBreakerMaxBackoff = 5 * time.Minute
+)
+
+// Breaker is a circuit breaker for the requests of a Client, see SetBreaker.
+// After Threshold consecutive failures to reach Vault (connection errors, or
+// 502, 503 and 504 responses from a proxy or load balancer) the breaker opens,
+// and requests fail with ErrUnavailable without reaching Vault. After the
+// backoff a single request probes Vault; the breaker closes if it succeeds,
+// otherwise the backoff doubles, up to MaxBackoff.
+type Breaker struct {
+	Threshold  int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// OnChange is called when the breaker opens, with the error, or closes,
+	// if set
+	OnChange func(open bool, err error)
+
+	mutex    sync.Mutex
+	failures int
+	open     bool
+	probing  bool
+	backoff  time.Duration
+	retry    time.Time
+}
+
+// NewBreaker returns a Breaker with the default settings
+func NewBreaker() *Breaker {
+	return &Breaker{
+		Threshold:  DefaultBreakerThreshold,
+		Backoff:    DefaultBreakerBackoff,
+		MaxBackoff: DefaultBreakerMaxBackoff,
+	}
+}
+
+// Open reports if the breaker is open, and when Vault is probed next
+func (b *Breaker) Open() (bool, time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.open, b.retry
+}
+
+// allow checks if a request may be made
+func (b *Breaker) allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.open {
+		return nil
+	}
+	if b.probing || time.Now().Before(b.retry) {
+		return &Error{Kind: ErrUnavailable, Err: fmt.Errorf("%v, retrying in %s", ErrUnavailable, time.Until(b.retry).Round(time.Second))}
+	}
+	debugf("breaker: probing Vault")
+	b.probing = true
+	return nil
+}
+
+// record records the outcome of a request
+func (b *Breaker) record(err error) {
+	b.mutex.Lock()
+	var changed bool
+	if err == nil {
+		changed = b.open
+		b.failures, b.open, b.probing = 0, false, false
+	} else {
+		b.failures++
+		if b.open {
+			// The probe failed
+			b.probing = false
+			if b.backoff *= 2; b.MaxBackoff > 0 && b.backoff > b.MaxBackoff {
+				b.backoff = b.MaxBackoff
+			}
+			b.retry = time.Now().Add(b.backoff)
+			debugf("breaker: probe failed, retrying in %s: %v", b.backoff, err)
+		} else if b.failures >= b.Threshold {
+			changed = true
+			b.open = true
+			b.backoff = b.Backoff
+			b.retry = time.Now().Add(b.backoff)
+		}
+	}
+	open, onChange := b.open, b.OnChange
+	b.mutex.Unlock()
+
+	if changed && onChange != nil {
+		onChange(open, err)
+	}
+}
+
+// breakerTransport makes the requests of a Client behind a Breaker
+type breakerTransport struct {
+	breaker *Breaker
+	next    http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := t.breaker.allow(); err != nil {
+		return nil, err
+	}
+	res, err := t.next.RoundTrip(r)
+	if err != nil && ErrorKind(err) == ErrReadOnly {
+		// Refused without reaching Vault
+		return nil, err
+	} else if err != nil {
+		t.breaker.record(err)
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		t.breaker.record(errors.New(res.Status))
+	default:
+		t.breaker.record(nil)
+	}
+	return res, nil
+}
+
+// SetBreaker makes the requests of the client behind the circuit breaker b,
+// including the requests made with the API client directly
+func (c *Client) SetBreaker(b *Breaker) error {
+	config := c.CloneConfig()
+	next := config.HttpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	config.HttpClient.Transport = &breakerTransport{breaker: b, next: next}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return err
+	}
+	client.SetToken(c.Token())
+	client.SetHeaders(c.Headers())
+	c.Client = client
+	c.Breaker = b
+	return nil
+}
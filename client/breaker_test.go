@@ -0,0 +1,77 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	var (
+		requests int
+		down     = true
+		err      error
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"data": {"password": "secret"}}`))
+	}))
+	defer server.Close()
+
+	c := testClient(t, server.URL)
+
+	var changes []bool
+	b := NewBreaker()
+	b.Backoff = 50 * time.Millisecond
+	b.OnChange = func(open bool, err error) {
+		changes = append(changes, open)
+	}
+	if err = c.SetBreaker(b); err != nil {
+		t.Fatal(err)
+	}
+	if c.Token() != "s.test" {
+		t.Fatal("expected token to be kept")
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err = c.Read("secret/db"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if requests != DefaultBreakerThreshold {
+		t.Fatalf("expected %d requests, got %d", DefaultBreakerThreshold, requests)
+	}
+	if ErrorKind(err) != ErrUnavailable {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if open, _ := b.Open(); !open {
+		t.Fatal("expected breaker to be open")
+	}
+
+	// A failed probe doubles the backoff
+	time.Sleep(60 * time.Millisecond)
+	c.Read("secret/db")
+	if requests != DefaultBreakerThreshold+1 {
+		t.Fatalf("expected a probe, got %d requests", requests)
+	}
+	if _, retry := b.Open(); time.Until(retry) < 60*time.Millisecond {
+		t.Fatalf("expected backoff to double, retry in %s", time.Until(retry))
+	}
+
+	down = false
+	time.Sleep(110 * time.Millisecond)
+	if _, err = c.Read("secret/db"); err != nil {
+		t.Fatal(err)
+	}
+	if open, _ := b.Open(); open {
+		t.Fatal("expected breaker to be closed")
+	}
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Fatalf("expected open and close, got %v", changes)
+	}
+}
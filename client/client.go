@@ -0,0 +1,283 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// mountRefresh is how long the mounts lookup is cached
+const mountRefresh = time.Minute
+
+// DebugLogFunc is the debug log function, defaults to nil (no debug logging)
+var DebugLogFunc func(string)
+
+func debugf(format string, v ...interface{}) {
+	if DebugLogFunc != nil {
+		DebugLogFunc(fmt.Sprintf(format, v...))
+	}
+}
+
+// Secret is a response from Vault
+type Secret = api.Secret
+
+// Observer is notified of the requests made by a Client, for example to record
+// metrics or tracing spans. Begin is called before each request, the function
+// it returns when the request is done.
+type Observer interface {
+	Begin(c *Client, operation, path string) func(*Secret, error)
+}
+
+// Cache keeps the responses of reads, to serve them when Vault can't be
+// reached (see Client.Offline)
+type Cache interface {
+	// Get returns the cached response for path, or nil
+	Get(path string) *Secret
+
+	// Put stores the response for path, or removes it if secret is nil
+	Put(path string, secret *Secret)
+}
+
+// Client for the Vault API
+type Client struct {
+	*api.Client
+
+	// Path we are operating on, relative paths are resolved against it;
+	// defaults to the root
+	Path string
+
+	// Observer is notified of requests, if set
+	Observer Observer
+
+	// WarningFunc is called with the warnings of a response, such as
+	// deprecation notices, or notices that the version that was read is
+	// deleted; if nil, warnings are only logged (see DebugLogFunc)
+	WarningFunc func(path string, warnings []string)
+
+	// Cache keeps the responses of reads and the mounts lookup, if set
+	Cache Cache
+
+	// Offline serves reads from the Cache when Vault can't be reached
+	Offline bool
+
+	// Breaker is the circuit breaker of the requests, see SetBreaker
+	Breaker *Breaker
+
+	// ReadOnly is set if requests that change Vault are refused, see
+	// SetReadOnly
+	ReadOnly bool
+
+	// cachedMounts is the cached mounts lookup, see Mounts
+	cachedMounts *cachedMounts
+
+	// namespaceMounts are the cached mounts lookups of child namespaces, see
+	// Resolve
+	namespaceMounts *namespaceMounts
+}
+
+// New builds a new Client; the token is read from the environment (see
+// api.Config.ReadEnvironment), or can be set with SetToken or Login
+func New(config *api.Config) (*Client, error) {
+	var (
+		c   = &Client{Path: "/", cachedMounts: new(cachedMounts), namespaceMounts: newNamespaceMounts()}
+		err error
+	)
+	c.Client, err = api.NewClient(config)
+	return c, err
+}
+
+// request performs a Vault request for operation on path; errors are
+// classified (see Error)
+func (c *Client) request(operation, path string, fn func(string) (*Secret, error)) (*Secret, error) {
+	var done func(*Secret, error)
+	if c.Observer != nil {
+		done = c.Observer.Begin(c, operation, path)
+	}
+	secret, err := fn(strings.TrimLeft(path, "/"))
+	if done != nil {
+		done(secret, err)
+	}
+	if secret != nil && len(secret.Warnings) > 0 {
+		c.warn(path, secret.Warnings...)
+	}
+	if operation == "read" && c.Offline && c.Cache != nil && unreachable(err) {
+		return nil, &unreachableError{err}
+	}
+	return secret, Classify(err)
+}
+
+// warn passes the warnings for path to the WarningFunc
+func (c *Client) warn(path string, warnings ...string) {
+	path = strings.TrimLeft(path, "/")
+	if c.WarningFunc != nil {
+		c.WarningFunc(path, warnings)
+		return
+	}
+	for _, warning := range warnings {
+		debugf("client: %s: warning: %s", path, warning)
+	}
+}
+
+// unreachable checks if err is a connection error, or a response from a proxy
+// or load balancer that indicates that Vault is down
+func unreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if res, ok := err.(*api.ResponseError); ok {
+		switch res.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// unreachableError is returned by request if Vault can't be reached, and reads
+// can be served from the cache
+type unreachableError struct {
+	error
+}
+
+// cached stores the response of a read in the cache, or returns the cached
+// response if Vault can't be reached
+func (c *Client) cached(path string, secret *Secret, err error) (*Secret, error) {
+	if c.Cache == nil {
+		return secret, err
+	}
+	path = strings.TrimLeft(path, "/")
+	if unreachable, ok := err.(*unreachableError); ok {
+		if secret = c.Cache.Get(path); secret != nil {
+			debugf("client: %s from cache, Vault is unreachable: %v", path, unreachable.error)
+			return secret, nil
+		}
+		return nil, unreachable.error
+	}
+	if err == nil {
+		c.Cache.Put(path, secret)
+	}
+	return secret, err
+}
+
+// Read reads the secret at path, errors are classified (see Error)
+func (c *Client) Read(path string) (*Secret, error) {
+	secret, err := c.request("read", path, c.Logical().Read)
+	return c.cached(path, secret, err)
+}
+
+// ReadWithData reads the secret at path with request parameters, errors are
+// classified (see Error)
+func (c *Client) ReadWithData(path string, data map[string][]string) (*Secret, error) {
+	secret, err := c.request("read", path, func(path string) (*Secret, error) {
+		return c.Logical().ReadWithData(path, data)
+	})
+	return c.cached(path+"?"+url.Values(data).Encode(), secret, err)
+}
+
+// Write writes data to path, errors are classified (see Error)
+func (c *Client) Write(path string, data map[string]interface{}) (*Secret, error) {
+	return c.request("write", path, func(path string) (*Secret, error) {
+		return c.Logical().Write(path, data)
+	})
+}
+
+// Delete removes the secret at path, errors are classified (see Error)
+func (c *Client) Delete(path string) (*Secret, error) {
+	return c.request("delete", path, c.Logical().Delete)
+}
+
+// List lists the secrets at path, errors are classified (see Error)
+func (c *Client) List(path string) (*Secret, error) {
+	return c.request("list", path, c.Logical().List)
+}
+
+// Abs resolves path against the working path
+func (c *Client) Abs(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Clean(filepath.Join(c.Path, path))
+}
+
+// SetPath sets the working path
+func (c *Client) SetPath(path string) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	c.Path = filepath.Clean(path)
+}
+
+// mountsPath is the path of the mounts lookup in the Cache
+const mountsPath = "sys/mounts"
+
+// cachedMountsLookup returns the mounts lookup from the Cache, or nil
+func (c *Client) cachedMountsLookup() map[string]*api.MountOutput {
+	secret := c.Cache.Get(mountsPath)
+	if secret == nil {
+		return nil
+	}
+	// Cached responses may have been decoded from JSON
+	b, err := json.Marshal(secret.Data["mounts"])
+	if err != nil {
+		return nil
+	}
+	var mounts map[string]*api.MountOutput
+	if err = json.Unmarshal(b, &mounts); err != nil {
+		return nil
+	}
+	return mounts
+}
+
+// cachedMounts is a cached mounts lookup, of namespace
+type cachedMounts struct {
+	sync.Mutex
+	mounts    map[string]*api.MountOutput
+	time      time.Time
+	namespace string
+}
+
+// Mounts returns the secrets engines, the lookup is cached for a minute
+func (c *Client) Mounts() (mounts map[string]*api.MountOutput, err error) {
+	if c.cachedMounts == nil {
+		c.cachedMounts = new(cachedMounts)
+	}
+	cache := c.cachedMounts
+	cache.Lock()
+	defer cache.Unlock()
+
+	namespace := c.Namespace()
+	if time.Since(cache.time) < mountRefresh && namespace == cache.namespace {
+		return cache.mounts, nil
+	}
+
+	var done func(*Secret, error)
+	if c.Observer != nil {
+		done = c.Observer.Begin(c, "mounts", mountsPath)
+	}
+	mounts, err = c.Sys().ListMounts()
+	if done != nil {
+		done(nil, err)
+	}
+	if c.Cache != nil && c.Offline && unreachable(err) {
+		if mounts = c.cachedMountsLookup(); mounts != nil {
+			debugf("client: mounts from cache, Vault is unreachable: %v", err)
+			err = nil
+		}
+	} else if err = Classify(err); err == nil && c.Cache != nil {
+		c.Cache.Put(mountsPath, &Secret{Data: map[string]interface{}{"mounts": mounts}})
+	}
+	if err == nil {
+		cache.mounts = mounts
+		cache.time = time.Now()
+		cache.namespace = namespace
+	}
+	return
+}
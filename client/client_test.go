@@ -0,0 +1,433 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// testVault is a fake Vault with a KV v1 mount at old/ and a KV v2 mount at
+// secret/
+func testVault(t *testing.T) (*Client, map[string]interface{}, *httptest.Server) {
+	t.Helper()
+
+	written := make(map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/mounts":
+			response = map[string]interface{}{
+				"old/":    map[string]interface{}{"type": "kv", "options": map[string]string{"version": "1"}},
+				"secret/": map[string]interface{}{"type": "kv", "options": map[string]string{"version": "2"}},
+			}
+		case "GET /v1/old/test":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "v1"}}
+		case "GET /v1/old/deprecated":
+			response = map[string]interface{}{
+				"data":     map[string]interface{}{"password": "v1"},
+				"warnings": []string{"this path is deprecated"},
+			}
+		case "GET /v1/secret/data/deleted":
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"data":     nil,
+				"metadata": map[string]interface{}{"version": 2, "deletion_time": "2018-06-01T12:00:00Z"},
+			}}
+		case "GET /v1/secret/data/test":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"password": "v2@" + r.URL.Query().Get("version")},
+				"metadata": map[string]interface{}{"version": 3},
+			}}
+		case "PUT /v1/secret/data/test", "PUT /v1/auth/approle/login":
+			var data map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				t.Error(err)
+			}
+			written[r.URL.Path] = data
+			response = map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.test"}}
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			response = map[string]interface{}{"errors": []string{"1 error occurred:\n\t* permission denied"}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+
+	return testClient(t, server.URL), written, server
+}
+
+// testClient returns a client with token s.test, without retries, for the
+// fake Vault at address
+func testClient(t *testing.T, address string) *Client {
+	t.Helper()
+	config := api.DefaultConfig()
+	config.Address = address
+	config.MaxRetries = 0
+	c, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetToken("s.test")
+	return c
+}
+
+func TestClientKV(t *testing.T) {
+	c, written, server := testVault(t)
+	defer server.Close()
+
+	secret, err := c.ReadSecret("old/test")
+	if err != nil {
+		t.Fatal(err)
+	} else if secret.Data["password"] != "v1" {
+		t.Fatalf("expected KV v1 data, got %v", secret.Data)
+	}
+
+	c.SetPath("/secret")
+	if secret, err = c.ReadSecret("test"); err != nil {
+		t.Fatal(err)
+	} else if secret.Data["password"] != "v2@0" {
+		t.Fatalf("expected KV v2 data, got %v", secret.Data)
+	}
+	if secret, version, err := c.ReadSecretWithVersion("test"); err != nil {
+		t.Fatal(err)
+	} else if version != 3 || secret.Data["password"] != "v2@" {
+		t.Fatalf("expected version 3, got %d %v", version, secret.Data)
+	}
+	if secret, err = c.ReadVersion("test", 2); err != nil {
+		t.Fatal(err)
+	} else if secret.Data["password"] != "v2@2" {
+		t.Fatalf("expected version 2, got %v", secret.Data)
+	}
+
+	// KV v2 secrets are written with check-and-set, on the version that was
+	// read; secrets that have the data already are not written
+	if err = c.WriteSecret("/secret/test", map[string]interface{}{"password": "new"}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"data": map[string]interface{}{"password": "new"}, "options": map[string]interface{}{"cas": float64(3)}}
+	if got := written["/v1/secret/data/test"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v written, got %v", want, got)
+	}
+	delete(written, "/v1/secret/data/test")
+	if err = c.WriteSecret("/secret/test", map[string]interface{}{"password": "v2@"}); err != nil {
+		t.Fatal(err)
+	} else if got, ok := written["/v1/secret/data/test"]; ok {
+		t.Fatalf("expected no write of the same data, got %v", got)
+	}
+	if err = c.WriteSecretCAS("/secret/test", map[string]interface{}{"password": "new"}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if got := written["/v1/secret/data/test"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v written, got %v", want, got)
+	}
+	if err = c.WriteSecretCAS("/old/test", nil, 0); err == nil {
+		t.Fatal("expected error for check-and-set on KV v1")
+	}
+
+	if _, err = c.ReadSecret("/old/other"); ErrorKind(err) != ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+	if _, err = c.ReadVersion("/old/test", 1); err == nil {
+		t.Fatal("expected error for versions on KV v1")
+	}
+}
+
+func TestClientWriteRetry(t *testing.T) {
+	var (
+		version = 3
+		data    = map[string]interface{}{"password": "old"}
+		writes  int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/mounts":
+			response = map[string]interface{}{
+				"secret/": map[string]interface{}{"type": "kv", "options": map[string]string{"version": "2"}},
+			}
+		case "GET /v1/secret/data/test":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"data":     data,
+				"metadata": map[string]interface{}{"version": version},
+			}}
+		case "PUT /v1/secret/data/test":
+			var request struct {
+				Data    map[string]interface{} `json:"data"`
+				Options struct {
+					CAS int `json:"cas"`
+				} `json:"options"`
+			}
+			json.NewDecoder(r.Body).Decode(&request)
+			if request.Options.CAS != version {
+				w.WriteHeader(http.StatusBadRequest)
+				response = map[string]interface{}{"errors": []string{"check-and-set parameter did not match the current version"}}
+				break
+			}
+			writes++
+			version, data = version+1, request.Data
+
+			// The write is applied, but the connection drops before the
+			// response
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+			}
+			conn.Close()
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	c := testClient(t, server.URL)
+
+	// The lost response is detected, the write isn't retried
+	if err := c.WriteSecret("secret/test", map[string]interface{}{"password": "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 1 || version != 4 {
+		t.Fatalf("expected 1 write, got %d (version %d)", writes, version)
+	}
+
+	// A retry of a write that was applied conflicts, and is detected
+	if err := c.WriteSecretCAS("secret/test", map[string]interface{}{"password": "new"}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteSecretCAS("secret/test", map[string]interface{}{"password": "other"}, 3); ErrorKind(err) != ErrVersionConflict {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+	if writes != 1 {
+		t.Fatalf("expected 1 write, got %d", writes)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	c, _, server := testVault(t)
+	defer server.Close()
+
+	m, err := Merge(c, "old/test", "secret/deleted", "secret/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Data["password"] != "v2@0" || m.Sources["password"] != "secret/test" {
+		t.Fatalf("expected password from secret/test, got %+v", m)
+	}
+	if !reflect.DeepEqual(m.Paths, []string{"old/test", "secret/test"}) {
+		t.Fatalf("expected the deleted secret to be skipped, got %v", m.Paths)
+	}
+
+	if _, err = Merge(c, "secret/deleted"); ErrorKind(err) != ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, err = Merge(c, "old/test", "denied"); ErrorKind(err) != ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
+
+func TestClientWarnings(t *testing.T) {
+	c, _, server := testVault(t)
+	defer server.Close()
+
+	var warnings []string
+	c.WarningFunc = func(path string, w []string) {
+		for _, warning := range w {
+			warnings = append(warnings, path+": "+warning)
+		}
+	}
+	if _, err := c.ReadSecret("old/deprecated"); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := c.ReadSecret("secret/deleted"); err != nil {
+		t.Fatal(err)
+	} else if secret != nil {
+		t.Fatalf("expected no secret for a deleted version, got %v", secret.Data)
+	}
+	want := []string{
+		"old/deprecated: this path is deprecated",
+		"secret/deleted: version 2 was deleted at 2018-06-01T12:00:00Z",
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Fatalf("expected warnings %q, got %q", want, warnings)
+	}
+
+	_, err := c.ReadSecret("old/other")
+	if status, errs := ErrorDetails(err); status != http.StatusForbidden || len(errs) != 1 {
+		t.Fatalf("expected status 403 with an error, got %d %q", status, errs)
+	}
+	if err, ok := err.(*Error); !ok || err.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected an Error with status 403, got %#v", err)
+	}
+}
+
+type testObserver []string
+
+func (o *testObserver) Begin(c *Client, operation, path string) func(*Secret, error) {
+	return func(secret *Secret, err error) {
+		*o = append(*o, operation+" "+path)
+	}
+}
+
+func TestClientObserver(t *testing.T) {
+	c, _, server := testVault(t)
+	defer server.Close()
+	o := new(testObserver)
+	c.Observer = o
+
+	if _, err := c.ReadSecret("/secret/test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReadSecret("/secret/test"); err != nil {
+		t.Fatal(err)
+	}
+	want := testObserver{"mounts sys/mounts", "read secret/data/test", "read secret/data/test"}
+	if !reflect.DeepEqual(*o, want) {
+		t.Fatalf("expected %q, got %q", want, *o)
+	}
+}
+
+// testCache is a Cache in memory, that stores the responses as JSON like a
+// cache on disk would
+type testCache map[string][]byte
+
+func (c testCache) Get(path string) *Secret {
+	var secret *Secret
+	json.Unmarshal(c[path], &secret)
+	return secret
+}
+
+func (c testCache) Put(path string, secret *Secret) {
+	c[path], _ = json.Marshal(secret)
+}
+
+func TestClientCache(t *testing.T) {
+	c, _, server := testVault(t)
+	defer server.Close()
+	cache := make(testCache)
+	c.Cache = cache
+	c.Offline = true
+
+	for _, path := range []string{"old/test", "secret/test"} {
+		if _, err := c.ReadSecret(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := cache["sys/mounts"]; !ok {
+		t.Fatalf("expected mounts to be cached, got %v", cache)
+	}
+
+	// Vault is unreachable, reads are served from the cache
+	server.Close()
+	c.cachedMounts.time = time.Time{}
+	for path, want := range map[string]string{"old/test": "v1", "secret/test": "v2@0"} {
+		secret, err := c.ReadSecret(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := secret.Data["password"]; got != want {
+			t.Fatalf("%s: expected %q, got %q", path, want, got)
+		}
+	}
+	if _, err := c.ReadSecret("old/missing"); err == nil {
+		t.Fatal("expected error for secret that is not cached")
+	}
+	c.Offline = false
+	if _, err := c.ReadSecret("old/test"); err == nil {
+		t.Fatal("expected error if not offline")
+	}
+}
+
+func TestClientLogin(t *testing.T) {
+	c, written, server := testVault(t)
+	defer server.Close()
+
+	if err := c.Login(&AppRole{}); err == nil {
+		t.Fatal("expected error without role ID")
+	}
+	if err := c.Login(&AppRole{RoleID: "role", SecretID: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if c.Token() != "s.test" {
+		t.Fatalf("expected token s.test, got %q", c.Token())
+	}
+	want := map[string]interface{}{"role_id": "role", "secret_id": "secret"}
+	if got := written["/v1/auth/approle/login"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v written, got %v", want, got)
+	}
+}
+
+var _ KV = fakeKV{}
+
+// fakeKV shows KV can be implemented by a fake for tests
+type fakeKV map[string]map[string]interface{}
+
+func (kv fakeKV) ReadSecret(path string) (*Secret, error) {
+	if data, ok := kv[path]; ok {
+		return &Secret{Data: data}, nil
+	}
+	return nil, nil
+}
+func (kv fakeKV) ReadVersion(path string, version int) (*Secret, error) { return kv.ReadSecret(path) }
+func (kv fakeKV) WriteSecret(path string, data map[string]interface{}) error {
+	kv[path] = data
+	return nil
+}
+func (kv fakeKV) DeleteSecret(path string) error {
+	delete(kv, path)
+	return nil
+}
+
+func TestWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test")
+
+	w := NewWriter(name, 0600)
+	if _, err = w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	w.Abort()
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to not exist after abort, got %v", name, err)
+	}
+	if written, err := w.Commit(); err != nil || written {
+		t.Fatalf("expected nothing to be written after abort, got %t, %v", written, err)
+	}
+
+	w = NewWriter(name, 0600)
+	if _, err = w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(name); err != nil || string(b) != "hello" {
+		t.Fatalf("expected hello, got %q, %v", b, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("expected only the target file, got %d files", len(files))
+	}
+
+	w = NewWriter(name, 0600)
+	if _, err = w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if written, err := w.Commit(); err != nil || written {
+		t.Fatalf("expected unchanged file to be left untouched, got %t, %v", written, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("expected the temporary file to be removed, got %d files", len(files))
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Package client is the Vault client library underneath vc, for programs that
+want to read secrets and write them to files the way vc does, without running
+the vc command.
+
+A Client reads and writes secrets, and transparently handles version 1 and 2
+of the KV secrets engine:
+
+	c, err := client.New(api.DefaultConfig())
+	if err != nil {
+		return err
+	}
+	if err = c.Login(&client.AppRole{RoleID: roleID, SecretID: secretID}); err != nil {
+		return err
+	}
+	secret, err := c.ReadSecret("secret/prod/db")
+
+Errors returned by the client are classified, see ErrorKind:
+
+	if client.ErrorKind(err) == client.ErrNotFound {
+		...
+	}
+
+Classified errors carry the HTTP status and the error messages of the Vault
+response, see ErrorDetails. Warnings of Vault, such as deprecation notices, are
+passed to the WarningFunc of the client:
+
+	c.WarningFunc = func(path string, warnings []string) {
+		log.Printf("vault: %s: %s", path, strings.Join(warnings, "; "))
+	}
+
+KV v2 secrets can be updated with check-and-set, so concurrent writers don't
+overwrite each other; the write fails with ErrVersionConflict if the secret
+changed since it was read:
+
+	secret, version, err := c.ReadSecretWithVersion("secret/prod/db")
+	...
+	err = c.WriteSecretCAS("secret/prod/db", data, version)
+
+Writes of KV v2 secrets are safe to retry: WriteSecret writes with
+check-and-set too, and a write of which the response was lost is detected by
+reading the secret again, instead of writing a duplicate version.
+
+Secrets can be overlaid in priority order with Merge, such as defaults, an
+environment and an instance; Sources has the path each key came from:
+
+	m, err := client.Merge(c, "secret/app/defaults", "secret/app/prod")
+	...
+	log.Printf("password from %s", m.Sources["password"])
+
+A Writer writes files atomically, so readers never see partial contents:
+
+	w := client.NewWriter("/etc/app/db.json", 0600)
+	if err = json.NewEncoder(w).Encode(secret.Data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+
+Code that only reads and writes secrets can accept a KV, which is implemented
+by Client, and be tested with a fake implementation.
+*/
+package client
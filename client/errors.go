@@ -0,0 +1,123 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Errors returned by the client, see Error
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrSealed           = errors.New("vault is sealed")
+	ErrVersionConflict  = errors.New("version conflict")
+)
+
+// errorKinds are the kinds of errors, see ErrorKind
+var errorKinds = []error{ErrNotFound, ErrPermissionDenied, ErrSealed, ErrVersionConflict, ErrUnavailable, ErrReadOnly}
+
+// Error is an error of a known kind, such as ErrNotFound; the kind can be
+// obtained with ErrorKind (or errors.Is)
+type Error struct {
+	Kind error
+	Err  error
+
+	// StatusCode is the HTTP status of the Vault response, if any
+	StatusCode int
+
+	// Errors are the error messages of the Vault response, if any
+	Errors []string
+}
+
+func (err *Error) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap returns the kind of error
+func (err *Error) Unwrap() error {
+	return err.Kind
+}
+
+// ErrorKind returns the kind of error, or nil for errors of an unknown kind;
+// wrapped errors (such as template execution errors) are unwrapped
+func ErrorKind(err error) error {
+	for err != nil {
+		if err, ok := err.(*Error); ok {
+			return err.Kind
+		}
+		for _, kind := range errorKinds {
+			if err == kind {
+				return kind
+			}
+		}
+		wrapper, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			break
+		}
+		err = wrapper.Unwrap()
+	}
+	return nil
+}
+
+// Classify determines the kind of error for errors returned by the Vault
+// API; errors of an unknown kind are returned as-is
+func Classify(err error) error {
+	if err == nil || ErrorKind(err) != nil {
+		return err
+	}
+
+	var (
+		status  int
+		message = err.Error()
+	)
+	var errs []string
+	if res, ok := err.(*api.ResponseError); ok {
+		status, errs = res.StatusCode, res.Errors
+		message = strings.Join(res.Errors, "; ")
+	}
+
+	var kind error
+	switch {
+	case status == http.StatusNotFound:
+		kind = ErrNotFound
+	case status == http.StatusForbidden, strings.Contains(message, "permission denied"):
+		kind = ErrPermissionDenied
+	case strings.Contains(message, "Vault is sealed"):
+		kind = ErrSealed
+	case strings.Contains(message, "check-and-set parameter did not match"):
+		kind = ErrVersionConflict
+	default:
+		return err
+	}
+	return &Error{Kind: kind, Err: err, StatusCode: status, Errors: errs}
+}
+
+// ErrorDetails returns the HTTP status and the error messages of the Vault
+// response that caused err, if any
+func ErrorDetails(err error) (status int, errs []string) {
+	for err != nil {
+		switch e := err.(type) {
+		case *Error:
+			if e.StatusCode != 0 || len(e.Errors) > 0 {
+				return e.StatusCode, e.Errors
+			}
+			err = e.Err
+			continue
+		case *api.ResponseError:
+			return e.StatusCode, e.Errors
+		}
+		wrapper, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			break
+		}
+		err = wrapper.Unwrap()
+	}
+	return 0, nil
+}
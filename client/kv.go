@@ -0,0 +1,294 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// genericType is the type of the KV v1 secrets engine in older Vault versions
+const genericType = "generic"
+
+// kvWriteAttempts is how many times WriteSecret writes a KV v2 secret that
+// other writers change in between
+const kvWriteAttempts = 3
+
+// KV reads and writes KV secrets, it is implemented by Client
+type KV interface {
+	// ReadSecret reads a secret; for KV v2 the data of the current version
+	ReadSecret(path string) (*Secret, error)
+
+	// ReadVersion reads a specific version of a KV v2 secret
+	ReadVersion(path string, version int) (*Secret, error)
+
+	// WriteSecret writes data to a secret; for KV v2 as a new version
+	WriteSecret(path string, data map[string]interface{}) error
+
+	// DeleteSecret removes a secret; for KV v2 the current version
+	DeleteSecret(path string) error
+}
+
+var _ KV = (*Client)(nil)
+
+// MountFor finds the mount serving path, returns the mount path (without
+// leading and with trailing slash, prefixed with the namespace for paths in
+// a child namespace) and the path relative to the mount; see Resolve
+func (c *Client) MountFor(path string) (mount string, info *api.MountOutput, rel string, err error) {
+	l, err := c.Resolve(path)
+	if err != nil {
+		return "", nil, "", err
+	}
+	return l.MountPath(), l.Info, l.Path, nil
+}
+
+// KVVersion returns the version of the KV secrets engine, or 0 if the mount
+// is not a KV secrets engine
+func KVVersion(info *api.MountOutput) int {
+	switch info.Type {
+	case genericType:
+		return 1
+	case "kv":
+		if info.Options["version"] == "2" {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// KV2Path maps path to the KV v2 API path with the given prefix (such as
+// "data" or "metadata"); an error is returned for mounts that are not KV v2
+func (c *Client) KV2Path(path, prefix string) (string, error) {
+	l, err := c.Resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if err = l.RequireKV2("versions"); err != nil {
+		return "", err
+	}
+	return l.APIPath(prefix), nil
+}
+
+// IsKV2 checks if path is served by a KV v2 secrets engine; if the mounts can
+// not be looked up, it is assumed not to be
+func (c *Client) IsKV2(path string) bool {
+	l, err := c.Resolve(path)
+	if err != nil {
+		debugf("kv: %v", err)
+		return false
+	}
+	return l.KVVersion == 2
+}
+
+// ReadSecret reads a secret; for KV v2 the data of the current version
+func (c *Client) ReadSecret(path string) (*Secret, error) {
+	if c.IsKV2(path) {
+		return c.ReadVersion(path, 0)
+	}
+	return c.Read(path)
+}
+
+// WriteSecret writes data to a secret; for KV v2 as a new version. KV v2
+// secrets are written with check-and-set, so retries are safe (see
+// WriteSecretCAS), and not at all if the current version has the same data;
+// without permission to read the secret, it is written as-is.
+func (c *Client) WriteSecret(path string, data map[string]interface{}) error {
+	if c.IsKV2(path) {
+		for attempt := 1; ; attempt++ {
+			current, version, err := c.ReadSecretWithVersion(path)
+			if ErrorKind(err) == ErrPermissionDenied {
+				debugf("kv: can't read %q, writing without check-and-set: %v", path, err)
+				break
+			} else if err != nil {
+				return err
+			}
+			if current != nil && sameData(current.Data, data) {
+				debugf("kv: version %d of %q has the data, not writing it again", version, path)
+				return nil
+			}
+			if err = c.WriteSecretCAS(path, data, version); ErrorKind(err) != ErrVersionConflict || attempt == kvWriteAttempts {
+				return err
+			}
+			debugf("kv: %q changed since version %d, writing again", path, version)
+		}
+		dataPath, err := c.KV2Path(path, "data")
+		if err != nil {
+			return err
+		}
+		_, err = c.Write(dataPath, map[string]interface{}{
+			"data": data,
+		})
+		return err
+	}
+	_, err := c.Write(path, data)
+	return err
+}
+
+// sameData checks if the data of two secrets is the same, as JSON
+func sameData(a, b map[string]interface{}) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ja, jb)
+}
+
+// ReadSecretWithVersion reads the current version of a KV v2 secret, with its
+// version number for WriteSecretCAS. The version is 0 if the secret doesn't
+// exist; the secret is nil if it doesn't exist or its current version is
+// deleted.
+func (c *Client) ReadSecretWithVersion(path string) (*Secret, int, error) {
+	dataPath, err := c.KV2Path(path, "data")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	debugf("kv: read %q with version", dataPath)
+	secret, err := c.Read(dataPath)
+	if err != nil || secret == nil {
+		return nil, 0, err
+	}
+	var version int
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok {
+		if version, err = strconv.Atoi(fmt.Sprint(metadata["version"])); err != nil {
+			return nil, 0, fmt.Errorf("%s: invalid version %v", path, metadata["version"])
+		}
+	}
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		c.warnDeleted(path, secret)
+		return nil, version, nil
+	}
+	secret.Data = data
+	return secret, version, nil
+}
+
+// WriteSecretCAS writes data to a KV v2 secret as a new version, if its
+// current version is cas (0 for a secret that doesn't exist yet); otherwise
+// the error is of kind ErrVersionConflict.
+//
+// A write can be applied while its response is lost, such as when the
+// connection drops; a retry then conflicts, instead of writing a duplicate
+// version. After a conflict or a connection error, the secret is read again,
+// and if version cas+1 has the data, the write was applied, and no error is
+// returned.
+func (c *Client) WriteSecretCAS(path string, data map[string]interface{}, cas int) error {
+	l, err := c.Resolve(path)
+	if err != nil {
+		return err
+	}
+	if err = l.RequireKV2("check-and-set writes"); err != nil {
+		return err
+	}
+	dataPath := l.APIPath("data")
+	debugf("kv: write %q with cas %d", dataPath, cas)
+	_, err = c.Write(dataPath, map[string]interface{}{
+		"data":    data,
+		"options": map[string]interface{}{"cas": cas},
+	})
+	if err != nil && (ErrorKind(err) == ErrVersionConflict || ErrorKind(err) == nil && unreachable(err)) {
+		current, version, rerr := c.ReadSecretWithVersion(path)
+		if rerr == nil && version == cas+1 && current != nil && sameData(current.Data, data) {
+			debugf("kv: write %q with cas %d was applied: %v", dataPath, cas, err)
+			return nil
+		}
+	}
+	return err
+}
+
+// ReadMetadata reads the metadata of a KV v2 secret, with its versions and
+// custom metadata; it returns nil if the secret doesn't exist
+func (c *Client) ReadMetadata(path string) (*Secret, error) {
+	metadataPath, err := c.KV2Path(path, "metadata")
+	if err != nil {
+		return nil, err
+	}
+	return c.Read(metadataPath)
+}
+
+// WriteCustomMetadata sets keys in the custom metadata of a KV v2 secret, the
+// other keys are retained
+func (c *Client) WriteCustomMetadata(path string, custom map[string]string) error {
+	metadataPath, err := c.KV2Path(path, "metadata")
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]interface{})
+	secret, err := c.Read(metadataPath)
+	if err != nil {
+		return err
+	} else if secret != nil {
+		current, _ := secret.Data["custom_metadata"].(map[string]interface{})
+		for k, v := range current {
+			merged[k] = v
+		}
+	}
+	for k, v := range custom {
+		merged[k] = v
+	}
+	_, err = c.Write(metadataPath, map[string]interface{}{
+		"custom_metadata": merged,
+	})
+	return err
+}
+
+// DeleteSecret removes a secret; for KV v2 the current version is deleted
+func (c *Client) DeleteSecret(path string) error {
+	if c.IsKV2(path) {
+		dataPath, err := c.KV2Path(path, "data")
+		if err != nil {
+			return err
+		}
+		_, err = c.Delete(dataPath)
+		return err
+	}
+	_, err := c.Delete(path)
+	return err
+}
+
+// ReadVersion reads the data of a specific version of a KV v2 secret, version
+// 0 is the current version
+func (c *Client) ReadVersion(path string, version int) (*Secret, error) {
+	dataPath, err := c.KV2Path(path, "data")
+	if err != nil {
+		return nil, err
+	}
+
+	debugf("kv: read %q version %d", dataPath, version)
+	secret, err := c.ReadWithData(dataPath, map[string][]string{
+		"version": {strconv.Itoa(version)},
+	})
+	if err != nil || secret == nil {
+		return nil, err
+	}
+
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		// Deleted or destroyed versions have no data
+		c.warnDeleted(path, secret)
+		return nil, nil
+	}
+	secret.Data = data
+	return secret, nil
+}
+
+// warnDeleted warns that the KV v2 version that was read is deleted or
+// destroyed, from its metadata
+func (c *Client) warnDeleted(path string, secret *Secret) {
+	metadata, ok := secret.Data["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if destroyed, _ := metadata["destroyed"].(bool); destroyed {
+		c.warn(c.Abs(path), fmt.Sprintf("version %v is destroyed", metadata["version"]))
+	} else if deleted, _ := metadata["deletion_time"].(string); deleted != "" {
+		c.warn(c.Abs(path), fmt.Sprintf("version %v was deleted at %s", metadata["version"], deleted))
+	}
+}
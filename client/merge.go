@@ -0,0 +1,69 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Merged is the data of several secrets overlaid in order, see Merge
+type Merged struct {
+	// Data has the keys of all secrets; keys in later secrets replace those
+	// of earlier secrets
+	Data map[string]interface{}
+
+	// Sources is the path of the secret each key of Data came from
+	Sources map[string]string
+
+	// Paths are the paths of the secrets that were added, in order
+	Paths []string
+}
+
+// NewMerged returns an empty Merged, for secrets that are added with Add
+func NewMerged() *Merged {
+	return &Merged{
+		Data:    make(map[string]interface{}),
+		Sources: make(map[string]string),
+	}
+}
+
+// Add overlays the data of the secret at path; its keys replace the keys that
+// were added before
+func (m *Merged) Add(path string, data map[string]interface{}) {
+	for key, value := range data {
+		m.Data[key] = value
+		m.Sources[key] = path
+	}
+	m.Paths = append(m.Paths, path)
+}
+
+// Merge reads the secrets at paths and overlays them in priority order, from
+// the lowest to the highest: the keys of a secret replace the keys of the
+// secrets before it, such as defaults, an environment and an instance:
+//
+//	m, err := client.Merge(c, "secret/app/defaults", "secret/app/prod", "secret/app/prod/web1")
+//
+// Secrets that don't exist are skipped; if none of them exist, the error is
+// ErrNotFound.
+func Merge(kv KV, paths ...string) (*Merged, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("merge: no paths")
+	}
+	m := NewMerged()
+	for _, path := range paths {
+		secret, err := kv.ReadSecret(path)
+		if err != nil && ErrorKind(err) != ErrNotFound {
+			return nil, err
+		} else if secret == nil || secret.Data == nil {
+			continue
+		}
+		m.Add(path, secret.Data)
+	}
+	if len(m.Paths) == 0 {
+		return nil, &Error{
+			Kind: ErrNotFound,
+			Err:  fmt.Errorf("merge %s: not found", strings.Join(paths, ", ")),
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,11 @@
+// +build !linux,!darwin,!freebsd,!openbsd,!netbsd,!dragonfly
+
+package client
+
+import "os"
+
+// Owner returns the owner and group of the file described by info; files have
+// no owner on this platform
+func Owner(info os.FileInfo) (uid, gid int, ok bool) {
+	return -1, -1, false
+}
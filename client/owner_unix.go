@@ -0,0 +1,17 @@
+// +build linux darwin freebsd openbsd netbsd dragonfly
+
+package client
+
+import (
+	"os"
+	"syscall"
+)
+
+// Owner returns the owner and group of the file described by info
+func Owner(info os.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
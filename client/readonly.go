@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// ErrReadOnly is returned for requests that change Vault, by a read-only
+// Client; see SetReadOnly
+var ErrReadOnly = errors.New("read-only mode")
+
+// readOnlyWrites are the paths that take a POST or PUT, but don't change
+// Vault: lookups, capabilities, hashing, and the renewal and revocation of
+// the token of the client itself. Audit hashes, logins and AppRole secret ID
+// lookups are allowed too, see readOnlyAllowed.
+var readOnlyWrites = []string{
+	"auth/token/lookup",
+	"auth/token/lookup-accessor",
+	"auth/token/lookup-self",
+	"auth/token/renew-self",
+	"auth/token/revoke-self",
+	"identity/lookup/*",
+	"sys/capabilities",
+	"sys/capabilities-accessor",
+	"sys/capabilities-self",
+	"sys/leases/lookup",
+	"sys/mfa/validate",
+	"sys/tools/hash",
+	"sys/tools/hash/*",
+	"sys/tools/random",
+	"sys/tools/random/*",
+	"sys/wrapping/lookup",
+}
+
+// readOnlyAllowed checks if a request with method to the API path p (without
+// the /v1/ prefix) doesn't change Vault
+func readOnlyAllowed(method, p string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, "LIST":
+		return true
+	case http.MethodPost, http.MethodPut:
+	default:
+		return false
+	}
+	for _, pattern := range readOnlyWrites {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+
+	// Audit devices may be nested
+	if strings.HasPrefix(p, "sys/audit-hash/") {
+		return true
+	}
+
+	// Logins, at auth/<mount>/login or auth/<mount>/login/<name>, the
+	// authorization URL of OIDC logins, and the lookups of AppRole secret IDs
+	// at auth/<mount>/role/<role>/secret-id/lookup and secret-id-accessor/lookup;
+	// mounts may be nested
+	if !strings.HasPrefix(p, "auth/") || strings.HasPrefix(p, "auth/token/") {
+		return false
+	}
+	parts := strings.Split(p, "/")
+	n := len(parts)
+	switch {
+	case n >= 6 && parts[n-4] == "role" && (parts[n-2] == "secret-id" || parts[n-2] == "secret-id-accessor") && parts[n-1] == "lookup":
+		return readOnlyMount(parts[1 : n-4])
+	case n >= 3 && parts[n-1] == "login":
+		return readOnlyMount(parts[1 : n-1])
+	case n >= 4 && parts[n-2] == "login":
+		return readOnlyMount(parts[1 : n-2])
+	case n >= 4 && parts[n-2] == "oidc" && parts[n-1] == "auth_url":
+		return readOnlyMount(parts[1 : n-2])
+	}
+	return false
+}
+
+// readOnlyMount checks if parts can be the path of an auth mount, and not of
+// a role or user named like an allowed endpoint, such as auth/approle/role/login
+func readOnlyMount(parts []string) bool {
+	for _, part := range parts {
+		switch part {
+		case "", "certs", "config", "groups", "map", "role", "roles", "users":
+			return false
+		}
+	}
+	return true
+}
+
+// readOnlyTransport refuses the requests of a Client that change Vault,
+// without sending them
+type readOnlyTransport struct {
+	next http.RoundTripper
+}
+
+func (t *readOnlyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if p := strings.TrimPrefix(r.URL.Path, "/v1/"); p != r.URL.Path && !readOnlyAllowed(r.Method, p) {
+		debugf("client: refused %s %s in read-only mode", r.Method, p)
+		return nil, &Error{Kind: ErrReadOnly, Err: fmt.Errorf("%s %s: refused in read-only mode", r.Method, p)}
+	}
+	return t.next.RoundTrip(r)
+}
+
+// readOnlyRetry doesn't retry requests refused by a readOnlyTransport, and
+// returns the refusal as-is
+func readOnlyRetry(next func(context.Context, *http.Response, error) (bool, error)) func(context.Context, *http.Response, error) (bool, error) {
+	return func(ctx context.Context, res *http.Response, err error) (bool, error) {
+		var refused *Error
+		if errors.As(err, &refused) && refused.Kind == ErrReadOnly {
+			return false, refused
+		}
+		return next(ctx, res, err)
+	}
+}
+
+// SetReadOnly makes the client refuse requests that change Vault, such as
+// writes, deletes and changes of mounts, policies and auth methods, with
+// ErrReadOnly; reads, lookups and logins are sent as before. This includes
+// the requests made with the API client directly.
+func (c *Client) SetReadOnly() error {
+	config := c.CloneConfig()
+	next := config.HttpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	config.HttpClient.Transport = &readOnlyTransport{next: next}
+	checkRetry := config.CheckRetry
+	if checkRetry == nil {
+		checkRetry = api.DefaultRetryPolicy
+	}
+	config.CheckRetry = readOnlyRetry(checkRetry)
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return err
+	}
+	client.SetToken(c.Token())
+	client.SetHeaders(c.Headers())
+	c.Client = client
+	c.ReadOnly = true
+	return nil
+}
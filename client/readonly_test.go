@@ -0,0 +1,108 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestReadOnlyAllowed(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         bool
+	}{
+		{"GET", "secret/data/app", true},
+		{"LIST", "secret/metadata/app", true},
+		{"PUT", "secret/data/app", false},
+		{"POST", "secret/data/app", false},
+		{"DELETE", "secret/metadata/app", false},
+		{"PATCH", "secret/data/app", false},
+		{"POST", "sys/mounts/kv", false},
+		{"PUT", "sys/policies/acl/app", false},
+		{"POST", "auth/token/create", false},
+		{"POST", "auth/token/lookup-accessor", true},
+		{"PUT", "auth/token/renew-self", true},
+		{"POST", "sys/capabilities-self", true},
+		{"POST", "sys/tools/hash/sha2-256", true},
+		{"POST", "identity/lookup/entity", true},
+		{"PUT", "auth/approle/login", true},
+		{"PUT", "auth/userpass/login/alice", true},
+		{"PUT", "auth/teams/ldap/login/alice", true},
+		{"PUT", "auth/oidc/oidc/auth_url", true},
+		{"POST", "auth/userpass/users/alice", false},
+		{"POST", "sys/audit-hash/file", true},
+		{"POST", "sys/audit-hash/team/file", true},
+		{"POST", "sys/audit/file", false},
+		{"POST", "auth/approle/role/app/secret-id-accessor/lookup", true},
+		{"POST", "auth/apps/prod/role/app/secret-id/lookup", true},
+		{"POST", "auth/approle/role/app/secret-id-accessor/destroy", false},
+		{"POST", "auth/approle/role/app/secret-id", false},
+		{"POST", "auth/approle/role/login", false},
+		{"POST", "auth/userpass/users/login", false},
+		{"POST", "auth/approle/role/login/secret-id/lookup", true},
+		{"POST", "auth/approle/role/app/users/secret-id/lookup", false},
+		{"PUT", "auth/token/login", false},
+	}
+	for _, test := range tests {
+		if got := readOnlyAllowed(test.method, test.path); got != test.want {
+			t.Errorf("%s %s: expected %t, got %t", test.method, test.path, test.want, got)
+		}
+	}
+}
+
+func TestSetReadOnly(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"data": {"password": "secret"}}`))
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	c, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetToken("s.test")
+	if err = c.SetReadOnly(); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBreaker()
+	if err = c.SetBreaker(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.Read("secret/app"); err != nil {
+		t.Fatalf("expected the read to succeed, got %v", err)
+	}
+	if _, err = c.Write("auth/token/lookup-accessor", map[string]interface{}{"accessor": "a"}); err != nil {
+		t.Fatalf("expected the lookup to succeed, got %v", err)
+	}
+
+	// Refused requests aren't sent, nor retried, and don't open the breaker
+	for i := 0; i < DefaultBreakerThreshold; i++ {
+		if _, err = c.Write("secret/app", map[string]interface{}{"password": "new"}); ErrorKind(err) != ErrReadOnly {
+			t.Fatalf("expected ErrReadOnly, got %v", err)
+		}
+	}
+	if err = c.Sys().Mount("kv", &api.MountInput{Type: "kv"}); ErrorKind(err) != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly for the mount, got %v", err)
+	}
+	if _, err = c.Delete("secret/app"); ErrorKind(err) != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly for the delete, got %v", err)
+	} else if want := "DELETE secret/app: refused in read-only mode"; err.Error() != want {
+		t.Fatalf("expected %q, got %q", want, err)
+	}
+	if open, _ := b.Open(); open {
+		t.Fatal("expected the breaker to be closed")
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %q", requests)
+	}
+	if !c.ReadOnly {
+		t.Fatal("expected the client to be read-only")
+	}
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Location is a path resolved against the mounts of its namespace, see Resolve
+type Location struct {
+	// Namespace is the namespace of the path, relative to the namespace of
+	// the client; empty for paths in the namespace of the client
+	Namespace string
+
+	// Mount is the path of the mount in the namespace, with a trailing slash
+	Mount string
+
+	// Type is the type of the secrets engine, such as "kv" or "pki"
+	Type string
+
+	// KVVersion is the version of a KV secrets engine, or 0 for other
+	// secrets engines
+	KVVersion int
+
+	// Path is the path relative to the mount
+	Path string
+
+	// Info describes the mount
+	Info *api.MountOutput
+}
+
+// APIPath returns the path of the location for the Vault API; for KV v2, the
+// prefix (such as "data" or "metadata") is inserted after the mount
+func (l *Location) APIPath(prefix string) string {
+	p := l.Mount + l.Path
+	if prefix != "" {
+		p = l.Mount + prefix + "/" + l.Path
+	}
+	if l.Namespace != "" {
+		p = l.Namespace + "/" + p
+	}
+	return p
+}
+
+// MountPath returns the path of the mount for the Vault API, with the
+// namespace
+func (l *Location) MountPath() string {
+	if l.Namespace != "" {
+		return l.Namespace + "/" + l.Mount
+	}
+	return l.Mount
+}
+
+// RequireKV2 returns an error if the location is not in a KV v2 secrets
+// engine; what is the feature that needs it, such as "versions"
+func (l *Location) RequireKV2(what string) error {
+	switch {
+	case l.KVVersion == 2:
+		return nil
+	case l.KVVersion == 1:
+		return fmt.Errorf("mount '%s' is KV v1, %s are not supported", l.MountPath(), what)
+	default:
+		return fmt.Errorf("mount '%s' is a %s secrets engine, %s are not supported", l.MountPath(), l.Type, what)
+	}
+}
+
+// Resolve parses path into its namespace, mount, secrets engine and the path
+// relative to the mount, with the cached mounts lookup (see Mounts). Paths
+// that are not served by a mount of the namespace of the client are looked up
+// in child namespaces, for paths prefixed with a namespace such as
+// "team-a/secret/app".
+func (c *Client) Resolve(p string) (*Location, error) {
+	p = strings.Trim(c.Abs(p), "/")
+
+	mounts, err := c.Mounts()
+	if err != nil {
+		return nil, err
+	}
+	if l := findMount(mounts, p); l != nil {
+		return l, nil
+	}
+
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		namespace := strings.Join(parts[:i], "/")
+		if l := findMount(c.mountsIn(namespace), strings.Join(parts[i:], "/")); l != nil {
+			l.Namespace = namespace
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no mount found", p)
+}
+
+// findMount returns the location of p in mounts, or nil; the longest matching
+// mount wins
+func findMount(mounts map[string]*api.MountOutput, p string) *Location {
+	var l *Location
+	for name, info := range mounts {
+		if strings.HasPrefix(p+"/", name) && (l == nil || len(name) > len(l.Mount)) {
+			l = &Location{Mount: name, Type: info.Type, KVVersion: KVVersion(info), Info: info}
+		}
+	}
+	if l != nil {
+		l.Path = strings.TrimSuffix(strings.TrimPrefix(p+"/", l.Mount), "/")
+	}
+	return l
+}
+
+// namespaceMounts are the cached mounts lookups of child namespaces
+type namespaceMounts struct {
+	sync.Mutex
+	mounts map[string]map[string]*api.MountOutput
+	times  map[string]time.Time
+}
+
+func newNamespaceMounts() *namespaceMounts {
+	return &namespaceMounts{
+		mounts: make(map[string]map[string]*api.MountOutput),
+		times:  make(map[string]time.Time),
+	}
+}
+
+// mountsIn returns the mounts of the child namespace, the lookup is cached
+// like Mounts; namespaces that don't exist, or that can't be looked up, have
+// no mounts
+func (c *Client) mountsIn(namespace string) map[string]*api.MountOutput {
+	if c.namespaceMounts == nil {
+		c.namespaceMounts = newNamespaceMounts()
+	}
+	cache := c.namespaceMounts
+	cache.Lock()
+	defer cache.Unlock()
+	if t, ok := cache.times[namespace]; ok && time.Since(t) < mountRefresh {
+		return cache.mounts[namespace]
+	}
+
+	var done func(*Secret, error)
+	if c.Observer != nil {
+		done = c.Observer.Begin(c, "mounts", namespace+"/"+mountsPath)
+	}
+	mounts, err := c.listMountsIn(namespace)
+	if done != nil {
+		done(nil, err)
+	}
+	if err != nil {
+		debugf("client: mounts of namespace %s: %v", namespace, err)
+	}
+	cache.mounts[namespace] = mounts
+	cache.times[namespace] = time.Now()
+	return mounts
+}
+
+// listMountsIn looks up the mounts of the child namespace
+func (c *Client) listMountsIn(namespace string) (map[string]*api.MountOutput, error) {
+	return c.WithNamespace(path.Join(c.Namespace(), namespace)).Sys().ListMounts()
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	lookups := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/mounts" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		namespace := r.Header.Get("X-Vault-Namespace")
+		lookups[namespace]++
+		var mounts map[string]interface{}
+		switch namespace {
+		case "":
+			mounts = map[string]interface{}{
+				"old/":    map[string]interface{}{"type": "kv", "options": map[string]string{"version": "1"}},
+				"secret/": map[string]interface{}{"type": "kv", "options": map[string]string{"version": "2"}},
+				"pki/":    map[string]interface{}{"type": "pki"},
+			}
+		case "team-a":
+			mounts = map[string]interface{}{
+				"kv/": map[string]interface{}{"type": "kv", "options": map[string]string{"version": "2"}},
+			}
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": mounts})
+	}))
+	defer server.Close()
+
+	c := testClient(t, server.URL)
+
+	for _, test := range []struct {
+		path, namespace, mount, rel, apiPath, err string
+	}{
+		{"/secret/app/db", "", "secret/", "app/db", "secret/data/app/db", ""},
+		{"old/app", "", "old/", "app", "old/data/app", "mount 'old/' is KV v1, versions are not supported"},
+		{"pki/issue/web", "", "pki/", "issue/web", "pki/data/issue/web", "mount 'pki/' is a pki secrets engine, versions are not supported"},
+		{"team-a/kv/app", "team-a", "kv/", "app", "team-a/kv/data/app", ""},
+		{"team-a/kv/other", "team-a", "kv/", "other", "team-a/kv/data/other", ""},
+	} {
+		l, err := c.Resolve(test.path)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if l.Namespace != test.namespace || l.Mount != test.mount || l.Path != test.rel {
+			t.Fatalf("%s: unexpected location %+v", test.path, l)
+		}
+		if got := l.APIPath("data"); got != test.apiPath {
+			t.Fatalf("%s: expected API path %q, got %q", test.path, test.apiPath, got)
+		}
+		if err = l.RequireKV2("versions"); (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Fatalf("%s: expected error %q, got %v", test.path, test.err, err)
+		}
+	}
+	if _, err := c.Resolve("nothing/here"); err == nil {
+		t.Fatal("expected error for a path without a mount")
+	}
+	if lookups[""] != 1 || lookups["team-a"] != 1 {
+		t.Fatalf("expected the mounts to be looked up once, got %v", lookups)
+	}
+}
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Writer writes a file atomically: data is written to a temporary file in the
+// same directory as the target file, which is moved to the final name when
+// the Writer is closed. Until then, the target file is untouched.
+//
+// The temporary file is created on the first write; if nothing was written,
+// or the contents didn't change, closing leaves the target file untouched.
+type Writer struct {
+	name, temp string
+	mode       os.FileMode
+	uid, gid   int
+	xattrs     map[string]string
+	mutex      sync.Mutex
+	file       *os.File
+}
+
+// NewWriter returns a Writer for the named file, created with mode
+func NewWriter(name string, mode os.FileMode) *Writer {
+	return &Writer{
+		name: name,
+		mode: mode,
+		uid:  -1,
+		gid:  -1,
+	}
+}
+
+// SetOwner sets the owner and group of the file, like os.Chown: -1 leaves
+// either unchanged. Changing the owner requires root (or CAP_CHOWN); it must be
+// set before the first write.
+func (w *Writer) SetOwner(uid, gid int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.uid, w.gid = uid, gid
+}
+
+// Name returns the name of the target file
+func (w *Writer) Name() string {
+	return w.name
+}
+
+// Close moves the temporary file to the target file
+func (w *Writer) Close() error {
+	_, err := w.Commit()
+	return err
+}
+
+// SetXattrs sets extended attributes on the file, such as "security.selinux"
+// for its SELinux label; it must be set before the first write. Without a
+// SELinux label, the label of the file that is replaced is kept, as renaming
+// the temporary file would lose it.
+func (w *Writer) SetXattrs(attrs map[string]string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.xattrs = attrs
+}
+
+// Commit moves the temporary file to the target file, like Close; it reports
+// whether the target file changed. If the target file already has the same
+// contents, mode, owner and extended attributes, it's left untouched.
+func (w *Writer) Commit() (bool, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file != nil {
+		defer func() {
+			w.file = nil
+		}()
+		if err := w.file.Close(); err != nil {
+			return false, err
+		}
+		if w.unchanged() {
+			debugf("writer: %s is unchanged", w.name)
+			return false, os.Remove(w.temp)
+		}
+		debugf("writer: rename %s to %s", w.temp, w.name)
+		if err := os.Rename(w.temp, w.name); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	debugf("writer: nothing was written")
+	return false, nil
+}
+
+// unchanged checks if the target file has the contents, mode, owner and
+// extended attributes of the temporary file
+func (w *Writer) unchanged() bool {
+	info, err := os.Stat(w.name)
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm() != w.mode.Perm() {
+		return false
+	}
+	if w.uid != -1 || w.gid != -1 {
+		uid, gid, ok := Owner(info)
+		if !ok || (w.uid != -1 && uid != w.uid) || (w.gid != -1 && gid != w.gid) {
+			return false
+		}
+	}
+	if !HasXattrs(w.name, w.xattrs) {
+		return false
+	}
+	old, err := ioutil.ReadFile(w.name)
+	if err != nil {
+		return false
+	}
+	b, err := ioutil.ReadFile(w.temp)
+	return err == nil && bytes.Equal(old, b)
+}
+
+// Abort closes and removes the temporary file, leaving the target untouched
+func (w *Writer) Abort() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file != nil {
+		debugf("writer: removing %s", w.temp)
+		w.file.Close()
+		os.Remove(w.temp)
+		w.file = nil
+	}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if err := w.maybeOpenWriter(); err != nil {
+		return 0, err
+	}
+	return w.file.Write(p)
+}
+
+func (w *Writer) maybeOpenWriter() (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		debugf("writer: creating temporary file for %s", w.name)
+		dir, base := filepath.Split(w.name)
+		base = "." + base + "."
+
+		if w.file, err = ioutil.TempFile(dir, base); err != nil {
+			return
+		}
+		if err = w.file.Chmod(w.mode); err != nil {
+			debugf("writer: chmod %s failed: %v", w.file.Name(), err)
+			return
+		}
+		if w.uid != -1 || w.gid != -1 {
+			if err = w.file.Chown(w.uid, w.gid); err != nil {
+				debugf("writer: chown %s failed: %v", w.file.Name(), err)
+				w.file.Close()
+				os.Remove(w.file.Name())
+				w.file = nil
+				return
+			}
+		}
+		if err = w.setXattrs(); err != nil {
+			w.file.Close()
+			os.Remove(w.file.Name())
+			w.file = nil
+			return
+		}
+		debugf("writer: using temporary file %s", w.file.Name())
+		w.temp = w.file.Name()
+	}
+
+	return
+}
+
+// setXattrs sets the extended attributes on the temporary file, and copies the
+// SELinux label of the target file if none is set
+func (w *Writer) setXattrs() error {
+	temp := w.file.Name()
+	for attr, value := range w.xattrs {
+		if err := setXattr(temp, attr, value); err != nil {
+			debugf("writer: setxattr %s on %s failed: %v", attr, temp, err)
+			return fmt.Errorf("set %s on %s: %v", attr, w.name, err)
+		}
+	}
+	if _, ok := w.xattrs[selinuxXattr]; !ok {
+		if label, ok := getXattr(w.name, selinuxXattr); ok {
+			debugf("writer: keeping SELinux label %s of %s", label, w.name)
+			if err := setXattr(temp, selinuxXattr, label); err != nil {
+				debugf("writer: setxattr %s on %s failed: %v", selinuxXattr, temp, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package client
+
+// HasXattrs checks if the named file has the extended attributes, such as
+// "security.selinux" for its SELinux label
+func HasXattrs(name string, attrs map[string]string) bool {
+	for attr, value := range attrs {
+		if current, ok := getXattr(name, attr); !ok || current != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+// +build linux
+
+package client
+
+import (
+	"strings"
+	"syscall"
+)
+
+// selinuxXattr is the extended attribute with the SELinux label of a file
+const selinuxXattr = "security.selinux"
+
+func setXattr(name, attr, value string) error {
+	return syscall.Setxattr(name, attr, []byte(value), 0)
+}
+
+// getXattr returns the value of the extended attribute of the named file,
+// without the trailing NUL that labels have
+func getXattr(name, attr string) (string, bool) {
+	size, err := syscall.Getxattr(name, attr, nil)
+	if err != nil {
+		return "", false
+	}
+	value := make([]byte, size)
+	if size, err = syscall.Getxattr(name, attr, value); err != nil {
+		return "", false
+	}
+	return strings.TrimRight(string(value[:size]), "\x00"), true
+}
@@ -0,0 +1,16 @@
+// +build !linux
+
+package client
+
+import "errors"
+
+// selinuxXattr is the extended attribute with the SELinux label of a file
+const selinuxXattr = "security.selinux"
+
+func setXattr(name, attr, value string) error {
+	return errors.New("extended attributes are not supported on this platform")
+}
+
+func getXattr(name, attr string) (string, bool) {
+	return "", false
+}
@@ -1,6 +1,12 @@
 package vc
 
-import "testing"
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"testing"
+)
 
 func TestClientPath(t *testing.T) {
 	tests := []struct {
@@ -18,8 +24,102 @@ func TestClientPath(t *testing.T) {
 	c := new(Client)
 	for _, test := range tests {
 		c.SetPath(test.Path)
-		if path := c.abspath(test.Test); path != test.Want {
+		if path := c.Abs(test.Test); path != test.Want {
 			t.Fatalf("abspath(%q) in %q; expected %q, got %q", test.Test, test.Path, test.Want, path)
 		}
 	}
 }
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		Test string
+		Want []string
+	}{
+		{"secret/test", []string{"secret/test"}},
+		{"secret/{foo}", []string{"secret/{foo}"}},
+		{"secret/{stage,prod}/db", []string{"secret/stage/db", "secret/prod/db"}},
+		{"{a,b}/{c,d}", []string{"a/c", "a/d", "b/c", "b/d"}},
+		{"secret/{a,b{1,2}}", []string{"secret/a", "secret/b1", "secret/b2"}},
+		{"secret/{,x}y", []string{"secret/y", "secret/xy"}},
+		{"secret/}{a,b", []string{"secret/}{a,b"}},
+	}
+
+	for _, test := range tests {
+		if got := expandBraces(test.Test); !reflect.DeepEqual(got, test.Want) {
+			t.Fatalf("expandBraces(%q): expected %q, got %q", test.Test, test.Want, got)
+		}
+	}
+}
+
+func TestGlobExpression(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Test    string
+		Want    bool
+	}{
+		{"*", "test", true},
+		{"test-?", "test-1", true},
+		{"test-?", "test-10", false},
+		{"*.json", "config.json", true},
+		{"*.json", "configxjson", false},
+		{"db*", "mydb", false},
+	}
+
+	for _, test := range tests {
+		if got := regexp.MustCompile(globExpression(test.Pattern)).MatchString(test.Test); got != test.Want {
+			t.Fatalf("globExpression(%q) match %q: expected %t, got %t", test.Pattern, test.Test, test.Want, got)
+		}
+	}
+}
+
+func TestListIter(t *testing.T) {
+	lists := make(map[string]int)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/secret", "GET /v1/secret/":
+			lists["secret"]++
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"b/", "a", "c"}}}
+		case "GET /v1/secret/b", "GET /v1/secret/b/":
+			lists["secret/b"]++
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"y", "x"}}}
+		case "GET /v1/secret/broken", "GET /v1/secret/broken/":
+			w.WriteHeader(http.StatusInternalServerError)
+			response = map[string]interface{}{"errors": []string{"internal error"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	it := c.ListIter("/secret", true)
+	if !it.Next() || it.Info().Name() != "/secret/a" {
+		t.Fatalf("expected /secret/a first, got %v", it.Info())
+	}
+	if lists["secret/b"] != 0 {
+		t.Fatal("expected secret/b to be listed when it is reached")
+	}
+	var names []string
+	for it.Next() {
+		names = append(names, it.Info().Name())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/secret/b", "/secret/b/x", "/secret/b/y", "/secret/c"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+
+	paths, err := c.walk("/secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/secret/a", "/secret/b/x", "/secret/b/y", "/secret/c"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("walk: expected %v, got %v", want, paths)
+	}
+
+	if it = c.ListIter("/secret/broken", true); it.Next() || it.Err() == nil {
+		t.Fatal("expected error for failed listing")
+	}
+}
@@ -0,0 +1,107 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// clipboardCommands are tried in order to set the system clipboard
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+}
+
+// clipboardPasteCommands are tried in order to read the system clipboard
+var clipboardPasteCommands = [][]string{
+	{"pbpaste"},
+	{"wl-paste", "--no-newline"},
+	{"xclip", "-selection", "clipboard", "-out"},
+	{"xsel", "--clipboard", "--output"},
+}
+
+// clipboardCommand returns the path of the first of commands that is usable
+// on this platform and display, and its arguments
+func clipboardCommand(commands [][]string) (string, []string, bool) {
+	for _, args := range commands {
+		darwin := args[0] == "pbcopy" || args[0] == "pbpaste"
+		wayland := args[0] == "wl-copy" || args[0] == "wl-paste"
+		if darwin && runtime.GOOS != "darwin" {
+			continue
+		}
+		if wayland && os.Getenv("WAYLAND_DISPLAY") == "" {
+			continue
+		}
+		if !darwin && !wayland && os.Getenv("DISPLAY") == "" {
+			continue
+		}
+		if path, err := exec.LookPath(args[0]); err == nil {
+			return path, args[1:], true
+		}
+	}
+	return "", nil, false
+}
+
+// copyToClipboard puts p on the system clipboard, either using one of the
+// platform clipboard utilities or by sending an OSC 52 escape sequence to the
+// controlling terminal.
+func copyToClipboard(p []byte) error {
+	if path, args, ok := clipboardCommand(clipboardCommands); ok {
+		Debugf("clipboard: using %s", path)
+		c := exec.Command(path, args...)
+		c.Stdin = bytes.NewReader(p)
+		if err := c.Run(); err != nil {
+			return fmt.Errorf("clipboard: %s: %v", filepath.Base(path), err)
+		}
+		return nil
+	}
+
+	// Fall back to OSC 52, which is supported by most terminal emulators (and
+	// also works over SSH)
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return errors.New("clipboard: no clipboard utility or terminal available")
+	}
+	defer tty.Close()
+
+	Debug("clipboard: using OSC 52 escape sequence")
+	_, err = fmt.Fprintf(tty, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString(p))
+	return err
+}
+
+// readClipboard returns the contents of the system clipboard, from one of the
+// platform clipboard utilities; OSC 52 terminals can't be read
+func readClipboard() ([]byte, error) {
+	path, args, ok := clipboardCommand(clipboardPasteCommands)
+	if !ok {
+		return nil, errors.New("clipboard: no clipboard utility to read with")
+	}
+	b, err := exec.Command(path, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("clipboard: %s: %v", filepath.Base(path), err)
+	}
+	return b, nil
+}
+
+// clearClipboard empties the system clipboard if it still holds p, and not
+// something copied since; clipboards that can't be read are emptied anyway
+func clearClipboard(p []byte) (bool, error) {
+	current, err := readClipboard()
+	if err == nil {
+		defer wipe(current)
+		if !bytes.Equal(current, p) {
+			Debug("clipboard: changed since the copy, not clearing")
+			return false, nil
+		}
+	} else {
+		Debugf("%v", err)
+	}
+	return true, copyToClipboard(nil)
+}
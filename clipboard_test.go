@@ -0,0 +1,56 @@
+package vc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClearClipboard(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "clipboard")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake xclip that keeps the clipboard in a file
+	clip := filepath.Join(dir, "clipboard")
+	script := "#!/bin/sh\nif [ \"$3\" = -out ]; then cat " + clip + "; else cat > " + clip + "; fi\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "xclip"), []byte(script), 0755); err != nil {
+		t.Skip(err)
+	}
+	for key, value := range map[string]string{"PATH": dir + string(os.PathListSeparator) + os.Getenv("PATH"), "DISPLAY": ":0", "WAYLAND_DISPLAY": ""} {
+		saved, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+		if ok {
+			defer os.Setenv(key, saved)
+		} else {
+			defer os.Unsetenv(key)
+		}
+	}
+
+	if err = copyToClipboard([]byte("s3cret")); err != nil {
+		t.Fatal(err)
+	}
+	if cleared, err := clearClipboard([]byte("s3cret")); err != nil || !cleared {
+		t.Fatalf("expected the clipboard to be cleared, got %t, %v", cleared, err)
+	}
+	if b, _ := ioutil.ReadFile(clip); len(b) != 0 {
+		t.Fatalf("expected an empty clipboard, got %q", b)
+	}
+
+	// Something copied since is kept
+	if err = copyToClipboard([]byte("s3cret")); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(clip, []byte("other"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cleared, err := clearClipboard([]byte("s3cret")); err != nil || cleared {
+		t.Fatalf("expected the clipboard to be kept, got %t, %v", cleared, err)
+	}
+	if b, _ := ioutil.ReadFile(clip); string(b) != "other" {
+		t.Fatalf("expected the clipboard to be kept, got %q", b)
+	}
+}
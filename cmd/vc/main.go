@@ -12,12 +12,84 @@ vc respects the following environment settings:
                    specified, its value will take precedence.
  VAULT_TOKEN       Vault access token
  VAULT_TOKEN_FILE  Vault access token file
+ VAULT_ROLE_ID     AppRole role ID (see "vc login")
+ VAULT_SECRET_ID   AppRole secret ID (see "vc login")
+ NO_COLOR          Disable colored output
+ OTEL_EXPORTER_OTLP_ENDPOINT
+                   Export tracing spans to an OpenTelemetry collector (OTLP
+                   over HTTP, see "Tracing" in the README)
+ VC_AGENT_SOCK     Socket of the agent, commands use the token of the agent
+                   (see "vc agent")
+ VC_ASSUME_YES     Skip confirmation prompts for destructive operations, like
+                   the --yes flag.
+ VC_CONFIG         Configuration file (default $HOME/.vc.yaml)
+ VC_PATH           Working path, relative secret paths are resolved against
+                   the working path (see "vc use")
+ VC_PROFILE        Vault cluster from the profiles in the configuration, like
+                   the --profile flag
 
 If no VAULT_TOKEN is set, VAULT_TOKEN_FILE will try:
  $HOME/.vault-token
  /etc/vault-client/token
 
 
+Global Flags
+
+vc accepts the following global flags:
+ --allow-plaintext-args
+                   Allow values that look like secrets as literal arguments
+                   (see "Plaintext arguments" in the README)
+ --ci              Mask fetched values in CI job logs (automatic on GitHub
+                   Actions, Azure Pipelines and Buildkite)
+ --debug           Enable debug logging
+ --disable-mlock   Don't lock memory, secrets may be swapped to disk (see
+                   "Memory" in the README)
+ --drain-timeout   How long a command may finish its work after SIGTERM,
+                   before uncommitted output is removed (default 30s)
+ --dry-run         Report the changes that would be made to Vault or files,
+                   without making them
+ --encrypt-to      Encrypt output to an age or OpenPGP recipient (can be
+                   repeated)
+ --explain         Explain permission errors: the policies and capabilities
+                   of the token on the denied path
+ --header          Send an extra HTTP header to Vault, as "Name: value" (can
+                   be repeated, see "Profiles" in the README)
+ --health-addr     Serve the health of the agent, or sync and template in
+                   watch mode, on this address (see "Health" in the README)
+ --insecure-mode   Allow output files with secrets that are readable by group
+                   or others (see "Output mode" in the README)
+ --max-age         Read responses from a Vault Agent cache again when they are
+                   older, such as 1m (see "Vault Agent" in the README)
+ --metrics-file    Write metrics to a file on exit, in the Prometheus text
+                   format (for the node_exporter textfile collector)
+ --no-color        Disable colored output
+ --offline         Serve reads from the cache when Vault can't be reached
+                   (see "Cache" in the README)
+ --profile         Vault cluster from the profiles in the configuration,
+                   with its own token (see "Profiles" in the README)
+ --read-only       Refuse operations that change Vault, and writes of files
+                   outside writable_files (see "Read-only mode" in the README)
+ --redact          Redact secret values in diffs, errors and logs: none,
+                   partial, hash or mask (see "Redaction" in the README)
+ --refresh         Bypass the cache of a Vault Agent, reads reach Vault
+ --yes             Skip confirmation prompts for destructive operations
+
+
+Exit Codes
+
+ 0  Success
+ 1  Syntax error, or invalid input
+ 2  Client error, such as an invalid configuration
+ 3  Server error
+ 4  System error, such as failing to write a file
+ 5  Codec error
+ 6  Secret not found
+ 7  Permission denied
+ 8  Vault is sealed
+ 9  Version conflict
+ 10 Files drifted from their templates (see vc verify)
+
+
 Command cat
 
 Show the contents of a secret.
@@ -140,34 +212,146 @@ package main
 import (
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/cli"
 
 	"github.com/tehmaze/vc"
 	_ "github.com/tehmaze/vc/builtin/codec"
+	"github.com/tehmaze/vc/client"
 )
 
 // BuildVersion is the version for release builds
 var BuildVersion = "(development build)"
 
+// maxAge sets vc.MaxAge
+func maxAge(value string) {
+	age, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid --max-age: %v", err)
+	}
+	vc.MaxAge = age
+}
+
+// redact sets vc.Redact
+func redact(mode string) {
+	if err := vc.CheckRedactMode(mode); err != nil {
+		log.Fatalf("invalid --redact: %v", err)
+	}
+	vc.Redact = mode
+}
+
+// drainTimeout sets vc.DrainTimeout
+func drainTimeout(value string) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid --drain-timeout: %v", err)
+	}
+	vc.DrainTimeout = timeout
+}
+
+func header(value string) {
+	if err := vc.AddHeader(value); err != nil {
+		log.Fatalf("invalid --header: %v", err)
+	}
+}
+
 func main() {
 	var (
 		debug bool
 		args  = make([]string, 0, len(os.Args[1:]))
 	)
 
-	for _, arg := range os.Args[1:] {
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
 		if arg == "--debug" {
 			debug = true
+		} else if arg == "--ci" {
+			vc.CI = true
+		} else if arg == "--no-color" {
+			vc.NoColor = true
+		} else if arg == "--disable-mlock" {
+			vc.DisableMlock = true
+		} else if arg == "--drain-timeout" && i+1 < len(os.Args) {
+			i++
+			drainTimeout(os.Args[i])
+		} else if strings.HasPrefix(arg, "--drain-timeout=") {
+			drainTimeout(arg[len("--drain-timeout="):])
+		} else if arg == "--dry-run" {
+			vc.DryRun = true
+		} else if arg == "--explain" {
+			vc.Explain = true
+		} else if arg == "--header" && i+1 < len(os.Args) {
+			i++
+			header(os.Args[i])
+		} else if strings.HasPrefix(arg, "--header=") {
+			header(arg[len("--header="):])
+		} else if arg == "--health-addr" && i+1 < len(os.Args) {
+			i++
+			vc.HealthAddr = os.Args[i]
+		} else if strings.HasPrefix(arg, "--health-addr=") {
+			vc.HealthAddr = arg[len("--health-addr="):]
+		} else if arg == "--allow-plaintext-args" {
+			vc.AllowPlaintextArgs = true
+		} else if arg == "--insecure-mode" {
+			vc.InsecureMode = true
+		} else if arg == "--offline" {
+			vc.Offline = true
+		} else if arg == "--read-only" {
+			vc.ReadOnly = true
+		} else if arg == "--redact" && i+1 < len(os.Args) {
+			i++
+			redact(os.Args[i])
+		} else if strings.HasPrefix(arg, "--redact=") {
+			redact(arg[len("--redact="):])
+		} else if arg == "--refresh" {
+			vc.Refresh = true
+		} else if arg == "--max-age" && i+1 < len(os.Args) {
+			i++
+			maxAge(os.Args[i])
+		} else if strings.HasPrefix(arg, "--max-age=") {
+			maxAge(arg[len("--max-age="):])
+		} else if arg == "--yes" {
+			vc.AssumeYes = true
+		} else if arg == "--encrypt-to" && i+1 < len(os.Args) {
+			i++
+			vc.EncryptTo = append(vc.EncryptTo, os.Args[i])
+		} else if strings.HasPrefix(arg, "--encrypt-to=") {
+			vc.EncryptTo = append(vc.EncryptTo, arg[len("--encrypt-to="):])
+		} else if arg == "--metrics-file" && i+1 < len(os.Args) {
+			i++
+			vc.MetricsFile = os.Args[i]
+		} else if strings.HasPrefix(arg, "--metrics-file=") {
+			vc.MetricsFile = arg[len("--metrics-file="):]
+		} else if arg == "--profile" && i+1 < len(os.Args) {
+			i++
+			vc.ProfileName = os.Args[i]
+		} else if strings.HasPrefix(arg, "--profile=") {
+			vc.ProfileName = arg[len("--profile="):]
 		} else {
 			args = append(args, arg)
 		}
 	}
 
+	// Installed (or linked) as a Docker or Git credential helper
+	switch filepath.Base(os.Args[0]) {
+	case vc.DockerCredentialHelper:
+		args = append([]string{"docker-credential"}, args...)
+	case vc.GitCredentialHelper:
+		args = append([]string{"git-credential"}, args...)
+	}
+
 	if debug {
 		vc.DebugLogFunc = func(message string) {
 			log.Println(message)
 		}
+		client.DebugLogFunc = vc.Debug
+	}
+
+	if err := vc.LockMemory(); err != nil {
+		log.Fatalln(err)
 	}
 
 	ui := &cli.BasicUi{
@@ -178,11 +362,24 @@ func main() {
 
 	app := vc.DefaultApp(ui, args)
 	app.Version = BuildVersion
+	vc.Version = BuildVersion
 
-	code, err := app.Run()
-	if err != nil {
-		log.Println(err)
-	}
+	code := vc.RunWithShutdown(func() int {
+		code, err := vc.Trace(strings.TrimSpace("vc "+app.Subcommand()), app.Run)
+		if err != nil {
+			log.Println(err)
+		}
+		if err = vc.RunHooks(); err != nil {
+			log.Println(err)
+			if code == vc.Success {
+				code = vc.SystemError
+			}
+		}
+		if err = vc.WriteMetrics(); err != nil {
+			log.Println(err)
+		}
+		return code
+	})
 
 	os.Exit(code)
 }
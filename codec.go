@@ -1,8 +1,11 @@
 package vc
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"sync"
 )
 
@@ -25,6 +28,54 @@ type Marshaler interface {
 	Marshal(path string, data map[string]interface{}) ([]byte, error)
 }
 
+// StreamMarshaler is a Marshaler that can write to w directly, without
+// buffering the output; commands use it for large values
+type StreamMarshaler interface {
+	MarshalTo(w io.Writer, path string, data map[string]interface{}) error
+}
+
+// marshalTo marshals data to w with c, streaming if c is a StreamMarshaler
+func marshalTo(w io.Writer, c Marshaler, path string, data map[string]interface{}) error {
+	if s, ok := c.(StreamMarshaler); ok {
+		return s.MarshalTo(w, path, data)
+	}
+	b, err := c.Marshal(path, data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Base64Reader decodes the base64 (standard encoding) value s as it is read,
+// ignoring whitespace, without copying s
+func Base64Reader(s string) io.Reader {
+	return base64.NewDecoder(base64.StdEncoding, &spaceFilter{r: strings.NewReader(s)})
+}
+
+// spaceFilter removes whitespace from r
+type spaceFilter struct {
+	r io.Reader
+}
+
+func (f *spaceFilter) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+		j := 0
+		for _, c := range p[:n] {
+			switch c {
+			case ' ', '\t', '\r', '\n':
+			default:
+				p[j] = c
+				j++
+			}
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
 // MarshalingNotSupported is a placeholder Marshaler that returns an error
 // upon marshaling.
 type MarshalingNotSupported struct{}
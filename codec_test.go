@@ -3,6 +3,7 @@ package vc
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
 	"testing"
 )
 
@@ -51,3 +52,26 @@ func TestCodec(t *testing.T) {
 		t.Fatal("expected unmarshal[\"test\"] to exist")
 	}
 }
+
+func TestBase64Reader(t *testing.T) {
+	b, err := ioutil.ReadAll(Base64Reader("aGVs\nbG8g\r\n d29y\tbGQ=\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello world" {
+		t.Fatalf("expected %q, got %q", "hello world", b)
+	}
+	if _, err = ioutil.ReadAll(Base64Reader("not base64!")); err == nil {
+		t.Fatal("expected error for invalid input")
+	}
+}
+
+func TestMarshalTo(t *testing.T) {
+	var buf bytes.Buffer
+	if err := marshalTo(&buf, new(testCodec), "test", map[string]interface{}{"test": "value"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "{\n  \"test\": \"value\"\n}\n"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
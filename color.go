@@ -0,0 +1,160 @@
+package vc
+
+import (
+	"os"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// NoColorEnv is the environment variable that disables colored output when
+// set, see https://no-color.org
+const NoColorEnv = "NO_COLOR"
+
+// NoColor disables colored output
+var NoColor bool
+
+// Theme maps the elements of the output to colors, such as "red" or
+// "bold blue"
+type Theme map[string]string
+
+// DefaultTheme is used for elements that have no color in the configured
+// theme
+var DefaultTheme = Theme{
+	"added":     "green",
+	"changed":   "yellow",
+	"removed":   "red",
+	"hunk":      "cyan",
+	"header":    "bold",
+	"dir":       "bold blue",
+	"current":   "green",
+	"deleted":   "red",
+	"destroyed": "dim",
+	"error":     "red",
+	"warn":      "yellow",
+}
+
+// colorCodes are the ANSI SGR parameters for color and attribute names
+var colorCodes = map[string]string{
+	"black":     "30",
+	"red":       "31",
+	"green":     "32",
+	"yellow":    "33",
+	"blue":      "34",
+	"magenta":   "35",
+	"cyan":      "36",
+	"white":     "37",
+	"bold":      "1",
+	"dim":       "2",
+	"italic":    "3",
+	"underline": "4",
+}
+
+// colorizer paints text according to a theme, if enabled
+type colorizer struct {
+	theme   Theme
+	enabled bool
+}
+
+// newColorizer returns a colorizer for output to f; mode is one of "auto",
+// "always" or "never". In auto mode, colors are used if f is a terminal and
+// NoColorEnv is not set.
+func newColorizer(theme Theme, mode string, f *os.File) colorizer {
+	var enabled bool
+	switch {
+	case NoColor || mode == "never":
+	case mode == "always":
+		enabled = true
+	default:
+		enabled = os.Getenv(NoColorEnv) == "" && IsTerminal(f.Fd())
+	}
+	return colorizer{theme: theme, enabled: enabled}
+}
+
+// colors returns a colorizer for output to f, using the configured theme
+func (cmd *baseCommand) colors(f *os.File) colorizer {
+	config, err := cmd.Config()
+	if err != nil {
+		Debugf("config: %v", err)
+		config = new(Config)
+	}
+	return newColorizer(config.Theme, config.Color, f)
+}
+
+// paint colors s as element
+func (c colorizer) paint(element, s string) string {
+	if !c.enabled || s == "" {
+		return s
+	}
+	color, ok := c.theme[element]
+	if !ok {
+		color = DefaultTheme[element]
+	}
+
+	var codes []string
+	for _, name := range strings.Fields(color) {
+		if code, ok := colorCodes[name]; ok {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return s
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m" + s + "\x1b[0m"
+}
+
+// change paints a change as returned by describeChanges
+func (c colorizer) change(s string) string {
+	switch {
+	case strings.HasPrefix(s, "+"):
+		return c.paint("added", s)
+	case strings.HasPrefix(s, "~"):
+		return c.paint("changed", s)
+	case strings.HasPrefix(s, "-"):
+		return c.paint("removed", s)
+	}
+	return s
+}
+
+// diff paints a line of a unified diff
+func (c colorizer) diff(s string) string {
+	switch {
+	case strings.HasPrefix(s, "+++"), strings.HasPrefix(s, "---"):
+		return s
+	case strings.HasPrefix(s, "@@"):
+		return c.paint("hunk", s)
+	case strings.HasPrefix(s, "+"):
+		return c.paint("added", s)
+	case strings.HasPrefix(s, "-"):
+		return c.paint("removed", s)
+	}
+	return s
+}
+
+// coloredUi paints errors and warnings
+type coloredUi struct {
+	cli.Ui
+	colors colorizer
+}
+
+// colorUi wraps ui to paint errors and warnings, which are written to stderr,
+// using the configured theme
+func colorUi(ui cli.Ui) cli.Ui {
+	config, err := LoadConfig(configName())
+	if err != nil {
+		Debugf("config: %v", err)
+		config = new(Config)
+	}
+	return &coloredUi{
+		Ui:     ui,
+		colors: newColorizer(config.Theme, config.Color, os.Stderr),
+	}
+}
+
+func (ui *coloredUi) Error(message string) {
+	ui.Ui.Error(ui.colors.paint("error", message))
+}
+
+func (ui *coloredUi) Warn(message string) {
+	ui.Ui.Warn(ui.colors.paint("warn", message))
+}
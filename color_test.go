@@ -0,0 +1,46 @@
+package vc
+
+import (
+	"os"
+	"testing"
+)
+
+func TestColorizer(t *testing.T) {
+	c := newColorizer(Theme{"dir": "bold magenta", "error": "none"}, "always", os.Stdout)
+	tests := []struct {
+		Element string
+		Test    string
+		Want    string
+	}{
+		{"added", "+ key", "\x1b[32m+ key\x1b[0m"},
+		{"dir", "secret", "\x1b[1;35msecret\x1b[0m"},
+		{"error", "error: test", "error: test"},
+		{"unknown", "test", "test"},
+		{"added", "", ""},
+	}
+	for _, test := range tests {
+		if got := c.paint(test.Element, test.Test); got != test.Want {
+			t.Fatalf("paint(%q, %q): expected %q, got %q", test.Element, test.Test, test.Want, got)
+		}
+	}
+
+	if got := c.change("~ key"); got != "\x1b[33m~ key\x1b[0m" {
+		t.Fatalf("change: unexpected %q", got)
+	}
+	if got := c.diff("--- old"); got != "--- old" {
+		t.Fatalf("diff: unexpected %q", got)
+	}
+	if got := c.diff("@@ -1,1 +1,1 @@"); got != "\x1b[36m@@ -1,1 +1,1 @@\x1b[0m" {
+		t.Fatalf("diff: unexpected %q", got)
+	}
+
+	if c = newColorizer(nil, "never", os.Stdout); c.paint("added", "+ key") != "+ key" {
+		t.Fatal("expected no colors in never mode")
+	}
+
+	NoColor = true
+	defer func() { NoColor = false }()
+	if c = newColorizer(nil, "always", os.Stdout); c.enabled {
+		t.Fatal("expected no colors with NoColor")
+	}
+}
@@ -0,0 +1,183 @@
+package vc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigFile is the default configuration file
+const ConfigFile = "$HOME/.vc.yaml"
+
+// ConfigFileEnv is the environment variable that overrides ConfigFile
+const ConfigFileEnv = "VC_CONFIG"
+
+// Config is the vc configuration file
+type Config struct {
+	// Aliases maps short names to secret paths
+	Aliases map[string]string `yaml:"aliases,omitempty"`
+
+	// TokenHelper is an external program that stores the Vault token, see
+	// the Vault CLI token helpers
+	TokenHelper string `yaml:"token_helper,omitempty"`
+
+	// IdleTimeout locks the session when the stored token wasn't used for
+	// the duration, see LockCommand
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+
+	// Color is "auto" (default), "always" or "never"
+	Color string `yaml:"color,omitempty"`
+
+	// Theme overrides the colors of DefaultTheme
+	Theme Theme `yaml:"theme,omitempty"`
+
+	// DockerCredentials is the path template for registry credentials, see
+	// DefaultDockerCredentials
+	DockerCredentials string `yaml:"docker_credentials,omitempty"`
+
+	// GitCredentials is the path template for Git credentials, see
+	// DefaultGitCredentials
+	GitCredentials string `yaml:"git_credentials,omitempty"`
+
+	// Plugins maps plugin names to their command line, see plugin
+	Plugins map[string][]string `yaml:"plugins,omitempty"`
+
+	// Hooks run after output files changed
+	Hooks []Hook `yaml:"hooks,omitempty"`
+
+	// Cache keeps the secrets that were read, encrypted, for --offline
+	Cache *Cache `yaml:"cache,omitempty"`
+
+	// Profiles are the Vault clusters that can be selected with --profile
+	Profiles map[string]*Profile `yaml:"profiles,omitempty"`
+
+	// Lint are the rules of vc lint
+	Lint *LintRules `yaml:"lint,omitempty"`
+
+	// Agent configures vc agent
+	Agent *AgentConfig `yaml:"agent,omitempty"`
+
+	// Redact configures the redaction of secret values in diffs, errors and
+	// logs
+	Redact *Redaction `yaml:"redact,omitempty"`
+
+	// SecurityKey seals the token store and the cache with a hardware
+	// security key
+	SecurityKey *SecurityKey `yaml:"security_key,omitempty"`
+
+	// OutputMode is the mode of output files with secrets, such as of vc cat
+	// -o and vc template, when -m isn't given; see DefaultOutputMode
+	OutputMode string `yaml:"output_mode,omitempty"`
+
+	// Schemas are the JSON Schemas the data of secrets is validated against
+	// before it is written
+	Schemas []Schema `yaml:"schemas,omitempty"`
+
+	// PlaintextArgs is warn (the default) or refuse, for secret values given
+	// as literal command line arguments; see checkPlaintextArgs
+	PlaintextArgs string `yaml:"plaintext_args,omitempty"`
+
+	// SelfUpdate configures the releases of vc self-update
+	SelfUpdate *SelfUpdate `yaml:"self_update,omitempty"`
+
+	// ReadOnly refuses operations that change Vault, and writes of files
+	// other than WritableFiles, like --read-only; see checkWritable
+	ReadOnly bool `yaml:"read_only,omitempty"`
+
+	// WritableFiles are the patterns of the files that may be written in
+	// read-only mode, such as $HOME/audit/*
+	WritableFiles []string `yaml:"writable_files,omitempty"`
+
+	name string
+}
+
+// LoadConfig reads the configuration file; a missing file results in an
+// empty configuration
+func LoadConfig(name string) (*Config, error) {
+	config := &Config{name: name}
+
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(b, config); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return config, nil
+}
+
+// configName returns the name of the configuration file
+func configName() string {
+	if name := os.Getenv(ConfigFileEnv); name != "" {
+		return name
+	}
+	return os.ExpandEnv(ConfigFile)
+}
+
+// Save writes the configuration file
+func (config *Config) Save() error {
+	if ReadOnly || config.ReadOnly {
+		return &Error{Kind: ErrReadOnly, Err: fmt.Errorf("%s: not writable in read-only mode", config.name)}
+	}
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	w := SafeOutputWriter(config.name, 0600)
+	if _, err = w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// expandAlias replaces the first element of path if it is an alias, it
+// returns true if an alias was expanded
+func (config *Config) expandAlias(path string) (string, bool) {
+	name, rest := path, ""
+	if i := strings.IndexAny(path, "/@"); i != -1 {
+		name, rest = path[:i], path[i:]
+	}
+	if target, ok := config.Aliases[name]; ok {
+		Debugf("alias: %s -> %s", name, target)
+		return strings.TrimRight(target, "/") + rest, true
+	}
+	return path, false
+}
+
+// expandTemplate replaces the {name} placeholders in the path template with
+// vars; empty elements are removed from the resulting path
+func expandTemplate(template string, vars map[string]string) string {
+	pairs := make([]string, 0, len(vars)*2)
+	for name, value := range vars {
+		pairs = append(pairs, "{"+name+"}", strings.Trim(value, "/"))
+	}
+	path := strings.NewReplacer(pairs...).Replace(template)
+
+	var parts []string
+	for _, part := range strings.Split(path, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// templateRoot returns the path of template up to the first placeholder
+func templateRoot(template string) string {
+	if i := strings.IndexByte(template, '{'); i != -1 {
+		template = template[:i]
+		if i = strings.LastIndexByte(template, '/'); i == -1 {
+			return ""
+		}
+		template = template[:i]
+	}
+	return strings.Trim(template, "/")
+}
@@ -0,0 +1,72 @@
+package vc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	temp, err := ioutil.TempFile(os.TempDir(), "config")
+	if err != nil {
+		t.Skip(err)
+	}
+	name := temp.Name()
+	temp.Close()
+	os.Remove(name)
+	defer os.Remove(name)
+
+	config, err := LoadConfig(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Aliases) != 0 {
+		t.Fatalf("expected no aliases, got %+v", config.Aliases)
+	}
+
+	config.Aliases = map[string]string{"db": "secret/teams/payments/prod/db/"}
+	if err = config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if config, err = LoadConfig(name); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Path string
+		Want string
+	}{
+		{"db", "secret/teams/payments/prod/db"},
+		{"db/password", "secret/teams/payments/prod/db/password"},
+		{"db@3", "secret/teams/payments/prod/db@3"},
+		{"dbx", "dbx"},
+		{"secret/db", "secret/db"},
+	}
+	for _, test := range tests {
+		if got, _ := config.expandAlias(test.Path); got != test.Want {
+			t.Fatalf("expandAlias(%q): expected %q, got %q", test.Path, test.Want, got)
+		}
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	tests := []struct {
+		Template string
+		Vars     map[string]string
+		Want     string
+		Root     string
+	}{
+		{"secret/docker/{host}", map[string]string{"host": "ghcr.io"}, "secret/docker/ghcr.io", "secret/docker"},
+		{"secret/git/{host}/{username}", map[string]string{"host": "github.com", "username": ""}, "secret/git/github.com", "secret/git"},
+		{"secret/git/{host}-{path}", map[string]string{"host": "example.com", "path": "/repo/"}, "secret/git/example.com-repo", "secret/git"},
+		{"/secret/ci/", nil, "secret/ci", "secret/ci"},
+	}
+	for _, test := range tests {
+		if got := expandTemplate(test.Template, test.Vars); got != test.Want {
+			t.Fatalf("expandTemplate(%q): expected %q, got %q", test.Template, test.Want, got)
+		}
+		if got := templateRoot(test.Template); got != test.Root {
+			t.Fatalf("templateRoot(%q): expected %q, got %q", test.Template, test.Root, got)
+		}
+	}
+}
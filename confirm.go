@@ -0,0 +1,67 @@
+package vc
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// AssumeYesEnv is the environment variable that skips confirmation prompts
+// when set to a true value, for automation.
+const AssumeYesEnv = "VC_ASSUME_YES"
+
+// AssumeYes skips confirmation prompts for destructive operations
+var AssumeYes bool
+
+// assumeYes checks if confirmation prompts should be skipped
+func assumeYes() bool {
+	if AssumeYes {
+		return true
+	}
+	yes, _ := strconv.ParseBool(os.Getenv(AssumeYesEnv))
+	return yes
+}
+
+// confirmChanges asks the user to confirm a destructive operation, after
+// listing the changes that will be made. Confirmation is skipped if force is
+// set or if AssumeYes applies. If we can't prompt, because stdin is not a
+// terminal, an error is returned. Dry runs don't need confirmation.
+func (cmd *baseCommand) confirmChanges(force bool, changes []string, format string, v ...interface{}) (bool, error) {
+	if force || assumeYes() || DryRun {
+		return true, nil
+	}
+
+	prompt := fmt.Sprintf(format, v...)
+	if !IsTerminal(os.Stdin.Fd()) {
+		return false, fmt.Errorf("%s; not a terminal, use -f or set %s=1 to confirm", prompt, AssumeYesEnv)
+	}
+	colors := cmd.colors(os.Stdout)
+	for _, change := range changes {
+		cmd.ui.Output(colors.change(change))
+	}
+	return confirm(prompt), nil
+}
+
+// describeChanges lists the keys that are added (+), changed (~) or removed (-)
+// when the data in a secret is replaced; values are never shown
+func describeChanges(old, new map[string]interface{}) []string {
+	var changes []string
+	for key, value := range new {
+		if oldValue, ok := old[key]; !ok {
+			changes = append(changes, "+ "+key)
+		} else if !reflect.DeepEqual(value, oldValue) {
+			changes = append(changes, "~ "+key)
+		}
+	}
+	for key := range old {
+		if _, ok := new[key]; !ok {
+			changes = append(changes, "- "+key)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i][2:] < changes[j][2:]
+	})
+	return changes
+}
@@ -0,0 +1,36 @@
+package vc
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDescribeChanges(t *testing.T) {
+	changes := describeChanges(map[string]interface{}{
+		"changed":   "old",
+		"removed":   "old",
+		"unchanged": "same",
+	}, map[string]interface{}{
+		"added":     "new",
+		"changed":   "new",
+		"unchanged": "same",
+	})
+	if want := []string{"+ added", "~ changed", "- removed"}; !reflect.DeepEqual(changes, want) {
+		t.Fatalf("expected %q, got %q", want, changes)
+	}
+}
+
+func TestAssumeYes(t *testing.T) {
+	org := os.Getenv(AssumeYesEnv)
+	defer os.Setenv(AssumeYesEnv, org)
+
+	os.Setenv(AssumeYesEnv, "")
+	if assumeYes() {
+		t.Fatal("expected assumeYes to be false")
+	}
+	os.Setenv(AssumeYesEnv, "1")
+	if !assumeYes() {
+		t.Fatalf("expected assumeYes to be true with %s=1", AssumeYesEnv)
+	}
+}
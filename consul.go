@@ -0,0 +1,108 @@
+package vc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultConsulAddr is the address of the Consul agent, if CONSUL_HTTP_ADDR
+// is not set
+const DefaultConsulAddr = "127.0.0.1:8500"
+
+// consulSource reads from Consul KV, for consul://path. The keys below path
+// are the keys of the secret; values are strings.
+type consulSource struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// newConsulSource configures a Consul KV client from the environment, like
+// the Consul CLI
+func newConsulSource() *consulSource {
+	s := &consulSource{
+		addr:   os.Getenv("CONSUL_HTTP_ADDR"),
+		token:  os.Getenv("CONSUL_HTTP_TOKEN"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	if s.addr == "" {
+		s.addr = DefaultConsulAddr
+	}
+	if !strings.Contains(s.addr, "://") {
+		if os.Getenv("CONSUL_HTTP_SSL") == "true" {
+			s.addr = "https://" + s.addr
+		} else {
+			s.addr = "http://" + s.addr
+		}
+	}
+	s.addr = strings.TrimRight(s.addr, "/")
+	if name := os.Getenv("CONSUL_HTTP_TOKEN_FILE"); s.token == "" && name != "" {
+		if b, err := ioutil.ReadFile(name); err == nil {
+			s.token = strings.TrimSpace(string(b))
+		} else {
+			Debugf("consul: %v", err)
+		}
+	}
+	return s
+}
+
+// consulEntry is a key in a Consul KV listing
+type consulEntry struct {
+	Key   string
+	Value []byte
+}
+
+// Read implements source
+func (s *consulSource) Read(path string) (*api.Secret, error) {
+	prefix := strings.Trim(path, "/") + "/"
+	u := s.addr + "/v1/kv/" + (&url.URL{Path: prefix}).EscapedPath() + "?recurse=true"
+	if dc := os.Getenv("CONSUL_DATACENTER"); dc != "" {
+		u += "&dc=" + url.QueryEscape(dc)
+	}
+	r, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		r.Header.Set("X-Consul-Token", s.token)
+	}
+
+	Debugf("consul: GET %s", u)
+	res, err := s.client.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("consul: %v", err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case res.StatusCode == http.StatusForbidden:
+		return nil, &Error{Kind: ErrPermissionDenied, Err: fmt.Errorf("consul: %s: %s", path, res.Status)}
+	case res.StatusCode/100 != 2:
+		return nil, fmt.Errorf("consul: %s: %s", path, res.Status)
+	}
+
+	var entries []consulEntry
+	if err = json.NewDecoder(res.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("consul: %s: %v", path, err)
+	}
+	data := make(map[string]interface{}, len(entries))
+	for _, entry := range entries {
+		// Skip folders
+		if key := strings.TrimPrefix(entry.Key, prefix); key != "" && !strings.HasSuffix(key, "/") {
+			data[key] = string(entry.Value)
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return &api.Secret{Data: data}, nil
+}
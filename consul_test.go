@@ -0,0 +1,54 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConsulSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "test" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/config/app/" || r.URL.Query().Get("recurse") != "true" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]consulEntry{
+			{Key: "config/app/"},
+			{Key: "config/app/feature", Value: []byte("on")},
+			{Key: "config/app/limits/"},
+			{Key: "config/app/limits/rps", Value: []byte("100")},
+		})
+	}))
+	defer server.Close()
+
+	defer os.Setenv("CONSUL_HTTP_ADDR", os.Getenv("CONSUL_HTTP_ADDR"))
+	defer os.Setenv("CONSUL_HTTP_TOKEN", os.Getenv("CONSUL_HTTP_TOKEN"))
+	os.Setenv("CONSUL_HTTP_ADDR", server.URL)
+	os.Setenv("CONSUL_HTTP_TOKEN", "test")
+
+	cmd := &baseCommand{config: new(Config)}
+	secret, err := cmd.readSource("consul://config/app", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"feature": "on", "limits/rps": "100"}
+	if !reflect.DeepEqual(secret.Data, want) {
+		t.Fatalf("expected %v, got %v", want, secret.Data)
+	}
+
+	if secret, err = cmd.readSource("consul://config/other", nil); err != nil || secret != nil {
+		t.Fatalf("expected no secret, got %v, %v", secret, err)
+	}
+
+	os.Setenv("CONSUL_HTTP_TOKEN", "wrong")
+	if _, err = cmd.readSource("consul://config/app", nil); ErrorKind(err) != ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
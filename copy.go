@@ -3,8 +3,6 @@ package vc
 import (
 	"flag"
 	"fmt"
-	"os"
-	"strings"
 
 	"github.com/mitchellh/cli"
 )
@@ -24,7 +22,7 @@ func (cmd *CopyCommand) Run(args []string) int {
 	if err := cmd.fs.Parse(args); err != nil {
 		return SyntaxError
 	}
-	if args = cmd.fs.Args(); len(args) != 2 {
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) != 2 {
 		return Help
 	}
 
@@ -39,38 +37,38 @@ func (cmd *CopyCommand) Run(args []string) int {
 	}
 
 	// Read secret at old path
-	secret, err := client.Logical().Read(strings.TrimLeft(args[0], "/"))
+	secret, err := client.Read(args[0])
 	if err != nil {
 		cmd.ui.Error(err.Error())
-		return ServerError
+		return exitCode(err, ServerError)
 	}
 	if secret == nil {
 		cmd.ui.Error(fmt.Sprintf("no secret at %q", args[0]))
-		return SyntaxError
+		return NotFoundError
 	}
 
 	// Check if secret at new path exists, unless force is enabled
 	if !cmd.force {
-		oldSecret, oerr := client.Logical().Read(strings.TrimLeft(args[1], "/"))
+		oldSecret, oerr := client.Read(args[1])
 		if oerr != nil {
 			cmd.ui.Error(oerr.Error())
-			return SyntaxError
+			return exitCode(oerr, ServerError)
 		}
 		if oldSecret != nil {
-			if !IsTerminal(os.Stdout.Fd()) {
-				cmd.ui.Error(fmt.Sprintf("secret at %q already exists", args[1]))
+			ok, err := cmd.confirmChanges(false, describeChanges(oldSecret.Data, secret.Data), "secret at %s already exists, overwrite?", args[1])
+			if err != nil {
+				cmd.ui.Error(err.Error())
 				return SystemError
-			}
-			if !confirmf("secret at %s already exists, overwrite?", args[1]) {
+			} else if !ok {
 				return Success
 			}
 		}
 	}
 
 	// Write secret at new path
-	if _, err = client.Logical().Write(strings.TrimLeft(args[1], "/"), secret.Data); err != nil {
+	if err = cmd.writeSecret(client, args[1], secret.Data); err != nil {
 		cmd.ui.Error(err.Error())
-		return ServerError
+		return exitCode(err, ServerError)
 	}
 
 	return Success
@@ -1,9 +1,10 @@
 package vc
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"strings"
+	"os"
 
 	"github.com/mitchellh/cli"
 )
@@ -11,19 +12,20 @@ import (
 // DeleteCommand can display (structured) secrets
 type DeleteCommand struct {
 	baseCommand
-	fs    *flag.FlagSet
-	force bool
+	fs        *flag.FlagSet
+	force     bool
+	recursive bool
 }
 
 func (cmd *DeleteCommand) Help() string {
-	return "Usage: vc rm <secret path>\n\nOptions:\n" + defaults(cmd.fs)
+	return "Usage: vc rm <secret path> [... <secret path>]\n\nOptions:\n" + defaults(cmd.fs)
 }
 
 func (cmd *DeleteCommand) Run(args []string) int {
 	if err := cmd.fs.Parse(args); err != nil {
 		return SyntaxError
 	}
-	if args = cmd.fs.Args(); len(args) != 1 {
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) == 0 {
 		return Help
 	}
 
@@ -33,28 +35,101 @@ func (cmd *DeleteCommand) Run(args []string) int {
 		return ClientError
 	}
 
+	// Expand globs (if any), and directories when removing recursively
+	if cmd.recursive {
+		if args, err = cmd.walk(client, args); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return exitCode(err, SyntaxError)
+		}
+	} else if args, err = client.expand(args, isSecret); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	if len(args) == 0 {
+		cmd.ui.Error("error: no secrets matched")
+		return SyntaxError
+	}
+
 	if !cmd.force {
-		secret, err := client.Logical().Read(strings.TrimLeft(args[0], "/"))
+		var changes []string
+		for _, path := range args {
+			secret, err := client.Read(path)
+			if err != nil {
+				cmd.ui.Error(err.Error())
+				return exitCode(err, ServerError)
+			}
+			if secret == nil {
+				cmd.ui.Error(fmt.Sprintf("secret at %q does not exist", path))
+				return NotFoundError
+			}
+			if len(args) == 1 {
+				changes = describeChanges(secret.Data, nil)
+			} else {
+				changes = append(changes, "- "+path)
+			}
+		}
+
+		var ok bool
+		if len(args) == 1 {
+			ok, err = cmd.confirmChanges(false, changes, "remove secret at %s?", args[0])
+		} else {
+			ok, err = cmd.confirmChanges(false, changes, "remove %d secrets?", len(args))
+		}
 		if err != nil {
 			cmd.ui.Error(err.Error())
-			return ServerError
-		}
-		if secret == nil {
-			cmd.ui.Error(fmt.Sprintf("secret at %q does not exist", args[0]))
-			return SyntaxError
+			return SystemError
+		} else if !ok {
+			return Success
 		}
 	}
 
-	if _, err := client.Logical().Delete(strings.TrimLeft(args[0], "/")); err != nil {
-		cmd.ui.Error(err.Error())
-		return ServerError
+	progress := cmd.progress("removing", len(args))
+	defer progress.Done()
+	for _, path := range args {
+		if err := cmd.deleteSecret(client, path); err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, ServerError)
+		}
+		progress.Add(1)
 	}
 
 	return Success
 }
 
+// walk expands patterns to all matching secrets, including the secrets below
+// matching directories
+func (cmd *DeleteCommand) walk(client *Client, patterns []string) ([]string, error) {
+	expanded, err := client.expand(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, path := range expanded {
+		info, err := client.Stat(path)
+		if err == os.ErrNotExist {
+			return nil, notFound(fmt.Sprintf("secret at %q does not exist", path))
+		} else if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, path)
+			continue
+		}
+		if client.Abs(path) == "/" {
+			return nil, errors.New("refusing to remove all secrets")
+		}
+		secrets, err := client.walk(info.Name())
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, secrets...)
+	}
+	return paths, nil
+}
+
 func (cmd *DeleteCommand) Synopsis() string {
-	return "remove a secret"
+	return "remove one or more secrets"
 }
 
 func DeleteCommandFactory(ui cli.Ui) cli.CommandFactory {
@@ -67,6 +142,7 @@ func DeleteCommandFactory(ui cli.Ui) cli.CommandFactory {
 
 		cmd.fs = flag.NewFlagSet("rm", flag.ContinueOnError)
 		cmd.fs.BoolVar(&cmd.force, "f", false, "force removal")
+		cmd.fs.BoolVar(&cmd.recursive, "r", false, "recursively remove the secrets in directories")
 		cmd.fs.Usage = func() {
 			fmt.Print(cmd.Help())
 		}
@@ -0,0 +1,150 @@
+package vc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around changes
+	diffContext = 3
+
+	// diffMaxCells limits the size of the LCS table, larger inputs are only
+	// summarized
+	diffMaxCells = 1 << 24
+)
+
+// diffLine is a line in a diff, prefixed by ' ', '-' or '+'
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines computes a line based diff between a and b, using the longest
+// common subsequence of lines
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var (
+		lines []diffLine
+		i, j  int
+	)
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
+
+// splitLines splits text into lines, without the line terminators
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// writeDiff writes a diff between old and new in unified format to w, with
+// only the changed lines and their context. It returns false if there are no
+// differences.
+func writeDiff(w io.Writer, oldName, newName, old, new string) (changed bool, err error) {
+	if old == new {
+		return false, nil
+	}
+
+	a, b := splitLines(old), splitLines(new)
+	if _, err = fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName); err != nil {
+		return true, err
+	}
+	if (len(a)+1)*(len(b)+1) > diffMaxCells {
+		_, err = fmt.Fprintf(w, "@@ %d lines changed to %d lines @@\n", len(a), len(b))
+		return true, err
+	}
+
+	lines := diffLines(a, b)
+	show := make([]bool, len(lines))
+	for i, line := range lines {
+		if line.op == ' ' {
+			continue
+		}
+		for j := i - diffContext; j <= i+diffContext; j++ {
+			if j >= 0 && j < len(lines) {
+				show[j] = true
+			}
+		}
+	}
+
+	var oldLine, newLine int
+	for i := 0; i < len(lines); {
+		if !show[i] {
+			if lines[i].op != '+' {
+				oldLine++
+			}
+			if lines[i].op != '-' {
+				newLine++
+			}
+			i++
+			continue
+		}
+
+		// Start of a hunk
+		end := i
+		for end < len(lines) && show[end] {
+			end++
+		}
+		var oldCount, newCount int
+		for _, line := range lines[i:end] {
+			if line.op != '+' {
+				oldCount++
+			}
+			if line.op != '-' {
+				newCount++
+			}
+		}
+		if _, err = fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", oldLine+1, oldCount, newLine+1, newCount); err != nil {
+			return true, err
+		}
+		for _, line := range lines[i:end] {
+			if _, err = fmt.Fprintf(w, "%c%s\n", line.op, line.text); err != nil {
+				return true, err
+			}
+		}
+		oldLine += oldCount
+		newLine += newCount
+		i = end
+	}
+
+	return true, nil
+}
@@ -0,0 +1,35 @@
+package vc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteDiff(t *testing.T) {
+	tests := []struct {
+		Old, New string
+		Want     string
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", ""},
+		{"", "a\n", "--- old\n+++ new\n@@ -1,0 +1,1 @@\n+a\n"},
+		{"a\nb\nc\n", "a\nB\nc\n", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			"--- old\n+++ new\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+	}
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		changed, err := writeDiff(buf, "old", "new", test.Old, test.New)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != (test.Want != "") {
+			t.Fatalf("expected changed=%t for %q -> %q", test.Want != "", test.Old, test.New)
+		}
+		if got := buf.String(); got != test.Want {
+			t.Fatalf("expected diff:\n%s\ngot:\n%s", test.Want, got)
+		}
+	}
+}
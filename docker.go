@@ -0,0 +1,250 @@
+package vc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// DockerCredentialHelper is the name vc is installed (or linked) as to act as
+// a Docker credential helper
+const DockerCredentialHelper = "docker-credential-vc"
+
+// DefaultDockerCredentials is the default path template for registry
+// credentials; {host} is the registry host (and port), {path} is the path of
+// the registry URL, if any
+const DefaultDockerCredentials = "secret/docker/{host}"
+
+// dockerCredentialsNotFound is the message the Docker CLI expects when no
+// credentials are found
+const dockerCredentialsNotFound = "credentials not found in native keychain"
+
+// Keys of the secret holding registry credentials
+const (
+	dockerServerURLKey = "server_url"
+	dockerUsernameKey  = "username"
+	dockerSecretKey    = "secret"
+)
+
+// dockerCredentials are exchanged with the Docker CLI
+type dockerCredentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// dockerServerVars returns the template variables for a registry server URL,
+// which may lack a scheme, such as "ghcr.io"
+func dockerServerVars(server string) (map[string]string, error) {
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q", server)
+	}
+	return map[string]string{
+		"host": u.Host,
+		"path": u.Path,
+	}, nil
+}
+
+// DockerCredentialCommand implements the Docker credential helper protocol
+type DockerCredentialCommand struct {
+	baseCommand
+	fs       *flag.FlagSet
+	sub      string
+	template string
+	server   string
+	in       io.Reader
+}
+
+func (cmd *DockerCredentialCommand) Help() string {
+	return `Usage: vc docker-credential <get|store|erase|list>
+
+Implements the Docker credential helper protocol, storing registry credentials
+in Vault. The server URL (for get and erase) or the credentials (for store)
+are read from stdin. Install (or link) vc as ` + DockerCredentialHelper + ` and
+add "credsStore": "vc" to ~/.docker/config.json to use it.
+
+Credentials are stored in the secret at the path template configured with
+docker_credentials (default ` + DefaultDockerCredentials + `).
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *DockerCredentialCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) != 0 {
+		return Help
+	}
+	if cmd.template == "" {
+		if config, err := cmd.Config(); err != nil {
+			cmd.ui.Output(err.Error())
+			return ClientError
+		} else if cmd.template = config.DockerCredentials; cmd.template == "" {
+			cmd.template = DefaultDockerCredentials
+		}
+	}
+
+	// The Docker CLI reads errors from stdout
+	var (
+		path  string
+		creds dockerCredentials
+		err   error
+	)
+	switch cmd.sub {
+	case "get", "erase":
+		path, err = cmd.path()
+	case "store":
+		if err = json.NewDecoder(cmd.in).Decode(&creds); err != nil {
+			err = fmt.Errorf("invalid credentials: %v", err)
+		} else {
+			path, err = cmd.serverPath(creds.ServerURL)
+		}
+	}
+	if err != nil {
+		cmd.ui.Output(err.Error())
+		return SyntaxError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Output(err.Error())
+		return ClientError
+	}
+
+	if err = cmd.run(client, path, creds); err != nil {
+		if ErrorKind(err) == ErrNotFound {
+			cmd.ui.Output(dockerCredentialsNotFound)
+		} else {
+			cmd.ui.Output(err.Error())
+		}
+		return exitCode(err, ServerError)
+	}
+	return Success
+}
+
+// run the action for the secret at path
+func (cmd *DockerCredentialCommand) run(client *Client, path string, creds dockerCredentials) error {
+	switch cmd.sub {
+	case "get":
+		secret, err := client.ReadSecret(path)
+		if err != nil {
+			return err
+		} else if secret == nil {
+			return notFound(path + ": secret not found")
+		}
+		creds.ServerURL = cmd.server
+		creds.Username, _ = secret.Data[dockerUsernameKey].(string)
+		creds.Secret, _ = secret.Data[dockerSecretKey].(string)
+		return cmd.output(creds)
+
+	case "store":
+		return cmd.writeSecret(client, path, map[string]interface{}{
+			dockerServerURLKey: creds.ServerURL,
+			dockerUsernameKey:  creds.Username,
+			dockerSecretKey:    creds.Secret,
+		})
+
+	case "erase":
+		if secret, err := client.ReadSecret(path); err != nil {
+			return err
+		} else if secret == nil {
+			return notFound(path + ": secret not found")
+		}
+		return cmd.deleteSecret(client, path)
+
+	case "list":
+		paths, err := client.walk(templateRoot(cmd.template))
+		if err != nil && ErrorKind(err) != ErrNotFound {
+			return err
+		}
+		sort.Strings(paths)
+
+		list := make(map[string]string)
+		for _, path := range paths {
+			secret, err := client.ReadSecret(path)
+			if err != nil {
+				return err
+			} else if secret == nil {
+				continue
+			}
+			// Only secrets stored by us have the server URL
+			if server, ok := secret.Data[dockerServerURLKey].(string); ok {
+				list[server], _ = secret.Data[dockerUsernameKey].(string)
+			}
+		}
+		return cmd.output(list)
+	}
+	return fmt.Errorf("unsupported action %q", cmd.sub)
+}
+
+// path reads the server URL from stdin and returns the path of its secret
+func (cmd *DockerCredentialCommand) path() (string, error) {
+	line, err := bufio.NewReader(cmd.in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if cmd.server = strings.TrimSpace(line); cmd.server == "" {
+		return "", errors.New("no server URL")
+	}
+	return cmd.serverPath(cmd.server)
+}
+
+// serverPath returns the path of the secret for the registry server URL
+func (cmd *DockerCredentialCommand) serverPath(server string) (string, error) {
+	vars, err := dockerServerVars(server)
+	if err != nil {
+		return "", err
+	}
+	return expandTemplate(cmd.template, vars), nil
+}
+
+func (cmd *DockerCredentialCommand) output(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	cmd.ui.Output(string(b))
+	return nil
+}
+
+func (cmd *DockerCredentialCommand) Synopsis() string {
+	return cmd.sub + " registry credentials (Docker credential helper)"
+}
+
+func DockerCredentialCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &DockerCredentialCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+			in:  os.Stdin,
+		}
+
+		cmd.fs = flag.NewFlagSet("docker-credential "+sub, flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.template, "path", "", "path template (default: from config, or "+DefaultDockerCredentials+")")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,42 @@
+package vc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDockerCredentialPath(t *testing.T) {
+	tests := []struct {
+		Template string
+		Server   string
+		Want     string
+	}{
+		{DefaultDockerCredentials, "ghcr.io", "secret/docker/ghcr.io"},
+		{DefaultDockerCredentials, "https://index.docker.io/v1/", "secret/docker/index.docker.io"},
+		{"secret/registry/{host}/{path}", "https://registry.example.com:5000/v2/", "secret/registry/registry.example.com:5000/v2"},
+	}
+	for _, test := range tests {
+		cmd := &DockerCredentialCommand{
+			template: test.Template,
+			in:       strings.NewReader(test.Server + "\n"),
+		}
+		path, err := cmd.path()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != test.Want {
+			t.Fatalf("path for %q: expected %q, got %q", test.Server, test.Want, path)
+		}
+		if cmd.server != test.Server {
+			t.Fatalf("expected server %q, got %q", test.Server, cmd.server)
+		}
+	}
+
+	cmd := &DockerCredentialCommand{
+		template: DefaultDockerCredentials,
+		in:       strings.NewReader("\n"),
+	}
+	if _, err := cmd.path(); err == nil {
+		t.Fatal("expected error for empty server URL")
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
 	yaml "gopkg.in/yaml.v2"
@@ -44,7 +43,7 @@ func (cmd *EditCommand) Run(args []string) int {
 	if err := cmd.fs.Parse(args); err != nil {
 		return 1
 	}
-	if args = cmd.fs.Args(); len(args) != 1 {
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) != 1 {
 		return cli.RunResultHelp
 	}
 
@@ -55,19 +54,33 @@ func (cmd *EditCommand) Run(args []string) int {
 	}
 
 	var (
-		name   string
-		exists bool
+		name    string
+		exists  bool
+		version int
 	)
-	if name, exists, err = cmd.readSecret(client, args[0]); err != nil {
+	if name, exists, version, err = cmd.readSecret(client, args[0]); err != nil {
 		cmd.ui.Error(err.Error())
-		return 1
+		return exitCode(err, 1)
 	}
 	defer os.Remove(name)
 
 	var data map[string]interface{}
-	if data, err = cmd.editSecret(name); err != nil {
+	for {
+		if data, err = cmd.editSecret(name); err != nil {
+			cmd.ui.Error(err.Error())
+			return 1
+		}
+		if len(data) == 0 {
+			break
+		}
+		// Invalid data is edited again, as are YAML errors
+		if err = cmd.validateWrite(client, args[0], data); ErrorKind(err) != ErrSchema {
+			break
+		}
 		cmd.ui.Error(err.Error())
-		return 1
+		if !confirm("edit again?") {
+			return SchemaError
+		}
 	}
 
 	if len(data) == 0 {
@@ -75,17 +88,29 @@ func (cmd *EditCommand) Run(args []string) int {
 			cmd.ui.Warn("no data was saved")
 			return 0
 		}
-		if _, err = client.Logical().Delete(strings.TrimLeft(args[0], "/")); err != nil {
+		var ok bool
+		if ok, err = cmd.confirmChanges(false, nil, "all content was removed, remove secret at %s?", args[0]); err != nil {
 			cmd.ui.Error(err.Error())
 			return 1
+		} else if !ok {
+			cmd.ui.Warn("secret was not removed")
+			return 0
+		}
+		if err = cmd.deleteSecret(client, args[0]); err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, 1)
 		}
 		cmd.ui.Info(fmt.Sprintf("secret at %s removed", args[0]))
 		return 0
 	}
 
-	if _, err = client.Logical().Write(strings.TrimLeft(args[0], "/"), data); err != nil {
-		cmd.ui.Error(err.Error())
-		return 1
+	if err = cmd.writeUpdate(client, args[0], data, version); err != nil {
+		if ErrorKind(err) == ErrVersionConflict {
+			cmd.ui.Error(fmt.Sprintf("error: secret at %s was changed while editing, not saved", args[0]))
+		} else {
+			cmd.ui.Error(err.Error())
+		}
+		return exitCode(err, 1)
 	}
 
 	cmd.ui.Info(fmt.Sprintf("secret at %s saved", args[0]))
@@ -129,10 +154,11 @@ again:
 	return
 }
 
-// readSecret loads a secret, marshals it to YaML and saves it to a temporary file
-func (cmd *EditCommand) readSecret(client *Client, path string) (name string, exists bool, err error) {
+// readSecret loads a secret, marshals it to YaML and saves it to a temporary
+// file; for KV v2 the version that was read is returned, see readForUpdate
+func (cmd *EditCommand) readSecret(client *Client, path string) (name string, exists bool, version int, err error) {
 	var secret *api.Secret
-	if secret, err = client.Logical().Read(strings.TrimLeft(path, "/")); err != nil {
+	if secret, version, err = cmd.readForUpdate(client, path); err != nil {
 		return
 	}
 
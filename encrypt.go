@@ -0,0 +1,138 @@
+package vc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// EncryptTo lists the recipients that output is encrypted to; age recipients
+// (age1..., or SSH public keys) are encrypted with age, others (key IDs,
+// fingerprints or email addresses) with gpg
+var EncryptTo []string
+
+// Encryption tools, variables so they can be replaced
+var (
+	ageCommand = "age"
+	gpgCommand = "gpg"
+)
+
+// isAgeRecipient checks if recipient is an age recipient
+func isAgeRecipient(recipient string) bool {
+	return strings.HasPrefix(recipient, "age1") || strings.HasPrefix(recipient, "ssh-")
+}
+
+// encryptCommand returns the command line that encrypts stdin to recipients,
+// with ASCII armored output on stdout
+func encryptCommand(recipients []string) ([]string, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	age := isAgeRecipient(recipients[0])
+	for _, recipient := range recipients[1:] {
+		if isAgeRecipient(recipient) != age {
+			return nil, errors.New("recipients can't mix age and OpenPGP")
+		}
+	}
+
+	if age {
+		args := []string{ageCommand, "--armor"}
+		for _, recipient := range recipients {
+			args = append(args, "--recipient", recipient)
+		}
+		return args, nil
+	}
+	args := []string{gpgCommand, "--batch", "--yes", "--armor", "--encrypt"}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+	return args, nil
+}
+
+// EncryptingOutputWriter implements a io.WriteCloser that encrypts the data
+// written to it for recipients, and writes the result to w. The encryption
+// tool is started on the first write; closing waits for it to finish and
+// closes w, unless it is stdout or stderr.
+func EncryptingOutputWriter(w io.WriteCloser, recipients []string) io.WriteCloser {
+	return &encryptingOutputWriter{
+		out:        w,
+		recipients: recipients,
+	}
+}
+
+type encryptingOutputWriter struct {
+	out        io.WriteCloser
+	recipients []string
+	mutex      sync.Mutex
+	cmd        *exec.Cmd
+	in         io.WriteCloser
+	stderr     bytes.Buffer
+}
+
+func (w *encryptingOutputWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.cmd == nil {
+		args, err := encryptCommand(w.recipients)
+		if err != nil {
+			return 0, fmt.Errorf("encrypt: %v", err)
+		}
+		Debugf("writer: encrypting with %s", strings.Join(args, " "))
+		w.cmd = exec.Command(args[0], args[1:]...)
+		w.cmd.Stdout = w.out
+		w.cmd.Stderr = &w.stderr
+		if w.in, err = w.cmd.StdinPipe(); err != nil {
+			return 0, err
+		}
+		if err = w.cmd.Start(); err != nil {
+			return 0, fmt.Errorf("encrypt: %v", err)
+		}
+	}
+	return w.in.Write(p)
+}
+
+// abort stops the encryption tool and discards the output file
+func (w *encryptingOutputWriter) abort() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.cmd != nil {
+		w.in.Close()
+		w.cmd.Process.Kill()
+		w.cmd.Wait()
+		w.cmd = nil
+	}
+	if sw, ok := w.out.(*safeOutputWriter); ok {
+		sw.abort()
+	}
+}
+
+func (w *encryptingOutputWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.cmd != nil {
+		w.in.Close()
+		if err := w.cmd.Wait(); err != nil {
+			if msg := strings.TrimSpace(w.stderr.String()); msg != "" {
+				err = errors.New(msg)
+			}
+			// Don't leave a partially encrypted file behind
+			if sw, ok := w.out.(*safeOutputWriter); ok {
+				sw.abort()
+			}
+			return fmt.Errorf("encrypt: %v", err)
+		}
+		w.cmd = nil
+	}
+	if w.out == os.Stdout || w.out == os.Stderr {
+		return nil
+	}
+	return w.out.Close()
+}
@@ -0,0 +1,75 @@
+package vc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEncryptCommand(t *testing.T) {
+	args, err := encryptCommand([]string{"age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p", "ssh-ed25519 AAAA test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{ageCommand, "--armor", "--recipient", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p", "--recipient", "ssh-ed25519 AAAA test"}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("expected %q, got %q", want, args)
+	}
+
+	if args, err = encryptCommand([]string{"ops@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{gpgCommand, "--batch", "--yes", "--armor", "--encrypt", "--recipient", "ops@example.org"}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("expected %q, got %q", want, args)
+	}
+
+	if _, err = encryptCommand([]string{"age1test", "ops@example.org"}); err == nil {
+		t.Fatal("expected error for mixed recipients")
+	}
+	if _, err = encryptCommand(nil); err == nil {
+		t.Fatal("expected error for no recipients")
+	}
+}
+
+func TestEncryptingOutputWriter(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "encrypt")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake age that "encrypts" by prefixing its input, or fails for "fail"
+	script := filepath.Join(dir, "age")
+	if err = ioutil.WriteFile(script, []byte("#!/bin/sh\nif [ \"$3\" = age1fail ]; then echo partial; echo 'no identity' >&2; exit 1; fi\necho encrypted\ncat\n"), 0755); err != nil {
+		t.Skip(err)
+	}
+	defer func(saved string) { ageCommand = saved }(ageCommand)
+	ageCommand = script
+
+	name := filepath.Join(dir, "out")
+	w := EncryptingOutputWriter(SafeOutputWriter(name, 0600), []string{"age1test"})
+	if _, err = w.Write([]byte("secret\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(name); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "encrypted\nsecret\n" {
+		t.Fatalf("unexpected output %q", b)
+	}
+
+	name = filepath.Join(dir, "failed")
+	w = EncryptingOutputWriter(SafeOutputWriter(name, 0600), []string{"age1fail"})
+	w.Write([]byte("secret\n"))
+	if err = w.Close(); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("expected %s not to exist, got %v", name, err)
+	}
+}
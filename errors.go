@@ -0,0 +1,57 @@
+package vc
+
+import (
+	"errors"
+
+	"github.com/tehmaze/vc/client"
+)
+
+// Errors returned by the client, see Error
+var (
+	ErrNotFound         = client.ErrNotFound
+	ErrPermissionDenied = client.ErrPermissionDenied
+	ErrSealed           = client.ErrSealed
+	ErrVersionConflict  = client.ErrVersionConflict
+	ErrUnavailable      = client.ErrUnavailable
+	ErrReadOnly         = client.ErrReadOnly
+)
+
+// Error is an error of a known kind, such as ErrNotFound; see client.Error
+type Error = client.Error
+
+// ErrorKind returns the kind of error, or nil for errors of an unknown kind;
+// see client.ErrorKind
+func ErrorKind(err error) error {
+	return client.ErrorKind(err)
+}
+
+// notFound returns an ErrNotFound error with a message
+func notFound(message string) error {
+	return &Error{Kind: ErrNotFound, Err: errors.New(message)}
+}
+
+// classifyError determines the kind of error for errors returned by the Vault
+// API; errors of an unknown kind are returned as-is
+func classifyError(err error) error {
+	return client.Classify(err)
+}
+
+// exitCode maps an error to the return code of a command, errors of an
+// unknown kind result in fallback
+func exitCode(err error, fallback int) int {
+	switch ErrorKind(err) {
+	case ErrNotFound:
+		return NotFoundError
+	case ErrPermissionDenied, ErrReadOnly:
+		return PermissionError
+	case ErrSealed:
+		return SealedError
+	case ErrVersionConflict:
+		return ConflictError
+	case ErrUnavailable:
+		return ServerError
+	case ErrSchema:
+		return SchemaError
+	}
+	return fallback
+}
@@ -0,0 +1,51 @@
+package vc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+type testWrappedError struct {
+	err error
+}
+
+func (err testWrappedError) Error() string { return "wrapped: " + err.err.Error() }
+func (err testWrappedError) Unwrap() error { return err.err }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		Err  error
+		Want error
+		Code int
+	}{
+		{nil, nil, Success},
+		{errors.New("test"), nil, ServerError},
+		{&api.ResponseError{StatusCode: http.StatusNotFound}, ErrNotFound, NotFoundError},
+		{&api.ResponseError{StatusCode: http.StatusForbidden, Errors: []string{"1 error occurred:\n\t* permission denied"}}, ErrPermissionDenied, PermissionError},
+		{&api.ResponseError{StatusCode: http.StatusServiceUnavailable, Errors: []string{"Vault is sealed"}}, ErrSealed, SealedError},
+		{&api.ResponseError{StatusCode: http.StatusBadRequest, Errors: []string{"check-and-set parameter did not match the current version"}}, ErrVersionConflict, ConflictError},
+		{fmt.Errorf("Error making API request.\n\nCode: 403. Errors:\n\n* permission denied"), ErrPermissionDenied, PermissionError},
+		{testWrappedError{notFound("secret test: not found")}, ErrNotFound, NotFoundError},
+		{ErrSealed, ErrSealed, SealedError},
+	}
+
+	for _, test := range tests {
+		err := classifyError(test.Err)
+		if kind := ErrorKind(err); kind != test.Want {
+			t.Fatalf("classifyError(%v): expected kind %v, got %v", test.Err, test.Want, kind)
+		}
+		if test.Err == nil {
+			continue
+		}
+		if code := exitCode(err, ServerError); code != test.Code {
+			t.Fatalf("exitCode(%v): expected %d, got %d", test.Err, test.Code, code)
+		}
+		if err.Error() != test.Err.Error() {
+			t.Fatalf("classifyError(%v): changed message to %q", test.Err, err)
+		}
+	}
+}
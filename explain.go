@@ -0,0 +1,177 @@
+package vc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tehmaze/vc/client"
+)
+
+// Explain explains permission errors: the policies of the token, its
+// capabilities on the denied path, and the capability that is missing
+var Explain bool
+
+// explainCapabilities are the capabilities that operations need
+var explainCapabilities = map[string][]string{
+	"read":   {"read"},
+	"write":  {"create", "update"},
+	"delete": {"delete"},
+	"list":   {"list"},
+}
+
+// explained are the denied requests that were explained, so they are explained
+// once
+var explained = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: make(map[string]bool)}
+
+var (
+	explainPathRule         = regexp.MustCompile(`(?s)path\s+"([^"]+)"\s*\{(.*?)\}`)
+	explainCapabilitiesRule = regexp.MustCompile(`capabilities\s*=\s*\[([^\]]*)\]`)
+)
+
+// explainRule is a path rule of a policy
+type explainRule struct {
+	Pattern      string
+	Capabilities []string
+}
+
+// explainDenied explains why the token was denied operation on path, on
+// stderr
+func explainDenied(c *client.Client, operation, path string) {
+	path = strings.TrimLeft(path, "/")
+	explained.Lock()
+	key := operation + " " + path
+	if explained.seen[key] {
+		explained.Unlock()
+		return
+	}
+	explained.seen[key] = true
+	explained.Unlock()
+
+	for _, line := range explainPermission(c, operation, path) {
+		fmt.Fprintln(os.Stderr, "explain: "+line)
+	}
+}
+
+// explainPermission returns the lines explaining why the token was denied
+// operation on path; lookups that are denied themselves are reported
+func explainPermission(c *client.Client, operation, path string) []string {
+	needed, ok := explainCapabilities[operation]
+	if !ok {
+		needed = []string{operation}
+	}
+	lines := []string{fmt.Sprintf("%s %s needs the %s capability", operation, path, strings.Join(needed, " or "))}
+
+	if capabilities, err := c.Sys().CapabilitiesSelf(path); err != nil {
+		lines = append(lines, fmt.Sprintf("unable to look up the capabilities of the token: %v", explainError(err)))
+	} else {
+		lines = append(lines, fmt.Sprintf("the token has %s on %s", explainList(capabilities), path))
+	}
+
+	secret, err := c.Auth().Token().LookupSelf()
+	if err != nil {
+		lines = append(lines, fmt.Sprintf("unable to look up the token: %v", explainError(err)))
+		return append(lines, explainSuggestion(path, needed))
+	}
+	// TokenPolicies includes the policies of the identity of the token
+	policies, _ := secret.TokenPolicies()
+	sort.Strings(policies)
+	lines = append(lines, fmt.Sprintf("the policies of the token are %s", explainList(policies)))
+
+	for _, name := range policies {
+		if name == "root" {
+			continue
+		}
+		rules, err := c.Sys().GetPolicy(name)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("policy %s: unable to read it: %v", name, explainError(err)))
+			continue
+		}
+		var matched bool
+		for _, rule := range explainRules(rules) {
+			if explainMatch(rule.Pattern, path) {
+				matched = true
+				lines = append(lines, fmt.Sprintf("policy %s: path %q has %s", name, rule.Pattern, explainList(rule.Capabilities)))
+			}
+		}
+		if !matched {
+			lines = append(lines, fmt.Sprintf("policy %s: no rules for %s", name, path))
+		}
+	}
+	return append(lines, explainSuggestion(path, needed))
+}
+
+// explainSuggestion returns the rule a policy needs for the operation
+func explainSuggestion(path string, needed []string) string {
+	return fmt.Sprintf("a policy of the token needs: path %q { capabilities = [%q] }", path, needed[0])
+}
+
+// explainError returns the error messages of the Vault response of err, on
+// one line
+func explainError(err error) string {
+	message := err.Error()
+	if _, errs := client.ErrorDetails(err); len(errs) > 0 {
+		message = strings.Join(errs, "; ")
+	}
+	return strings.Join(strings.Fields(message), " ")
+}
+
+// explainList formats the list of names, or none
+func explainList(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// explainRules returns the path rules of the policy, in HCL or JSON
+func explainRules(policy string) []explainRule {
+	var rules []explainRule
+	var parsed struct {
+		Path map[string]struct {
+			Capabilities []string `json:"capabilities"`
+		} `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(policy), &parsed); err == nil {
+		for pattern, rule := range parsed.Path {
+			rules = append(rules, explainRule{Pattern: pattern, Capabilities: rule.Capabilities})
+		}
+		sort.Slice(rules, func(i, j int) bool { return rules[i].Pattern < rules[j].Pattern })
+		return rules
+	}
+
+	// A rule without capabilities, such as one with only the deprecated
+	// policy field, has none
+	for _, match := range explainPathRule.FindAllStringSubmatch(policy, -1) {
+		rule := explainRule{Pattern: match[1]}
+		if caps := explainCapabilitiesRule.FindStringSubmatch(match[2]); caps != nil {
+			for _, capability := range strings.Split(caps[1], ",") {
+				if capability = strings.Trim(strings.TrimSpace(capability), `"`); capability != "" {
+					rule.Capabilities = append(rule.Capabilities, capability)
+				}
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// explainMatch checks if the path pattern of a policy matches path: "+"
+// matches a path segment, and a trailing "*" any suffix
+func explainMatch(pattern, path string) bool {
+	pattern = strings.TrimLeft(pattern, "/")
+	expr := regexp.QuoteMeta(strings.TrimSuffix(pattern, "*"))
+	expr = strings.Replace(expr, `\+`, `[^/]+`, -1)
+	if strings.HasSuffix(pattern, "*") {
+		expr += ".*"
+	}
+	ok, _ := regexp.MatchString("^"+expr+"$", path)
+	return ok
+}
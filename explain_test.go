@@ -0,0 +1,78 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExplainMatch(t *testing.T) {
+	for _, test := range []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"secret/data/app", "secret/data/app", true},
+		{"secret/data/app", "secret/data/app/db", false},
+		{"secret/data/*", "secret/data/app/db", true},
+		{"secret/data/app*", "secret/data/application", true},
+		{"secret/+/app", "secret/data/app", true},
+		{"secret/+/app", "secret/data/x/app", false},
+		{"/secret/data/+/db", "secret/data/app/db", true},
+	} {
+		if got := explainMatch(test.pattern, test.path); got != test.want {
+			t.Errorf("explainMatch(%q, %q): expected %t, got %t", test.pattern, test.path, test.want, got)
+		}
+	}
+}
+
+func TestExplainPermission(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/sys/capabilities-self":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"capabilities":    []string{"list"},
+				"secret/data/app": []string{"list"},
+			}}
+		case "GET /v1/auth/token/lookup-self":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"policies":          []string{"default", "app"},
+				"identity_policies": []string{"team"},
+			}}
+		case "GET /v1/sys/policies/acl/app":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"policy": "path \"secret/data/+\" {\n  capabilities = [\"list\"]\n}\npath \"secret/metadata/*\" {\n  capabilities = [\"read\", \"list\"]\n}\n",
+			}}
+		case "GET /v1/sys/policies/acl/team":
+			w.WriteHeader(http.StatusForbidden)
+			response = map[string]interface{}{"errors": []string{"1 error occurred:\n\t* permission denied\n\n"}}
+		case "GET /v1/sys/policies/acl/default":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"policy": `{"path": {"auth/token/lookup-self": {"capabilities": ["read"]}}}`,
+			}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), nil)
+
+	got := strings.Join(explainPermission(&c.Client, "read", "secret/data/app"), "\n")
+	for _, want := range []string{
+		"read secret/data/app needs the read capability",
+		"the token has [list] on secret/data/app",
+		"the policies of the token are [app, default, team]",
+		`policy app: path "secret/data/+" has [list]`,
+		"policy default: no rules for secret/data/app",
+		"policy team: unable to read it: 1 error occurred: * permission denied",
+		`a policy of the token needs: path "secret/data/app" { capabilities = ["read"] }`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "secret/metadata") {
+		t.Errorf("expected no rules for other paths in:\n%s", got)
+	}
+}
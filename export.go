@@ -0,0 +1,207 @@
+package vc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// exportRecord is a secret in an export, one per line
+type exportRecord struct {
+	Path string                 `json:"path"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// exportHasher replaces values with their hash, see ExportCommand
+type exportHasher struct {
+	key []byte
+}
+
+// hash returns the hash of the canonical JSON encoding of value, so values of
+// different types (such as "1" and 1) have different hashes
+func (h *exportHasher) hash(value interface{}) (string, error) {
+	b, err := exportMarshal(value)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(b)
+	var (
+		prefix = "sha256:"
+		mac    hash.Hash
+	)
+	if h.key != nil {
+		prefix, mac = "hmac-sha256:", hmac.New(sha256.New, h.key)
+	} else {
+		mac = sha256.New()
+	}
+	mac.Write(b)
+	return prefix + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// exportMarshal returns the canonical JSON encoding of v: object keys sorted,
+// no HTML escaping and no indentation; numbers are encoded as Vault returned
+// them
+func exportMarshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// ExportCommand exports secrets in a canonical format, for diffing between
+// clusters
+type ExportCommand struct {
+	baseCommand
+	fs      *flag.FlagSet
+	hash    bool
+	hashKey string
+}
+
+func (cmd *ExportCommand) Help() string {
+	return `Usage: vc export [<options>] <path> [... <path>]
+
+Export the secrets at the paths, and below directories, in a canonical format
+that can be diffed: one JSON object per line with the path of the secret,
+relative to the path given, and its data, sorted by path, with the keys of the
+data sorted and no insignificant whitespace. Exports of the same secrets from
+two Vault clusters, even at different mounts, are identical.
+
+With -hash, values are replaced by the SHA-256 hash of their JSON encoding, so
+exports can be compared without plaintext values. Passwords can be guessed from
+their plain hash; with -hash-key, values are hashed with HMAC-SHA256 and the
+key in the file, which should be the same for both exports and be kept secret.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *ExportCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) == 0 {
+		return Help
+	}
+
+	var hasher *exportHasher
+	if cmd.hash || cmd.hashKey != "" {
+		hasher = new(exportHasher)
+	}
+	if cmd.hashKey != "" {
+		key, err := readSecretFile(cmd.hashKey)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: -hash-key: %v", err))
+			return SyntaxError
+		}
+		defer key.Wipe()
+		if hasher.key = bytes.TrimSpace(key.Bytes()); len(hasher.key) == 0 {
+			cmd.ui.Error("error: -hash-key: empty key")
+			return SyntaxError
+		}
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	if cmd.mode, err = cmd.outputMode(cmd.fs, DefaultOutputMode); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+
+	for _, root := range args {
+		paths, err := client.secretsBelow(root)
+		if err != nil {
+			cmd.abort()
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return exitCode(err, ServerError)
+		}
+		prefix := strings.Trim(client.Abs(root), "/") + "/"
+		for _, path := range paths {
+			path = strings.TrimLeft(path, "/")
+			if err = cmd.export(client, hasher, path, prefix); err != nil {
+				cmd.abort()
+				cmd.ui.Error(fmt.Sprintf("error: %s: %v", path, err))
+				return exitCode(err, ServerError)
+			}
+		}
+	}
+	if cmd.w == nil {
+		// Nothing to export, create an empty export
+		if err = cmd.writerOpen(); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	}
+	if err = cmd.Close(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	return Success
+}
+
+// export writes the record of the secret at path; paths are relative to
+// prefix, a secret given as path is exported with its name
+func (cmd *ExportCommand) export(client *Client, hasher *exportHasher, path, prefix string) error {
+	secret, err := client.ReadSecret(path)
+	if err != nil || secret == nil {
+		return err
+	}
+	record := exportRecord{Path: strings.TrimPrefix(path, prefix), Data: secret.Data}
+	if !strings.HasPrefix(path, prefix) {
+		record.Path = filepath.Base(path)
+	}
+	if hasher != nil {
+		record.Data = make(map[string]interface{}, len(secret.Data))
+		for key, value := range secret.Data {
+			if record.Data[key], err = hasher.hash(value); err != nil {
+				return err
+			}
+		}
+	}
+	b, err := exportMarshal(record)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	defer wipe(b)
+	_, err = cmd.Write(b)
+	return err
+}
+
+func (cmd *ExportCommand) Synopsis() string {
+	return "export secrets in a canonical format, for diffing"
+}
+
+func ExportCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &ExportCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("export", flag.ContinueOnError)
+		cmd.fs.BoolVar(&cmd.hash, "hash", false, "replace values with their SHA-256 hash")
+		cmd.fs.StringVar(&cmd.hashKey, "hash-key", "", "file with the key to hash values with HMAC-SHA256 (implies -hash)")
+		cmd.fs.StringVar(&cmd.out, "o", "", "output (default: stdout)")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
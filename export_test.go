@@ -0,0 +1,95 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestExportCommand(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "export")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The same secrets at mounts with another KV version, and with the keys
+	// in another order
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		request := r.Method + " " + r.URL.Path
+		if r.URL.Query().Get("list") == "true" {
+			request = "LIST " + r.URL.Path
+		}
+		switch request {
+		case "LIST /v1/kv/metadata/app", "LIST /v1/kv/metadata/app/":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"web", "db"}}}
+		case "GET /v1/kv/data/app/db":
+			response = json.RawMessage(`{"data": {"data": {"user": "app", "password": "<secret>", "port": 5432}, "metadata": {"version": 2}}}`)
+		case "GET /v1/kv/data/app/web":
+			response = json.RawMessage(`{"data": {"data": {"key": "k"}, "metadata": {"version": 1}}}`)
+		case "GET /v1/old/app":
+			w.WriteHeader(http.StatusForbidden)
+			response = map[string]interface{}{"errors": []string{"permission denied"}}
+		case "LIST /v1/old/app", "LIST /v1/old/app/":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"db", "web"}}}
+		case "GET /v1/old/app/db":
+			response = json.RawMessage(`{"data": {"port": 5432, "password": "<secret>", "user": "app"}}`)
+		case "GET /v1/old/app/web":
+			response = json.RawMessage(`{"data": {"key": "k"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"kv/": "kv-v2", "old/": "kv"})
+
+	export := func(args ...string) string {
+		t.Helper()
+		name := filepath.Join(dir, "export.json")
+		ui := cli.NewMockUi()
+		command, _ := ExportCommandFactory(ui)()
+		cmd := command.(*ExportCommand)
+		cmd.c = c
+		if code := cmd.Run(append([]string{"-o", name}, args...)); code != Success {
+			t.Fatalf("%v: expected success, got %d: %s", args, code, ui.ErrorWriter.String())
+		}
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	want := `{"path":"db","data":{"password":"<secret>","port":5432,"user":"app"}}
+{"path":"web","data":{"key":"k"}}
+`
+	for _, root := range []string{"kv/app", "old/app"} {
+		if got := export(root); got != want {
+			t.Fatalf("%s: expected\n%s\ngot\n%s", root, want, got)
+		}
+	}
+
+	hashed := export("-hash", "kv/app")
+	if strings.Contains(hashed, "<secret>") || !strings.Contains(hashed, `"password":"sha256:`) {
+		t.Fatalf("expected hashed values, got\n%s", hashed)
+	}
+	if other := export("-hash", "old/app"); other != hashed {
+		t.Fatalf("expected the same hashes, got\n%s\nand\n%s", hashed, other)
+	}
+
+	key := filepath.Join(dir, "key")
+	if err = ioutil.WriteFile(key, []byte("shared key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyed := export("-hash-key", key, "kv/app")
+	if !strings.Contains(keyed, `"password":"hmac-sha256:`) || keyed == hashed {
+		t.Fatalf("expected HMAC values, got\n%s", keyed)
+	}
+}
@@ -1,15 +1,12 @@
 package vc
 
 import (
-	"bytes"
 	"encoding/base64"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"strconv"
-	"strings"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/mitchellh/cli"
@@ -44,6 +41,7 @@ func (cmd *FileCommand) Run(args []string) int {
 	if len(args) == 1 {
 		args = append(args, "-")
 	}
+	args[0] = cmd.resolve(args[0])
 
 	var err error
 	switch cmd.sub {
@@ -57,7 +55,7 @@ func (cmd *FileCommand) Run(args []string) int {
 
 	if err != nil {
 		cmd.ui.Error(err.Error())
-		return 1
+		return exitCode(err, 1)
 	}
 
 	return 0
@@ -67,11 +65,9 @@ func (cmd *FileCommand) Run(args []string) int {
 func (cmd *FileCommand) runGet(path, name string) (err error) {
 	if !cmd.force && name != "" && name != "-" {
 		if _, infoErr := os.Stat(name); infoErr == nil {
-			if !IsTerminal(os.Stdout.Fd()) {
-				return fmt.Errorf("%s: already exists", name)
-			}
-			if !confirmf("%s: already exists, overwrite?", name) {
-				return nil
+			var ok bool
+			if ok, err = cmd.confirmChanges(false, nil, "%s: already exists, overwrite?", name); !ok {
+				return
 			}
 		}
 	}
@@ -88,14 +84,14 @@ func (cmd *FileCommand) runGet(path, name string) (err error) {
 	}
 
 	var secret *api.Secret
-	if secret, err = client.Logical().Read(strings.TrimLeft(path, "/")); err != nil {
+	if secret, err = client.Read(path); err != nil {
 		return
 	}
 	if secret == nil {
 		if cmd.ignoreMissing {
 			return nil
 		}
-		return fmt.Errorf("no secret at %q", path)
+		return notFound(fmt.Sprintf("no secret at %q", path))
 	}
 
 	kind, ok := secret.Data["__TYPE__"].(string)
@@ -110,30 +106,27 @@ func (cmd *FileCommand) runGet(path, name string) (err error) {
 		return fmt.Errorf("secret at %q has no content", path)
 	}
 
-	var data []byte
-	if data, err = base64.StdEncoding.DecodeString(contents); err != nil {
+	// Large files are decoded as they are written
+	cmd.out = name
+	if _, err = io.Copy(cmd, Base64Reader(contents)); err != nil {
+		cmd.abort()
 		return
 	}
-
-	if name == "" || name == "-" {
-		_, err = os.Stdout.Write(data)
-	} else {
-		err = ioutil.WriteFile(name, data, cmd.mode)
-	}
+	err = cmd.Close()
 
 	return
 }
 
 // runPut puts a file in Vault
 func (cmd *FileCommand) runPut(path, name string) (err error) {
-	var b []byte
-	if name == "" || name == "-" {
-		if b, err = ioutil.ReadAll(os.Stdin); err != nil {
-			return
-		}
-	} else if b, err = ioutil.ReadFile(name); err != nil {
+	if name == "" {
+		name = "-"
+	}
+	var in *secureBuffer
+	if in, err = readSecretFile(name); err != nil {
 		return
 	}
+	defer in.Wipe()
 
 	var client *Client
 	if client, err = cmd.Client(); err != nil {
@@ -141,30 +134,33 @@ func (cmd *FileCommand) runPut(path, name string) (err error) {
 	}
 
 	if !cmd.force {
-		if secret, _ := client.Logical().Read(strings.TrimLeft(path, "/")); secret != nil {
-			if !IsTerminal(os.Stdout.Fd()) || name == "" || name == "-" {
+		if secret, _ := client.Read(path); secret != nil {
+			if name == "-" && !assumeYes() {
+				// We can't prompt, stdin is used for reading the file
 				return fmt.Errorf("secret at %q already exists", path)
 			}
-			if !confirmf("secret at %s already exists, overwrite?", path) {
-				return nil
+			var ok bool
+			if ok, err = cmd.confirmChanges(false, []string{"~ contents"}, "secret at %s already exists, overwrite?", path); !ok {
+				return
 			}
 		}
 	}
 
-	out := new(bytes.Buffer)
+	out := new(secureBuffer)
+	defer out.Wipe()
 	var breaker lineBreaker
 	breaker.out = out
 
 	b64 := base64.NewEncoder(base64.StdEncoding, &breaker)
-	if _, err = b64.Write(b); err != nil {
+	if _, err = b64.Write(in.Bytes()); err != nil {
 		return err
 	}
 	b64.Close()
 	breaker.Close()
 
-	_, err = client.Logical().Write(strings.TrimLeft(path, "/"), map[string]interface{}{
+	err = cmd.writeSecret(client, path, map[string]interface{}{
 		CodecTypeKey: "file",
-		"contents":   out.String(),
+		"contents":   string(out.Bytes()),
 	})
 
 	return
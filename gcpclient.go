@@ -0,0 +1,274 @@
+package vc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Google Cloud endpoints
+const (
+	gcpTokenURL    = "https://oauth2.googleapis.com/token"
+	gcpMetadataURL = "http://metadata.google.internal/computeMetadata/v1/"
+	gcpScope       = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// gcpCredentials is a credentials file, either a service account key or the
+// application default credentials of a user (gcloud auth application-default
+// login)
+type gcpCredentials struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// gcpClient talks to Google Cloud APIs
+type gcpClient struct {
+	project string
+	token   string
+	client  *http.Client
+}
+
+// gcpCredentialsFile returns the name of the application default credentials
+func gcpCredentialsFile() string {
+	if name := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); name != "" {
+		return name
+	}
+	return os.ExpandEnv("$HOME/.config/gcloud/application_default_credentials.json")
+}
+
+// newGCPClient obtains an access token from $GOOGLE_OAUTH_ACCESS_TOKEN, the
+// application default credentials or the metadata server, in that order. The
+// project defaults to $GOOGLE_CLOUD_PROJECT or the project of the credentials.
+func newGCPClient(project string) (*gcpClient, error) {
+	c := &gcpClient{
+		project: project,
+		token:   os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+	if c.project == "" {
+		c.project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+
+	if c.token == "" {
+		b, err := ioutil.ReadFile(gcpCredentialsFile())
+		if err == nil {
+			var creds gcpCredentials
+			if err = json.Unmarshal(b, &creds); err != nil {
+				return nil, fmt.Errorf("gcp: %s: %v", gcpCredentialsFile(), err)
+			}
+			if c.token, err = c.exchange(creds); err != nil {
+				return nil, fmt.Errorf("gcp: %v", err)
+			}
+			if c.project == "" {
+				c.project = creds.ProjectID
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("gcp: %v", err)
+		} else if c.token, err = c.metadataToken(); err != nil {
+			return nil, fmt.Errorf("gcp: no credentials found: %v", err)
+		}
+	}
+
+	if c.project == "" {
+		if b, err := c.metadata("project/project-id"); err == nil {
+			c.project = string(b)
+		}
+	}
+	if c.project == "" {
+		return nil, errors.New("gcp: no project, use -project or set GOOGLE_CLOUD_PROJECT")
+	}
+	return c, nil
+}
+
+// exchange obtains an access token using the credentials
+func (c *gcpClient) exchange(creds gcpCredentials) (string, error) {
+	form := url.Values{}
+	switch creds.Type {
+	case "service_account":
+		assertion, err := gcpAssertion(creds, time.Now())
+		if err != nil {
+			return "", err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+	default:
+		return "", fmt.Errorf("unsupported credentials type %q", creds.Type)
+	}
+
+	tokenURL := creds.TokenURI
+	if tokenURL == "" {
+		tokenURL = gcpTokenURL
+	}
+	res, err := c.client.PostForm(tokenURL, form)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("token: %s: %v", res.Status, err)
+	}
+	if token.AccessToken == "" {
+		return "", &Error{Kind: ErrPermissionDenied, Err: fmt.Errorf("token: %s: %s", token.Error, token.ErrorDescription)}
+	}
+	return token.AccessToken, nil
+}
+
+// gcpAssertion returns the signed JWT for a service account, to be exchanged
+// for an access token
+func gcpAssertion(creds gcpCredentials, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", errors.New("service account: no private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("service account: %v", err)
+		}
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("service account: private key is not an RSA key")
+	}
+
+	aud := creds.TokenURI
+	if aud == "" {
+		aud = gcpTokenURL
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   creds.ClientEmail,
+		"scope": gcpScope,
+		"aud":   aud,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	encode := base64.RawURLEncoding.EncodeToString
+	payload := encode(header) + "." + encode(claims)
+	hash := sha256.Sum256([]byte(payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + encode(signature), nil
+}
+
+// metadata fetches path from the metadata server
+func (c *gcpClient) metadata(path string) ([]byte, error) {
+	r, err := http.NewRequest("GET", gcpMetadataURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Metadata-Flavor", "Google")
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata: %s", res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// metadataToken obtains an access token for the service account of the
+// instance we're running on
+func (c *gcpClient) metadataToken() (string, error) {
+	b, err := c.metadata("instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.Unmarshal(b, &token)
+	return token.AccessToken, err
+}
+
+// do sends a request with a JSON body in, and decodes the response into out
+func (c *gcpClient) do(method, u string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	r, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	Debugf("gcp: %s %s", method, u)
+	res, err := c.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode/100 == 2 {
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(b, out)
+	}
+
+	var status struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(b, &status) != nil || status.Error.Message == "" {
+		status.Error.Message = strings.TrimSpace(string(b))
+	}
+	err = fmt.Errorf("gcp: %s: %s", res.Status, status.Error.Message)
+	switch res.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &Error{Kind: ErrPermissionDenied, Err: err}
+	case http.StatusNotFound:
+		return &Error{Kind: ErrNotFound, Err: err}
+	case http.StatusConflict:
+		return &Error{Kind: ErrVersionConflict, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package vc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGCPAssertion(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"unsupported_grant_type"}`)
+			return
+		}
+		parts := strings.Split(r.PostFormValue("assertion"), ".")
+		if len(parts) != 3 {
+			t.Errorf("expected JWT, got %q", r.PostFormValue("assertion"))
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature); err != nil {
+			t.Errorf("invalid signature: %v", err)
+		}
+		b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]interface{}
+		json.Unmarshal(b, &claims)
+		if claims["iss"] != "vc@example.iam.gserviceaccount.com" || claims["scope"] != gcpScope {
+			t.Errorf("unexpected claims %v", claims)
+		}
+		fmt.Fprint(w, `{"access_token":"ya29.test","expires_in":3599}`)
+	}))
+	defer server.Close()
+
+	creds := gcpCredentials{
+		Type:        "service_account",
+		ClientEmail: "vc@example.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:    server.URL,
+	}
+	c := &gcpClient{client: &http.Client{Timeout: 5 * time.Second}}
+	token, err := c.exchange(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "ya29.test" {
+		t.Fatalf("expected token ya29.test, got %q", token)
+	}
+
+	creds.Type = "authorized_user"
+	if _, err = c.exchange(creds); ErrorKind(err) != ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
+
+func TestGCPNames(t *testing.T) {
+	if id := gcpSecretID("/app/prod/db.creds"); id != "app_prod_db_creds" {
+		t.Fatalf("expected app_prod_db_creds, got %q", id)
+	}
+	labels := gcpLabels(map[string]string{"Team": "Payments", "cost.center": "42"})
+	if want := map[string]string{"team": "payments", "cost_center": "42"}; !reflect.DeepEqual(labels, want) {
+		t.Fatalf("expected %v, got %v", want, labels)
+	}
+	if name := ssmName("app/prod/db/"); name != "/app/prod/db" {
+		t.Fatalf("expected /app/prod/db, got %q", name)
+	}
+}
@@ -0,0 +1,85 @@
+package vc
+
+import (
+	"encoding/base64"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// gcpSecretManagerURL is the Secret Manager API endpoint
+var gcpSecretManagerURL = "https://secretmanager.googleapis.com/v1/"
+
+// gcpInvalid matches the characters not allowed in secret IDs and labels
+var gcpInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// gcpSecretID converts a name to a secret ID; the hierarchy is flattened, as
+// in "app_prod_db" for "app/prod/db"
+func gcpSecretID(name string) string {
+	return gcpInvalid.ReplaceAllString(strings.Trim(name, "/"), "_")
+}
+
+// gcpLabels converts tags to labels, which are lowercase
+func gcpLabels(tags map[string]string) map[string]string {
+	labels := make(map[string]string, len(tags))
+	for key, value := range tags {
+		labels[gcpInvalid.ReplaceAllString(strings.ToLower(key), "_")] = gcpInvalid.ReplaceAllString(strings.ToLower(value), "_")
+	}
+	return labels
+}
+
+// gcpSecretManager is the GCP Secret Manager bridge store
+type gcpSecretManager struct {
+	*gcpClient
+}
+
+func newGCPSecretManager(project string) (*gcpSecretManager, error) {
+	client, err := newGCPClient(project)
+	if err != nil {
+		return nil, err
+	}
+	return &gcpSecretManager{client}, nil
+}
+
+func (s *gcpSecretManager) secretURL(name string) string {
+	return gcpSecretManagerURL + "projects/" + url.PathEscape(s.project) + "/secrets/" + gcpSecretID(name)
+}
+
+func (s *gcpSecretManager) Get(name string) (string, error) {
+	var out struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := s.do("GET", s.secretURL(name)+"/versions/latest:access", nil, &out); err != nil {
+		return "", err
+	}
+	b, err := base64.StdEncoding.DecodeString(out.Payload.Data)
+	return string(b), err
+}
+
+func (s *gcpSecretManager) Put(name, value string, tags map[string]string, create bool) error {
+	if create {
+		in := map[string]interface{}{
+			"replication": map[string]interface{}{"automatic": map[string]interface{}{}},
+			"labels":      gcpLabels(tags),
+		}
+		u := gcpSecretManagerURL + "projects/" + url.PathEscape(s.project) + "/secrets?secretId=" + gcpSecretID(name)
+		if err := s.do("POST", u, in, nil); err != nil {
+			return err
+		}
+	} else if len(tags) > 0 {
+		if err := s.do("PATCH", s.secretURL(name)+"?updateMask=labels", map[string]interface{}{
+			"labels": gcpLabels(tags),
+		}, nil); err != nil {
+			return err
+		}
+	}
+	return s.do("POST", s.secretURL(name)+":addVersion", map[string]interface{}{
+		"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte(value))},
+	}, nil)
+}
+
+func (s *gcpSecretManager) String() string {
+	return "GCP Secret Manager (" + s.project + ")"
+}
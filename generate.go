@@ -0,0 +1,291 @@
+package vc
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// Character classes for generated passwords
+var passwordClasses = map[rune]string{
+	'l': "abcdefghijklmnopqrstuvwxyz",
+	'u': "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	'd': "0123456789",
+	's': "!#$%&()*+,-./:;<=>?@[]^_{|}~",
+}
+
+// minimumWordlistSize is the least number of unique words we accept for
+// generating passphrases
+const minimumWordlistSize = 1024
+
+// GenerateCommand generates passwords and passphrases
+type GenerateCommand struct {
+	baseCommand
+	fs        *flag.FlagSet
+	sub       string
+	length    int
+	classes   string
+	exclude   string
+	min       int
+	words     int
+	wordlist  string
+	separator string
+	store     string
+	key       string
+	force     bool
+}
+
+func (cmd *GenerateCommand) Help() string {
+	return "Usage: vc generate <password|passphrase> [<options>]\n\nOptions:\n" + defaults(cmd.fs)
+}
+
+func (cmd *GenerateCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) != 0 {
+		return Help
+	}
+
+	var (
+		value string
+		err   error
+	)
+	switch cmd.sub {
+	case "password":
+		value, err = generatePassword(cmd.length, cmd.classes, cmd.exclude, cmd.min)
+	case "passphrase":
+		var words []string
+		if words, err = readWordlist(cmd.wordlist); err == nil {
+			value, err = generatePassphrase(words, cmd.words, cmd.separator)
+		}
+	default:
+		return Help
+	}
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+
+	if cmd.store == "" {
+		cmd.ui.Output(value)
+		return Success
+	}
+	return cmd.runStore(value)
+}
+
+// runStore saves the generated value in key of the secret at cmd.store,
+// retaining the other keys of the secret
+func (cmd *GenerateCommand) runStore(value string) int {
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	path := strings.TrimLeft(cmd.resolve(cmd.store), "/")
+	secret, version, err := cmd.readForUpdate(client, path)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+
+	data := make(map[string]interface{})
+	if secret != nil {
+		for k, v := range secret.Data {
+			data[k] = v
+		}
+	}
+	if _, exists := data[cmd.key]; exists {
+		ok, err := cmd.confirmChanges(cmd.force, []string{"~ " + cmd.key}, "key %s of secret at %s already exists, overwrite?", cmd.key, cmd.store)
+		if err != nil {
+			cmd.ui.Error(err.Error())
+			return SystemError
+		} else if !ok {
+			return Success
+		}
+	}
+	data[cmd.key] = value
+
+	if err = cmd.writeUpdate(client, path, data, version); err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+
+	cmd.ui.Info(fmt.Sprintf("generated %s stored in key %s of secret %s", cmd.sub, cmd.key, cmd.store))
+	return Success
+}
+
+// randomIndex returns a uniform random number in [0, n)
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+// generatePassword generates a password of length characters, picked from the
+// character classes (any of "luds") and with at least min characters from
+// each class: min characters are drawn from each class, the rest from all
+// classes, and the result is shuffled
+func generatePassword(length int, classes, exclude string, min int) (string, error) {
+	if length < 1 {
+		return "", errors.New("length must be positive")
+	}
+	if min < 0 {
+		return "", errors.New("minimum must not be negative")
+	}
+
+	var (
+		sets     []string
+		alphabet string
+	)
+	for _, class := range classes {
+		chars, ok := passwordClasses[class]
+		if !ok {
+			return "", fmt.Errorf("unknown character class %q", class)
+		}
+		chars = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(exclude, r) {
+				return -1
+			}
+			return r
+		}, chars)
+		if chars == "" {
+			return "", fmt.Errorf("character class %q has no characters left after excluding %q", class, exclude)
+		}
+		sets = append(sets, chars)
+		alphabet += chars
+	}
+	if alphabet == "" {
+		return "", errors.New("no characters to pick from")
+	}
+	if min*len(sets) > length {
+		return "", fmt.Errorf("length %d is too short to contain %d characters of %d classes", length, min, len(sets))
+	}
+
+	out := make([]byte, 0, length)
+	pick := func(set string) error {
+		j, err := randomIndex(len(set))
+		if err != nil {
+			return err
+		}
+		out = append(out, set[j])
+		return nil
+	}
+	for _, set := range sets {
+		for i := 0; i < min; i++ {
+			if err := pick(set); err != nil {
+				return "", err
+			}
+		}
+	}
+	for len(out) < length {
+		if err := pick(alphabet); err != nil {
+			return "", err
+		}
+	}
+
+	// Fisher-Yates, so the required characters aren't up front
+	for i := len(out) - 1; i > 0; i-- {
+		j, err := randomIndex(i + 1)
+		if err != nil {
+			return "", err
+		}
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out), nil
+}
+
+// generatePassphrase picks count words from words (diceware style)
+func generatePassphrase(words []string, count int, separator string) (string, error) {
+	if count < 1 {
+		return "", errors.New("number of words must be positive")
+	}
+	if len(words) < minimumWordlistSize {
+		return "", fmt.Errorf("word list contains %d usable words, need at least %d", len(words), minimumWordlistSize)
+	}
+
+	out := make([]string, count)
+	for i := range out {
+		j, err := randomIndex(len(words))
+		if err != nil {
+			return "", err
+		}
+		out[i] = words[j]
+	}
+	return strings.Join(out, separator), nil
+}
+
+// readWordlist reads unique, lower case words from a file. Lines in diceware
+// format ("11111 word") are supported.
+func readWordlist(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		words []string
+		seen  = make(map[string]bool)
+		scan  = bufio.NewScanner(f)
+	)
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		word := fields[len(fields)-1]
+		if len(word) < 3 || len(word) > 9 || seen[word] || strings.Trim(word, passwordClasses['l']) != "" {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	return words, scan.Err()
+}
+
+func (cmd *GenerateCommand) Synopsis() string {
+	return "generate a " + cmd.sub
+}
+
+func GenerateCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &GenerateCommand{
+			sub: sub,
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("generate "+sub, flag.ContinueOnError)
+		switch sub {
+		case "password":
+			cmd.fs.IntVar(&cmd.length, "length", 24, "password length")
+			cmd.fs.StringVar(&cmd.classes, "classes", "luds", "character classes: (l)ower, (u)pper, (d)igits, (s)ymbols")
+			cmd.fs.StringVar(&cmd.exclude, "exclude", "", "characters to exclude")
+			cmd.fs.IntVar(&cmd.min, "min", 1, "minimum number of characters from each class")
+		case "passphrase":
+			cmd.fs.IntVar(&cmd.words, "words", 6, "number of words")
+			cmd.fs.StringVar(&cmd.wordlist, "wordlist", "/usr/share/dict/words", "word list file")
+			cmd.fs.StringVar(&cmd.separator, "separator", "-", "word separator")
+		}
+		cmd.fs.BoolVar(&cmd.force, "f", false, "force overwrite (for -store)")
+		cmd.fs.StringVar(&cmd.key, "k", "password", "key (for -store)")
+		cmd.fs.StringVar(&cmd.store, "store", "", "store in secret path instead of printing")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
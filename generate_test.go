@@ -0,0 +1,94 @@
+package vc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	for _, test := range []struct {
+		Length  int
+		Classes string
+		Exclude string
+		Min     int
+		Fail    bool
+	}{
+		{24, "luds", "", 1, false},
+		{8, "d", "", 8, false},
+		{16, "lu", "lIO0", 4, false},
+		{2, "luds", "", 1, true},
+		{8, "x", "", 1, true},
+		{8, "d", passwordClasses['d'], 1, true},
+		{0, "l", "", 0, true},
+		{64, "luds", "012345678abcdefghijklmnopqrstuvwxy", 16, false},
+		{8, "ld", passwordClasses['d'], 1, true},
+		{8, "l", "", -1, true},
+	} {
+		password, err := generatePassword(test.Length, test.Classes, test.Exclude, test.Min)
+		if test.Fail {
+			if err == nil {
+				t.Fatalf("expected %+v to fail", test)
+			}
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(password) != test.Length {
+			t.Fatalf("expected password of length %d, got %q", test.Length, password)
+		}
+		if strings.ContainsAny(password, test.Exclude) {
+			t.Fatalf("expected password %q to not contain any of %q", password, test.Exclude)
+		}
+		for _, class := range test.Classes {
+			var count int
+			for _, c := range password {
+				if strings.ContainsRune(passwordClasses[class], c) {
+					count++
+				}
+			}
+			if count < test.Min {
+				t.Fatalf("expected password %q to contain at least %d of class %c", password, test.Min, class)
+			}
+		}
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	f, err := ioutil.TempFile(os.TempDir(), "words")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.Remove(f.Name())
+	for i := 0; i < minimumWordlistSize; i++ {
+		fmt.Fprintf(f, "%05d word%s\n", i, strings.Map(func(r rune) rune {
+			return 'a' + (r - '0')
+		}, fmt.Sprintf("%04d", i)))
+	}
+	fmt.Fprintln(f, "Skipped")
+	fmt.Fprintln(f, "no")
+	f.Close()
+
+	words, err := readWordlist(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(words) != minimumWordlistSize {
+		t.Fatalf("expected %d words, got %d", minimumWordlistSize, len(words))
+	}
+
+	passphrase, err := generatePassphrase(words, 5, " ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(strings.Fields(passphrase)); n != 5 {
+		t.Fatalf("expected 5 words, got %q", passphrase)
+	}
+
+	if _, err = generatePassphrase(words[:10], 5, " "); err == nil {
+		t.Fatal("expected short word list to fail")
+	}
+}
@@ -0,0 +1,201 @@
+package vc
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// GitCredentialHelper is the name vc is installed (or linked) as to act as a
+// Git credential helper
+const GitCredentialHelper = "git-credential-vc"
+
+// DefaultGitCredentials is the default path template for Git credentials;
+// {protocol}, {host}, {path} and {username} are the attributes passed by Git
+const DefaultGitCredentials = "secret/git/{host}"
+
+// Keys of the secret holding Git credentials
+const (
+	gitUsernameKey = "username"
+	gitPasswordKey = "password"
+)
+
+// readGitCredential reads the attributes of a credential in the format of the
+// Git credential helper protocol, up to an empty line or EOF
+func readGitCredential(r io.Reader) (map[string]string, error) {
+	var (
+		attrs   = make(map[string]string)
+		scanner = bufio.NewScanner(r)
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 1 {
+			return nil, fmt.Errorf("invalid credential attribute %q", line)
+		}
+		attrs[line[:i]] = line[i+1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// GitCredentialCommand implements the Git credential helper protocol
+type GitCredentialCommand struct {
+	baseCommand
+	fs       *flag.FlagSet
+	sub      string
+	template string
+	in       io.Reader
+}
+
+func (cmd *GitCredentialCommand) Help() string {
+	return `Usage: vc git-credential <get|store|erase>
+
+Implements the Git credential helper protocol, reading credentials from Vault.
+The credential attributes are read from stdin. Install (or link) vc as
+` + GitCredentialHelper + ` and configure it with:
+
+  git config --global credential.helper vc
+
+Credentials are read from the secret at the path template configured with
+git_credentials (default ` + DefaultGitCredentials + `), in keys ` + gitUsernameKey + ` and
+` + gitPasswordKey + `. Credentials rejected by the server are only erased if they
+match the ones in Vault.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *GitCredentialCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) != 0 {
+		return Help
+	}
+	if cmd.template == "" {
+		if config, err := cmd.Config(); err != nil {
+			cmd.ui.Error(err.Error())
+			return ClientError
+		} else if cmd.template = config.GitCredentials; cmd.template == "" {
+			cmd.template = DefaultGitCredentials
+		}
+	}
+
+	attrs, err := readGitCredential(cmd.in)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	if attrs["host"] == "" {
+		cmd.ui.Error("error: no host")
+		return SyntaxError
+	}
+	path := expandTemplate(cmd.template, map[string]string{
+		"protocol": attrs["protocol"],
+		"host":     attrs["host"],
+		"path":     attrs["path"],
+		"username": attrs["username"],
+	})
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	secret, err := client.ReadSecret(path)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+	var username, password string
+	if secret != nil {
+		username, _ = secret.Data[gitUsernameKey].(string)
+		password, _ = secret.Data[gitPasswordKey].(string)
+	}
+
+	switch cmd.sub {
+	case "get":
+		// Git tries the next helper (or prompts) if we return nothing
+		if secret == nil || password == "" {
+			Debugf("git-credential: %s: no credentials", path)
+			return Success
+		}
+		if username == "" {
+			username = attrs["username"]
+		}
+		var buf bytes.Buffer
+		if username != "" {
+			fmt.Fprintf(&buf, "username=%s\n", username)
+		}
+		fmt.Fprintf(&buf, "password=%s\n", password)
+		if _, err = cmd.Write(buf.Bytes()); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+
+	case "store":
+		// Git stores the credentials we returned after using them, avoid
+		// writing a new version of the same secret
+		if attrs["password"] == "" || (username == attrs["username"] && password == attrs["password"]) {
+			return Success
+		}
+		if err = cmd.writeSecret(client, path, map[string]interface{}{
+			gitUsernameKey: attrs["username"],
+			gitPasswordKey: attrs["password"],
+		}); err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, ServerError)
+		}
+
+	case "erase":
+		if secret == nil || password != attrs["password"] {
+			Debugf("git-credential: %s: credentials do not match, not erasing", path)
+			return Success
+		}
+		if err = cmd.deleteSecret(client, path); err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, ServerError)
+		}
+
+	default:
+		// Unknown actions must be ignored, according to the protocol
+	}
+	return Success
+}
+
+func (cmd *GitCredentialCommand) Synopsis() string {
+	return cmd.sub + " Git credentials (Git credential helper)"
+}
+
+func GitCredentialCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &GitCredentialCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+			in:  os.Stdin,
+		}
+
+		cmd.fs = flag.NewFlagSet("git-credential "+sub, flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.template, "path", "", "path template (default: from config, or "+DefaultGitCredentials+")")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
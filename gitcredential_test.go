@@ -0,0 +1,26 @@
+package vc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadGitCredential(t *testing.T) {
+	attrs, err := readGitCredential(strings.NewReader("protocol=https\nhost=github.com\npassword=a=b\n\nignored=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"protocol": "https",
+		"host":     "github.com",
+		"password": "a=b",
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Fatalf("expected %v, got %v", want, attrs)
+	}
+
+	if _, err = readGitCredential(strings.NewReader("invalid\n")); err == nil {
+		t.Fatal("expected error for invalid attribute")
+	}
+}
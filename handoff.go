@@ -0,0 +1,124 @@
+package vc
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+)
+
+// HandoffCommand wraps a secret for a single use by someone else, see
+// ReceiveCommand
+type HandoffCommand struct {
+	baseCommand
+	fs  *flag.FlagSet
+	key string
+	ttl time.Duration
+	qr  bool
+}
+
+func (cmd *HandoffCommand) Help() string {
+	return `Usage: vc handoff [<options>] <secret path>[@<version>]
+
+Read the secret and response wrap its data (or the value of key with -k) for
+-ttl, then print only the wrapping token, or show it as a QR code with -qr.
+The wrapping token can be unwrapped once, with vc receive, by anyone who has
+it; nobody else can read the data afterwards.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *HandoffCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.fs.Args(); len(args) != 1 {
+		return Help
+	}
+	if cmd.ttl <= 0 {
+		cmd.ui.Error("error: -ttl must be positive")
+		return SyntaxError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	path := cmd.resolve(args[0])
+	var s *api.Secret
+	if name, version, ok := splitVersion(path); ok {
+		s, err = client.ReadVersion(name, version)
+	} else {
+		s, err = client.ReadSecret(path)
+	}
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	} else if s == nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: secret not found", path))
+		return NotFoundError
+	}
+
+	data := s.Data
+	if cmd.key != "" {
+		value, ok := s.Data[cmd.key]
+		if !ok {
+			cmd.ui.Error(fmt.Sprintf("error: %s: key %q not found", path, cmd.key))
+			return NotFoundError
+		}
+		data = map[string]interface{}{cmd.key: value}
+	}
+
+	if DryRun {
+		cmd.ui.Output(fmt.Sprintf("dry run: wrap %s for %s", path, cmd.ttl))
+		return Success
+	}
+	token, err := wrapData(client, cmd.ttl, data)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+
+	if cmd.qr {
+		if err = renderQR(os.Stdout, token); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	} else {
+		cmd.ui.Output(token)
+	}
+	fmt.Fprintf(os.Stderr, "handoff: %s is wrapped for %s, for a single use; unwrap with: vc receive\n",
+		strings.TrimLeft(path, "/"), cmd.ttl)
+	return Success
+}
+
+func (cmd *HandoffCommand) Synopsis() string {
+	return "wrap a secret for a single use by someone else"
+}
+
+func HandoffCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &HandoffCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("handoff", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.key, "k", "", "only hand off the value of key")
+		cmd.fs.DurationVar(&cmd.ttl, "ttl", 5*time.Minute, "TTL of the wrapping token")
+		cmd.fs.BoolVar(&cmd.qr, "qr", false, "show the wrapping token as a QR code")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
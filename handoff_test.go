@@ -0,0 +1,84 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestHandoffReceive(t *testing.T) {
+	var (
+		wrapTTL string
+		wrapped map[string]interface{}
+	)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/secret/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"username": "app", "password": "s3cret"}}
+		case "PUT /v1/sys/wrapping/wrap", "POST /v1/sys/wrapping/wrap":
+			wrapTTL = r.Header.Get("X-Vault-Wrap-TTL")
+			json.NewDecoder(r.Body).Decode(&wrapped)
+			response = map[string]interface{}{"wrap_info": map[string]interface{}{"token": "s.wrap", "ttl": 60}}
+		case "PUT /v1/sys/wrapping/unwrap", "POST /v1/sys/wrapping/unwrap":
+			if r.Header.Get("X-Vault-Token") != "s.wrap" || wrapped == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				response = map[string]interface{}{"errors": []string{"wrapping token is not valid or does not exist"}}
+				break
+			}
+			response = map[string]interface{}{"data": wrapped}
+			wrapped = nil
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+	c.SetToken("s.sender")
+
+	ui := cli.NewMockUi()
+	command, _ := HandoffCommandFactory(ui)()
+	handoff := command.(*HandoffCommand)
+	handoff.c, handoff.config = c, new(Config)
+	if code := handoff.Run([]string{"-k", "password", "-ttl", "1m", "secret/db"}); code != Success {
+		t.Fatalf("handoff: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if got := ui.OutputWriter.String(); got != "s.wrap\n" {
+		t.Fatalf("handoff: expected only the wrapping token, got %q", got)
+	}
+	if wrapTTL != "1m0s" || len(wrapped) != 1 || wrapped["password"] != "s3cret" {
+		t.Fatalf("handoff: unexpected wrap %q %v", wrapTTL, wrapped)
+	}
+
+	dir, err := ioutil.TempDir("", "vc-receive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "password")
+
+	receive := func() int {
+		ui = cli.NewMockUi()
+		command, _ = ReceiveCommandFactory(ui)()
+		cmd := command.(*ReceiveCommand)
+		cmd.c, cmd.config = c, new(Config)
+		return cmd.Run([]string{"-k", "password", "-o", out, "s.wrap"})
+	}
+	if code := receive(); code != Success {
+		t.Fatalf("receive: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if b, _ := ioutil.ReadFile(out); string(b) != "s3cret" {
+		t.Fatalf("receive: unexpected output %q", b)
+	}
+	if fi, err := os.Stat(out); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("receive: expected mode 0600, got %v (%v)", fi.Mode(), err)
+	}
+	if code := receive(); code == Success {
+		t.Fatal("receive: expected the second unwrap to fail")
+	}
+}
@@ -0,0 +1,74 @@
+package vc
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Headers are the extra HTTP headers sent to Vault, from --header; they
+// override the headers of the profile
+var Headers = make(http.Header)
+
+// AddHeader adds a header, as "Name: value", to Headers
+func AddHeader(value string) error {
+	name, value, err := parseHeader(value)
+	if err != nil {
+		return err
+	}
+	Headers.Add(name, value)
+	return nil
+}
+
+// parseHeader parses a header as "Name: value"; the headers with the token
+// and namespace are set by vc
+func parseHeader(header string) (name, value string, err error) {
+	i := strings.IndexByte(header, ':')
+	if i <= 0 {
+		return "", "", fmt.Errorf("header %q is not Name: value", header)
+	}
+	name, value = strings.TrimSpace(header[:i]), strings.TrimSpace(header[i+1:])
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("header %q: invalid name", header)
+	}
+	switch http.CanonicalHeaderKey(name) {
+	case "X-Vault-Token", "X-Vault-Namespace":
+		return "", "", fmt.Errorf("header %s is set by vc, use a token or namespace instead", name)
+	}
+	return name, value, nil
+}
+
+// setHeaders sets the headers of the profile, with environment variables
+// expanded in their values, and Headers on the client
+func (cmd *baseCommand) setHeaders(c *Client, p *Profile) error {
+	headers := c.Headers()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	if p != nil {
+		for name, value := range p.Headers {
+			name, value, err := parseHeader(name + ": " + os.ExpandEnv(value))
+			if err != nil {
+				return fmt.Errorf("profile %s: %v", cmd.profileName(), err)
+			}
+			headers.Set(name, value)
+		}
+	}
+	for name, values := range Headers {
+		headers[name] = values
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// Values may be credentials of a proxy
+	Debugf("client: sending headers %s", strings.Join(names, ", "))
+	c.SetHeaders(headers)
+	return nil
+}
@@ -0,0 +1,89 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		header      string
+		name, value string
+		err         bool
+	}{
+		{"X-Tenant: payments", "X-Tenant", "payments", false},
+		{"baggage:deploy=1, region=eu", "baggage", "deploy=1, region=eu", false},
+		{"X-Empty:", "X-Empty", "", false},
+		{"X-Tenant", "", "", true},
+		{": payments", "", "", true},
+		{"X Tenant: payments", "", "", true},
+		{"x-vault-token: s.test", "", "", true},
+	}
+	for _, test := range tests {
+		name, value, err := parseHeader(test.header)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.header)
+			}
+		} else if err != nil {
+			t.Errorf("%q: %v", test.header, err)
+		} else if name != test.name || value != test.value {
+			t.Errorf("%q: expected %q %q, got %q %q", test.header, test.name, test.value, name, value)
+		}
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	saved := Headers
+	defer func() { Headers = saved }()
+	Headers = make(http.Header)
+	if err := AddHeader("X-Tenant: billing"); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("VC_TEST_PROXY_TOKEN", "secret")
+	defer os.Unsetenv("VC_TEST_PROXY_TOKEN")
+	dir, err := ioutil.TempDir(os.TempDir(), "headers")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	savedTokens, savedSessions := profileTokenFile, sessionFile
+	defer func() { profileTokenFile, sessionFile = savedTokens, savedSessions }()
+	profileTokenFile = filepath.Join(dir, "tokens")
+	sessionFile = filepath.Join(dir, "sessions")
+
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"id": "s.test"}})
+	}))
+	defer server.Close()
+
+	cmd := &baseCommand{ui: cli.NewMockUi(), useProfile: "prod"}
+	cmd.config = &Config{Profiles: map[string]*Profile{
+		"prod": {Address: server.URL, Headers: map[string]string{
+			"X-Proxy-Authorization": "Bearer $VC_TEST_PROXY_TOKEN",
+			"X-Tenant":              "payments",
+		}},
+	}}
+	client, err := cmd.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Read("auth/token/lookup-self"); err != nil {
+		t.Fatal(err)
+	}
+	if v := got.Get("X-Proxy-Authorization"); v != "Bearer secret" {
+		t.Errorf("expected the header of the profile, got %q", v)
+	}
+	if v := got["X-Tenant"]; len(v) != 1 || v[0] != "billing" {
+		t.Errorf("expected --header to override the profile, got %q", v)
+	}
+}
@@ -0,0 +1,243 @@
+package vc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HealthAddr is the address on which the agent, and sync and template in
+// watch mode, serve their health, such as 127.0.0.1:8201; see healthStatus
+var HealthAddr string
+
+// healthGrace is how late a scheduled check may be before the command is
+// considered wedged
+const healthGrace = time.Minute
+
+// healthStatus is the health of a long-running command: whether its token is
+// valid, whether its last render succeeded, and whether it checks Vault on
+// schedule, so what it serves or rendered is fresh. It is served as JSON on
+// /health, with status 200 if healthy and 503 otherwise, and reported to the
+// systemd watchdog.
+type healthStatus struct {
+	mutex sync.Mutex
+
+	// tokenErr is the error of the last lookup, renewal or login
+	tokenChecked bool
+	tokenErr     error
+	tokenExpires time.Time
+
+	// renders is set for commands that render files
+	renders   bool
+	renderErr error
+
+	// next is when the command checks Vault again
+	next time.Time
+
+	// degraded checks if Vault is unreachable, may be nil
+	degraded func() bool
+}
+
+// health is the health of this process
+var health = new(healthStatus)
+
+type healthCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Healthy bool                   `json:"healthy"`
+	Checks  map[string]healthCheck `json:"checks"`
+}
+
+// token records the outcome of a lookup, renewal or login; a ttl of 0 is
+// a token that doesn't expire
+func (h *healthStatus) token(ttl time.Duration, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.tokenChecked, h.tokenErr = true, err
+	if err == nil && ttl > 0 {
+		h.tokenExpires = time.Now().Add(ttl)
+	} else if err == nil {
+		h.tokenExpires = time.Time{}
+	}
+}
+
+// lookupToken looks up the token of c, for commands that don't renew it
+func (h *healthStatus) lookupToken(c *Client) {
+	secret, err := c.Auth().Token().LookupSelf()
+	if err != nil {
+		h.token(0, err)
+		return
+	}
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		h.token(0, err)
+		return
+	}
+	observeTokenTTL(ttl)
+}
+
+// render records the outcome of a render
+func (h *healthStatus) render(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.renders, h.renderErr = true, err
+}
+
+// schedule records when the command checks Vault again
+func (h *healthStatus) schedule(next time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.next = next
+}
+
+// report checks the health at now
+func (h *healthStatus) report(now time.Time) healthReport {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	report := healthReport{Healthy: true, Checks: make(map[string]healthCheck)}
+	check := func(name string, err error) {
+		if err != nil {
+			report.Healthy = false
+			report.Checks[name] = healthCheck{Error: err.Error()}
+		} else {
+			report.Checks[name] = healthCheck{OK: true}
+		}
+	}
+
+	switch {
+	case !h.tokenChecked:
+		check("auth", errors.New("the token wasn't checked yet"))
+	case h.tokenErr != nil:
+		check("auth", h.tokenErr)
+	case !h.tokenExpires.IsZero() && !now.Before(h.tokenExpires):
+		check("auth", fmt.Errorf("the token expired at %s", h.tokenExpires.Format(time.RFC3339)))
+	default:
+		check("auth", nil)
+	}
+	if h.renders {
+		check("render", h.renderErr)
+	}
+	switch {
+	case h.degraded != nil && h.degraded():
+		check("cache", errors.New("Vault is unreachable, serving cached secrets"))
+	case h.next.IsZero():
+		check("cache", errors.New("no check is scheduled"))
+	case now.After(h.next.Add(healthGrace)):
+		check("cache", fmt.Errorf("the check due at %s didn't run", h.next.Format(time.RFC3339)))
+	default:
+		check("cache", nil)
+	}
+	return report
+}
+
+func (h *healthStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		agentError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	report := h.report(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// startHealth serves the health on HealthAddr, if set, and tells systemd the
+// command is ready; with WatchdogSec in the unit, the watchdog is notified
+// while the command is healthy, so systemd restarts it once it isn't. The
+// returned function stops both.
+func startHealth() (func(), error) {
+	var server *http.Server
+	if HealthAddr != "" {
+		l, err := net.Listen("tcp", HealthAddr)
+		if err != nil {
+			return nil, fmt.Errorf("health: %v", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/health", health)
+		server = &http.Server{Handler: mux}
+		Debugf("health: serving on http://%s/health", l.Addr())
+		go func() {
+			if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+				fmt.Fprintf(os.Stderr, "warning: health: %v\n", err)
+			}
+		}()
+	}
+
+	if err := sdNotify("READY=1"); err != nil {
+		Debugf("health: %v", err)
+	}
+	stop := make(chan struct{})
+	if interval := sdWatchdog(); interval > 0 {
+		Debugf("health: notifying the systemd watchdog every %s", interval)
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case now := <-ticker.C:
+					if report := health.report(now); report.Healthy {
+						sdNotify("WATCHDOG=1")
+					} else {
+						Debugf("health: unhealthy, not notifying the watchdog: %v", report.Checks)
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	return func() {
+		close(stop)
+		sdNotify("STOPPING=1")
+		if server != nil {
+			server.Close()
+		}
+	}, nil
+}
+
+// sdNotify sends state to the notification socket of systemd, if vc runs as a
+// service with Type=notify (or a watchdog)
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		// Abstract namespace
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("sd_notify: %v", err)
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("sd_notify: %v", err)
+	}
+	return nil
+}
+
+// sdWatchdog returns the interval at which to notify the systemd watchdog,
+// half its timeout, or 0 without a watchdog for this process
+func sdWatchdog() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
@@ -0,0 +1,103 @@
+package vc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHealthStatus(t *testing.T) {
+	h := new(healthStatus)
+	get := func() (int, healthReport) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+		var report healthReport
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, report
+	}
+
+	// Unhealthy until the token is checked and a check is scheduled
+	if code, report := get(); code != http.StatusServiceUnavailable || report.Healthy {
+		t.Fatalf("expected unhealthy before the first check, got %d %+v", code, report)
+	}
+	h.token(time.Hour, nil)
+	h.schedule(time.Now().Add(time.Minute))
+	if code, report := get(); code != http.StatusOK || !report.Healthy || len(report.Checks) != 2 {
+		t.Fatalf("expected healthy, got %d %+v", code, report)
+	}
+
+	h.render(errors.New("the last run failed with exit code 3"))
+	if _, report := get(); report.Healthy || report.Checks["render"].Error == "" || !report.Checks["auth"].OK {
+		t.Fatalf("expected the render to fail, got %+v", report)
+	}
+	h.render(nil)
+
+	tests := []struct {
+		name  string
+		setup func()
+		check string
+	}{
+		{"expired", func() { h.tokenExpires = time.Now().Add(-time.Second) }, "auth"},
+		{"token error", func() { h.token(0, errors.New("permission denied")) }, "auth"},
+		{"wedged", func() { h.schedule(time.Now().Add(-2 * healthGrace)) }, "cache"},
+		{"degraded", func() { h.degraded = func() bool { return true } }, "cache"},
+	}
+	for _, test := range tests {
+		h.token(time.Hour, nil)
+		h.schedule(time.Now().Add(time.Minute))
+		h.degraded = nil
+		test.setup()
+		if _, report := get(); report.Healthy || report.Checks[test.check].OK {
+			t.Errorf("%s: expected %s to fail, got %+v", test.name, test.check, report)
+		}
+	}
+}
+
+func TestSDNotify(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "health")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	os.Setenv("NOTIFY_SOCKET", socket)
+	if err = sdNotify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b[:n]); got != "READY=1" {
+		t.Fatalf("expected READY=1, got %q", got)
+	}
+
+	defer os.Unsetenv("WATCHDOG_USEC")
+	os.Setenv("WATCHDOG_USEC", "10000000")
+	if got := sdWatchdog(); got != 5*time.Second {
+		t.Fatalf("expected a 5s watchdog interval, got %s", got)
+	}
+	os.Setenv("WATCHDOG_PID", "1")
+	defer os.Unsetenv("WATCHDOG_PID")
+	if got := sdWatchdog(); got != 0 {
+		t.Fatalf("expected no watchdog for another process, got %s", got)
+	}
+}
@@ -0,0 +1,224 @@
+package vc
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// authorMetadataKey is the custom metadata key prefix that records the author
+// of a version, as "author_v<version>"
+const authorMetadataKey = "author_v"
+
+// HistoryCommand lists versions of a KV v2 secret
+type HistoryCommand struct {
+	baseCommand
+	fs     *flag.FlagSet
+	limit  int
+	format string
+}
+
+// secretVersion is a version of a KV v2 secret
+type secretVersion struct {
+	Version   int
+	Created   time.Time
+	Deleted   time.Time
+	Destroyed bool
+	Author    string
+}
+
+func (v secretVersion) State(current int) string {
+	switch {
+	case v.Destroyed:
+		return "destroyed"
+	case !v.Deleted.IsZero():
+		return "deleted " + v.Deleted.Format(time.RFC3339)
+	case v.Version == current:
+		return "current"
+	}
+	return ""
+}
+
+// historyEntry is a version formatted with -template
+type historyEntry struct {
+	secretVersion
+	Path  string
+	State string
+}
+
+func (cmd *HistoryCommand) Help() string {
+	return `Usage: vc history [<options>] <secret path>
+
+With -template, each version is printed as a line formatted with the Go
+template, such as '{{ .Version }} {{ .Author }}'. The fields are Path, Version,
+Created, Deleted, Destroyed, Author and State.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *HistoryCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) != 1 {
+		return Help
+	}
+	var tmpl *textTemplate.Template
+	if cmd.format != "" {
+		var err error
+		if tmpl, err = parseListTemplate(cmd.format); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SyntaxError
+		}
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	metadataPath, err := client.KV2Path(args[0], "metadata")
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+
+	Debugf("history: read %q", metadataPath)
+	secret, err := client.Read(metadataPath)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+	if secret == nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: secret not found", args[0]))
+		return NotFoundError
+	}
+
+	current, versions, err := parseVersions(secret.Data)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: %v", args[0], err))
+		return exitCode(err, ServerError)
+	}
+	if cmd.limit > 0 && len(versions) > cmd.limit {
+		versions = versions[:cmd.limit]
+	}
+	if tmpl != nil {
+		for _, v := range versions {
+			line, err := executeListTemplate(tmpl, historyEntry{secretVersion: v, Path: args[0], State: v.State(current)})
+			if err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %v", err))
+				return SyntaxError
+			}
+			cmd.ui.Output(line)
+		}
+		return Success
+	}
+
+	var (
+		w      = tabwriter.NewWriter(cmd, 0, 8, 2, ' ', 0)
+		colors = cmd.colors(os.Stdout)
+	)
+	fmt.Fprintln(w, "VERSION\tCREATED\tAUTHOR\tSTATE")
+	for _, v := range versions {
+		author := v.Author
+		if author == "" {
+			author = "-"
+		}
+		// The state is the last column, so colors don't affect the alignment
+		state := v.State(current)
+		if state != "" {
+			state = colors.paint(strings.Fields(state)[0], state)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", v.Version, v.Created.Format(time.RFC3339), author, state)
+	}
+	if err = w.Flush(); err != nil {
+		cmd.ui.Error(err.Error())
+		return SystemError
+	}
+
+	return Success
+}
+
+// parseVersions parses KV v2 secret metadata, it returns the current version
+// and all versions, newest first
+func parseVersions(data map[string]interface{}) (current int, versions []secretVersion, err error) {
+	if current, err = parseInt(data["current_version"]); err != nil {
+		return 0, nil, fmt.Errorf("current_version: %v", err)
+	}
+
+	custom, _ := data["custom_metadata"].(map[string]interface{})
+	items, _ := data["versions"].(map[string]interface{})
+	for key, item := range items {
+		var v secretVersion
+		if v.Version, err = strconv.Atoi(key); err != nil {
+			return 0, nil, fmt.Errorf("invalid version %q", key)
+		}
+		meta, ok := item.(map[string]interface{})
+		if !ok {
+			return 0, nil, fmt.Errorf("version %s: invalid metadata", key)
+		}
+		if s, _ := meta["created_time"].(string); s != "" {
+			v.Created, _ = time.Parse(time.RFC3339Nano, s)
+		}
+		if s, _ := meta["deletion_time"].(string); s != "" {
+			v.Deleted, _ = time.Parse(time.RFC3339Nano, s)
+		}
+		v.Destroyed, _ = meta["destroyed"].(bool)
+		v.Author, _ = custom[authorMetadataKey+key].(string)
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version > versions[j].Version
+	})
+	return
+}
+
+// parseInt parses numbers as returned by the Vault API
+func parseInt(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case fmt.Stringer: // json.Number
+		return strconv.Atoi(v.String())
+	case float64:
+		return int(v), nil
+	case int:
+		return v, nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
+
+func (cmd *HistoryCommand) Synopsis() string {
+	return "list versions of a secret"
+}
+
+func HistoryCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &HistoryCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("history", flag.ContinueOnError)
+		cmd.fs.IntVar(&cmd.limit, "limit", 0, "show at most limit versions (0 for all)")
+		cmd.fs.StringVar(&cmd.format, "template", "", "print each version formatted with the Go template")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,122 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestHistoryCommand(t *testing.T) {
+	for _, test := range []testCommand{
+		testCommand{
+			Factory: HistoryCommandFactory,
+			Args:    []string{"--help"},
+			Code:    Success,
+		},
+	} {
+		if test.Live {
+			if err := testLiveAvailable(); err != nil {
+				t.Skip(err)
+			}
+		}
+		testCommandRun(t, test)
+	}
+}
+
+func TestParseVersions(t *testing.T) {
+	current, versions, err := parseVersions(map[string]interface{}{
+		"current_version": json.Number("3"),
+		"custom_metadata": map[string]interface{}{
+			"author_v3": "alice",
+		},
+		"versions": map[string]interface{}{
+			"1": map[string]interface{}{
+				"created_time":  "2018-03-22T02:24:06.945319214Z",
+				"deletion_time": "",
+				"destroyed":     true,
+			},
+			"2": map[string]interface{}{
+				"created_time":  "2018-03-22T02:36:33.954880664Z",
+				"deletion_time": "2018-03-22T02:40:00.000000000Z",
+				"destroyed":     false,
+			},
+			"3": map[string]interface{}{
+				"created_time":  "2018-03-22T02:36:43.986212308Z",
+				"deletion_time": "",
+				"destroyed":     false,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != 3 {
+		t.Fatalf("expected current version 3, got %d", current)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("expected 3 versions, got %d", len(versions))
+	}
+	for i, want := range []string{"current", "deleted 2018-03-22T02:40:00Z", "destroyed"} {
+		if got := versions[i].State(current); got != want {
+			t.Fatalf("version %d: expected state %q, got %q", versions[i].Version, want, got)
+		}
+	}
+	if versions[0].Author != "alice" {
+		t.Fatalf("expected author alice, got %q", versions[0].Author)
+	}
+}
+
+func TestSplitVersion(t *testing.T) {
+	tests := []struct {
+		Path    string
+		Want    string
+		Version int
+		OK      bool
+	}{
+		{"secret/foo@3", "secret/foo", 3, true},
+		{"secret/foo", "secret/foo", 0, false},
+		{"secret/user@example.com", "secret/user@example.com", 0, false},
+		{"secret/foo@0", "secret/foo@0", 0, false},
+	}
+	for _, test := range tests {
+		path, version, ok := splitVersion(test.Path)
+		if path != test.Want || version != test.Version || ok != test.OK {
+			t.Fatalf("splitVersion(%q): expected %q, %d, %t; got %q, %d, %t",
+				test.Path, test.Want, test.Version, test.OK, path, version, ok)
+		}
+	}
+}
+
+func TestHistoryCommandTemplate(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/kv/metadata/app/db":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"current_version": 2,
+				"custom_metadata": map[string]interface{}{"author_v2": "alice"},
+				"versions": map[string]interface{}{
+					"1": map[string]interface{}{"created_time": "2026-09-01T00:00:00Z", "destroyed": true},
+					"2": map[string]interface{}{"created_time": "2026-10-01T00:00:00Z"},
+				},
+			}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"kv/": "kv-v2"})
+
+	ui := cli.NewMockUi()
+	command, _ := HistoryCommandFactory(ui)()
+	cmd := command.(*HistoryCommand)
+	cmd.c, cmd.config = c, new(Config)
+	if code := cmd.Run([]string{"-template", "{{ .Path }}@{{ .Version }} {{ .Author }} {{ .State }}", "kv/app/db"}); code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if got, want := ui.OutputWriter.String(), "kv/app/db@2 alice current\nkv/app/db@1  destroyed\n"; got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+}
@@ -0,0 +1,119 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// hookTimeout is the timeout for webhooks
+const hookTimeout = 10 * time.Second
+
+// Hook runs after output files changed, for example to reload a service
+type Hook struct {
+	// Outputs are the patterns of the output files the hook is for, see
+	// filepath.Match; absolute, or relative to the working directory
+	Outputs []string `yaml:"outputs"`
+
+	// Exec is a command line, the changed files are appended as arguments
+	Exec []string `yaml:"exec,omitempty"`
+
+	// Webhook is a URL that the changed files are POSTed to, as JSON
+	Webhook string `yaml:"webhook,omitempty"`
+}
+
+// changedFiles are the output files that changed
+var (
+	changedFiles []string
+	changedMutex sync.Mutex
+)
+
+// outputChanged records that the output file name changed
+func outputChanged(name string) {
+	metrics.add(filesChanged, 1)
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	changedMutex.Lock()
+	defer changedMutex.Unlock()
+	changedFiles = append(changedFiles, name)
+}
+
+// matches returns the changed files the hook is for
+func (hook *Hook) matches(changed []string) (matched []string) {
+	for _, name := range changed {
+		for _, pattern := range hook.Outputs {
+			if abs, err := filepath.Abs(pattern); err == nil {
+				pattern = abs
+			}
+			if ok, _ := filepath.Match(pattern, name); ok {
+				matched = append(matched, name)
+				break
+			}
+		}
+	}
+	return
+}
+
+// run runs the hook for the changed files
+func (hook *Hook) run(changed []string) error {
+	if len(hook.Exec) > 0 {
+		Debugf("hook: %v %v", hook.Exec, changed)
+		c := exec.Command(hook.Exec[0], append(hook.Exec[1:len(hook.Exec):len(hook.Exec)], changed...)...)
+		c.Stdout = os.Stderr
+		c.Stderr = os.Stderr
+		if err := c.Run(); err != nil {
+			return fmt.Errorf("hook %s: %v", hook.Exec[0], err)
+		}
+	}
+
+	if hook.Webhook != "" {
+		Debugf("hook: POST %s %v", hook.Webhook, changed)
+		body, err := json.Marshal(map[string][]string{"changed": changed})
+		if err != nil {
+			return err
+		}
+		res, err := (&http.Client{Timeout: hookTimeout}).Post(hook.Webhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("hook: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode/100 != 2 {
+			return fmt.Errorf("hook %s: %s", hook.Webhook, res.Status)
+		}
+	}
+	return nil
+}
+
+// RunHooks runs the hooks in the configuration file for the output files that
+// changed; all hooks are run, the first error is returned
+func RunHooks() error {
+	changedMutex.Lock()
+	changed := changedFiles
+	changedFiles = nil
+	changedMutex.Unlock()
+	if len(changed) == 0 {
+		return nil
+	}
+
+	config, err := LoadConfig(configName())
+	if err != nil {
+		return err
+	}
+	var first error
+	for i := range config.Hooks {
+		hook := &config.Hooks[i]
+		if matched := hook.matches(changed); len(matched) > 0 {
+			if err = hook.run(matched); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,64 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHookMatches(t *testing.T) {
+	hook := &Hook{Outputs: []string{"/etc/nginx/*.pem", "/etc/app.conf"}}
+	changed := []string{"/etc/nginx/site.pem", "/etc/nginx/site.conf", "/etc/app.conf"}
+	want := []string{"/etc/nginx/site.pem", "/etc/app.conf"}
+	if got := hook.matches(changed); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestHookRun(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "hook")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake reload command that saves its arguments
+	name := filepath.Join(dir, "reload")
+	if err = ioutil.WriteFile(name, []byte("#!/bin/sh\necho \"$@\" > \"$0.args\"\n"), 0755); err != nil {
+		t.Skip(err)
+	}
+	var body map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	hook := &Hook{Exec: []string{name, "nginx"}, Webhook: server.URL}
+	changed := []string{"/etc/nginx/a.pem", "/etc/nginx/b.pem"}
+	if err = hook.run(changed); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(name + ".args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := strings.TrimSpace(string(b)); args != "nginx /etc/nginx/a.pem /etc/nginx/b.pem" {
+		t.Fatalf("unexpected arguments %q", args)
+	}
+	if !reflect.DeepEqual(body["changed"], changed) {
+		t.Fatalf("expected %q posted, got %q", changed, body["changed"])
+	}
+
+	hook = &Hook{Exec: []string{filepath.Join(dir, "missing")}}
+	if err = hook.run(changed); err == nil {
+		t.Fatal("expected error for missing command")
+	}
+}
@@ -0,0 +1,331 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// identityInfo is the identity of a token: the token, its entity with the
+// aliases, and the groups of the entity
+type identityInfo struct {
+	Token    identityToken    `json:"token"`
+	Entity   *identityEntity  `json:"entity,omitempty"`
+	Groups   []identityGroup  `json:"groups,omitempty"`
+	Policies []string         `json:"policies"`
+	groupIDs map[string]bool  // direct groups
+	lookups  map[string]error // failed lookups, by what was looked up
+}
+
+type identityToken struct {
+	Accessor         string   `json:"accessor"`
+	DisplayName      string   `json:"display_name"`
+	Path             string   `json:"path"`
+	Policies         []string `json:"policies"`
+	IdentityPolicies []string `json:"identity_policies,omitempty"`
+	EntityID         string   `json:"entity_id,omitempty"`
+	TTL              int      `json:"ttl"`
+	Orphan           bool     `json:"orphan"`
+}
+
+type identityEntity struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Policies []string        `json:"policies"`
+	Disabled bool            `json:"disabled"`
+	Aliases  []identityAlias `json:"aliases"`
+}
+
+type identityAlias struct {
+	Name          string `json:"name"`
+	MountAccessor string `json:"mount_accessor"`
+	MountPath     string `json:"mount_path"`
+	MountType     string `json:"mount_type"`
+}
+
+type identityGroup struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Policies []string `json:"policies"`
+	Direct   bool     `json:"direct"`
+}
+
+// IdentityCommand shows the identity of a token
+type IdentityCommand struct {
+	baseCommand
+	fs       *flag.FlagSet
+	accessor string
+	raw      bool
+}
+
+func (cmd *IdentityCommand) Help() string {
+	return `Usage: vc identity [<options>]
+
+Show the identity of the current token, or of the token with -accessor: the
+policies of the token, its entity with the aliases of the entity, the groups
+of the entity (direct or inherited), and the policies that apply. Parts that
+can't be looked up, because the token has no access to them, are skipped with
+a warning.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *IdentityCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) > 0 {
+		return Help
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	info, err := lookupIdentity(client, cmd.accessor)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	failed := make([]string, 0, len(info.lookups))
+	for what := range info.lookups {
+		failed = append(failed, what)
+	}
+	sort.Strings(failed)
+	for _, what := range failed {
+		cmd.ui.Warn(fmt.Sprintf("warning: identity: %s: %v", what, info.lookups[what]))
+	}
+
+	if cmd.raw {
+		b, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return CodecError
+		}
+		cmd.ui.Output(string(b))
+		return Success
+	}
+	cmd.ui.Output(info.String())
+	return Success
+}
+
+// lookupIdentity looks up the token with accessor (or the current token if
+// empty), its entity and groups
+func lookupIdentity(client *Client, accessor string) (*identityInfo, error) {
+	var (
+		info = &identityInfo{lookups: make(map[string]error), groupIDs: make(map[string]bool)}
+		data map[string]interface{}
+	)
+	if accessor == "" {
+		secret, err := client.Read("auth/token/lookup-self")
+		if err != nil {
+			return nil, err
+		} else if secret == nil {
+			return nil, notFound("token not found")
+		}
+		data = secret.Data
+	} else {
+		secret, err := client.Write("auth/token/lookup-accessor", map[string]interface{}{"accessor": accessor})
+		if err != nil {
+			return nil, err
+		} else if secret == nil {
+			return nil, notFound("token not found for accessor " + accessor)
+		}
+		data = secret.Data
+	}
+
+	info.Token = newIdentityToken(data)
+	t := &info.Token
+
+	policies := append(append([]string(nil), t.Policies...), t.IdentityPolicies...)
+	if t.EntityID != "" {
+		if err := info.lookupEntity(client); err != nil {
+			info.lookups["entity "+t.EntityID] = err
+		} else {
+			policies = append(policies, info.Entity.Policies...)
+			for _, group := range info.Groups {
+				policies = append(policies, group.Policies...)
+			}
+		}
+	}
+	info.Policies = identityUnique(policies)
+	return info, nil
+}
+
+// newIdentityToken returns the token in the data of a token lookup
+func newIdentityToken(data map[string]interface{}) identityToken {
+	var t identityToken
+	t.Accessor, _ = data["accessor"].(string)
+	t.DisplayName, _ = data["display_name"].(string)
+	t.Path, _ = data["path"].(string)
+	t.EntityID, _ = data["entity_id"].(string)
+	t.Orphan, _ = data["orphan"].(bool)
+	t.Policies = identityStrings(data["policies"])
+	t.IdentityPolicies = identityStrings(data["identity_policies"])
+	t.TTL, _ = parseInt(data["ttl"])
+	return t
+}
+
+// lookupEntity looks up the entity of the token, and its groups
+func (info *identityInfo) lookupEntity(client *Client) error {
+	secret, err := client.Read("identity/entity/id/" + info.Token.EntityID)
+	if err != nil {
+		return err
+	} else if secret == nil {
+		return notFound("entity not found")
+	}
+
+	e := &identityEntity{ID: info.Token.EntityID}
+	e.Name, _ = secret.Data["name"].(string)
+	e.Disabled, _ = secret.Data["disabled"].(bool)
+	e.Policies = identityStrings(secret.Data["policies"])
+	aliases, _ := secret.Data["aliases"].([]interface{})
+	for _, v := range aliases {
+		alias, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		a := identityAlias{}
+		a.Name, _ = alias["name"].(string)
+		a.MountAccessor, _ = alias["mount_accessor"].(string)
+		a.MountPath, _ = alias["mount_path"].(string)
+		a.MountType, _ = alias["mount_type"].(string)
+		e.Aliases = append(e.Aliases, a)
+	}
+	info.Entity = e
+
+	for _, id := range identityStrings(secret.Data["direct_group_ids"]) {
+		info.groupIDs[id] = true
+	}
+	ids := identityUnique(append(identityStrings(secret.Data["direct_group_ids"]), identityStrings(secret.Data["inherited_group_ids"])...))
+	for _, id := range ids {
+		group := identityGroup{ID: id, Direct: info.groupIDs[id]}
+		if secret, err := client.Read("identity/group/id/" + id); err != nil {
+			info.lookups["group "+id] = err
+		} else if secret != nil {
+			group.Name, _ = secret.Data["name"].(string)
+			group.Policies = identityStrings(secret.Data["policies"])
+		}
+		info.Groups = append(info.Groups, group)
+	}
+	sort.Slice(info.Groups, func(i, j int) bool { return info.Groups[i].Name < info.Groups[j].Name })
+	return nil
+}
+
+// String formats the identity for display
+func (info *identityInfo) String() string {
+	var (
+		b = new(bytes.Buffer)
+		w = tabwriter.NewWriter(b, 0, 8, 2, ' ', 0)
+		t = info.Token
+	)
+	fmt.Fprintf(w, "token:\t%s (accessor %s)\n", t.DisplayName, t.Accessor)
+	if t.Path != "" {
+		fmt.Fprintf(w, "  path:\t%s\n", t.Path)
+	}
+	if t.TTL == 0 {
+		fmt.Fprintf(w, "  ttl:\tnever expires\n")
+	} else {
+		fmt.Fprintf(w, "  ttl:\t%s\n", time.Duration(t.TTL)*time.Second)
+	}
+	fmt.Fprintf(w, "  policies:\t%s\n", identityList(t.Policies))
+	if len(t.IdentityPolicies) > 0 {
+		fmt.Fprintf(w, "  identity policies:\t%s\n", identityList(t.IdentityPolicies))
+	}
+
+	if e := info.Entity; e != nil {
+		name := e.Name
+		if e.Disabled {
+			name += " (disabled)"
+		}
+		fmt.Fprintf(w, "entity:\t%s (%s)\n", name, e.ID)
+		fmt.Fprintf(w, "  policies:\t%s\n", identityList(e.Policies))
+		for _, a := range e.Aliases {
+			fmt.Fprintf(w, "  alias:\t%s (%s %s)\n", a.Name, a.MountType, a.MountPath)
+		}
+	} else if t.EntityID == "" {
+		fmt.Fprintf(w, "entity:\tnone\n")
+	}
+	for _, g := range info.Groups {
+		kind := "inherited"
+		if g.Direct {
+			kind = "direct"
+		}
+		name := g.Name
+		if name == "" {
+			name = g.ID
+		}
+		fmt.Fprintf(w, "group:\t%s (%s)\n", name, kind)
+		fmt.Fprintf(w, "  policies:\t%s\n", identityList(g.Policies))
+	}
+	fmt.Fprintf(w, "policies:\t%s\n", identityList(info.Policies))
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// identityStrings returns the strings in a list of a Vault response
+func identityStrings(v interface{}) []string {
+	list, _ := v.([]interface{})
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// identityUnique returns the unique values, sorted
+func identityUnique(values []string) []string {
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// identityList formats a list of names
+func identityList(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ", ")
+}
+
+func (cmd *IdentityCommand) Synopsis() string {
+	return "show the entity, groups and policies of a token"
+}
+
+func IdentityCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &IdentityCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("identity", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.accessor, "accessor", "", "accessor of the token (default: the current token)")
+		cmd.fs.BoolVar(&cmd.raw, "json", false, "print the identity as JSON")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
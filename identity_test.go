@@ -0,0 +1,80 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestIdentityCommand(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/auth/token/lookup-self":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"accessor": "a.self", "display_name": "approle", "path": "auth/approle/login", "ttl": 3600,
+				"policies": []string{"default", "app"}, "entity_id": "e1",
+			}}
+		case "POST /v1/auth/token/lookup-accessor", "PUT /v1/auth/token/lookup-accessor":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"accessor": "a.root", "display_name": "root", "policies": []string{"root"},
+			}}
+		case "GET /v1/identity/entity/id/e1":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"name": "ci", "policies": []string{"ci"},
+				"aliases":          []interface{}{map[string]interface{}{"name": "ci-role", "mount_type": "approle", "mount_path": "auth/approle/"}},
+				"direct_group_ids": []string{"g1"}, "inherited_group_ids": []string{"g2"},
+			}}
+		case "GET /v1/identity/group/id/g1":
+			response = map[string]interface{}{"data": map[string]interface{}{"name": "deploy", "policies": []string{"deploy", "app"}}}
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			response = map[string]interface{}{"errors": []string{"permission denied"}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), nil)
+
+	tests := []struct {
+		args   []string
+		output string
+		warn   string
+	}{
+		{nil, `token:       approle (accessor a.self)
+  path:      auth/approle/login
+  ttl:       1h0m0s
+  policies:  default, app
+entity:      ci (e1)
+  policies:  ci
+  alias:     ci-role (approle auth/approle/)
+group:       g2 (inherited)
+  policies:  -
+group:       deploy (direct)
+  policies:  deploy, app
+policies:    app, ci, default, deploy
+`, "warning: identity: group g2: "},
+		{[]string{"-accessor", "a.root"}, `token:       root (accessor a.root)
+  ttl:       never expires
+  policies:  root
+entity:      none
+policies:    root
+`, ""},
+	}
+	for _, test := range tests {
+		ui := cli.NewMockUi()
+		command, _ := IdentityCommandFactory(ui)()
+		cmd := command.(*IdentityCommand)
+		cmd.c, cmd.config = c, new(Config)
+		if code := cmd.Run(test.args); code != Success {
+			t.Fatalf("%v: expected success, got %d: %s", test.args, code, ui.ErrorWriter.String())
+		}
+		if got := ui.OutputWriter.String(); got != test.output {
+			t.Fatalf("%v: expected\n%s\ngot\n%s", test.args, test.output, got)
+		}
+		if got := ui.ErrorWriter.String(); (test.warn == "") != (got == "") || !strings.HasPrefix(got, test.warn) {
+			t.Fatalf("%v: expected warning %q, got %q", test.args, test.warn, got)
+		}
+	}
+}
@@ -0,0 +1,647 @@
+package vc
+
+import (
+	"archive/zip"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// DefaultImportPath is the path template for imported items
+const DefaultImportPath = "{vault}/{item}"
+
+// importItem is an item exported by a password manager
+type importItem struct {
+	// ID is the identifier of the item in the password manager
+	ID string
+
+	// Vault is the name of the vault (1Password) or folder (Bitwarden)
+	Vault string
+
+	// Name of the item
+	Name string
+
+	// Fields are the values of the item; attachments are base64 encoded, in
+	// keys with the binaryKeySuffix
+	Fields map[string]string
+}
+
+// set sets field name, if value is not empty; a number is appended to names
+// that are already set
+func (item *importItem) set(name, value string) {
+	if value == "" {
+		return
+	}
+	if item.Fields == nil {
+		item.Fields = make(map[string]string)
+	}
+	key := name
+	for i := 2; ; i++ {
+		if _, exists := item.Fields[key]; !exists {
+			break
+		}
+		key = fmt.Sprintf("%s_%d", name, i)
+	}
+	item.Fields[key] = value
+}
+
+// attach stores the contents of an attachment, base64 encoded
+func (item *importItem) attach(name string, b []byte) {
+	item.set(name+binaryKeySuffix, base64.StdEncoding.EncodeToString(b))
+}
+
+// importPathEscaper replaces characters in names that can't be used in path
+// components
+var importPathEscaper = strings.NewReplacer("/", "-", "{", "(", "}", ")")
+
+// importMapping maps items to paths, and fields to keys
+type importMapping struct {
+	// Path is the path template, relative to the import tree
+	Path string
+
+	// Keys maps field names to keys; fields mapped to "" are not imported
+	Keys map[string]string
+}
+
+// path returns the path of item relative to the import tree
+func (m *importMapping) path(item importItem) string {
+	return expandTemplate(m.Path, map[string]string{
+		"vault":  importPathEscaper.Replace(item.Vault),
+		"folder": importPathEscaper.Replace(item.Vault),
+		"item":   importPathEscaper.Replace(item.Name),
+		"id":     importPathEscaper.Replace(item.ID),
+	})
+}
+
+// data returns the secret data of item
+func (m *importMapping) data(item importItem) map[string]interface{} {
+	data := make(map[string]interface{}, len(item.Fields))
+	for name, value := range item.Fields {
+		key, ok := m.Keys[name]
+		if !ok {
+			key = name
+		}
+		if key != "" {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// ImportCommand imports the items exported by a password manager
+type ImportCommand struct {
+	baseCommand
+	fs          *flag.FlagSet
+	kind        string
+	path        string
+	format      string
+	attachments string
+	mapping     stringsValue
+	conflict    string
+	force       bool
+}
+
+func (cmd *ImportCommand) Help() string {
+	var formats string
+	switch cmd.kind {
+	case "1password":
+		formats = `Exports in the 1PUX format (1Password 8) include the attachments, CSV
+exports only the title, website, username, password, one-time password and
+notes.`
+	case "bitwarden":
+		formats = `Exports in the JSON format include the custom fields, CSV exports only the
+login fields, custom fields and notes. Encrypted exports are not supported.
+Attachments are read from -attachments, in <directory>/<item id>/<file name>
+as saved by "bw get attachment --itemid <item id> --output".`
+	}
+	return `Usage: vc import ` + cmd.kind + ` [<options>] <export file> <secret path>
+
+Writes the items of a ` + cmd.kind + ` export to the tree at path, one secret per
+item. The path of the secret is the -path template, with {vault} (or
+{folder}), {item} and {id} replaced by the names of the vault and item and the
+item's identifier; use {id} if item names are not unique.
+
+` + formats + `
+
+Fields are stored in keys username, password, url, totp and notes, and custom
+fields in keys named after the field; attachments are stored base64 encoded,
+in "<file name>` + binaryKeySuffix + `". Use -map field=key to rename a key, or
+-map field= to skip the field.
+
+Items that exist with other values are conflicts, which fail the import
+before any changes are made (-conflict fail), are skipped or are overwritten.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *ImportCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.fs.Args(); len(args) != 2 {
+		return Help
+	}
+	switch cmd.conflict {
+	case conflictFail, conflictSkip, conflictOverwrite:
+	default:
+		cmd.ui.Error(fmt.Sprintf("error: invalid conflict policy %q", cmd.conflict))
+		return SyntaxError
+	}
+	m := &importMapping{Path: cmd.path, Keys: make(map[string]string)}
+	for _, rule := range cmd.mapping {
+		i := strings.IndexByte(rule, '=')
+		if i < 1 {
+			cmd.ui.Error(fmt.Sprintf("error: invalid mapping %q, expected field=key", rule))
+			return SyntaxError
+		}
+		m.Keys[rule[:i]] = rule[i+1:]
+	}
+
+	items, err := cmd.load(args[0])
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: %v", args[0], err))
+		return CodecError
+	}
+	root := strings.Trim(cmd.resolve(args[1]), "/")
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	actions, conflicts, err := cmd.plan(client, root, m, items)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	if len(conflicts) > 0 && cmd.conflict == conflictFail {
+		for _, action := range conflicts {
+			cmd.ui.Error(fmt.Sprintf("conflict: %s has other values than %s", action.target, action.source))
+		}
+		cmd.ui.Error(fmt.Sprintf("error: %d conflicts; use -conflict skip or -conflict overwrite", len(conflicts)))
+		return ConflictError
+	} else if len(conflicts) > 0 && cmd.conflict == conflictOverwrite {
+		actions = append(actions, conflicts...)
+	} else if len(conflicts) > 0 {
+		cmd.ui.Warn(fmt.Sprintf("skipping %d conflicts", len(conflicts)))
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].target < actions[j].target })
+
+	if len(actions) == 0 {
+		cmd.ui.Info("nothing to import")
+		return Success
+	}
+	var changes []string
+	for _, action := range actions {
+		if action.create {
+			changes = append(changes, "+ "+action.target)
+		} else {
+			changes = append(changes, "~ "+action.target)
+		}
+	}
+	ok, err := cmd.confirmChanges(cmd.force, changes, "import %d items to %s?", len(actions), root)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return SystemError
+	} else if !ok {
+		return Success
+	}
+
+	progress := cmd.progress("importing", len(actions))
+	defer progress.Done()
+	for _, action := range actions {
+		if err = cmd.writeSecret(client, action.target, action.data); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", action.target, err))
+			return exitCode(err, ServerError)
+		}
+		progress.Add(1)
+	}
+
+	if !DryRun {
+		cmd.ui.Info(fmt.Sprintf("imported %d items to %s", len(actions), root))
+	}
+	return Success
+}
+
+// load parses the export file
+func (cmd *ImportCommand) load(name string) ([]importItem, error) {
+	format := cmd.format
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	}
+	switch {
+	case cmd.kind == "1password" && format == "1pux":
+		return parse1PUX(name)
+	case cmd.kind == "bitwarden" && format == "json":
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseBitwardenJSON(f, cmd.attachments)
+	case format == "csv":
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseImportCSV(f)
+	}
+	return nil, fmt.Errorf("unsupported format %q, use -format", format)
+}
+
+// plan returns the items that are written to the tree at root, and the ones
+// that conflict with existing secrets
+func (cmd *ImportCommand) plan(client *Client, root string, m *importMapping, items []importItem) (actions, conflicts []bridgeAction, err error) {
+	seen := make(map[string]string)
+	for _, item := range items {
+		rel := m.path(item)
+		if rel == "" {
+			return nil, nil, fmt.Errorf("item %q: empty path", item.Name)
+		}
+		if other, ok := seen[rel]; ok {
+			return nil, nil, fmt.Errorf("items %q and %q map to %s; add {id} to -path", other, item.Name, rel)
+		}
+		seen[rel] = item.Name
+
+		action := bridgeAction{source: item.Name, target: root + "/" + rel, data: m.data(item)}
+		if len(action.data) == 0 {
+			Debugf("import: %s has no fields", item.Name)
+			continue
+		}
+		secret, err := client.ReadSecret(action.target)
+		if err != nil {
+			return nil, nil, err
+		} else if secret == nil {
+			action.create = true
+			actions = append(actions, action)
+		} else if !bridgeEqual(secret.Data, action.data) {
+			conflicts = append(conflicts, action)
+		}
+	}
+	return
+}
+
+// bitwardenExport is a Bitwarden JSON export
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []struct {
+		ID       string `json:"id"`
+		FolderID string `json:"folderId"`
+		Name     string `json:"name"`
+		Notes    string `json:"notes"`
+		Login    *struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			TOTP     string `json:"totp"`
+			URIs     []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+		} `json:"login"`
+		Fields []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"fields"`
+	} `json:"items"`
+}
+
+// parseBitwardenJSON parses a Bitwarden JSON export; attachments are read
+// from the directory attachments, if not empty
+func parseBitwardenJSON(r io.Reader, attachments string) ([]importItem, error) {
+	var export bitwardenExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+	if export.Encrypted {
+		return nil, errors.New("encrypted exports are not supported")
+	}
+	folders := make(map[string]string, len(export.Folders))
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+
+	items := make([]importItem, 0, len(export.Items))
+	for _, v := range export.Items {
+		item := importItem{ID: v.ID, Vault: folders[v.FolderID], Name: v.Name}
+		if v.Login != nil {
+			item.set("username", v.Login.Username)
+			item.set("password", v.Login.Password)
+			item.set("totp", v.Login.TOTP)
+			for _, uri := range v.Login.URIs {
+				item.set("url", uri.URI)
+			}
+		}
+		item.set("notes", v.Notes)
+		for _, field := range v.Fields {
+			item.set(field.Name, field.Value)
+		}
+		if attachments != "" && v.ID != "" {
+			if err := attachFiles(&item, filepath.Join(attachments, v.ID)); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// attachFiles attaches the files in dir, if it exists
+func attachFiles(item *importItem, dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return err
+		}
+		item.attach(file.Name(), b)
+	}
+	return nil
+}
+
+// importColumns maps CSV columns of 1Password and Bitwarden exports to fields
+var importColumns = map[string]string{
+	"title":             "",
+	"name":              "",
+	"vault":             "",
+	"folder":            "",
+	"url":               "url",
+	"website":           "url",
+	"login_uri":         "url",
+	"username":          "username",
+	"login_username":    "username",
+	"password":          "password",
+	"login_password":    "password",
+	"otpauth":           "totp",
+	"one-time password": "totp",
+	"login_totp":        "totp",
+	"notes":             "notes",
+	"fields":            "",
+	"favorite":          "",
+	"archived":          "",
+	"tags":              "",
+	"type":              "",
+	"reprompt":          "",
+}
+
+// parseImportCSV parses a 1Password or Bitwarden CSV export; columns that are
+// not known are imported as fields named after the column
+func parseImportCSV(r io.Reader) ([]importItem, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+
+	var items []importItem
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		var item importItem
+		for i, value := range record {
+			if i >= len(header) {
+				break
+			}
+			column := header[i]
+			switch column {
+			case "title", "name":
+				item.Name = value
+			case "vault", "folder":
+				item.Vault = value
+			case "fields":
+				// Bitwarden custom fields, as "name: value" lines
+				for _, line := range strings.Split(value, "\n") {
+					if j := strings.Index(line, ": "); j > 0 {
+						item.set(line[:j], line[j+2:])
+					}
+				}
+			default:
+				field, known := importColumns[column]
+				if !known {
+					field = column
+				}
+				if field != "" {
+					item.set(field, value)
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// onePUXExport is the export.data of a 1Password 1PUX export
+type onePUXExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				UUID string `json:"uuid"`
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []onePUXItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type onePUXItem struct {
+	UUID     string `json:"uuid"`
+	State    string `json:"state"`
+	Overview struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	} `json:"overview"`
+	Details struct {
+		LoginFields []struct {
+			Name        string `json:"name"`
+			Value       string `json:"value"`
+			Designation string `json:"designation"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Fields []struct {
+				Title string                     `json:"title"`
+				ID    string                     `json:"id"`
+				Value map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+		DocumentAttributes *onePUXFile `json:"documentAttributes"`
+	} `json:"details"`
+}
+
+type onePUXFile struct {
+	FileName   string `json:"fileName"`
+	DocumentID string `json:"documentId"`
+}
+
+// parse1PUX parses a 1Password 1PUX export, a zip file with the items in
+// export.data and the attachments in files/
+func parse1PUX(name string) ([]importItem, error) {
+	z, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	files := make(map[string]*zip.File, len(z.File))
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+	readFile := func(name string) ([]byte, error) {
+		f, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: not found", name)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+
+	b, err := readFile("export.data")
+	if err != nil {
+		return nil, err
+	}
+	var export onePUXExport
+	if err = json.Unmarshal(b, &export); err != nil {
+		return nil, fmt.Errorf("export.data: %v", err)
+	}
+
+	var items []importItem
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, v := range vault.Items {
+				if v.State == "archived" {
+					continue
+				}
+				item, attachments, err := v.item(vault.Attrs.Name)
+				if err != nil {
+					return nil, err
+				}
+				for _, file := range attachments {
+					if b, err = readFile("files/" + file.DocumentID + "__" + file.FileName); err != nil {
+						return nil, fmt.Errorf("%s: %v", item.Name, err)
+					}
+					item.attach(file.FileName, b)
+				}
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+// item returns the fields of the item, and its attachments
+func (v onePUXItem) item(vault string) (importItem, []onePUXFile, error) {
+	var (
+		item        = importItem{ID: v.UUID, Vault: vault, Name: v.Overview.Title}
+		attachments []onePUXFile
+	)
+	for _, field := range v.Details.LoginFields {
+		switch field.Designation {
+		case "username", "password":
+			item.set(field.Designation, field.Value)
+		}
+	}
+	item.set("password", v.Details.Password)
+	item.set("url", v.Overview.URL)
+	for _, section := range v.Details.Sections {
+		for _, field := range section.Fields {
+			name := field.Title
+			if name == "" {
+				name = field.ID
+			}
+			for kind, raw := range field.Value {
+				switch kind {
+				case "file":
+					var file onePUXFile
+					if err := json.Unmarshal(raw, &file); err != nil {
+						return item, nil, fmt.Errorf("%s: %s: %v", item.Name, name, err)
+					}
+					attachments = append(attachments, file)
+				case "totp":
+					var value string
+					json.Unmarshal(raw, &value)
+					item.set("totp", value)
+				default:
+					// Strings, or other values such as dates as JSON
+					var value string
+					if err := json.Unmarshal(raw, &value); err != nil {
+						value = string(raw)
+					}
+					item.set(name, value)
+				}
+			}
+		}
+	}
+	item.set("notes", v.Details.NotesPlain)
+	if v.Details.DocumentAttributes != nil {
+		attachments = append(attachments, *v.Details.DocumentAttributes)
+	}
+	return item, attachments, nil
+}
+
+func (cmd *ImportCommand) Synopsis() string {
+	return "import the items of a " + cmd.kind + " export"
+}
+
+func ImportCommandFactory(ui cli.Ui, kind string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &ImportCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			kind: kind,
+		}
+
+		cmd.fs = flag.NewFlagSet("import "+kind, flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.path, "path", DefaultImportPath, "path template for items")
+		cmd.fs.StringVar(&cmd.format, "format", "", "export format (default: from the file extension)")
+		if kind == "bitwarden" {
+			cmd.fs.StringVar(&cmd.attachments, "attachments", "", "directory with the attachments")
+		}
+		cmd.fs.Var(&cmd.mapping, "map", "map a field to a key, as field=key (can be repeated)")
+		cmd.fs.StringVar(&cmd.conflict, "conflict", conflictFail, "conflict policy (fail, skip or overwrite)")
+		cmd.fs.BoolVar(&cmd.force, "f", false, "import without confirmation")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,169 @@
+package vc
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBitwardenJSON(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "import")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(filepath.Join(dir, "1"), 0700); err != nil {
+		t.Skip(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "1", "key.bin"), []byte{0x00, 0xff}, 0600); err != nil {
+		t.Skip(err)
+	}
+
+	items, err := parseBitwardenJSON(strings.NewReader(`{
+  "encrypted": false,
+  "folders": [{"id": "f", "name": "Work"}],
+  "items": [
+    {"id": "1", "folderId": "f", "name": "Mail", "notes": "note",
+     "login": {"username": "test", "password": "secret", "uris": [{"uri": "https://a"}, {"uri": "https://b"}]},
+     "fields": [{"name": "pin", "value": "1234"}]},
+    {"id": "2", "folderId": null, "name": "Other", "login": {"password": "x"}}
+  ]
+}`), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []importItem{
+		{ID: "1", Vault: "Work", Name: "Mail", Fields: map[string]string{
+			"username":       "test",
+			"password":       "secret",
+			"url":            "https://a",
+			"url_2":          "https://b",
+			"notes":          "note",
+			"pin":            "1234",
+			"key.bin_base64": "AP8=",
+		}},
+		{ID: "2", Name: "Other", Fields: map[string]string{"password": "x"}},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("expected %+v, got %+v", want, items)
+	}
+
+	if _, err = parseBitwardenJSON(strings.NewReader(`{"encrypted": true}`), ""); err == nil {
+		t.Fatal("expected error for encrypted export")
+	}
+}
+
+func TestParseImportCSV(t *testing.T) {
+	tests := []struct {
+		Name string
+		CSV  string
+		Want []importItem
+	}{
+		{
+			"bitwarden",
+			"folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+				"Work,,login,Mail,note,\"pin: 1234\nkey: value\",0,https://a,test,secret,otp\n",
+			[]importItem{{Vault: "Work", Name: "Mail", Fields: map[string]string{
+				"notes": "note", "pin": "1234", "key": "value", "url": "https://a",
+				"username": "test", "password": "secret", "totp": "otp",
+			}}},
+		},
+		{
+			"1password",
+			"\ufeffTitle,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\n" +
+				"Mail,https://a,test,secret,,false,false,,\n",
+			[]importItem{{Name: "Mail", Fields: map[string]string{
+				"url": "https://a", "username": "test", "password": "secret",
+			}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			items, err := parseImportCSV(strings.NewReader(test.CSV))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(items, test.Want) {
+				t.Fatalf("expected %+v, got %+v", test.Want, items)
+			}
+		})
+	}
+}
+
+func TestParse1PUX(t *testing.T) {
+	f, err := ioutil.TempFile(os.TempDir(), "import")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.Remove(f.Name())
+
+	z := zip.NewWriter(f)
+	for name, content := range map[string]string{
+		"export.data": `{"accounts": [{"vaults": [{"attrs": {"name": "Private"}, "items": [
+  {"uuid": "u1", "overview": {"title": "Mail", "url": "https://a"},
+   "details": {"loginFields": [
+     {"designation": "username", "value": "test"},
+     {"designation": "password", "value": "secret"}],
+    "notesPlain": "note",
+    "sections": [{"fields": [
+      {"title": "pin", "value": {"concealed": "1234"}},
+      {"title": "otp", "value": {"totp": "otpauth://totp/x"}},
+      {"title": "key", "value": {"file": {"fileName": "key.bin", "documentId": "d1"}}}]}]}},
+  {"uuid": "u2", "state": "archived", "overview": {"title": "Old"}}
+]}]}]}`,
+		"files/d1__key.bin": "\x00\xff",
+	} {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err = z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	items, err := parse1PUX(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []importItem{{ID: "u1", Vault: "Private", Name: "Mail", Fields: map[string]string{
+		"username":       "test",
+		"password":       "secret",
+		"url":            "https://a",
+		"notes":          "note",
+		"pin":            "1234",
+		"totp":           "otpauth://totp/x",
+		"key.bin_base64": "AP8=",
+	}}}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("expected %+v, got %+v", want, items)
+	}
+}
+
+func TestImportMapping(t *testing.T) {
+	m := &importMapping{
+		Path: DefaultImportPath,
+		Keys: map[string]string{"username": "user", "notes": ""},
+	}
+	item := importItem{ID: "1", Vault: "Work", Name: "a/b", Fields: map[string]string{
+		"username": "test",
+		"password": "secret",
+		"notes":    "note",
+	}}
+	if got, want := m.path(item), "Work/a-b"; got != want {
+		t.Fatalf("path: expected %q, got %q", want, got)
+	}
+	if got, want := m.path(importItem{Name: "Mail"}), "Mail"; got != want {
+		t.Fatalf("path without vault: expected %q, got %q", want, got)
+	}
+	want := map[string]interface{}{"user": "test", "password": "secret"}
+	if got := m.data(item); !reflect.DeepEqual(got, want) {
+		t.Fatalf("data: expected %v, got %v", want, got)
+	}
+}
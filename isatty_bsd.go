@@ -7,7 +7,10 @@ import (
 	"unsafe"
 )
 
-const ioctlReadTermios = syscall.TIOCGETA
+const (
+	ioctlReadTermios  = syscall.TIOCGETA
+	ioctlWriteTermios = syscall.TIOCSETA
+)
 
 // IsTerminal return true if the file descriptor is terminal.
 func IsTerminal(fd uintptr) bool {
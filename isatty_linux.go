@@ -7,7 +7,10 @@ import (
 	"unsafe"
 )
 
-const ioctlReadTermios = syscall.TCGETS
+const (
+	ioctlReadTermios  = syscall.TCGETS
+	ioctlWriteTermios = syscall.TCSETS
+)
 
 // IsTerminal return true if the file descriptor is terminal.
 func IsTerminal(fd uintptr) bool {
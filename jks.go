@@ -0,0 +1,148 @@
+package vc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Java KeyStore (JKS) format constants
+const (
+	jksMagic       = 0xfeedfeed
+	jksVersion     = 2
+	jksPrivateKey  = 1
+	jksTrustedCert = 2
+	jksDigestSalt  = "Mighty Aphrodite"
+)
+
+// oidJKSKeyProtector is the Sun proprietary key protection algorithm, used
+// for the private keys in a JKS keystore
+var oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// encodeJKS encodes the keystore in the Java KeyStore format; the keys and
+// the integrity of the keystore are protected with password
+func encodeJKS(ks *keystore, password string) ([]byte, error) {
+	pass := jksPassword(password)
+	defer wipe(pass)
+
+	var (
+		b         = new(bytes.Buffer)
+		timestamp = ks.created.UnixNano() / 1e6
+		seen      = make(map[string]bool)
+	)
+	binary.Write(b, binary.BigEndian, uint32(jksMagic))
+	binary.Write(b, binary.BigEndian, uint32(jksVersion))
+	binary.Write(b, binary.BigEndian, uint32(len(ks.entries)))
+	for _, entry := range ks.entries {
+		// Aliases are case insensitive, the JDK stores them lowercased
+		alias := strings.ToLower(entry.alias)
+		if seen[alias] {
+			return nil, fmt.Errorf("jks: duplicate alias %q", alias)
+		}
+		seen[alias] = true
+
+		if entry.key == nil {
+			binary.Write(b, binary.BigEndian, uint32(jksTrustedCert))
+			if err := jksWriteUTF(b, alias); err != nil {
+				return nil, err
+			}
+			binary.Write(b, binary.BigEndian, timestamp)
+			jksWriteCert(b, entry.chain[0].Raw)
+			continue
+		}
+
+		protected, err := jksProtectKey(entry.key, pass)
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(b, binary.BigEndian, uint32(jksPrivateKey))
+		if err = jksWriteUTF(b, alias); err != nil {
+			return nil, err
+		}
+		binary.Write(b, binary.BigEndian, timestamp)
+		binary.Write(b, binary.BigEndian, uint32(len(protected)))
+		b.Write(protected)
+		binary.Write(b, binary.BigEndian, uint32(len(entry.chain)))
+		for _, cert := range entry.chain {
+			jksWriteCert(b, cert.Raw)
+		}
+	}
+
+	h := sha1.New()
+	h.Write(pass)
+	h.Write([]byte(jksDigestSalt))
+	h.Write(b.Bytes())
+	b.Write(h.Sum(nil))
+	return b.Bytes(), nil
+}
+
+// jksProtectKey encrypts the PKCS#8 encoded key as the JDK KeyProtector does:
+// the key is XORed with a SHA-1 based key stream, and followed by a SHA-1
+// checksum of the password and the key
+func jksProtectKey(key, pass []byte) ([]byte, error) {
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	protected := make([]byte, 0, 2*sha1.Size+len(key))
+	protected = append(protected, salt...)
+	digest := salt
+	for i := 0; i < len(key); i += sha1.Size {
+		h := sha1.New()
+		h.Write(pass)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for j := 0; j < sha1.Size && i+j < len(key); j++ {
+			protected = append(protected, key[i+j]^digest[j])
+		}
+	}
+	h := sha1.New()
+	h.Write(pass)
+	h.Write(key)
+	protected = h.Sum(protected)
+
+	return asn1.Marshal(pkcs12EncryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidJKSKeyProtector, Parameters: asn1.NullRawValue},
+		Data:      protected,
+	})
+}
+
+func jksWriteCert(b *bytes.Buffer, der []byte) {
+	jksWriteUTF(b, "X.509")
+	binary.Write(b, binary.BigEndian, uint32(len(der)))
+	b.Write(der)
+}
+
+// jksWriteUTF writes s in the modified UTF-8 of Java's DataOutput.writeUTF
+func jksWriteUTF(b *bytes.Buffer, s string) error {
+	var out []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		switch {
+		case c >= 0x01 && c <= 0x7f:
+			out = append(out, byte(c))
+		case c <= 0x7ff:
+			out = append(out, byte(0xc0|c>>6), byte(0x80|c&0x3f))
+		default:
+			out = append(out, byte(0xe0|c>>12), byte(0x80|(c>>6)&0x3f), byte(0x80|c&0x3f))
+		}
+	}
+	if len(out) > 0xffff {
+		return errors.New("jks: string too long")
+	}
+	binary.Write(b, binary.BigEndian, uint16(len(out)))
+	b.Write(out)
+	return nil
+}
+
+// jksPassword returns the password as UTF-16 big endian, without terminator
+func jksPassword(password string) []byte {
+	return pkcs12BMPString(password)
+}
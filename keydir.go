@@ -0,0 +1,194 @@
+package vc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// keyFiles returns the contents of a file for each key of data, for a
+// directory with one file per key, like a Kubernetes secret volume: strings
+// are written as-is, binary values (see binaryKeySuffix) are decoded to a file
+// without the suffix, and other values are JSON encoded
+func keyFiles(data map[string]interface{}) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(data))
+	for _, key := range sortedKeys(data) {
+		if key == CodecTypeKey {
+			continue
+		}
+		var (
+			name = key
+			b    []byte
+			err  error
+		)
+		switch value := data[key].(type) {
+		case string:
+			if strings.HasSuffix(key, binaryKeySuffix) {
+				name = strings.TrimSuffix(key, binaryKeySuffix)
+				if b, err = base64.StdEncoding.DecodeString(value); err != nil {
+					return nil, fmt.Errorf("key %q: %v", key, err)
+				}
+			} else {
+				b = []byte(value)
+			}
+		default:
+			if b, err = json.Marshal(value); err != nil {
+				return nil, fmt.Errorf("key %q: %v", key, err)
+			}
+		}
+		if !keyFileName(name) {
+			return nil, fmt.Errorf("key %q can't be used as a file name", key)
+		} else if _, exists := files[name]; exists {
+			return nil, fmt.Errorf("key %q and %q are both written to %s", name, name+binaryKeySuffix, name)
+		}
+		files[name] = b
+	}
+	return files, nil
+}
+
+// keyDirState is the hidden file in a directory of key files with the names
+// of the files vc wrote there, so -clean only removes those
+const keyDirState = ".vc-keys"
+
+// keyDirFiles is the content of keyDirState
+type keyDirFiles struct {
+	Files []string `json:"files"`
+}
+
+// keyFileName checks if name can be the name of a key file
+func keyFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && name != keyDirState && !strings.ContainsAny(name, `/\`)
+}
+
+// loadKeyDirState returns the names of the files vc wrote in dir, a missing
+// state file has none
+func loadKeyDirState(dir string) ([]string, error) {
+	name := filepath.Join(dir, keyDirState)
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state keyDirFiles
+	if err = json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	names := state.Files[:0]
+	for _, file := range state.Files {
+		if keyFileName(file) {
+			names = append(names, file)
+		}
+	}
+	return names, nil
+}
+
+// saveKeyDirState writes the names of the files vc wrote in dir
+func saveKeyDirState(dir string, names []string) error {
+	b, err := json.MarshalIndent(keyDirFiles{Files: names}, "", "  ")
+	if err != nil {
+		return err
+	}
+	w := SafeOutputWriter(filepath.Join(dir, keyDirState), 0600)
+	if _, err = w.Write(append(b, '\n')); err != nil {
+		w.(*safeOutputWriter).abort()
+		return err
+	}
+	return w.Close()
+}
+
+// runDir writes each key of the secret to its own file in cmd.dir; with
+// cmd.clean, the files vc wrote earlier for keys that no longer exist are
+// removed, see keyDirState
+func (cmd *CatCommand) runDir(path string, s *api.Secret) int {
+	files, err := keyFiles(s.Data)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: %v", path, err))
+		return CodecError
+	}
+	defer func() {
+		for _, b := range files {
+			wipe(b)
+		}
+	}()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !DryRun {
+		if err = cmd.checkWritableDir(cmd.dir, append([]string{keyDirState}, names...)); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return exitCode(err, SystemError)
+		}
+		if err = os.MkdirAll(cmd.dir, 0700); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	}
+	written, err := loadKeyDirState(cmd.dir)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	for _, name := range names {
+		w := cmd.outputWriter(filepath.Join(cmd.dir, name), cmd.mode)
+		if _, err = w.Write(files[name]); err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	}
+
+	// Files of keys that no longer exist are kept in the state until removed
+	state := names
+	for _, file := range written {
+		if _, ok := files[file]; ok {
+			continue
+		}
+		name := filepath.Join(cmd.dir, file)
+		info, err := os.Lstat(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+		if !cmd.clean || !info.Mode().IsRegular() {
+			state = append(state, file)
+			continue
+		}
+		if DryRun {
+			cmd.ui.Output("dry run: remove " + name)
+			continue
+		}
+		if err = cmd.checkWritable(name); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return exitCode(err, SystemError)
+		}
+		Debugf("cat: remove %s", name)
+		if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	}
+	if DryRun {
+		return Success
+	}
+	sort.Strings(state)
+	if err = saveKeyDirState(cmd.dir, state); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	return Success
+}
@@ -0,0 +1,123 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestKeyFiles(t *testing.T) {
+	files, err := keyFiles(map[string]interface{}{
+		CodecTypeKey:                 "json",
+		"password":                   "s3cr3t",
+		"port":                       json.Number("5432"),
+		"keystore" + binaryKeySuffix: "AAEC",
+		"hosts":                      []interface{}{"a", "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{
+		"password": []byte("s3cr3t"),
+		"port":     []byte("5432"),
+		"keystore": {0, 1, 2},
+		"hosts":    []byte(`["a","b"]`),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("expected %q, got %q", want, files)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"../passwd": "x"},
+		{"..": "x"},
+		{"key": "x", "key" + binaryKeySuffix: "AAEC"},
+		{"key" + binaryKeySuffix: "not base64"},
+		{keyDirState: "x"},
+	} {
+		if _, err = keyFiles(data); err == nil {
+			t.Errorf("%v: expected error", data)
+		}
+	}
+}
+
+func TestCatCommandDir(t *testing.T) {
+	data := map[string]interface{}{"username": "app", "password": "s3cr3t", "token": "old"}
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/secret/app/db":
+			response = map[string]interface{}{"data": data}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	dir, err := ioutil.TempDir("", "vc-keydir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{"app.conf": "port=5432", ".keep": ""} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(args ...string) {
+		t.Helper()
+		ui := cli.NewMockUi()
+		command, _ := CatCommandFactory(ui)()
+		cmd := command.(*CatCommand)
+		cmd.c, cmd.config = c, new(Config)
+		if code := cmd.Run(args); code != Success {
+			t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+		}
+	}
+	run("-dir", dir, "secret/app/db")
+	delete(data, "token")
+
+	// Only the files written for keys that no longer exist are removed
+	for _, clean := range []bool{false, true} {
+		ui := cli.NewMockUi()
+		command, _ := CatCommandFactory(ui)()
+		cmd := command.(*CatCommand)
+		cmd.c, cmd.config = c, new(Config)
+		args := []string{"-dir", dir, "secret/app/db"}
+		if clean {
+			args = append([]string{"-clean"}, args...)
+		}
+		if code := cmd.Run(args); code != Success {
+			t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+		}
+
+		var names []string
+		infos, _ := ioutil.ReadDir(dir)
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		want := []string{".keep", ".vc-keys", "app.conf", "password", "token", "username"}
+		if clean {
+			want = []string{".keep", ".vc-keys", "app.conf", "password", "username"}
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Fatalf("clean=%t: expected %v, got %v", clean, want, names)
+		}
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "password")); string(b) != "s3cr3t" {
+		t.Fatalf("expected password s3cr3t, got %q", b)
+	}
+
+	ui := cli.NewMockUi()
+	command, _ := CatCommandFactory(ui)()
+	if code := command.Run([]string{"-dir", dir, "-k", "password", "secret/app/db"}); code != SyntaxError {
+		t.Fatalf("expected exit code %d, got %d", SyntaxError, code)
+	}
+}
@@ -0,0 +1,243 @@
+package vc
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+// Keys of the secret holding an SSH keypair
+const (
+	sshPrivateKey = "private_key"
+	sshPublicKey  = "public_key"
+	sshSignedKey  = "signed_key"
+)
+
+// KeygenCommand generates keypairs and stores them in Vault
+type KeygenCommand struct {
+	baseCommand
+	fs         *flag.FlagSet
+	sub        string
+	keyType    string
+	bits       int
+	comment    string
+	public     string
+	sign       string
+	principals string
+	ttl        string
+	force      bool
+}
+
+func (cmd *KeygenCommand) Help() string {
+	return `Usage: vc keygen ssh [<options>] <secret path>
+
+Generates an SSH keypair, stores it in the secret at path (in keys
+` + sshPrivateKey + ` and ` + sshPublicKey + `) and writes the public key to a file. With -sign,
+the public key is signed by the SSH secrets engine and the certificate is
+stored in key ` + sshSignedKey + ` and written next to the public key.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *KeygenCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.fs.Args(); len(args) != 1 || cmd.sub != "ssh" {
+		return Help
+	}
+	path := strings.TrimLeft(cmd.resolve(args[0]), "/")
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	secret, err := client.Read(path)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+
+	private, public, err := generateSSHKey(cmd.keyType, cmd.bits, cmd.comment)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	data := map[string]interface{}{
+		sshPrivateKey: private,
+		sshPublicKey:  public,
+	}
+
+	if cmd.sign != "" {
+		// The certificate is requested once the changes are confirmed
+		data[sshSignedKey] = ""
+	}
+
+	if secret != nil {
+		ok, err := cmd.confirmChanges(cmd.force, describeChanges(secret.Data, data), "secret at %s already exists, overwrite?", path)
+		if err != nil {
+			cmd.ui.Error(err.Error())
+			return SystemError
+		} else if !ok {
+			return Success
+		}
+	}
+
+	if cmd.sign != "" && DryRun {
+		cmd.ui.Output("dry run: sign the public key with " + cmd.sign)
+	} else if cmd.sign != "" {
+		signed, err := signSSHKey(client, cmd.sign, public, cmd.principals, cmd.ttl)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return exitCode(err, ServerError)
+		}
+		data[sshSignedKey] = signed
+	}
+
+	if err = cmd.writeSecret(client, path, data); err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+
+	if cmd.public != "" {
+		if err = cmd.writeFile(cmd.public, public); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+		if signed, ok := data[sshSignedKey].(string); ok {
+			if err = cmd.writeFile(certificateName(cmd.public), signed); err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %v", err))
+				return SystemError
+			}
+		}
+	}
+
+	cmd.ui.Info(fmt.Sprintf("generated %s key stored in secret %s", cmd.keyType, path))
+	return Success
+}
+
+// signSSHKey has the public key signed by the SSH secrets engine at path
+func signSSHKey(client *Client, path, public, principals, ttl string) (string, error) {
+	data := map[string]interface{}{
+		"public_key": public,
+	}
+	if principals != "" {
+		data["valid_principals"] = principals
+	}
+	if ttl != "" {
+		data["ttl"] = ttl
+	}
+
+	secret, err := client.Write(path, data)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("%s: no signed key returned", path)
+	}
+	signed, ok := secret.Data["signed_key"].(string)
+	if !ok {
+		return "", fmt.Errorf("%s: no signed key returned", path)
+	}
+	return strings.TrimSpace(signed) + "\n", nil
+}
+
+// writeFile writes a public key or certificate to the file name
+func (cmd *KeygenCommand) writeFile(name, data string) error {
+	w := cmd.outputWriter(name, 0644)
+	if _, err := w.Write([]byte(data)); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// certificateName returns the name of the certificate for a public key file,
+// following the OpenSSH convention (id_ed25519.pub has id_ed25519-cert.pub)
+func certificateName(public string) string {
+	return strings.TrimSuffix(public, ".pub") + "-cert.pub"
+}
+
+// generateSSHKey generates a keypair of keyType ("ed25519" or "rsa"), it
+// returns the private key in OpenSSH format and the public key in
+// authorized_keys format
+func generateSSHKey(keyType string, bits int, comment string) (private, public string, err error) {
+	var key crypto.Signer
+	switch keyType {
+	case "ed25519":
+		if _, key, err = ed25519.GenerateKey(rand.Reader); err != nil {
+			return
+		}
+	case "rsa":
+		if bits < 2048 {
+			return "", "", fmt.Errorf("rsa: %d bits is too small, use at least 2048", bits)
+		}
+		if key, err = rsa.GenerateKey(rand.Reader, bits); err != nil {
+			return
+		}
+	default:
+		return "", "", fmt.Errorf("unsupported key type %q", keyType)
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, comment)
+	if err != nil {
+		return
+	}
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return
+	}
+
+	public = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		public += " " + comment
+	}
+	return string(pem.EncodeToMemory(block)), public + "\n", nil
+}
+
+func (cmd *KeygenCommand) Synopsis() string {
+	return "generate an " + cmd.sub + " keypair"
+}
+
+func KeygenCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &KeygenCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+		}
+
+		comment := os.Getenv("USER")
+		if host, err := os.Hostname(); err == nil && comment != "" {
+			comment += "@" + host
+		}
+
+		cmd.fs = flag.NewFlagSet("keygen "+sub, flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.keyType, "t", "ed25519", "key type (ed25519 or rsa)")
+		cmd.fs.IntVar(&cmd.bits, "b", 4096, "key size in bits (rsa)")
+		cmd.fs.StringVar(&cmd.comment, "C", comment, "comment")
+		cmd.fs.StringVar(&cmd.public, "o", "", "write the public key to file")
+		cmd.fs.StringVar(&cmd.sign, "sign", "", "sign with the SSH secrets engine, such as ssh-client-signer/sign/my-role")
+		cmd.fs.StringVar(&cmd.principals, "principals", "", "valid principals of the certificate, comma separated")
+		cmd.fs.StringVar(&cmd.ttl, "ttl", "", "TTL of the certificate")
+		cmd.fs.BoolVar(&cmd.force, "f", false, "force overwrite")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,99 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateSSHKey(t *testing.T) {
+	for _, keyType := range []string{"ed25519", "rsa"} {
+		private, public, err := generateSSHKey(keyType, 2048, "test@example.org")
+		if err != nil {
+			t.Fatalf("%s: %v", keyType, err)
+		}
+
+		signer, err := ssh.ParsePrivateKey([]byte(private))
+		if err != nil {
+			t.Fatalf("%s: private key: %v", keyType, err)
+		}
+		pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(public))
+		if err != nil {
+			t.Fatalf("%s: public key: %v", keyType, err)
+		}
+		if comment != "test@example.org" {
+			t.Fatalf("%s: expected comment %q, got %q", keyType, "test@example.org", comment)
+		}
+		if string(pub.Marshal()) != string(signer.PublicKey().Marshal()) {
+			t.Fatalf("%s: public key doesn't match private key", keyType)
+		}
+		if !strings.HasSuffix(public, "\n") {
+			t.Fatalf("%s: expected newline after public key", keyType)
+		}
+	}
+
+	if _, _, err := generateSSHKey("rsa", 1024, ""); err == nil {
+		t.Fatal("expected error for small RSA key")
+	}
+	if _, _, err := generateSSHKey("dsa", 0, ""); err == nil {
+		t.Fatal("expected error for unsupported key type")
+	}
+	if name := certificateName("id_ed25519.pub"); name != "id_ed25519-cert.pub" {
+		t.Fatalf("expected id_ed25519-cert.pub, got %q", name)
+	}
+}
+
+func TestKeygenCommandSign(t *testing.T) {
+	var signed, writes int
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/secret/app/ssh":
+			response = map[string]interface{}{"data": map[string]interface{}{sshPublicKey: "ssh-ed25519 old"}}
+		case "PUT /v1/secret/app/ssh", "POST /v1/secret/app/ssh":
+			writes++
+		case "PUT /v1/ssh/sign/app", "POST /v1/ssh/sign/app":
+			signed++
+			response = map[string]interface{}{"data": map[string]interface{}{"signed_key": "ssh-ed25519-cert-v01@openssh.com AAAA"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	run := func(args ...string) (*cli.MockUi, int) {
+		ui := cli.NewMockUi()
+		command, _ := KeygenCommandFactory(ui, "ssh")()
+		cmd := command.(*KeygenCommand)
+		cmd.c, cmd.config = c, new(Config)
+		return ui, cmd.Run(append(args, "secret/app/ssh"))
+	}
+
+	// Without confirmation, no certificate is issued
+	if ui, code := run("-sign", "ssh/sign/app"); code == Success {
+		t.Fatalf("expected the overwrite to need confirmation: %s", ui.OutputWriter.String())
+	}
+	DryRun = true
+	ui, code := run("-sign", "ssh/sign/app")
+	DryRun = false
+	if code != Success {
+		t.Fatalf("dry run: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	} else if !strings.Contains(ui.OutputWriter.String(), "dry run: sign the public key with ssh/sign/app") {
+		t.Fatalf("dry run: expected the signing in the output, got %q", ui.OutputWriter.String())
+	}
+	if signed != 0 || writes != 0 {
+		t.Fatalf("expected no certificates and writes, got %d and %d", signed, writes)
+	}
+
+	if ui, code = run("-f", "-sign", "ssh/sign/app"); code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if signed != 1 || writes != 1 {
+		t.Fatalf("expected a certificate and a write, got %d and %d", signed, writes)
+	}
+}
@@ -0,0 +1,381 @@
+package vc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// keystore holds the entries of a Java keystore: private keys with their
+// certificate chain, and trusted certificates
+type keystore struct {
+	entries []keystoreEntry
+	created time.Time
+}
+
+// keystoreEntry is a private key (PKCS#8 encoded) with its certificate chain
+// from the leaf up, or a trusted certificate if key is nil
+type keystoreEntry struct {
+	alias string
+	key   []byte
+	chain []*x509.Certificate
+}
+
+// wipe wipes the private keys
+func (ks *keystore) wipe() {
+	for _, entry := range ks.entries {
+		wipe(entry.key)
+	}
+}
+
+// buildKeystore builds a keystore from the PEM blocks in bundles: the private
+// key (if any) gets alias, with the chain of its certificate. Certificates that
+// are not in the chain are added as trusted certificates, named alias-<n> (or
+// alias if it's the only entry).
+func buildKeystore(alias string, bundles []string) (*keystore, error) {
+	var (
+		certs []*x509.Certificate
+		seen  = make(map[string]bool)
+		key   interface{}
+	)
+	for _, bundle := range bundles {
+		for rest := []byte(bundle); ; {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			switch block.Type {
+			case "CERTIFICATE":
+				if seen[string(block.Bytes)] {
+					continue
+				}
+				seen[string(block.Bytes)] = true
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				certs = append(certs, cert)
+			case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+				if key != nil {
+					return nil, errors.New("more than one private key")
+				}
+				var err error
+				if key, err = parsePrivateKey(block); err != nil {
+					return nil, err
+				}
+				wipe(block.Bytes)
+			case "ENCRYPTED PRIVATE KEY":
+				return nil, errors.New("encrypted private keys are not supported")
+			}
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates")
+	}
+
+	var (
+		ks    = &keystore{created: time.Now()}
+		inKey = make(map[int]bool)
+	)
+	if key != nil {
+		leaf := -1
+		for i, cert := range certs {
+			if publicKeyMatches(cert, key) {
+				leaf = i
+				break
+			}
+		}
+		if leaf < 0 {
+			return nil, errors.New("no certificate for the private key")
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		entry := keystoreEntry{alias: alias, key: der}
+		for _, i := range certChain(certs, leaf) {
+			inKey[i] = true
+			entry.chain = append(entry.chain, certs[i])
+		}
+		ks.entries = append(ks.entries, entry)
+	}
+
+	trusted, n := len(certs)-len(inKey), 0
+	for i, cert := range certs {
+		if inKey[i] {
+			continue
+		}
+		n++
+		name := alias
+		if key != nil || trusted > 1 {
+			name = alias + "-" + strconv.Itoa(n)
+		}
+		ks.entries = append(ks.entries, keystoreEntry{alias: name, chain: []*x509.Certificate{cert}})
+	}
+	return ks, nil
+}
+
+// parsePrivateKey parses a PKCS#8, PKCS#1 (RSA) or SEC 1 (EC) private key
+func parsePrivateKey(block *pem.Block) (interface{}, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
+
+// publicKeyMatches reports whether cert is the certificate of key
+func publicKeyMatches(cert *x509.Certificate, key interface{}) bool {
+	signer, ok := key.(interface {
+		Public() crypto.PublicKey
+	})
+	if !ok {
+		return false
+	}
+	a, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return false
+	}
+	b, err := x509.MarshalPKIXPublicKey(signer.Public())
+	return err == nil && bytes.Equal(a, b)
+}
+
+// keystorePEM returns the string values (and lists of strings, such as the
+// ca_chain of the PKI secrets engine) of data, sorted by key
+func keystorePEM(data map[string]interface{}) []string {
+	var values []string
+	for _, key := range sortedKeys(data) {
+		switch v := data[key].(type) {
+		case string:
+			values = append(values, v)
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// KeystoreCommand writes certificates and keys to a Java keystore
+type KeystoreCommand struct {
+	baseCommand
+	fs        *flag.FlagSet
+	storeType string
+	alias     string
+	password  string
+	cn        string
+	altNames  string
+	ttl       string
+	mod       string
+}
+
+func (cmd *KeystoreCommand) Help() string {
+	return `Usage: vc keystore [<options>] -o <file> -password <path>:<key> <secret path> [... <secret path>]
+
+Assemble the certificates and the private key in the secrets into a PKCS#12 or
+JKS keystore, for Java applications. The PEM encoded certificates and key can
+be in any key of the secrets, such as the certificate, ca_chain and
+private_key of the PKI secrets engine. The key is stored under -alias with the
+chain of its certificate, other certificates are stored as trusted
+certificates. Without a private key, the keystore is a truststore.
+
+With -cn, a new certificate is issued by writing to the secret path, such as
+pki/issue/<role>. The store password is read from the key of the secret given
+with -password. The keystore is replaced atomically.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *KeystoreCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) == 0 {
+		return Help
+	}
+	if cmd.out == "" || cmd.password == "" {
+		cmd.ui.Error("error: -o and -password are required")
+		return SyntaxError
+	}
+	if cmd.cn != "" && len(args) != 1 {
+		cmd.ui.Error("error: -cn takes a single PKI path")
+		return SyntaxError
+	}
+	if mode, err := cmd.outputMode(cmd.fs, cmd.mod); err != nil {
+		cmd.ui.Error("error: " + err.Error())
+		return SyntaxError
+	} else {
+		cmd.mode = mode
+	}
+	if cmd.storeType == "" {
+		cmd.storeType = "pkcs12"
+		if strings.HasSuffix(strings.ToLower(cmd.out), ".jks") {
+			cmd.storeType = "jks"
+		}
+	}
+	encode := encodePKCS12
+	switch cmd.storeType {
+	case "pkcs12", "p12":
+	case "jks":
+		encode = encodeJKS
+	default:
+		cmd.ui.Error(fmt.Sprintf("error: unsupported keystore type %q, use pkcs12 or jks", cmd.storeType))
+		return SyntaxError
+	}
+	if cmd.alias == "" {
+		cmd.alias = path.Base(strings.TrimRight(args[0], "/"))
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	password, err := cmd.readPassword(client)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: -password: %v", err))
+		return exitCode(err, ServerError)
+	}
+
+	var bundles []string
+	if cmd.cn != "" {
+		if DryRun {
+			cmd.ui.Output(fmt.Sprintf("dry run: issue a certificate for %s at %s, write %s keystore %s", cmd.cn, args[0], cmd.storeType, cmd.out))
+			return Success
+		}
+		data := map[string]interface{}{"common_name": cmd.cn}
+		if cmd.altNames != "" {
+			data["alt_names"] = cmd.altNames
+		}
+		if cmd.ttl != "" {
+			data["ttl"] = cmd.ttl
+		}
+		secret, err := client.Write(strings.TrimLeft(args[0], "/"), data)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", args[0], err))
+			return exitCode(err, ServerError)
+		} else if secret == nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: no certificate issued", args[0]))
+			return ServerError
+		}
+		bundles = keystorePEM(secret.Data)
+	} else {
+		if args, err = client.expand(args, isSecret); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return exitCode(err, SyntaxError)
+		}
+		for _, path := range args {
+			secret, err := cmd.readSource(path, client.ReadSecret)
+			if err != nil {
+				cmd.ui.Error(err.Error())
+				return exitCode(err, ServerError)
+			} else if secret == nil {
+				cmd.ui.Error(fmt.Sprintf("error: %s: secret not found", path))
+				return NotFoundError
+			}
+			bundles = append(bundles, keystorePEM(secret.Data)...)
+		}
+	}
+
+	ks, err := buildKeystore(cmd.alias, bundles)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: %v", strings.Join(args, ", "), err))
+		return CodecError
+	}
+	defer ks.wipe()
+	aliases := make([]string, len(ks.entries))
+	for i, entry := range ks.entries {
+		aliases[i] = entry.alias
+	}
+	if DryRun {
+		cmd.ui.Output(fmt.Sprintf("dry run: write %s keystore %s with %s", cmd.storeType, cmd.out, strings.Join(aliases, ", ")))
+		return Success
+	}
+
+	b, err := encode(ks, password)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return CodecError
+	}
+	defer wipe(b)
+	if _, err = cmd.Write(b); err != nil {
+		cmd.abort()
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if err = cmd.Close(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	cmd.ui.Info(fmt.Sprintf("wrote %s keystore %s with %s", cmd.storeType, cmd.out, strings.Join(aliases, ", ")))
+	return Success
+}
+
+// readPassword reads the store password from the secret and key in -password
+func (cmd *KeystoreCommand) readPassword(client *Client) (string, error) {
+	i := strings.LastIndexByte(cmd.password, ':')
+	if i < 1 || i == len(cmd.password)-1 {
+		return "", fmt.Errorf("invalid %q, expected <path>:<key>", cmd.password)
+	}
+	name, key := cmd.resolve(cmd.password[:i]), cmd.password[i+1:]
+	secret, err := cmd.readSource(name, client.ReadSecret)
+	if err != nil {
+		return "", err
+	} else if secret == nil {
+		return "", notFound(name + ": secret not found")
+	}
+	password, ok := secret.Data[key].(string)
+	if !ok {
+		return "", notFound(fmt.Sprintf("%s: key %q not found", name, key))
+	} else if password == "" {
+		return "", fmt.Errorf("%s: key %q is empty", name, key)
+	}
+	return password, nil
+}
+
+func (cmd *KeystoreCommand) Synopsis() string {
+	return "write certificates and keys to a PKCS#12 or JKS keystore"
+}
+
+func KeystoreCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &KeystoreCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("keystore", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.alias, "alias", "", "alias of the key (default: the base of the first secret path)")
+		cmd.fs.StringVar(&cmd.altNames, "alt-names", "", "subject alternative names for -cn, separated by commas")
+		cmd.fs.StringVar(&cmd.cn, "cn", "", "issue a certificate for the common name")
+		cmd.fs.StringVar(&cmd.mod, "m", "0600", "output mode")
+		cmd.fs.StringVar(&cmd.out, "o", "", "output file")
+		cmd.fs.StringVar(&cmd.password, "password", "", "store password, as <secret path>:<key>")
+		cmd.fs.StringVar(&cmd.storeType, "t", "", "keystore type: pkcs12 or jks (default: jks for .jks files)")
+		cmd.fs.StringVar(&cmd.ttl, "ttl", "", "TTL of the certificate for -cn")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,281 @@
+package vc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// testCertChain returns a PEM encoded root, intermediate and leaf
+// certificate, and the PEM encoded (PKCS#8) key of the leaf
+func testCertChain(t *testing.T) ([]string, string) {
+	var (
+		parent *x509.Certificate
+		key    *ecdsa.PrivateKey
+		certs  []string
+	)
+	for i, name := range []string{"root", "intermediate", "leaf"} {
+		next, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(int64(i + 1)),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             time.Now(),
+			NotAfter:              time.Now().Add(time.Hour),
+			BasicConstraintsValid: true,
+			IsCA:                  name != "leaf",
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		}
+		signer, issuer := next, template
+		if parent != nil {
+			signer, issuer = key, parent
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, issuer, &next.PublicKey, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parent, err = x509.ParseCertificate(der); err != nil {
+			t.Fatal(err)
+		}
+		key = next
+		certs = append(certs, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certs, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestBuildKeystore(t *testing.T) {
+	certs, key := testCertChain(t)
+	other, _ := testCertChain(t)
+
+	// As issued by the PKI secrets engine, with the issuing CA twice
+	ks, err := buildKeystore("web", []string{certs[1], certs[2] + "\n" + certs[1] + certs[0], key, other[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.entries) != 2 {
+		t.Fatalf("expected a key and a trusted certificate, got %d entries", len(ks.entries))
+	}
+	entry := ks.entries[0]
+	if entry.alias != "web" || entry.key == nil || len(entry.chain) != 3 {
+		t.Fatalf("unexpected key entry %q with %d certificates", entry.alias, len(entry.chain))
+	}
+	for i, name := range []string{"leaf", "intermediate", "root"} {
+		if cn := entry.chain[i].Subject.CommonName; cn != name {
+			t.Fatalf("chain %d: expected %s, got %s", i, name, cn)
+		}
+	}
+	if entry = ks.entries[1]; entry.alias != "web-1" || entry.key != nil {
+		t.Fatalf("unexpected trusted entry %q", entry.alias)
+	}
+
+	if ks, err = buildKeystore("ca", []string{certs[0]}); err != nil {
+		t.Fatal(err)
+	} else if len(ks.entries) != 1 || ks.entries[0].alias != "ca" {
+		t.Fatalf("expected a truststore with ca, got %+v", ks.entries)
+	}
+	if _, err = buildKeystore("web", []string{other[2], key}); err == nil {
+		t.Fatal("expected an error for a key without its certificate")
+	}
+	if _, err = buildKeystore("web", []string{key}); err == nil {
+		t.Fatal("expected an error without certificates")
+	}
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	certs, key := testCertChain(t)
+	ks, err := buildKeystore("web", []string{certs[2], certs[1], certs[0], key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := encodePKCS12(ks, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pkcs12.ToPEM(b, "wrong"); err == nil {
+		t.Fatal("expected an error for the wrong password")
+	}
+	blocks, err := pkcs12.ToPEM(b, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, block := range blocks {
+		types = append(types, block.Type)
+	}
+	if len(blocks) != 4 || blocks[0].Type != "CERTIFICATE" || blocks[3].Type != "PRIVATE KEY" {
+		t.Fatalf("expected 3 certificates and a key, got %v", types)
+	}
+	if !bytes.Equal(blocks[0].Bytes, ks.entries[0].chain[0].Raw) {
+		t.Fatal("expected the leaf certificate first")
+	}
+	if blocks[0].Headers["friendlyName"] != "web" || blocks[0].Headers["localKeyId"] != blocks[3].Headers["localKeyId"] {
+		t.Fatalf("unexpected attributes %v and %v", blocks[0].Headers, blocks[3].Headers)
+	}
+}
+
+func TestEncodeJKS(t *testing.T) {
+	certs, key := testCertChain(t)
+	ks, err := buildKeystore("Web", []string{certs[2], certs[1], key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := encodeJKS(ks, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pass := jksPassword("changeit")
+	h := sha1.New()
+	h.Write(pass)
+	h.Write([]byte(jksDigestSalt))
+	h.Write(b[:len(b)-sha1.Size])
+	if !bytes.Equal(h.Sum(nil), b[len(b)-sha1.Size:]) {
+		t.Fatal("invalid keystore digest")
+	}
+
+	r := bytes.NewReader(b[:len(b)-sha1.Size])
+	var header struct{ Magic, Version, Count, Tag uint32 }
+	binary.Read(r, binary.BigEndian, &header)
+	if header.Magic != jksMagic || header.Version != jksVersion || header.Count != 1 || header.Tag != jksPrivateKey {
+		t.Fatalf("unexpected header %+v", header)
+	}
+	var n uint16
+	binary.Read(r, binary.BigEndian, &n)
+	alias := make([]byte, n)
+	r.Read(alias)
+	if string(alias) != "web" {
+		t.Fatalf("expected alias web, got %q", alias)
+	}
+	var (
+		timestamp int64
+		size      uint32
+	)
+	binary.Read(r, binary.BigEndian, &timestamp)
+	binary.Read(r, binary.BigEndian, &size)
+	protected := make([]byte, size)
+	r.Read(protected)
+
+	// Recover the key as the JDK KeyProtector does
+	var info pkcs12EncryptedPrivateKeyInfo
+	if _, err = asn1.Unmarshal(protected, &info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidJKSKeyProtector) {
+		t.Fatalf("unexpected key algorithm %v", info.Algorithm.Algorithm)
+	}
+	var (
+		salt      = info.Data[:sha1.Size]
+		encrypted = info.Data[sha1.Size : len(info.Data)-sha1.Size]
+		plain     = make([]byte, len(encrypted))
+		digest    = salt
+	)
+	for i := 0; i < len(encrypted); i += sha1.Size {
+		h := sha1.New()
+		h.Write(pass)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for j := 0; j < sha1.Size && i+j < len(encrypted); j++ {
+			plain[i+j] = encrypted[i+j] ^ digest[j]
+		}
+	}
+	if block, _ := pem.Decode([]byte(key)); !bytes.Equal(plain, block.Bytes) {
+		t.Fatal("the private key does not match")
+	}
+
+	var chain uint32
+	binary.Read(r, binary.BigEndian, &chain)
+	if chain != 2 {
+		t.Fatalf("expected a chain of 2 certificates, got %d", chain)
+	}
+}
+
+func TestKeystoreCommand(t *testing.T) {
+	certs, key := testCertChain(t)
+	var issued map[string]interface{}
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/secret/keystore":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "changeit"}}
+		case "PUT /v1/pki/issue/web", "POST /v1/pki/issue/web":
+			json.NewDecoder(r.Body).Decode(&issued)
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"certificate":      certs[2],
+				"issuing_ca":       certs[1],
+				"ca_chain":         []string{certs[1], certs[0]},
+				"private_key":      key,
+				"private_key_type": "ec",
+			}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv", "pki/": "pki"})
+
+	dir, err := ioutil.TempDir("", "vc-keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"web.p12", "web.jks"} {
+		ui := cli.NewMockUi()
+		command, _ := KeystoreCommandFactory(ui)()
+		cmd := command.(*KeystoreCommand)
+		cmd.c, cmd.config = c, new(Config)
+		out := filepath.Join(dir, name)
+		if code := cmd.Run([]string{"-o", out, "-password", "secret/keystore:password", "-cn", "web.example.com", "pki/issue/web"}); code != Success {
+			t.Fatalf("%s: expected success, got %d: %s", name, code, ui.ErrorWriter.String())
+		}
+		if issued["common_name"] != "web.example.com" {
+			t.Fatalf("%s: unexpected issue request %v", name, issued)
+		}
+		b, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, _ := os.Stat(out); info.Mode().Perm() != 0600 {
+			t.Fatalf("%s: expected mode 0600, got %v", name, info.Mode())
+		}
+		if name == "web.jks" {
+			if binary.BigEndian.Uint32(b) != jksMagic {
+				t.Fatalf("%s: expected a JKS keystore", name)
+			}
+		} else if blocks, err := pkcs12.ToPEM(b, "changeit"); err != nil || len(blocks) != 4 {
+			t.Fatalf("%s: expected 3 certificates and a key, got %d blocks: %v", name, len(blocks), err)
+		}
+	}
+
+	ui := cli.NewMockUi()
+	command, _ := KeystoreCommandFactory(ui)()
+	cmd := command.(*KeystoreCommand)
+	cmd.c, cmd.config = c, new(Config)
+	if code := cmd.Run([]string{"-o", filepath.Join(dir, "x.p12"), "-password", "secret/keystore:missing", "secret/keystore"}); code != NotFoundError {
+		t.Fatalf("expected not found for a missing password key, got %d: %s", code, ui.ErrorWriter.String())
+	}
+}
@@ -0,0 +1,349 @@
+package vc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// kubeObject is a Kubernetes API object, with the fields we use
+type kubeObject struct {
+	APIVersion string            `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string            `yaml:"kind" json:"kind"`
+	Metadata   kubeMetadata      `yaml:"metadata" json:"metadata"`
+	Type       string            `yaml:"type,omitempty" json:"type,omitempty"`
+	Data       map[string]string `yaml:"data,omitempty" json:"data,omitempty"`
+}
+
+type kubeMetadata struct {
+	Name      string            `yaml:"name" json:"name"`
+	Namespace string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// kubeNameInvalid matches the characters not allowed in Kubernetes names
+var kubeNameInvalid = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// kubeName converts s to a valid Kubernetes object name
+func kubeName(s string) string {
+	return strings.Trim(kubeNameInvalid.ReplaceAllString(strings.ToLower(s), "-"), "-.")
+}
+
+// kubeSecretData maps the keys of secrets to the keys of a Kubernetes Secret,
+// with base64 encoded values. Mapping entries are "key=name" or
+// "path:key=name"; if there are mappings, only the mapped keys are included.
+// Keys ending in the binary key suffix hold base64 encoded values already.
+func kubeSecretData(paths []string, secrets []map[string]interface{}, mapping []string) (map[string]string, error) {
+	var (
+		names  = make(map[string]string)
+		mapped = len(mapping) > 0
+		used   = make(map[string]bool)
+		data   = make(map[string]string)
+		origin = make(map[string]string)
+	)
+	for _, entry := range mapping {
+		i := strings.IndexByte(entry, '=')
+		if i < 1 || i == len(entry)-1 {
+			return nil, fmt.Errorf("invalid mapping %q, expected key=name", entry)
+		}
+		names[strings.TrimLeft(entry[:i], "/")] = entry[i+1:]
+	}
+
+	for i, secret := range secrets {
+		keys := make([]string, 0, len(secret))
+		for key := range secret {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if key == CodecTypeKey {
+				continue
+			}
+			source := strings.TrimLeft(paths[i], "/") + ":" + key
+			name, ok := names[source]
+			if !ok {
+				source = key
+				name, ok = names[source]
+			}
+			if ok {
+				used[source] = true
+			}
+			if !ok && mapped {
+				continue
+			} else if !ok {
+				name = key
+			}
+
+			var value string
+			switch v := secret[key].(type) {
+			case string:
+				value = base64.StdEncoding.EncodeToString([]byte(v))
+				if strings.HasSuffix(key, binaryKeySuffix) {
+					// Already encoded
+					value = v
+					if !ok {
+						name = strings.TrimSuffix(key, binaryKeySuffix)
+					}
+				}
+			default:
+				b, err := json.Marshal(v)
+				if err != nil {
+					return nil, fmt.Errorf("%s: key %s: %v", paths[i], key, err)
+				}
+				value = base64.StdEncoding.EncodeToString(b)
+			}
+
+			if other, exists := origin[name]; exists {
+				return nil, fmt.Errorf("key %s is in both %s and %s; use -map", name, other, paths[i])
+			}
+			origin[name] = paths[i]
+			data[name] = value
+		}
+	}
+
+	for _, entry := range mapping {
+		if source := strings.TrimLeft(entry[:strings.IndexByte(entry, '=')], "/"); !used[source] {
+			return nil, notFound(fmt.Sprintf("mapped key %s not found", source))
+		}
+	}
+	return data, nil
+}
+
+// KubeCommand renders secrets as Kubernetes manifests
+type KubeCommand struct {
+	baseCommand
+	fs         *flag.FlagSet
+	sub        string
+	name       string
+	namespace  string
+	secretType string
+	mapping    stringsValue
+	labels     stringsValue
+	mod        string
+	apply      bool
+	kubeconfig string
+	context    string
+	store      string
+	storeKind  string
+	refresh    string
+	role       string
+}
+
+func (cmd *KubeCommand) Help() string {
+	switch cmd.sub {
+	case "externalsecret":
+		return `Usage: vc k8s externalsecret [<options>] <secret path>
+
+Generates an ExternalSecret (external-secrets.io) manifest for each secret in
+the tree at path, mapping all keys of the secret to a Kubernetes Secret of the
+same name. Remote keys are relative to the mount of the secrets engine, which
+is configured in the secret store.
+
+Options:
+` + defaults(cmd.fs)
+	case "secretproviderclass":
+		return `Usage: vc k8s secretproviderclass [<options>] <secret path>
+
+Generates a SecretProviderClass (Secrets Store CSI driver) manifest for the
+Vault provider for each secret in the tree at path, with an object per key
+that is also synced to a Kubernetes Secret of the same name.
+
+Options:
+` + defaults(cmd.fs)
+	}
+	return `Usage: vc k8s secret [<options>] <secret path> [... <secret path>]
+
+Renders the secrets as a Kubernetes Secret manifest. The keys of all secrets
+are merged; use -map key=name (or -map path:key=name) to rename keys, in which
+case only the mapped keys are included. With -apply, the Secret is created or
+updated in the cluster of the current kubeconfig context (or the cluster vc
+runs in) using server-side apply.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *KubeCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) == 0 || (cmd.sub != "secret" && len(args) != 1) {
+		return Help
+	}
+	if mode, err := cmd.outputMode(cmd.fs, cmd.mod); err != nil {
+		cmd.ui.Error("error: " + err.Error())
+		return SyntaxError
+	} else {
+		cmd.mode = mode
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	if cmd.sub != "secret" {
+		return cmd.runSync(client, args[0])
+	}
+	if args, err = client.expand(args, isSecret); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SyntaxError)
+	}
+
+	var secrets []map[string]interface{}
+	for _, path := range args {
+		secret, err := cmd.readSource(path, client.ReadSecret)
+		if err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, ServerError)
+		}
+		if secret == nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: secret not found", path))
+			return NotFoundError
+		}
+		secrets = append(secrets, secret.Data)
+	}
+
+	object, err := cmd.secret(args, secrets)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SyntaxError)
+	}
+
+	if cmd.apply {
+		return cmd.runApply(object)
+	}
+
+	b, err := yaml.Marshal(object)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if _, err = cmd.Write(b); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if err = cmd.Close(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	return Success
+}
+
+// secret builds the Kubernetes Secret object for the secrets at paths
+func (cmd *KubeCommand) secret(paths []string, secrets []map[string]interface{}) (*kubeObject, error) {
+	data, err := kubeSecretData(paths, secrets, cmd.mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	object := &kubeObject{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: kubeMetadata{
+			Name:      cmd.name,
+			Namespace: cmd.namespace,
+		},
+		Type: cmd.secretType,
+		Data: data,
+	}
+	if object.Metadata.Name == "" {
+		object.Metadata.Name = kubeName(filepath.Base(paths[0]))
+	}
+	for _, label := range cmd.labels {
+		i := strings.IndexByte(label, '=')
+		if i < 1 {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", label)
+		}
+		if object.Metadata.Labels == nil {
+			object.Metadata.Labels = make(map[string]string)
+		}
+		object.Metadata.Labels[label[:i]] = label[i+1:]
+	}
+	return object, nil
+}
+
+// runApply creates or updates the Secret in the cluster
+func (cmd *KubeCommand) runApply(object *kubeObject) int {
+	kube, err := newKubeClient(cmd.kubeconfig, cmd.context)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return ClientError
+	}
+	if object.Metadata.Namespace == "" {
+		object.Metadata.Namespace = kube.namespace
+	}
+
+	var (
+		meta = object.Metadata
+		path = "/api/v1/namespaces/" + meta.Namespace + "/secrets/" + meta.Name
+	)
+	if DryRun {
+		cmd.ui.Output(fmt.Sprintf("dry run: apply secret %s/%s to %s", meta.Namespace, meta.Name, kube.server))
+		return Success
+	}
+	if err = kube.apply(path, object); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	cmd.ui.Info(fmt.Sprintf("secret %s/%s applied", meta.Namespace, meta.Name))
+	return Success
+}
+
+func (cmd *KubeCommand) Synopsis() string {
+	switch cmd.sub {
+	case "externalsecret":
+		return "generate ExternalSecret manifests for a tree of secrets"
+	case "secretproviderclass":
+		return "generate SecretProviderClass manifests for a tree of secrets"
+	}
+	return "render secrets as a Kubernetes Secret"
+}
+
+func KubeCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &KubeCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("k8s "+sub, flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.out, "o", "", "output (default: stdout)")
+		cmd.fs.StringVar(&cmd.mod, "m", "0600", "output mode")
+		switch sub {
+		case "secret":
+			cmd.fs.StringVar(&cmd.name, "name", "", "name of the Secret (default: base of the first secret path)")
+			cmd.fs.StringVar(&cmd.namespace, "namespace", "", "namespace of the Secret (default: from context with -apply)")
+			cmd.fs.StringVar(&cmd.secretType, "type", "Opaque", "type of the Secret")
+			cmd.fs.Var(&cmd.mapping, "map", "map a key to a Secret key, as key=name or path:key=name (can be repeated)")
+			cmd.fs.Var(&cmd.labels, "label", "add a label, as key=value (can be repeated)")
+			cmd.fs.BoolVar(&cmd.apply, "apply", false, "apply the Secret to the cluster")
+			cmd.fs.StringVar(&cmd.kubeconfig, "kubeconfig", "", "kubeconfig file (default: $KUBECONFIG, ~/.kube/config or in-cluster)")
+			cmd.fs.StringVar(&cmd.context, "context", "", "kubeconfig context (default: current context)")
+		case "externalsecret":
+			cmd.fs.StringVar(&cmd.namespace, "namespace", "", "namespace of the manifests")
+			cmd.fs.StringVar(&cmd.store, "store", "vault", "name of the secret store")
+			cmd.fs.StringVar(&cmd.storeKind, "store-kind", "SecretStore", "kind of the secret store (SecretStore or ClusterSecretStore)")
+			cmd.fs.StringVar(&cmd.refresh, "refresh", "1h", "refresh interval")
+		case "secretproviderclass":
+			cmd.fs.StringVar(&cmd.namespace, "namespace", "", "namespace of the manifests")
+			cmd.fs.StringVar(&cmd.role, "role", "", "Vault Kubernetes auth role")
+		}
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
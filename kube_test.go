@@ -0,0 +1,150 @@
+package vc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKubeName(t *testing.T) {
+	tests := []struct {
+		Test string
+		Want string
+	}{
+		{"db", "db"},
+		{"DB_Credentials", "db-credentials"},
+		{"_test.", "test"},
+	}
+	for _, test := range tests {
+		if got := kubeName(test.Test); got != test.Want {
+			t.Fatalf("kubeName(%q): expected %q, got %q", test.Test, test.Want, got)
+		}
+	}
+}
+
+func TestKubeSecretData(t *testing.T) {
+	var (
+		paths   = []string{"secret/db", "/secret/api"}
+		secrets = []map[string]interface{}{
+			{"username": "test", "password": "secret", "cert_base64": "AAEC"},
+			{"token": "s.test", "port": 443},
+		}
+	)
+
+	data, err := kubeSecretData(paths, secrets, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"username": "dGVzdA==",
+		"password": "c2VjcmV0",
+		"cert":     "AAEC",
+		"token":    "cy50ZXN0",
+		"port":     "NDQz",
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("expected %v, got %v", want, data)
+	}
+
+	if data, err = kubeSecretData(paths, secrets, []string{"password=DB_PASSWORD", "secret/api:token=API_TOKEN"}); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{
+		"DB_PASSWORD": "c2VjcmV0",
+		"API_TOKEN":   "cy50ZXN0",
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("expected %v, got %v", want, data)
+	}
+
+	if _, err = kubeSecretData(paths, secrets, []string{"missing=test"}); ErrorKind(err) != ErrNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if _, err = kubeSecretData(paths, secrets, []string{"invalid"}); err == nil {
+		t.Fatal("expected error for invalid mapping")
+	}
+	if _, err = kubeSecretData([]string{"a", "b"}, []map[string]interface{}{{"key": "a"}, {"key": "b"}}, nil); err == nil {
+		t.Fatal("expected error for duplicate keys")
+	}
+}
+
+func TestKubeClient(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "kube")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "config")
+	if err = ioutil.WriteFile(name, []byte(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+    insecure-skip-tls-verify: true
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+    namespace: testing
+users:
+- name: test
+  user:
+    token: test-token
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newKubeClient(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.server != "https://127.0.0.1:6443" || c.token != "test-token" || c.namespace != "testing" {
+		t.Fatalf("unexpected client %+v", c)
+	}
+	if _, err = newKubeClient(name, "missing"); err == nil {
+		t.Fatal("expected error for missing context")
+	}
+}
+
+func TestKubeClientApply(t *testing.T) {
+	var (
+		method, path, contentType, auth string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType, auth = r.Method, r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		if r.URL.Query().Get("fieldManager") != kubeFieldManager {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/denied") {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"kind":"Status","message":"secrets is forbidden"}`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	c := &kubeClient{server: server.URL, token: "test", client: server.Client()}
+	if err := c.apply("/api/v1/namespaces/default/secrets/test", &kubeObject{Kind: "Secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if method != "PATCH" || path != "/api/v1/namespaces/default/secrets/test" || contentType != "application/apply-patch+yaml" || auth != "Bearer test" {
+		t.Fatalf("unexpected request %s %s (%s, %s)", method, path, contentType, auth)
+	}
+
+	err := c.apply("/api/v1/namespaces/default/secrets/denied", &kubeObject{Kind: "Secret"})
+	if ErrorKind(err) != ErrPermissionDenied || !strings.Contains(err.Error(), "secrets is forbidden") {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package vc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Kubernetes service account files, available when running in a pod
+const (
+	kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	kubeFieldManager      = "vc"
+)
+
+// kubeConfig is the subset of a kubeconfig file that we support
+type kubeConfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Exec                  interface{} `yaml:"exec"`
+			AuthProvider          interface{} `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// kubeClient talks to the Kubernetes API server
+type kubeClient struct {
+	server    string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// kubeConfigName returns the name of the kubeconfig file
+func kubeConfigName() string {
+	if name := os.Getenv("KUBECONFIG"); name != "" {
+		// Only the first file of a list is used
+		return filepath.SplitList(name)[0]
+	}
+	return os.ExpandEnv("$HOME/.kube/config")
+}
+
+// newKubeClient configures a client from the kubeconfig file name, or from
+// the service account if running in a pod and name is empty
+func newKubeClient(name, context string) (*kubeClient, error) {
+	if name == "" {
+		if host := os.Getenv("KUBERNETES_SERVICE_HOST"); host != "" {
+			return newInClusterKubeClient(host, os.Getenv("KUBERNETES_SERVICE_PORT"))
+		}
+		name = kubeConfigName()
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var config kubeConfig
+	if err = yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if context == "" {
+		context = config.CurrentContext
+	}
+
+	c := &kubeClient{namespace: "default"}
+	var clusterName, userName string
+	for _, item := range config.Contexts {
+		if item.Name == context {
+			clusterName, userName = item.Context.Cluster, item.Context.User
+			if item.Context.Namespace != "" {
+				c.namespace = item.Context.Namespace
+			}
+			break
+		}
+	}
+	if clusterName == "" {
+		return nil, fmt.Errorf("%s: context %q not found", name, context)
+	}
+
+	// Relative paths in kubeconfig files are relative to the file
+	dir := filepath.Dir(name)
+	relative := func(path string) string {
+		if path != "" && !filepath.IsAbs(path) {
+			return filepath.Join(dir, path)
+		}
+		return path
+	}
+
+	tlsConfig := new(tls.Config)
+	for _, item := range config.Clusters {
+		if item.Name != clusterName {
+			continue
+		}
+		c.server = item.Cluster.Server
+		tlsConfig.InsecureSkipVerify = item.Cluster.InsecureSkipTLSVerify
+		ca, err := kubeData(item.Cluster.CertificateAuthorityData, relative(item.Cluster.CertificateAuthority))
+		if err != nil {
+			return nil, fmt.Errorf("%s: cluster %s: %v", name, clusterName, err)
+		}
+		if ca != nil {
+			if tlsConfig.RootCAs, err = kubeCertPool(ca); err != nil {
+				return nil, fmt.Errorf("%s: cluster %s: %v", name, clusterName, err)
+			}
+		}
+	}
+	if c.server == "" {
+		return nil, fmt.Errorf("%s: cluster %q not found", name, clusterName)
+	}
+
+	for _, item := range config.Users {
+		if item.Name != userName {
+			continue
+		}
+		if item.User.Exec != nil || item.User.AuthProvider != nil {
+			return nil, fmt.Errorf("%s: user %s: exec and auth provider plugins are not supported", name, userName)
+		}
+		c.token = item.User.Token
+		if c.token == "" && item.User.TokenFile != "" {
+			token, err := ioutil.ReadFile(relative(item.User.TokenFile))
+			if err != nil {
+				return nil, err
+			}
+			c.token = strings.TrimSpace(string(token))
+		}
+		cert, err := kubeData(item.User.ClientCertificateData, relative(item.User.ClientCertificate))
+		if err != nil {
+			return nil, fmt.Errorf("%s: user %s: %v", name, userName, err)
+		}
+		key, err := kubeData(item.User.ClientKeyData, relative(item.User.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("%s: user %s: %v", name, userName, err)
+		}
+		if cert != nil && key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("%s: user %s: %v", name, userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+
+	c.client = kubeHTTPClient(tlsConfig)
+	return c, nil
+}
+
+// newInClusterKubeClient configures a client using the service account of
+// the pod we're running in
+func newInClusterKubeClient(host, port string) (*kubeClient, error) {
+	token, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool, err := kubeCertPool(ca)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &kubeClient{
+		server:    "https://" + net.JoinHostPort(host, port),
+		token:     strings.TrimSpace(string(token)),
+		namespace: "default",
+		client:    kubeHTTPClient(&tls.Config{RootCAs: pool}),
+	}
+	if namespace, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "namespace")); err == nil {
+		c.namespace = strings.TrimSpace(string(namespace))
+	}
+	return c, nil
+}
+
+func kubeHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+// kubeData returns the base64 encoded data, or the contents of file name
+func kubeData(data, name string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if name != "" {
+		return ioutil.ReadFile(name)
+	}
+	return nil, nil
+}
+
+func kubeCertPool(ca []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no valid CA certificates found")
+	}
+	return pool, nil
+}
+
+// apply creates or updates an object using server-side apply; path is the
+// API path of the object, such as /api/v1/namespaces/default/secrets/test
+func (c *kubeClient) apply(path string, object interface{}) error {
+	b, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+
+	u := strings.TrimRight(c.server, "/") + path + "?" + url.Values{
+		"fieldManager": {kubeFieldManager},
+		"force":        {"true"},
+	}.Encode()
+	Debugf("kube: apply %s", u)
+	r, err := http.NewRequest("PATCH", u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/apply-patch+yaml")
+	r.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+
+	// Errors are returned as a Status object
+	var status struct {
+		Message string `json:"message"`
+	}
+	if body, err := ioutil.ReadAll(res.Body); err == nil {
+		if json.Unmarshal(body, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(body))
+		}
+	}
+	err = fmt.Errorf("kubernetes: %s: %s", res.Status, status.Message)
+	switch res.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &Error{Kind: ErrPermissionDenied, Err: err}
+	case http.StatusNotFound:
+		return &Error{Kind: ErrNotFound, Err: err}
+	case http.StatusConflict:
+		return &Error{Kind: ErrVersionConflict, Err: err}
+	}
+	return err
+}
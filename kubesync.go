@@ -0,0 +1,265 @@
+package vc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// kubeSyncSecret is a secret that is synced to Kubernetes by an operator
+type kubeSyncSecret struct {
+	// Name of the Kubernetes objects
+	Name string
+
+	// Key is the path of the secret relative to the mount
+	Key string
+
+	// APIPath is the path of the secret in the Vault API, for KV v2 this
+	// includes the data/ prefix
+	APIPath string
+
+	// Keys of the secret
+	Keys []string
+}
+
+// kubeSyncOptions are the settings for the generated manifests
+type kubeSyncOptions struct {
+	Namespace       string
+	Store           string
+	StoreKind       string
+	RefreshInterval string
+	Role            string
+	VaultAddress    string
+}
+
+// externalSecret is an external-secrets.io ExternalSecret
+type externalSecret struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   kubeMetadata `yaml:"metadata"`
+	Spec       struct {
+		RefreshInterval string `yaml:"refreshInterval,omitempty"`
+		SecretStoreRef  struct {
+			Name string `yaml:"name"`
+			Kind string `yaml:"kind"`
+		} `yaml:"secretStoreRef"`
+		Target struct {
+			Name           string `yaml:"name"`
+			CreationPolicy string `yaml:"creationPolicy"`
+		} `yaml:"target"`
+		Data []externalSecretData `yaml:"data"`
+	} `yaml:"spec"`
+}
+
+type externalSecretData struct {
+	SecretKey string `yaml:"secretKey"`
+	RemoteRef struct {
+		Key      string `yaml:"key"`
+		Property string `yaml:"property"`
+	} `yaml:"remoteRef"`
+}
+
+// secretProviderClass is a secrets-store.csi.x-k8s.io SecretProviderClass for
+// the Vault CSI provider
+type secretProviderClass struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   kubeMetadata `yaml:"metadata"`
+	Spec       struct {
+		Provider      string               `yaml:"provider"`
+		Parameters    map[string]string    `yaml:"parameters"`
+		SecretObjects []secretObjectTarget `yaml:"secretObjects,omitempty"`
+	} `yaml:"spec"`
+}
+
+type secretObjectTarget struct {
+	SecretName string             `yaml:"secretName"`
+	Type       string             `yaml:"type"`
+	Data       []secretObjectData `yaml:"data"`
+}
+
+type secretObjectData struct {
+	ObjectName string `yaml:"objectName"`
+	Key        string `yaml:"key"`
+}
+
+type secretProviderObject struct {
+	ObjectName string `yaml:"objectName"`
+	SecretPath string `yaml:"secretPath"`
+	SecretKey  string `yaml:"secretKey"`
+}
+
+// newExternalSecret builds the ExternalSecret for s; remote keys are relative
+// to the mount, which is configured in the secret store
+func newExternalSecret(s kubeSyncSecret, options kubeSyncOptions) *externalSecret {
+	object := &externalSecret{
+		APIVersion: "external-secrets.io/v1beta1",
+		Kind:       "ExternalSecret",
+		Metadata: kubeMetadata{
+			Name:      s.Name,
+			Namespace: options.Namespace,
+		},
+	}
+	object.Spec.RefreshInterval = options.RefreshInterval
+	object.Spec.SecretStoreRef.Name = options.Store
+	object.Spec.SecretStoreRef.Kind = options.StoreKind
+	object.Spec.Target.Name = s.Name
+	object.Spec.Target.CreationPolicy = "Owner"
+	for _, key := range s.Keys {
+		var data externalSecretData
+		data.SecretKey = key
+		data.RemoteRef.Key = s.Key
+		data.RemoteRef.Property = key
+		object.Spec.Data = append(object.Spec.Data, data)
+	}
+	return object
+}
+
+// newSecretProviderClass builds the SecretProviderClass for s, which also
+// syncs the objects to a Kubernetes Secret
+func newSecretProviderClass(s kubeSyncSecret, options kubeSyncOptions) (*secretProviderClass, error) {
+	object := &secretProviderClass{
+		APIVersion: "secrets-store.csi.x-k8s.io/v1",
+		Kind:       "SecretProviderClass",
+		Metadata: kubeMetadata{
+			Name:      s.Name,
+			Namespace: options.Namespace,
+		},
+	}
+	object.Spec.Provider = "vault"
+
+	var (
+		objects []secretProviderObject
+		target  = secretObjectTarget{SecretName: s.Name, Type: "Opaque"}
+	)
+	for _, key := range s.Keys {
+		name := s.Name + "-" + kubeName(key)
+		objects = append(objects, secretProviderObject{
+			ObjectName: name,
+			SecretPath: s.APIPath,
+			SecretKey:  key,
+		})
+		target.Data = append(target.Data, secretObjectData{ObjectName: name, Key: key})
+	}
+	object.Spec.SecretObjects = []secretObjectTarget{target}
+
+	b, err := yaml.Marshal(objects)
+	if err != nil {
+		return nil, err
+	}
+	object.Spec.Parameters = map[string]string{
+		"objects": string(b),
+	}
+	if options.Role != "" {
+		object.Spec.Parameters["roleName"] = options.Role
+	}
+	if options.VaultAddress != "" {
+		object.Spec.Parameters["vaultAddress"] = options.VaultAddress
+	}
+	return object, nil
+}
+
+// kubeSyncName names the objects for the secret at path in the tree at root,
+// such as "prod-db" for secret/app/prod/db in secret/app
+func kubeSyncName(root, p string) string {
+	root, p = strings.Trim(root, "/"), strings.Trim(p, "/")
+	rel := path.Base(p)
+	if strings.HasPrefix(p, root+"/") {
+		rel = p[len(root)+1:]
+	}
+	return kubeName(strings.Replace(rel, "/", "-", -1))
+}
+
+// runSync writes the operator manifests for the secrets in the tree at root
+func (cmd *KubeCommand) runSync(client *Client, root string) int {
+	info, err := client.Stat(root)
+	if err == os.ErrNotExist {
+		cmd.ui.Error(fmt.Sprintf("error: %s: not found", root))
+		return NotFoundError
+	} else if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+
+	paths := []string{root}
+	if info.IsDir() {
+		if paths, err = client.walk(root); err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, ServerError)
+		}
+	}
+	sort.Strings(paths)
+
+	options := kubeSyncOptions{
+		Namespace:       cmd.namespace,
+		Store:           cmd.store,
+		StoreKind:       cmd.storeKind,
+		RefreshInterval: cmd.refresh,
+		Role:            cmd.role,
+		VaultAddress:    client.Address(),
+	}
+
+	var buf bytes.Buffer
+	for _, p := range paths {
+		secret, err := client.ReadSecret(p)
+		if err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, ServerError)
+		} else if secret == nil {
+			continue
+		}
+
+		s := kubeSyncSecret{
+			Name:    kubeSyncName(root, p),
+			APIPath: strings.TrimLeft(client.Abs(p), "/"),
+		}
+		mount, _, key, err := client.MountFor(p)
+		if err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, ServerError)
+		}
+		if s.Key = key; client.IsKV2(p) {
+			s.APIPath = mount + "data/" + s.Key
+		}
+		for key := range secret.Data {
+			if key != CodecTypeKey {
+				s.Keys = append(s.Keys, key)
+			}
+		}
+		sort.Strings(s.Keys)
+
+		var object interface{}
+		switch cmd.sub {
+		case "externalsecret":
+			object = newExternalSecret(s, options)
+		case "secretproviderclass":
+			if object, err = newSecretProviderClass(s, options); err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %v", err))
+				return SystemError
+			}
+		}
+
+		b, err := yaml.Marshal(object)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+		buf.WriteString("---\n")
+		buf.Write(b)
+	}
+
+	if _, err = cmd.Write(buf.Bytes()); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if err = cmd.Close(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	return Success
+}
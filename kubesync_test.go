@@ -0,0 +1,77 @@
+package vc
+
+import (
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestKubeSyncName(t *testing.T) {
+	tests := []struct {
+		Root string
+		Path string
+		Want string
+	}{
+		{"secret/app", "secret/app/prod/db", "prod-db"},
+		{"/secret/app/", "/secret/app/api_key", "api-key"},
+		{"secret/app/db", "secret/app/db", "db"},
+	}
+	for _, test := range tests {
+		if got := kubeSyncName(test.Root, test.Path); got != test.Want {
+			t.Fatalf("kubeSyncName(%q, %q): expected %q, got %q", test.Root, test.Path, test.Want, got)
+		}
+	}
+}
+
+func TestKubeSyncManifests(t *testing.T) {
+	var (
+		s = kubeSyncSecret{
+			Name:    "prod-db",
+			Key:     "app/prod/db",
+			APIPath: "secret/data/app/prod/db",
+			Keys:    []string{"password", "username"},
+		}
+		options = kubeSyncOptions{
+			Namespace:       "app",
+			Store:           "vault",
+			StoreKind:       "ClusterSecretStore",
+			RefreshInterval: "1h",
+			Role:            "app",
+			VaultAddress:    "https://vault:8200",
+		}
+	)
+
+	b, err := yaml.Marshal(newExternalSecret(s, options))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"kind: ExternalSecret",
+		"namespace: app",
+		"kind: ClusterSecretStore",
+		"- secretKey: password\n    remoteRef:\n      key: app/prod/db\n      property: password",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in ExternalSecret:\n%s", want, b)
+		}
+	}
+
+	spc, err := newSecretProviderClass(s, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spc.Spec.Parameters["roleName"] != "app" || spc.Spec.Parameters["vaultAddress"] != "https://vault:8200" {
+		t.Fatalf("unexpected parameters %v", spc.Spec.Parameters)
+	}
+	var objects []secretProviderObject
+	if err = yaml.Unmarshal([]byte(spc.Spec.Parameters["objects"]), &objects); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].ObjectName != "prod-db-password" || objects[0].SecretPath != "secret/data/app/prod/db" {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+	if data := spc.Spec.SecretObjects[0].Data; len(data) != 2 || data[1].Key != "username" {
+		t.Fatalf("unexpected secret objects %+v", spc.Spec.SecretObjects)
+	}
+}
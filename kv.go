@@ -0,0 +1,19 @@
+package vc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// splitVersion splits a path with a version suffix, such as secret/foo@3
+func splitVersion(path string) (string, int, bool) {
+	i := strings.LastIndexByte(path, '@')
+	if i < 1 {
+		return path, 0, false
+	}
+	version, err := strconv.Atoi(path[i+1:])
+	if err != nil || version < 1 {
+		return path, 0, false
+	}
+	return path[:i], version, true
+}
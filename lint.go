@@ -0,0 +1,317 @@
+package vc
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Lint rules, names of the checks done by vc lint
+const (
+	lintShortPassword   = "short-password"
+	lintWeakPassword    = "weak-password"
+	lintCertificate     = "expired-certificate"
+	lintForbiddenKey    = "forbidden-key"
+	lintMissingMetadata = "missing-metadata"
+)
+
+// DefaultLintMinLength is the minimum length of passwords
+const DefaultLintMinLength = 12
+
+// DefaultLintPasswordKeys are the patterns of keys that hold passwords
+var DefaultLintPasswordKeys = []string{"*pass*", "*secret*", "*token*"}
+
+// lintCommonPasswords are weak, ignoring case and trailing digits, see lintWeak
+var lintCommonPasswords = map[string]bool{
+	"admin": true, "changeit": true, "changeme": true, "default": true,
+	"dragon": true, "letmein": true, "master": true, "monkey": true,
+	"p@ssw0rd": true, "passw0rd": true, "password": true, "qwerty": true,
+	"qwertyuiop": true, "root": true, "secret": true, "test": true,
+	"welcome": true, "abc": true, "abcdef": true, "iloveyou": true,
+}
+
+// LintRules configure the checks of vc lint
+type LintRules struct {
+	// MinLength is the minimum length of passwords, see DefaultLintMinLength
+	MinLength int `yaml:"min_length,omitempty"`
+
+	// PasswordKeys are patterns of keys that hold passwords, see
+	// DefaultLintPasswordKeys
+	PasswordKeys []string `yaml:"password_keys,omitempty"`
+
+	// ExpiresWithin reports certificates that expire within the duration,
+	// besides the expired ones
+	ExpiresWithin time.Duration `yaml:"expires_within,omitempty"`
+
+	// Forbidden lists keys that are not allowed below paths
+	Forbidden []LintForbidden `yaml:"forbidden,omitempty"`
+
+	// RequiredMetadata are the custom metadata keys KV v2 secrets must have,
+	// such as owner
+	RequiredMetadata []string `yaml:"required_metadata,omitempty"`
+
+	// Disable lists the names of the rules that are not checked
+	Disable []string `yaml:"disable,omitempty"`
+}
+
+// LintForbidden forbids keys matching Keys in secrets at (or below) a path
+// matching one of Paths
+type LintForbidden struct {
+	Paths []string `yaml:"paths"`
+	Keys  []string `yaml:"keys"`
+}
+
+// lintViolation is a secret that breaks a rule
+type lintViolation struct {
+	Path    string `json:"path"`
+	Key     string `json:"key,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// lintMatch checks if name matches one of the glob patterns, ignoring case
+func lintMatch(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := regexp.MatchString("(?i)"+globExpression(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lintWeak checks if the password is weak: a common password (ignoring case
+// and trailing digits and punctuation), or made of less than 5 different
+// characters
+func lintWeak(password string) bool {
+	base := strings.TrimRight(strings.ToLower(password), "0123456789!.?")
+	if base == "" || lintCommonPasswords[base] {
+		return true
+	}
+	chars := make(map[rune]bool)
+	for _, c := range password {
+		chars[c] = true
+	}
+	return len(chars) < 5
+}
+
+// lint checks the data of the secret at path against the rules; metadata is
+// the custom metadata of a KV v2 secret, or nil
+func (rules *LintRules) lint(path string, data map[string]interface{}, metadata map[string]interface{}, now time.Time) []lintViolation {
+	var (
+		violations []lintViolation
+		disabled   = make(map[string]bool)
+		minLength  = rules.MinLength
+		keys       = rules.PasswordKeys
+	)
+	for _, rule := range rules.Disable {
+		disabled[rule] = true
+	}
+	if minLength == 0 {
+		minLength = DefaultLintMinLength
+	}
+	if len(keys) == 0 {
+		keys = DefaultLintPasswordKeys
+	}
+	report := func(key, rule, format string, v ...interface{}) {
+		if !disabled[rule] {
+			violations = append(violations, lintViolation{Path: path, Key: key, Rule: rule, Message: fmt.Sprintf(format, v...)})
+		}
+	}
+
+	for _, key := range sortedKeys(data) {
+		if key == CodecTypeKey {
+			continue
+		}
+		for _, f := range rules.Forbidden {
+			if matchPathPrefix(f.Paths, path) && lintMatch(f.Keys, key) {
+				report(key, lintForbiddenKey, "key is not allowed here")
+				break
+			}
+		}
+
+		value, ok := data[key].(string)
+		if !ok {
+			continue
+		}
+		if certs, errs := pemCertificates(value); len(certs) > 0 || len(errs) > 0 {
+			for _, err := range errs {
+				report(key, lintCertificate, "invalid certificate: %v", err)
+			}
+			for _, cert := range certs {
+				if now.After(cert.NotAfter) {
+					report(key, lintCertificate, "certificate %q expired at %s", cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+				} else if rules.ExpiresWithin > 0 && now.Add(rules.ExpiresWithin).After(cert.NotAfter) {
+					report(key, lintCertificate, "certificate %q expires at %s", cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+				}
+			}
+			continue
+		}
+		if !lintMatch(keys, key) || strings.HasSuffix(key, binaryKeySuffix) {
+			continue
+		}
+		if len([]rune(value)) < minLength {
+			report(key, lintShortPassword, "password is shorter than %d characters", minLength)
+		}
+		if lintWeak(value) {
+			report(key, lintWeakPassword, "password is weak")
+		}
+	}
+
+	if metadata != nil {
+		for _, key := range rules.RequiredMetadata {
+			if v, _ := metadata[key].(string); v == "" {
+				report("", lintMissingMetadata, "no %s in the custom metadata", key)
+			}
+		}
+	}
+	return violations
+}
+
+// LintCommand checks secrets against the lint rules
+type LintCommand struct {
+	baseCommand
+	fs    *flag.FlagSet
+	rules string
+	raw   bool
+}
+
+func (cmd *LintCommand) Help() string {
+	return `Usage: vc lint [<options>] <path> [... <path>]
+
+Check the secrets at the paths, and below directories, against the lint rules:
+short or weak passwords, expired certificates, forbidden keys and missing
+custom metadata. The rules are configured in the lint section of the
+configuration file, or in the YAML file given with -rules. Violations are
+reported, and the exit code is 11; with -json, they are printed as JSON.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *LintCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) == 0 {
+		return Help
+	}
+
+	config, err := cmd.Config()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	rules := config.Lint
+	if cmd.rules != "" {
+		b, err := ioutil.ReadFile(cmd.rules)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SyntaxError
+		}
+		rules = new(LintRules)
+		if err = yaml.UnmarshalStrict(b, rules); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", cmd.rules, err))
+			return SyntaxError
+		}
+	} else if rules == nil {
+		rules = new(LintRules)
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	paths, err := client.secretsAt(args)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+
+	var (
+		violations = []lintViolation{}
+		failed     = make(map[string]bool)
+		now        = time.Now()
+	)
+	for _, path := range paths {
+		path = strings.TrimLeft(path, "/")
+		secret, err := client.ReadSecret(path)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", path, err))
+			return exitCode(err, ServerError)
+		} else if secret == nil {
+			continue
+		}
+		var custom map[string]interface{}
+		if len(rules.RequiredMetadata) > 0 && client.IsKV2(path) {
+			metadata, err := client.ReadMetadata(path)
+			if err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %s: %v", path, err))
+				return exitCode(err, ServerError)
+			}
+			custom = make(map[string]interface{})
+			if metadata != nil {
+				if m, ok := metadata.Data["custom_metadata"].(map[string]interface{}); ok {
+					custom = m
+				}
+			}
+		}
+		for _, v := range rules.lint(path, secret.Data, custom, now) {
+			violations = append(violations, v)
+			failed[v.Path] = true
+		}
+	}
+
+	if cmd.raw {
+		b, err := json.MarshalIndent(violations, "", "  ")
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return CodecError
+		}
+		cmd.ui.Output(string(b))
+	} else {
+		for _, v := range violations {
+			if v.Key != "" {
+				cmd.ui.Output(fmt.Sprintf("%s: %s: %s (%s)", v.Path, v.Key, v.Message, v.Rule))
+			} else {
+				cmd.ui.Output(fmt.Sprintf("%s: %s (%s)", v.Path, v.Message, v.Rule))
+			}
+		}
+		cmd.ui.Info(fmt.Sprintf("lint: %d violations in %d of %d secrets", len(violations), len(failed), len(paths)))
+	}
+	if len(violations) > 0 {
+		return LintError
+	}
+	return Success
+}
+
+func (cmd *LintCommand) Synopsis() string {
+	return "check secrets against lint rules"
+}
+
+func LintCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &LintCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("lint", flag.ContinueOnError)
+		cmd.fs.BoolVar(&cmd.raw, "json", false, "print the violations as JSON")
+		cmd.fs.StringVar(&cmd.rules, "rules", "", "rules file (default: the lint section of the configuration file)")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,116 @@
+package vc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestLintRules(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "old.example.com"},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	rules := &LintRules{
+		Forbidden:        []LintForbidden{{Paths: []string{"secret/prod"}, Keys: []string{"password"}}},
+		RequiredMetadata: []string{"owner"},
+	}
+	tests := []struct {
+		path     string
+		data     map[string]interface{}
+		metadata map[string]interface{}
+		rules    []string
+	}{
+		{"secret/dev/db", map[string]interface{}{"password": "Zq3#vR8!kLp2@xW9"}, nil, nil},
+		{"secret/dev/db", map[string]interface{}{"password": "abc123"}, nil, []string{lintShortPassword, lintWeakPassword}},
+		{"secret/dev/db", map[string]interface{}{"db_pass": "Password2024!"}, nil, []string{lintWeakPassword}},
+		{"secret/dev/db", map[string]interface{}{"api_token": "aaaaabbbbbaaaaabbbbb"}, nil, []string{lintWeakPassword}},
+		{"secret/dev/db", map[string]interface{}{"username": "abc"}, nil, nil},
+		{"secret/prod/app/db", map[string]interface{}{"Password": "Zq3#vR8!kLp2@xW9"}, nil, []string{lintForbiddenKey}},
+		{"secret/dev/tls", map[string]interface{}{"certificate": expired}, nil, []string{lintCertificate}},
+		{"secret/dev/db", map[string]interface{}{}, map[string]interface{}{"team": "ops"}, []string{lintMissingMetadata}},
+		{"secret/dev/db", map[string]interface{}{}, map[string]interface{}{"owner": "ops"}, nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, v := range rules.lint(test.path, test.data, test.metadata, time.Now()) {
+			got = append(got, v.Rule)
+		}
+		if strings.Join(got, " ") != strings.Join(test.rules, " ") {
+			t.Fatalf("%s %v: expected %v, got %v", test.path, test.data, test.rules, got)
+		}
+	}
+
+	rules.Disable = []string{lintWeakPassword}
+	if v := rules.lint("secret/dev/db", map[string]interface{}{"password": "abc123"}, nil, time.Now()); len(v) != 1 || v[0].Rule != lintShortPassword {
+		t.Fatalf("expected only %s, got %v", lintShortPassword, v)
+	}
+}
+
+func TestLintCommand(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		list := r.URL.Query().Get("list") == "true"
+		switch path := strings.TrimSuffix(r.URL.Path, "/"); {
+		case path == "/v1/secret/app" && list:
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"db", "api"}}}
+		case path == "/v1/secret/app/db" && !list:
+			response = map[string]interface{}{"data": map[string]interface{}{"username": "app", "password": "changeme"}}
+		case path == "/v1/secret/app/api" && !list:
+			response = map[string]interface{}{"data": map[string]interface{}{"token": "Zq3#vR8!kLp2@xW9"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	ui := cli.NewMockUi()
+	command, _ := LintCommandFactory(ui)()
+	cmd := command.(*LintCommand)
+	cmd.c, cmd.config = c, new(Config)
+	if code := cmd.Run([]string{"-json", "secret/app"}); code != LintError {
+		t.Fatalf("expected exit code %d, got %d: %s", LintError, code, ui.ErrorWriter.String())
+	}
+	var violations []lintViolation
+	if err := json.Unmarshal([]byte(ui.OutputWriter.String()), &violations); err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 2 || violations[0].Path != "secret/app/db" || violations[0].Key != "password" {
+		t.Fatalf("expected 2 violations of secret/app/db, got %+v", violations)
+	}
+
+	ui = cli.NewMockUi()
+	command, _ = LintCommandFactory(ui)()
+	cmd = command.(*LintCommand)
+	cmd.c, cmd.config = c, &Config{Lint: &LintRules{Disable: []string{lintShortPassword, lintWeakPassword}}}
+	if code := cmd.Run([]string{"secret/app"}); code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if out := ui.OutputWriter.String(); out != "lint: 0 violations in 0 of 2 secrets\n" {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
@@ -1,11 +1,15 @@
 package vc
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"os"
+	"path"
 	"sort"
 	"strings"
+	textTemplate "text/template"
+	"time"
 
 	"github.com/mitchellh/cli"
 )
@@ -17,17 +21,35 @@ type ListCommand struct {
 	compact bool
 	long    bool
 	recurse bool
+	find    bool
+	format  string
+	tmpl    *textTemplate.Template
 }
 
 func (cmd *ListCommand) Help() string {
-	return "Usage: vc [<options>] ls [<secret path>] [... <secret path>]\n\nOptions:\n" + defaults(cmd.fs)
+	return `Usage: vc [<options>] ls [<secret path>] [... <secret path>]
+
+With -template, each secret (and directory) is printed as a line formatted
+with the Go template, such as '{{ .Path }} {{ .Version }}'. The fields are
+Path, Name and Dir; Version, Updated and Metadata are read from the metadata
+of KV v2 secrets when the template uses them.
+
+Options:
+` + defaults(cmd.fs)
 }
 
 func (cmd *ListCommand) Run(args []string) int {
 	if err := cmd.fs.Parse(args); err != nil {
 		return 1
 	}
-	args = cmd.fs.Args()
+	args = cmd.resolveAll(cmd.fs.Args())
+	if cmd.format != "" {
+		var err error
+		if cmd.tmpl, err = parseListTemplate(cmd.format); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SyntaxError
+		}
+	}
 
 	client, err := cmd.Client()
 	if err != nil {
@@ -35,13 +57,17 @@ func (cmd *ListCommand) Run(args []string) int {
 		return 2
 	}
 
+	list := cmd.list
+	if cmd.find {
+		list = cmd.listFind
+	}
 	if len(args) == 0 {
-		return cmd.list(client, ".")
+		return list(client, ".")
 	}
 
 	var ret int
 	for _, path := range args {
-		if code := cmd.list(client, path); code > ret {
+		if code := list(client, path); code > ret {
 			ret = code
 		}
 	}
@@ -49,12 +75,12 @@ func (cmd *ListCommand) Run(args []string) int {
 }
 
 func (cmd *ListCommand) list(client *Client, path string) int {
-	//path = client.abspath(path)
+	//path = client.Abs(path)
 
 	infos, err := client.Glob(path)
 	if err != nil {
 		cmd.ui.Error(err.Error())
-		return 1
+		return exitCode(err, 1)
 	}
 
 	if len(infos) == 1 && infos[0].IsDir() {
@@ -62,16 +88,17 @@ func (cmd *ListCommand) list(client *Client, path string) int {
 		infos, err = client.ReadDir(infos[0].Name())
 		if err != nil {
 			cmd.ui.Error(err.Error())
-			return 1
+			return exitCode(err, 1)
 		}
 	}
 	if len(infos) == 0 {
 		cmd.ui.Error(fmt.Sprintf("%s: not found", path))
-		return 1
+		return NotFoundError
 	}
 
-	if cmd.recurse {
-		fmt.Println(path + ":")
+	colors := cmd.colors(os.Stdout)
+	if cmd.recurse && cmd.tmpl == nil {
+		fmt.Println(colors.paint("header", path+":"))
 	}
 
 	var (
@@ -87,9 +114,17 @@ func (cmd *ListCommand) list(client *Client, path string) int {
 	sort.Strings(names)
 	for _, name := range names {
 		info := files[name]
+		if cmd.tmpl != nil {
+			if err := cmd.printTemplate(client, info); err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %v", err))
+				return exitCode(err, SyntaxError)
+			}
+			continue
+		}
 		var t = '-'
 		if info.IsDir() {
 			t = 'd'
+			name = colors.paint("dir", name)
 		}
 		if cmd.long {
 			fmt.Printf("%c%s %s\n", t, info.Mode(), name)
@@ -104,7 +139,9 @@ func (cmd *ListCommand) list(client *Client, path string) int {
 			if !info.IsDir() {
 				continue
 			}
-			fmt.Println("")
+			if cmd.tmpl == nil {
+				fmt.Println("")
+			}
 			if code := cmd.list(client, info.Name()); code != 0 {
 				return code
 			}
@@ -114,11 +151,156 @@ func (cmd *ListCommand) list(client *Client, path string) int {
 	return 0
 }
 
+// listFind prints the paths of all secrets below path as they are listed, so
+// the first paths of large trees are shown immediately
+func (cmd *ListCommand) listFind(client *Client, path string) int {
+	infos, err := client.Glob(path)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, 1)
+	}
+	if len(infos) == 0 {
+		cmd.ui.Error(fmt.Sprintf("%s: not found", path))
+		return NotFoundError
+	}
+
+	for _, info := range infos {
+		if !info.IsDir() {
+			if err = cmd.printFind(client, info); err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %v", err))
+				return exitCode(err, SyntaxError)
+			}
+			continue
+		}
+		it := client.ListIter(info.Name(), true)
+		for it.Next() {
+			if it.Info().IsDir() {
+				continue
+			}
+			if err = cmd.printFind(client, it.Info()); err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %v", err))
+				return exitCode(err, SyntaxError)
+			}
+		}
+		if err = it.Err(); err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, 1)
+		}
+	}
+
+	return 0
+}
+
+func (cmd *ListCommand) printFind(client *Client, info os.FileInfo) error {
+	if cmd.tmpl != nil {
+		return cmd.printTemplate(client, info)
+	}
+	if cmd.long {
+		fmt.Printf("-%s %s\n", info.Mode(), info.Name())
+	} else {
+		fmt.Println(info.Name())
+	}
+	return nil
+}
+
+// printTemplate prints info formatted with the template of -template
+func (cmd *ListCommand) printTemplate(client *Client, info os.FileInfo) error {
+	line, err := executeListTemplate(cmd.tmpl, &listEntry{
+		Path:   info.Name(),
+		Name:   path.Base(info.Name()),
+		Dir:    info.IsDir(),
+		client: client,
+	})
+	if err != nil {
+		return err
+	}
+	cmd.ui.Output(line)
+	return nil
+}
+
+// listEntry is a secret, or directory, formatted with -template; the metadata
+// of KV v2 secrets is read when the template uses it
+type listEntry struct {
+	Path string
+	Name string
+	Dir  bool
+
+	client   *Client
+	metadata map[string]interface{}
+	read     bool
+}
+
+// Metadata returns the metadata of a KV v2 secret, or nil; the path may be
+// below metadata/ of the mount, as listed by ls
+func (e *listEntry) Metadata() (map[string]interface{}, error) {
+	if e.read || e.Dir || e.client == nil {
+		return e.metadata, nil
+	}
+	e.read = true
+	l, err := e.client.Resolve(e.Path)
+	if err != nil || l.KVVersion != 2 {
+		return nil, nil
+	}
+	metadataPath := l.APIPath("metadata")
+	if strings.HasPrefix(l.Path, "metadata/") {
+		metadataPath = strings.Trim(e.Path, "/")
+	}
+	secret, err := e.client.Read(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	if secret != nil {
+		e.metadata = secret.Data
+	}
+	return e.metadata, nil
+}
+
+// Version returns the current version of a KV v2 secret, or 0
+func (e *listEntry) Version() (int, error) {
+	metadata, err := e.Metadata()
+	if err != nil {
+		return 0, err
+	}
+	return parseInt(metadata["current_version"])
+}
+
+// Updated returns the time a KV v2 secret was last updated, or the zero time
+func (e *listEntry) Updated() (time.Time, error) {
+	metadata, err := e.Metadata()
+	if err != nil {
+		return time.Time{}, err
+	}
+	updated, _ := metadata["updated_time"].(string)
+	if updated == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, updated)
+}
+
+// parseListTemplate parses the Go template of -template, of list results
+func parseListTemplate(text string) (*textTemplate.Template, error) {
+	t, err := textTemplate.New("template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("-template: %v", err)
+	}
+	return t, nil
+}
+
+// executeListTemplate formats data as a line with the template
+func executeListTemplate(t *textTemplate.Template, data interface{}) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		// Errors of Metadata are wrapped by the template
+		return "", fmt.Errorf("-template: %v", err)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
 func (cmd *ListCommand) listMounts(client *Client) int {
 	mounts, err := client.Sys().ListMounts()
 	if err != nil {
 		cmd.ui.Error(err.Error())
-		return 1
+		return exitCode(err, 1)
 	}
 
 	var names []string
@@ -132,8 +314,9 @@ func (cmd *ListCommand) listMounts(client *Client) int {
 		return 0
 	}
 
+	colors := cmd.colors(os.Stdout)
 	if cmd.recurse {
-		fmt.Println("/:")
+		fmt.Println(colors.paint("header", "/:"))
 	}
 
 	sort.Strings(names)
@@ -141,9 +324,9 @@ func (cmd *ListCommand) listMounts(client *Client) int {
 		name = strings.TrimSuffix(name, "/")
 
 		if cmd.long {
-			fmt.Printf("drwxr-x--- %s\n", name)
+			fmt.Printf("drwxr-x--- %s\n", colors.paint("dir", name))
 		} else {
-			fmt.Println(name)
+			fmt.Println(colors.paint("dir", name))
 		}
 
 		if cmd.recurse {
@@ -173,6 +356,8 @@ func ListCommandFactory(ui cli.Ui) cli.CommandFactory {
 		cmd.fs.BoolVar(&cmd.compact, "1", false, "list in compact format")
 		cmd.fs.BoolVar(&cmd.long, "l", false, "list in long format")
 		cmd.fs.BoolVar(&cmd.recurse, "R", false, "recursively list subdirectories encountered")
+		cmd.fs.BoolVar(&cmd.find, "find", false, "print the paths of all secrets below the paths, as they are listed")
+		cmd.fs.StringVar(&cmd.format, "template", "", "print each secret formatted with the Go template")
 		cmd.fs.Usage = func() {
 			fmt.Print(cmd.Help())
 		}
@@ -0,0 +1,69 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestListCommandTemplate(t *testing.T) {
+	var metadataReads int
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		request := r.Method + " " + strings.TrimSuffix(r.URL.Path, "/")
+		if r.URL.Query().Get("list") == "true" {
+			request = "LIST " + strings.TrimSuffix(r.URL.Path, "/")
+		}
+		switch request {
+		case "LIST /v1/kv/metadata/app":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"web", "db"}}}
+		case "GET /v1/kv/metadata/app/db", "GET /v1/kv/metadata/app/web":
+			metadataReads++
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"current_version": 3,
+				"updated_time":    "2026-10-01T12:00:00Z",
+			}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"kv/": "kv-v2"})
+
+	ls := func(args ...string) (*cli.MockUi, int) {
+		ui := cli.NewMockUi()
+		command, _ := ListCommandFactory(ui)()
+		cmd := command.(*ListCommand)
+		cmd.c, cmd.config = c, new(Config)
+		return ui, cmd.Run(args)
+	}
+
+	ui, code := ls("-template", "{{ .Name }} {{ .Dir }}", "kv/metadata/app")
+	if code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if got, want := ui.OutputWriter.String(), "db false\nweb false\n"; got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+	if metadataReads != 0 {
+		t.Fatalf("expected no metadata reads, got %d", metadataReads)
+	}
+
+	ui, code = ls("-find", "-template", `{{ .Path }} {{ .Version }} {{ .Updated.Format "2006-01-02" }}`, "kv/metadata/app")
+	if code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if got, want := ui.OutputWriter.String(), "/kv/metadata/app/db 3 2026-10-01\n/kv/metadata/app/web 3 2026-10-01\n"; got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	if _, code = ls("-template", "{{ .Path", "kv/metadata/app"); code != SyntaxError {
+		t.Fatalf("expected syntax error for an invalid template, got %d", code)
+	}
+	if _, code = ls("-template", "{{ .Owner }}", "kv/metadata/app"); code != SyntaxError {
+		t.Fatalf("expected syntax error for an unknown field, got %d", code)
+	}
+}
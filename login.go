@@ -0,0 +1,444 @@
+package vc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+
+	"github.com/tehmaze/vc/client"
+)
+
+// Environment variables used by the approle login method
+const (
+	RoleIDEnv   = "VAULT_ROLE_ID"
+	SecretIDEnv = "VAULT_SECRET_ID"
+)
+
+// Defaults for the login methods
+const (
+	kubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	ec2IdentityURL      = "http://169.254.169.254/latest/dynamic/instance-identity/pkcs7"
+	ec2TokenURL         = "http://169.254.169.254/latest/api/token"
+	ec2CredentialsURL   = "http://169.254.169.254/latest/meta-data/iam/security-credentials/"
+	oidcListenAddr      = "localhost:8250"
+	oidcTimeout         = 2 * time.Minute
+)
+
+// loginMethods maps login methods to their implementation
+var loginMethods = map[string]func(*LoginCommand, *Client, string) (*api.Secret, error){
+	"approle":    (*LoginCommand).loginAppRole,
+	"aws":        (*LoginCommand).loginAWS,
+	"cert":       (*LoginCommand).loginCert,
+	"kubernetes": (*LoginCommand).loginKubernetes,
+	"ldap":       (*LoginCommand).loginLDAP,
+	"oidc":       (*LoginCommand).loginOIDC,
+	"token":      (*LoginCommand).loginToken,
+}
+
+// LoginCommand authenticates to Vault and stores the resulting token
+type LoginCommand struct {
+	baseCommand
+	fs       *flag.FlagSet
+	method   string
+	path     string
+	role     string
+	username string
+	token    string
+	roleID   string
+	secretID string
+	jwtFile  string
+	nonce    string
+	listen   string
+	noStore  bool
+}
+
+func (cmd *LoginCommand) Help() string {
+	var methods []string
+	for method := range loginMethods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	return `Usage: vc login [<options>]
+
+Authenticates to Vault and stores the token in the token store. Without
+method, the method is detected from the environment: an explicit token, an
+AppRole role ID (` + RoleIDEnv + `), a Kubernetes service account or a TLS
+client certificate (VAULT_CLIENT_CERT) are tried in order, and otherwise vc
+prompts for a token.
+
+Methods: ` + strings.Join(methods, ", ") + `
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *LoginCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) != 0 {
+		return Help
+	}
+
+	method := cmd.method
+	if method == "" {
+		method = cmd.detectMethod()
+		Debugf("login: detected method %s", method)
+	}
+	login, ok := loginMethods[method]
+	if !ok {
+		cmd.ui.Error(fmt.Sprintf("error: unsupported login method %q", method))
+		return SyntaxError
+	}
+	if err := cmd.checkPlaintextArgs(map[string]interface{}{"-token": cmd.token, "-secret-id": cmd.secretID}); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	mount := cmd.path
+	if mount == "" {
+		mount = method
+	}
+	mount = strings.Trim(mount, "/")
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	if method != "token" {
+		client.ClearToken()
+	}
+
+	secret, err := login(cmd, client, mount)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	if secret == nil {
+		cmd.ui.Error("error: no token returned")
+		return exitCode(err, ServerError)
+	}
+
+	token, err := secret.TokenID()
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	if method == "token" {
+		// The lookup doesn't return the token itself
+		token = cmd.token
+	}
+	client.SetToken(token)
+
+	if !cmd.noStore {
+		store, err := cmd.tokenStore()
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+		if DryRun {
+			fmt.Fprintf(os.Stderr, "dry run: store token in %s\n", store)
+		} else if err = store.Store(token); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		} else if err = cmd.unlockSession(); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	}
+
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	observeTokenTTL(ttl)
+	policies, err := secret.TokenPolicies()
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	if ttl == 0 {
+		cmd.ui.Output("ttl:      never expires")
+	} else {
+		cmd.ui.Output(fmt.Sprintf("ttl:      %s", ttl))
+	}
+	cmd.ui.Output(fmt.Sprintf("policies: %s", strings.Join(policies, ", ")))
+	if secret.Auth != nil && secret.Auth.Metadata["nonce"] != "" && cmd.nonce == "" {
+		cmd.ui.Output(fmt.Sprintf("nonce:    %s (use -nonce to log in again)", secret.Auth.Metadata["nonce"]))
+	}
+
+	return Success
+}
+
+// detectMethod picks a login method based on the flags and environment
+func (cmd *LoginCommand) detectMethod() string {
+	if cmd.token != "" {
+		return "token"
+	}
+	if cmd.roleID != "" || os.Getenv(RoleIDEnv) != "" {
+		return "approle"
+	}
+	if _, err := os.Stat(cmd.jwtFile); err == nil {
+		return "kubernetes"
+	}
+	if os.Getenv("VAULT_CLIENT_CERT") != "" {
+		return "cert"
+	}
+	return "token"
+}
+
+func (cmd *LoginCommand) loginToken(c *Client, mount string) (*api.Secret, error) {
+	if cmd.token == "" {
+		var err error
+		if cmd.token, err = promptSecret("token", false); err != nil {
+			return nil, err
+		}
+	}
+	return (&client.Token{Token: cmd.token}).Login(&c.Client)
+}
+
+func (cmd *LoginCommand) loginAppRole(c *Client, mount string) (*api.Secret, error) {
+	roleID, secretID := cmd.roleID, cmd.secretID
+	if roleID == "" {
+		roleID = os.Getenv(RoleIDEnv)
+	}
+	if secretID == "" {
+		secretID = os.Getenv(SecretIDEnv)
+	}
+	auth := &client.AppRole{Mount: mount, RoleID: roleID, SecretID: secretID}
+	return auth.Login(&c.Client)
+}
+
+func (cmd *LoginCommand) loginAWS(c *Client, mount string) (*api.Secret, error) {
+	pkcs7, err := ec2Identity()
+	if err != nil {
+		return nil, fmt.Errorf("aws: %v", err)
+	}
+	data := map[string]interface{}{"pkcs7": pkcs7}
+	if cmd.role != "" {
+		data["role"] = cmd.role
+	}
+	if cmd.nonce != "" {
+		data["nonce"] = cmd.nonce
+	}
+	return c.Write("auth/"+mount+"/login", data)
+}
+
+func (cmd *LoginCommand) loginCert(c *Client, mount string) (*api.Secret, error) {
+	data := map[string]interface{}{}
+	if cmd.role != "" {
+		data["name"] = cmd.role
+	}
+	return c.Write("auth/"+mount+"/login", data)
+}
+
+func (cmd *LoginCommand) loginKubernetes(c *Client, mount string) (*api.Secret, error) {
+	auth := &client.Kubernetes{Mount: mount, Role: cmd.role, JWTFile: cmd.jwtFile}
+	return auth.Login(&c.Client)
+}
+
+func (cmd *LoginCommand) loginLDAP(c *Client, mount string) (*api.Secret, error) {
+	username := cmd.username
+	if username == "" {
+		username = os.Getenv("USER")
+	}
+	if username == "" {
+		return nil, errors.New("ldap: username is required")
+	}
+	password, err := promptSecret(fmt.Sprintf("password for %s", username), false)
+	if err != nil {
+		return nil, err
+	}
+	return c.Write("auth/"+mount+"/login/"+username, map[string]interface{}{
+		"password": password,
+	})
+}
+
+func (cmd *LoginCommand) loginOIDC(c *Client, mount string) (*api.Secret, error) {
+	l, err := net.Listen("tcp", cmd.listen)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: %v", err)
+	}
+	defer l.Close()
+
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return nil, err
+	}
+	var (
+		nonce    = hex.EncodeToString(b)
+		redirect = "http://" + cmd.listen + "/oidc/callback"
+	)
+	s, err := c.Write("auth/"+mount+"/oidc/auth_url", map[string]interface{}{
+		"role":         cmd.role,
+		"redirect_uri": redirect,
+		"client_nonce": nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var authURL string
+	if s != nil {
+		authURL, _ = s.Data["auth_url"].(string)
+	}
+	if authURL == "" {
+		return nil, fmt.Errorf("oidc: no authorization URL returned, check that %s is an allowed redirect URI", redirect)
+	}
+
+	type result struct {
+		secret *api.Secret
+		err    error
+	}
+	var (
+		done   = make(chan result, 1)
+		server = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/oidc/callback" {
+				http.NotFound(w, r)
+				return
+			}
+			q := r.URL.Query()
+			if message := q.Get("error_description"); message != "" {
+				fmt.Fprintln(w, "Login failed, you can close this window.")
+				done <- result{err: fmt.Errorf("oidc: %s", message)}
+				return
+			}
+			secret, err := c.ReadWithData("auth/"+mount+"/oidc/callback", map[string][]string{
+				"state":        {q.Get("state")},
+				"code":         {q.Get("code")},
+				"client_nonce": {nonce},
+			})
+			if err != nil {
+				fmt.Fprintln(w, "Login failed, you can close this window.")
+			} else {
+				fmt.Fprintln(w, "Login succeeded, you can close this window.")
+			}
+			done <- result{secret, err}
+		})}
+	)
+	go server.Serve(l)
+	defer server.Shutdown(context.Background())
+
+	fmt.Fprintf(os.Stderr, "Complete the login in your browser:\n\n    %s\n\n", authURL)
+	if err = openBrowser(authURL); err != nil {
+		Debugf("oidc: %v", err)
+	}
+
+	select {
+	case r := <-done:
+		return r.secret, r.err
+	case <-time.After(oidcTimeout):
+		return nil, errors.New("oidc: timeout waiting for the login to complete")
+	}
+}
+
+// ec2Identity fetches the PKCS#7 signed instance identity document from the
+// EC2 instance metadata service
+func ec2Identity() (string, error) {
+	b, err := ec2Metadata(ec2IdentityURL)
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(string(b), "\n", "", -1), nil
+}
+
+// ec2Metadata fetches url from the EC2 instance metadata service, using a
+// session token if IMDSv2 is available
+func ec2Metadata(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	var token string
+	r, err := http.NewRequest("PUT", ec2TokenURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	if res, err := client.Do(r); err == nil {
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			token = string(b)
+		}
+	}
+
+	if r, err = http.NewRequest("GET", url, nil); err != nil {
+		return nil, err
+	}
+	if token != "" {
+		r.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+	res, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("instance metadata: %s", res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// openBrowser opens url in the default web browser
+func openBrowser(url string) error {
+	var name string
+	switch runtime.GOOS {
+	case "darwin":
+		name = "open"
+	default:
+		name = "xdg-open"
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return err
+	}
+	return exec.Command(path, url).Start()
+}
+
+func (cmd *LoginCommand) Synopsis() string {
+	return "log in to Vault"
+}
+
+func LoginCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &LoginCommand{
+			baseCommand: baseCommand{
+				ui:      ui,
+				relogin: true,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("login", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.method, "method", "", "login method (default: detect)")
+		cmd.fs.StringVar(&cmd.path, "path", "", "mount path of the auth method (default: method)")
+		cmd.fs.StringVar(&cmd.role, "role", "", "role (aws, cert, kubernetes, oidc)")
+		cmd.fs.StringVar(&cmd.username, "username", "", "username (ldap, default: $USER)")
+		cmd.fs.StringVar(&cmd.token, "token", "", "token (token, default: prompt)")
+		cmd.fs.StringVar(&cmd.roleID, "role-id", "", "role ID (approle, default: $"+RoleIDEnv+")")
+		cmd.fs.StringVar(&cmd.secretID, "secret-id", "", "secret ID (approle, default: $"+SecretIDEnv+")")
+		cmd.fs.StringVar(&cmd.jwtFile, "jwt-file", kubernetesTokenFile, "service account token (kubernetes)")
+		cmd.fs.StringVar(&cmd.nonce, "nonce", "", "nonce returned by the first login (aws)")
+		cmd.fs.StringVar(&cmd.listen, "listen", oidcListenAddr, "callback listen address (oidc)")
+		cmd.fs.BoolVar(&cmd.noStore, "no-store", false, "don't store the token")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,25 @@
+package vc
+
+import "testing"
+
+func TestLoginCommand(t *testing.T) {
+	for _, test := range []testCommand{
+		testCommand{
+			Factory: LoginCommandFactory,
+			Args:    []string{"--help"},
+			Code:    Success,
+		},
+		testCommand{
+			Factory: LoginCommandFactory,
+			Args:    []string{"-method", "test"},
+			Code:    SyntaxError,
+		},
+	} {
+		if test.Live {
+			if err := testLiveAvailable(); err != nil {
+				t.Skip(err)
+			}
+		}
+		testCommandRun(t, test)
+	}
+}
@@ -0,0 +1,153 @@
+package vc
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/tehmaze/vc/client"
+)
+
+// mergeFormat returns the format for output name: json, yaml or dotenv by the
+// file extension, or json
+func mergeFormat(name string) string {
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".env":
+		return sopsFormat(name)
+	}
+	return "json"
+}
+
+// mergeSecrets overlays the secrets at paths in order, read with read; secrets
+// that don't exist are skipped, unless none of them exist
+func mergeSecrets(paths []string, read func(string) (*client.Secret, error)) (*client.Merged, error) {
+	m := client.NewMerged()
+	for _, path := range paths {
+		secret, err := read(path)
+		if err != nil && client.ErrorKind(err) != client.ErrNotFound {
+			return nil, err
+		} else if secret == nil || secret.Data == nil {
+			continue
+		}
+		data := make(map[string]interface{}, len(secret.Data))
+		for key, value := range secret.Data {
+			if key != CodecTypeKey {
+				data[key] = value
+			}
+		}
+		m.Add(path, data)
+	}
+	if len(m.Paths) == 0 {
+		return nil, notFound(fmt.Sprintf("merge %s: not found", strings.Join(paths, ", ")))
+	}
+	return m, nil
+}
+
+// MergeCommand overlays several secrets into one
+type MergeCommand struct {
+	baseCommand
+	fs      *flag.FlagSet
+	format  string
+	mod     string
+	sources bool
+}
+
+func (cmd *MergeCommand) Help() string {
+	return `Usage: vc merge [<options>] <secret path> [... <secret path>]
+
+Overlays the secrets in priority order, from the lowest to the highest: keys of
+a secret replace the keys of the secrets before it, such as defaults, an
+environment and an instance. Secrets that don't exist are skipped, unless none
+of them exist. The merged keys are written as a JSON, YAML or dotenv document;
+with -sources, the path each key came from is written instead.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *MergeCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) == 0 {
+		return Help
+	}
+	if mode, err := cmd.outputMode(cmd.fs, cmd.mod); err != nil {
+		cmd.ui.Error("error: " + err.Error())
+		return SyntaxError
+	} else {
+		cmd.mode = mode
+	}
+	if cmd.format == "" {
+		cmd.format = mergeFormat(cmd.out)
+	}
+
+	c, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	m, err := mergeSecrets(args, func(path string) (*client.Secret, error) {
+		return cmd.readSource(path, c.ReadSecret)
+	})
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+
+	var (
+		doc  []byte
+		data = m.Data
+	)
+	if cmd.sources {
+		data = make(map[string]interface{}, len(m.Sources))
+		for key, path := range m.Sources {
+			data[key] = path
+		}
+	}
+	if doc, err = encodeDocument(data, cmd.format); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return CodecError
+	}
+	if len(doc) > 0 && doc[len(doc)-1] != '\n' {
+		doc = append(doc, '\n')
+	}
+	defer wipe(doc)
+
+	if _, err = cmd.Write(doc); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if err = cmd.Close(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	return Success
+}
+
+func (cmd *MergeCommand) Synopsis() string {
+	return "overlay secrets in priority order"
+}
+
+func MergeCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &MergeCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("merge", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.out, "o", "", "output (default: stdout)")
+		cmd.fs.StringVar(&cmd.mod, "m", "0600", "output mode")
+		cmd.fs.StringVar(&cmd.format, "format", "", "format: json, yaml or dotenv (default: from output file extension, or json)")
+		cmd.fs.BoolVar(&cmd.sources, "sources", false, "write the path each key came from, instead of the values")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
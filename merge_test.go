@@ -0,0 +1,72 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestMergeCommand(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/secret/app/defaults":
+			response = map[string]interface{}{"data": map[string]interface{}{"host": "localhost", "port": 5432, "user": "app"}}
+		case "GET /v1/secret/app/prod":
+			response = map[string]interface{}{"data": map[string]interface{}{"host": "db.prod", "password": "s3cr3t", CodecTypeKey: "json"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	dir, err := ioutil.TempDir("", "vc-merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		Args []string
+		Want string
+	}{
+		{
+			[]string{"secret/app/defaults", "secret/app/prod", "secret/app/prod/web1"},
+			"{\n  \"host\": \"db.prod\",\n  \"password\": \"s3cr3t\",\n  \"port\": 5432,\n  \"user\": \"app\"\n}\n",
+		},
+		{
+			[]string{"-sources", "-format", "dotenv", "secret/app/defaults", "secret/app/prod"},
+			"host=secret/app/prod\npassword=secret/app/prod\nport=secret/app/defaults\nuser=secret/app/defaults\n",
+		},
+	} {
+		out := filepath.Join(dir, "merged")
+		ui := cli.NewMockUi()
+		command, _ := MergeCommandFactory(ui)()
+		cmd := command.(*MergeCommand)
+		cmd.c, cmd.config = c, new(Config)
+		if code := cmd.Run(append([]string{"-o", out}, test.Args...)); code != Success {
+			t.Fatalf("%v: expected success, got %d: %s", test.Args, code, ui.ErrorWriter.String())
+		}
+		b, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.Want {
+			t.Errorf("%v: expected %q, got %q", test.Args, test.Want, b)
+		}
+	}
+
+	ui := cli.NewMockUi()
+	command, _ := MergeCommandFactory(ui)()
+	cmd := command.(*MergeCommand)
+	cmd.c, cmd.config = c, new(Config)
+	if code := cmd.Run([]string{"secret/app/test", "secret/app/qa"}); code != NotFoundError {
+		t.Fatalf("expected exit code %d, got %d: %s", NotFoundError, code, ui.ErrorWriter.String())
+	}
+}
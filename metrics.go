@@ -0,0 +1,238 @@
+package vc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// MetricsFile is the file metrics are written to when vc exits, in the
+// Prometheus text format (for the node_exporter textfile collector)
+var MetricsFile string
+
+// Metrics kinds
+const (
+	counterMetric   = "counter"
+	gaugeMetric     = "gauge"
+	histogramMetric = "histogram"
+)
+
+// requestBuckets are the histogram buckets for Vault request latency, in
+// seconds
+var requestBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is a metric family, with one series per set of label values
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels []string
+	value  float64
+	counts []uint64
+	count  uint64
+}
+
+// metricRegistry holds the metrics collected by vc
+type metricRegistry struct {
+	mutex   sync.Mutex
+	metrics []*metric
+}
+
+// register adds a metric to the registry
+func (r *metricRegistry) register(name, kind, help string, buckets []float64, labels ...string) *metric {
+	m := &metric{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// get returns the series for the label values; the registry must be locked
+func (m *metric) get(values []string) *metricSeries {
+	key := strings.Join(values, "\x00")
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{labels: values}
+		if m.kind == histogramMetric {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// add adds delta to a counter or gauge
+func (r *metricRegistry) add(m *metric, delta float64, values ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	m.get(values).value += delta
+}
+
+// set sets the value of a gauge
+func (r *metricRegistry) set(m *metric, value float64, values ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	m.get(values).value = value
+}
+
+// observe records an observation in a histogram
+func (r *metricRegistry) observe(m *metric, value float64, values ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	s := m.get(values)
+	for i, bound := range m.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (r *metricRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var n int64
+	printf := func(format string, v ...interface{}) error {
+		i, err := fmt.Fprintf(w, format, v...)
+		n += int64(i)
+		return err
+	}
+	for _, m := range r.metrics {
+		if len(m.series) == 0 {
+			continue
+		}
+		if err := printf("# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind); err != nil {
+			return n, err
+		}
+
+		keys := make([]string, 0, len(m.series))
+		for key := range m.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			var (
+				s   = m.series[key]
+				err error
+			)
+			if m.kind != histogramMetric {
+				err = printf("%s%s %s\n", m.name, metricLabels(m.labels, s.labels), formatMetric(s.value))
+			} else {
+				var (
+					names  = append(m.labels[:len(m.labels):len(m.labels)], "le")
+					values = append(s.labels[:len(s.labels):len(s.labels)], "")
+				)
+				for i, bound := range m.buckets {
+					values[len(values)-1] = formatMetric(bound)
+					if err = printf("%s_bucket%s %d\n", m.name, metricLabels(names, values), s.counts[i]); err != nil {
+						return n, err
+					}
+				}
+				values[len(values)-1] = "+Inf"
+				labels := metricLabels(m.labels, s.labels)
+				err = printf("%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+					m.name, metricLabels(names, values), s.count,
+					m.name, labels, formatMetric(s.value),
+					m.name, labels, s.count)
+			}
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// metricLabels formats label pairs
+func metricLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetric(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Metrics collected by vc
+var (
+	metrics = new(metricRegistry)
+
+	requestDuration = metrics.register("vc_vault_request_duration_seconds", histogramMetric,
+		"Latency of Vault requests.", requestBuckets, "operation")
+	requestErrors = metrics.register("vc_vault_request_errors_total", counterMetric,
+		"Failed Vault requests, by HTTP status code (0 for connection errors).", nil, "operation", "code")
+	rendersTotal = metrics.register("vc_renders_total", counterMetric,
+		"Templates rendered.", nil)
+	filesChanged = metrics.register("vc_files_changed_total", counterMetric,
+		"Output files that changed.", nil)
+	tokenTTL = metrics.register("vc_token_ttl_seconds", gaugeMetric,
+		"Remaining TTL of the Vault token, as of the last login or lookup.", nil)
+	cacheReads = metrics.register("vc_cache_stale_reads_total", counterMetric,
+		"Reads served from the cache because Vault was unreachable.", nil)
+	vaultUp = metrics.register("vc_vault_up", gaugeMetric,
+		"Whether Vault is reachable, 0 while the circuit breaker of the agent is open.", nil)
+)
+
+// observeRequest records the latency and outcome of a Vault request
+func observeRequest(operation string, start time.Time, err error) {
+	metrics.observe(requestDuration, time.Since(start).Seconds(), operation)
+	if err != nil {
+		code := 0
+		if res, ok := err.(*api.ResponseError); ok {
+			code = res.StatusCode
+		}
+		metrics.add(requestErrors, 1, operation, strconv.Itoa(code))
+	}
+}
+
+// observeTokenTTL records the remaining TTL of the token, in the metrics and
+// the health
+func observeTokenTTL(ttl time.Duration) {
+	metrics.set(tokenTTL, ttl.Seconds())
+	health.token(ttl, nil)
+}
+
+// WriteMetrics writes the collected metrics to MetricsFile, if set
+func WriteMetrics() error {
+	if MetricsFile == "" {
+		return nil
+	}
+	w := SafeOutputWriter(MetricsFile, 0644)
+	if _, err := metrics.WriteTo(w); err != nil {
+		if sw, ok := w.(*safeOutputWriter); ok {
+			sw.abort()
+		}
+		return err
+	}
+	if w == os.Stdout || w == os.Stderr {
+		return nil
+	}
+	return w.Close()
+}
@@ -0,0 +1,46 @@
+package vc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMetricRegistry(t *testing.T) {
+	var (
+		r        = new(metricRegistry)
+		latency  = r.register("test_duration_seconds", histogramMetric, "Latency.", []float64{.1, 1}, "operation")
+		errors   = r.register("test_errors_total", counterMetric, "Errors.", nil, "operation", "code")
+		ttl      = r.register("test_ttl_seconds", gaugeMetric, "TTL.", nil)
+		_        = r.register("test_unused_total", counterMetric, "Unused.", nil)
+		buf      bytes.Buffer
+		expected = `# HELP test_duration_seconds Latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{operation="read",le="0.1"} 1
+test_duration_seconds_bucket{operation="read",le="1"} 1
+test_duration_seconds_bucket{operation="read",le="+Inf"} 2
+test_duration_seconds_sum{operation="read"} 2.05
+test_duration_seconds_count{operation="read"} 2
+# HELP test_errors_total Errors.
+# TYPE test_errors_total counter
+test_errors_total{operation="read",code="403"} 2
+test_errors_total{operation="write",code="0"} 1
+# HELP test_ttl_seconds TTL.
+# TYPE test_ttl_seconds gauge
+test_ttl_seconds 3600
+`
+	)
+	r.observe(latency, .05, "read")
+	r.observe(latency, 2, "read")
+	r.add(errors, 1, "write", "0")
+	r.add(errors, 1, "read", "403")
+	r.add(errors, 1, "read", "403")
+	r.set(ttl, 60)
+	r.set(ttl, 3600)
+
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
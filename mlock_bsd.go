@@ -0,0 +1,13 @@
+// +build darwin freebsd openbsd netbsd dragonfly
+
+package vc
+
+// mlockPermitted reports that memory can't be locked; the BSDs have no
+// portable way to check the limits
+func mlockPermitted() bool {
+	return false
+}
+
+func lockMemory() error {
+	return nil
+}
@@ -0,0 +1,29 @@
+// +build linux
+
+package vc
+
+import (
+	"os"
+	"syscall"
+)
+
+// rlimitMemlock is RLIMIT_MEMLOCK, which the syscall package doesn't define
+const rlimitMemlock = 8
+
+// rlimInfinity is RLIM_INFINITY
+const rlimInfinity = ^uint64(0)
+
+func mlockPermitted() bool {
+	if os.Geteuid() == 0 {
+		return true
+	}
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(rlimitMemlock, &limit); err != nil {
+		return false
+	}
+	return limit.Cur == rlimInfinity
+}
+
+func lockMemory() error {
+	return syscall.Mlockall(syscall.MCL_CURRENT | syscall.MCL_FUTURE)
+}
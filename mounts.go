@@ -0,0 +1,277 @@
+package vc
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+
+	"github.com/tehmaze/vc/client"
+)
+
+// MountsCommand manages the mounts of secrets engines
+type MountsCommand struct {
+	baseCommand
+	fs          *flag.FlagSet
+	sub         string
+	path        string
+	description string
+	defaultTTL  string
+	maxTTL      string
+	version     int
+	force       bool
+}
+
+func (cmd *MountsCommand) Help() string {
+	switch cmd.sub {
+	case "list":
+		return `Usage: vc mounts list
+
+List the mounts of secrets engines, with their type, KV version and TTLs; TTLs
+of 0 are the system defaults.
+`
+	case "enable":
+		return `Usage: vc mounts enable [<options>] <type>
+
+Enable a secrets engine of type, such as kv, pki or transit, at -path (the type
+by default). For kv, -version selects KV version 1 or 2.
+
+Options:
+` + defaults(cmd.fs)
+	case "disable":
+		return `Usage: vc mounts disable [<options>] <path>
+
+Disable the mount at path, after confirmation. This destroys all the secrets in
+the mount, and revokes their leases.
+
+Options:
+` + defaults(cmd.fs)
+	case "tune":
+		return `Usage: vc mounts tune [<options>] <path>
+
+Change the TTLs or the description of the mount at path, or upgrade a KV v1
+mount to KV v2 with -version 2. Only the options given are changed.
+
+Options:
+` + defaults(cmd.fs)
+	}
+	return `Usage: vc mounts <list|enable|disable|tune> [<options>]`
+}
+
+func (cmd *MountsCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	args = cmd.fs.Args()
+	if (cmd.sub == "list" && len(args) != 0) || (cmd.sub != "list" && len(args) != 1) {
+		return Help
+	}
+	if cmd.version < 0 || cmd.version > 2 {
+		cmd.ui.Error(fmt.Sprintf("error: invalid -version %d, expected 1 or 2", cmd.version))
+		return SyntaxError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	switch cmd.sub {
+	case "list":
+		err = cmd.list(client)
+	case "enable":
+		err = cmd.enable(client, args[0])
+	case "disable":
+		err = cmd.disable(client, mountPath(args[0]))
+	case "tune":
+		err = cmd.tune(client, mountPath(args[0]))
+	default:
+		return Help
+	}
+	if err != nil {
+		err = classifyError(err)
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	return Success
+}
+
+// mountPath returns the path of a mount with a trailing slash, such as
+// "secret/"
+func mountPath(path string) string {
+	return strings.Trim(path, "/") + "/"
+}
+
+func (cmd *MountsCommand) list(c *Client) error {
+	mounts, err := c.Sys().ListMounts()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(mounts))
+	for name := range mounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		b = new(bytes.Buffer)
+		w = tabwriter.NewWriter(b, 0, 8, 2, ' ', 0)
+	)
+	fmt.Fprintln(w, "PATH\tTYPE\tVERSION\tDEFAULT TTL\tMAX TTL\tDESCRIPTION")
+	for _, name := range names {
+		info := mounts[name]
+		version := "-"
+		if v := client.KVVersion(info); v > 0 {
+			version = strconv.Itoa(v)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", name, info.Type, version,
+			mountTTL(info.Config.DefaultLeaseTTL), mountTTL(info.Config.MaxLeaseTTL), info.Description)
+	}
+	w.Flush()
+	cmd.ui.Output(strings.TrimSuffix(b.String(), "\n"))
+	return nil
+}
+
+// mountTTL formats a TTL in seconds
+func mountTTL(ttl int) string {
+	return (time.Duration(ttl) * time.Second).String()
+}
+
+func (cmd *MountsCommand) enable(c *Client, engine string) error {
+	path := cmd.path
+	if path == "" {
+		path = engine
+	}
+	path = mountPath(path)
+	input := &api.MountInput{
+		Type:        engine,
+		Description: cmd.description,
+		Config: api.MountConfigInput{
+			DefaultLeaseTTL: cmd.defaultTTL,
+			MaxLeaseTTL:     cmd.maxTTL,
+		},
+	}
+	if cmd.version != 0 {
+		if engine != "kv" {
+			return fmt.Errorf("-version is only supported for kv, not %s", engine)
+		}
+		input.Options = map[string]string{"version": strconv.Itoa(cmd.version)}
+	}
+	if DryRun {
+		cmd.ui.Output(fmt.Sprintf("dry run: enable %s at %s", engine, path))
+		return nil
+	}
+	if err := c.Sys().Mount(path, input); err != nil {
+		return err
+	}
+	cmd.ui.Output(cmd.colors(os.Stdout).change("+ " + path))
+	return nil
+}
+
+func (cmd *MountsCommand) disable(c *Client, path string) error {
+	mounts, err := c.Sys().ListMounts()
+	if err != nil {
+		return err
+	}
+	info, ok := mounts[path]
+	if !ok {
+		return notFound(fmt.Sprintf("no mount at %s", path))
+	}
+	changes := []string{fmt.Sprintf("- %s (%s)", path, info.Type)}
+	if ok, err := cmd.confirmChanges(cmd.force, changes, "Disable the mount at %s, destroying all its secrets?", path); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("not confirmed, %s is not disabled", path)
+	}
+	if DryRun {
+		cmd.ui.Output("dry run: disable the mount at " + path)
+		return nil
+	}
+	if err = c.Sys().Unmount(path); err != nil {
+		return err
+	}
+	cmd.ui.Output(cmd.colors(os.Stdout).change("- " + path))
+	return nil
+}
+
+func (cmd *MountsCommand) tune(c *Client, path string) error {
+	var (
+		input api.MountConfigInput
+		set   = make(map[string]bool)
+	)
+	cmd.fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if len(set) == 0 {
+		return fmt.Errorf("nothing to change, see vc mounts tune -h")
+	}
+	input.DefaultLeaseTTL, input.MaxLeaseTTL = cmd.defaultTTL, cmd.maxTTL
+	if set["description"] {
+		input.Description = &cmd.description
+	}
+	if set["version"] {
+		input.Options = map[string]string{"version": strconv.Itoa(cmd.version)}
+	}
+	if DryRun {
+		cmd.ui.Output("dry run: tune the mount at " + path)
+		return nil
+	}
+	if err := c.Sys().TuneMount(path, input); err != nil {
+		return err
+	}
+	cmd.ui.Output(cmd.colors(os.Stdout).change("~ " + path))
+	return nil
+}
+
+func (cmd *MountsCommand) Synopsis() string {
+	switch cmd.sub {
+	case "list":
+		return "list the mounts of secrets engines"
+	case "enable":
+		return "enable a secrets engine"
+	case "disable":
+		return "disable a secrets engine, destroying its secrets"
+	case "tune":
+		return "tune the mount of a secrets engine"
+	}
+	return "manage the mounts of secrets engines"
+}
+
+func MountsCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &MountsCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("mounts "+sub, flag.ContinueOnError)
+		switch sub {
+		case "enable":
+			cmd.fs.StringVar(&cmd.path, "path", "", "mount path (default: type)")
+		case "disable":
+			cmd.fs.BoolVar(&cmd.force, "f", false, "don't ask for confirmation")
+		}
+		if sub == "enable" || sub == "tune" {
+			cmd.fs.StringVar(&cmd.description, "description", "", "description of the mount")
+			cmd.fs.StringVar(&cmd.defaultTTL, "default-ttl", "", "default lease TTL, such as 768h")
+			cmd.fs.StringVar(&cmd.maxTTL, "max-ttl", "", "maximum lease TTL")
+			cmd.fs.IntVar(&cmd.version, "version", 0, "KV version (1 or 2)")
+		}
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
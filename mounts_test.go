@@ -0,0 +1,95 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestMountsCommand(t *testing.T) {
+	var (
+		requests []string
+		written  = make(map[string]map[string]interface{})
+	)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]interface{}
+		if r.Method == "POST" || r.Method == "PUT" {
+			json.NewDecoder(r.Body).Decode(&data)
+			written[r.URL.Path] = data
+		}
+		if r.Method != "GET" {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/mounts":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"secret/": map[string]interface{}{"type": "kv", "options": map[string]string{"version": "2"}, "description": "key/value secrets"},
+				"pki/":    map[string]interface{}{"type": "pki", "config": map[string]int{"default_lease_ttl": 3600, "max_lease_ttl": 86400}},
+			})
+		}
+	}), nil)
+
+	run := func(sub string, args ...string) (*cli.MockUi, int) {
+		ui := cli.NewMockUi()
+		command, _ := MountsCommandFactory(ui, sub)()
+		cmd := command.(*MountsCommand)
+		cmd.c, cmd.config = c, new(Config)
+		return ui, cmd.Run(args)
+	}
+
+	ui, code := run("list")
+	if code != Success {
+		t.Fatalf("list: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	want := "PATH     TYPE  VERSION  DEFAULT TTL  MAX TTL  DESCRIPTION\n" +
+		"pki/     pki   -        1h0m0s       24h0m0s  \n" +
+		"secret/  kv    2        0s           0s       key/value secrets\n"
+	if got := ui.OutputWriter.String(); got != want {
+		t.Fatalf("list: expected\n%s\ngot\n%s", want, got)
+	}
+
+	if ui, code = run("enable", "-path", "apps", "-version", "2", "-max-ttl", "24h", "kv"); code != Success {
+		t.Fatalf("enable: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if ui, code = run("enable", "-version", "2", "pki"); code != ServerError {
+		t.Fatalf("enable: expected error for -version with pki, got %d", code)
+	}
+	if ui, code = run("tune", "-default-ttl", "1h", "pki"); code != Success {
+		t.Fatalf("tune: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if ui, code = run("tune", "pki"); code == Success {
+		t.Fatal("tune: expected error without options")
+	}
+
+	// Disabling needs confirmation
+	if ui, code = run("disable", "pki"); code == Success {
+		t.Fatal("disable: expected error without confirmation")
+	}
+	if ui, code = run("disable", "-f", "missing"); code != NotFoundError {
+		t.Fatalf("disable: expected not found, got %d", code)
+	}
+	if ui, code = run("disable", "-f", "/pki/"); code != Success {
+		t.Fatalf("disable: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+
+	wantRequests := []string{
+		"POST /v1/sys/mounts/apps",
+		"POST /v1/sys/mounts/pki/tune",
+		"DELETE /v1/sys/mounts/pki",
+	}
+	if !reflect.DeepEqual(requests, wantRequests) {
+		t.Fatalf("expected requests\n%s\ngot\n%s", strings.Join(wantRequests, "\n"), strings.Join(requests, "\n"))
+	}
+	mount := written["/v1/sys/mounts/apps"]
+	if mount["type"] != "kv" || !reflect.DeepEqual(mount["options"], map[string]interface{}{"version": "2"}) ||
+		mount["config"].(map[string]interface{})["max_lease_ttl"] != "24h" {
+		t.Fatalf("unexpected mount %v", mount)
+	}
+	if tune := written["/v1/sys/mounts/pki/tune"]; tune["default_lease_ttl"] != "1h" || tune["description"] != nil {
+		t.Fatalf("unexpected tune %v", tune)
+	}
+}
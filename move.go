@@ -3,8 +3,6 @@ package vc
 import (
 	"flag"
 	"fmt"
-	"os"
-	"strings"
 
 	"github.com/mitchellh/cli"
 )
@@ -24,7 +22,7 @@ func (cmd *MoveCommand) Run(args []string) int {
 	if err := cmd.fs.Parse(args); err != nil {
 		return 1
 	}
-	if args = cmd.fs.Args(); len(args) != 2 {
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) != 2 {
 		return cli.RunResultHelp
 	}
 
@@ -39,44 +37,44 @@ func (cmd *MoveCommand) Run(args []string) int {
 	}
 
 	// Read secret at old path
-	secret, err := client.Logical().Read(strings.TrimLeft(args[0], "/"))
+	secret, err := client.Read(args[0])
 	if err != nil {
 		cmd.ui.Error(err.Error())
-		return 1
+		return exitCode(err, 1)
 	}
 	if secret == nil {
 		cmd.ui.Error(fmt.Sprintf("no secret at %q", args[0]))
-		return 1
+		return NotFoundError
 	}
 
 	// Check if secret at new path exists, unless force is enabled
 	if !cmd.force {
-		oldSecret, oerr := client.Logical().Read(strings.TrimLeft(args[1], "/"))
+		oldSecret, oerr := client.Read(args[1])
 		if oerr != nil {
 			cmd.ui.Error(oerr.Error())
-			return 1
+			return exitCode(oerr, 1)
 		}
 		if oldSecret != nil {
-			if !IsTerminal(os.Stdout.Fd()) {
-				cmd.ui.Error(fmt.Sprintf("secret at %q already exists", args[1]))
+			ok, err := cmd.confirmChanges(false, describeChanges(oldSecret.Data, secret.Data), "secret at %s already exists, overwrite?", args[1])
+			if err != nil {
+				cmd.ui.Error(err.Error())
 				return 1
-			}
-			if !confirmf("secret at %s already exists, overwrite?", args[1]) {
+			} else if !ok {
 				return 0
 			}
 		}
 	}
 
 	// Write secret at new path
-	if _, err = client.Logical().Write(strings.TrimLeft(args[1], "/"), secret.Data); err != nil {
+	if err = cmd.writeSecret(client, args[1], secret.Data); err != nil {
 		cmd.ui.Error(err.Error())
-		return 1
+		return exitCode(err, 1)
 	}
 
 	// Delete secret at old path
-	if _, err = client.Logical().Delete(strings.TrimLeft(args[0], "/")); err != nil {
+	if err = cmd.deleteSecret(client, args[0]); err != nil {
 		cmd.ui.Error(err.Error())
-		return 1
+		return exitCode(err, 1)
 	}
 
 	return 0
@@ -0,0 +1,551 @@
+package vc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+)
+
+// OperatorCommand seals and unseals Vault, and rekeys it or generates a root
+// token with the unseal key shares
+type OperatorCommand struct {
+	baseCommand
+	fs        *flag.FlagSet
+	sub       string
+	force     bool
+	reset     bool
+	migrate   bool
+	cancel    bool
+	shares    int
+	threshold int
+	pgpKeys   string
+	wrapTTL   time.Duration
+
+	// stdin has the key shares when stdin is not a terminal
+	stdin *bufio.Reader
+}
+
+func (cmd *OperatorCommand) Help() string {
+	switch cmd.sub {
+	case "seal":
+		return `Usage: vc operator seal [<options>]
+
+Seal Vault, after confirmation. Sealed, Vault serves no requests until it is
+unsealed with the unseal key shares.
+
+Options:
+` + defaults(cmd.fs)
+	case "unseal":
+		return `Usage: vc operator unseal [<options>]
+
+Unseal Vault. The key shares are prompted for without echo on a terminal, or
+read from stdin (one per line) otherwise, until the threshold is reached; key
+shares are never accepted as arguments, as they would end up in the shell
+history.
+
+Options:
+` + defaults(cmd.fs)
+	case "rekey":
+		return `Usage: vc operator rekey [<options>]
+
+Generate new unseal key shares, with the current key shares which are prompted
+for like vc operator unseal. A rekey that is in progress is continued. The new
+key shares are written to -o, encrypted to the --encrypt-to recipients if
+given; with -wrap-ttl, each key share is response wrapped and the wrapping
+tokens are written instead, to hand out to the key holders. With -pgp-keys,
+Vault encrypts each key share to the public key of its holder.
+
+Options:
+` + defaults(cmd.fs)
+	case "generate-root":
+		return `Usage: vc operator generate-root [<options>]
+
+Generate a root token, with the unseal key shares which are prompted for like
+vc operator unseal. The one-time password is kept in memory, and the decoded
+root token is written to -o, encrypted to the --encrypt-to recipients if given,
+or wrapped with -wrap-ttl. With -pgp-keys, Vault encrypts the root token to the
+public key instead. Revoke the root token once you're done with it.
+
+Options:
+` + defaults(cmd.fs)
+	}
+	return `Usage: vc operator <seal|unseal|rekey|generate-root> [<options>]`
+}
+
+func (cmd *OperatorCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) > 0 {
+		return Help
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	switch cmd.sub {
+	case "seal":
+		err = cmd.seal(client)
+	case "unseal":
+		err = cmd.unseal(client)
+	case "rekey":
+		err = cmd.rekey(client)
+	case "generate-root":
+		err = cmd.generateRoot(client)
+	default:
+		return Help
+	}
+	if err != nil {
+		err = classifyError(err)
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	return Success
+}
+
+func (cmd *OperatorCommand) seal(client *Client) error {
+	if ok, err := cmd.confirmChanges(cmd.force, nil, "Seal Vault at %s?", client.Address()); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("not confirmed")
+	}
+	if DryRun {
+		cmd.ui.Output("dry run: seal Vault at " + client.Address())
+		return nil
+	}
+	if err := client.Sys().Seal(); err != nil {
+		return err
+	}
+	cmd.ui.Info("seal: Vault is sealed")
+	return nil
+}
+
+func (cmd *OperatorCommand) unseal(client *Client) error {
+	status, err := client.Sys().SealStatus()
+	if err != nil {
+		return err
+	}
+	if cmd.reset {
+		if DryRun {
+			cmd.ui.Output("dry run: reset the unseal progress")
+		} else if status, err = client.Sys().ResetUnsealProcess(); err != nil {
+			return err
+		}
+	}
+	if !status.Sealed {
+		cmd.ui.Info("unseal: Vault is not sealed")
+		return nil
+	}
+	if DryRun {
+		cmd.ui.Output(fmt.Sprintf("dry run: unseal Vault, %d of %d key shares entered", status.Progress, status.T))
+		return nil
+	}
+
+	for status.Sealed {
+		key, err := cmd.keyShare("Unseal key share", status.Progress+1, status.T)
+		if err != nil {
+			return fmt.Errorf("not unsealed, %d of %d key shares entered: %v", status.Progress, status.T, err)
+		}
+		if status, err = client.Sys().UnsealWithOptions(&api.UnsealOpts{Key: key, Migrate: cmd.migrate}); err != nil {
+			return err
+		}
+		if status.Sealed {
+			cmd.ui.Info(fmt.Sprintf("unseal: %d of %d key shares entered", status.Progress, status.T))
+		}
+	}
+	cmd.ui.Info("unseal: Vault is unsealed")
+	return nil
+}
+
+func (cmd *OperatorCommand) rekey(client *Client) error {
+	status, err := client.Sys().RekeyStatus()
+	if err != nil {
+		return err
+	}
+	if cmd.cancel {
+		if !status.Started {
+			cmd.ui.Info("rekey: no rekey in progress")
+			return nil
+		} else if DryRun {
+			cmd.ui.Output("dry run: cancel the rekey in progress")
+			return nil
+		}
+		if err = client.Sys().RekeyCancel(); err != nil {
+			return err
+		}
+		cmd.ui.Info("rekey: cancelled")
+		return nil
+	}
+
+	if status.Started {
+		cmd.ui.Info(fmt.Sprintf("rekey: continuing the rekey in progress, into %d key shares with a threshold of %d", status.N, status.T))
+	} else {
+		if cmd.shares < 1 || cmd.threshold < 1 || cmd.threshold > cmd.shares {
+			return fmt.Errorf("invalid -shares %d and -threshold %d", cmd.shares, cmd.threshold)
+		}
+		pgpKeys, err := readPGPKeys(cmd.pgpKeys)
+		if err != nil {
+			return err
+		}
+		if len(pgpKeys) > 0 && len(pgpKeys) != cmd.shares {
+			return fmt.Errorf("%d PGP keys for %d key shares", len(pgpKeys), cmd.shares)
+		}
+		if DryRun {
+			cmd.ui.Output(fmt.Sprintf("dry run: rekey into %d key shares with a threshold of %d", cmd.shares, cmd.threshold))
+			return nil
+		}
+		if status, err = client.Sys().RekeyInit(&api.RekeyInitRequest{
+			SecretShares:    cmd.shares,
+			SecretThreshold: cmd.threshold,
+			PGPKeys:         pgpKeys,
+		}); err != nil {
+			return err
+		}
+	}
+	if DryRun {
+		cmd.ui.Output(fmt.Sprintf("dry run: rekey, %d of %d key shares entered", status.Progress, status.Required))
+		return nil
+	}
+	cmd.ui.Info("rekey: nonce " + status.Nonce)
+
+	for progress := status.Progress; ; progress++ {
+		key, err := cmd.keyShare("Current key share", progress+1, status.Required)
+		if err != nil {
+			return fmt.Errorf("not rekeyed, %d of %d key shares entered (cancel with -cancel): %v", progress, status.Required, err)
+		}
+		res, err := client.Sys().RekeyUpdate(key, status.Nonce)
+		if err != nil {
+			return err
+		}
+		if !res.Complete {
+			cmd.ui.Info(fmt.Sprintf("rekey: %d of %d key shares entered", progress+1, status.Required))
+			continue
+		}
+
+		keys := res.KeysB64
+		if len(keys) == 0 {
+			keys = res.Keys
+		}
+		if err = cmd.output(client, "Key share", keys); err != nil {
+			// The old key shares no longer work, so don't lose the new ones
+			for i, key := range keys {
+				fmt.Fprintf(os.Stderr, "Key share %d: %s\n", i+1, key)
+			}
+			return fmt.Errorf("rekeyed, but writing the key shares failed: %v", err)
+		}
+		cmd.ui.Info(fmt.Sprintf("rekey: Vault is rekeyed into %d key shares with a threshold of %d", len(keys), status.T))
+		if res.VerificationRequired {
+			cmd.ui.Warn("warning: rekey: the new key shares must be verified before they are used")
+		}
+		return nil
+	}
+}
+
+func (cmd *OperatorCommand) generateRoot(client *Client) error {
+	status, err := client.Sys().GenerateRootStatus()
+	if err != nil {
+		return err
+	}
+	if cmd.cancel {
+		if !status.Started {
+			cmd.ui.Info("generate-root: no root token generation in progress")
+			return nil
+		} else if DryRun {
+			cmd.ui.Output("dry run: cancel the root token generation in progress")
+			return nil
+		}
+		if err = client.Sys().GenerateRootCancel(); err != nil {
+			return err
+		}
+		cmd.ui.Info("generate-root: cancelled")
+		return nil
+	}
+	if status.Started {
+		// The one-time password of the generation in progress is not known
+		return errors.New("a root token generation is in progress, cancel it with -cancel first")
+	}
+
+	pgpKeys, err := readPGPKeys(cmd.pgpKeys)
+	if err != nil {
+		return err
+	} else if len(pgpKeys) > 1 {
+		return errors.New("the root token is encrypted to a single PGP key")
+	}
+	if DryRun {
+		cmd.ui.Output("dry run: generate a root token")
+		return nil
+	}
+	var pgpKey string
+	if len(pgpKeys) == 1 {
+		pgpKey = pgpKeys[0]
+	}
+	if status, err = client.Sys().GenerateRootInit("", pgpKey); err != nil {
+		return err
+	}
+	otp := status.OTP
+	if pgpKey == "" && otp == "" {
+		client.Sys().GenerateRootCancel()
+		return errors.New("Vault returned no one-time password, it needs to be version 1.10 or later")
+	}
+	cmd.ui.Info("generate-root: nonce " + status.Nonce)
+
+	for status.Progress < status.Required {
+		key, err := cmd.keyShare("Unseal key share", status.Progress+1, status.Required)
+		if err != nil {
+			client.Sys().GenerateRootCancel()
+			return fmt.Errorf("no root token generated, %d of %d key shares entered: %v", status.Progress, status.Required, err)
+		}
+		nonce := status.Nonce
+		if status, err = client.Sys().GenerateRootUpdate(key, nonce); err != nil {
+			return err
+		}
+		if status.Complete {
+			break
+		}
+		cmd.ui.Info(fmt.Sprintf("generate-root: %d of %d key shares entered", status.Progress, status.Required))
+	}
+
+	token := status.EncodedRootToken
+	if token == "" {
+		token = status.EncodedToken
+	}
+	if pgpKey == "" {
+		if token, err = decodeRootToken(token, otp); err != nil {
+			return err
+		}
+	}
+	if err = cmd.output(client, "Root token", []string{token}); err != nil {
+		return err
+	}
+	cmd.ui.Info("generate-root: root token generated, revoke it once you're done")
+	return nil
+}
+
+// keyShare reads key share n of t; key shares are prompted for without echo on
+// a terminal, or read from stdin
+func (cmd *OperatorCommand) keyShare(label string, n, t int) (string, error) {
+	if stopping() {
+		return "", errors.New("shutting down")
+	}
+	if cmd.stdin == nil && IsTerminal(os.Stdin.Fd()) {
+		key, err := promptSecret(fmt.Sprintf("%s (%d of %d)", label, n, t), false)
+		if err == nil && strings.TrimSpace(key) == "" {
+			err = errors.New("no key share entered")
+		}
+		return strings.TrimSpace(key), err
+	}
+	if cmd.stdin == nil {
+		cmd.stdin = bufio.NewReader(os.Stdin)
+	}
+	for {
+		line, err := cmd.stdin.ReadString('\n')
+		if key := strings.TrimSpace(line); key != "" {
+			return key, nil
+		}
+		if err == io.EOF {
+			return "", errors.New("no more key shares on stdin")
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// output writes the key shares or the root token in values, numbered if there
+// are several; with -wrap-ttl, each value is response wrapped, and the wrapping
+// tokens are written instead
+func (cmd *OperatorCommand) output(client *Client, label string, values []string) error {
+	if cmd.wrapTTL > 0 {
+		wrapped := make([]string, len(values))
+		for i, value := range values {
+			token, err := wrapValue(client, cmd.wrapTTL, value)
+			if err != nil {
+				return fmt.Errorf("wrapping the %s: %v", strings.ToLower(label), err)
+			}
+			wrapped[i] = token
+		}
+		values, label = wrapped, "Wrapped "+strings.ToLower(label)
+	}
+
+	b := new(secureBuffer)
+	defer b.Wipe()
+	for i, value := range values {
+		if len(values) > 1 {
+			fmt.Fprintf(b, "%s %d: %s\n", label, i+1, value)
+		} else {
+			fmt.Fprintf(b, "%s: %s\n", label, value)
+		}
+	}
+	if cmd.wrapTTL > 0 {
+		fmt.Fprintf(b, "\nThe wrapping tokens expire in %s, unwrap with: vault unwrap <token>\n", cmd.wrapTTL)
+	}
+	if _, err := cmd.Write(b.Bytes()); err != nil {
+		cmd.abort()
+		return err
+	}
+	return cmd.Close()
+}
+
+// wrapValue response wraps value with ttl, and returns the wrapping token
+func wrapValue(client *Client, ttl time.Duration, value string) (string, error) {
+	return wrapData(client, ttl, map[string]interface{}{"value": value})
+}
+
+// wrapData response wraps data with ttl, and returns the wrapping token
+func wrapData(client *Client, ttl time.Duration, data map[string]interface{}) (string, error) {
+	client.SetWrappingLookupFunc(func(operation, path string) string {
+		if path == "sys/wrapping/wrap" {
+			return ttl.String()
+		}
+		return ""
+	})
+	defer client.SetWrappingLookupFunc(nil)
+
+	secret, err := client.Write("sys/wrapping/wrap", data)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+		return "", errors.New("no wrapping token returned")
+	}
+	return secret.WrapInfo.Token, nil
+}
+
+// decodeRootToken decodes the encoded root token with the one-time password
+func decodeRootToken(encoded, otp string) (string, error) {
+	b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid encoded root token: %v", err)
+	}
+	if len(b) != len(otp) {
+		return "", fmt.Errorf("invalid encoded root token: length %d, expected %d", len(b), len(otp))
+	}
+	for i := range b {
+		b[i] ^= otp[i]
+	}
+	return string(b), nil
+}
+
+// readPGPKeys reads the public keys in the files, separated by commas, for
+// Vault: base64 encoded as is, or armored or binary keys which are encoded.
+// Keybase users ("keybase:name") are passed to Vault.
+func readPGPKeys(names string) ([]string, error) {
+	if names == "" {
+		return nil, nil
+	}
+	var keys []string
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, "keybase:") {
+			keys = append(keys, name)
+			continue
+		}
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		b = bytes.TrimSpace(b)
+		if _, err = base64.StdEncoding.DecodeString(string(b)); err == nil {
+			keys = append(keys, string(b))
+			continue
+		}
+		if bytes.HasPrefix(b, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+			if b, err = dearmorPGPKey(b); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		keys = append(keys, base64.StdEncoding.EncodeToString(b))
+	}
+	return keys, nil
+}
+
+// dearmorPGPKey returns the binary key in an armored public key block
+func dearmorPGPKey(armored []byte) ([]byte, error) {
+	var (
+		body   bytes.Buffer
+		inBody bool
+	)
+	for _, line := range strings.Split(string(armored), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "-----BEGIN"):
+		case strings.HasPrefix(line, "-----END"):
+			inBody = false
+		case !inBody && line == "":
+			// Headers end with an empty line
+			inBody = true
+		case inBody && !strings.HasPrefix(line, "="):
+			// Lines starting with = are the checksum
+			body.WriteString(line)
+		}
+	}
+	b, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid armored public key")
+	}
+	return b, nil
+}
+
+func (cmd *OperatorCommand) Synopsis() string {
+	switch cmd.sub {
+	case "seal":
+		return "seal Vault"
+	case "unseal":
+		return "unseal Vault with the key shares"
+	case "rekey":
+		return "generate new unseal key shares"
+	case "generate-root":
+		return "generate a root token with the key shares"
+	}
+	return "operate Vault"
+}
+
+func OperatorCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &OperatorCommand{
+			baseCommand: baseCommand{
+				ui:   ui,
+				mode: 0600,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("operator "+sub, flag.ContinueOnError)
+		switch sub {
+		case "seal":
+			cmd.fs.BoolVar(&cmd.force, "f", false, "don't ask for confirmation")
+		case "unseal":
+			cmd.fs.BoolVar(&cmd.reset, "reset", false, "discard the key shares entered before")
+			cmd.fs.BoolVar(&cmd.migrate, "migrate", false, "unseal during a seal migration")
+		case "rekey":
+			cmd.fs.IntVar(&cmd.shares, "shares", 5, "number of key shares")
+			cmd.fs.IntVar(&cmd.threshold, "threshold", 3, "number of key shares required to unseal")
+			cmd.fs.StringVar(&cmd.pgpKeys, "pgp-keys", "", "public key files (or keybase:<user>) to encrypt the key shares to, separated by commas")
+		case "generate-root":
+			cmd.fs.StringVar(&cmd.pgpKeys, "pgp-keys", "", "public key file (or keybase:<user>) to encrypt the root token to")
+		}
+		if sub == "rekey" || sub == "generate-root" {
+			cmd.fs.BoolVar(&cmd.cancel, "cancel", false, "cancel the operation in progress")
+			cmd.fs.DurationVar(&cmd.wrapTTL, "wrap-ttl", 0, "response wrap the output, for ttl")
+			cmd.fs.StringVar(&cmd.out, "o", "", "output (default: stdout)")
+		}
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,136 @@
+package vc
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+// testOperatorVault is a fake Vault that needs two key shares, k1 and k2
+func testOperatorVault(t *testing.T) *Client {
+	t.Helper()
+
+	var (
+		sealed   = true
+		progress int
+		otp      = "0123456789abcdef0123456789ab"
+		token    = "hvs.0123456789abcdefghijklmn"
+	)
+	return newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]interface{}
+		if r.Method == "PUT" || r.Method == "POST" {
+			json.NewDecoder(r.Body).Decode(&data)
+		}
+		share := func() bool {
+			if key := data["key"]; key != "k1" && key != "k2" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"invalid key"}})
+				return false
+			}
+			progress++
+			return true
+		}
+
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/seal-status":
+			response = map[string]interface{}{"sealed": sealed, "t": 2, "n": 3, "progress": progress}
+		case "PUT /v1/sys/unseal":
+			if !share() {
+				return
+			}
+			if progress == 2 {
+				sealed, progress = false, 0
+			}
+			response = map[string]interface{}{"sealed": sealed, "t": 2, "n": 3, "progress": progress}
+		case "GET /v1/sys/generate-root/attempt", "GET /v1/sys/rekey/init":
+			response = map[string]interface{}{"started": false}
+		case "PUT /v1/sys/generate-root/attempt":
+			response = map[string]interface{}{"started": true, "nonce": "n", "required": 2, "otp": otp, "otp_length": len(otp)}
+		case "PUT /v1/sys/generate-root/update":
+			if !share() {
+				return
+			}
+			encoded := []byte(token)
+			for i := range encoded {
+				encoded[i] ^= otp[i]
+			}
+			response = map[string]interface{}{"started": true, "nonce": "n", "required": 2, "progress": progress,
+				"complete": progress == 2, "encoded_token": base64.RawStdEncoding.EncodeToString(encoded)}
+		case "PUT /v1/sys/rekey/init":
+			response = map[string]interface{}{"started": true, "nonce": "n", "t": data["secret_threshold"], "n": data["secret_shares"], "required": 2}
+		case "PUT /v1/sys/rekey/update":
+			if !share() {
+				return
+			}
+			response = map[string]interface{}{"nonce": "n", "complete": progress == 2, "keys_base64": []string{"n1", "n2", "n3"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), nil)
+}
+
+func TestOperatorCommand(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "operator")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		sub    string
+		args   []string
+		stdin  string
+		code   int
+		output string
+	}{
+		{"unseal", nil, "k1\n\nk2\n", Success, ""},
+		{"unseal", nil, "k1\n", ServerError, ""},
+		{"unseal", nil, "k1\nbad\n", ServerError, ""},
+		{"generate-root", nil, "k1\nk2\n", Success, "Root token: hvs.0123456789abcdefghijklmn\n"},
+		{"rekey", []string{"-shares", "3", "-threshold", "2"}, "k1\nk2\n", Success, "Key share 1: n1\nKey share 2: n2\nKey share 3: n3\n"},
+		{"rekey", []string{"-shares", "2", "-threshold", "3"}, "", ServerError, ""},
+	}
+	for _, test := range tests {
+		c := testOperatorVault(t)
+		ui := cli.NewMockUi()
+		factory := OperatorCommandFactory(ui, test.sub)
+		command, _ := factory()
+		cmd := command.(*OperatorCommand)
+		cmd.c, cmd.config = c, new(Config)
+		cmd.stdin = bufio.NewReader(strings.NewReader(test.stdin))
+
+		out := filepath.Join(dir, test.sub)
+		args := test.args
+		if test.sub != "unseal" {
+			args = append(args, "-o", out)
+		}
+		code := cmd.Run(args)
+		if code != test.code {
+			t.Fatalf("%s %v: expected return code %d, got %d: %s", test.sub, test.args, test.code, code, ui.ErrorWriter.String())
+		}
+		if test.output == "" {
+			continue
+		}
+		if b, err := ioutil.ReadFile(out); err != nil {
+			t.Fatal(err)
+		} else if string(b) != test.output {
+			t.Fatalf("%s: expected output %q, got %q", test.sub, test.output, b)
+		}
+		if fi, err := os.Stat(out); err != nil {
+			t.Fatal(err)
+		} else if fi.Mode().Perm() != 0600 {
+			t.Fatalf("%s: expected mode 0600, got %s", test.sub, fi.Mode())
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// +build darwin freebsd openbsd netbsd dragonfly linux
+
+package vc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// readPassword reads a line from the terminal at fd with local echo disabled.
+func readPassword(fd uintptr) ([]byte, error) {
+	var state syscall.Termios
+	if _, _, err := syscall.Syscall6(syscall.SYS_IOCTL, fd, ioctlReadTermios, uintptr(unsafe.Pointer(&state)), 0, 0, 0); err != 0 {
+		return nil, err
+	}
+
+	noecho := state
+	noecho.Lflag &^= syscall.ECHO
+	noecho.Lflag |= syscall.ICANON | syscall.ISIG
+	noecho.Iflag |= syscall.ICRNL
+	if _, _, err := syscall.Syscall6(syscall.SYS_IOCTL, fd, ioctlWriteTermios, uintptr(unsafe.Pointer(&noecho)), 0, 0, 0); err != 0 {
+		return nil, err
+	}
+	defer syscall.Syscall6(syscall.SYS_IOCTL, fd, ioctlWriteTermios, uintptr(unsafe.Pointer(&state)), 0, 0, 0)
+
+	var (
+		line []byte
+		buf  [1]byte
+	)
+	for {
+		n, err := syscall.Read(int(fd), buf[:])
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 || buf[0] == '\n' {
+			break
+		}
+		line = append(line, buf[0])
+	}
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// promptSecret asks for a value on the terminal without echoing it back; if
+// verify is set, the user has to enter the value twice.
+func promptSecret(label string, verify bool) (string, error) {
+	if !IsTerminal(os.Stdin.Fd()) {
+		return "", errors.New("unable to prompt: stdin is not a terminal")
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+	value, err := readPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	if verify {
+		fmt.Fprintf(os.Stderr, "%s (again): ", label)
+		again, err := readPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(again) != string(value) {
+			return "", errors.New("values do not match")
+		}
+	}
+
+	return string(value), nil
+}
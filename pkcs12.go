@@ -0,0 +1,352 @@
+package vc
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"unicode/utf16"
+)
+
+// PKCS#12 (RFC 7292) object identifiers
+var (
+	oidPKCS7Data          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7EncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidSHA1               = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidPBEWithSHA3DES     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidShroudedKeyBag     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+
+	// oidJavaTrustedKeyUsage marks a certificate without a key as trusted,
+	// for the Java PKCS12 keystore, with oidAnyExtendedKeyUsage
+	oidJavaTrustedKeyUsage = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+)
+
+// pkcs12Iterations is the number of iterations of the PKCS#12 key derivation,
+// as used by Java and OpenSSL
+const pkcs12Iterations = 2048
+
+type pkcs12PFX struct {
+	Version  int
+	AuthSafe pkcs12ContentInfo
+	MacData  pkcs12MacData
+}
+
+type pkcs12ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type pkcs12EncryptedData struct {
+	Version              int
+	EncryptedContentInfo pkcs12EncryptedContentInfo
+}
+
+type pkcs12EncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type pkcs12MacData struct {
+	Mac        pkcs12DigestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type pkcs12DigestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pkcs12PBEParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pkcs12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID     asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type pkcs12CertBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pkcs12EncryptedPrivateKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Data      []byte
+}
+
+// encodePKCS12 encodes the keystore as PKCS#12, encrypted and authenticated
+// with password. The key and certificates are encrypted with
+// pbeWithSHAAnd3-KeyTripleDES-CBC and the MAC is HMAC-SHA1, which all Java
+// versions can read.
+func encodePKCS12(ks *keystore, password string) ([]byte, error) {
+	pass := pkcs12Password(password)
+	defer wipe(pass)
+
+	var certBags, keyBags []pkcs12SafeBag
+	for _, entry := range ks.entries {
+		var localKeyID []byte
+		if entry.key != nil {
+			sum := sha1.Sum(entry.chain[0].Raw)
+			localKeyID = sum[:]
+			bag, err := pkcs12KeyBag(entry.key, pass, entry.alias, localKeyID)
+			if err != nil {
+				return nil, err
+			}
+			keyBags = append(keyBags, bag)
+		}
+		for i, cert := range entry.chain {
+			bag := pkcs12SafeBag{ID: oidCertBag}
+			b, err := asn1.Marshal(pkcs12CertBag{ID: oidCertTypeX509, Data: cert.Raw})
+			if err != nil {
+				return nil, err
+			}
+			bag.Value.FullBytes, _ = asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b})
+			switch {
+			case entry.key != nil && i == 0:
+				bag.Attributes = pkcs12Attributes(entry.alias, localKeyID, false)
+			case entry.key == nil:
+				bag.Attributes = pkcs12Attributes(entry.alias, nil, true)
+			}
+			certBags = append(certBags, bag)
+		}
+	}
+
+	var authSafe []pkcs12ContentInfo
+	if len(certBags) > 0 {
+		plain, err := asn1.Marshal(certBags)
+		if err != nil {
+			return nil, err
+		}
+		info, err := pkcs12Encrypt(plain, pass)
+		if err != nil {
+			return nil, err
+		}
+		authSafe = append(authSafe, info)
+	}
+	if len(keyBags) > 0 {
+		plain, err := asn1.Marshal(keyBags)
+		if err != nil {
+			return nil, err
+		}
+		authSafe = append(authSafe, pkcs12Data(plain))
+	}
+	if len(authSafe) == 0 {
+		return nil, errors.New("pkcs12: no entries")
+	}
+
+	content, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 20)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	macKey := pkcs12Derive(salt, pass, 3, pkcs12Iterations, 20)
+	defer wipe(macKey)
+	mac := hmac.New(sha1.New, macKey)
+	mac.Write(content)
+
+	return asn1.Marshal(pkcs12PFX{
+		Version:  3,
+		AuthSafe: pkcs12Data(content),
+		MacData: pkcs12MacData{
+			Mac: pkcs12DigestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    salt,
+			Iterations: pkcs12Iterations,
+		},
+	})
+}
+
+// pkcs12KeyBag returns the shrouded key bag for the PKCS#8 encoded key
+func pkcs12KeyBag(key, pass []byte, alias string, localKeyID []byte) (pkcs12SafeBag, error) {
+	bag := pkcs12SafeBag{ID: oidShroudedKeyBag}
+	algorithm, encrypted, err := pkcs12PBEEncrypt(key, pass)
+	if err != nil {
+		return bag, err
+	}
+	b, err := asn1.Marshal(pkcs12EncryptedPrivateKeyInfo{Algorithm: algorithm, Data: encrypted})
+	if err != nil {
+		return bag, err
+	}
+	bag.Value.FullBytes, _ = asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b})
+	bag.Attributes = pkcs12Attributes(alias, localKeyID, false)
+	return bag, nil
+}
+
+// pkcs12Attributes returns the bag attributes: the friendly name (the alias),
+// the local key ID linking a key to its certificate, and for certificates
+// without a key, the Java trusted key usage
+func pkcs12Attributes(alias string, localKeyID []byte, trusted bool) []pkcs12Attribute {
+	var attrs []pkcs12Attribute
+	add := func(id asn1.ObjectIdentifier, value []byte) {
+		attrs = append(attrs, pkcs12Attribute{ID: id, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value}})
+	}
+	if alias != "" {
+		name := pkcs12BMPString(alias)
+		b, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: 30, Bytes: name})
+		add(oidFriendlyName, b)
+	}
+	if localKeyID != nil {
+		b, _ := asn1.Marshal(localKeyID)
+		add(oidLocalKeyID, b)
+	}
+	if trusted {
+		b, _ := asn1.Marshal(oidAnyExtendedKeyUsage)
+		add(oidJavaTrustedKeyUsage, b)
+	}
+	return attrs
+}
+
+// pkcs12Data returns the content info for data
+func pkcs12Data(data []byte) pkcs12ContentInfo {
+	b, _ := asn1.Marshal(data)
+	return pkcs12ContentInfo{
+		ContentType: oidPKCS7Data,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	}
+}
+
+// pkcs12Encrypt returns the encrypted data content info for data
+func pkcs12Encrypt(data, pass []byte) (pkcs12ContentInfo, error) {
+	algorithm, encrypted, err := pkcs12PBEEncrypt(data, pass)
+	if err != nil {
+		return pkcs12ContentInfo{}, err
+	}
+	b, err := asn1.Marshal(pkcs12EncryptedData{
+		EncryptedContentInfo: pkcs12EncryptedContentInfo{
+			ContentType:                oidPKCS7Data,
+			ContentEncryptionAlgorithm: algorithm,
+			EncryptedContent:           encrypted,
+		},
+	})
+	if err != nil {
+		return pkcs12ContentInfo{}, err
+	}
+	return pkcs12ContentInfo{
+		ContentType: oidPKCS7EncryptedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	}, nil
+}
+
+// pkcs12PBEEncrypt encrypts data with pbeWithSHAAnd3-KeyTripleDES-CBC
+func pkcs12PBEEncrypt(data, pass []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	var algorithm pkix.AlgorithmIdentifier
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return algorithm, nil, err
+	}
+	params, err := asn1.Marshal(pkcs12PBEParams{Salt: salt, Iterations: pkcs12Iterations})
+	if err != nil {
+		return algorithm, nil, err
+	}
+	algorithm = pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHA3DES, Parameters: asn1.RawValue{FullBytes: params}}
+
+	key := pkcs12Derive(salt, pass, 1, pkcs12Iterations, 24)
+	defer wipe(key)
+	iv := pkcs12Derive(salt, pass, 2, pkcs12Iterations, 8)
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return algorithm, nil, err
+	}
+
+	// PKCS#7 padding
+	n := block.BlockSize() - len(data)%block.BlockSize()
+	encrypted := make([]byte, len(data)+n)
+	copy(encrypted, data)
+	for i := len(data); i < len(encrypted); i++ {
+		encrypted[i] = byte(n)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+	return algorithm, encrypted, nil
+}
+
+// pkcs12Derive derives size bytes of key material with SHA-1 from the salt
+// and password, for the id (1 for keys, 2 for IVs and 3 for MAC keys), see
+// RFC 7292 appendix B.2
+func pkcs12Derive(salt, pass []byte, id byte, iterations, size int) []byte {
+	const u, v = sha1.Size, 64
+
+	D := make([]byte, v)
+	for i := range D {
+		D[i] = id
+	}
+	fill := func(b []byte) []byte {
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+	I := append(fill(salt), fill(pass)...)
+	defer wipe(I)
+
+	var (
+		out []byte
+		one = big.NewInt(1)
+	)
+	for len(out) < size {
+		h := sha1.New()
+		h.Write(D)
+		h.Write(I)
+		A := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			sum := sha1.Sum(A)
+			A = sum[:]
+		}
+		out = append(out, A...)
+
+		// I_j = (I_j + B + 1) mod 2^(8v), with B the hash repeated to v bytes
+		B := new(big.Int).SetBytes(fill(A))
+		for j := 0; j < len(I); j += v {
+			Ij := new(big.Int).SetBytes(I[j : j+v])
+			Ij.Add(Ij, B).Add(Ij, one)
+			b := Ij.Bytes()
+			if len(b) > v {
+				b = b[len(b)-v:]
+			}
+			for k := range I[j : j+v-len(b)] {
+				I[j+k] = 0
+			}
+			copy(I[j+v-len(b):j+v], b)
+		}
+	}
+	return out[:size]
+}
+
+// pkcs12Password returns the password as a NUL terminated BMPString
+func pkcs12Password(password string) []byte {
+	return append(pkcs12BMPString(password), 0, 0)
+}
+
+// pkcs12BMPString encodes s as UTF-16 big endian
+func pkcs12BMPString(s string) []byte {
+	var b []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return b
+}
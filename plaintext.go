@@ -0,0 +1,137 @@
+package vc
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// AllowPlaintextArgs allows secret values as literal command line arguments,
+// from --allow-plaintext-args; see checkPlaintextArgs
+var AllowPlaintextArgs bool
+
+// Values of plaintext_args in the configuration file
+const (
+	plaintextArgsWarn   = "warn"
+	plaintextArgsRefuse = "refuse"
+)
+
+// plaintextKeyWords are parts of the names of keys and flags with secret
+// values
+var plaintextKeyWords = []string{"password", "passwd", "secret", "token", "private", "credential", "apikey", "api_key", "api-key"}
+
+// plaintextPrefixes are prefixes of well known tokens and keys
+var plaintextPrefixes = []string{"hvs.", "hvb.", "AKIA", "ASIA", "ghp_", "gho_", "github_pat_", "glpat-", "xoxb-", "xoxp-", "sk_live_", "-----BEGIN"}
+
+// plaintextLegacyToken matches the service tokens of Vault before 1.10, s.
+// and 24 to 26 characters of base62; a bare s. prefix matches host names too
+var plaintextLegacyToken = regexp.MustCompile(`^s\.[0-9A-Za-z]{24,26}$`)
+
+// plaintextUUID matches UUIDs, such as of entities and accessors, which are
+// identifiers; secret IDs are recognized by their flag or key
+var plaintextUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}(-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}$`)
+
+// checkPlaintextArgs checks the values given as literal command line
+// arguments, by the name of their key or flag: values that look like secrets
+// end up in the shell history. They are reported as a warning, or refused if
+// plaintext_args in the configuration file is refuse, unless
+// AllowPlaintextArgs is set.
+func (cmd *baseCommand) checkPlaintextArgs(values map[string]interface{}) error {
+	if AllowPlaintextArgs {
+		return nil
+	}
+	var names []string
+	for _, name := range sortedKeys(values) {
+		if value, ok := values[name].(string); ok && looksSecret(name, value) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	config, err := cmd.Config()
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("%s looks like a secret on the command line, it ends up in the shell history; read it from a prompt (-), a file (@file) or stdin (@-), or use --allow-plaintext-args", strings.Join(names, ", "))
+	switch config.PlaintextArgs {
+	case "", plaintextArgsWarn:
+		cmd.ui.Warn("warning: " + message)
+		return nil
+	case plaintextArgsRefuse:
+		return fmt.Errorf("refusing %s", message)
+	default:
+		return fmt.Errorf("invalid plaintext_args %q, use %s or %s", config.PlaintextArgs, plaintextArgsWarn, plaintextArgsRefuse)
+	}
+}
+
+// looksSecret checks if value, of the key or flag name, looks like a secret:
+// by the name, a well known prefix, credentials in a URL, or its entropy
+func looksSecret(name, value string) bool {
+	if value == "" {
+		return false
+	}
+	lower := strings.ToLower(name)
+	for _, word := range plaintextKeyWords {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	for _, prefix := range plaintextPrefixes {
+		if strings.HasPrefix(value, prefix) && len(value) > len(prefix)+8 {
+			return true
+		}
+	}
+	if plaintextLegacyToken.MatchString(value) {
+		return true
+	}
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		_, ok := u.User.Password()
+		return ok
+	}
+	if len(value) < 20 || strings.ContainsAny(value, " /") || plaintextUUID.MatchString(value) {
+		// Short values, sentences, paths and identifiers
+		return false
+	}
+	return shannonEntropy(value) >= 3.5 && characterClasses(value) >= 3
+}
+
+// shannonEntropy returns the entropy of s, in bits per character
+func shannonEntropy(s string) float64 {
+	var (
+		counts = make(map[rune]int)
+		n      float64
+	)
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// characterClasses counts the classes of characters in s: lower case, upper
+// case, digits and others
+func characterClasses(s string) int {
+	var lower, upper, digit, other int
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = 1
+		case r >= 'A' && r <= 'Z':
+			upper = 1
+		case r >= '0' && r <= '9':
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
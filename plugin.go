@@ -0,0 +1,190 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// PluginProtocol is the version of the plugin protocol, passed to plugins in
+// the VC_PLUGIN_PROTOCOL environment variable
+const PluginProtocol = "1"
+
+// Plugin request types
+const (
+	pluginRead    = "read"
+	pluginProcess = "process"
+)
+
+// pluginRequest is written to the plugin on stdin as JSON
+type pluginRequest struct {
+	Type string `json:"type"`
+
+	// Path is the path to read, without the scheme (read)
+	Path string `json:"path,omitempty"`
+
+	// Output is the output file, or "" for stdout (process)
+	Output string `json:"output,omitempty"`
+
+	// Content is the rendered output, base64 encoded (process)
+	Content []byte `json:"content,omitempty"`
+}
+
+// pluginResponse is read from the plugin's stdout as JSON
+type pluginResponse struct {
+	// Data is the secret that was read, null if not found (read)
+	Data map[string]interface{} `json:"data"`
+
+	// Content replaces the output, base64 encoded; if null, nothing is
+	// written (process)
+	Content []byte `json:"content"`
+
+	// Error is an error message
+	Error string `json:"error,omitempty"`
+}
+
+// source reads secrets from a backend other than Vault, for paths with a
+// scheme such as name://path
+type source interface {
+	Read(path string) (*api.Secret, error)
+}
+
+// splitScheme splits a path with a scheme, such as consul://config/app
+func splitScheme(path string) (scheme, rest string, ok bool) {
+	i := strings.Index(path, "://")
+	if i < 1 || strings.ContainsAny(path[:i], "/@") {
+		return "", path, false
+	}
+	return path[:i], path[i+3:], true
+}
+
+// plugin is an external program implementing the plugin protocol: a JSON
+// request is written to stdin, and a JSON response is read from stdout
+type plugin struct {
+	name    string
+	command []string
+}
+
+func (p *plugin) call(request *pluginRequest) (*pluginResponse, error) {
+	if len(p.command) == 0 {
+		return nil, fmt.Errorf("plugin %s: no command", p.name)
+	}
+	in, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		stdout, stderr bytes.Buffer
+		c              = exec.Command(p.command[0], p.command[1:]...)
+	)
+	c.Stdin = bytes.NewReader(in)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	c.Env = append(os.Environ(), "VC_PLUGIN_PROTOCOL="+PluginProtocol, "VC_PLUGIN_NAME="+p.name)
+	Debugf("plugin: %s %s", p.name, request.Type)
+	runErr := c.Run()
+
+	response := new(pluginResponse)
+	if err = json.Unmarshal(stdout.Bytes(), response); err != nil && runErr == nil {
+		return nil, fmt.Errorf("plugin %s: invalid response: %v", p.name, err)
+	}
+	switch {
+	case response.Error != "":
+		return nil, fmt.Errorf("plugin %s: %s", p.name, response.Error)
+	case runErr != nil:
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("plugin %s: %s", p.name, msg)
+		}
+		return nil, fmt.Errorf("plugin %s: %v", p.name, runErr)
+	}
+	return response, nil
+}
+
+// Read implements source
+func (p *plugin) Read(path string) (*api.Secret, error) {
+	response, err := p.call(&pluginRequest{Type: pluginRead, Path: path})
+	if err != nil || response.Data == nil {
+		return nil, err
+	}
+	return &api.Secret{Data: response.Data}, nil
+}
+
+// process post-processes the output, it returns nil if nothing should be
+// written
+func (p *plugin) process(output string, content []byte) ([]byte, error) {
+	if stdoutName[output] {
+		output = ""
+	}
+	response, err := p.call(&pluginRequest{Type: pluginProcess, Output: output, Content: content})
+	if err != nil {
+		return nil, err
+	}
+	return response.Content, nil
+}
+
+// plugin returns the configured plugin
+func (cmd *baseCommand) plugin(name string) (*plugin, error) {
+	config, err := cmd.Config()
+	if err != nil {
+		return nil, err
+	}
+	command, ok := config.Plugins[name]
+	if !ok {
+		return nil, fmt.Errorf("plugin %s is not configured", name)
+	}
+	return &plugin{name: name, command: command}, nil
+}
+
+// builtinSources are the sources that don't need a plugin
+var builtinSources = map[string]func() source{
+	"consul": func() source { return newConsulSource() },
+}
+
+// source returns the source for scheme; configured plugins take precedence
+// over the builtin sources
+func (cmd *baseCommand) source(scheme string) (source, error) {
+	if config, err := cmd.Config(); err == nil && config.Plugins[scheme] == nil {
+		if builtin, ok := builtinSources[scheme]; ok {
+			return builtin(), nil
+		}
+	}
+	return cmd.plugin(scheme)
+}
+
+// readSource reads the secret at path with vault, or from the source for its
+// scheme (see splitScheme)
+func (cmd *baseCommand) readSource(path string, vault func(string) (*api.Secret, error)) (*api.Secret, error) {
+	scheme, rest, ok := splitScheme(path)
+	if !ok {
+		return vault(path)
+	}
+	s, err := cmd.source(scheme)
+	if err != nil {
+		return nil, err
+	}
+	return s.Read(rest)
+}
+
+// postProcess runs the output through the post-processors, in order; nil is
+// returned if a post-processor handled the output itself
+func (cmd *baseCommand) postProcess(names []string, content []byte) ([]byte, error) {
+	for _, name := range names {
+		p, err := cmd.plugin(name)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = p.process(cmd.out, content); err != nil {
+			return nil, err
+		} else if content == nil {
+			Debugf("plugin: %s handled the output", name)
+			return nil, nil
+		}
+	}
+	return content, nil
+}
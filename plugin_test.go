@@ -0,0 +1,92 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitScheme(t *testing.T) {
+	tests := []struct {
+		Path, Scheme, Rest string
+		OK                 bool
+	}{
+		{"consul://config/app", "consul", "config/app", true},
+		{"secret/app", "", "secret/app", false},
+		{"/secret/a://b", "", "/secret/a://b", false},
+		{"://x", "", "://x", false},
+	}
+	for _, test := range tests {
+		scheme, rest, ok := splitScheme(test.Path)
+		if scheme != test.Scheme || rest != test.Rest || ok != test.OK {
+			t.Fatalf("splitScheme(%q): expected %q %q %t, got %q %q %t", test.Path, test.Scheme, test.Rest, test.OK, scheme, rest, ok)
+		}
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "plugin")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake plugin that saves the request, and responds with $1
+	name := filepath.Join(dir, "plugin")
+	if err = ioutil.WriteFile(name, []byte("#!/bin/sh\ncat > \"$0.request\"\necho \"$1\"\n[ -z \"$2\" ] || exit $2\n"), 0755); err != nil {
+		t.Skip(err)
+	}
+	request := func() (r pluginRequest) {
+		b, err := ioutil.ReadFile(name + ".request")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal(b, &r); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	cmd := &baseCommand{config: &Config{Plugins: map[string][]string{
+		"src":     {name, `{"data":{"key":"value"}}`},
+		"missing": {name, `{"data":null}`},
+		"fail":    {name, `{"error":"no such item"}`, "1"},
+		"upper":   {name, `{"content":"SEVMTE8="}`},
+		"push":    {name, `{}`},
+	}}}
+
+	secret, err := cmd.readSource("src://app/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if secret.Data["key"] != "value" {
+		t.Fatalf("unexpected data %v", secret.Data)
+	}
+	if r := request(); r.Type != pluginRead || r.Path != "app/config" {
+		t.Fatalf("unexpected request %+v", r)
+	}
+	if secret, err = cmd.readSource("missing://app", nil); err != nil || secret != nil {
+		t.Fatalf("expected no secret, got %v, %v", secret, err)
+	}
+	if _, err = cmd.readSource("fail://app", nil); err == nil || err.Error() != "plugin fail: no such item" {
+		t.Fatalf("expected plugin error, got %v", err)
+	}
+	if _, err = cmd.readSource("other://app", nil); err == nil {
+		t.Fatal("expected error for unconfigured plugin")
+	}
+
+	cmd.out = "/etc/app.conf"
+	content, err := cmd.postProcess([]string{"upper"}, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(content) != "HELLO" {
+		t.Fatalf("expected HELLO, got %q", content)
+	}
+	if r := request(); r.Type != pluginProcess || r.Output != "/etc/app.conf" || string(r.Content) != "hello" {
+		t.Fatalf("unexpected request %+v", r)
+	}
+	if content, err = cmd.postProcess([]string{"push", "upper"}, []byte("hello")); err != nil || content != nil {
+		t.Fatalf("expected the output to be handled, got %q, %v", content, err)
+	}
+}
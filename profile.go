@@ -0,0 +1,93 @@
+package vc
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// ProfileEnv is the environment variable with the profile to use, like the
+// --profile flag
+const ProfileEnv = "VC_PROFILE"
+
+// ProfileName is the profile to use, see Profile
+var ProfileName string
+
+// Profile is a Vault cluster in the configuration file, selected with
+// --profile; tokens are stored per cluster, see profileTokenStore
+type Profile struct {
+	// Address of the Vault server, like VAULT_ADDR
+	Address string `yaml:"address"`
+
+	// Namespace is the Vault Enterprise namespace, like VAULT_NAMESPACE
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// CACert is the CA certificate to verify the Vault server, like
+	// VAULT_CACERT
+	CACert string `yaml:"ca_cert,omitempty"`
+
+	// IdleTimeout overrides the idle timeout of the configuration file
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+
+	// Headers are extra HTTP headers sent to the Vault server, by name; see
+	// Headers
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// profileName returns the name of the selected profile, or an empty string
+func profileName() string {
+	if ProfileName != "" {
+		return ProfileName
+	}
+	return os.Getenv(ProfileEnv)
+}
+
+// profileName returns the name of the profile of the command, see useProfile
+func (cmd *baseCommand) profileName() string {
+	if cmd.useProfile != "" {
+		return cmd.useProfile
+	}
+	return profileName()
+}
+
+// profile returns the selected profile, or nil if no profile is selected
+func (cmd *baseCommand) profile() (*Profile, error) {
+	name := cmd.profileName()
+	if name == "" {
+		return nil, nil
+	}
+	config, err := cmd.Config()
+	if err != nil {
+		return nil, err
+	}
+	p, ok := config.Profiles[name]
+	if !ok || p == nil {
+		return nil, fmt.Errorf("unknown profile %q, see profiles in %s", name, config.name)
+	}
+	if p.Address == "" {
+		return nil, fmt.Errorf("profile %s: no address", name)
+	}
+	return p, nil
+}
+
+// apply configures the client for the profile
+func (p *Profile) apply(config *api.Config) error {
+	config.Address = p.Address
+	if p.CACert != "" {
+		if err := config.ConfigureTLS(&api.TLSConfig{CACert: os.ExpandEnv(p.CACert)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tokenKey is the key of the token of a Vault cluster, by its address and
+// namespace
+func tokenKey(address, namespace string) string {
+	if namespace == "" {
+		return address
+	}
+	return address + "#" + namespace
+}
@@ -0,0 +1,117 @@
+package vc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Update intervals for progress reporting
+const (
+	progressTerminalInterval = 100 * time.Millisecond
+	progressLineInterval     = 10 * time.Second
+)
+
+// progress reports the count, rate and estimated time remaining of a bulk
+// operation. On a terminal the status line is updated in place, otherwise a
+// status line is written periodically.
+type progress struct {
+	mu       sync.Mutex
+	w        io.Writer
+	tty      bool
+	label    string
+	total    int
+	done     int
+	start    time.Time
+	last     time.Time
+	interval time.Duration
+	shown    bool
+}
+
+// newProgress starts reporting progress for total items to w; progress for
+// single items is not reported
+func newProgress(w io.Writer, tty bool, label string, total int) *progress {
+	p := &progress{
+		w:        w,
+		tty:      tty,
+		label:    label,
+		total:    total,
+		start:    time.Now(),
+		interval: progressLineInterval,
+	}
+	if tty {
+		p.interval = progressTerminalInterval
+	}
+	p.last = p.start
+	return p
+}
+
+// progress starts reporting progress on stderr; there is no progress
+// reporting in dry run mode
+func (cmd *baseCommand) progress(label string, total int) *progress {
+	if DryRun {
+		return newProgress(nil, false, label, 0)
+	}
+	return newProgress(os.Stderr, IsTerminal(os.Stderr.Fd()), label, total)
+}
+
+// Add marks n items as done
+func (p *progress) Add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done += n
+	if now := time.Now(); now.Sub(p.last) >= p.interval {
+		p.last = now
+		p.show(now)
+	}
+}
+
+// Done ends progress reporting, the final status is written if any progress
+// was shown
+func (p *progress) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.shown {
+		p.show(time.Now())
+		if p.tty {
+			fmt.Fprintln(p.w)
+		}
+	}
+}
+
+func (p *progress) show(now time.Time) {
+	if p.w == nil || p.total < 2 {
+		return
+	}
+	p.shown = true
+	if p.tty {
+		fmt.Fprintf(p.w, "\r\x1b[K%s", p.status(now))
+	} else {
+		fmt.Fprintln(p.w, p.status(now))
+	}
+}
+
+// status formats the progress, such as "removing 12/100 (12%), 4.0/s, ETA 22s"
+func (p *progress) status(now time.Time) string {
+	var (
+		elapsed = now.Sub(p.start)
+		percent = p.done * 100 / p.total
+		rate    float64
+	)
+	if elapsed > 0 {
+		rate = float64(p.done) / elapsed.Seconds()
+	}
+	status := fmt.Sprintf("%s %d/%d (%d%%), %.1f/s", p.label, p.done, p.total, percent, rate)
+	if p.done >= p.total {
+		return status + fmt.Sprintf(", done in %s", elapsed.Round(time.Second))
+	}
+	if rate > 0 {
+		eta := time.Duration(float64(p.total-p.done) / rate * float64(time.Second))
+		status += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+	return status
+}
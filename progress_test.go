@@ -0,0 +1,44 @@
+package vc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		p   = newProgress(&buf, false, "testing", 4)
+	)
+	p.interval = 0
+	p.start = p.start.Add(-2 * time.Second)
+
+	p.Add(1)
+	if line := buf.String(); !strings.HasPrefix(line, "testing 1/4 (25%), 0.5/s, ETA ") {
+		t.Fatalf("unexpected progress %q", line)
+	}
+	buf.Reset()
+
+	p.Add(3)
+	p.Done()
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 {
+		t.Fatalf("expected 2 lines of progress, got %q", lines)
+	} else if !strings.Contains(lines[1], "4/4 (100%)") || !strings.Contains(lines[1], "done in 2s") {
+		t.Fatalf("unexpected final progress %q", lines[1])
+	}
+}
+
+func TestProgressSingle(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		p   = newProgress(&buf, true, "testing", 1)
+	)
+	p.interval = 0
+	p.Add(1)
+	p.Done()
+	if buf.Len() != 0 {
+		t.Fatalf("expected no progress for a single item, got %q", buf.String())
+	}
+}
@@ -0,0 +1,55 @@
+package vc
+
+import (
+	"bufio"
+	"io"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// qrQuietZone is the number of light modules surrounding the QR code
+const qrQuietZone = 2
+
+// renderQR renders text as a QR code that can be scanned from a terminal. Two
+// rows of modules are packed in a single line of text using half blocks, the
+// (light) background is drawn with blocks, so the code also works in terminals
+// with a dark background.
+func renderQR(w io.Writer, text string) error {
+	code, err := qrcode.New(text, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	light := func(x, y int) bool {
+		x -= qrQuietZone
+		y -= qrQuietZone
+		if x < 0 || y < 0 || y >= len(bitmap) || x >= len(bitmap[y]) {
+			return true
+		}
+		return !bitmap[y][x]
+	}
+
+	var (
+		out  = bufio.NewWriter(w)
+		size = len(bitmap) + qrQuietZone*2
+	)
+	for y := 0; y < size; y += 2 {
+		for x := 0; x < size; x++ {
+			top, bottom := light(x, y), y+1 >= size || light(x, y+1)
+			switch {
+			case top && bottom:
+				out.WriteString("█")
+			case top:
+				out.WriteString("▀")
+			case bottom:
+				out.WriteString("▄")
+			default:
+				out.WriteByte(' ')
+			}
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
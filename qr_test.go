@@ -0,0 +1,29 @@
+package vc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRenderQR(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := renderQR(buf, "otpauth://totp/vc:test?secret=JBSWY3DPEHPK3PXP&issuer=vc"); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	width := utf8.RuneCountInString(lines[0])
+	if want := (width + 1) / 2; len(lines) != want {
+		t.Fatalf("expected %d lines for a code of width %d, got %d", want, width, len(lines))
+	}
+	for i, line := range lines {
+		if n := utf8.RuneCountInString(line); n != width {
+			t.Fatalf("line %d: expected width %d, got %d", i, width, n)
+		}
+	}
+	if lines[0] != strings.Repeat("█", width) {
+		t.Fatalf("expected quiet zone on the first line, got %q", lines[0])
+	}
+}
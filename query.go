@@ -0,0 +1,174 @@
+package vc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// queryStep is a single step in a query expression
+type queryStep struct {
+	key     string
+	index   int
+	isIndex bool
+	iterate bool
+}
+
+func (step queryStep) String() string {
+	switch {
+	case step.iterate:
+		return "[]"
+	case step.isIndex:
+		return fmt.Sprintf("[%d]", step.index)
+	default:
+		return "." + step.key
+	}
+}
+
+// parseQuery parses a jq-like path expression, such as:
+//
+//	.password
+//	.database.hosts[0]
+//	.["key with spaces"]
+//	.users[].name
+func parseQuery(expr string) ([]queryStep, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, ".") {
+		return nil, fmt.Errorf("query %q: must start with a dot", expr)
+	}
+
+	var (
+		steps []queryStep
+		rest  = expr
+	)
+	if rest == "." {
+		return nil, nil
+	}
+	for len(rest) > 0 {
+		switch {
+		case strings.HasPrefix(rest, ".["):
+			rest = rest[1:]
+		case rest[0] == '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("query %q: empty key", expr)
+			}
+			steps = append(steps, queryStep{key: rest[:end]})
+			rest = rest[end:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if strings.HasPrefix(rest, `["`) {
+				end = strings.Index(rest, `"]`)
+				if end != -1 {
+					end++
+				}
+			}
+			if end == -1 {
+				return nil, fmt.Errorf("query %q: missing ]", expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case inner == "":
+				steps = append(steps, queryStep{iterate: true})
+			case strings.HasPrefix(inner, `"`):
+				key, err := strconv.Unquote(inner)
+				if err != nil {
+					return nil, fmt.Errorf("query %q: invalid key %s", expr, inner)
+				}
+				steps = append(steps, queryStep{key: key})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("query %q: invalid index %s", expr, inner)
+				}
+				steps = append(steps, queryStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("query %q: unexpected %q", expr, rest)
+		}
+	}
+	return steps, nil
+}
+
+// evalQuery evaluates the query steps against value. String values holding
+// JSON objects or arrays are decoded when traversed into.
+func evalQuery(steps []queryStep, value interface{}) ([]interface{}, error) {
+	if len(steps) == 0 {
+		return []interface{}{value}, nil
+	}
+
+	step := steps[0]
+	if s, ok := value.(string); ok && (strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[")) {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(s), &decoded); err == nil {
+			value = decoded
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if step.iterate {
+			var results []interface{}
+			for _, key := range sortedKeys(value) {
+				result, err := evalQuery(steps[1:], value[key])
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, result...)
+			}
+			return results, nil
+		}
+		if step.isIndex {
+			return nil, fmt.Errorf("%s: can't index an object", step)
+		}
+		item, ok := value[step.key]
+		if !ok {
+			return nil, fmt.Errorf("%s: key not found", step)
+		}
+		return evalQuery(steps[1:], item)
+
+	case []interface{}:
+		if step.iterate {
+			var results []interface{}
+			for _, item := range value {
+				result, err := evalQuery(steps[1:], item)
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, result...)
+			}
+			return results, nil
+		}
+		if !step.isIndex {
+			return nil, fmt.Errorf("%s: can't lookup a key in an array", step)
+		}
+		index := step.index
+		if index < 0 {
+			index += len(value)
+		}
+		if index < 0 || index >= len(value) {
+			return nil, fmt.Errorf("%s: index out of range", step)
+		}
+		return evalQuery(steps[1:], value[index])
+
+	default:
+		return nil, fmt.Errorf("%s: can't traverse into %T", step, value)
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,63 @@
+package vc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	data := map[string]interface{}{
+		"password": "secret",
+		"database": map[string]interface{}{
+			"hosts": []interface{}{"db1", "db2"},
+		},
+		"key with spaces": "value",
+		"nested":          `{"user": {"name": "root"}}`,
+		"users": []interface{}{
+			map[string]interface{}{"name": "alice"},
+			map[string]interface{}{"name": "bob"},
+		},
+	}
+
+	tests := []struct {
+		Query string
+		Want  []interface{}
+	}{
+		{".password", []interface{}{"secret"}},
+		{".database.hosts[0]", []interface{}{"db1"}},
+		{".database.hosts[-1]", []interface{}{"db2"}},
+		{".database.hosts[]", []interface{}{"db1", "db2"}},
+		{`.["key with spaces"]`, []interface{}{"value"}},
+		{".nested.user.name", []interface{}{"root"}},
+		{".users[].name", []interface{}{"alice", "bob"}},
+		{".", []interface{}{data}},
+	}
+	for _, test := range tests {
+		steps, err := parseQuery(test.Query)
+		if err != nil {
+			t.Fatalf("%s: %v", test.Query, err)
+		}
+		got, err := evalQuery(steps, data)
+		if err != nil {
+			t.Fatalf("%s: %v", test.Query, err)
+		}
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Fatalf("%s: expected %v, got %v", test.Query, test.Want, got)
+		}
+	}
+
+	for _, query := range []string{"password", ".foo[", ".foo[x]", "..foo"} {
+		if _, err := parseQuery(query); err == nil {
+			t.Fatalf("expected parsing %q to fail", query)
+		}
+	}
+	for _, query := range []string{".missing", ".password.foo", ".database.hosts[5]", ".database[0]"} {
+		steps, err := parseQuery(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if _, err = evalQuery(steps, data); err == nil {
+			t.Fatalf("expected evaluating %q to fail", query)
+		}
+	}
+}
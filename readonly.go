@@ -0,0 +1,90 @@
+package vc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ReadOnly refuses operations that change Vault, and writes of files other
+// than the writable_files of the configuration file, from --read-only; the
+// configuration file can set read_only too, see readOnly
+var ReadOnly bool
+
+// readOnly checks if the command runs in read-only mode, from --read-only or
+// read_only in the configuration file
+func (cmd *baseCommand) readOnly() (bool, error) {
+	if ReadOnly {
+		return true, nil
+	}
+	config, err := cmd.Config()
+	if err != nil {
+		return false, err
+	}
+	return config.ReadOnly, nil
+}
+
+// checkWritable refuses writes of the named output file in read-only mode,
+// unless it (or a directory it is in) matches one of writable_files in the
+// configuration file; stdout and stderr are always writable. The files vc
+// keeps itself, such as the token store and the cache, are not checked.
+func (cmd *baseCommand) checkWritable(name string) error {
+	if stdoutName[name] || stderrName[name] {
+		return nil
+	}
+	if readOnly, err := cmd.readOnly(); err != nil || !readOnly {
+		return err
+	}
+	config, err := cmd.Config()
+	if err != nil {
+		return err
+	}
+	full, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range config.WritableFiles {
+		if pattern, err = filepath.Abs(os.ExpandEnv(pattern)); err != nil {
+			return err
+		}
+		for p := full; ; p = filepath.Dir(p) {
+			if ok, _ := filepath.Match(pattern, p); ok {
+				return nil
+			}
+			if p == filepath.Dir(p) {
+				break
+			}
+		}
+	}
+	return &Error{Kind: ErrReadOnly, Err: fmt.Errorf("%s: not writable in read-only mode, see writable_files", name)}
+}
+
+// checkWritableDir checks the files with names in dir with checkWritable, and
+// dir itself if it is to be created
+func (cmd *baseCommand) checkWritableDir(dir string, names []string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err = cmd.checkWritable(dir); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if err := cmd.checkWritable(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refusedWriter is the output writer of files that are not writable, see
+// checkWritable
+type refusedWriter struct {
+	err error
+}
+
+func (w refusedWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func (w refusedWriter) Close() error {
+	return w.err
+}
@@ -0,0 +1,93 @@
+package vc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "readonly")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(filepath.Join(dir, "audit"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newReplicateServer("s.test", map[string]string{"app/db": `{"password": "pw"}`}, nil)
+	defer server.Close()
+	for key, value := range map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "s.test"} {
+		saved, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+		if ok {
+			defer os.Setenv(key, saved)
+		} else {
+			defer os.Unsetenv(key)
+		}
+	}
+	config := &Config{ReadOnly: true, WritableFiles: []string{filepath.Join(dir, "audit")}}
+
+	write := func(args ...string) (*cli.MockUi, int) {
+		ui := cli.NewMockUi()
+		command, _ := WriteCommandFactory(ui)()
+		cmd := command.(*WriteCommand)
+		cmd.config = config
+		return ui, cmd.Run(args)
+	}
+	cat := func(args ...string) (*cli.MockUi, int) {
+		ui := cli.NewMockUi()
+		command, _ := CatCommandFactory(ui)()
+		cmd := command.(*CatCommand)
+		cmd.config = config
+		return ui, cmd.Run(args)
+	}
+
+	// Writes are refused before they reach Vault
+	ui, code := write("kv/app/new", "user=app")
+	if code != PermissionError {
+		t.Fatalf("expected permission error, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if got := ui.ErrorWriter.String(); !strings.Contains(got, "refused in read-only mode") {
+		t.Fatalf("expected the write to be refused, got %q", got)
+	}
+	if len(server.writes) != 0 {
+		t.Fatalf("expected no writes, got %q", server.writes)
+	}
+
+	// Output files are written only if writable
+	name := filepath.Join(dir, "db.env")
+	if ui, code = cat("-o", name, "kv/data/app/db"); code != PermissionError {
+		t.Fatalf("expected permission error, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("expected %s not to be written, got %v", name, err)
+	}
+	name = filepath.Join(dir, "audit", "db.env")
+	if ui, code = cat("-o", name, "kv/data/app/db"); code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if _, err = os.Stat(name); err != nil {
+		t.Fatal(err)
+	}
+
+	// Directories of key files, as of cat -dir
+	cmd := &baseCommand{config: config}
+	if err = cmd.checkWritableDir(filepath.Join(dir, "keys"), []string{"tls.key"}); ErrorKind(err) != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err = cmd.checkWritableDir(filepath.Join(dir, "audit", "keys"), []string{"tls.key"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The configuration file can't be changed
+	config.name = filepath.Join(dir, "vc.yaml")
+	if err = config.Save(); ErrorKind(err) != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+}
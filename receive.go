@@ -0,0 +1,153 @@
+package vc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/tehmaze/vc/client"
+)
+
+// ReceiveCommand unwraps a secret handed off with HandoffCommand
+type ReceiveCommand struct {
+	baseCommand
+	fs  *flag.FlagSet
+	key string
+}
+
+func (cmd *ReceiveCommand) Help() string {
+	return `Usage: vc receive [<options>] [<wrapping token>]
+
+Unwrap the data handed off with vc handoff, and write it to the output as JSON,
+or only the value of key with -k. Without a wrapping token, it is prompted for
+(or read from stdin). The wrapping token is the only credential needed, and it
+can be unwrapped once: if it is no longer valid, someone else may have
+unwrapped it first.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *ReceiveCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	args = cmd.fs.Args()
+	if len(args) > 1 {
+		return Help
+	}
+
+	var (
+		token string
+		err   error
+	)
+	if len(args) == 1 && args[0] != "-" {
+		token = args[0]
+	} else if token, err = readWrappingToken(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+
+	c, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	// Unwrap with the wrapping token itself, so no Vault token is needed
+	unwrap, err := c.Clone()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	unwrap.SetToken(token)
+	s, err := unwrap.Logical().Unwrap("")
+	if err != nil {
+		err = client.Classify(err)
+		cmd.ui.Error(fmt.Sprintf("error: unwrap: %v (the token may have expired, or was already unwrapped)", err))
+		return exitCode(err, ServerError)
+	} else if s == nil || s.Data == nil {
+		cmd.ui.Error("error: unwrap: no data in the wrapping token")
+		return NotFoundError
+	}
+
+	b := new(secureBuffer)
+	defer b.Wipe()
+	if cmd.key != "" {
+		value, ok := s.Data[cmd.key]
+		if !ok {
+			cmd.ui.Error(fmt.Sprintf("error: key %q not found", cmd.key))
+			return NotFoundError
+		}
+		if v, ok := value.(string); ok {
+			io.WriteString(b, v)
+		} else if err = json.NewEncoder(b).Encode(value); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: key %q: %v", cmd.key, err))
+			return CodecError
+		}
+	} else {
+		enc := json.NewEncoder(b)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(s.Data); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return CodecError
+		}
+	}
+	if _, err = cmd.Write(b.Bytes()); err != nil {
+		cmd.abort()
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if err = cmd.Close(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	return Success
+}
+
+// readWrappingToken prompts for the wrapping token, or reads it from stdin if
+// stdin is not a terminal
+func readWrappingToken() (string, error) {
+	if IsTerminal(os.Stdin.Fd()) {
+		return promptSecret("Wrapping token", false)
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return "", errors.New("no wrapping token on stdin")
+	}
+	return line, nil
+}
+
+func (cmd *ReceiveCommand) Synopsis() string {
+	return "unwrap a secret handed off with vc handoff"
+}
+
+func ReceiveCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &ReceiveCommand{
+			baseCommand: baseCommand{
+				ui:   ui,
+				mode: 0600,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("receive", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.key, "k", "", "only write the value of key")
+		cmd.fs.StringVar(&cmd.out, "o", "", "output (default: stdout)")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
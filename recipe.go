@@ -0,0 +1,216 @@
+package vc
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// recipe generates a complete configuration file from the data of a secret,
+// for sync manifest entries with a recipe instead of a template
+type recipe func(data map[string]interface{}) ([]byte, error)
+
+// recipes are the built-in recipes, by name
+var recipes = map[string]recipe{
+	"openvpn":   recipeOpenVPN,
+	"wireguard": recipeWireGuard,
+}
+
+// recipeNames returns the names of the recipes, sorted
+func recipeNames() []string {
+	names := make([]string, 0, len(recipes))
+	for name := range recipes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// recipeData returns the data of a secret, unwrapping KV v2 responses
+func recipeData(data map[string]interface{}) map[string]interface{} {
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok = data["metadata"]; ok {
+			return inner
+		}
+	}
+	return data
+}
+
+// recipeString returns the value of key as a string; lists are joined with
+// ", ", numbers are formatted as they were in JSON
+func recipeString(data map[string]interface{}, key string) string {
+	switch v := data[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, strings.TrimSpace(fmt.Sprint(item)))
+		}
+		return strings.Join(values, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// recipeWireGuardKey checks that the value of key is a WireGuard key: 32
+// bytes, base64 encoded
+func recipeWireGuardKey(data map[string]interface{}, key string, required bool) (string, error) {
+	value := recipeString(data, key)
+	if value == "" {
+		if required {
+			return "", fmt.Errorf("key %q is required", key)
+		}
+		return "", nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(value); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("key %q is not a WireGuard key", key)
+	}
+	return value, nil
+}
+
+// recipeWireGuard generates a wg-quick configuration: the interface from
+// private_key, address, dns, listen_port and mtu, and a peer from public_key,
+// preshared_key, endpoint, allowed_ips (default: all traffic) and
+// persistent_keepalive, or a peer for each item in peers
+func recipeWireGuard(data map[string]interface{}) ([]byte, error) {
+	data = recipeData(data)
+	privateKey, err := recipeWireGuardKey(data, "private_key", true)
+	if err != nil {
+		return nil, err
+	}
+	address := recipeString(data, "address")
+	if address == "" {
+		return nil, errors.New(`key "address" is required`)
+	}
+
+	b := new(secureBuffer)
+	defer b.Wipe()
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(b, "PrivateKey = %s\n", privateKey)
+	fmt.Fprintf(b, "Address = %s\n", address)
+	for _, option := range [][2]string{{"dns", "DNS"}, {"listen_port", "ListenPort"}, {"mtu", "MTU"}} {
+		if value := recipeString(data, option[0]); value != "" {
+			fmt.Fprintf(b, "%s = %s\n", option[1], value)
+		}
+	}
+
+	var peers []map[string]interface{}
+	if list, ok := data["peers"].([]interface{}); ok {
+		for i, item := range list {
+			peer, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("peer %d is not an object", i+1)
+			}
+			peers = append(peers, peer)
+		}
+	} else {
+		peers = append(peers, data)
+	}
+	for i, peer := range peers {
+		publicKey, err := recipeWireGuardKey(peer, "public_key", true)
+		if err != nil {
+			return nil, recipePeerError(i, len(peers), err)
+		}
+		presharedKey, err := recipeWireGuardKey(peer, "preshared_key", false)
+		if err != nil {
+			return nil, recipePeerError(i, len(peers), err)
+		}
+		allowedIPs := recipeString(peer, "allowed_ips")
+		if allowedIPs == "" {
+			allowedIPs = "0.0.0.0/0, ::/0"
+		}
+
+		b.WriteString("\n[Peer]\n")
+		fmt.Fprintf(b, "PublicKey = %s\n", publicKey)
+		if presharedKey != "" {
+			fmt.Fprintf(b, "PresharedKey = %s\n", presharedKey)
+		}
+		if endpoint := recipeString(peer, "endpoint"); endpoint != "" {
+			fmt.Fprintf(b, "Endpoint = %s\n", endpoint)
+		}
+		fmt.Fprintf(b, "AllowedIPs = %s\n", allowedIPs)
+		if keepalive := recipeString(peer, "persistent_keepalive"); keepalive != "" {
+			fmt.Fprintf(b, "PersistentKeepalive = %s\n", keepalive)
+		}
+	}
+	return append([]byte(nil), b.Bytes()...), nil
+}
+
+// recipePeerError adds the number of the peer to err, if there are peers
+func recipePeerError(i, peers int, err error) error {
+	if peers > 1 {
+		return fmt.Errorf("peer %d: %v", i+1, err)
+	}
+	return err
+}
+
+// recipeOpenVPN generates an OpenVPN client configuration, with the
+// certificates and keys inline: remote (with port and proto), dev, ca, cert,
+// key, tls_crypt or tls_auth, and extra options
+func recipeOpenVPN(data map[string]interface{}) ([]byte, error) {
+	data = recipeData(data)
+	for _, key := range []string{"remote", "ca", "cert", "key"} {
+		if recipeString(data, key) == "" {
+			return nil, fmt.Errorf("key %q is required", key)
+		}
+	}
+	if recipeString(data, "tls_crypt") != "" && recipeString(data, "tls_auth") != "" {
+		return nil, errors.New(`keys "tls_crypt" and "tls_auth" can't both be used`)
+	}
+	option := func(key, fallback string) string {
+		if value := recipeString(data, key); value != "" {
+			return value
+		}
+		return fallback
+	}
+
+	b := new(secureBuffer)
+	defer b.Wipe()
+	b.WriteString("client\n")
+	fmt.Fprintf(b, "dev %s\n", option("dev", "tun"))
+	fmt.Fprintf(b, "proto %s\n", option("proto", "udp"))
+	port := option("port", "1194")
+	remotes, ok := data["remote"].([]interface{})
+	if !ok {
+		remotes = []interface{}{data["remote"]}
+	}
+	for _, remote := range remotes {
+		remote := strings.TrimSpace(fmt.Sprint(remote))
+		if !strings.Contains(remote, " ") {
+			remote += " " + port
+		}
+		fmt.Fprintf(b, "remote %s\n", remote)
+	}
+	b.WriteString("resolv-retry infinite\nnobind\npersist-key\npersist-tun\nremote-cert-tls server\n")
+	if cipher := recipeString(data, "cipher"); cipher != "" {
+		fmt.Fprintf(b, "data-ciphers %s\n", cipher)
+	}
+	if recipeString(data, "tls_auth") != "" {
+		b.WriteString("key-direction 1\n")
+	}
+	if options, ok := data["options"].(string); ok && strings.TrimSpace(options) != "" {
+		b.WriteString(strings.TrimSpace(options) + "\n")
+	}
+
+	for _, inline := range [][2]string{{"ca", "ca"}, {"cert", "cert"}, {"key", "key"}, {"tls_crypt", "tls-crypt"}, {"tls_auth", "tls-auth"}} {
+		var blocks []string
+		switch v := data[inline[0]].(type) {
+		case string:
+			blocks = append(blocks, strings.TrimSpace(v))
+		case []interface{}:
+			// Such as the ca_chain of the PKI secrets engine
+			for _, item := range v {
+				blocks = append(blocks, strings.TrimSpace(fmt.Sprint(item)))
+			}
+		}
+		if value := strings.TrimSpace(strings.Join(blocks, "\n")); value != "" {
+			fmt.Fprintf(b, "<%s>\n%s\n</%s>\n", inline[1], value, inline[1])
+		}
+	}
+	return append([]byte(nil), b.Bytes()...), nil
+}
@@ -0,0 +1,136 @@
+package vc
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	testWireGuardKey  = "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="
+	testWireGuardPeer = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="
+)
+
+func TestRecipeWireGuard(t *testing.T) {
+	b, err := recipeWireGuard(map[string]interface{}{
+		"private_key":          testWireGuardKey,
+		"address":              []interface{}{"10.0.0.2/32", "fd00::2/128"},
+		"dns":                  "10.0.0.1",
+		"public_key":           testWireGuardPeer,
+		"preshared_key":        testWireGuardKey,
+		"endpoint":             "vpn.example.com:51820",
+		"persistent_keepalive": 25.0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `[Interface]
+PrivateKey = ` + testWireGuardKey + `
+Address = 10.0.0.2/32, fd00::2/128
+DNS = 10.0.0.1
+
+[Peer]
+PublicKey = ` + testWireGuardPeer + `
+PresharedKey = ` + testWireGuardKey + `
+Endpoint = vpn.example.com:51820
+AllowedIPs = 0.0.0.0/0, ::/0
+PersistentKeepalive = 25
+`
+	if string(b) != expect {
+		t.Fatalf("expected\n%s\ngot\n%s", expect, b)
+	}
+
+	// KV v2 data, with a list of peers
+	b, err = recipeWireGuard(map[string]interface{}{
+		"data": map[string]interface{}{
+			"private_key": testWireGuardKey,
+			"address":     "10.0.0.2/32",
+			"peers": []interface{}{
+				map[string]interface{}{"public_key": testWireGuardPeer, "allowed_ips": "10.0.0.0/24"},
+				map[string]interface{}{"public_key": testWireGuardKey, "allowed_ips": "10.1.0.0/24"},
+			},
+		},
+		"metadata": map[string]interface{}{"version": 1.0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "[Peer]"); n != 2 {
+		t.Fatalf("expected 2 peers, got %d:\n%s", n, b)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"address": "10.0.0.2/32", "public_key": testWireGuardPeer},
+		{"private_key": "short", "address": "10.0.0.2/32", "public_key": testWireGuardPeer},
+		{"private_key": testWireGuardKey, "public_key": testWireGuardPeer},
+		{"private_key": testWireGuardKey, "address": "10.0.0.2/32"},
+	} {
+		if _, err = recipeWireGuard(data); err == nil {
+			t.Fatalf("%v: expected an error", data)
+		}
+	}
+}
+
+func TestRecipeOpenVPN(t *testing.T) {
+	b, err := recipeOpenVPN(map[string]interface{}{
+		"remote":    "vpn.example.com",
+		"ca":        []interface{}{"CA1\n", "CA2\n"},
+		"cert":      "CERT\n",
+		"key":       "KEY\n",
+		"tls_crypt": "TLS\n",
+		"options":   "verb 3\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `client
+dev tun
+proto udp
+remote vpn.example.com 1194
+resolv-retry infinite
+nobind
+persist-key
+persist-tun
+remote-cert-tls server
+verb 3
+<ca>
+CA1
+CA2
+</ca>
+<cert>
+CERT
+</cert>
+<key>
+KEY
+</key>
+<tls-crypt>
+TLS
+</tls-crypt>
+`
+	if string(b) != expect {
+		t.Fatalf("expected\n%s\ngot\n%s", expect, b)
+	}
+
+	if _, err = recipeOpenVPN(map[string]interface{}{"remote": "vpn.example.com", "ca": "CA", "cert": "CERT"}); err == nil {
+		t.Fatal("expected an error without a key")
+	}
+	if _, err = recipeOpenVPN(map[string]interface{}{"remote": "vpn", "ca": "CA", "cert": "CERT", "key": "KEY", "tls_auth": "A", "tls_crypt": "C"}); err == nil {
+		t.Fatal("expected an error with tls_auth and tls_crypt")
+	}
+}
+
+func TestCheckSyncRecipe(t *testing.T) {
+	f := syncFile{Recipe: "wireguard", Secret: "secret/vpn", Output: "wg0.conf"}
+	if err := checkSyncRecipe(f); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []syncFile{
+		{Recipe: "ipsec", Secret: "secret/vpn", Output: "wg0.conf"},
+		{Recipe: "wireguard", Output: "wg0.conf"},
+		{Recipe: "wireguard", Template: "wg0.tpl", Secret: "secret/vpn", Output: "wg0.conf"},
+		{Recipe: "wireguard", Secret: "secret/vpn", Output: "wg0.conf", Mode: "0640"},
+	} {
+		if err := checkSyncRecipe(f); err == nil {
+			t.Fatalf("%+v: expected an error", f)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package vc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+)
+
+// Redaction modes for secret values in diffs, errors and logs, from showing
+// the most of a value to the least, see Redaction
+const (
+	RedactNone    = "none"
+	RedactPartial = "partial"
+	RedactHash    = "hash"
+	RedactMask    = "mask"
+)
+
+// redactModes are the redaction modes, by strength
+var redactModes = map[string]int{RedactNone: 0, RedactPartial: 1, RedactHash: 2, RedactMask: 3}
+
+// Defaults for redaction
+const (
+	// DefaultRedactReveal is the number of characters shown at the start and
+	// the end of values in the partial mode
+	DefaultRedactReveal = 2
+
+	// redactMinLength is the minimum length of values that are redacted,
+	// shorter values (such as "true" or a port number) would redact most
+	// of the text
+	redactMinLength = 4
+
+	redactMasked = "********"
+)
+
+// Redact is the redaction mode from the --redact flag, it overrides the
+// configuration unless that is locked
+var Redact string
+
+// CheckRedactMode checks if mode is a redaction mode
+func CheckRedactMode(mode string) error {
+	if _, ok := redactModes[mode]; !ok {
+		return fmt.Errorf("unknown redaction mode %q (none, partial, hash or mask)", mode)
+	}
+	return nil
+}
+
+// Redaction configures how the values of the secrets vc read are redacted in
+// the diffs of dry runs, in errors and warnings, and in debug logs. Output
+// that is meant to have values, such as vc cat, isn't redacted.
+type Redaction struct {
+	// Mode is none (default), partial, hash or mask
+	Mode string `yaml:"mode,omitempty"`
+
+	// Reveal is the number of characters partial shows at the start and the
+	// end of values, see DefaultRedactReveal
+	Reveal int `yaml:"reveal,omitempty"`
+
+	// Commands override Mode for commands, by name
+	Commands map[string]string `yaml:"commands,omitempty"`
+
+	// Locked makes Mode the minimum, commands and --redact can only redact
+	// more
+	Locked bool `yaml:"locked,omitempty"`
+}
+
+// mode returns the redaction mode for command; unknown modes are masks
+func (r *Redaction) mode(command string) string {
+	mode := RedactNone
+	if r != nil && r.Mode != "" {
+		mode = r.Mode
+	}
+	override := func(m string) {
+		if r == nil || !r.Locked || redactStrength(m) >= redactStrength(mode) {
+			mode = m
+		} else {
+			Debugf("redact: mode %s is locked, not using %s", mode, m)
+		}
+	}
+	if m, ok := r.commandMode(command); ok {
+		override(m)
+	}
+	if Redact != "" {
+		override(Redact)
+	}
+	if _, ok := redactModes[mode]; !ok {
+		Debugf("redact: unknown mode %q, masking values", mode)
+		return RedactMask
+	}
+	return mode
+}
+
+func (r *Redaction) commandMode(command string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	mode, ok := r.Commands[command]
+	return mode, ok
+}
+
+// redactStrength returns the strength of mode, unknown modes are masks
+func redactStrength(mode string) int {
+	if strength, ok := redactModes[mode]; ok {
+		return strength
+	}
+	return redactModes[RedactMask]
+}
+
+// valueRedactor replaces the secret values it was given in text
+type valueRedactor struct {
+	mutex    sync.Mutex
+	mode     string
+	reveal   int
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+// redactor redacts the values of the secrets that were read, see redactUi
+var redactor = &valueRedactor{mode: RedactNone}
+
+// configure sets the mode, and the characters to reveal for partial
+func (r *valueRedactor) configure(mode string, reveal int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if reveal <= 0 {
+		reveal = DefaultRedactReveal
+	}
+	r.mode, r.reveal, r.replacer = mode, reveal, nil
+}
+
+// addSecret adds the values in secret, see eachSecretValue
+func (r *valueRedactor) addSecret(path string, secret *api.Secret) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.mode == RedactNone {
+		return
+	}
+	eachSecretValue(path, secret, r.add)
+}
+
+// add adds value, multi-line values line by line; the mutex must be held
+func (r *valueRedactor) add(value string) {
+	if r.values == nil {
+		r.values = make(map[string]bool)
+	}
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); len(line) >= redactMinLength && !r.values[line] {
+			r.values[line] = true
+			r.replacer = nil
+		}
+	}
+}
+
+// redact replaces the values in text
+func (r *valueRedactor) redact(text string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.mode == RedactNone || len(r.values) == 0 {
+		return text
+	}
+	if r.replacer == nil {
+		// Longer values first, so values that contain others are replaced
+		// as a whole
+		values := make([]string, 0, len(r.values))
+		for value := range r.values {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if len(values[i]) != len(values[j]) {
+				return len(values[i]) > len(values[j])
+			}
+			return values[i] < values[j]
+		})
+		pairs := make([]string, 0, 2*len(values))
+		for _, value := range values {
+			pairs = append(pairs, value, redactValue(r.mode, r.reveal, value))
+		}
+		r.replacer = strings.NewReplacer(pairs...)
+	}
+	return r.replacer.Replace(text)
+}
+
+// redactValue returns value redacted in mode
+func redactValue(mode string, reveal int, value string) string {
+	switch mode {
+	case RedactNone:
+		return value
+	case RedactHash:
+		hash := sha256.Sum256([]byte(value))
+		return "[sha256:" + hex.EncodeToString(hash[:4]) + "]"
+	case RedactPartial:
+		runes := []rune(value)
+		if len(runes) >= 2*reveal+redactMinLength {
+			return string(runes[:reveal]) + "****" + string(runes[len(runes)-reveal:])
+		}
+	}
+	return redactMasked
+}
+
+// redactText redacts the values of the secrets that were read in text
+func redactText(text string) string {
+	return redactor.redact(text)
+}
+
+// redactingUi redacts the values of the secrets that were read in errors and
+// warnings
+type redactingUi struct {
+	cli.Ui
+}
+
+// redactUi configures the redaction for the command in args, and returns ui
+// with redaction of errors and warnings
+func redactUi(ui cli.Ui, args []string) cli.Ui {
+	config, err := LoadConfig(configName())
+	if err != nil {
+		Debugf("config: %v", err)
+		config = new(Config)
+	}
+	var command string
+	if len(args) > 0 {
+		command = args[0]
+	}
+	mode := config.Redact.mode(command)
+	if mode != RedactNone {
+		Debugf("redact: %s values", mode)
+	}
+	var reveal int
+	if config.Redact != nil {
+		reveal = config.Redact.Reveal
+	}
+	redactor.configure(mode, reveal)
+	return &redactingUi{Ui: ui}
+}
+
+func (ui *redactingUi) Error(message string) {
+	ui.Ui.Error(redactText(message))
+}
+
+func (ui *redactingUi) Warn(message string) {
+	ui.Ui.Warn(redactText(message))
+}
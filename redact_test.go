@@ -0,0 +1,67 @@
+package vc
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestRedactionMode(t *testing.T) {
+	defer func() { Redact = "" }()
+
+	for _, test := range []struct {
+		redaction *Redaction
+		command   string
+		flag      string
+		want      string
+	}{
+		{nil, "cat", "", RedactNone},
+		{nil, "cat", RedactHash, RedactHash},
+		{&Redaction{Mode: RedactMask}, "cat", "", RedactMask},
+		{&Redaction{Mode: RedactMask, Commands: map[string]string{"sync": RedactPartial}}, "sync", "", RedactPartial},
+		{&Redaction{Mode: RedactMask, Commands: map[string]string{"sync": RedactPartial}}, "template", "", RedactMask},
+		{&Redaction{Mode: RedactHash}, "cat", RedactNone, RedactNone},
+		{&Redaction{Mode: RedactHash, Locked: true}, "cat", RedactNone, RedactHash},
+		{&Redaction{Mode: RedactHash, Locked: true}, "cat", RedactMask, RedactMask},
+		{&Redaction{Mode: RedactHash, Locked: true, Commands: map[string]string{"sync": RedactNone}}, "sync", "", RedactHash},
+		{&Redaction{Mode: "bogus"}, "cat", "", RedactMask},
+	} {
+		Redact = test.flag
+		if got := test.redaction.mode(test.command); got != test.want {
+			t.Errorf("%+v %s --redact=%s: expected %s, got %s", test.redaction, test.command, test.flag, test.want, got)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	secret := &api.Secret{Data: map[string]interface{}{
+		"data": map[string]interface{}{
+			"password": "hunter2hunter2",
+			"key":      "line one\nline two\n",
+			"port":     "22",
+		},
+		"metadata": map[string]interface{}{"version": 1},
+	}}
+	text := "password=hunter2hunter2 port=22 key=line one"
+
+	for mode, want := range map[string]string{
+		RedactNone:    text,
+		RedactMask:    "password=******** port=22 key=********",
+		RedactPartial: "password=hu****r2 port=22 key=li****ne",
+		RedactHash:    "password=[sha256:",
+	} {
+		r := new(valueRedactor)
+		r.configure(mode, 0)
+		r.addSecret("secret/data/app", secret)
+		got := r.redact(text)
+		if mode == RedactHash {
+			if got[:len(want)] != want || len(got) != len("password=[sha256:01234567] port=22 key=[sha256:01234567]") {
+				t.Errorf("%s: unexpected %q", mode, got)
+			}
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", mode, want, got)
+		}
+	}
+}
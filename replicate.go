@@ -0,0 +1,281 @@
+package vc
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// conflictNewer overwrites secrets that were updated before the source
+const conflictNewer = "newer"
+
+// replicateAction is a planned copy of a secret between clusters; skip is
+// the reason a conflict isn't copied
+type replicateAction struct {
+	source string
+	target string
+	data   map[string]interface{}
+	create bool
+	skip   string
+}
+
+// ReplicateCommand copies a tree of secrets from the Vault cluster of one
+// profile to the one of another
+type ReplicateCommand struct {
+	baseCommand
+	fs       *flag.FlagSet
+	from     string
+	to       string
+	target   string
+	conflict string
+	force    bool
+}
+
+func (cmd *ReplicateCommand) Help() string {
+	return `Usage: vc replicate [<options>] -from-profile <profile> -to-profile <profile> <path>
+
+Copy the secret at the path, or the secrets below it, from the Vault cluster of
+one profile (see profiles in the configuration file) to the one of another, at
+the same path or below the -to path. Each cluster uses the token stored for its
+profile, see vc --profile <profile> login; VAULT_TOKEN and the agent are not
+used.
+
+Secrets that exist with other values are conflicts, which are skipped
+(-conflict skip), overwritten (-conflict overwrite), or overwritten if the
+source secret was updated after the target secret (-conflict newer), by the
+update times of their KV v2 metadata; conflicts without update times are
+skipped. With --dry-run, the plan is reported without copying.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *ReplicateCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.fs.Args(); len(args) != 1 {
+		return Help
+	}
+	if cmd.from == "" || cmd.to == "" {
+		cmd.ui.Error("error: -from-profile and -to-profile are required")
+		return SyntaxError
+	}
+	switch cmd.conflict {
+	case conflictSkip, conflictOverwrite, conflictNewer:
+	default:
+		cmd.ui.Error(fmt.Sprintf("error: invalid conflict policy %q", cmd.conflict))
+		return SyntaxError
+	}
+
+	source, err := cmd.profileClient(cmd.from)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ClientError)
+	}
+	target, err := cmd.profileClient(cmd.to)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ClientError)
+	}
+	if source.Address() == target.Address() && source.Namespace() == target.Namespace() {
+		cmd.ui.Error(fmt.Sprintf("error: profiles %s and %s are the same Vault cluster", cmd.from, cmd.to))
+		return SyntaxError
+	}
+
+	actions, err := cmd.plan(source, target, args[0])
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+
+	var (
+		changes []string
+		copies  int
+	)
+	for _, action := range actions {
+		if action.skip != "" {
+			continue
+		}
+		copies++
+		if action.create {
+			changes = append(changes, "+ "+action.target)
+		} else {
+			changes = append(changes, "~ "+action.target)
+		}
+	}
+	if skipped := len(actions) - copies; skipped > 0 && !DryRun {
+		cmd.ui.Warn(fmt.Sprintf("skipping %d conflicts", skipped))
+	}
+	if DryRun {
+		for _, action := range actions {
+			if action.skip != "" {
+				cmd.ui.Output(fmt.Sprintf("dry run: skip %s (%s)", action.target, action.skip))
+			} else if action.create {
+				cmd.ui.Output(fmt.Sprintf("dry run: create %s in %s", action.target, cmd.to))
+			} else {
+				cmd.ui.Output(fmt.Sprintf("dry run: update %s in %s", action.target, cmd.to))
+			}
+		}
+		return Success
+	}
+	if copies == 0 {
+		cmd.ui.Info("nothing to copy")
+		return Success
+	}
+
+	ok, err := cmd.confirmChanges(cmd.force, changes, "copy %d secrets to %s?", copies, cmd.to)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return SystemError
+	} else if !ok {
+		return Success
+	}
+
+	progress := cmd.progress("copying", copies)
+	defer progress.Done()
+	for _, action := range actions {
+		if action.skip != "" {
+			continue
+		}
+		if err = target.WriteSecret(action.target, action.data); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", action.target, err))
+			return exitCode(err, ServerError)
+		}
+		progress.Add(1)
+	}
+	cmd.ui.Info(fmt.Sprintf("copied %d secrets to %s", copies, cmd.to))
+	return Success
+}
+
+// profileClient returns the client of the Vault cluster of the profile
+func (cmd *ReplicateCommand) profileClient(name string) (*Client, error) {
+	side := &baseCommand{ui: cmd.ui, config: cmd.config, useProfile: name}
+	client, err := side.Client()
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %v", name, err)
+	}
+	cmd.config = side.config
+	return client, nil
+}
+
+// plan returns the copies of the secrets below root, with the conflicts that
+// are skipped; secrets with the same values in both clusters are left out
+func (cmd *ReplicateCommand) plan(source, target *Client, root string) ([]replicateAction, error) {
+	paths, err := source.secretsBelow(root)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		prefix = strings.Trim(source.Abs(root), "/")
+		dest   = prefix
+	)
+	if cmd.target != "" {
+		dest = strings.Trim(target.Abs(cmd.target), "/")
+	}
+
+	var actions []replicateAction
+	for _, path := range paths {
+		path = strings.Trim(path, "/")
+		secret, err := source.ReadSecret(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", cmd.from, path, err)
+		} else if secret == nil {
+			continue
+		}
+
+		action := replicateAction{source: path, target: dest, data: secret.Data}
+		if rel := strings.TrimPrefix(path, prefix+"/"); rel != path {
+			action.target = dest + "/" + rel
+		}
+		existing, err := target.ReadSecret(action.target)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", cmd.to, action.target, err)
+		} else if existing == nil {
+			action.create = true
+		} else if bridgeEqual(existing.Data, secret.Data) {
+			Debugf("replicate: %s is up to date", action.target)
+			continue
+		} else if action.skip, err = cmd.resolveConflict(source, target, action); err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// resolveConflict returns why the conflicting action is skipped by the
+// conflict policy, or an empty string if the target is overwritten
+func (cmd *ReplicateCommand) resolveConflict(source, target *Client, action replicateAction) (string, error) {
+	switch cmd.conflict {
+	case conflictOverwrite:
+		return "", nil
+	case conflictSkip:
+		return "exists with other values", nil
+	}
+
+	sourceTime, err := replicateUpdated(source, action.source)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %v", cmd.from, action.source, err)
+	}
+	targetTime, err := replicateUpdated(target, action.target)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %v", cmd.to, action.target, err)
+	}
+	if sourceTime == nil || targetTime == nil {
+		return "no update time to compare", nil
+	} else if !sourceTime.After(*targetTime) {
+		return "updated after the source", nil
+	}
+	return "", nil
+}
+
+// replicateUpdated returns the update time in the KV v2 metadata of the
+// secret at path, or nil if it has none
+func replicateUpdated(client *Client, path string) (*time.Time, error) {
+	if !client.IsKV2(path) {
+		return nil, nil
+	}
+	metadata, err := client.ReadMetadata(path)
+	if err != nil || metadata == nil {
+		return nil, err
+	}
+	updated, _ := metadata.Data["updated_time"].(string)
+	if updated == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, updated)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update time %q", updated)
+	}
+	return &t, nil
+}
+
+func (cmd *ReplicateCommand) Synopsis() string {
+	return "copy secrets between the Vault clusters of two profiles"
+}
+
+func ReplicateCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &ReplicateCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("replicate", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.from, "from-profile", "", "profile of the source cluster")
+		cmd.fs.StringVar(&cmd.to, "to-profile", "", "profile of the target cluster")
+		cmd.fs.StringVar(&cmd.target, "to", "", "path in the target cluster (default: the same path)")
+		cmd.fs.StringVar(&cmd.conflict, "conflict", conflictSkip, "conflict policy (skip, overwrite or newer)")
+		cmd.fs.BoolVar(&cmd.force, "f", false, "copy without confirmation")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,177 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+// replicateServer is a Vault cluster with KV v2 secrets, by path below kv/,
+// updated at the times in updated; writes are recorded
+type replicateServer struct {
+	*httptest.Server
+	token   string
+	secrets map[string]string
+	updated map[string]string
+
+	mu     sync.Mutex
+	writes []string
+}
+
+func newReplicateServer(token string, secrets, updated map[string]string) *replicateServer {
+	s := &replicateServer{token: token, secrets: secrets, updated: updated}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != s.token {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+		var (
+			response interface{}
+			path     = r.URL.Path
+		)
+		switch {
+		case path == "/v1/sys/mounts":
+			response = map[string]interface{}{
+				"kv/": map[string]interface{}{"type": "kv", "options": map[string]string{"version": "2"}},
+			}
+		case r.URL.Query().Get("list") == "true" && strings.TrimSuffix(path, "/") == "/v1/kv/metadata/app":
+			var keys []string
+			for name := range s.secrets {
+				keys = append(keys, strings.TrimPrefix(name, "app/"))
+			}
+			sort.Strings(keys)
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": keys}}
+		case strings.HasPrefix(path, "/v1/kv/metadata/") && s.updated[strings.TrimPrefix(path, "/v1/kv/metadata/")] != "":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"updated_time": s.updated[strings.TrimPrefix(path, "/v1/kv/metadata/")],
+			}}
+		case strings.HasPrefix(path, "/v1/kv/data/") && r.Method == "GET" && s.secrets[strings.TrimPrefix(path, "/v1/kv/data/")] != "":
+			response = json.RawMessage(`{"data": {"data": ` + s.secrets[strings.TrimPrefix(path, "/v1/kv/data/")] + `}}`)
+		case strings.HasPrefix(path, "/v1/kv/data/") && (r.Method == "PUT" || r.Method == "POST"):
+			var body struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			b, _ := json.Marshal(body.Data)
+			s.mu.Lock()
+			s.writes = append(s.writes, strings.TrimPrefix(path, "/v1/kv/data/")+" "+string(b))
+			s.mu.Unlock()
+			response = map[string]interface{}{"data": map[string]interface{}{"version": 2}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	return s
+}
+
+func TestReplicateCommand(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "replicate")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	savedTokens, savedSessions, savedDryRun := profileTokenFile, sessionFile, DryRun
+	defer func() { profileTokenFile, sessionFile, DryRun = savedTokens, savedSessions, savedDryRun }()
+	profileTokenFile = filepath.Join(dir, "tokens")
+	sessionFile = filepath.Join(dir, "sessions")
+	os.Setenv("VAULT_TOKEN", "s.environment")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	source := newReplicateServer("s.eu", map[string]string{
+		"app/db":   `{"password": "new"}`,
+		"app/web":  `{"key": "old"}`,
+		"app/new":  `{"key": "k"}`,
+		"app/same": `{"key": "same"}`,
+	}, map[string]string{
+		"app/db":  "2026-02-01T00:00:00Z",
+		"app/web": "2026-01-01T00:00:00Z",
+	})
+	defer source.Close()
+	config := &Config{Profiles: map[string]*Profile{
+		"prod-eu": {Address: source.URL},
+	}}
+
+	replicate := func(t *testing.T, args ...string) (*replicateServer, string) {
+		t.Helper()
+		target := newReplicateServer("s.us", map[string]string{
+			"app/db":   `{"password": "old"}`,
+			"app/web":  `{"key": "new"}`,
+			"app/same": `{"key": "same"}`,
+		}, map[string]string{
+			"app/db":  "2026-01-01T00:00:00Z",
+			"app/web": "2026-03-01T00:00:00Z",
+		})
+		t.Cleanup(target.Close)
+		config.Profiles["prod-us"] = &Profile{Address: target.URL}
+
+		for name, token := range map[string]string{source.URL: "s.eu", target.URL: "s.us"} {
+			store := profileTokenStore{name: profileTokenFile, key: tokenKey(name, "")}
+			if err := store.Store(token); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ui := cli.NewMockUi()
+		command, _ := ReplicateCommandFactory(ui)()
+		cmd := command.(*ReplicateCommand)
+		cmd.config = config
+		args = append([]string{"-f", "-from-profile", "prod-eu", "-to-profile", "prod-us"}, args...)
+		if code := cmd.Run(append(args, "kv/app")); code != Success {
+			t.Fatalf("%v: expected success, got %d: %s", args, code, ui.ErrorWriter.String())
+		}
+		sort.Strings(target.writes)
+		return target, ui.OutputWriter.String()
+	}
+
+	tests := []struct {
+		conflict string
+		writes   []string
+	}{
+		{"skip", []string{`app/new {"key":"k"}`}},
+		{"newer", []string{`app/db {"password":"new"}`, `app/new {"key":"k"}`}},
+		{"overwrite", []string{`app/db {"password":"new"}`, `app/new {"key":"k"}`, `app/web {"key":"old"}`}},
+	}
+	for _, test := range tests {
+		t.Run(test.conflict, func(t *testing.T) {
+			target, _ := replicate(t, "-conflict", test.conflict)
+			if !reflect.DeepEqual(target.writes, test.writes) {
+				t.Fatalf("expected writes %q, got %q", test.writes, target.writes)
+			}
+		})
+	}
+
+	t.Run("dry-run", func(t *testing.T) {
+		DryRun = true
+		defer func() { DryRun = false }()
+		target, output := replicate(t, "-conflict", "newer")
+		if len(target.writes) != 0 {
+			t.Fatalf("expected no writes, got %q", target.writes)
+		}
+		for _, line := range []string{
+			"dry run: update kv/app/db in prod-us",
+			"dry run: create kv/app/new in prod-us",
+			"dry run: skip kv/app/web (updated after the source)",
+		} {
+			if !strings.Contains(output, line) {
+				t.Fatalf("expected %q in plan, got:\n%s", line, output)
+			}
+		}
+		if strings.Contains(output, "kv/app/same") {
+			t.Fatalf("expected secrets with the same values to be left out, got:\n%s", output)
+		}
+	})
+}
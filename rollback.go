@@ -0,0 +1,105 @@
+package vc
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/mitchellh/cli"
+)
+
+// RollbackCommand restores a previous version of a KV v2 secret
+type RollbackCommand struct {
+	baseCommand
+	fs      *flag.FlagSet
+	version int
+	force   bool
+}
+
+func (cmd *RollbackCommand) Help() string {
+	return "Usage: vc rollback -to-version <version> [<options>] <secret path>\n\nOptions:\n" + defaults(cmd.fs)
+}
+
+func (cmd *RollbackCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) != 1 || cmd.version < 1 {
+		return Help
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	if _, err = client.KV2Path(args[0], "data"); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+
+	target, err := client.ReadVersion(args[0], cmd.version)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+	if target == nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: version %d not found, deleted or destroyed", args[0], cmd.version))
+		return NotFoundError
+	}
+
+	current, err := client.ReadVersion(args[0], 0)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+	var currentData map[string]interface{}
+	if current != nil {
+		currentData = current.Data
+	}
+
+	changes := describeChanges(currentData, target.Data)
+	if len(changes) == 0 {
+		cmd.ui.Info(fmt.Sprintf("secret at %s is identical to version %d", args[0], cmd.version))
+		return Success
+	}
+	ok, err := cmd.confirmChanges(cmd.force, changes, "roll back secret at %s to version %d?", args[0], cmd.version)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return SystemError
+	} else if !ok {
+		return Success
+	}
+
+	if err = cmd.writeSecret(client, args[0], target.Data); err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	}
+
+	if !DryRun {
+		cmd.ui.Info(fmt.Sprintf("secret at %s rolled back to version %d", args[0], cmd.version))
+	}
+	return Success
+}
+
+func (cmd *RollbackCommand) Synopsis() string {
+	return "roll back a secret to a previous version"
+}
+
+func RollbackCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &RollbackCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("rollback", flag.ContinueOnError)
+		cmd.fs.BoolVar(&cmd.force, "f", false, "force rollback, without confirmation")
+		cmd.fs.IntVar(&cmd.version, "to-version", 0, "version to roll back to")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
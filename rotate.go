@@ -0,0 +1,338 @@
+package vc
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// rotatedMetadataKey is the custom metadata key prefix that records when a key
+// of a secret was last rotated, as "rotated_<key>"
+const rotatedMetadataKey = "rotated_"
+
+// rotatePreviousSuffix is appended to the key that keeps the previous value
+// during the grace period
+const rotatePreviousSuffix = "_previous"
+
+// rotateManifest lists the secrets that are rotated by rotate
+type rotateManifest struct {
+	Secrets []rotateSecret `yaml:"secrets"`
+}
+
+// rotateSecret is a key of a secret that is rotated every Interval; the new
+// value is generated, or returned by Command. During the Grace period after a
+// rotation the previous value is kept, in the key with rotatePreviousSuffix.
+type rotateSecret struct {
+	Path     string           `yaml:"path"`
+	Key      string           `yaml:"key"`
+	Interval string           `yaml:"interval"`
+	Grace    string           `yaml:"grace"`
+	Generate *rotateGenerator `yaml:"generate"`
+	Command  []string         `yaml:"command"`
+
+	interval time.Duration
+	grace    time.Duration
+}
+
+// rotateGenerator generates a password or a passphrase, see vc generate
+type rotateGenerator struct {
+	Type      string `yaml:"type"`
+	Length    int    `yaml:"length"`
+	Classes   string `yaml:"classes"`
+	Exclude   string `yaml:"exclude"`
+	Min       *int   `yaml:"min"`
+	Words     int    `yaml:"words"`
+	Wordlist  string `yaml:"wordlist"`
+	Separator string `yaml:"separator"`
+}
+
+// loadRotateManifest reads the manifest file name
+func loadRotateManifest(name string) (*rotateManifest, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	m := new(rotateManifest)
+	if err = yaml.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	for i := range m.Secrets {
+		s := &m.Secrets[i]
+		if s.Path == "" || s.Interval == "" {
+			return nil, fmt.Errorf("%s: secret %d: path and interval are required", name, i+1)
+		}
+		if s.Key == "" {
+			s.Key = "password"
+		}
+		if s.interval, err = time.ParseDuration(s.Interval); err != nil || s.interval <= 0 {
+			return nil, fmt.Errorf("%s: %s: invalid interval %q", name, s.Path, s.Interval)
+		}
+		if s.Grace != "" {
+			if s.grace, err = time.ParseDuration(s.Grace); err != nil || s.grace < 0 {
+				return nil, fmt.Errorf("%s: %s: invalid grace %q", name, s.Path, s.Grace)
+			}
+		}
+		if s.Generate != nil && len(s.Command) > 0 {
+			return nil, fmt.Errorf("%s: %s: generate and command are exclusive", name, s.Path)
+		} else if s.Generate == nil && len(s.Command) == 0 {
+			s.Generate = new(rotateGenerator)
+		}
+	}
+	return m, nil
+}
+
+// generate returns the new value; current is the value that is rotated
+func (s *rotateSecret) generate(current string) (string, error) {
+	if len(s.Command) > 0 {
+		return s.run(current)
+	}
+
+	g := s.Generate
+	switch g.Type {
+	case "", "password":
+		length, classes, min := g.Length, g.Classes, 1
+		if length == 0 {
+			length = 24
+		}
+		if classes == "" {
+			classes = "luds"
+		}
+		if g.Min != nil {
+			min = *g.Min
+		}
+		return generatePassword(length, classes, g.Exclude, min)
+	case "passphrase":
+		count, wordlist, separator := g.Words, g.Wordlist, g.Separator
+		if count == 0 {
+			count = 6
+		}
+		if wordlist == "" {
+			wordlist = "/usr/share/dict/words"
+		}
+		if separator == "" {
+			separator = "-"
+		}
+		words, err := readWordlist(wordlist)
+		if err != nil {
+			return "", err
+		}
+		return generatePassphrase(words, count, separator)
+	default:
+		return "", fmt.Errorf("unknown generator %q", g.Type)
+	}
+}
+
+// run runs the command, with the current value on its standard input; the
+// new value is its output
+func (s *rotateSecret) run(current string) (string, error) {
+	Debugf("rotate: %v for %s/%s", s.Command, s.Path, s.Key)
+	var (
+		out = new(secureBuffer)
+		c   = exec.Command(s.Command[0], s.Command[1:]...)
+	)
+	defer out.Wipe()
+	c.Env = append(os.Environ(), "VC_ROTATE_PATH="+s.Path, "VC_ROTATE_KEY="+s.Key)
+	c.Stdin = strings.NewReader(current)
+	c.Stdout = out
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("%s: %v", s.Command[0], err)
+	}
+	value := strings.TrimRight(string(out.Bytes()), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("%s: no value", s.Command[0])
+	}
+	return value, nil
+}
+
+// RotateCommand rotates the secrets in a manifest that are due
+type RotateCommand struct {
+	baseCommand
+	fs       *flag.FlagSet
+	manifest string
+	force    bool
+}
+
+func (cmd *RotateCommand) Help() string {
+	return `Usage: vc rotate [<options>] -f <manifest> [<path> ...]
+
+Rotate the secrets in the manifest that are due, or only the secrets at the
+paths given. The new value is written with check-and-set, so secrets that are
+changed meanwhile are not overwritten, and the time of the rotation is recorded
+in the custom metadata of the secret. Secrets must be in a KV v2 mount.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *RotateCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if cmd.manifest == "" {
+		return Help
+	}
+
+	m, err := loadRotateManifest(cmd.manifest)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	only := make(map[string]bool)
+	for _, path := range cmd.resolveAll(cmd.fs.Args()) {
+		only[strings.Trim(path, "/")] = true
+	}
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	var (
+		ret              int
+		rotated, pending int
+		colors           = cmd.colors(os.Stdout)
+		now              = time.Now()
+	)
+	for i := range m.Secrets {
+		s := &m.Secrets[i]
+		s.Path = strings.Trim(cmd.resolve(s.Path), "/")
+		if len(only) > 0 && !only[s.Path] {
+			continue
+		}
+		if stopping() {
+			cmd.ui.Warn("warning: rotate: shutting down, skipping the other secrets")
+			break
+		}
+		changes, err := cmd.rotate(client, s, now)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s/%s: %v", s.Path, s.Key, err))
+			if code := exitCode(err, ServerError); code > ret {
+				ret = code
+			}
+			continue
+		}
+		for _, change := range changes {
+			cmd.ui.Output(colors.change(change))
+		}
+		if len(changes) > 0 && changes[0][0] == '~' {
+			rotated++
+		} else {
+			pending++
+		}
+	}
+	cmd.ui.Info(fmt.Sprintf("rotate: %d rotated, %d not due", rotated, pending))
+	return ret
+}
+
+// rotate rotates s if it is due, or removes the previous value once the grace
+// period is over; it returns the changes
+func (cmd *RotateCommand) rotate(client *Client, s *rotateSecret, now time.Time) ([]string, error) {
+	if l, err := client.Resolve(s.Path); err != nil {
+		return nil, err
+	} else if err = l.RequireKV2("rotations"); err != nil {
+		return nil, err
+	}
+	meta, err := client.ReadMetadata(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		version int
+		custom  map[string]interface{}
+		data    = make(map[string]interface{})
+	)
+	if meta != nil {
+		if version, err = parseInt(meta.Data["current_version"]); err != nil {
+			return nil, fmt.Errorf("current_version: %v", err)
+		}
+		custom, _ = meta.Data["custom_metadata"].(map[string]interface{})
+	}
+	if version > 0 {
+		// The version that was read is the one that is replaced, see cas
+		secret, err := client.ReadVersion(s.Path, version)
+		if err != nil {
+			return nil, err
+		} else if secret != nil {
+			for k, v := range secret.Data {
+				data[k] = v
+			}
+		}
+	}
+
+	var rotated time.Time
+	if value, _ := custom[rotatedMetadataKey+s.Key].(string); value != "" {
+		if rotated, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, fmt.Errorf("invalid %s%s in the custom metadata: %v", rotatedMetadataKey, s.Key, err)
+		}
+	}
+	var (
+		key      = s.Path + "/" + s.Key
+		previous = s.Key + rotatePreviousSuffix
+	)
+	if !cmd.force && !rotated.IsZero() && now.Before(rotated.Add(s.interval)) {
+		Debugf("rotate: %s is due at %s", key, rotated.Add(s.interval).Format(time.RFC3339))
+		if _, ok := data[previous]; !ok || now.Before(rotated.Add(s.grace)) {
+			return nil, nil
+		}
+		if !DryRun {
+			delete(data, previous)
+			if err = client.WriteSecretCAS(s.Path, data, version); err != nil {
+				return nil, err
+			}
+		}
+		return []string{"- " + s.Path + "/" + previous}, nil
+	}
+
+	if DryRun {
+		return []string{"~ " + key}, nil
+	}
+	current, _ := data[s.Key].(string)
+	value, err := s.generate(current)
+	if err != nil {
+		return nil, err
+	}
+	data[s.Key] = value
+	if s.grace > 0 && current != "" {
+		data[previous] = current
+	} else {
+		delete(data, previous)
+	}
+	if err = client.WriteSecretCAS(s.Path, data, version); err != nil {
+		return nil, err
+	}
+	if err = client.WriteCustomMetadata(s.Path, map[string]string{rotatedMetadataKey + s.Key: now.UTC().Format(time.RFC3339)}); err != nil {
+		return nil, fmt.Errorf("rotated, but recording the time failed: %v", err)
+	}
+	return []string{"~ " + key}, nil
+}
+
+func (cmd *RotateCommand) Synopsis() string {
+	return "rotate the secrets in a manifest that are due"
+}
+
+func RotateCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &RotateCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("rotate", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.manifest, "f", "", "manifest file")
+		cmd.fs.BoolVar(&cmd.force, "force", false, "rotate secrets that are not due")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,113 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestRotateCommand(t *testing.T) {
+	var (
+		data    = map[string]interface{}{"password": "old", "user": "app"}
+		version = 1
+		custom  = map[string]interface{}{}
+	)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/secret/metadata/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"current_version": version, "custom_metadata": custom}}
+		case "PUT /v1/secret/metadata/db":
+			var body struct {
+				Custom map[string]interface{} `json:"custom_metadata"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			custom = body.Custom
+		case "GET /v1/secret/data/db":
+			if r.URL.Query().Get("version") != strconv.Itoa(version) {
+				t.Errorf("expected a read of version %d, got %s", version, r.URL.RawQuery)
+			}
+			response = map[string]interface{}{"data": map[string]interface{}{"data": data}}
+		case "PUT /v1/secret/data/db":
+			var body struct {
+				Data    map[string]interface{} `json:"data"`
+				Options struct {
+					CAS int `json:"cas"`
+				} `json:"options"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Options.CAS != version {
+				w.WriteHeader(http.StatusBadRequest)
+				response = map[string]interface{}{"errors": []string{"check-and-set parameter did not match the current version"}}
+				break
+			}
+			data, version = body.Data, version+1
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv-v2"})
+
+	dir, err := ioutil.TempDir(os.TempDir(), "rotate")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := filepath.Join(dir, "rotate.yaml")
+	if err = ioutil.WriteFile(manifest, []byte(`secrets:
+  - path: secret/db
+    interval: 720h
+    grace: 1h
+    generate: {length: 16, classes: ld}
+`), 0600); err != nil {
+		t.Skip(err)
+	}
+
+	run := func() (int, string) {
+		ui := cli.NewMockUi()
+		command, _ := RotateCommandFactory(ui)()
+		cmd := command.(*RotateCommand)
+		cmd.c, cmd.config = c, new(Config)
+		code := cmd.Run([]string{"-f", manifest})
+		return code, ui.OutputWriter.String()
+	}
+
+	// Never rotated
+	if code, out := run(); code != Success || out != "~ secret/db/password\nrotate: 1 rotated, 0 not due\n" {
+		t.Fatalf("unexpected result %d %q", code, out)
+	}
+	if password, _ := data["password"].(string); len(password) != 16 || data["password_previous"] != "old" || data["user"] != "app" {
+		t.Fatalf("unexpected data %v", data)
+	}
+	if _, err = time.Parse(time.RFC3339, custom["rotated_password"].(string)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Not due, within the grace period
+	if code, out := run(); code != Success || out != "rotate: 0 rotated, 1 not due\n" {
+		t.Fatalf("unexpected result %d %q", code, out)
+	}
+
+	// After the grace period, the previous value is removed
+	custom["rotated_password"] = time.Now().Add(-2 * time.Hour).Format(time.RFC3339)
+	if code, out := run(); code != Success || out != "- secret/db/password_previous\nrotate: 0 rotated, 1 not due\n" {
+		t.Fatalf("unexpected result %d %q", code, out)
+	}
+	if _, ok := data["password_previous"]; ok {
+		t.Fatalf("expected previous value to be removed, got %v", data)
+	}
+
+	// Due
+	custom["rotated_password"] = time.Now().Add(-721 * time.Hour).Format(time.RFC3339)
+	if code, out := run(); code != Success || out != "~ secret/db/password\nrotate: 1 rotated, 0 not due\n" {
+		t.Fatalf("unexpected result %d %q", code, out)
+	}
+}
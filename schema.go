@@ -0,0 +1,273 @@
+package vc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SchemaMetadataKey is the custom metadata key of KV v2 secrets with the JSON
+// Schema of the secret
+const SchemaMetadataKey = "schema"
+
+// ErrSchema is returned for writes of data that violates its schema
+var ErrSchema = errors.New("schema violation")
+
+// Schema attaches a JSON Schema to the secrets at, or below, paths matching
+// one of Paths; the data of the secrets is validated before vc writes it
+type Schema struct {
+	Paths []string `yaml:"paths"`
+
+	// File is the JSON Schema, in JSON
+	File string `yaml:"file"`
+}
+
+// validateWrite validates data against the schemas of the configuration file
+// that apply to path, and the schema in the custom metadata of a KV v2
+// secret; violations are returned as ErrSchema
+func (cmd *baseCommand) validateWrite(client *Client, path string, data map[string]interface{}) error {
+	config, err := cmd.Config()
+	if err != nil {
+		return err
+	}
+	type source struct {
+		name   string
+		schema []byte
+	}
+	var sources []source
+	for _, s := range config.Schemas {
+		if !matchPathPrefix(s.Paths, path) {
+			continue
+		}
+		name := os.ExpandEnv(s.File)
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("schema: %v", err)
+		}
+		sources = append(sources, source{name, b})
+	}
+	if client.IsKV2(path) {
+		metadata, err := client.ReadMetadata(path)
+		if err != nil && ErrorKind(err) != ErrNotFound {
+			// Writes don't need to read metadata
+			Debugf("schema: %s: %v", path, err)
+		} else if metadata != nil {
+			custom, _ := metadata.Data["custom_metadata"].(map[string]interface{})
+			if s, _ := custom[SchemaMetadataKey].(string); s != "" {
+				sources = append(sources, source{"in the metadata", []byte(s)})
+			}
+		}
+	}
+
+	value := make(map[string]interface{}, len(data))
+	for key, v := range data {
+		if key != CodecTypeKey {
+			value[key] = v
+		}
+	}
+	for _, s := range sources {
+		var schema interface{}
+		if err := json.Unmarshal(s.schema, &schema); err != nil {
+			return fmt.Errorf("schema %s: %v", s.name, err)
+		}
+		Debugf("schema: validating %s against the schema %s", path, s.name)
+		if violations := validateSchema(schema, value, ""); len(violations) > 0 {
+			return &Error{Kind: ErrSchema, Err: fmt.Errorf("%s violates the schema %s: %s", path, s.name, strings.Join(violations, "; "))}
+		}
+	}
+	return nil
+}
+
+// validateSchema validates value against the JSON Schema, returning the
+// violations; at is the JSON pointer of value. The validation keywords for
+// types, enumerations, objects, arrays, strings and numbers are supported,
+// others (such as $ref and allOf) are ignored.
+func validateSchema(schema, value interface{}, at string) []string {
+	if m, ok := value.(map[interface{}]interface{}); ok {
+		// Nested YAML objects, such as from vc edit
+		object := make(map[string]interface{}, len(m))
+		for key, v := range m {
+			object[fmt.Sprint(key)] = v
+		}
+		value = object
+	}
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		if allowed, ok := schema.(bool); ok && !allowed {
+			return []string{schemaPointer(at) + ": not allowed"}
+		}
+		return nil
+	}
+
+	var violations []string
+	report := func(format string, v ...interface{}) {
+		violations = append(violations, schemaPointer(at)+": "+fmt.Sprintf(format, v...))
+	}
+	if t, ok := s["type"]; ok {
+		types := schemaStrings(t)
+		if !schemaTypeIn(types, value) {
+			report("expected %s, got %s", strings.Join(types, " or "), schemaType(value))
+			return violations
+		}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		var found bool
+		for _, v := range enum {
+			if schemaEqual(v, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("not one of the allowed values")
+		}
+	}
+	if c, ok := s["const"]; ok && !schemaEqual(c, value) {
+		report("not the allowed value")
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		properties, _ := s["properties"].(map[string]interface{})
+		for _, key := range schemaStrings(s["required"]) {
+			if _, ok := value[key]; !ok {
+				report("missing required key %q", key)
+			}
+		}
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, ok := properties[key]; ok {
+				violations = append(violations, validateSchema(property, value[key], at+"/"+key)...)
+			} else if additional, ok := s["additionalProperties"]; ok {
+				if allowed, ok := additional.(bool); ok && !allowed {
+					violations = append(violations, schemaPointer(at+"/"+key)+": unknown key")
+				} else {
+					violations = append(violations, validateSchema(additional, value[key], at+"/"+key)...)
+				}
+			}
+		}
+	case []interface{}:
+		if n, ok := schemaNumber(s["minItems"]); ok && float64(len(value)) < n {
+			report("fewer than %v items", n)
+		}
+		if n, ok := schemaNumber(s["maxItems"]); ok && float64(len(value)) > n {
+			report("more than %v items", n)
+		}
+		if items, ok := s["items"]; ok {
+			for i, item := range value {
+				violations = append(violations, validateSchema(items, item, fmt.Sprintf("%s/%d", at, i))...)
+			}
+		}
+	case string:
+		length := float64(len([]rune(value)))
+		if n, ok := schemaNumber(s["minLength"]); ok && length < n {
+			report("shorter than %v characters", n)
+		}
+		if n, ok := schemaNumber(s["maxLength"]); ok && length > n {
+			report("longer than %v characters", n)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err != nil {
+				report("invalid pattern %q in the schema", pattern)
+			} else if !re.MatchString(value) {
+				report("doesn't match %q", pattern)
+			}
+		}
+	default:
+		if n, ok := schemaNumber(value); ok {
+			if min, ok := schemaNumber(s["minimum"]); ok && n < min {
+				report("less than %v", min)
+			}
+			if max, ok := schemaNumber(s["maximum"]); ok && n > max {
+				report("more than %v", max)
+			}
+		}
+	}
+	return violations
+}
+
+// schemaPointer returns the JSON pointer at, or the data for the root
+func schemaPointer(at string) string {
+	if at == "" {
+		return "data"
+	}
+	return at
+}
+
+// schemaType returns the JSON Schema type of value
+func schemaType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		if n, ok := schemaNumber(value); ok && n == math.Trunc(n) {
+			return "integer"
+		} else if ok {
+			return "number"
+		}
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// schemaTypeIn checks if value has one of types; integers are numbers
+func schemaTypeIn(types []string, value interface{}) bool {
+	actual := schemaType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaNumber returns the value of numbers, as decoded from JSON
+func schemaNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// schemaEqual compares JSON values, numbers by value
+func schemaEqual(a, b interface{}) bool {
+	if x, ok := schemaNumber(a); ok {
+		y, ok := schemaNumber(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// schemaStrings returns a string, or the strings in a list
+func schemaStrings(v interface{}) []string {
+	if s, ok := v.(string); ok {
+		return []string{s}
+	}
+	return identityStrings(v)
+}
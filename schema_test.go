@@ -0,0 +1,122 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestValidateSchema(t *testing.T) {
+	var schema interface{}
+	if err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["host", "port"],
+		"additionalProperties": false,
+		"properties": {
+			"host": {"type": "string", "minLength": 1},
+			"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+			"mode": {"enum": ["ro", "rw"]},
+			"user": {"type": "string", "pattern": "^[a-z]+$"},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+		}
+	}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{`{"host": "db", "port": 5432, "mode": "ro", "user": "app", "tags": ["a"]}`, nil},
+		{`{"host": "db"}`, []string{`data: missing required key "port"`}},
+		{`{"host": "db", "port": "5432"}`, []string{"/port: expected integer, got string"}},
+		{`{"host": "db", "port": 5432.5}`, []string{"/port: expected integer, got number"}},
+		{`{"host": "db", "port": 0}`, []string{"/port: less than 1"}},
+		{`{"host": "", "port": 1, "hots": "db"}`, []string{"/host: shorter than 1 characters", "/hots: unknown key"}},
+		{`{"host": "db", "port": 1, "mode": "rx", "user": "App"}`, []string{"/mode: not one of the allowed values", `/user: doesn't match "^[a-z]+$"`}},
+		{`{"host": "db", "port": 1, "tags": ["a", 2, "c"]}`, []string{"/tags: more than 2 items", "/tags/1: expected string, got integer"}},
+	}
+	for _, test := range tests {
+		decoder := json.NewDecoder(strings.NewReader(test.data))
+		decoder.UseNumber()
+		var data interface{}
+		if err := decoder.Decode(&data); err != nil {
+			t.Fatal(err)
+		}
+		if got := validateSchema(schema, data, ""); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %q, got %q", test.data, test.want, got)
+		}
+	}
+}
+
+func TestWriteSchema(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "schema")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.json")
+	if err = ioutil.WriteFile(name, []byte(`{"required": ["url"], "additionalProperties": {"type": "string"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var writes []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/kv/metadata/apps/web/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"custom_metadata": map[string]string{
+				SchemaMetadataKey: `{"required": ["password"], "properties": {"port": {"pattern": "^[0-9]+$"}}}`,
+			}}}
+		case "PUT /v1/kv/data/apps/web/db", "POST /v1/kv/data/apps/web/db", "PUT /v1/kv/data/apps/web", "POST /v1/kv/data/apps/web":
+			writes = append(writes, r.URL.Path)
+			response = map[string]interface{}{"data": map[string]interface{}{"version": 1}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"kv/": "kv-v2"})
+
+	write := func(args ...string) (*cli.MockUi, int) {
+		ui := cli.NewMockUi()
+		command, _ := WriteCommandFactory(ui)()
+		cmd := command.(*WriteCommand)
+		cmd.c = c
+		cmd.config = &Config{Schemas: []Schema{{Paths: []string{"kv/apps/*"}, File: name}}}
+		return ui, cmd.Run(args)
+	}
+
+	// The schema of the configuration file applies below kv/apps/*
+	if ui, code := write("kv/apps/web", "url=https://web"); code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	ui, code := write("kv/apps/web", "uri=https://web")
+	if code != SchemaError {
+		t.Fatalf("expected schema error, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if got := ui.ErrorWriter.String(); !strings.Contains(got, `missing required key "url"`) {
+		t.Fatalf("expected the missing key to be reported, got %q", got)
+	}
+
+	// Both schemas apply to secrets with a schema in their metadata
+	if ui, code = write("kv/apps/web/db", "url=postgres://db", "password=pw", "port=5432"); code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if ui, code = write("kv/apps/web/db", "url=postgres://db", "port=5432"); code != SchemaError {
+		t.Fatalf("expected schema error, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if ui, code = write("kv/apps/web/db", "url=postgres://db", "password=pw", "port=db"); code != SchemaError {
+		t.Fatalf("expected schema error, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if len(writes) != 2 {
+		t.Fatalf("expected 2 writes, got %q", writes)
+	}
+}
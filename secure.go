@@ -0,0 +1,120 @@
+package vc
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// DisableMlock disables locking the memory of the process, see LockMemory
+var DisableMlock bool
+
+// LockMemory locks the memory of the process, so secrets are never swapped
+// to disk. Memory is only locked if that is permitted without limits (as
+// root, or with an unlimited RLIMIT_MEMLOCK), because the process can't
+// allocate memory beyond the limit once it is locked; otherwise a debug
+// message is logged and nil is returned.
+func LockMemory() error {
+	if DisableMlock {
+		return nil
+	}
+	if !mlockPermitted() {
+		Debug("mlock: not permitted, memory is not locked")
+		return nil
+	}
+	if err := lockMemory(); err != nil {
+		return fmt.Errorf("mlock: %v (use --disable-mlock to run without locking memory)", err)
+	}
+	Debug("mlock: memory is locked")
+	return nil
+}
+
+// wipe overwrites p with zeros
+func wipe(p []byte) {
+	for i := range p {
+		p[i] = 0
+	}
+}
+
+// secureBuffer is a buffer for secret material, that wipes the memory it
+// releases when it grows, and all of its memory when it is wiped; use it
+// instead of bytes.Buffer for values that are not kept in strings
+type secureBuffer struct {
+	b []byte
+}
+
+func (buf *secureBuffer) grow(n int) {
+	if len(buf.b)+n <= cap(buf.b) {
+		return
+	}
+	size := 2*cap(buf.b) + n
+	if size < 512 {
+		size = 512
+	}
+	b := make([]byte, len(buf.b), size)
+	copy(b, buf.b)
+	wipe(buf.b[:cap(buf.b)])
+	buf.b = b
+}
+
+func (buf *secureBuffer) Write(p []byte) (int, error) {
+	buf.grow(len(p))
+	buf.b = append(buf.b, p...)
+	return len(p), nil
+}
+
+func (buf *secureBuffer) WriteString(s string) (int, error) {
+	buf.grow(len(s))
+	buf.b = append(buf.b, s...)
+	return len(s), nil
+}
+
+// ReadFrom reads r until EOF
+func (buf *secureBuffer) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	for {
+		buf.grow(512)
+		n, err := r.Read(buf.b[len(buf.b):cap(buf.b)])
+		buf.b = buf.b[:len(buf.b)+n]
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		} else if err != nil {
+			return total, err
+		}
+	}
+}
+
+// Bytes returns the contents, which are valid until the buffer is written to
+// or wiped
+func (buf *secureBuffer) Bytes() []byte {
+	return buf.b
+}
+
+func (buf *secureBuffer) Len() int {
+	return len(buf.b)
+}
+
+// Wipe overwrites the contents with zeros, and empties the buffer
+func (buf *secureBuffer) Wipe() {
+	wipe(buf.b[:cap(buf.b)])
+	buf.b = buf.b[:0]
+}
+
+// readSecretFile reads the file name (or stdin for "-") into a secureBuffer
+func readSecretFile(name string) (*secureBuffer, error) {
+	f := os.Stdin
+	if name != "-" {
+		var err error
+		if f, err = os.Open(name); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+	}
+	buf := new(secureBuffer)
+	if _, err := buf.ReadFrom(f); err != nil {
+		buf.Wipe()
+		return nil, err
+	}
+	return buf, nil
+}
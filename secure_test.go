@@ -0,0 +1,35 @@
+package vc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSecureBuffer(t *testing.T) {
+	buf := new(secureBuffer)
+	buf.WriteString("secret")
+	old := buf.Bytes()[:cap(buf.Bytes())]
+
+	// Growing the buffer wipes the old memory
+	buf.Write(bytes.Repeat([]byte{'x'}, 1024))
+	if !bytes.Equal(old, make([]byte, len(old))) {
+		t.Fatal("expected old memory to be wiped")
+	}
+	if got := string(buf.Bytes()); got != "secret"+strings.Repeat("x", 1024) {
+		t.Fatalf("unexpected contents %q", got)
+	}
+
+	b := buf.Bytes()
+	buf.Wipe()
+	if buf.Len() != 0 || !bytes.Equal(b, make([]byte, len(b))) {
+		t.Fatal("expected buffer to be wiped")
+	}
+
+	if _, err := buf.ReadFrom(strings.NewReader(strings.Repeat("y", 2000))); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 2000 {
+		t.Fatalf("expected 2000 bytes, got %d", buf.Len())
+	}
+}
@@ -0,0 +1,250 @@
+package vc
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultSecurityKeyFile keeps the store key, encrypted to the security key
+const DefaultSecurityKeyFile = "$HOME/.config/vc/store.key.age"
+
+// sealedPrefix starts the files sealed with the store key, see storeKey
+const sealedPrefix = "vc:sealed:1:"
+
+// SecurityKey protects the token store and the cache on disk with a hardware
+// security key, such as a YubiKey. The files are encrypted with a random store
+// key, which is encrypted with age to the security key, with the
+// age-plugin-yubikey (PIV) or age-plugin-fido2-hmac (FIDO2 hmac-secret)
+// plugins. Decrypting the store key asks for a touch; the store key is then
+// kept in $XDG_RUNTIME_DIR until the session ends.
+type SecurityKey struct {
+	// Identity is the age identity file of the security key, as generated by
+	// the plugin
+	Identity string `yaml:"identity"`
+
+	// Recipient is the age recipient of the security key, such as
+	// age1yubikey1...
+	Recipient string `yaml:"recipient"`
+
+	// KeyFile keeps the encrypted store key, see DefaultSecurityKeyFile
+	KeyFile string `yaml:"key_file,omitempty"`
+}
+
+// storeKey seals and opens files with the AES-256-GCM key protected by a
+// SecurityKey; a nil storeKey leaves files as they are
+type storeKey struct {
+	aead cipher.AEAD
+}
+
+var (
+	// storeKeys are the store keys that were loaded, by key file, so the
+	// security key is touched once
+	storeKeys      = make(map[string]*storeKey)
+	storeKeysMutex sync.Mutex
+)
+
+// loadStoreKey returns the store key of config; the store key is created on
+// first use, and decrypted with the security key if it isn't in the session
+func loadStoreKey(config *SecurityKey) (*storeKey, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Identity == "" || config.Recipient == "" {
+		return nil, errors.New("security_key: identity and recipient are required")
+	}
+	name := config.keyFile()
+
+	storeKeysMutex.Lock()
+	defer storeKeysMutex.Unlock()
+	if key, ok := storeKeys[name]; ok {
+		return key, nil
+	}
+
+	session := sessionKeyFile(name)
+	b, err := readSessionKey(session)
+	if err != nil {
+		Debugf("security key: %v", err)
+	}
+	if b == nil {
+		if b, err = decryptStoreKey(config, name); err != nil {
+			return nil, fmt.Errorf("security key: %v", err)
+		}
+		if session != "" {
+			if err = writeKeyFile(session, b); err != nil {
+				Debugf("security key: %v", err)
+			}
+		}
+	}
+	key, err := newStoreKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("security key: %v", err)
+	}
+	storeKeys[name] = key
+	return key, nil
+}
+
+// keyFile returns the file that keeps the encrypted store key
+func (config *SecurityKey) keyFile() string {
+	if config.KeyFile == "" {
+		return os.ExpandEnv(DefaultSecurityKeyFile)
+	}
+	return os.ExpandEnv(config.KeyFile)
+}
+
+// forgetStoreKey removes the store key of config from the session, so it has
+// to be decrypted with the security key again
+func forgetStoreKey(config *SecurityKey) error {
+	name := config.keyFile()
+	storeKeysMutex.Lock()
+	defer storeKeysMutex.Unlock()
+	delete(storeKeys, name)
+	if session := sessionKeyFile(name); session != "" {
+		if err := os.Remove(session); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessionKeyFile returns the file that keeps the store key of the key file for
+// the session, or an empty string if there are no sessions
+func sessionKeyFile(name string) string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(name))
+	return filepath.Join(dir, "vc", hex.EncodeToString(hash[:8])+".key")
+}
+
+// readSessionKey returns the store key kept for the session, or nil
+func readSessionKey(name string) ([]byte, error) {
+	if name == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("%s: invalid store key", name)
+	}
+	Debugf("security key: using the store key of the session")
+	return b, nil
+}
+
+// decryptStoreKey decrypts the store key in the key file with the security
+// key; if there is no key file, a new store key is encrypted to the security
+// key, which doesn't need a touch
+func decryptStoreKey(config *SecurityKey, name string) ([]byte, error) {
+	sealed, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		b := make([]byte, 32)
+		if _, err = io.ReadFull(rand.Reader, b); err != nil {
+			return nil, err
+		}
+		if sealed, err = pipeCommand([]string{ageCommand, "--encrypt", "--recipient", config.Recipient}, b); err != nil {
+			return nil, err
+		}
+		Debugf("security key: new store key in %s", name)
+		return b, writeKeyFile(name, sealed)
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The plugin asks for the PIN and the touch on the terminal
+	var out bytes.Buffer
+	fmt.Fprintln(os.Stderr, "vc: touch your security key to unlock the token store")
+	c := exec.Command(ageCommand, "--decrypt", "--identity", os.ExpandEnv(config.Identity))
+	c.Stdin = bytes.NewReader(sealed)
+	c.Stdout = &out
+	c.Stderr = os.Stderr
+	if err = c.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v", ageCommand, err)
+	}
+	if out.Len() != 32 {
+		return nil, fmt.Errorf("%s: invalid store key", name)
+	}
+	return out.Bytes(), nil
+}
+
+// writeKeyFile writes the key b to name, only readable by the user
+func writeKeyFile(name string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	w := SafeOutputWriter(name, 0600)
+	if _, err := w.Write(b); err != nil {
+		w.(*safeOutputWriter).abort()
+		return err
+	}
+	return w.Close()
+}
+
+func newStoreKey(b []byte) (*storeKey, error) {
+	block, err := aes.NewCipher(b)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &storeKey{aead: aead}, nil
+}
+
+// seal encrypts b; the result is text, starting with sealedPrefix
+func (k *storeKey) seal(b []byte) ([]byte, error) {
+	if k == nil {
+		return b, nil
+	}
+	nonce := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+len(b)+k.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := k.aead.Seal(nonce, nonce, b, nil)
+	return []byte(sealedPrefix + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// open decrypts b, if it was sealed; files that weren't sealed, such as token
+// files from before the security key was configured, are returned as they are
+func (k *storeKey) open(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, []byte(sealedPrefix)) {
+		if k != nil {
+			Debugf("security key: file isn't sealed")
+		}
+		return b, nil
+	}
+	if k == nil {
+		return nil, errors.New("file is sealed with a security key, see security_key in the configuration")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b[len(sealedPrefix):])))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < k.aead.NonceSize() {
+		return nil, errors.New("sealed file is truncated")
+	}
+	nonce := sealed[:k.aead.NonceSize()]
+	b, err = k.aead.Open(nil, nonce, sealed[len(nonce):], nil)
+	if err != nil {
+		return nil, errors.New("unable to open sealed file, it was sealed with another store key")
+	}
+	return b, nil
+}
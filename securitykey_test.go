@@ -0,0 +1,93 @@
+package vc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecurityKey(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "securitykey")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake age that "encrypts" by copying stdin
+	script := filepath.Join(dir, "age")
+	if err = ioutil.WriteFile(script, []byte("#!/bin/sh\ncat\n"), 0755); err != nil {
+		t.Skip(err)
+	}
+	defer func(saved, savedRuntime string) {
+		ageCommand = saved
+		os.Setenv("XDG_RUNTIME_DIR", savedRuntime)
+		storeKeys = make(map[string]*storeKey)
+	}(ageCommand, os.Getenv("XDG_RUNTIME_DIR"))
+	ageCommand = script
+	os.Setenv("XDG_RUNTIME_DIR", filepath.Join(dir, "run"))
+
+	config := &SecurityKey{Identity: "yubikey.txt", Recipient: "age1yubikey1test", KeyFile: filepath.Join(dir, "store.key.age")}
+	if _, err = loadStoreKey(&SecurityKey{}); err == nil {
+		t.Fatal("expected error without identity and recipient")
+	}
+	key, err := loadStoreKey(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := sessionKeyFile(config.KeyFile)
+	if fi, err := os.Stat(session); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected session key mode 0600, got %s", fi.Mode())
+	}
+
+	// A token file from before keeps working, and is sealed when stored
+	var (
+		name  = filepath.Join(dir, "token")
+		store = fileTokenStore{names: []string{name}, key: key}
+	)
+	if err = ioutil.WriteFile(name, []byte("s.plain\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := store.Token(); err != nil || token != "s.plain" {
+		t.Fatalf("expected token s.plain, got %q, %v", token, err)
+	}
+	if err = store.Store("s.sealed"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(name); !bytes.HasPrefix(b, []byte(sealedPrefix)) || bytes.Contains(b, []byte("s.sealed")) {
+		t.Fatalf("expected sealed token file, got %q", b)
+	}
+	if _, err = (fileTokenStore{names: []string{name}}).Token(); err == nil {
+		t.Fatal("expected error reading sealed token without key")
+	}
+
+	// Without the session, the store key is decrypted with the security key
+	for _, remove := range []string{"", session} {
+		storeKeys = make(map[string]*storeKey)
+		if remove != "" {
+			os.Remove(remove)
+		}
+		other, err := loadStoreKey(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.key = other
+		if token, err := store.Token(); err != nil || token != "s.sealed" {
+			t.Fatalf("expected token s.sealed, got %q, %v", token, err)
+		}
+	}
+
+	// Another store key can't open the file
+	storeKeys = make(map[string]*storeKey)
+	os.Remove(session)
+	os.Remove(config.KeyFile)
+	if store.key, err = loadStoreKey(config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Token(); err == nil {
+		t.Fatal("expected error with another store key")
+	}
+}
@@ -0,0 +1,394 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// Version is the version of vc, set by the main package
+var Version = "(development build)"
+
+// selfUpdateMaxSize is the largest binary vc self-update downloads
+const selfUpdateMaxSize = 512 << 20
+
+// SelfUpdate configures vc self-update
+type SelfUpdate struct {
+	// URL is the release manifest, see releaseManifest
+	URL string `yaml:"url"`
+
+	// PublicKey is the Ed25519 public key that signs the release manifest,
+	// in base64
+	PublicKey string `yaml:"public_key"`
+}
+
+// releaseManifest is the latest release, at the URL of SelfUpdate; its
+// detached Ed25519 signature, in base64, is at the URL with .sig appended
+type releaseManifest struct {
+	Version string `json:"version"`
+
+	// Binaries are by platform, such as linux-amd64; their URLs may be
+	// relative to the manifest
+	Binaries map[string]releaseBinary `json:"binaries"`
+}
+
+type releaseBinary struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// SelfUpdateCommand replaces the vc binary with the latest release
+type SelfUpdateCommand struct {
+	baseCommand
+	fs         *flag.FlagSet
+	url        string
+	publicKey  string
+	check      bool
+	force      bool
+	downgrade  bool
+	executable string
+	http       *http.Client
+}
+
+func (cmd *SelfUpdateCommand) Help() string {
+	return `Usage: vc self-update [<options>]
+
+Replace the vc binary with the latest release. The release manifest is read
+from self_update in the configuration file (or -url), and its detached
+signature is verified with the public key there (or -key) before the binary
+for this platform is downloaded. The binary is checked against the SHA-256
+checksum in the manifest, written next to the running binary and renamed over
+it, so an interrupted update leaves the old binary in place. Releases that are
+not newer than this vc are not installed without -downgrade, so a replayed older
+manifest can't downgrade vc.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *SelfUpdateCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) != 0 {
+		return Help
+	}
+
+	config, err := cmd.Config()
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if s := config.SelfUpdate; s != nil {
+		if cmd.url == "" {
+			cmd.url = os.ExpandEnv(s.URL)
+		}
+		if cmd.publicKey == "" {
+			cmd.publicKey = s.PublicKey
+		}
+	}
+	if cmd.url == "" || cmd.publicKey == "" {
+		cmd.ui.Error("error: the release manifest and its public key are required, see self_update in the configuration")
+		return SyntaxError
+	}
+	key, err := base64.StdEncoding.DecodeString(cmd.publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		cmd.ui.Error("error: invalid public key, expected an Ed25519 public key in base64")
+		return SyntaxError
+	}
+
+	if err = cmd.update(ed25519.PublicKey(key)); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SystemError)
+	}
+	return Success
+}
+
+func (cmd *SelfUpdateCommand) update(key ed25519.PublicKey) error {
+	manifest, err := cmd.manifest(key)
+	if err != nil {
+		return err
+	}
+	newer, err := compareVersions(manifest.Version, Version)
+	if err != nil {
+		return err
+	} else if newer <= 0 && !cmd.downgrade {
+		// Older manifests, replayed, would install releases with known issues
+		if newer < 0 {
+			cmd.ui.Warn(fmt.Sprintf("warning: the release manifest has vc %s, older than this %s; use -downgrade to install it", manifest.Version, Version))
+		}
+		cmd.ui.Output(fmt.Sprintf("vc %s is up to date", Version))
+		return nil
+	}
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+	binary, ok := manifest.Binaries[platform]
+	if !ok || binary.URL == "" || binary.SHA256 == "" {
+		return notFound(fmt.Sprintf("release %s has no binary for %s", manifest.Version, platform))
+	}
+	if cmd.check {
+		cmd.ui.Output(fmt.Sprintf("vc %s is available, this is %s", manifest.Version, Version))
+		return nil
+	}
+
+	name := cmd.executable
+	if name == "" {
+		if name, err = os.Executable(); err != nil {
+			return err
+		}
+	}
+	if name, err = filepath.EvalSymlinks(name); err != nil {
+		return err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	if !DryRun {
+		if err = cmd.checkWritable(name); err != nil {
+			return err
+		}
+	}
+
+	changes := []string{fmt.Sprintf("~ %s (%s to %s)", name, Version, manifest.Version)}
+	if ok, err := cmd.confirmChanges(cmd.force, changes, "Replace %s with vc %s?", name, manifest.Version); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("not confirmed, vc is not updated")
+	}
+	if DryRun {
+		cmd.ui.Output(fmt.Sprintf("dry run: replace %s with vc %s", name, manifest.Version))
+		return nil
+	}
+
+	u, err := resolveReleaseURL(cmd.url, binary.URL)
+	if err != nil {
+		return err
+	}
+	Debugf("self-update: downloading %s", u)
+	r, err := cmd.get(u)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var (
+		w    = SafeOutputWriter(name, info.Mode().Perm()).(*safeOutputWriter)
+		hash = sha256.New()
+	)
+	n, err := io.Copy(io.MultiWriter(w, hash), io.LimitReader(r, selfUpdateMaxSize+1))
+	if err == nil && n > selfUpdateMaxSize {
+		err = fmt.Errorf("%s: binary is larger than %d bytes", u, selfUpdateMaxSize)
+	} else if sum := hex.EncodeToString(hash.Sum(nil)); err == nil && !strings.EqualFold(sum, binary.SHA256) {
+		err = fmt.Errorf("%s: checksum is %s, the manifest has %s", u, sum, binary.SHA256)
+	}
+	if err != nil {
+		w.abort()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	cmd.ui.Output(cmd.colors(os.Stdout).change(changes[0]))
+	return nil
+}
+
+// manifest reads the release manifest and verifies its signature
+func (cmd *SelfUpdateCommand) manifest(key ed25519.PublicKey) (*releaseManifest, error) {
+	body, err := cmd.read(cmd.url)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := cmd.read(cmd.url + ".sig")
+	if err != nil {
+		return nil, err
+	}
+	if signature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature))); err != nil {
+		return nil, fmt.Errorf("%s.sig: %v", cmd.url, err)
+	}
+	if !ed25519.Verify(key, body, signature) {
+		return nil, fmt.Errorf("%s: invalid signature", cmd.url)
+	}
+	manifest := new(releaseManifest)
+	if err = json.Unmarshal(body, manifest); err != nil {
+		return nil, fmt.Errorf("%s: %v", cmd.url, err)
+	} else if manifest.Version == "" {
+		return nil, fmt.Errorf("%s: no version", cmd.url)
+	}
+	return manifest, nil
+}
+
+// read reads a small response, such as the manifest or its signature
+func (cmd *SelfUpdateCommand) read(u string) ([]byte, error) {
+	r, err := cmd.get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(io.LimitReader(r, 1<<20))
+}
+
+func (cmd *SelfUpdateCommand) get(u string) (io.ReadCloser, error) {
+	res, err := cmd.http.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, notFound(u + ": not found")
+	} else if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s: %s", u, res.Status)
+	}
+	return res.Body, nil
+}
+
+// resolveReleaseURL resolves the URL of a binary relative to the manifest
+func resolveReleaseURL(manifest, binary string) (string, error) {
+	base, err := url.Parse(manifest)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(binary)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// compareVersions compares the release version a with the version b of vc,
+// such as 1.4.0 or v1.5.0-rc.1, and returns -1, 0 or 1 if a is older, the
+// same or newer; pre-releases are older than their release. Development
+// builds, whose version isn't a release version, are older than any release.
+func compareVersions(a, b string) (int, error) {
+	x, ok := parseVersion(a)
+	if !ok {
+		return 0, fmt.Errorf("invalid release version %q", a)
+	}
+	y, ok := parseVersion(b)
+	if !ok {
+		return 1, nil
+	}
+	for i := 0; i < 3; i++ {
+		if x.numbers[i] != y.numbers[i] {
+			return compareInts(x.numbers[i], y.numbers[i]), nil
+		}
+	}
+	switch {
+	case x.pre == y.pre:
+		return 0, nil
+	case x.pre == "":
+		return 1, nil
+	case y.pre == "":
+		return -1, nil
+	}
+	p, q := strings.Split(x.pre, "."), strings.Split(y.pre, ".")
+	for i := 0; i < len(p) && i < len(q); i++ {
+		if p[i] == q[i] {
+			continue
+		}
+		m, errM := strconv.Atoi(p[i])
+		n, errN := strconv.Atoi(q[i])
+		switch {
+		case errM == nil && errN == nil:
+			return compareInts(m, n), nil
+		case errM == nil:
+			// Numeric identifiers are older than alphanumeric ones
+			return -1, nil
+		case errN == nil:
+			return 1, nil
+		case p[i] < q[i]:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+	return compareInts(len(p), len(q)), nil
+}
+
+type releaseVersion struct {
+	numbers [3]int
+	pre     string
+}
+
+// parseVersion parses a release version, <major>[.<minor>[.<patch>]] with an
+// optional v prefix, pre-release after - and build metadata after +
+func parseVersion(s string) (releaseVersion, bool) {
+	var v releaseVersion
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s, v.pre = s[:i], s[i+1:]
+		if v.pre == "" {
+			return v, false
+		}
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.numbers[i] = n
+	}
+	return v, true
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (cmd *SelfUpdateCommand) Synopsis() string {
+	return "replace vc with the latest release"
+}
+
+func SelfUpdateCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &SelfUpdateCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			http: &http.Client{Timeout: 5 * time.Minute},
+		}
+
+		cmd.fs = flag.NewFlagSet("self-update", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.url, "url", "", "release manifest (default from the configuration)")
+		cmd.fs.StringVar(&cmd.publicKey, "key", "", "Ed25519 public key of the manifest, in base64 (default from the configuration)")
+		cmd.fs.BoolVar(&cmd.check, "check", false, "only check for a new release")
+		cmd.fs.BoolVar(&cmd.force, "f", false, "don't ask for confirmation")
+		cmd.fs.BoolVar(&cmd.downgrade, "downgrade", false, "install the release even if it isn't newer")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,172 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestSelfUpdateCommand(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "self-update")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "vc")
+	if err = ioutil.WriteFile(name, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		binary   = []byte("new")
+		sum      = sha256.Sum256(binary)
+		manifest []byte
+	)
+	sign := func(checksum string) {
+		manifest, _ = json.Marshal(releaseManifest{
+			Version: "1.1.0",
+			Binaries: map[string]releaseBinary{
+				runtime.GOOS + "-" + runtime.GOARCH: {URL: "vc-1.1.0", SHA256: checksum},
+			},
+		})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases/latest.json":
+			w.Write(manifest)
+		case "/releases/latest.json.sig":
+			w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, manifest))))
+		case "/releases/vc-1.1.0":
+			w.Write(binary)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	savedVersion := Version
+	defer func() { Version = savedVersion }()
+	Version = "1.0.0"
+
+	run := func(key ed25519.PublicKey, args ...string) (*cli.MockUi, int) {
+		ui := cli.NewMockUi()
+		command, _ := SelfUpdateCommandFactory(ui)()
+		cmd := command.(*SelfUpdateCommand)
+		cmd.executable = name
+		cmd.config = &Config{SelfUpdate: &SelfUpdate{
+			URL:       server.URL + "/releases/latest.json",
+			PublicKey: base64.StdEncoding.EncodeToString(key),
+		}}
+		return ui, cmd.Run(append([]string{"-f"}, args...))
+	}
+	binaryIs := func(want string) {
+		t.Helper()
+		if b, err := ioutil.ReadFile(name); err != nil {
+			t.Fatal(err)
+		} else if string(b) != want {
+			t.Fatalf("expected the binary to be %q, got %q", want, b)
+		}
+	}
+
+	// A manifest signed with another key, or a binary with another checksum,
+	// leave the binary in place
+	sign(hex.EncodeToString(sum[:]))
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	if ui, code := run(other); code == Success || !strings.Contains(ui.ErrorWriter.String(), "invalid signature") {
+		t.Fatalf("expected invalid signature, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	binaryIs("old")
+	sign(strings.Repeat("0", 64))
+	if ui, code := run(public); code == Success || !strings.Contains(ui.ErrorWriter.String(), "checksum") {
+		t.Fatalf("expected checksum mismatch, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	binaryIs("old")
+
+	sign(hex.EncodeToString(sum[:]))
+	if ui, code := run(public, "-check"); code != Success || !strings.Contains(ui.OutputWriter.String(), "1.1.0 is available") {
+		t.Fatalf("expected a release, got %d: %s%s", code, ui.OutputWriter.String(), ui.ErrorWriter.String())
+	}
+	binaryIs("old")
+	ReadOnly = true
+	ui, code := run(public)
+	ReadOnly = false
+	if code != PermissionError || !strings.Contains(ui.ErrorWriter.String(), "read-only mode") {
+		t.Fatalf("expected the update to be refused in read-only mode, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	binaryIs("old")
+	if ui, code := run(public); code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	binaryIs("new")
+	if info, err := os.Stat(name); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0755 {
+		t.Fatalf("expected mode 0755, got %04o", info.Mode().Perm())
+	}
+
+	Version = "1.1.0"
+	if ui, code := run(public); code != Success || !strings.Contains(ui.OutputWriter.String(), "up to date") {
+		t.Fatalf("expected up to date, got %d: %s%s", code, ui.OutputWriter.String(), ui.ErrorWriter.String())
+	}
+
+	// Older releases are only installed with -downgrade
+	if err = ioutil.WriteFile(name, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	Version = "1.2.0"
+	if ui, code := run(public); code != Success || !strings.Contains(ui.ErrorWriter.String(), "older than this 1.2.0") {
+		t.Fatalf("expected the downgrade to be refused, got %d: %s%s", code, ui.OutputWriter.String(), ui.ErrorWriter.String())
+	}
+	binaryIs("old")
+	if ui, code := run(public, "-downgrade"); code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	binaryIs("new")
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.4.0", "1.3.2", 1},
+		{"1.3.2", "1.4.0", -1},
+		{"v1.4.0", "1.4.0", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.4", "1.4.0", 0},
+		{"1.4.0", "1.4.0-rc.1", 1},
+		{"1.4.0-rc.1", "1.4.0", -1},
+		{"1.4.0-rc.2", "1.4.0-rc.10", -1},
+		{"1.4.0-beta", "1.4.0-alpha", 1},
+		{"1.4.0-rc.1", "1.4.0-rc", 1},
+		{"1.4.0+build.5", "1.4.0", 0},
+		{"1.0.0", "(development build)", 1},
+	}
+	for _, test := range tests {
+		if got, err := compareVersions(test.a, test.b); err != nil || got != test.want {
+			t.Errorf("%s vs %s: expected %d, got %d (%v)", test.a, test.b, test.want, got, err)
+		}
+	}
+	for _, version := range []string{"", "latest", "1.x", "1.2.3.4", "1.2.3-"} {
+		if _, err := compareVersions(version, "1.0.0"); err == nil {
+			t.Errorf("%q: expected an invalid version", version)
+		}
+	}
+}
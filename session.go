@@ -0,0 +1,375 @@
+package vc
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// sessionFile keeps the state of the sessions, by Vault cluster, see
+// sessionState
+var sessionFile = os.ExpandEnv("$HOME/.vc-sessions")
+
+// errSessionLocked is returned by Client when the session is locked
+var errSessionLocked = errors.New("session is locked, unlock it with vc unlock")
+
+// sessionState is the state of the stored token of a Vault cluster
+type sessionState struct {
+	// LastUsed is when the stored token was last used
+	LastUsed time.Time `json:"last_used"`
+
+	// Locked is set when the stored token is sealed with the security key and
+	// the store key was removed from the session, see lockSession
+	Locked bool `json:"locked,omitempty"`
+
+	// Expires is when Vault expires the stored token, once its TTL was
+	// limited to the idle timeout, see limitTokenTTL
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// sessionKey returns the key of the session of the selected Vault cluster
+func (cmd *baseCommand) sessionKey() (string, error) {
+	p, err := cmd.profile()
+	if err != nil {
+		return "", err
+	}
+	if p != nil {
+		return tokenKey(p.Address, p.Namespace), nil
+	}
+	return "default", nil
+}
+
+// idleTimeout returns the idle timeout of the selected profile, or of the
+// configuration file
+func (cmd *baseCommand) idleTimeout() (time.Duration, error) {
+	config, err := cmd.Config()
+	if err != nil {
+		return 0, err
+	}
+	p, err := cmd.profile()
+	if err != nil {
+		return 0, err
+	}
+	if p != nil && p.IdleTimeout > 0 {
+		return p.IdleTimeout, nil
+	}
+	return config.IdleTimeout, nil
+}
+
+func loadSessions() (map[string]*sessionState, error) {
+	sessions := make(map[string]*sessionState)
+	b, err := ioutil.ReadFile(sessionFile)
+	if os.IsNotExist(err) {
+		return sessions, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("session: %v", err)
+	}
+	if err = json.Unmarshal(b, &sessions); err != nil {
+		return nil, fmt.Errorf("session: %s: %v", sessionFile, err)
+	}
+	return sessions, nil
+}
+
+func saveSessions(sessions map[string]*sessionState) error {
+	if DryRun {
+		return nil
+	}
+	if len(sessions) == 0 {
+		if err := os.Remove(sessionFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+	w := SafeOutputWriter(sessionFile, 0600)
+	if _, err = w.Write(append(b, '\n')); err != nil {
+		w.(*safeOutputWriter).abort()
+		return err
+	}
+	return w.Close()
+}
+
+// checkSession is called before the stored token is used: locked sessions
+// fail, and sessions that were idle for longer than the idle timeout are
+// locked, see lockSession
+func (cmd *baseCommand) checkSession() error {
+	key, err := cmd.sessionKey()
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.idleTimeout()
+	if err != nil {
+		return err
+	}
+	sessions, err := loadSessions()
+	if err != nil {
+		return err
+	}
+	s := sessions[key]
+	if s != nil && s.Locked {
+		return errSessionLocked
+	}
+	if timeout <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if s != nil && now.Sub(s.LastUsed) > timeout {
+		Debugf("session: idle since %s", s.LastUsed.Format(time.RFC3339))
+		if err = cmd.lockSession(sessions, key); err != nil {
+			return err
+		}
+		return fmt.Errorf("session was idle for more than %s and is locked", timeout)
+	}
+	if s == nil {
+		s = new(sessionState)
+		sessions[key] = s
+	}
+	s.LastUsed = now
+	return saveSessions(sessions)
+}
+
+// limitTokenTTL limits the TTL of the stored token to the idle timeout, so
+// Vault expires it when the session is idle, also for other programs that use
+// a plaintext token store such as ~/.vault-token; vc can only lock the session
+// when it runs. Tokens sealed with a security key, tokens that aren't
+// renewable, and tokens that expire before the idle timeout are left as-is.
+// Once limited, the token is renewed with the idle timeout on every use.
+func (cmd *baseCommand) limitTokenTTL() {
+	if Offline {
+		return
+	}
+	config, err := cmd.Config()
+	if err != nil {
+		return
+	}
+	if config.SecurityKey != nil && config.TokenHelper == "" {
+		return
+	}
+	timeout, err := cmd.idleTimeout()
+	if err != nil || timeout <= 0 {
+		return
+	}
+	key, err := cmd.sessionKey()
+	if err != nil {
+		return
+	}
+	sessions, err := loadSessions()
+	if err != nil {
+		return
+	}
+	s := sessions[key]
+	if s == nil || s.Locked {
+		return
+	}
+
+	if s.Expires.IsZero() {
+		secret, err := cmd.c.Auth().Token().LookupSelf()
+		if err != nil {
+			Debugf("session: token lookup failed: %v", err)
+			return
+		}
+		renewable, _ := secret.TokenIsRenewable()
+		ttl, _ := secret.TokenTTL()
+		if !renewable || (ttl > 0 && ttl <= timeout) {
+			return
+		}
+	}
+	secret, err := cmd.c.Auth().Token().RenewSelf(int(timeout / time.Second))
+	if err != nil {
+		Debugf("session: limiting the token TTL failed: %v", err)
+		return
+	}
+	ttl, _ := secret.TokenTTL()
+	Debugf("session: token expires in %s", ttl)
+	s.Expires = time.Now().Add(ttl)
+	if err = saveSessions(sessions); err != nil {
+		Debugf("session: %v", err)
+	}
+}
+
+// lockSession locks the session: with a security key, the stored token is
+// sealed and the store key is removed from the session, so using the token
+// again requires vc unlock; otherwise, the stored token is wiped, and vc login
+// is required
+func (cmd *baseCommand) lockSession(sessions map[string]*sessionState, key string) error {
+	config, err := cmd.Config()
+	if err != nil {
+		return err
+	}
+	store, err := cmd.tokenStore()
+	if err != nil {
+		return err
+	}
+
+	if config.SecurityKey == nil || config.TokenHelper != "" {
+		Debugf("session: erasing token in %s", store)
+		if !DryRun {
+			if err = store.Erase(); err != nil {
+				return err
+			}
+		}
+		delete(sessions, key)
+		return saveSessions(sessions)
+	}
+
+	// Tokens stored before the security key was configured are sealed now
+	token, err := store.Token()
+	if err != nil {
+		return err
+	}
+	if token != "" && !DryRun {
+		if err = store.Store(token); err != nil {
+			return err
+		}
+	}
+	if err = forgetStoreKey(config.SecurityKey); err != nil {
+		return err
+	}
+	sessions[key] = &sessionState{LastUsed: time.Now(), Locked: true}
+	return saveSessions(sessions)
+}
+
+// unlockSession marks the session as used, and no longer locked
+func (cmd *baseCommand) unlockSession() error {
+	key, err := cmd.sessionKey()
+	if err != nil {
+		return err
+	}
+	sessions, err := loadSessions()
+	if err != nil {
+		return err
+	}
+	sessions[key] = &sessionState{LastUsed: time.Now()}
+	return saveSessions(sessions)
+}
+
+// LockCommand locks or unlocks the session
+type LockCommand struct {
+	baseCommand
+	fs   *flag.FlagSet
+	lock bool
+}
+
+func (cmd *LockCommand) Help() string {
+	if !cmd.lock {
+		return `Usage: vc unlock
+
+Unlock the session that was locked by vc lock, or after the idle timeout: the
+security key is touched to decrypt the store key, and the stored token can be
+used again. Sessions without a security key are not locked, their token is
+wiped; use vc login.
+
+Options:
+` + defaults(cmd.fs)
+	}
+	return `Usage: vc lock
+
+Lock the session, as the idle timeout does: with a security key (see
+security_key in the configuration file), the stored token is sealed and the
+store key is removed from the session, until vc unlock. Without, the stored
+token is wiped, until vc login.
+
+vc checks the idle timeout when it runs. Without a security key, the stored
+token is kept in plaintext until then, for example in ~/.vault-token, where
+other programs can use it; vc limits the TTL of renewable tokens to the idle
+timeout, so Vault expires them when the session is idle.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *LockCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) != 0 {
+		return Help
+	}
+
+	config, err := cmd.Config()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	key, err := cmd.sessionKey()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	sessions, err := loadSessions()
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+
+	if cmd.lock {
+		if s := sessions[key]; s != nil && s.Locked {
+			cmd.ui.Info("session is locked")
+			return Success
+		}
+		if err = cmd.lockSession(sessions, key); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+		if config.SecurityKey == nil || config.TokenHelper != "" {
+			cmd.ui.Info("session is locked, the token was wiped")
+		} else {
+			cmd.ui.Info("session is locked")
+		}
+		return Success
+	}
+
+	if s := sessions[key]; s == nil || !s.Locked {
+		cmd.ui.Info("session is not locked")
+		return Success
+	}
+	if _, err = loadStoreKey(config.SecurityKey); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return PermissionError
+	}
+	if err = cmd.unlockSession(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	cmd.ui.Info("session is unlocked")
+	return Success
+}
+
+func (cmd *LockCommand) Synopsis() string {
+	if !cmd.lock {
+		return "unlock the session"
+	}
+	return "lock the session, sealing or wiping the stored token"
+}
+
+func LockCommandFactory(ui cli.Ui, lock bool) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &LockCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			lock: lock,
+		}
+
+		name := "unlock"
+		if lock {
+			name = "lock"
+		}
+		cmd.fs = flag.NewFlagSet(name, flag.ContinueOnError)
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,194 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestSessionIdleTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "session")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	saved, savedFiles, savedName := sessionFile, tokenFiles, ProfileName
+	defer func() { sessionFile, tokenFiles, ProfileName = saved, savedFiles, savedName }()
+	sessionFile = filepath.Join(dir, "sessions")
+	tokenFiles = []string{filepath.Join(dir, "token")}
+	ProfileName = ""
+
+	cmd := &baseCommand{config: &Config{IdleTimeout: time.Hour}}
+	if err = (fileTokenStore{names: tokenFiles}).Store("s.test"); err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.checkSession(); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := loadSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := sessions["default"]; s == nil || time.Since(s.LastUsed) > time.Minute {
+		t.Fatalf("expected session to be used, got %+v", s)
+	}
+
+	// After the idle timeout, the token is wiped
+	sessions["default"].LastUsed = time.Now().Add(-2 * time.Hour)
+	if err = saveSessions(sessions); err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.checkSession(); err == nil {
+		t.Fatal("expected error after the idle timeout")
+	}
+	if _, err = os.Stat(tokenFiles[0]); !os.IsNotExist(err) {
+		t.Fatalf("expected token to be wiped, got %v", err)
+	}
+}
+
+func TestLimitTokenTTL(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "session")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	saved, savedName := sessionFile, ProfileName
+	defer func() { sessionFile, ProfileName = saved, savedName }()
+	sessionFile = filepath.Join(dir, "sessions")
+	ProfileName = ""
+
+	var lookups, renewals []string
+	ttl := 768 * 3600
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/token/lookup-self":
+			lookups = append(lookups, r.Method)
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"ttl": ttl, "renewable": true}})
+		case "/v1/auth/token/renew-self":
+			var body struct {
+				Increment json.Number `json:"increment"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			renewals = append(renewals, body.Increment.String())
+			json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.test", "lease_duration": 3600, "renewable": true}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}), nil)
+
+	cmd := &baseCommand{c: c, config: &Config{IdleTimeout: time.Hour}}
+	if err = cmd.checkSession(); err != nil {
+		t.Fatal(err)
+	}
+	cmd.limitTokenTTL()
+	if len(lookups) != 1 || len(renewals) != 1 || renewals[0] != "3600" {
+		t.Fatalf("expected a lookup and a renewal by 3600, got %q, %q", lookups, renewals)
+	}
+	sessions, err := loadSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := sessions["default"]; s == nil || time.Until(s.Expires) < 59*time.Minute {
+		t.Fatalf("expected the token to expire in an hour, got %+v", s)
+	}
+
+	// Limited tokens are renewed on every use, without a lookup
+	if err = cmd.checkSession(); err != nil {
+		t.Fatal(err)
+	}
+	cmd.limitTokenTTL()
+	if len(lookups) != 1 || len(renewals) != 2 {
+		t.Fatalf("expected a renewal without lookup, got %q, %q", lookups, renewals)
+	}
+
+	// Tokens that expire before the idle timeout are left as-is
+	if err = os.Remove(sessionFile); err != nil {
+		t.Fatal(err)
+	}
+	ttl = 600
+	if err = cmd.checkSession(); err != nil {
+		t.Fatal(err)
+	}
+	cmd.limitTokenTTL()
+	if len(lookups) != 2 || len(renewals) != 2 {
+		t.Fatalf("expected a lookup only, got %q, %q", lookups, renewals)
+	}
+
+	// Sealed tokens are left as-is
+	cmd.config.SecurityKey = &SecurityKey{Identity: "yubikey.txt"}
+	cmd.limitTokenTTL()
+	if len(lookups) != 2 || len(renewals) != 2 {
+		t.Fatalf("expected no requests, got %q, %q", lookups, renewals)
+	}
+}
+
+func TestLockCommand(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "session")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake age that "encrypts" by copying stdin
+	script := filepath.Join(dir, "age")
+	if err = ioutil.WriteFile(script, []byte("#!/bin/sh\ncat\n"), 0755); err != nil {
+		t.Skip(err)
+	}
+	saved, savedFiles, savedName, savedAge, savedRuntime := sessionFile, tokenFiles, ProfileName, ageCommand, os.Getenv("XDG_RUNTIME_DIR")
+	defer func() {
+		sessionFile, tokenFiles, ProfileName, ageCommand = saved, savedFiles, savedName, savedAge
+		os.Setenv("XDG_RUNTIME_DIR", savedRuntime)
+		storeKeys = make(map[string]*storeKey)
+	}()
+	sessionFile = filepath.Join(dir, "sessions")
+	tokenFiles = []string{filepath.Join(dir, "token")}
+	ProfileName = ""
+	ageCommand = script
+	os.Setenv("XDG_RUNTIME_DIR", filepath.Join(dir, "run"))
+
+	config := &Config{SecurityKey: &SecurityKey{Identity: "yubikey.txt", Recipient: "age1yubikey1test", KeyFile: filepath.Join(dir, "store.key.age")}}
+	if err = ioutil.WriteFile(tokenFiles[0], []byte("s.plain"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	run := func(lock bool) {
+		t.Helper()
+		ui := cli.NewMockUi()
+		command, _ := LockCommandFactory(ui, lock)()
+		command.(*LockCommand).config = config
+		if code := command.Run(nil); code != Success {
+			t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+		}
+	}
+
+	run(true)
+	if b, _ := ioutil.ReadFile(tokenFiles[0]); string(b[:len(sealedPrefix)]) != sealedPrefix {
+		t.Fatalf("expected sealed token, got %q", b)
+	}
+	if _, err = os.Stat(sessionKeyFile(config.SecurityKey.keyFile())); !os.IsNotExist(err) {
+		t.Fatalf("expected no store key in the session, got %v", err)
+	}
+	cmd := &baseCommand{config: config}
+	if err = cmd.checkSession(); err != errSessionLocked {
+		t.Fatalf("expected %v, got %v", errSessionLocked, err)
+	}
+
+	run(false)
+	if err = cmd.checkSession(); err != nil {
+		t.Fatal(err)
+	}
+	store, err := cmd.tokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := store.Token(); err != nil || token != "s.plain" {
+		t.Fatalf("expected token s.plain, got %q, %v", token, err)
+	}
+}
@@ -1,6 +1,7 @@
 package vc
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -15,6 +16,10 @@ import (
 // ShellHistoryFile is the file where readline history is recorded
 const ShellHistoryFile = "$HOME/.vc_history"
 
+// shellClient is the client of a running shell, it's used by the commands run
+// in the shell so they don't authenticate again
+var shellClient *Client
+
 const banner = `
       ,--.!,
    __/   -*-   	                 _               _
@@ -42,7 +47,16 @@ type ShellCommand struct {
 }
 
 func (cmd *ShellCommand) Help() string {
-	return "vc [<options>] shell"
+	return `Usage: vc shell [<options>] [<secret path>]
+
+Start an interactive shell at the secret path (default: the working path). The
+commands of vc can be used without the vc prefix, they share the connection and
+token of the shell, and relative secret paths are resolved against the current
+path, which is changed with cd. Paths are completed with tab, and the history is
+kept in ~/.vc_history.
+
+Options:
+` + defaults(cmd.fs)
 }
 
 func (cmd *ShellCommand) Synopsis() string {
@@ -50,20 +64,28 @@ func (cmd *ShellCommand) Synopsis() string {
 }
 
 func (cmd *ShellCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.fs.Args(); len(args) > 1 {
+		return Help
+	}
+
 	client, err := cmd.Client()
 	if err != nil {
 		cmd.ui.Error(err.Error())
 		return 1
 	}
+	if client.Path == "" {
+		client.Path = "/"
+	}
 
 	if len(args) > 0 {
 		if strings.HasPrefix(args[0], "/") {
-			client.Path = client.abspath(args[0])
+			client.Path = client.Abs(args[0])
 		} else {
-			client.Path = client.abspath("/" + args[0])
+			client.Path = client.Abs("/" + args[0])
 		}
-	} else {
-		client.Path = "/"
 	}
 
 	secret, err := client.Auth().Token().LookupSelf()
@@ -71,14 +93,31 @@ func (cmd *ShellCommand) Run(args []string) int {
 		cmd.ui.Error(err.Error())
 		return 1
 	}
+	if secret == nil {
+		cmd.ui.Error("error: token lookup returned no data")
+		return ServerError
+	}
 	if _, ok := secret.Data["id"].(string); ok {
 		delete(secret.Data, "id")
 	}
 	Debugf("client: token: %+v", secret.Data)
-	if cmd.user = secret.Data["display_name"].(string); cmd.user == "" {
+	if cmd.user, _ = secret.Data["display_name"].(string); cmd.user == "" {
 		cmd.user = "?"
 	}
 
+	// Commands run in the shell use its client, and resolve relative paths
+	// against its current path
+	shellClient = client
+	defer func(wd string) {
+		shellClient = nil
+		os.Setenv(WorkingPathEnv, wd)
+	}(os.Getenv(WorkingPathEnv))
+	os.Setenv(WorkingPathEnv, client.Path)
+
+	var commands []readline.PrefixCompleterInterface
+	for _, name := range shellCompletedCommands {
+		commands = append(commands, readline.PcItem(name))
+	}
 	completer := readline.NewPrefixCompleter(
 		readline.PcItem("mode",
 			readline.PcItem("vi"),
@@ -87,6 +126,9 @@ func (cmd *ShellCommand) Run(args []string) int {
 		readline.PcItem("cd",
 			readline.PcItemDynamic(client.Complete(isDir)),
 		),
+		readline.PcItem("cat",
+			readline.PcItemDynamic(client.Complete(isAny)),
+		),
 		readline.PcItem("cp",
 			readline.PcItemDynamic(client.Complete(isAny),
 				readline.PcItemDynamic(client.Complete(isAny)),
@@ -95,14 +137,27 @@ func (cmd *ShellCommand) Run(args []string) int {
 		readline.PcItem("edit",
 			readline.PcItemDynamic(client.Complete(isAny)),
 		),
+		readline.PcItem("history",
+			readline.PcItemDynamic(client.Complete(isAny)),
+		),
 		readline.PcItem("ls",
 			readline.PcItemDynamic(client.Complete(isAny)),
 		),
+		readline.PcItem("mv",
+			readline.PcItemDynamic(client.Complete(isAny),
+				readline.PcItemDynamic(client.Complete(isAny)),
+			),
+		),
+		readline.PcItem("rm",
+			readline.PcItemDynamic(client.Complete(isAny)),
+		),
+		readline.PcItem("write",
+			readline.PcItemDynamic(client.Complete(isAny)),
+		),
 		readline.PcItem("pwd"),
-		readline.PcItem("setprompt"),
 		readline.PcItem("bye"),
 		readline.PcItem("exit"),
-		readline.PcItem("help"),
+		readline.PcItem("help", commands...),
 	)
 
 	l, err := readline.NewEx(&readline.Config{
@@ -142,10 +197,10 @@ func (cmd *ShellCommand) Run(args []string) int {
 		case line == "help" || strings.HasPrefix(line, "help "):
 			cmd.runHelp(strings.TrimSpace(line[4:]))
 		case line == "cd":
-			client.Path = "/"
+			cmd.chdir("/")
 			l.SetPrompt(cmd.prompt())
 		case strings.HasPrefix(line, "cd "):
-			client.Path = client.abspath(line[3:])
+			cmd.chdir(strings.TrimSpace(line[3:]))
 			l.SetPrompt(cmd.prompt())
 		case line == "pwd":
 			cmd.ui.Output(client.Path)
@@ -176,6 +231,20 @@ exit:
 	return 0
 }
 
+// chdir changes the current path of the shell, if path is a directory
+func (cmd *ShellCommand) chdir(path string) {
+	path = cmd.c.Abs(cmd.resolve(path))
+	if info, err := cmd.c.Stat(path); err == nil && !info.IsDir() {
+		cmd.ui.Error(fmt.Sprintf("cd: %s: not a directory", path))
+		return
+	} else if err != nil && os.IsNotExist(err) {
+		cmd.ui.Error(fmt.Sprintf("cd: %s: not found", path))
+		return
+	}
+	cmd.c.Path = path
+	os.Setenv(WorkingPathEnv, path)
+}
+
 func (cmd *ShellCommand) prompt() string {
 	cmd.host = "vault"
 	if !cmd.hostInfoProblematic {
@@ -193,36 +262,95 @@ func (cmd *ShellCommand) prompt() string {
 		cmd.user, cmd.host, cmd.c.Path)
 }
 
-func (cmd *ShellCommand) expandArgs(args []string) string {
+func (cmd *ShellCommand) expandArgs(args []string) []string {
 	for i, arg := range args {
 		if !strings.HasPrefix(arg, "-") {
-			args[i] = cmd.c.abspath(arg)
+			args[i] = cmd.c.Abs(cmd.resolve(arg))
+		}
+	}
+	return args
+}
+
+// shellFields splits a command line into arguments; single and double quotes
+// group words, and a backslash escapes the next character
+func shellFields(line string) ([]string, error) {
+	var (
+		fields []string
+		field  []rune
+		quote  rune
+		inside bool
+		escape bool
+	)
+	for _, c := range line {
+		switch {
+		case escape:
+			field, escape = append(field, c), false
+		case c == '\\' && quote != '\'':
+			escape, inside = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				field = append(field, c)
+			}
+		case c == '\'' || c == '"':
+			quote, inside = c, true
+		case c == ' ' || c == '\t':
+			if inside {
+				fields, field, inside = append(fields, string(field)), nil, false
+			}
+		default:
+			field, inside = append(field, c), true
 		}
 	}
-	return strings.Join(args, " ")
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	} else if escape {
+		return nil, errors.New("trailing backslash")
+	}
+	if inside {
+		fields = append(fields, string(field))
+	}
+	return fields, nil
 }
 
 var (
 	commandsWithPathArgs = map[string]int{
-		"cat": -1,
-		"cd":  1,
-		"cp":  2,
-		"ls":  -1,
-		"mv":  2,
-		"rm":  1,
+		"cat":     -1,
+		"cd":      1,
+		"cp":      2,
+		"edit":    1,
+		"history": 1,
+		"ls":      -1,
+		"mv":      2,
+		"rm":      1,
 	}
 	commandsWithDefaultPath = map[string]bool{
 		"cat": true,
 		"ls":  true,
 	}
+
+	// shellCompletedCommands are completed after help
+	shellCompletedCommands = []string{"cat", "cp", "edit", "generate", "history", "ls", "mv", "rm", "write"}
 )
 
-func (cmd *ShellCommand) runCommand(line string) {
+// runCommand runs a command line in the shell, and returns its exit code
+func (cmd *ShellCommand) runCommand(line string) int {
 	// Commands that take a path argument; we need to turn relative paths into
 	// absolute paths based on our current working directory.
-	args := strings.Fields(strings.TrimSpace(line))
+	args, err := shellFields(line)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	} else if len(args) > 0 && args[0] == "vc" {
+		// Allow commands copied from elsewhere
+		args = args[1:]
+	}
 	if len(args) == 0 {
-		return
+		return Success
+	} else if args[0] == "shell" {
+		cmd.ui.Error("error: already in a shell")
+		return SyntaxError
 	}
 
 	// Expand commands with path arguments, relative paths need to be resolved
@@ -234,28 +362,28 @@ func (cmd *ShellCommand) runCommand(line string) {
 			// working directory as a default argument.
 			if commandsWithDefaultPath[args[0]] {
 				Debugf("args[0]=%q; with default path", args[0])
-				line = args[0] + " " + cmd.c.Path
+				args = append(args, cmd.c.Path)
 			} else {
 				Debugf("args[0]=%q; no default path", args[0])
-				line = args[0]
 			}
 		} else {
 			// Expand path arguments
 			Debugf("args[0]=%q; with path args %+v", args[0], args[1:])
-			line = args[0] + " " + cmd.expandArgs(args[1:])
+			args = append(args[:1], cmd.expandArgs(args[1:])...)
 		}
 	} else {
 		Debugf("args[0]=%q; no path args", args[0])
 	}
 
-	Debugf("command: %q", line)
-	code, err := DefaultApp(cmd.ui, strings.Fields(line)).Run()
+	Debugf("command: %q", args)
+	code, err := DefaultApp(cmd.ui, args).Run()
 	if err != nil {
 		cmd.ui.Error(err.Error())
 	}
 	if code != 0 {
 		Debugf("return code %d", code)
 	}
+	return code
 }
 
 func (cmd *ShellCommand) runHelp(line string) {
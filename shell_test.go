@@ -0,0 +1,93 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestShellFields(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  ls  -l  app ", []string{"ls", "-l", "app"}},
+		{`write db "note=hello world"`, []string{"write", "db", "note=hello world"}},
+		{`write db note='say "hi"'`, []string{"write", "db", `note=say "hi"`}},
+		{`write db a\ b=c ""`, []string{"write", "db", "a b=c", ""}},
+	} {
+		got, err := shellFields(test.line)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: expected %q, got %q", test.line, test.want, got)
+		}
+	}
+	for _, line := range []string{`cat "app`, `cat app\`} {
+		if _, err := shellFields(line); err == nil {
+			t.Errorf("%q: expected error", line)
+		}
+	}
+}
+
+func TestShellRunCommand(t *testing.T) {
+	var written map[string]interface{}
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		request := r.Method + " " + r.URL.Path
+		if r.URL.Query().Get("list") == "true" {
+			request = "LIST " + r.URL.Path
+		}
+		switch request {
+		case "LIST /v1/secret/app":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"db"}}}
+		case "GET /v1/secret/app/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "secret"}}
+		case "PUT /v1/secret/app/api":
+			json.NewDecoder(r.Body).Decode(&written)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+	c.Path = "/"
+
+	defer os.Setenv(WorkingPathEnv, os.Getenv(WorkingPathEnv))
+	shellClient = c
+	defer func() { shellClient = nil }()
+
+	ui := cli.NewMockUi()
+	command, _ := ShellCommandFactory(ui)()
+	cmd := command.(*ShellCommand)
+	cmd.c, cmd.config = c, new(Config)
+
+	cmd.chdir("secret/app/db")
+	if c.Path != "/" {
+		t.Fatalf("expected cd to a secret to fail, path is %s", c.Path)
+	}
+	cmd.chdir("secret/app")
+	if c.Path != "/secret/app" || os.Getenv(WorkingPathEnv) != "/secret/app" {
+		t.Fatalf("expected path /secret/app, got %s", c.Path)
+	}
+
+	// The command uses the client of the shell, and resolves paths against
+	// the current path
+	if code := cmd.runCommand(`vc write api "note=hello world"`); code != Success {
+		t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if written["note"] != "hello world" {
+		t.Fatalf("expected note to be written, got %+v", written)
+	}
+	if code := cmd.runCommand("shell"); code != SyntaxError {
+		t.Fatalf("expected nested shell to fail, got %d", code)
+	}
+}
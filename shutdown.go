@@ -0,0 +1,134 @@
+package vc
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultDrainTimeout is how long a command may run after SIGTERM
+const DefaultDrainTimeout = 30 * time.Second
+
+// DrainTimeout is how long a command may run after SIGTERM, see
+// RunWithShutdown
+var DrainTimeout = DefaultDrainTimeout
+
+// shutdown coordinates the shutdown on SIGTERM
+var shutdown = struct {
+	sync.Mutex
+	stop    chan struct{}
+	writers map[*safeOutputWriter]bool
+	leases  map[string]*Client
+}{
+	stop:    make(chan struct{}),
+	writers: make(map[*safeOutputWriter]bool),
+	leases:  make(map[string]*Client),
+}
+
+// RunWithShutdown runs the command run. On SIGTERM, commands stop accepting
+// new work (see shuttingDown), and run may finish what it is doing for the
+// DrainTimeout. If it doesn't, the output files that were not committed are
+// removed, the leases of secrets that were read for them are revoked, and
+// 128+SIGTERM is returned; a second SIGTERM skips the drain.
+func RunWithShutdown(run func() int) int {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	done := make(chan int, 1)
+	go func() {
+		done <- run()
+	}()
+
+	select {
+	case code := <-done:
+		return code
+	case <-signals:
+	}
+	Debugf("shutdown: draining for %s", DrainTimeout)
+	close(shutdown.stop)
+
+	select {
+	case code := <-done:
+		return code
+	case <-time.After(DrainTimeout):
+		fmt.Fprintf(os.Stderr, "warning: shutdown: still running after %s, aborting\n", DrainTimeout)
+	case <-signals:
+		fmt.Fprintln(os.Stderr, "warning: shutdown: aborting")
+	}
+	abortOperations()
+	return 128 + int(syscall.SIGTERM)
+}
+
+// shuttingDown returns a channel that is closed on SIGTERM; commands that
+// process a series of items (or requests) stop taking new ones
+func shuttingDown() <-chan struct{} {
+	return shutdown.stop
+}
+
+// stopping checks if a shutdown is in progress
+func stopping() bool {
+	select {
+	case <-shutdown.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// trackWriter registers an output file that is not committed yet
+func trackWriter(w *safeOutputWriter) {
+	shutdown.Lock()
+	defer shutdown.Unlock()
+	shutdown.writers[w] = true
+}
+
+// untrackWriter unregisters an output file that was committed or aborted
+func untrackWriter(w *safeOutputWriter) {
+	shutdown.Lock()
+	defer shutdown.Unlock()
+	delete(shutdown.writers, w)
+}
+
+// trackLease registers the lease of a secret that was read for output that is
+// not written yet, see releaseLeases
+func trackLease(c *Client, leaseID string) {
+	if leaseID == "" {
+		return
+	}
+	shutdown.Lock()
+	defer shutdown.Unlock()
+	shutdown.leases[leaseID] = c
+}
+
+// releaseLeases unregisters the tracked leases, once the secrets are written
+func releaseLeases() {
+	shutdown.Lock()
+	defer shutdown.Unlock()
+	shutdown.leases = make(map[string]*Client)
+}
+
+// abortOperations removes the output files that were not committed, and
+// revokes the tracked leases, as the secrets were never written
+func abortOperations() {
+	shutdown.Lock()
+	writers, leases := shutdown.writers, shutdown.leases
+	shutdown.writers = make(map[*safeOutputWriter]bool)
+	shutdown.leases = make(map[string]*Client)
+	shutdown.Unlock()
+
+	for w := range writers {
+		Debugf("shutdown: removing uncommitted %s", w.Name())
+		w.Abort()
+	}
+	for leaseID, c := range leases {
+		if err := c.Sys().Revoke(leaseID); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: shutdown: revoke %s: %v\n", leaseID, err)
+		} else {
+			Debugf("shutdown: revoked %s", leaseID)
+		}
+	}
+}
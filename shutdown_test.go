@@ -0,0 +1,47 @@
+package vc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunWithShutdown(t *testing.T) {
+	defer func(saved time.Duration) { DrainTimeout = saved }(DrainTimeout)
+	DrainTimeout = 100 * time.Millisecond
+	defer func() { shutdown.stop = make(chan struct{}) }()
+
+	// The command finishes its work
+	shutdown.stop = make(chan struct{})
+	code := RunWithShutdown(func() int {
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		<-shuttingDown()
+		return SyntaxError
+	})
+	if code != SyntaxError {
+		t.Fatalf("expected exit code %d, got %d", SyntaxError, code)
+	}
+
+	// The command doesn't finish in time, its output is removed
+	dir, err := ioutil.TempDir(os.TempDir(), "shutdown")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	shutdown.stop = make(chan struct{})
+	code = RunWithShutdown(func() int {
+		w := SafeOutputWriter(filepath.Join(dir, "out"), 0600)
+		w.Write([]byte("partial"))
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		select {}
+	})
+	if code != 128+int(syscall.SIGTERM) {
+		t.Fatalf("expected exit code %d, got %d", 128+int(syscall.SIGTERM), code)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("expected temporary file to be removed, got %d files", len(files))
+	}
+}
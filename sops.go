@@ -0,0 +1,250 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// sopsCommand is the sops binary
+var sopsCommand = "sops"
+
+// sopsFormat returns the format for output name: json, dotenv or yaml
+func sopsFormat(name string) string {
+	switch filepath.Ext(name) {
+	case ".json":
+		return "json"
+	case ".env":
+		return "dotenv"
+	}
+	return "yaml"
+}
+
+// sopsDocument merges the keys of secrets into a document in format, see
+// encodeDocument; keys can't be in more than one secret
+func sopsDocument(paths []string, secrets []map[string]interface{}, format string) ([]byte, error) {
+	var (
+		data   = make(map[string]interface{})
+		origin = make(map[string]string)
+	)
+	for i, secret := range secrets {
+		for key, value := range secret {
+			if key == CodecTypeKey {
+				continue
+			}
+			if other, exists := origin[key]; exists {
+				return nil, fmt.Errorf("key %s is in both %s and %s", key, other, paths[i])
+			}
+			origin[key] = paths[i]
+			data[key] = value
+		}
+	}
+	return encodeDocument(data, format)
+}
+
+// encodeDocument encodes data as a json, yaml or dotenv document; values keep
+// their type, except for dotenv which only has strings
+func encodeDocument(data map[string]interface{}, format string) ([]byte, error) {
+	// Normalize numbers returned by Vault
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "json":
+		return json.MarshalIndent(doc, "", "  ")
+	case "yaml":
+		return yaml.Marshal(doc)
+	case "dotenv":
+		keys := make([]string, 0, len(doc))
+		for key := range doc {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var buf bytes.Buffer
+		for _, key := range keys {
+			value, ok := doc[key].(string)
+			if !ok {
+				b, _ := json.Marshal(doc[key])
+				value = string(b)
+			}
+			if strings.ContainsAny(value, "\n") {
+				return nil, fmt.Errorf("key %s: dotenv values can't contain newlines", key)
+			}
+			fmt.Fprintf(&buf, "%s=%s\n", key, value)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// SopsCommand writes secrets as SOPS encrypted files
+type SopsCommand struct {
+	baseCommand
+	fs     *flag.FlagSet
+	format string
+	age    stringsValue
+	kms    stringsValue
+	pgp    stringsValue
+	mod    string
+}
+
+func (cmd *SopsCommand) Help() string {
+	return `Usage: vc sops [<options>] <secret path> [... <secret path>]
+
+Writes the keys of the secrets as a SOPS encrypted YAML, JSON or dotenv file,
+using the sops binary. The data key is encrypted for the given age recipients,
+AWS KMS keys or PGP fingerprints; if none are given, the creation rules in
+.sops.yaml for the output file are used.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *SopsCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) == 0 {
+		return Help
+	}
+	if mode, err := strconv.ParseInt(cmd.mod, 8, 32); err != nil {
+		cmd.ui.Error("error: invalid mode: " + err.Error())
+		return SyntaxError
+	} else {
+		cmd.mode = os.FileMode(mode)
+	}
+	if cmd.format == "" {
+		cmd.format = sopsFormat(cmd.out)
+	}
+	if len(cmd.age)+len(cmd.kms)+len(cmd.pgp) == 0 && (cmd.out == "" || cmd.out == "-") {
+		cmd.ui.Error("error: no recipients; use -age, -kms or -pgp, or -o to use the creation rules in .sops.yaml")
+		return SyntaxError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	if args, err = client.expand(args, isSecret); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SyntaxError)
+	}
+
+	var secrets []map[string]interface{}
+	for _, path := range args {
+		secret, err := cmd.readSource(path, client.ReadSecret)
+		if err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, ServerError)
+		}
+		if secret == nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: secret not found", path))
+			return NotFoundError
+		}
+		secrets = append(secrets, secret.Data)
+	}
+
+	doc, err := sopsDocument(args, secrets, cmd.format)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	encrypted, err := cmd.encrypt(doc)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+
+	if _, err = cmd.Write(encrypted); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if err = cmd.Close(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	return Success
+}
+
+// sopsArgs returns the arguments for sops to encrypt a document from stdin
+func (cmd *SopsCommand) sopsArgs() []string {
+	args := []string{"--encrypt", "--input-type", cmd.format, "--output-type", cmd.format}
+	if len(cmd.age) > 0 {
+		args = append(args, "--age", strings.Join(cmd.age, ","))
+	}
+	if len(cmd.kms) > 0 {
+		args = append(args, "--kms", strings.Join(cmd.kms, ","))
+	}
+	if len(cmd.pgp) > 0 {
+		args = append(args, "--pgp", strings.Join(cmd.pgp, ","))
+	}
+	if cmd.out != "" && cmd.out != "-" {
+		// Match the creation rules against the output file
+		args = append(args, "--filename-override", cmd.out)
+	}
+	return append(args, "/dev/stdin")
+}
+
+// encrypt runs sops, the plaintext document is only passed through a pipe
+func (cmd *SopsCommand) encrypt(doc []byte) ([]byte, error) {
+	var (
+		args   = cmd.sopsArgs()
+		stderr bytes.Buffer
+		c      = exec.Command(sopsCommand, args...)
+	)
+	c.Stdin = bytes.NewReader(doc)
+	c.Stderr = &stderr
+	Debugf("sops: %s %s", sopsCommand, strings.Join(args, " "))
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", sopsCommand, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", sopsCommand, err)
+	}
+	return out, nil
+}
+
+func (cmd *SopsCommand) Synopsis() string {
+	return "write secrets as a SOPS encrypted file"
+}
+
+func SopsCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &SopsCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("sops", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.out, "o", "", "output (default: stdout)")
+		cmd.fs.StringVar(&cmd.mod, "m", "0644", "output mode")
+		cmd.fs.StringVar(&cmd.format, "format", "", "format: yaml, json or dotenv (default: from output file extension, or yaml)")
+		cmd.fs.Var(&cmd.age, "age", "age recipient (can be repeated)")
+		cmd.fs.Var(&cmd.kms, "kms", "AWS KMS key ARN (can be repeated)")
+		cmd.fs.Var(&cmd.pgp, "pgp", "PGP fingerprint (can be repeated)")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,85 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSopsDocument(t *testing.T) {
+	var (
+		paths   = []string{"secret/db", "secret/api"}
+		secrets = []map[string]interface{}{
+			{CodecTypeKey: "json", "username": "test", "port": json.Number("5432")},
+			{"token": "s.test"},
+		}
+	)
+
+	tests := []struct {
+		Format string
+		Want   string
+	}{
+		{"yaml", "port: 5432\ntoken: s.test\nusername: test\n"},
+		{"json", "{\n  \"port\": 5432,\n  \"token\": \"s.test\",\n  \"username\": \"test\"\n}"},
+		{"dotenv", "port=5432\ntoken=s.test\nusername=test\n"},
+	}
+	for _, test := range tests {
+		doc, err := sopsDocument(paths, secrets, test.Format)
+		if err != nil {
+			t.Fatalf("%s: %v", test.Format, err)
+		}
+		if string(doc) != test.Want {
+			t.Fatalf("%s: expected %q, got %q", test.Format, test.Want, doc)
+		}
+	}
+
+	if _, err := sopsDocument([]string{"a", "b"}, []map[string]interface{}{{"key": "a"}, {"key": "b"}}, "yaml"); err == nil {
+		t.Fatal("expected error for duplicate keys")
+	}
+	if _, err := sopsDocument(paths, []map[string]interface{}{{"cert": "a\nb"}}, "dotenv"); err == nil {
+		t.Fatal("expected error for newline in dotenv value")
+	}
+}
+
+func TestSopsFormat(t *testing.T) {
+	for name, want := range map[string]string{
+		"":                 "yaml",
+		"secrets.enc.yaml": "yaml",
+		"secrets.json":     "json",
+		".env":             "dotenv",
+		"prod.env":         "dotenv",
+	} {
+		if got := sopsFormat(name); got != want {
+			t.Fatalf("sopsFormat(%q): expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestSopsEncrypt(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "sops")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake sops that echoes its arguments and input
+	name := filepath.Join(dir, "sops")
+	if err = ioutil.WriteFile(name, []byte("#!/bin/sh\necho \"$@\"\ncat\n"), 0755); err != nil {
+		t.Skip(err)
+	}
+	defer func(saved string) { sopsCommand = saved }(sopsCommand)
+	sopsCommand = name
+
+	cmd := &SopsCommand{format: "yaml", age: stringsValue{"age1a", "age1b"}}
+	cmd.out = "secrets/prod.yaml"
+	out, err := cmd.encrypt([]byte("key: value\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--encrypt --input-type yaml --output-type yaml --age age1a,age1b --filename-override secrets/prod.yaml /dev/stdin\nkey: value\n"
+	if string(out) != want {
+		t.Fatalf("expected %q, got %q", want, out)
+	}
+}
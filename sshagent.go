@@ -0,0 +1,190 @@
+package vc
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SSHCommand loads SSH keys held in Vault into the SSH agent
+type SSHCommand struct {
+	baseCommand
+	fs         *flag.FlagSet
+	sub        string
+	key        string
+	lifetime   time.Duration
+	confirm    bool
+	sign       string
+	principals string
+	ttl        string
+	noCert     bool
+}
+
+func (cmd *SSHCommand) Help() string {
+	return `Usage: vc ssh add [<options>] <secret path>
+
+Reads the private key in the secret at path and adds it to the running SSH
+agent (at $SSH_AUTH_SOCK), without writing it to disk. If the secret holds a
+certificate in key ` + sshSignedKey + `, it is added with the key; with -sign,
+the key is signed by the SSH secrets engine first.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *SSHCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.fs.Args(); len(args) != 1 || cmd.sub != "add" {
+		return Help
+	}
+	path := strings.TrimLeft(cmd.resolve(args[0]), "/")
+	if cmd.lifetime < 0 || cmd.lifetime.Seconds() > float64(^uint32(0)) {
+		cmd.ui.Error(fmt.Sprintf("error: invalid lifetime %s", cmd.lifetime))
+		return SyntaxError
+	}
+
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		cmd.ui.Error("error: no SSH agent running (SSH_AUTH_SOCK is not set)")
+		return ClientError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	secret, err := client.ReadSecret(path)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	} else if secret == nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: secret not found", path))
+		return NotFoundError
+	}
+	private, ok := secret.Data[cmd.key].(string)
+	if !ok {
+		cmd.ui.Error(fmt.Sprintf("error: %s: key %q not found", path, cmd.key))
+		return NotFoundError
+	}
+
+	key, err := cmd.parsePrivateKey(path, []byte(private))
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: %v", path, err))
+		return CodecError
+	}
+	added := agent.AddedKey{
+		PrivateKey:       key,
+		Comment:          path,
+		LifetimeSecs:     uint32(cmd.lifetime.Seconds()),
+		ConfirmBeforeUse: cmd.confirm,
+	}
+
+	signed, _ := secret.Data[sshSignedKey].(string)
+	if cmd.sign != "" {
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", path, err))
+			return CodecError
+		}
+		public := string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+		if signed, err = signSSHKey(client, cmd.sign, public, cmd.principals, cmd.ttl); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return exitCode(err, ServerError)
+		}
+	}
+	if signed != "" && !cmd.noCert {
+		if added.Certificate, err = parseCertificate(signed); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", path, err))
+			return CodecError
+		}
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: ssh agent: %v", err))
+		return SystemError
+	}
+	defer conn.Close()
+	if err = agent.NewClient(conn).Add(added); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: ssh agent: %v", err))
+		return SystemError
+	}
+
+	what := "key"
+	if added.Certificate != nil {
+		what = "key and certificate"
+	}
+	if cmd.lifetime > 0 {
+		cmd.ui.Info(fmt.Sprintf("added %s from %s to the SSH agent, for %s", what, path, cmd.lifetime))
+	} else {
+		cmd.ui.Info(fmt.Sprintf("added %s from %s to the SSH agent", what, path))
+	}
+	return Success
+}
+
+// parsePrivateKey parses a private key, prompting for the passphrase if the
+// key is encrypted
+func (cmd *SSHCommand) parsePrivateKey(path string, private []byte) (interface{}, error) {
+	key, err := ssh.ParseRawPrivateKey(private)
+	if _, ok := err.(*ssh.PassphraseMissingError); !ok {
+		return key, err
+	}
+	passphrase, err := cmd.ui.AskSecret(fmt.Sprintf("passphrase for %s:", path))
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParseRawPrivateKeyWithPassphrase(private, []byte(passphrase))
+}
+
+// parseCertificate parses an SSH certificate in authorized_keys format
+func parseCertificate(signed string) (*ssh.Certificate, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(signed))
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("signed key is not a certificate")
+	}
+	return cert, nil
+}
+
+func (cmd *SSHCommand) Synopsis() string {
+	return "add an SSH key held in Vault to the SSH agent"
+}
+
+func SSHCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &SSHCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("ssh "+sub, flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.key, "k", sshPrivateKey, "key holding the private key")
+		cmd.fs.DurationVar(&cmd.lifetime, "t", time.Hour, "lifetime of the key in the agent (0 for no limit)")
+		cmd.fs.BoolVar(&cmd.confirm, "c", false, "confirm each use of the key")
+		cmd.fs.StringVar(&cmd.sign, "sign", "", "sign with the SSH secrets engine, such as ssh-client-signer/sign/my-role")
+		cmd.fs.StringVar(&cmd.principals, "principals", "", "valid principals of the certificate, comma separated")
+		cmd.fs.StringVar(&cmd.ttl, "ttl", "", "TTL of the certificate")
+		cmd.fs.BoolVar(&cmd.noCert, "no-cert", false, "don't add the certificate stored in the secret")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,68 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestSSHAgentKey(t *testing.T) {
+	private, public, err := generateSSHKey("ed25519", 0, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &SSHCommand{}
+	key, err := cmd.parsePrivateKey("secret/ssh/test", []byte(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sign the public key with a test CA
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(public))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"deploy"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err = cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := parseCertificate(string(ssh.MarshalAuthorizedKey(cert)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.ValidPrincipals[0] != "deploy" {
+		t.Fatalf("expected principal deploy, got %v", parsed.ValidPrincipals)
+	}
+	if _, err = parseCertificate(public); err == nil {
+		t.Fatal("expected error for public key")
+	}
+
+	keyring := agent.NewKeyring()
+	if err = keyring.Add(agent.AddedKey{PrivateKey: key, Certificate: parsed, LifetimeSecs: 60}); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := keyring.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Format != ssh.CertAlgoED25519v01 {
+		t.Fatalf("expected certificate in agent, got %v", keys)
+	}
+}
@@ -0,0 +1,67 @@
+package vc
+
+import "strings"
+
+// ssmParameterStore is the AWS SSM Parameter Store bridge store; secrets are
+// stored as SecureString parameters holding a JSON object
+type ssmParameterStore struct {
+	*awsClient
+	keyID string
+}
+
+func newSSMParameterStore(profile, region, keyID string) (*ssmParameterStore, error) {
+	client, err := newAWSClient("ssm", "AmazonSSM", profile, region)
+	if err != nil {
+		return nil, err
+	}
+	return &ssmParameterStore{client, keyID}, nil
+}
+
+// ssmName returns the parameter name, which is hierarchical if it starts
+// with a slash
+func ssmName(name string) string {
+	return "/" + strings.Trim(name, "/")
+}
+
+func (s *ssmParameterStore) Get(name string) (string, error) {
+	var out struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	err := s.call("GetParameter", map[string]interface{}{
+		"Name":           ssmName(name),
+		"WithDecryption": true,
+	}, &out)
+	return out.Parameter.Value, err
+}
+
+func (s *ssmParameterStore) Put(name, value string, tags map[string]string, create bool) error {
+	in := map[string]interface{}{
+		"Name":  ssmName(name),
+		"Value": value,
+		"Type":  "SecureString",
+		"Tier":  "Intelligent-Tiering",
+	}
+	if s.keyID != "" {
+		in["KeyId"] = s.keyID
+	}
+	// Tags can only be set when creating a parameter
+	if create {
+		in["Tags"] = awsTags(tags)
+	} else {
+		in["Overwrite"] = true
+	}
+	if err := s.call("PutParameter", in, nil); err != nil || create || len(tags) == 0 {
+		return err
+	}
+	return s.call("AddTagsToResource", map[string]interface{}{
+		"ResourceType": "Parameter",
+		"ResourceId":   ssmName(name),
+		"Tags":         awsTags(tags),
+	}, nil)
+}
+
+func (s *ssmParameterStore) String() string {
+	return "AWS SSM Parameter Store (" + s.region + ")"
+}
@@ -0,0 +1,282 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// statsSecret is a secret in the statistics
+type statsSecret struct {
+	Path     string     `json:"path"`
+	Depth    int        `json:"-"`
+	Keys     int        `json:"keys"`
+	Size     int        `json:"size"`
+	Versions int        `json:"versions,omitempty"`
+	Updated  *time.Time `json:"updated,omitempty"`
+}
+
+// statsDepth are the statistics of the secrets at a depth below the paths
+type statsDepth struct {
+	Depth   int `json:"depth"`
+	Secrets int `json:"secrets"`
+	Size    int `json:"size"`
+}
+
+// statsReport are the statistics of the secrets below the paths; versions
+// and update times are those of KV v2 secrets
+type statsReport struct {
+	Secrets  int           `json:"secrets"`
+	Size     int           `json:"size"`
+	Versions int           `json:"versions"`
+	Oldest   *statsSecret  `json:"oldest,omitempty"`
+	Newest   *statsSecret  `json:"newest,omitempty"`
+	Depths   []statsDepth  `json:"depths"`
+	Largest  []statsSecret `json:"largest"`
+}
+
+// add adds the secret to the report
+func (r *statsReport) add(s statsSecret) {
+	r.Secrets++
+	r.Size += s.Size
+	r.Versions += s.Versions
+	if s.Updated != nil {
+		if r.Oldest == nil || s.Updated.Before(*r.Oldest.Updated) {
+			oldest := s
+			r.Oldest = &oldest
+		}
+		if r.Newest == nil || s.Updated.After(*r.Newest.Updated) {
+			newest := s
+			r.Newest = &newest
+		}
+	}
+	for len(r.Depths) <= s.Depth {
+		r.Depths = append(r.Depths, statsDepth{Depth: len(r.Depths)})
+	}
+	r.Depths[s.Depth].Secrets++
+	r.Depths[s.Depth].Size += s.Size
+	r.Largest = append(r.Largest, s)
+}
+
+// finish sorts the largest secrets, keeping top, and drops the depths
+// without secrets
+func (r *statsReport) finish(top int) {
+	sort.SliceStable(r.Largest, func(i, j int) bool {
+		return r.Largest[i].Size > r.Largest[j].Size
+	})
+	if len(r.Largest) > top {
+		r.Largest = r.Largest[:top]
+	}
+	depths := r.Depths[:0]
+	for _, depth := range r.Depths {
+		if depth.Secrets > 0 {
+			depths = append(depths, depth)
+		}
+	}
+	r.Depths = depths
+}
+
+// statsValueSize returns the size of a value: the length of strings, and of
+// the JSON encoding of other values
+func statsValueSize(v interface{}) int {
+	if s, ok := v.(string); ok {
+		return len(s)
+	}
+	b, _ := json.Marshal(v)
+	return len(b)
+}
+
+// statsSize formats a size in bytes
+func statsSize(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, suffix := float64(n)/unit, "KiB"
+	for _, next := range []string{"MiB", "GiB"} {
+		if size < unit {
+			break
+		}
+		size, suffix = size/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", size, suffix)
+}
+
+// StatsCommand reports statistics of the secrets below paths
+type StatsCommand struct {
+	baseCommand
+	fs  *flag.FlagSet
+	raw bool
+	top int
+}
+
+func (cmd *StatsCommand) Help() string {
+	return `Usage: vc stats [<options>] <path> [... <path>]
+
+Walk the secrets at the paths, and below directories, and report the number of
+secrets by depth below the paths, the total size of their values, the number
+of versions and the oldest and newest update of KV v2 secrets, and the largest
+secrets. With -json, the statistics are printed as JSON. Sizes are the sizes of
+the values, in bytes, which is close to what the secrets take in storage.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *StatsCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) == 0 {
+		return Help
+	}
+	if cmd.top < 0 {
+		cmd.ui.Error("error: -top can't be negative")
+		return SyntaxError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	report := &statsReport{Depths: []statsDepth{}, Largest: []statsSecret{}}
+	for _, root := range args {
+		paths, err := client.secretsBelow(root)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return exitCode(err, ServerError)
+		}
+		prefix := strings.Trim(client.Abs(root), "/") + "/"
+		progress := cmd.progress("reading", len(paths))
+		for _, path := range paths {
+			path = strings.TrimLeft(path, "/")
+			s, err := cmd.stat(client, path)
+			progress.Add(1)
+			if err != nil {
+				progress.Done()
+				cmd.ui.Error(fmt.Sprintf("error: %s: %v", path, err))
+				return exitCode(err, ServerError)
+			} else if s == nil {
+				continue
+			}
+			if strings.HasPrefix(path, prefix) {
+				s.Depth = strings.Count(path[len(prefix):], "/") + 1
+			}
+			report.add(*s)
+		}
+		progress.Done()
+	}
+	report.finish(cmd.top)
+
+	if cmd.raw {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return CodecError
+		}
+		cmd.ui.Output(string(b))
+		return Success
+	}
+
+	var (
+		b = new(bytes.Buffer)
+		w = tabwriter.NewWriter(b, 0, 8, 2, ' ', 0)
+	)
+	fmt.Fprintf(w, "secrets:\t%d\n", report.Secrets)
+	fmt.Fprintf(w, "size:\t%s\n", statsSize(report.Size))
+	fmt.Fprintf(w, "versions:\t%d\n", report.Versions)
+	if report.Oldest != nil {
+		fmt.Fprintf(w, "oldest update:\t%s\t%s\n", report.Oldest.Updated.Format(time.RFC3339), report.Oldest.Path)
+		fmt.Fprintf(w, "newest update:\t%s\t%s\n", report.Newest.Updated.Format(time.RFC3339), report.Newest.Path)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "DEPTH\tSECRETS\tSIZE")
+	for _, depth := range report.Depths {
+		fmt.Fprintf(w, "%d\t%d\t%s\n", depth.Depth, depth.Secrets, statsSize(depth.Size))
+	}
+	if len(report.Largest) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "PATH\tKEYS\tSIZE\tVERSIONS\tUPDATED")
+		for _, s := range report.Largest {
+			versions, updated := "-", "-"
+			if s.Versions > 0 {
+				versions = fmt.Sprint(s.Versions)
+			}
+			if s.Updated != nil {
+				updated = s.Updated.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", s.Path, s.Keys, statsSize(s.Size), versions, updated)
+		}
+	}
+	w.Flush()
+	cmd.ui.Output(strings.TrimSuffix(b.String(), "\n"))
+	return Success
+}
+
+// stat returns the statistics of the secret at path, or nil if it has no
+// data (such as a deleted KV v2 version)
+func (cmd *StatsCommand) stat(client *Client, path string) (*statsSecret, error) {
+	secret, err := client.ReadSecret(path)
+	if err != nil || secret == nil {
+		return nil, err
+	}
+	s := &statsSecret{Path: path, Keys: len(secret.Data)}
+	for key, value := range secret.Data {
+		s.Size += statsValueSize(value)
+		if key == CodecTypeKey {
+			s.Keys--
+		}
+	}
+	if !client.IsKV2(path) {
+		return s, nil
+	}
+
+	metadata, err := client.ReadMetadata(path)
+	if err != nil {
+		return nil, err
+	} else if metadata == nil {
+		return s, nil
+	}
+	if versions, ok := metadata.Data["versions"].(map[string]interface{}); ok {
+		s.Versions = len(versions)
+	}
+	if updated, _ := metadata.Data["updated_time"].(string); updated != "" {
+		if t, err := time.Parse(time.RFC3339Nano, updated); err == nil {
+			t = t.UTC()
+			s.Updated = &t
+		}
+	}
+	return s, nil
+}
+
+func (cmd *StatsCommand) Synopsis() string {
+	return "report statistics of the secrets below paths"
+}
+
+func StatsCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &StatsCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("stats", flag.ContinueOnError)
+		cmd.fs.BoolVar(&cmd.raw, "json", false, "print the statistics as JSON")
+		cmd.fs.IntVar(&cmd.top, "top", 10, "number of largest secrets to report")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,88 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestStatsCommand(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		request := r.Method + " " + r.URL.Path
+		if r.URL.Query().Get("list") == "true" {
+			request = "LIST " + r.URL.Path
+		}
+		switch request {
+		case "LIST /v1/secret/metadata/app", "LIST /v1/secret/metadata/app/":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"db", "api/"}}}
+		case "LIST /v1/secret/metadata/app/api", "LIST /v1/secret/metadata/app/api/":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"key"}}}
+		case "GET /v1/secret/data/app/db":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"username": "app", "password": "0123456789"},
+				"metadata": map[string]interface{}{"version": 3},
+			}}
+		case "GET /v1/secret/metadata/app/db":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"current_version": 3,
+				"updated_time":    "2020-01-02T03:04:05.123Z",
+				"versions":        map[string]interface{}{"1": map[string]interface{}{}, "2": map[string]interface{}{}, "3": map[string]interface{}{}},
+			}}
+		case "GET /v1/secret/data/app/api/key":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"key": strings.Repeat("k", 2000), "ports": []int{80, 443}},
+				"metadata": map[string]interface{}{"version": 1},
+			}}
+		case "GET /v1/secret/metadata/app/api/key":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"current_version": 1,
+				"updated_time":    "2021-01-02T03:04:05Z",
+				"versions":        map[string]interface{}{"1": map[string]interface{}{}},
+			}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv-v2"})
+
+	run := func(args ...string) string {
+		t.Helper()
+		ui := cli.NewMockUi()
+		command, _ := StatsCommandFactory(ui)()
+		cmd := command.(*StatsCommand)
+		cmd.c = c
+		if code := cmd.Run(args); code != Success {
+			t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+		}
+		return ui.OutputWriter.String()
+	}
+
+	var report statsReport
+	if err := json.Unmarshal([]byte(run("-json", "-top", "1", "secret/app")), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Secrets != 2 || report.Size != 2021 || report.Versions != 4 {
+		t.Fatalf("expected 2 secrets of 2021 bytes with 4 versions, got %+v", report)
+	}
+	if len(report.Depths) != 2 || report.Depths[0] != (statsDepth{Depth: 1, Secrets: 1, Size: 13}) || report.Depths[1] != (statsDepth{Depth: 2, Secrets: 1, Size: 2008}) {
+		t.Fatalf("unexpected depths %+v", report.Depths)
+	}
+	if len(report.Largest) != 1 || report.Largest[0].Path != "secret/app/api/key" || report.Largest[0].Keys != 2 {
+		t.Fatalf("unexpected largest secrets %+v", report.Largest)
+	}
+	if report.Oldest == nil || report.Oldest.Path != "secret/app/db" || report.Newest == nil || report.Newest.Path != "secret/app/api/key" {
+		t.Fatalf("unexpected oldest %+v and newest %+v", report.Oldest, report.Newest)
+	}
+
+	out := run("secret/app")
+	for _, want := range []string{"size:           2.0 KiB", "oldest update:  2020-01-02T03:04:05Z  secret/app/db", "secret/app/db       2     13 B     3"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+}
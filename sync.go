@@ -0,0 +1,1459 @@
+package vc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/tehmaze/vc/client"
+)
+
+// syncStateSuffix is appended to the manifest name for the default state file
+const syncStateSuffix = ".state"
+
+// SyncRefreshMetadataKey is the custom metadata key of KV v2 secrets with the
+// interval at which sync -watch checks the files that use them, such as 1h
+const SyncRefreshMetadataKey = "refresh_interval"
+
+// syncManifest lists the templates that are rendered by sync
+type syncManifest struct {
+	// State is the state file, relative to the manifest, see syncStateSuffix
+	State string `yaml:"state"`
+
+	// Vars are the variables for the outputs that are templates, see
+	// expandOutputs
+	Vars map[string]string `yaml:"vars"`
+
+	// Files are the rendered templates
+	Files []syncFile `yaml:"files"`
+
+	// dir is the directory of the manifest
+	dir string
+}
+
+// syncFile is a template, rendered to Output; or a recipe, generating Output
+// from the data of Secret
+type syncFile struct {
+	Template   string            `yaml:"template"`
+	Recipe     string            `yaml:"recipe"`
+	Secret     string            `yaml:"secret"`
+	Output     string            `yaml:"output"`
+	Mode       string            `yaml:"mode"`
+	Owner      string            `yaml:"owner"`
+	Group      string            `yaml:"group"`
+	SELinux    string            `yaml:"selinux"`
+	Xattrs     map[string]string `yaml:"xattrs"`
+	Templating string            `yaml:"templating"`
+	Transform  []string          `yaml:"transform"`
+	Post       []string          `yaml:"post"`
+
+	// Refresh is the interval at which sync -watch checks the file, see
+	// SyncCommand.refresh
+	Refresh string `yaml:"refresh"`
+}
+
+// syncState records the last render of each output file
+type syncState struct {
+	Files map[string]*syncFileState `json:"files"`
+}
+
+// syncFileState has the hashes of the template and the output file, and the
+// versions of the secrets that were used; KV v2 secrets are recorded with
+// their version ("v3"), others with the hash of their data. Created is set
+// for output files that didn't exist before sync wrote them; only those are
+// deleted once they are no longer in the manifest.
+type syncFileState struct {
+	Template string            `json:"template"`
+	Content  string            `json:"content"`
+	Secrets  map[string]string `json:"secrets"`
+	Created  bool              `json:"created,omitempty"`
+}
+
+// syncAction is a rendered file that changed
+type syncAction struct {
+	file    syncFile
+	mode    os.FileMode
+	owner   *fileOwner
+	xattrs  map[string]string
+	content []byte
+	state   *syncFileState
+	create  bool
+}
+
+// syncPlan is the plan of sync plan, applied by sync apply; it has the
+// hashes of the output files before and after, not their contents
+type syncPlan struct {
+	Manifest     string            `json:"manifest"`
+	ManifestHash string            `json:"manifest_hash"`
+	State        string            `json:"state"`
+	Vars         map[string]string `json:"vars,omitempty"`
+	Created      time.Time         `json:"created"`
+	Reads        []string          `json:"reads"`
+	Files        []syncPlanFile    `json:"files"`
+}
+
+// syncPlanFile is an output file that is created, updated or deleted; Before
+// is "" for files that don't exist, After "" for files that are deleted
+type syncPlanFile struct {
+	Output string `json:"output"`
+	Action string `json:"action"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// loadSyncManifest reads the manifest file name; relative paths in the
+// manifest are relative to its directory
+func loadSyncManifest(name string) (*syncManifest, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	m := new(syncManifest)
+	if err = yaml.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	m.dir = filepath.Dir(name)
+	if m.State == "" {
+		m.State = name + syncStateSuffix
+	} else if !isSyncTemplate(m.State) {
+		m.State = m.rel(m.State)
+	}
+	for i, f := range m.Files {
+		if f.Recipe != "" {
+			if err = checkSyncRecipe(f); err != nil {
+				return nil, fmt.Errorf("%s: file %d: %v", name, i+1, err)
+			}
+		} else if f.Template == "" || f.Output == "" {
+			return nil, fmt.Errorf("%s: file %d: template and output are required", name, i+1)
+		} else {
+			m.Files[i].Template = m.rel(f.Template)
+		}
+		if !isSyncTemplate(f.Output) {
+			m.Files[i].Output = m.rel(f.Output)
+		}
+		if f.Mode == "" && f.Recipe != "" {
+			m.Files[i].Mode = DefaultOutputMode
+		}
+		if f.Templating == "" {
+			m.Files[i].Templating = "html"
+		}
+		if f.Refresh != "" {
+			if d, err := time.ParseDuration(f.Refresh); err != nil || d <= 0 {
+				return nil, fmt.Errorf("%s: file %d: invalid refresh %q", name, i+1, f.Refresh)
+			}
+		}
+	}
+	return m, nil
+}
+
+// checkSyncRecipe checks a file with a recipe: the output holds private keys,
+// so it can't be readable by others
+func checkSyncRecipe(f syncFile) error {
+	if recipes[f.Recipe] == nil {
+		return fmt.Errorf("unknown recipe %q, use one of %s", f.Recipe, strings.Join(recipeNames(), ", "))
+	}
+	if f.Template != "" {
+		return fmt.Errorf("recipe %s: a file has a template or a recipe, not both", f.Recipe)
+	}
+	if f.Secret == "" || f.Output == "" {
+		return fmt.Errorf("recipe %s: secret and output are required", f.Recipe)
+	}
+	if f.Mode != "" {
+		mode, err := strconv.ParseUint(f.Mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid mode: %v", err)
+		} else if mode&0077 != 0 {
+			return fmt.Errorf("recipe %s: mode %s makes the keys readable by others, use 0600", f.Recipe, f.Mode)
+		}
+	}
+	return nil
+}
+
+// fileMode returns the mode of the output of f, output_mode in the
+// configuration file if the manifest has none
+func (cmd *baseCommand) fileMode(f syncFile) (os.FileMode, error) {
+	mod := f.Mode
+	if mod == "" {
+		config, err := cmd.Config()
+		if err != nil {
+			return 0, err
+		}
+		if mod = config.OutputMode; mod == "" {
+			mod = DefaultOutputMode
+		}
+	}
+	mode, err := strconv.ParseUint(mod, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode: %v", err)
+	}
+	return os.FileMode(mode), nil
+}
+
+// rel returns path relative to the directory of the manifest
+func (m *syncManifest) rel(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(m.dir, path)
+}
+
+// isSyncTemplate checks if a path in the manifest is a template
+func isSyncTemplate(path string) bool {
+	return strings.Contains(path, "{{")
+}
+
+// expandOutputs expands the state file and outputs that are templates, such
+// as /etc/app/{{ .Env }}/db.conf, with the variables of the manifest and vars,
+// which take precedence. Templates can read secrets with secret, and the
+// environment with env.
+func (m *syncManifest) expandOutputs(vars map[string]string, read func(string) (*api.Secret, error)) error {
+	data := make(map[string]string, len(m.Vars)+len(vars))
+	for key, value := range m.Vars {
+		data[key] = value
+	}
+	for key, value := range vars {
+		data[key] = value
+	}
+	funcs := textTemplate.FuncMap{
+		"env": os.Getenv,
+		"secret": func(path, key string) (string, error) {
+			secret, err := read(path)
+			if err != nil {
+				return "", err
+			} else if secret == nil {
+				return "", notFound(fmt.Sprintf("secret %s: not found", path))
+			}
+			value, ok := secret.Data[key].(string)
+			if !ok {
+				return "", fmt.Errorf("secret %s: key %q not found", path, key)
+			}
+			return value, nil
+		},
+	}
+
+	if isSyncTemplate(m.State) {
+		state, err := expandSyncPath(m.State, data, funcs)
+		if err != nil {
+			return fmt.Errorf("state: %v", err)
+		}
+		m.State = m.rel(state)
+	}
+	outputs := make(map[string]int)
+	for i, f := range m.Files {
+		if isSyncTemplate(f.Output) {
+			output, err := expandSyncPath(f.Output, data, funcs)
+			if err != nil {
+				return fmt.Errorf("file %d: %v", i+1, err)
+			}
+			m.Files[i].Output = m.rel(output)
+		}
+		if j, ok := outputs[m.Files[i].Output]; ok {
+			return fmt.Errorf("files %d and %d: both are written to %s", j+1, i+1, m.Files[i].Output)
+		}
+		outputs[m.Files[i].Output] = i
+	}
+	return nil
+}
+
+// expandSyncPath expands the path template; to prevent path traversal, the
+// expanded path can't contain "..", and must be below the directory of the
+// text before the first action (/etc/app for /etc/app/{{ .Env }}/db.conf)
+func expandSyncPath(path string, data map[string]string, funcs textTemplate.FuncMap) (string, error) {
+	t, err := textTemplate.New(path).Funcs(funcs).Option("missingkey=error").Parse(path)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err = t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	expanded := b.String()
+
+	base := filepath.Dir(path[:strings.Index(path, "{{")] + "x")
+	if strings.ContainsRune(expanded, 0) || strings.HasSuffix(expanded, "/") {
+		return "", fmt.Errorf("%s: invalid path %q", path, expanded)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(expanded), "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%s: path %q is outside of %s", path, expanded, base)
+		}
+	}
+	clean := filepath.Clean(expanded)
+	if base == "." && !filepath.IsAbs(clean) {
+		return clean, nil
+	}
+	if prefix := strings.TrimSuffix(base, string(filepath.Separator)) + string(filepath.Separator); !strings.HasPrefix(clean, prefix) {
+		return "", fmt.Errorf("%s: path %q is outside of %s", path, expanded, base)
+	}
+	return clean, nil
+}
+
+// parseSyncVars parses the key=value variables of -var
+func parseSyncVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		i := strings.IndexByte(pair, '=')
+		if i < 1 {
+			return nil, fmt.Errorf("invalid -var %q, expected key=value", pair)
+		}
+		vars[pair[:i]] = pair[i+1:]
+	}
+	return vars, nil
+}
+
+// loadSyncState reads the state file name, a missing file is an empty state
+func loadSyncState(name string) (*syncState, error) {
+	state := &syncState{Files: make(map[string]*syncFileState)}
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]*syncFileState)
+	}
+	return state, nil
+}
+
+// save writes the state file name
+func (state *syncState) save(name string) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	w := SafeOutputWriter(name, 0600)
+	if _, err = w.Write(append(b, '\n')); err != nil {
+		w.(*safeOutputWriter).abort()
+		return err
+	}
+	return w.Close()
+}
+
+// loadSyncPlan reads the plan file name
+func loadSyncPlan(name string) (*syncPlan, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p := new(syncPlan)
+	if err = json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	} else if p.Manifest == "" || p.State == "" {
+		return nil, fmt.Errorf("%s: not a plan of vc sync plan", name)
+	}
+	return p, nil
+}
+
+// save writes the plan file name
+func (p *syncPlan) save(name string) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	w := SafeOutputWriter(name, 0600)
+	if _, err = w.Write(append(b, '\n')); err != nil {
+		w.(*safeOutputWriter).abort()
+		return err
+	}
+	return w.Close()
+}
+
+// hashBytes returns the hex encoded SHA-256 hash of b
+func hashBytes(b []byte) string {
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:])
+}
+
+// hashFile returns the hash of the file name, or "" if it doesn't exist
+func hashFile(name string) (string, error) {
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer wipe(b)
+	return hashBytes(b), nil
+}
+
+// syncVersion returns the version of a secret as recorded in the state
+func syncVersion(secret *api.Secret) string {
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok && metadata["version"] != nil {
+		return fmt.Sprintf("v%v", metadata["version"])
+	}
+	b, _ := json.Marshal(secret.Data)
+	return "sha256:" + hashBytes(b)
+}
+
+// syncRead is a secret, or the version of a secret, read once per run; other
+// templates that need it wait for done
+type syncRead struct {
+	done    chan struct{}
+	secret  *api.Secret
+	version string
+	err     error
+}
+
+// syncResult is the plan for a file, see SyncCommand.plan; debug messages are
+// kept, so they are logged in the order of the manifest. Files that are not
+// due in watch mode are idle.
+type syncResult struct {
+	action  *syncAction
+	err     error
+	skipped bool
+	idle    bool
+	debug   []string
+}
+
+func (r *syncResult) debugf(format string, v ...interface{}) {
+	r.debug = append(r.debug, fmt.Sprintf(format, v...))
+}
+
+// syncGraph maps the secrets that the templates used in the last run to the
+// outputs that depend on them
+func syncGraph(m *syncManifest, state *syncState) map[string][]string {
+	graph := make(map[string][]string)
+	for _, f := range m.Files {
+		if last := state.Files[f.Output]; last != nil {
+			for path := range last.Secrets {
+				graph[path] = append(graph[path], f.Output)
+			}
+		}
+	}
+	return graph
+}
+
+// SyncCommand renders the templates in a manifest, for the secrets that
+// changed since the last run
+type SyncCommand struct {
+	baseCommand
+	fs          *flag.FlagSet
+	manifest    string
+	state       string
+	force       bool
+	vars        stringsValue
+	concurrency int
+	watch       bool
+	interval    time.Duration
+	sub         string
+	planFile    string
+	prune       bool
+
+	// secrets are the secrets read in this run, versions the versions of the
+	// secrets that were checked for changes
+	mutex    sync.Mutex
+	secrets  map[string]*syncRead
+	versions map[string]*syncRead
+
+	// hints are the refresh intervals of the secrets, by path, from their
+	// leases or metadata; see refresh
+	hints map[string]time.Duration
+}
+
+func (cmd *SyncCommand) Help() string {
+	switch cmd.sub {
+	case "plan":
+		return `Usage: vc sync plan [<options>] -f <manifest> -out <plan file>
+
+Plan a sync, without writing any files: print the secrets that would be read
+and the files that would be created (+), updated (~) or, with -prune, deleted
+(-) because they are no longer in the manifest. The plan is written to the
+plan file, for review, and applied with vc sync apply. The plan file has the
+hashes of the files before and after, not their contents.
+
+Options:
+` + defaults(cmd.fs)
+	case "apply":
+		return `Usage: vc sync apply [<options>] <plan file>
+
+Apply a plan of vc sync plan: the files of the plan are rendered again, and
+written (or deleted) only if all of them are exactly as planned. If one of the
+files, its template or secrets, or the manifest changed since the plan, no
+files are written and the command fails (exit code 9); plan again. Files that
+are not in the plan are left alone.
+
+Options:
+` + defaults(cmd.fs)
+	}
+	return `Usage: vc sync [<options>] -f <manifest>
+
+Render the templates in the manifest, like vc template. A state file records
+the hashes of the templates and output files, and the versions of the secrets
+that were used; only templates of which the secrets, the template or the output
+file changed are rendered again, and only changed files are written.
+
+The secrets the templates used in the last run are checked for changes once,
+however many templates use them, and the templates are rendered by -c workers;
+each secret is read once per run. The plan and errors are reported in the order
+of the manifest.
+
+With -watch, sync keeps running and checks each file again at its own
+interval: the refresh of the file in the manifest, such as 10m; or else two
+thirds of the shortest lease of its secrets, or the shortest refresh_interval
+in the custom metadata of its KV v2 secrets; or else -interval.
+
+Files that sync created and that are no longer in the manifest are deleted
+with -prune, or after confirmation; files that existed before sync wrote them,
+or that changed since, are never deleted.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *SyncCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	var plan *syncPlan
+	if cmd.sub == "apply" {
+		if cmd.fs.NArg() != 1 {
+			return Help
+		}
+		var err error
+		if plan, err = loadSyncPlan(cmd.fs.Arg(0)); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SyntaxError
+		}
+		cmd.manifest = plan.Manifest
+		for key, value := range plan.Vars {
+			cmd.vars = append(cmd.vars, key+"="+value)
+		}
+		if cmd.state == "" {
+			cmd.state = plan.State
+		}
+	} else if cmd.manifest == "" || cmd.fs.NArg() > 0 {
+		return Help
+	}
+	if cmd.sub == "plan" && cmd.planFile == "" {
+		cmd.ui.Error("error: -out is required")
+		return SyntaxError
+	}
+	if cmd.concurrency < 1 {
+		cmd.ui.Error("error: -c must be at least 1")
+		return SyntaxError
+	}
+	if cmd.watch && cmd.interval <= 0 {
+		cmd.ui.Error("error: -interval must be positive")
+		return SyntaxError
+	}
+
+	vars, err := parseSyncVars(cmd.vars)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	m, err := loadSyncManifest(cmd.manifest)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	if err = m.expandOutputs(vars, func(path string) (*api.Secret, error) {
+		return cmd.read(&TemplateCommand{baseCommand: cmd.baseCommand}, client, path)
+	}); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: %v", cmd.manifest, err))
+		return exitCode(err, SyntaxError)
+	}
+	if cmd.state != "" {
+		m.State = cmd.state
+	}
+	state, err := loadSyncState(m.State)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	if err = cmd.checkOutputs(m); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SystemError)
+	}
+	if plan != nil {
+		return cmd.applyPlan(client, m, state, plan)
+	}
+
+	ret := cmd.run(client, m, state, nil)
+	if !cmd.watch {
+		return ret
+	}
+	cmd.checkHealth(client, ret)
+	stopHealth, err := startHealth()
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	defer stopHealth()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	var (
+		next = make([]time.Time, len(m.Files))
+		due  = make([]bool, len(m.Files))
+	)
+	for i := range due {
+		due[i] = true
+	}
+	for {
+		// Schedule the files that were checked, and wait for the first
+		var first time.Time
+		for i, f := range m.Files {
+			if due[i] {
+				next[i] = time.Now().Add(cmd.refresh(f, state.Files[f.Output]))
+				Debugf("sync: checking %s again at %s", f.Output, next[i].Format(time.RFC3339))
+			}
+			if first.IsZero() || next[i].Before(first) {
+				first = next[i]
+			}
+		}
+		health.schedule(first)
+		select {
+		case <-time.After(time.Until(first)):
+		case <-interrupt:
+			return ret
+		case <-shuttingDown():
+			return ret
+		}
+
+		now := time.Now()
+		for i := range m.Files {
+			due[i] = !next[i].After(now)
+		}
+		cmd.secrets, cmd.versions = nil, nil
+		code := cmd.run(client, m, state, due)
+		if code > ret {
+			ret = code
+		}
+		cmd.checkHealth(client, code)
+	}
+}
+
+// checkOutputs checks that the files sync writes are writable in read-only
+// mode, before any file is rendered: the plan file, or the output files and
+// the state file (see checkWritable). Outputs with secrets in their names are
+// known only after expandOutputs, which reads those secrets.
+func (cmd *SyncCommand) checkOutputs(m *syncManifest) error {
+	if DryRun {
+		return nil
+	} else if cmd.sub == "plan" {
+		return cmd.checkWritable(cmd.planFile)
+	}
+	if err := cmd.checkWritable(m.State); err != nil {
+		return err
+	}
+	for _, f := range m.Files {
+		if err := cmd.checkWritable(f.Output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkHealth records the outcome of a run in watch mode, and checks the
+// token, see healthStatus
+func (cmd *SyncCommand) checkHealth(client *Client, code int) {
+	if code != Success {
+		health.render(fmt.Errorf("the last run failed with exit code %d", code))
+	} else {
+		health.render(nil)
+	}
+	health.lookupToken(client)
+}
+
+// printPlan prints the files that are created, updated and deleted; in watch
+// mode, a plan without changes is only logged
+func (cmd *SyncCommand) printPlan(actions []syncAction, deletes []string, unchanged int, watching bool) {
+	var created int
+	colors := cmd.colors(os.Stdout)
+	for _, action := range actions {
+		if action.create {
+			created++
+			cmd.ui.Output(colors.change("+ " + action.file.Output))
+		} else {
+			cmd.ui.Output(colors.change("~ " + action.file.Output))
+		}
+	}
+	for _, output := range deletes {
+		cmd.ui.Output(colors.change("- " + output))
+	}
+	plan := fmt.Sprintf("plan: %d to create, %d to update, %d unchanged", created, len(actions)-created, unchanged)
+	if len(deletes) > 0 {
+		plan = fmt.Sprintf("plan: %d to create, %d to update, %d to delete, %d unchanged", created, len(actions)-created, len(deletes), unchanged)
+	}
+	if !watching || len(actions) > 0 {
+		cmd.ui.Info(plan)
+	} else {
+		Debugf("sync: %s", plan)
+	}
+}
+
+// writePlan prints the secrets that the changed files read, and the plan,
+// and writes the plan file; nothing is written if planning failed
+func (cmd *SyncCommand) writePlan(m *syncManifest, actions []syncAction, deletes []string, unchanged, ret int) int {
+	reads := make(map[string]bool)
+	for _, action := range actions {
+		for path := range action.state.Secrets {
+			reads[path] = true
+		}
+	}
+	p := &syncPlan{Created: time.Now().UTC(), Reads: make([]string, 0, len(reads))}
+	for path := range reads {
+		p.Reads = append(p.Reads, path)
+	}
+	sort.Strings(p.Reads)
+	for _, path := range p.Reads {
+		cmd.ui.Output("read " + path)
+	}
+	sort.Strings(deletes)
+	cmd.printPlan(actions, deletes, unchanged, false)
+	if ret != Success {
+		cmd.ui.Error("error: the plan is incomplete, " + cmd.planFile + " is not written")
+		return ret
+	}
+
+	for _, action := range actions {
+		f := syncPlanFile{Output: action.file.Output, Action: "update", Before: action.state.Content, After: hashBytes(action.content)}
+		if action.create {
+			f.Action = "create"
+		}
+		wipe(action.content)
+		p.Files = append(p.Files, f)
+	}
+	for _, output := range deletes {
+		hash, err := hashFile(output)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+		p.Files = append(p.Files, syncPlanFile{Output: output, Action: "delete", Before: hash})
+	}
+	var err error
+	if p.Manifest, err = filepath.Abs(cmd.manifest); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if p.State, err = filepath.Abs(m.State); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if p.ManifestHash, err = hashFile(cmd.manifest); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if p.Vars, err = parseSyncVars(cmd.vars); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	if err = p.save(cmd.planFile); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	cmd.ui.Info(fmt.Sprintf("plan written to %s, apply it with vc sync apply %s", cmd.planFile, cmd.planFile))
+	return Success
+}
+
+// applyPlan renders the files in the plan again, and writes or deletes them
+// only if all of them are as planned; otherwise nothing is written
+func (cmd *SyncCommand) applyPlan(client *Client, m *syncManifest, state *syncState, p *syncPlan) int {
+	var errs []error
+	stale := func(output, format string, v ...interface{}) {
+		errs = append(errs, &Error{Kind: ErrVersionConflict, Err: fmt.Errorf("%s: %s", output, fmt.Sprintf(format, v...))})
+	}
+	if hash, err := hashFile(cmd.manifest); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	} else if hash != p.ManifestHash {
+		stale(cmd.manifest, "changed since the plan")
+	}
+
+	files := make(map[string]syncFile)
+	for _, f := range m.Files {
+		files[f.Output] = f
+	}
+	var (
+		planned []syncPlanFile
+		deletes []string
+	)
+	for _, pf := range p.Files {
+		_, ok := files[pf.Output]
+		switch {
+		case pf.Action == "delete" && ok:
+			stale(pf.Output, "is in the manifest again")
+		case pf.Action == "delete":
+			if hash, err := hashFile(pf.Output); err != nil {
+				errs = append(errs, err)
+			} else if hash != pf.Before {
+				stale(pf.Output, "changed since the plan")
+			} else if err = cmd.checkWritable(pf.Output); err != nil && !DryRun {
+				errs = append(errs, err)
+			} else {
+				deletes = append(deletes, pf.Output)
+			}
+		case !ok:
+			stale(pf.Output, "is no longer in the manifest")
+		default:
+			planned = append(planned, pf)
+		}
+	}
+
+	// Render all planned files, ignoring the state
+	cmd.force = true
+	results := make([]syncResult, len(planned))
+	cmd.each(len(planned), func(i int) {
+		results[i].action, results[i].err = cmd.plan(client, files[planned[i].Output], state.Files[planned[i].Output], &results[i])
+	})
+	var actions []syncAction
+	for i, pf := range planned {
+		result := results[i]
+		for _, message := range result.debug {
+			Debug(message)
+		}
+		switch {
+		case result.err != nil:
+			errs = append(errs, fmt.Errorf("%s: %v", pf.Output, result.err))
+		case result.action.state.Content != pf.Before:
+			stale(pf.Output, "changed since the plan")
+		case result.action.content == nil || hashBytes(result.action.content) != pf.After:
+			stale(pf.Output, "renders differently than planned, its template or secrets changed")
+		default:
+			actions = append(actions, *result.action)
+		}
+	}
+	if len(errs) > 0 {
+		ret := Success
+		for _, err := range errs {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			if code := exitCode(err, ServerError); code > ret {
+				ret = code
+			}
+		}
+		for _, action := range actions {
+			wipe(action.content)
+		}
+		cmd.ui.Error("error: no files were written; run vc sync plan again")
+		return ret
+	}
+
+	cmd.printPlan(actions, deletes, 0, false)
+	if DryRun {
+		return Success
+	}
+	ret := Success
+	for _, action := range actions {
+		if err := cmd.apply(action); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", action.file.Output, err))
+			ret = SystemError
+			continue
+		}
+		state.Files[action.file.Output] = action.state
+	}
+	for _, output := range deletes {
+		if err := os.Remove(output); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			ret = SystemError
+			continue
+		}
+		delete(state.Files, output)
+	}
+	if err := state.save(m.State); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	releaseLeases()
+	return ret
+}
+
+// refresh returns the interval at which -watch checks f: its refresh; or two
+// thirds of the shortest lease of the secrets it used last, or the shortest
+// refresh_interval in their metadata, see SyncRefreshMetadataKey; or else
+// -interval
+func (cmd *SyncCommand) refresh(f syncFile, last *syncFileState) time.Duration {
+	if f.Refresh != "" {
+		d, _ := time.ParseDuration(f.Refresh)
+		return d
+	}
+	var interval time.Duration
+	if last != nil {
+		cmd.mutex.Lock()
+		for path := range last.Secrets {
+			if hint := cmd.hints[path]; hint > 0 && (interval == 0 || hint < interval) {
+				interval = hint
+			}
+		}
+		cmd.mutex.Unlock()
+	}
+	if interval == 0 {
+		return cmd.interval
+	} else if interval < time.Second {
+		// Leases that are about to expire
+		return time.Second
+	}
+	return interval
+}
+
+// hint records the refresh interval of the secret at path, from its lease or
+// the custom metadata of a KV v2 secret (in metadata)
+func (cmd *SyncCommand) hint(path string, leaseDuration int, metadata map[string]interface{}) {
+	var interval time.Duration
+	if leaseDuration > 0 {
+		interval = time.Duration(leaseDuration) * time.Second * 2 / 3
+	}
+	custom, _ := metadata["custom_metadata"].(map[string]interface{})
+	if s, _ := custom[SyncRefreshMetadataKey].(string); s != "" {
+		if d, err := time.ParseDuration(s); err != nil || d <= 0 {
+			Debugf("sync: %s: invalid %s %q", path, SyncRefreshMetadataKey, s)
+		} else if interval == 0 || d < interval {
+			interval = d
+		}
+	}
+	if interval == 0 {
+		return
+	}
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	if cmd.hints == nil {
+		cmd.hints = make(map[string]time.Duration)
+	}
+	cmd.hints[path] = interval
+}
+
+// run renders the files of the manifest that changed, of the files that are
+// due (all if due is nil), and saves the state
+func (cmd *SyncCommand) run(client *Client, m *syncManifest, state *syncState, due []bool) int {
+	isDue := func(i int) bool { return due == nil || due[i] }
+
+	// Check the secrets of the last run for changes once, for all the
+	// templates that depend on them
+	graph := syncGraph(m, state)
+	if due != nil {
+		outputs := make(map[string]bool)
+		for i, f := range m.Files {
+			outputs[f.Output] = due[i]
+		}
+		for path, dependents := range graph {
+			var keep []string
+			for _, output := range dependents {
+				if outputs[output] {
+					keep = append(keep, output)
+				}
+			}
+			if len(keep) == 0 {
+				delete(graph, path)
+			} else {
+				graph[path] = keep
+			}
+		}
+	}
+	if !cmd.force && len(graph) > 0 {
+		paths := make([]string, 0, len(graph))
+		for path := range graph {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		Debugf("sync: checking %d secrets of the last run for changes", len(paths))
+		cmd.each(len(paths), func(i int) {
+			// Errors are reported for the templates that depend on the secret
+			cmd.version(client, paths[i], state.versionOf(paths[i], graph[paths[i]]))
+		})
+	}
+
+	results := make([]syncResult, len(m.Files))
+	cmd.each(len(m.Files), func(i int) {
+		if !isDue(i) {
+			results[i].idle = true
+			return
+		}
+		if stopping() {
+			results[i].skipped = true
+			return
+		}
+		f := m.Files[i]
+		results[i].action, results[i].err = cmd.plan(client, f, state.Files[f.Output], &results[i])
+	})
+
+	var (
+		ret       int
+		err       error
+		actions   []syncAction
+		unchanged int
+		skipped   int
+		outputs   = make(map[string]bool)
+	)
+	for i, f := range m.Files {
+		outputs[f.Output] = true
+		result := results[i]
+		for _, message := range result.debug {
+			Debug(message)
+		}
+		switch {
+		case result.idle:
+		case result.skipped:
+			skipped++
+		case result.err != nil:
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", f.Output, result.err))
+			if code := exitCode(result.err, ServerError); code > ret {
+				ret = code
+			}
+		case result.action == nil:
+			unchanged++
+		case result.action.content == nil:
+			// Rendered, but the output file didn't change
+			state.Files[f.Output] = result.action.state
+			unchanged++
+		default:
+			actions = append(actions, *result.action)
+		}
+	}
+	if skipped > 0 {
+		cmd.ui.Warn(fmt.Sprintf("warning: shutting down, skipping %d files", skipped))
+	}
+	var deletes []string
+	if due == nil {
+		// Reported by the first run in watch mode
+		if deletes, err = cmd.orphans(state, outputs); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	}
+
+	sort.Slice(actions, func(i, j int) bool { return actions[i].file.Output < actions[j].file.Output })
+	if cmd.sub == "plan" {
+		return cmd.writePlan(m, actions, deletes, unchanged, ret)
+	}
+	cmd.printPlan(actions, deletes, unchanged, due != nil)
+	if DryRun {
+		return ret
+	}
+
+	for _, action := range actions {
+		if err = cmd.apply(action); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", action.file.Output, err))
+			if ret < SystemError {
+				ret = SystemError
+			}
+			continue
+		}
+		state.Files[action.file.Output] = action.state
+	}
+	for _, output := range deletes {
+		if err = os.Remove(output); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			if ret < SystemError {
+				ret = SystemError
+			}
+			continue
+		}
+		delete(state.Files, output)
+	}
+	if err = state.save(m.State); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	releaseLeases()
+	return ret
+}
+
+// orphans returns the output files in the state that are no longer in the
+// manifest and are deleted: with -prune, or after confirmation. Only files
+// that sync created, and that didn't change since it last wrote them, are
+// deleted; others are kept in the state, with a warning, until they are
+// removed (see verify).
+func (cmd *SyncCommand) orphans(state *syncState, outputs map[string]bool) ([]string, error) {
+	var orphans []string
+	for output, last := range state.Files {
+		if outputs[output] {
+			continue
+		}
+		hash, err := hashFile(output)
+		switch {
+		case err != nil:
+			return nil, err
+		case hash == "":
+			delete(state.Files, output)
+		case !last.Created:
+			cmd.ui.Warn(fmt.Sprintf("warning: %s is no longer in the manifest; it existed before sync wrote it, and is not deleted", output))
+		case hash != last.Content:
+			cmd.ui.Warn(fmt.Sprintf("warning: %s is no longer in the manifest; it changed since sync wrote it, and is not deleted", output))
+		case !DryRun && cmd.checkWritable(output) != nil:
+			cmd.ui.Warn(fmt.Sprintf("warning: %s is no longer in the manifest; it is not writable in read-only mode, and is not deleted", output))
+		default:
+			orphans = append(orphans, output)
+		}
+	}
+	sort.Strings(orphans)
+	if len(orphans) == 0 || cmd.prune {
+		return orphans, nil
+	}
+	if cmd.sub == "" && (assumeYes() || IsTerminal(os.Stdin.Fd())) {
+		changes := make([]string, len(orphans))
+		for i, output := range orphans {
+			changes[i] = "- " + output
+		}
+		if ok, err := cmd.confirmChanges(false, changes, "Delete %d files that are no longer in the manifest?", len(orphans)); err != nil {
+			return nil, err
+		} else if ok {
+			return orphans, nil
+		}
+	}
+	for _, output := range orphans {
+		cmd.ui.Warn(fmt.Sprintf("warning: %s is no longer in the manifest, use -prune to delete it", output))
+	}
+	return nil, nil
+}
+
+// each calls fn for 0 to n-1 with cmd.concurrency workers
+func (cmd *SyncCommand) each(n int, fn func(i int)) {
+	var (
+		jobs = make(chan int)
+		wait sync.WaitGroup
+	)
+	for w := 0; w < cmd.concurrency && w < n; w++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wait.Wait()
+}
+
+// plan renders the file, if the template, the output file or one of the
+// secrets changed since the last render; nil is returned if nothing changed
+func (cmd *SyncCommand) plan(client *Client, f syncFile, last *syncFileState, result *syncResult) (*syncAction, error) {
+	mode, err := cmd.fileMode(f)
+	if err != nil {
+		return nil, err
+	} else if err = checkOutputMode(mode); err != nil {
+		return nil, err
+	}
+	owner, err := lookupOwner(f.Owner, f.Group)
+	if err != nil {
+		return nil, err
+	}
+	templateHash, err := f.templateHash()
+	if err != nil {
+		return nil, err
+	}
+	contentHash, err := hashFile(f.Output)
+	if err != nil {
+		return nil, err
+	}
+	xattrs := outputXattrs(f.SELinux, f.Xattrs)
+	current := contentHash == "" || attributed(f.Output, owner, xattrs)
+
+	if !cmd.force && current && last != nil && last.Template == templateHash && last.Content == contentHash {
+		changed, err := cmd.changed(client, last.Secrets, result)
+		if err != nil {
+			return nil, err
+		} else if !changed {
+			result.debugf("sync: %s is up to date", f.Output)
+			return nil, nil
+		}
+	}
+
+	content, versions, err := cmd.render(client, f)
+	if err != nil {
+		return nil, err
+	}
+	action := &syncAction{
+		file:   f,
+		mode:   mode,
+		owner:  owner,
+		xattrs: xattrs,
+		create: contentHash == "",
+		state: &syncFileState{
+			Template: templateHash,
+			Content:  contentHash,
+			Secrets:  versions,
+			Created:  contentHash == "" || (last != nil && last.Created),
+		},
+	}
+	if content == nil {
+		// A post-processor handled the output
+		return action, nil
+	}
+	if hashBytes(content) == contentHash && current {
+		result.debugf("sync: %s is unchanged", f.Output)
+		return action, nil
+	}
+	action.content = content
+	return action, nil
+}
+
+// templateHash returns the hash of the template of f, or of the recipe and
+// its secret
+func (f syncFile) templateHash() (string, error) {
+	if f.Recipe != "" {
+		return hashBytes([]byte("recipe " + f.Recipe + " " + f.Secret)), nil
+	}
+	b, err := ioutil.ReadFile(f.Template)
+	if err != nil {
+		return "", err
+	}
+	return hashBytes(b), nil
+}
+
+// render renders the template (or the recipe) of f in memory, reading each secret once per
+// run; it returns the post-processed contents, or nil if a post-processor
+// handled the output, and the versions of the secrets that were used
+func (cmd *SyncCommand) render(client *Client, f syncFile) ([]byte, map[string]string, error) {
+	t := &TemplateCommand{baseCommand: cmd.baseCommand}
+	t.c, t.out = client, f.Output
+	t.read = func(path string) (*api.Secret, error) {
+		return cmd.read(t, client, path)
+	}
+	var (
+		b        []byte
+		versions = make(map[string]string)
+	)
+	if f.Recipe != "" {
+		secret, err := t.read(f.Secret)
+		if err != nil {
+			return nil, nil, err
+		} else if secret == nil {
+			return nil, nil, notFound(fmt.Sprintf("secret %s: not found", f.Secret))
+		}
+		if b, err = recipes[f.Recipe](secret.Data); err != nil {
+			return nil, nil, fmt.Errorf("recipe %s: %s: %v", f.Recipe, f.Secret, err)
+		}
+		versions[f.Secret] = syncVersion(cmd.secret(f.Secret))
+	} else {
+		tmpl, err := t.parseTemplate(f.Template, f.Templating)
+		if err != nil {
+			return nil, nil, err
+		}
+		s, err := t.executeTemplate(tmpl)
+		if err != nil {
+			return nil, nil, err
+		}
+		b = []byte(s)
+		for path := range t.lookup {
+			versions[path] = syncVersion(cmd.secret(path))
+		}
+		for path := range t.decode {
+			versions[path] = syncVersion(cmd.secret(path))
+		}
+	}
+	metrics.add(rendersTotal, 1)
+
+	transforms, err := parseTransforms(f.Transform)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b, err = applyTransforms(transforms, b); err != nil {
+		return nil, nil, err
+	}
+	content, err := t.postProcess(f.Post, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, versions, nil
+}
+
+// changed checks if any of the secrets changed since the last render; KV v2
+// secrets are checked by the version in their metadata, without reading them
+func (cmd *SyncCommand) changed(client *Client, versions map[string]string, result *syncResult) (bool, error) {
+	for path, version := range versions {
+		current, err := cmd.version(client, path, version)
+		if err != nil {
+			return false, err
+		} else if current != version {
+			result.debugf("sync: %s changed (%s to %s)", path, version, current)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// versionOf returns the version of the secret at path that was recorded for
+// the first of outputs
+func (state *syncState) versionOf(path string, outputs []string) string {
+	return state.Files[outputs[0]].Secrets[path]
+}
+
+// once returns the read for key in reads, and whether it is new; if it isn't,
+// once waits until it is done
+func (cmd *SyncCommand) once(reads *map[string]*syncRead, key string) (*syncRead, bool) {
+	cmd.mutex.Lock()
+	if *reads == nil {
+		*reads = make(map[string]*syncRead)
+	}
+	r, ok := (*reads)[key]
+	if !ok {
+		r = &syncRead{done: make(chan struct{})}
+		(*reads)[key] = r
+	}
+	cmd.mutex.Unlock()
+	if ok {
+		<-r.done
+	}
+	return r, !ok
+}
+
+// version returns the current version of the secret at path, checked once
+// per run
+func (cmd *SyncCommand) version(c *Client, path, last string) (string, error) {
+	r, ok := cmd.once(&cmd.versions, path)
+	if ok {
+		r.version, r.err = cmd.readVersion(c, path, last)
+		close(r.done)
+	}
+	return r.version, r.err
+}
+
+// readVersion reads the current version of the secret at path
+func (cmd *SyncCommand) readVersion(c *Client, path, last string) (string, error) {
+	if _, _, ok := splitScheme(path); !ok && strings.HasPrefix(last, "v") {
+		mount, info, rel, err := c.MountFor(path)
+		if err == nil && client.KVVersion(info) == 2 && strings.HasPrefix(rel, "data/") {
+			secret, err := c.Read(mount + "metadata/" + strings.TrimPrefix(rel, "data/"))
+			if err != nil {
+				return "", err
+			} else if secret == nil || secret.Data["current_version"] == nil {
+				return "", nil
+			}
+			cmd.hint(path, 0, secret.Data)
+			return fmt.Sprintf("v%v", secret.Data["current_version"]), nil
+		}
+	}
+	secret, err := cmd.read(&TemplateCommand{baseCommand: cmd.baseCommand}, c, path)
+	if err != nil {
+		return "", err
+	} else if secret == nil {
+		return "", nil
+	}
+	return syncVersion(secret), nil
+}
+
+// read reads the secret at path for template t, once per run; a copy is
+// returned, because templates modify the data
+func (cmd *SyncCommand) read(t *TemplateCommand, client *Client, path string) (*api.Secret, error) {
+	r, ok := cmd.once(&cmd.secrets, path)
+	if ok {
+		if r.secret, r.err = t.readSource(path, client.Read); r.secret != nil {
+			trackLease(client, r.secret.LeaseID)
+			metadata, _ := r.secret.Data["metadata"].(map[string]interface{})
+			cmd.hint(path, r.secret.LeaseDuration, metadata)
+		}
+		close(r.done)
+	}
+	if r.err != nil {
+		return nil, r.err
+	} else if r.secret == nil {
+		return nil, nil
+	}
+	copied := *r.secret
+	copied.Data = make(map[string]interface{}, len(r.secret.Data))
+	for key, value := range r.secret.Data {
+		copied.Data[key] = value
+	}
+	return &copied, nil
+}
+
+// secret returns the secret at path that was read in this run
+func (cmd *SyncCommand) secret(path string) *api.Secret {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	if r, ok := cmd.secrets[path]; ok {
+		return r.secret
+	}
+	return nil
+}
+
+// apply writes the output file of action
+func (cmd *SyncCommand) apply(action syncAction) error {
+	defer wipe(action.content)
+	cmd.owner, cmd.xattrs = action.owner, action.xattrs
+	w := cmd.outputWriter(action.file.Output, action.mode)
+	if _, err := w.Write(action.content); err != nil {
+		if sw, ok := w.(interface {
+			abort()
+		}); ok {
+			sw.abort()
+		}
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	// With EncryptTo, the file has other contents than were rendered
+	hash, err := hashFile(action.file.Output)
+	if err != nil {
+		return err
+	}
+	action.state.Content = hash
+	return nil
+}
+
+func (cmd *SyncCommand) Synopsis() string {
+	switch cmd.sub {
+	case "plan":
+		return "plan a sync, for review"
+	case "apply":
+		return "apply a plan of sync plan"
+	}
+	return "render the templates in a manifest that changed"
+}
+
+func SyncCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &SyncCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet(strings.TrimSpace("sync "+sub), flag.ContinueOnError)
+		if sub != "apply" {
+			cmd.fs.StringVar(&cmd.manifest, "f", "", "manifest file")
+			cmd.fs.BoolVar(&cmd.force, "force", false, "render all templates, ignoring the state")
+			cmd.fs.Var(&cmd.vars, "var", "key=value variable for the outputs, can be repeated")
+		}
+		cmd.fs.StringVar(&cmd.state, "state", "", "state file (default: the manifest name with "+syncStateSuffix+")")
+		cmd.fs.IntVar(&cmd.concurrency, "c", 4, "number of templates rendered at once")
+		switch sub {
+		case "":
+			cmd.fs.BoolVar(&cmd.watch, "watch", false, "keep running, checking each file at its refresh interval")
+			cmd.fs.DurationVar(&cmd.interval, "interval", 5*time.Minute, "refresh interval of files without one, with -watch")
+		case "plan":
+			cmd.fs.StringVar(&cmd.planFile, "out", "", "plan file")
+		}
+		if sub != "apply" {
+			cmd.fs.BoolVar(&cmd.prune, "prune", false, "delete the files that sync created and are no longer in the manifest")
+		}
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,487 @@
+package vc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+)
+
+func TestSyncCommand(t *testing.T) {
+	var (
+		password = "secret"
+		version  = 1
+		reads    = make(map[string]int)
+		mutex    sync.Mutex
+	)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reads[r.URL.Path]++
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/secret/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": password}}
+		case "/v1/secret/vpn":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"private_key": testWireGuardKey,
+				"address":     "10.0.0.2/32",
+				"public_key":  testWireGuardPeer,
+			}}
+		case "/v1/secret2/metadata/app":
+			response = map[string]interface{}{"data": map[string]interface{}{"current_version": version}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv", "secret2/": "kv-v2"})
+
+	dir, err := ioutil.TempDir(os.TempDir(), "sync")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"db.tpl": `password={{ secret "secret/db" "password" }}`,
+		"sync.yaml": `files:
+  - template: db.tpl
+    output: db.ini
+    templating: text
+  - recipe: wireguard
+    secret: secret/vpn
+    output: wg0.conf
+`,
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Skip(err)
+		}
+	}
+	output := filepath.Join(dir, "db.ini")
+	wg := filepath.Join(dir, "wg0.conf")
+
+	run := func() string {
+		ui := cli.NewMockUi()
+		command, _ := SyncCommandFactory(ui, "")()
+		cmd := command.(*SyncCommand)
+		cmd.c, cmd.config = c, new(Config)
+		if code := cmd.Run([]string{"-f", filepath.Join(dir, "sync.yaml")}); code != Success {
+			t.Fatalf("expected success, got %d: %s", code, ui.ErrorWriter.String())
+		}
+		return ui.OutputWriter.String()
+	}
+	if out := run(); out != "+ "+output+"\n+ "+wg+"\nplan: 2 to create, 0 to update, 0 unchanged\n" {
+		t.Fatalf("unexpected plan %q", out)
+	}
+	if b, _ := ioutil.ReadFile(output); string(b) != "password=secret" {
+		t.Fatalf("unexpected output %q", b)
+	}
+	if b, _ := ioutil.ReadFile(wg); !strings.HasPrefix(string(b), "[Interface]\nPrivateKey = "+testWireGuardKey+"\n") {
+		t.Fatalf("unexpected recipe output %q", b)
+	}
+	if info, err := os.Stat(wg); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600 for the recipe output, got %v (%v)", info.Mode(), err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "sync.yaml"+syncStateSuffix)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing changed, the secret is read once to compare its hash
+	if out := run(); out != "plan: 0 to create, 0 to update, 2 unchanged\n" {
+		t.Fatalf("unexpected plan %q", out)
+	}
+	if n := reads["/v1/secret/db"]; n != 2 {
+		t.Fatalf("expected 2 reads of secret/db, got %d", n)
+	}
+
+	password = "changed"
+	if out := run(); out != "~ "+output+"\nplan: 0 to create, 1 to update, 1 unchanged\n" {
+		t.Fatalf("unexpected plan %q", out)
+	}
+	if b, _ := ioutil.ReadFile(output); string(b) != "password=changed" {
+		t.Fatalf("unexpected output %q", b)
+	}
+
+	// Changes to the output file are reverted
+	if err = ioutil.WriteFile(output, []byte("edited"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if out := run(); out != "~ "+output+"\nplan: 0 to create, 1 to update, 1 unchanged\n" {
+		t.Fatalf("unexpected plan %q", out)
+	}
+
+	// KV v2 secrets are compared by the version in their metadata, without
+	// reading their data
+	cmd := &SyncCommand{baseCommand: baseCommand{c: c}}
+	if changed, err := cmd.changed(c, map[string]string{"secret2/data/app": "v1"}, new(syncResult)); err != nil || changed {
+		t.Fatalf("expected no change, got %t (%v)", changed, err)
+	}
+	version = 2
+	cmd = &SyncCommand{baseCommand: baseCommand{c: c}}
+	if changed, err := cmd.changed(c, map[string]string{"secret2/data/app": "v1"}, new(syncResult)); err != nil || !changed {
+		t.Fatalf("expected change, got %t (%v)", changed, err)
+	}
+	if reads["/v1/secret2/data/app"] != 0 {
+		t.Fatal("expected no reads of secret2/data/app")
+	}
+}
+
+func TestSyncConcurrent(t *testing.T) {
+	var (
+		mutex sync.Mutex
+		reads = make(map[string]int)
+	)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		reads[r.URL.Path]++
+		mutex.Unlock()
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/secret/db", "/v1/secret/app":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "secret"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	dir, err := ioutil.TempDir(os.TempDir(), "sync")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := "files:\n"
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("%02d", i)
+		text := `{{ secret "secret/db" "password" }} {{ secret "secret/app" "password" }}`
+		if i == 7 {
+			text = `{{ secret "secret/missing" "password" }}`
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, name+".tpl"), []byte(text), 0600); err != nil {
+			t.Skip(err)
+		}
+		manifest += fmt.Sprintf("  - template: %s.tpl\n    output: %s.conf\n    templating: text\n", name, name)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "sync.yaml"), []byte(manifest), 0600); err != nil {
+		t.Skip(err)
+	}
+
+	ui := cli.NewMockUi()
+	command, _ := SyncCommandFactory(ui, "")()
+	cmd := command.(*SyncCommand)
+	cmd.c, cmd.config = c, new(Config)
+	if code := cmd.Run([]string{"-c", "8", "-f", filepath.Join(dir, "sync.yaml")}); code != NotFoundError {
+		t.Fatalf("expected not found, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if n := reads["/v1/secret/db"] + reads["/v1/secret/app"]; n != 2 {
+		t.Fatalf("expected each secret to be read once, got %v", reads)
+	}
+	if !strings.HasPrefix(ui.OutputWriter.String(), "+ "+filepath.Join(dir, "00.conf")+"\n+ "+filepath.Join(dir, "01.conf")+"\n") {
+		t.Fatalf("expected the plan in order, got %q", ui.OutputWriter.String())
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "plan: 19 to create, 0 to update, 0 unchanged") {
+		t.Fatalf("unexpected plan %q", ui.OutputWriter.String())
+	}
+	if !strings.Contains(ui.ErrorWriter.String(), "07.conf") {
+		t.Fatalf("expected error for 07.conf, got %q", ui.ErrorWriter.String())
+	}
+}
+
+func TestSyncExpandOutputs(t *testing.T) {
+	m := &syncManifest{
+		State: "/var/lib/vc/{{ .Env }}.state",
+		Vars:  map[string]string{"Env": "dev", "App": "web"},
+		Files: []syncFile{
+			{Template: "/a.tpl", Output: "/etc/app/{{ .Env }}/db.conf"},
+			{Template: "/b.tpl", Output: `/etc/{{ .App }}/{{ secret "secret/app" "name" }}.conf`},
+			{Template: "/c.tpl", Output: "out/{{ .Env }}.conf"},
+		},
+		dir: "/srv",
+	}
+	read := func(path string) (*api.Secret, error) {
+		return &api.Secret{Data: map[string]interface{}{"name": "api"}}, nil
+	}
+	if err := m.expandOutputs(map[string]string{"Env": "prod"}, read); err != nil {
+		t.Fatal(err)
+	}
+	if m.State != "/var/lib/vc/prod.state" {
+		t.Fatalf("unexpected state %q", m.State)
+	}
+	for i, expect := range []string{"/etc/app/prod/db.conf", "/etc/web/api.conf", "/srv/out/prod.conf"} {
+		if m.Files[i].Output != expect {
+			t.Fatalf("file %d: expected %q, got %q", i+1, expect, m.Files[i].Output)
+		}
+	}
+
+	for _, test := range []struct {
+		path, env string
+	}{
+		{"/etc/app/{{ .Env }}/db.conf", "../../shadow"},
+		{"/etc/app/{{ .Env }}/db.conf", "prod/.."},
+		{"/etc/app-{{ .Env }}/db.conf", "/../passwd"},
+		{"{{ .Env }}", "/etc/passwd"},
+		{"/etc/app/{{ .Missing }}", "prod"},
+		{"/etc/app/{{ .Env }}", "prod/"},
+	} {
+		if path, err := expandSyncPath(test.path, map[string]string{"Env": test.env}, nil); err == nil {
+			t.Fatalf("%s with %q: expected an error, got %q", test.path, test.env, path)
+		}
+	}
+
+	m = &syncManifest{Files: []syncFile{
+		{Template: "/a.tpl", Output: "/etc/{{ .Env }}.conf"},
+		{Template: "/b.tpl", Output: "/etc/prod.conf"},
+	}}
+	if err := m.expandOutputs(map[string]string{"Env": "prod"}, read); err == nil {
+		t.Fatal("expected an error for files with the same output")
+	}
+}
+
+func TestSyncRefresh(t *testing.T) {
+	cmd := &SyncCommand{interval: 5 * time.Minute}
+	cmd.hint("database/creds/app", 3600, nil)
+	cmd.hint("secret2/data/app", 0, map[string]interface{}{
+		"custom_metadata": map[string]interface{}{SyncRefreshMetadataKey: "10m"},
+	})
+	cmd.hint("secret2/data/slow", 0, map[string]interface{}{
+		"custom_metadata": map[string]interface{}{SyncRefreshMetadataKey: "never"},
+	})
+
+	state := func(paths ...string) *syncFileState {
+		last := &syncFileState{Secrets: make(map[string]string)}
+		for _, path := range paths {
+			last.Secrets[path] = "v1"
+		}
+		return last
+	}
+	tests := []struct {
+		file syncFile
+		last *syncFileState
+		want time.Duration
+	}{
+		{syncFile{Refresh: "30s"}, state("database/creds/app"), 30 * time.Second},
+		{syncFile{}, state("database/creds/app"), 40 * time.Minute},
+		{syncFile{}, state("database/creds/app", "secret2/data/app"), 10 * time.Minute},
+		{syncFile{}, state("secret2/data/slow"), 5 * time.Minute},
+		{syncFile{}, nil, 5 * time.Minute},
+	}
+	for _, test := range tests {
+		if got := cmd.refresh(test.file, test.last); got != test.want {
+			t.Errorf("%+v: expected %s, got %s", test.last, test.want, got)
+		}
+	}
+
+	dir, err := ioutil.TempDir(os.TempDir(), "sync")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "sync.yaml")
+	if err = ioutil.WriteFile(name, []byte("files:\n  - template: a.tpl\n    output: a\n    refresh: soon\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loadSyncManifest(name); err == nil || !strings.Contains(err.Error(), "invalid refresh") {
+		t.Fatalf("expected invalid refresh, got %v", err)
+	}
+}
+
+func TestSyncPlan(t *testing.T) {
+	password := "secret"
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/secret/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": password}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	dir, err := ioutil.TempDir(os.TempDir(), "sync")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	var (
+		manifest = filepath.Join(dir, "sync.yaml")
+		output   = filepath.Join(dir, "db.ini")
+		planFile = filepath.Join(dir, "sync.plan")
+	)
+	if err = ioutil.WriteFile(filepath.Join(dir, "db.tpl"), []byte(`password={{ secret "secret/db" "password" }}`), 0600); err != nil {
+		t.Skip(err)
+	}
+	writeManifest := func(files string) {
+		if err := ioutil.WriteFile(manifest, []byte("files:\n"+files), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeManifest("  - template: db.tpl\n    output: db.ini\n    templating: text\n")
+
+	run := func(sub string, args ...string) (string, int) {
+		ui := cli.NewMockUi()
+		command, _ := SyncCommandFactory(ui, sub)()
+		cmd := command.(*SyncCommand)
+		cmd.c, cmd.config = c, new(Config)
+		code := cmd.Run(args)
+		return ui.OutputWriter.String() + ui.ErrorWriter.String(), code
+	}
+
+	// Planning writes the plan, not the files
+	out, code := run("plan", "-f", manifest, "-out", planFile)
+	if code != Success {
+		t.Fatalf("plan: expected success, got %d: %s", code, out)
+	}
+	if !strings.HasPrefix(out, "read secret/db\n+ "+output+"\nplan: 1 to create, 0 to update, 0 unchanged\n") {
+		t.Fatalf("plan: unexpected output %q", out)
+	}
+	if _, err = os.Stat(output); !os.IsNotExist(err) {
+		t.Fatalf("plan: expected %s not to be written, got %v", output, err)
+	}
+	if b, _ := ioutil.ReadFile(planFile); strings.Contains(string(b), "password") {
+		t.Fatalf("plan: expected no secrets in the plan, got %s", b)
+	}
+	if out, code = run("apply", planFile); code != Success {
+		t.Fatalf("apply: expected success, got %d: %s", code, out)
+	}
+	if b, _ := ioutil.ReadFile(output); string(b) != "password=secret" {
+		t.Fatalf("apply: unexpected output %q", b)
+	}
+
+	// Secrets that change after the plan fail the apply
+	password = "changed"
+	if out, code = run("plan", "-f", manifest, "-out", planFile); code != Success {
+		t.Fatalf("plan: expected success, got %d: %s", code, out)
+	}
+	password = "changed again"
+	if out, code = run("apply", planFile); code != ConflictError {
+		t.Fatalf("apply: expected conflict, got %d: %s", code, out)
+	}
+	if b, _ := ioutil.ReadFile(output); string(b) != "password=secret" {
+		t.Fatalf("apply: expected %s not to be written, got %q", output, b)
+	}
+	if out, code = run("plan", "-f", manifest, "-out", planFile); code != Success {
+		t.Fatalf("plan: expected success, got %d: %s", code, out)
+	}
+	if out, code = run("apply", planFile); code != Success {
+		t.Fatalf("apply: expected success, got %d: %s", code, out)
+	}
+	if b, _ := ioutil.ReadFile(output); string(b) != "password=changed again" {
+		t.Fatalf("apply: unexpected output %q", b)
+	}
+
+	// Files that are no longer in the manifest are deleted with -prune
+	writeManifest("")
+	if out, code = run("plan", "-f", manifest, "-out", planFile, "-prune"); code != Success {
+		t.Fatalf("plan: expected success, got %d: %s", code, out)
+	}
+	if !strings.Contains(out, "- "+output+"\nplan: 0 to create, 0 to update, 1 to delete, 0 unchanged\n") {
+		t.Fatalf("plan: unexpected output %q", out)
+	}
+	if out, code = run("apply", planFile); code != Success {
+		t.Fatalf("apply: expected success, got %d: %s", code, out)
+	}
+	if _, err = os.Stat(output); !os.IsNotExist(err) {
+		t.Fatalf("apply: expected %s to be deleted, got %v", output, err)
+	}
+}
+
+func TestSyncPrune(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/secret/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "secret"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	dir, err := ioutil.TempDir(os.TempDir(), "sync")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := filepath.Join(dir, "sync.yaml")
+	for name, content := range map[string]string{
+		"db.tpl":     `password={{ secret "secret/db" "password" }}`,
+		"existing.1": "replaced",
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Skip(err)
+		}
+	}
+	var files string
+	for _, output := range []string{"created.1", "created.2", "existing.1"} {
+		files += "  - template: db.tpl\n    output: " + output + "\n    templating: text\n"
+	}
+	if err = ioutil.WriteFile(manifest, []byte("files:\n"+files), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) string {
+		ui := cli.NewMockUi()
+		command, _ := SyncCommandFactory(ui, "")()
+		cmd := command.(*SyncCommand)
+		cmd.c, cmd.config = c, new(Config)
+		if code := cmd.Run(append(args, "-f", manifest)); code != Success {
+			t.Fatalf("%v: expected success, got %d: %s", args, code, ui.ErrorWriter.String())
+		}
+		return ui.OutputWriter.String() + ui.ErrorWriter.String()
+	}
+	run()
+	if err = ioutil.WriteFile(manifest, []byte("files:\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "created.2"), []byte("changed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without -prune, nothing is deleted
+	out := run()
+	if !strings.Contains(out, "created.1 is no longer in the manifest, use -prune to delete it") {
+		t.Fatalf("expected a warning, got %q", out)
+	}
+	for _, name := range []string{"created.1", "created.2", "existing.1"} {
+		if _, err = os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only files that sync created, and that didn't change, are deleted
+	out = run("-prune")
+	if !strings.Contains(out, "- "+filepath.Join(dir, "created.1")+"\nplan: 0 to create, 0 to update, 1 to delete, 0 unchanged\n") {
+		t.Fatalf("unexpected plan %q", out)
+	}
+	if !strings.Contains(out, "created.2 is no longer in the manifest; it changed") || !strings.Contains(out, "existing.1 is no longer in the manifest; it existed") {
+		t.Fatalf("expected warnings for the files that are kept, got %q", out)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "created.1")); !os.IsNotExist(err) {
+		t.Fatalf("expected created.1 to be deleted, got %v", err)
+	}
+	for _, name := range []string{"created.2", "existing.1"} {
+		if _, err = os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state, err := loadSyncState(manifest + syncStateSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Files) != 2 || state.Files[filepath.Join(dir, "created.1")] != nil {
+		t.Fatalf("expected the deleted file to be removed from the state, got %v", state.Files)
+	}
+}
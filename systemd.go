@@ -0,0 +1,351 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// Default directories for credentials, these are searched by systemd for
+// LoadCredential= and LoadCredentialEncrypted= without an explicit path
+const (
+	systemdCredentialDir          = "/etc/credstore"
+	systemdEncryptedCredentialDir = "/etc/credstore.encrypted"
+)
+
+// systemdCreds is the systemd-creds binary, used for encryption
+var systemdCreds = "systemd-creds"
+
+// systemdNameInvalid matches the characters we do not allow in credential
+// names, which are also used as file names
+var systemdNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// systemdName converts s to a credential name
+func systemdName(s string) string {
+	return strings.Trim(systemdNameInvalid.ReplaceAllString(s, "_"), ".")
+}
+
+// systemdCredentials returns the raw value of each credential for the keys of
+// secrets, with name prefix. If keys are given, only those keys are included.
+// Keys ending in the binary key suffix are decoded, other non-string values
+// are JSON encoded.
+func systemdCredentials(paths []string, secrets []map[string]interface{}, keys []string, prefix string) (map[string][]byte, error) {
+	var (
+		include = make(map[string]bool)
+		used    = make(map[string]bool)
+		creds   = make(map[string][]byte)
+		origin  = make(map[string]string)
+	)
+	for _, key := range keys {
+		include[key] = true
+	}
+
+	for i, secret := range secrets {
+		names := make([]string, 0, len(secret))
+		for key := range secret {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+
+		for _, key := range names {
+			if key == CodecTypeKey || (len(include) > 0 && !include[key]) {
+				continue
+			}
+			used[key] = true
+
+			var (
+				name  = key
+				value []byte
+				err   error
+			)
+			switch v := secret[key].(type) {
+			case string:
+				value = []byte(v)
+				if strings.HasSuffix(key, binaryKeySuffix) {
+					name = strings.TrimSuffix(key, binaryKeySuffix)
+					if value, err = base64.StdEncoding.DecodeString(v); err != nil {
+						return nil, fmt.Errorf("%s: key %s: %v", paths[i], key, err)
+					}
+				}
+			default:
+				if value, err = json.Marshal(v); err != nil {
+					return nil, fmt.Errorf("%s: key %s: %v", paths[i], key, err)
+				}
+			}
+
+			if name = systemdName(prefix + name); name == "" {
+				return nil, fmt.Errorf("%s: key %s: invalid credential name", paths[i], key)
+			}
+			if other, exists := origin[name]; exists {
+				return nil, fmt.Errorf("credential %s is in both %s and %s; use -k or -prefix", name, other, paths[i])
+			}
+			origin[name] = paths[i]
+			creds[name] = value
+		}
+	}
+
+	for _, key := range keys {
+		if !used[key] {
+			return nil, notFound(fmt.Sprintf("key %s not found", key))
+		}
+	}
+	return creds, nil
+}
+
+// systemdUnit returns the [Service] section that loads the credentials in
+// names from dir
+func systemdUnit(names []string, dir string, encrypted bool) string {
+	directive := "LoadCredential"
+	if encrypted {
+		directive = "LoadCredentialEncrypted"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("[Service]\n")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s=%s:%s\n", directive, name, filepath.Join(dir, name))
+	}
+	return buf.String()
+}
+
+// SystemdCommand writes secrets as systemd credentials
+type SystemdCommand struct {
+	baseCommand
+	fs      *flag.FlagSet
+	sub     string
+	dir     string
+	keys    stringsValue
+	prefix  string
+	encrypt bool
+	withKey string
+	inline  bool
+	mod     string
+}
+
+func (cmd *SystemdCommand) Help() string {
+	if cmd.sub == "unit" {
+		return `Usage: vc systemd unit [<options>] <secret path> [... <secret path>]
+
+Prints the unit file snippet that loads the credentials written by
+"vc systemd creds" with the same options. With -inline, the credentials are
+encrypted with systemd-creds and embedded using SetCredentialEncrypted=, so
+no files are needed. Services read the credentials from the files in
+$CREDENTIALS_DIRECTORY.
+
+Options:
+` + defaults(cmd.fs)
+	}
+	return `Usage: vc systemd creds [<options>] <secret path> [... <secret path>]
+
+Writes each key of the secrets to a file in the credentials directory, for use
+with LoadCredential=. With -encrypt, the values are encrypted with
+systemd-creds for use with LoadCredentialEncrypted=. Use "vc systemd unit"
+to print the matching unit file snippet.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *SystemdCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.resolveAll(cmd.fs.Args()); len(args) == 0 {
+		return Help
+	}
+	if mode, err := strconv.ParseInt(cmd.mod, 8, 32); err != nil {
+		cmd.ui.Error("error: invalid mode: " + err.Error())
+		return SyntaxError
+	} else {
+		cmd.mode = os.FileMode(mode)
+	}
+	if cmd.sub != "unit" {
+		// Units have no secrets
+		if err := checkOutputMode(cmd.mode); err != nil {
+			cmd.ui.Error("error: " + err.Error())
+			return SyntaxError
+		}
+	}
+	if cmd.dir == "" {
+		cmd.dir = systemdCredentialDir
+		if cmd.encrypt {
+			cmd.dir = systemdEncryptedCredentialDir
+		}
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	if args, err = client.expand(args, isSecret); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SyntaxError)
+	}
+
+	var secrets []map[string]interface{}
+	for _, path := range args {
+		secret, err := cmd.readSource(path, client.ReadSecret)
+		if err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, ServerError)
+		}
+		if secret == nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: secret not found", path))
+			return NotFoundError
+		}
+		secrets = append(secrets, secret.Data)
+	}
+
+	creds, err := systemdCredentials(args, secrets, cmd.keys, cmd.prefix)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SyntaxError)
+	}
+	names := make([]string, 0, len(creds))
+	for name := range creds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if cmd.sub == "unit" {
+		return cmd.runUnit(names, creds)
+	}
+
+	if !DryRun {
+		if err = cmd.checkWritableDir(cmd.dir, names); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return exitCode(err, SystemError)
+		}
+		if err = os.MkdirAll(cmd.dir, 0700); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	}
+	for _, name := range names {
+		value := creds[name]
+		if cmd.encrypt {
+			if value, err = cmd.encryptCredential(name, value, false); err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %s: %v", name, err))
+				return SystemError
+			}
+		}
+		w := cmd.outputWriter(filepath.Join(cmd.dir, name), cmd.mode)
+		if _, err = w.Write(value); err != nil {
+			w.Close()
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+		if err = w.Close(); err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %v", err))
+			return SystemError
+		}
+	}
+
+	cmd.ui.Info(fmt.Sprintf("wrote %d credentials to %s", len(names), cmd.dir))
+	return Success
+}
+
+// runUnit writes the unit file snippet for the credentials
+func (cmd *SystemdCommand) runUnit(names []string, creds map[string][]byte) int {
+	unit := systemdUnit(names, cmd.dir, cmd.encrypt)
+	if cmd.inline {
+		var buf bytes.Buffer
+		buf.WriteString("[Service]\n")
+		for _, name := range names {
+			b, err := cmd.encryptCredential(name, creds[name], true)
+			if err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %s: %v", name, err))
+				return SystemError
+			}
+			buf.Write(b)
+		}
+		unit = buf.String()
+	}
+
+	if _, err := cmd.Write([]byte(unit)); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	if err := cmd.Close(); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	return Success
+}
+
+// encryptCredential encrypts value with systemd-creds; if pretty is set, the
+// result is a SetCredentialEncrypted= line
+func (cmd *SystemdCommand) encryptCredential(name string, value []byte, pretty bool) ([]byte, error) {
+	args := []string{"encrypt", "--name=" + name}
+	if cmd.withKey != "" {
+		args = append(args, "--with-key="+cmd.withKey)
+	}
+	if pretty {
+		args = append(args, "--pretty")
+	}
+	args = append(args, "-", "-")
+
+	var stderr bytes.Buffer
+	c := exec.Command(systemdCreds, args...)
+	c.Stdin = bytes.NewReader(value)
+	c.Stderr = &stderr
+	Debugf("systemd: %s %s", systemdCreds, strings.Join(args, " "))
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", systemdCreds, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", systemdCreds, err)
+	}
+	return out, nil
+}
+
+func (cmd *SystemdCommand) Synopsis() string {
+	if cmd.sub == "unit" {
+		return "print a unit file snippet loading systemd credentials"
+	}
+	return "write secrets as systemd credentials"
+}
+
+func SystemdCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &SystemdCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("systemd "+sub, flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.dir, "d", "", "credentials directory (default: "+systemdCredentialDir+", or "+systemdEncryptedCredentialDir+" with -encrypt)")
+		cmd.fs.Var(&cmd.keys, "k", "only include key (can be repeated)")
+		cmd.fs.StringVar(&cmd.prefix, "prefix", "", "prefix for the credential names")
+		cmd.fs.BoolVar(&cmd.encrypt, "encrypt", false, "encrypt the credentials with systemd-creds")
+		cmd.fs.StringVar(&cmd.withKey, "with-key", "", "systemd-creds encryption key (host, tpm2, host+tpm2 or auto)")
+		switch sub {
+		case "creds":
+			cmd.fs.StringVar(&cmd.mod, "m", "0400", "credential file mode")
+		case "unit":
+			cmd.fs.StringVar(&cmd.out, "o", "", "output (default: stdout)")
+			cmd.fs.StringVar(&cmd.mod, "m", "0644", "output mode")
+			cmd.fs.BoolVar(&cmd.inline, "inline", false, "embed the encrypted credentials with SetCredentialEncrypted=")
+		}
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
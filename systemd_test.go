@@ -0,0 +1,102 @@
+package vc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSystemdName(t *testing.T) {
+	tests := []struct {
+		Test string
+		Want string
+	}{
+		{"db_password", "db_password"},
+		{"app.db-password", "app.db-password"},
+		{"api key/v2", "api_key_v2"},
+		{".hidden", "hidden"},
+	}
+	for _, test := range tests {
+		if got := systemdName(test.Test); got != test.Want {
+			t.Fatalf("systemdName(%q): expected %q, got %q", test.Test, test.Want, got)
+		}
+	}
+}
+
+func TestSystemdCredentials(t *testing.T) {
+	var (
+		paths   = []string{"secret/db", "secret/api"}
+		secrets = []map[string]interface{}{
+			{"username": "test", "password": "secret", "cert_base64": "AAEC"},
+			{"token": "s.test", "port": 443},
+		}
+	)
+
+	creds, err := systemdCredentials(paths, secrets, nil, "app.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{
+		"app.username": []byte("test"),
+		"app.password": []byte("secret"),
+		"app.cert":     {0, 1, 2},
+		"app.token":    []byte("s.test"),
+		"app.port":     []byte("443"),
+	}
+	if !reflect.DeepEqual(creds, want) {
+		t.Fatalf("expected %q, got %q", want, creds)
+	}
+
+	if creds, err = systemdCredentials(paths, secrets, []string{"password"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if want = map[string][]byte{"password": []byte("secret")}; !reflect.DeepEqual(creds, want) {
+		t.Fatalf("expected %q, got %q", want, creds)
+	}
+
+	if _, err = systemdCredentials(paths, secrets, []string{"missing"}, ""); ErrorKind(err) != ErrNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if _, err = systemdCredentials([]string{"a", "b"}, []map[string]interface{}{{"key": "a"}, {"key": "b"}}, nil, ""); err == nil {
+		t.Fatal("expected error for duplicate credentials")
+	}
+}
+
+func TestSystemdUnit(t *testing.T) {
+	want := "[Service]\nLoadCredential=password:/etc/credstore/password\n"
+	if got := systemdUnit([]string{"password"}, systemdCredentialDir, false); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	want = "[Service]\nLoadCredentialEncrypted=password:/etc/credstore.encrypted/password\n"
+	if got := systemdUnit([]string{"password"}, systemdEncryptedCredentialDir, true); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSystemdEncryptCredential(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "systemd")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake systemd-creds that echoes its arguments and input
+	name := filepath.Join(dir, "systemd-creds")
+	if err = ioutil.WriteFile(name, []byte("#!/bin/sh\necho \"$@\"\ncat\n"), 0755); err != nil {
+		t.Skip(err)
+	}
+	defer func(saved string) { systemdCreds = saved }(systemdCreds)
+	systemdCreds = name
+
+	cmd := &SystemdCommand{withKey: "host"}
+	out, err := cmd.encryptCredential("password", []byte("secret"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "encrypt --name=password --with-key=host --pretty - -\nsecret"; strings.TrimSpace(string(out)) != want {
+		t.Fatalf("expected %q, got %q", want, out)
+	}
+}
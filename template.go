@@ -3,16 +3,19 @@ package vc
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	htmlTemplate "html/template"
 	"io"
 	"io/ioutil"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
 	textTemplate "text/template"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/mitchellh/cli"
@@ -23,9 +26,39 @@ type TemplateCommand struct {
 	baseCommand
 	fs             *flag.FlagSet
 	mod            string
+	ownerName      string
+	groupName      string
+	label          string
+	xattrs         stringsValue
 	templatingMode string
+	post           stringsValue
+	transform      stringsValue
+	watch          bool
+	strict         bool
+	set            stringsValue
 	lookup         map[string]map[string]string
 	decode         map[string]string
+
+	// creds are the dynamic credentials read during a render, by path; the
+	// template is rendered again by renderBy in watch mode
+	creds    map[string]*api.Secret
+	renderBy time.Time
+
+	// certs are the certificates issued during a render, by path and common
+	// name
+	certs map[string]*api.Secret
+
+	// read reads the secrets, instead of readSource, if set
+	read func(path string) (*api.Secret, error)
+
+	// issue issues the certificates, instead of Vault, if set
+	issue func(path string, data map[string]interface{}) (*api.Secret, error)
+
+	// values are the -set values, the data of the template
+	values map[string]string
+
+	// noEnv disables the env function, for templates of other processes
+	noEnv bool
 }
 
 type template interface {
@@ -48,29 +81,124 @@ func (cmd *TemplateCommand) Run(args []string) int {
 		return cli.RunResultHelp
 	}
 
-	if mode, err := strconv.ParseInt(cmd.mod, 8, 32); err != nil {
-		cmd.ui.Error("error: invalid mode: " + err.Error())
+	if mode, err := cmd.outputMode(cmd.fs, cmd.mod); err != nil {
+		cmd.ui.Error("error: " + err.Error())
 		return 1
 	} else {
-		cmd.mode = os.FileMode(mode)
+		cmd.mode = mode
+	}
+	owner, err := lookupOwner(cmd.ownerName, cmd.groupName)
+	if err != nil {
+		cmd.ui.Error("error: " + err.Error())
+		return 1
+	}
+	cmd.owner = owner
+	xattrs := make(map[string]string, len(cmd.xattrs))
+	for _, pair := range cmd.xattrs {
+		i := strings.IndexByte(pair, '=')
+		if i < 1 {
+			cmd.ui.Error(fmt.Sprintf("error: invalid -xattr %q, expected name=value", pair))
+			return 1
+		}
+		xattrs[pair[:i]] = pair[i+1:]
+	}
+	cmd.baseCommand.xattrs = outputXattrs(cmd.label, xattrs)
+	cmd.values = make(map[string]string, len(cmd.set))
+	for _, pair := range cmd.set {
+		i := strings.IndexByte(pair, '=')
+		if i < 1 {
+			cmd.ui.Error(fmt.Sprintf("error: invalid -set %q, expected key=value", pair))
+			return 1
+		}
+		cmd.values[pair[:i]] = pair[i+1:]
 	}
 
-	t, err := cmd.parseTemplate(args[0], cmd.templatingMode)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	var stopHealth func()
+	for {
+		if ret := cmd.render(args[0]); ret != 0 || !cmd.watch {
+			return ret
+		}
+		if cmd.renderBy.IsZero() {
+			cmd.ui.Info("template: no leases, nothing to watch")
+			return 0
+		}
+		health.render(nil)
+		health.schedule(cmd.renderBy)
+		if client, err := cmd.Client(); err == nil {
+			health.lookupToken(client)
+		}
+		if stopHealth == nil {
+			if stopHealth, err = startHealth(); err != nil {
+				cmd.ui.Error(fmt.Sprintf("error: %v", err))
+				return 1
+			}
+			defer stopHealth()
+		}
+
+		// Render again with new credentials before the leases expire
+		wait := time.Until(cmd.renderBy)
+		Debugf("template: rendering %s again in %s", args[0], wait)
+		select {
+		case <-time.After(wait):
+		case <-interrupt:
+			return 0
+		case <-shuttingDown():
+			return 0
+		}
+		if cmd.out != "" {
+			cmd.w = nil
+		}
+	}
+}
+
+// render renders the template in file name to the output
+func (cmd *TemplateCommand) render(name string) int {
+	t, err := cmd.parseTemplate(name, cmd.templatingMode)
 	if err != nil {
 		cmd.ui.Error("error: " + err.Error())
 		return 1
 	}
 
+	span := startSpan("template.render", spanInternal, "template.name", name)
 	s, err := cmd.executeTemplate(t)
+	span.finish(err)
 	if err != nil {
+		cmd.ui.Error("error: " + err.Error())
+		return exitCode(err, 1)
+	}
+	metrics.add(rendersTotal, 1)
+
+	transforms, err := parseTransforms(cmd.transform)
+	if err != nil {
+		cmd.ui.Error("error: " + err.Error())
+		return 1
+	}
+	b, err := applyTransforms(transforms, []byte(s))
+	if err != nil {
+		cmd.ui.Error("error: " + err.Error())
+		return 1
+	}
+
+	if b, err = cmd.postProcess(cmd.post, b); err != nil {
 		cmd.ui.Error("error: " + err.Error())
 		return 1
+	} else if b == nil {
+		releaseLeases()
+		return 0
 	}
 
-	if _, err = cmd.Write([]byte(s)); err != nil {
+	if _, err = cmd.Write(b); err != nil {
 		cmd.ui.Error("error: " + err.Error())
 		return 1
 	}
+	if err = cmd.Close(); err != nil {
+		cmd.ui.Error("error: " + err.Error())
+		return 1
+	}
+	releaseLeases()
 
 	return 0
 }
@@ -80,20 +208,36 @@ func (cmd *TemplateCommand) parseTemplate(name string, templatingMode string) (t
 	if err != nil {
 		return nil, err
 	}
+	return cmd.parseTemplateText(name, string(b), templatingMode)
+}
 
+// parseTemplateText parses the template text, with the functions of vc
+func (cmd *TemplateCommand) parseTemplateText(name, text string, templatingMode string) (template, error) {
 	switch templatingMode {
 	case "text":
 		return textTemplate.New(name).Funcs(textTemplate.FuncMap{
-			"decode": cmd.templateDecode,
-			"secret": cmd.templateSecret,
-			"nested": cmd.templateNested,
-		}).Parse(string(b))
+			"decode":      cmd.templateDecode,
+			"secret":      cmd.templateSecret,
+			"nested":      cmd.templateNested,
+			"dbCreds":     cmd.templateDBCreds,
+			"awsCreds":    cmd.templateAWSCreds,
+			"merge":       cmd.templateMerge,
+			"pkiCert":     cmd.templatePKICert,
+			"verifyChain": templateVerifyChain,
+			"env":         cmd.templateEnv,
+		}).Option(cmd.missingKey()).Parse(text)
 	case "html":
 		return htmlTemplate.New(name).Funcs(htmlTemplate.FuncMap{
-			"decode": cmd.templateDecode,
-			"secret": cmd.templateSecret,
-			"nested": cmd.templateNested,
-		}).Parse(string(b))
+			"decode":      cmd.templateDecode,
+			"secret":      cmd.templateSecret,
+			"nested":      cmd.templateNested,
+			"dbCreds":     cmd.templateDBCreds,
+			"awsCreds":    cmd.templateAWSCreds,
+			"merge":       cmd.templateMerge,
+			"pkiCert":     cmd.templatePKICert,
+			"verifyChain": templateVerifyChain,
+			"env":         cmd.templateEnv,
+		}).Option(cmd.missingKey()).Parse(text)
 	default:
 		return nil, fmt.Errorf("unknown templating mode %s", templatingMode)
 	}
@@ -103,12 +247,19 @@ func (cmd *TemplateCommand) executeTemplate(t template) (content string, err err
 	// Prepare lookup tables
 	cmd.lookup = make(map[string]map[string]string)
 	cmd.decode = make(map[string]string)
+	cmd.creds = make(map[string]*api.Secret)
+	cmd.certs = make(map[string]*api.Secret)
+	cmd.renderBy = time.Time{}
 
 	// Execute template: first run; here we make an inventory of what secrets are
 	// required. The secret lookups will be replaced by placeholders in the
 	// templateSecret function.
 	w := new(bytes.Buffer)
-	if err = t.Execute(w, struct{}{}); err != nil {
+	values := cmd.values
+	if values == nil {
+		values = make(map[string]string)
+	}
+	if err = t.Execute(w, values); err != nil {
 		return
 	}
 	content = w.String()
@@ -137,11 +288,11 @@ func (cmd *TemplateCommand) executeTemplateDecodes(client *Client, input string)
 
 	for path, k := range cmd.decode {
 		var secret *api.Secret
-		if secret, err = client.Logical().Read(path); err != nil {
+		if secret, err = cmd.readSecret(client, path); err != nil {
 			return "", err
 		}
 		if secret == nil || secret.Data == nil {
-			return "", fmt.Errorf("decode %s: not found", path)
+			return "", notFound(fmt.Sprintf("decode %s: not found", path))
 		}
 
 		encoderType, ok := secret.Data[CodecTypeKey].(string)
@@ -172,11 +323,11 @@ func (cmd *TemplateCommand) executeTemplateSecrets(client *Client, input string)
 	// For each of the secret paths, lookup the secret
 	for path, kv := range cmd.lookup {
 		var secret *api.Secret
-		if secret, err = client.Logical().Read(strings.TrimLeft(path, "/")); err != nil {
+		if secret, err = cmd.readSecret(client, path); err != nil {
 			return "", err
 		}
 		if secret == nil {
-			return "", fmt.Errorf("secret %s: not found", path)
+			return "", notFound(fmt.Sprintf("secret %s: not found", path))
 		}
 
 		// For each of the secret keys, lookup the value
@@ -200,11 +351,11 @@ func (cmd *TemplateCommand) executeTemplateNested(client *Client, input string)
 	// For each of the secret paths, lookup the secret
 	for path, kv := range cmd.lookup {
 		var secret *api.Secret
-		if secret, err = client.Logical().Read(strings.TrimLeft(path, "/")); err != nil {
+		if secret, err = cmd.readSecret(client, path); err != nil {
 			return "", err
 		}
 		if secret == nil {
-			return "", fmt.Errorf("nested %s: not found", path)
+			return "", notFound(fmt.Sprintf("nested %s: not found", path))
 		}
 
 		// For each of the secret keys, lookup the value
@@ -242,7 +393,20 @@ func (cmd *TemplateCommand) executeTemplateNested(client *Client, input string)
 	return
 }
 
+// readSecret reads the secret at path, from Vault or a source plugin
+func (cmd *TemplateCommand) readSecret(client *Client, path string) (*api.Secret, error) {
+	if cmd.read != nil {
+		return cmd.read(path)
+	}
+	secret, err := cmd.readSource(path, client.Read)
+	if secret != nil {
+		trackLease(client, secret.LeaseID)
+	}
+	return secret, err
+}
+
 func (cmd *TemplateCommand) templateDecode(path string) string {
+	path = cmd.resolve(path)
 	if _, ok := cmd.decode[path]; !ok {
 		cmd.decode[path] = cmd.randomIdentifier("decode")
 	}
@@ -250,6 +414,7 @@ func (cmd *TemplateCommand) templateDecode(path string) string {
 }
 
 func (cmd *TemplateCommand) templateSecret(path string, key string) string {
+	path = cmd.resolve(path)
 	kv, ok := cmd.lookup[path]
 	if !ok {
 		cmd.lookup[path] = make(map[string]string)
@@ -264,6 +429,7 @@ func (cmd *TemplateCommand) templateSecret(path string, key string) string {
 }
 
 func (cmd *TemplateCommand) templateNested(path string, key string) string {
+	path = cmd.resolve(path)
 	// keys := strings.Split(key, ".")
 
 	kv, ok := cmd.lookup[path]
@@ -279,6 +445,212 @@ func (cmd *TemplateCommand) templateNested(path string, key string) string {
 	return kv[key]
 }
 
+func (cmd *TemplateCommand) templateDBCreds(role string) (map[string]interface{}, error) {
+	return cmd.templateCreds("database", role)
+}
+
+func (cmd *TemplateCommand) templateAWSCreds(role string) (map[string]interface{}, error) {
+	return cmd.templateCreds("aws", role)
+}
+
+// templateCreds reads the dynamic credentials of role from the secrets engine
+// at mount, or at the mount in role given as "<mount>/<role>". The credentials
+// are read once per render, so all their keys are from the same lease.
+func (cmd *TemplateCommand) templateCreds(mount, role string) (map[string]interface{}, error) {
+	if i := strings.LastIndexByte(role, '/'); i > 0 {
+		mount, role = role[:i], role[i+1:]
+	}
+	path := strings.Trim(mount, "/") + "/creds/" + role
+	if secret, ok := cmd.creds[path]; ok {
+		return secret.Data, nil
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := cmd.readSecret(client, path)
+	if err != nil {
+		return nil, err
+	} else if secret == nil || secret.Data == nil {
+		return nil, notFound(fmt.Sprintf("creds %s: not found", path))
+	}
+	cmd.creds[path] = secret
+
+	if secret.LeaseDuration > 0 {
+		cmd.renderAfter(time.Duration(secret.LeaseDuration) * time.Second)
+	}
+	return secret.Data, nil
+}
+
+// templateEnv returns the environment variable name, or the default if it is
+// unset; unset variables without a default fail the render with -strict, and
+// are empty otherwise
+func (cmd *TemplateCommand) templateEnv(name string, defaults ...string) (string, error) {
+	if cmd.noEnv {
+		return "", fmt.Errorf("env %s: environment variables are not available", name)
+	} else if len(defaults) > 1 {
+		return "", fmt.Errorf("env %s: expected one default", name)
+	}
+	if value, ok := os.LookupEnv(name); ok {
+		return value, nil
+	} else if len(defaults) == 1 {
+		return defaults[0], nil
+	} else if cmd.strict {
+		return "", fmt.Errorf("env %s: not set", name)
+	}
+	if cmd.ui != nil {
+		cmd.ui.Warn(fmt.Sprintf("warning: env %s: not set, rendered empty", name))
+	}
+	return "", nil
+}
+
+// missingKey is the template option for parameters that are not set
+func (cmd *TemplateCommand) missingKey() string {
+	if cmd.strict {
+		return "missingkey=error"
+	}
+	return "missingkey=zero"
+}
+
+// renderAfter renders the template again, in watch mode, at two thirds of ttl
+// if that is before the next render
+func (cmd *TemplateCommand) renderAfter(ttl time.Duration) {
+	if by := time.Now().Add(ttl * 2 / 3); cmd.renderBy.IsZero() || by.Before(cmd.renderBy) {
+		cmd.renderBy = by
+	}
+}
+
+// templatePKICert issues a certificate for the common name with role of the
+// PKI secrets engine at pki, or at the mount in role given as
+// "<mount>/<role>". The certificate, with its private_key, issuing_ca and
+// ca_chain, is issued once per render.
+func (cmd *TemplateCommand) templatePKICert(role, commonName string) (map[string]interface{}, error) {
+	mount := "pki"
+	if i := strings.LastIndexByte(role, '/'); i > 0 {
+		mount, role = role[:i], role[i+1:]
+	}
+	path := strings.Trim(mount, "/") + "/issue/" + role
+	if secret, ok := cmd.certs[path+" "+commonName]; ok {
+		return secret.Data, nil
+	}
+
+	var (
+		data   = map[string]interface{}{"common_name": commonName}
+		secret *api.Secret
+		err    error
+	)
+	if cmd.issue != nil {
+		secret, err = cmd.issue(path, data)
+	} else {
+		var client *Client
+		if client, err = cmd.Client(); err != nil {
+			return nil, err
+		}
+		if secret, err = client.Write(path, data); err == nil && secret != nil {
+			trackLease(client, secret.LeaseID)
+		}
+	}
+	if err != nil && ErrorKind(err) != nil {
+		return nil, &Error{Kind: ErrorKind(err), Err: fmt.Errorf("pkiCert %s: %v", path, err)}
+	} else if err != nil {
+		return nil, fmt.Errorf("pkiCert %s: %v", path, err)
+	} else if secret == nil || secret.Data == nil {
+		return nil, notFound(fmt.Sprintf("pkiCert %s: no certificate issued", path))
+	}
+	cmd.certs[path+" "+commonName] = secret
+
+	// Render again before the certificate expires
+	pem, _ := secret.Data["certificate"].(string)
+	if certs, _ := pemCertificates(pem); len(certs) > 0 {
+		cmd.renderAfter(time.Until(certs[0].NotAfter))
+	}
+	return secret.Data, nil
+}
+
+// templateVerifyChain verifies that the first certificate in cert chains to
+// the certificates in ca, with the other certificates in cert as
+// intermediates, and returns cert; the render fails if it doesn't. Both are
+// PEM, or lists of PEM such as ca_chain.
+func templateVerifyChain(cert, ca interface{}) (string, error) {
+	certPEM, err := templatePEM(cert)
+	if err != nil {
+		return "", fmt.Errorf("verifyChain: certificate: %v", err)
+	}
+	caPEM, err := templatePEM(ca)
+	if err != nil {
+		return "", fmt.Errorf("verifyChain: CA: %v", err)
+	}
+	certs, errs := pemCertificates(certPEM)
+	if len(errs) > 0 {
+		return "", fmt.Errorf("verifyChain: certificate: %v", errs[0])
+	} else if len(certs) == 0 {
+		return "", errors.New("verifyChain: no certificate")
+	}
+	roots, errs := pemCertificates(caPEM)
+	if len(errs) > 0 {
+		return "", fmt.Errorf("verifyChain: CA: %v", errs[0])
+	} else if len(roots) == 0 {
+		return "", errors.New("verifyChain: no CA certificate")
+	}
+
+	options := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, root := range roots {
+		options.Roots.AddCert(root)
+	}
+	for _, intermediate := range certs[1:] {
+		options.Intermediates.AddCert(intermediate)
+	}
+	if _, err = certs[0].Verify(options); err != nil {
+		return "", fmt.Errorf("verifyChain: %s: %v", certs[0].Subject, err)
+	}
+	return certPEM, nil
+}
+
+// templatePEM returns the PEM in v, joining lists
+func templatePEM(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []string:
+		return strings.Join(v, "\n"), nil
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("expected PEM, got %T", item)
+			}
+			values = append(values, s)
+		}
+		return strings.Join(values, "\n"), nil
+	case nil:
+		return "", errors.New("missing")
+	default:
+		return "", fmt.Errorf("expected PEM, got %T", v)
+	}
+}
+
+// templateMerge overlays the secrets at paths in priority order, see
+// mergeSecrets, and returns the merged keys
+func (cmd *TemplateCommand) templateMerge(paths ...string) (map[string]interface{}, error) {
+	client, err := cmd.Client()
+	if err != nil {
+		return nil, err
+	}
+	m, err := mergeSecrets(cmd.resolveAll(paths), func(path string) (*api.Secret, error) {
+		return cmd.readSecret(client, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.Data, nil
+}
+
 func (cmd *TemplateCommand) randomIdentifier(t string) string {
 	r := make([]byte, 8)
 	io.ReadFull(rand.Reader, r)
@@ -296,7 +668,16 @@ func TemplateCommandFactory(ui cli.Ui) cli.CommandFactory {
 		cmd.fs = flag.NewFlagSet("template", flag.ContinueOnError)
 		cmd.fs.StringVar(&cmd.mod, "m", "0600", "output mode")
 		cmd.fs.StringVar(&cmd.out, "o", "", "output (default: stdout)")
+		cmd.fs.StringVar(&cmd.ownerName, "owner", "", "owner of the output file, requires root")
+		cmd.fs.StringVar(&cmd.groupName, "group", "", "group of the output file")
+		cmd.fs.StringVar(&cmd.label, "selinux", "", "SELinux label of the output file (default: the label of the file it replaces)")
+		cmd.fs.Var(&cmd.xattrs, "xattr", "name=value extended attribute of the output file, can be repeated")
 		cmd.fs.StringVar(&cmd.templatingMode, "t", "html", "templating mode: html or text")
+		cmd.fs.Var(&cmd.post, "post", "post-process the output with a plugin (can be repeated)")
+		cmd.fs.Var(&cmd.transform, "transform", "transform the output, such as base64-decode or \"indent 4\" (can be repeated)")
+		cmd.fs.BoolVar(&cmd.watch, "watch", false, "render again before the leases of dynamic credentials expire")
+		cmd.fs.Var(&cmd.set, "set", "key=value parameter, available as {{ .key }}, can be repeated")
+		cmd.fs.BoolVar(&cmd.strict, "strict", false, "fail on unset environment variables and parameters")
 		cmd.fs.Usage = func() {
 			fmt.Print(cmd.Help())
 		}
@@ -9,7 +9,9 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestTemplateCommand_Run(t *testing.T) {
@@ -94,6 +96,97 @@ func TestTemplateCommand_TextTemplateXml(t *testing.T) {
 	}
 }
 
+func TestTemplateCommand_DynamicCreds(t *testing.T) {
+	commandUnderTest, output := createCommandUnderTest(t, nil)
+	reads := make(map[string]int)
+	commandUnderTest.read = func(path string) (*api.Secret, error) {
+		reads[path]++
+		switch path {
+		case "database/creds/app":
+			return &api.Secret{LeaseID: path + "/1", LeaseDuration: 3600, Data: map[string]interface{}{
+				"username": "v-app", "password": "pw",
+			}}, nil
+		case "cloud/creds/deploy":
+			return &api.Secret{LeaseID: path + "/1", LeaseDuration: 900, Data: map[string]interface{}{
+				"access_key": "AKIA",
+			}}, nil
+		}
+		return nil, nil
+	}
+	f := createTemplateFile(t, `{{ with dbCreds "app" }}{{ .username }}:{{ .password }}{{ end }} {{ (dbCreds "app").username }} {{ (awsCreds "cloud/deploy").access_key }}`)
+
+	start := time.Now()
+	exitCode := commandUnderTest.Run([]string{f.Name()})
+	commandOutput := output.String()
+	if exitCode != 0 {
+		t.Fatal("Exit code is not 0", commandOutput, exitCode)
+	}
+	if commandOutput != "v-app:pw v-app AKIA" {
+		t.Fatal("Unexpected output", "'"+commandOutput+"'")
+	}
+	if reads["database/creds/app"] != 1 || reads["cloud/creds/deploy"] != 1 {
+		t.Fatal("Expected the credentials to be read once", reads)
+	}
+	if by := commandUnderTest.renderBy.Sub(start); by < 10*time.Minute || by > 10*time.Minute+time.Second {
+		t.Fatal("Expected to render again at 2/3 of the shortest lease, got", by)
+	}
+
+	output.Reset()
+	f = createTemplateFile(t, `{{ (dbCreds "missing").username }}`)
+	if exitCode = commandUnderTest.Run([]string{f.Name()}); exitCode != NotFoundError {
+		t.Fatal("Expected not found, got", exitCode, output.String())
+	}
+}
+
+func TestTemplateCommand_PKICert(t *testing.T) {
+	certs, key := testCertChain(t)
+	other, _ := testCertChain(t)
+	commandUnderTest, output := createCommandUnderTest(t, nil)
+	issued := make(map[string]int)
+	commandUnderTest.issue = func(path string, data map[string]interface{}) (*api.Secret, error) {
+		issued[path+" "+data["common_name"].(string)]++
+		return &api.Secret{Data: map[string]interface{}{
+			"certificate": certs[2],
+			"issuing_ca":  certs[1],
+			"ca_chain":    []interface{}{certs[1], certs[0]},
+			"private_key": key,
+		}}, nil
+	}
+	f := createTemplateFile(t, `{{ with pkiCert "web" "www.example.com" }}{{ verifyChain .certificate .ca_chain }}{{ .private_key }}{{ end }}{{ (pkiCert "web" "www.example.com").issuing_ca }}`)
+
+	start := time.Now()
+	exitCode := commandUnderTest.Run([]string{"-t", "text", f.Name()})
+	commandOutput := output.String()
+	if exitCode != 0 {
+		t.Fatal("Exit code is not 0", commandOutput, exitCode)
+	}
+	if commandOutput != certs[2]+key+certs[1] {
+		t.Fatal("Unexpected output", "'"+commandOutput+"'")
+	}
+	if issued["pki/issue/web www.example.com"] != 1 {
+		t.Fatal("Expected the certificate to be issued once", issued)
+	}
+	if by := commandUnderTest.renderBy.Sub(start); by < 39*time.Minute || by > 40*time.Minute+time.Second {
+		t.Fatal("Expected to render again at 2/3 of the certificate validity, got", by)
+	}
+
+	// A chain to another CA fails the render, and nothing is written
+	output.Reset()
+	commandUnderTest.issue = func(path string, data map[string]interface{}) (*api.Secret, error) {
+		return &api.Secret{Data: map[string]interface{}{
+			"certificate": certs[2] + certs[1],
+			"issuing_ca":  other[0],
+		}}, nil
+	}
+	f = createTemplateFile(t, `{{ with pkiCert "intranet/web" "www.example.com" }}{{ verifyChain .certificate .issuing_ca }}{{ end }}`)
+	if exitCode = commandUnderTest.Run([]string{"-t", "text", f.Name()}); exitCode == 0 {
+		t.Fatal("Expected the render to fail, got", output.String())
+	}
+	if commandOutput = output.String(); strings.Contains(commandOutput, "BEGIN CERTIFICATE") || !strings.Contains(commandOutput, "verifyChain") {
+		t.Fatal("Unexpected output", "'"+commandOutput+"'")
+	}
+}
+
 func writeSecret(t *testing.T, vaultClient *api.Client, path string, secret map[string]interface{}) {
 	_, err := vaultClient.Logical().Write(path, secret)
 	if err != nil {
@@ -101,6 +194,38 @@ func writeSecret(t *testing.T, vaultClient *api.Client, path string, secret map[
 	}
 }
 
+func TestTemplateCommand_EnvAndSet(t *testing.T) {
+	vaultClient, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("VC_TEST_REGION", "eu-west-1")
+	defer os.Unsetenv("VC_TEST_REGION")
+	os.Unsetenv("VC_TEST_UNSET")
+	f := createTemplateFile(t, `{{ env "VC_TEST_REGION" }} {{ env "VC_TEST_UNSET" "default" }} {{ .replicas }}`)
+
+	commandUnderTest, output := createCommandUnderTest(t, vaultClient)
+	if exitCode := commandUnderTest.Run([]string{"-t", "text", "-set", "replicas=3", f.Name()}); exitCode != 0 {
+		t.Fatal("Exit code is not 0", output.String(), exitCode)
+	}
+	if got := output.String(); got != "eu-west-1 default 3" {
+		t.Fatal("Unexpected output", "'"+got+"'")
+	}
+
+	// Unset variables and parameters fail the render with -strict
+	for _, text := range []string{`{{ env "VC_TEST_UNSET" }}`, `{{ .replicas }}`} {
+		f = createTemplateFile(t, text)
+		commandUnderTest, output = createCommandUnderTest(t, vaultClient)
+		if exitCode := commandUnderTest.Run([]string{"-t", "text", f.Name()}); exitCode != 0 {
+			t.Fatal("Exit code is not 0", output.String(), exitCode)
+		}
+		commandUnderTest, output = createCommandUnderTest(t, vaultClient)
+		if exitCode := commandUnderTest.Run([]string{"-t", "text", "-strict", f.Name()}); exitCode == 0 {
+			t.Fatal("Expected an error with -strict for", text, output.String())
+		}
+	}
+}
+
 func createTemplateFile(t *testing.T, templateContents string) *os.File {
 	f, err := ioutil.TempFile(".", "template")
 	t.Cleanup(func() {
@@ -132,10 +257,9 @@ func createCommandUnderTest(t *testing.T, client *api.Client) (*TemplateCommand,
 		t.Fatal(err)
 	}
 	templateCommand := commandUnderTest.(*TemplateCommand)
-	templateCommand.c = &Client{
-		Path:   "/",
-		Client: client,
-	}
+	templateCommand.c = new(Client)
+	templateCommand.c.Path = "/"
+	templateCommand.c.Client.Client = client
 	templateCommand.w = &byteBufferWriteCloser{ByteBuffer: b}
 
 	return templateCommand, b
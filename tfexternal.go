@@ -0,0 +1,151 @@
+package vc
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+)
+
+// tfExternalResult returns the result for the Terraform external data source,
+// which only supports string values; non-string values are JSON encoded. If
+// keys are given, only those keys are included.
+func tfExternalResult(path string, data map[string]interface{}, keys []string) (map[string]string, error) {
+	if len(keys) == 0 {
+		for key := range data {
+			if key != CodecTypeKey {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	result := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, ok := data[key]
+		if !ok {
+			return nil, notFound(fmt.Sprintf("%s: key %q not found", path, key))
+		}
+		switch v := value.(type) {
+		case string:
+			result[key] = v
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: key %s: %v", path, key, err)
+			}
+			result[key] = string(b)
+		}
+	}
+	return result, nil
+}
+
+// TFExternalCommand implements the Terraform external data source protocol
+type TFExternalCommand struct {
+	baseCommand
+	fs *flag.FlagSet
+	in io.Reader
+}
+
+func (cmd *TFExternalCommand) Help() string {
+	return `Usage: vc tf-external
+
+Implements the Terraform external data source protocol. The query is read from
+stdin as a JSON object with the secret "path" (which may have an @<version>),
+and optionally "keys", a comma separated list of keys to return. The keys of
+the secret are written to stdout as a JSON object of strings.
+
+  data "external" "db" {
+    program = ["vc", "tf-external"]
+    query = {
+      path = "secret/prod/db"
+      keys = "username,password"
+    }
+  }
+`
+}
+
+func (cmd *TFExternalCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) != 0 {
+		return Help
+	}
+
+	var query map[string]string
+	if err := json.NewDecoder(cmd.in).Decode(&query); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: invalid query: %v", err))
+		return SyntaxError
+	}
+	if query["path"] == "" {
+		cmd.ui.Error("error: invalid query: no path")
+		return SyntaxError
+	}
+	path := cmd.resolve(query["path"])
+	var keys []string
+	if query["keys"] != "" {
+		for _, key := range strings.Split(query["keys"], ",") {
+			keys = append(keys, strings.TrimSpace(key))
+		}
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	var secret *api.Secret
+	if name, version, ok := splitVersion(path); ok {
+		secret, err = client.ReadVersion(name, version)
+	} else {
+		secret, err = cmd.readSource(path, client.ReadSecret)
+	}
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return exitCode(err, ServerError)
+	} else if secret == nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: secret not found", path))
+		return NotFoundError
+	}
+
+	result, err := tfExternalResult(path, secret.Data, keys)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, SyntaxError)
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SystemError
+	}
+	cmd.ui.Output(string(b))
+	return Success
+}
+
+func (cmd *TFExternalCommand) Synopsis() string {
+	return "read secrets for the Terraform external data source"
+}
+
+func TFExternalCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &TFExternalCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			in: os.Stdin,
+		}
+
+		cmd.fs = flag.NewFlagSet("tf-external", flag.ContinueOnError)
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,42 @@
+package vc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTFExternalResult(t *testing.T) {
+	data := map[string]interface{}{
+		CodecTypeKey: "json",
+		"username":   "test",
+		"password":   "secret",
+		"port":       json.Number("5432"),
+		"hosts":      []interface{}{"a", "b"},
+	}
+
+	result, err := tfExternalResult("secret/db", data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"username": "test",
+		"password": "secret",
+		"port":     "5432",
+		"hosts":    `["a","b"]`,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("expected %v, got %v", want, result)
+	}
+
+	if result, err = tfExternalResult("secret/db", data, []string{"password"}); err != nil {
+		t.Fatal(err)
+	}
+	if want = map[string]string{"password": "secret"}; !reflect.DeepEqual(result, want) {
+		t.Fatalf("expected %v, got %v", want, result)
+	}
+
+	if _, err = tfExternalResult("secret/db", data, []string{"missing"}); ErrorKind(err) != ErrNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// TokenStore keeps the Vault token between invocations
+type TokenStore interface {
+	// Token returns the stored token, or an empty string if there is none
+	Token() (string, error)
+
+	// Store replaces the stored token
+	Store(token string) error
+
+	// Erase removes the stored token
+	Erase() error
+
+	// String describes where the token is kept
+	String() string
+}
+
+// fileTokenStore reads the token from the first existing token file;
+// tokens are stored in that same file, or in the first file if none exist;
+// with a key, tokens are sealed
+type fileTokenStore struct {
+	names []string
+	key   *storeKey
+}
+
+func (s fileTokenStore) name() string {
+	var first string
+	for _, name := range s.names {
+		if name == "" {
+			continue
+		}
+		if first == "" {
+			first = name
+		}
+		if fi, err := os.Stat(name); err == nil && !fi.IsDir() {
+			return name
+		} else if err != nil {
+			Debugf("token: error %s: %v", name, err)
+		}
+	}
+	return first
+}
+
+func (s fileTokenStore) Token() (string, error) {
+	name := s.name()
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to read token: %v", err)
+	}
+	if b, err = s.key.open(b); err != nil {
+		return "", fmt.Errorf("unable to read token: %s: %v", name, err)
+	}
+	Debugf("token: using token file %s", name)
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (s fileTokenStore) Store(token string) error {
+	b, err := s.key.seal([]byte(token))
+	if err != nil {
+		return err
+	}
+	w := SafeOutputWriter(s.name(), 0600)
+	if _, err = w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s fileTokenStore) Erase() error {
+	if err := os.Remove(s.name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s fileTokenStore) String() string {
+	return s.name()
+}
+
+// helperTokenStore uses an external token helper program, compatible with the
+// token helpers of the Vault CLI; the program is called with "get", "store"
+// or "erase" as argument and exchanges the token over stdin and stdout
+type helperTokenStore struct {
+	path string
+	env  []string
+}
+
+func (s helperTokenStore) run(stdin string, arg string) (string, error) {
+	var (
+		c      = exec.Command(s.path, arg)
+		stdout bytes.Buffer
+		stderr bytes.Buffer
+	)
+	c.Stdin = strings.NewReader(stdin)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if s.env != nil {
+		c.Env = append(os.Environ(), s.env...)
+	}
+	Debugf("token: %s %s", s.path, arg)
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("token helper %s: %v: %s", arg, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (s helperTokenStore) Token() (string, error) {
+	return s.run("", "get")
+}
+
+func (s helperTokenStore) Store(token string) error {
+	_, err := s.run(token, "store")
+	return err
+}
+
+func (s helperTokenStore) Erase() error {
+	_, err := s.run("", "erase")
+	return err
+}
+
+func (s helperTokenStore) String() string {
+	return "token helper " + s.path
+}
+
+// profileTokenStore keeps the tokens of all profiles in one file, as a JSON
+// object with the token of each Vault cluster by its tokenKey; with a store
+// key, the file is sealed
+type profileTokenStore struct {
+	name  string
+	key   string
+	store *storeKey
+}
+
+func (s profileTokenStore) load() (map[string]string, error) {
+	tokens := make(map[string]string)
+	b, err := ioutil.ReadFile(s.name)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read token: %v", err)
+	}
+	if b, err = s.store.open(b); err != nil {
+		return nil, fmt.Errorf("unable to read token: %s: %v", s.name, err)
+	}
+	if err = json.Unmarshal(b, &tokens); err != nil {
+		return nil, fmt.Errorf("unable to read token: %s: %v", s.name, err)
+	}
+	return tokens, nil
+}
+
+func (s profileTokenStore) save(tokens map[string]string) error {
+	if len(tokens) == 0 {
+		if err := os.Remove(s.name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if b, err = s.store.seal(append(b, '\n')); err != nil {
+		return err
+	}
+	w := SafeOutputWriter(s.name, 0600)
+	if _, err = w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s profileTokenStore) Token() (string, error) {
+	tokens, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	if token := tokens[s.key]; token != "" {
+		Debugf("token: using token for %s in %s", s.key, s.name)
+		return token, nil
+	}
+	return "", nil
+}
+
+func (s profileTokenStore) Store(token string) error {
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	tokens[s.key] = token
+	return s.save(tokens)
+}
+
+func (s profileTokenStore) Erase() error {
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := tokens[s.key]; !ok {
+		return nil
+	}
+	delete(tokens, s.key)
+	return s.save(tokens)
+}
+
+func (s profileTokenStore) String() string {
+	return s.name + " (" + s.key + ")"
+}
+
+// tokenStore returns the configured token store; with a profile, the token
+// of its Vault cluster is used. With a security key, token files are sealed.
+func (cmd *baseCommand) tokenStore() (TokenStore, error) {
+	config, err := cmd.Config()
+	if err != nil {
+		return nil, err
+	}
+	p, err := cmd.profile()
+	if err != nil {
+		return nil, err
+	}
+	if config.TokenHelper != "" {
+		s := helperTokenStore{path: os.ExpandEnv(config.TokenHelper)}
+		if p != nil {
+			// The token helper tells the clusters apart, as for the Vault CLI
+			s.env = []string{"VAULT_ADDR=" + p.Address, "VAULT_NAMESPACE=" + p.Namespace}
+		}
+		return s, nil
+	}
+	key, err := loadStoreKey(config.SecurityKey)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		return profileTokenStore{name: profileTokenFile, key: tokenKey(p.Address, p.Namespace), store: key}, nil
+	}
+	return fileTokenStore{names: tokenFiles, key: key}, nil
+}
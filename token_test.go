@@ -0,0 +1,109 @@
+package vc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "token")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		first  = filepath.Join(dir, "first")
+		second = filepath.Join(dir, "second")
+		store  = fileTokenStore{names: []string{"", first, second}}
+	)
+	if token, err := store.Token(); err != nil {
+		t.Fatal(err)
+	} else if token != "" {
+		t.Fatalf("expected no token, got %q", token)
+	}
+
+	// Existing token files take precedence
+	if err = ioutil.WriteFile(second, []byte("s.second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Store("s.test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(first); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to not exist, got %v", first, err)
+	}
+	if token, err := store.Token(); err != nil {
+		t.Fatal(err)
+	} else if token != "s.test" {
+		t.Fatalf("expected token %q, got %q", "s.test", token)
+	}
+
+	if err = store.Erase(); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := store.Token(); err != nil {
+		t.Fatal(err)
+	} else if token != "" {
+		t.Fatalf("expected no token, got %q", token)
+	}
+}
+
+func TestProfileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "token")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+
+	saved, savedName := profileTokenFile, ProfileName
+	defer func() { profileTokenFile, ProfileName = saved, savedName }()
+	profileTokenFile = filepath.Join(dir, "tokens")
+
+	cmd := &baseCommand{config: &Config{Profiles: map[string]*Profile{
+		"prod":    {Address: "https://prod:8200"},
+		"team":    {Address: "https://prod:8200", Namespace: "team"},
+		"staging": {Address: "https://staging:8200"},
+	}}}
+	stores := make(map[string]TokenStore)
+	for _, name := range []string{"prod", "team", "staging"} {
+		ProfileName = name
+		store, err := cmd.tokenStore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = store.Store("s." + name); err != nil {
+			t.Fatal(err)
+		}
+		stores[name] = store
+	}
+
+	// Each cluster, and each namespace, has its own token
+	for name, store := range stores {
+		if token, err := store.Token(); err != nil {
+			t.Fatal(err)
+		} else if token != "s."+name {
+			t.Fatalf("%s: expected token %q, got %q", name, "s."+name, token)
+		}
+	}
+	if err = stores["prod"].Erase(); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := stores["prod"].Token(); err != nil {
+		t.Fatal(err)
+	} else if token != "" {
+		t.Fatalf("expected no token, got %q", token)
+	}
+	if token, err := stores["team"].Token(); err != nil {
+		t.Fatal(err)
+	} else if token != "s.team" {
+		t.Fatalf("expected token %q, got %q", "s.team", token)
+	}
+
+	ProfileName = "unknown"
+	if _, err = cmd.tokenStore(); err == nil {
+		t.Fatal("expected an error for an unknown profile")
+	}
+}
@@ -0,0 +1,224 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/tehmaze/vc/client"
+)
+
+// TokenCommand lists and revokes tokens by accessor
+type TokenCommand struct {
+	baseCommand
+	fs       *flag.FlagSet
+	sub      string
+	accessor string
+	all      bool
+	raw      bool
+	force    bool
+}
+
+func (cmd *TokenCommand) Help() string {
+	switch cmd.sub {
+	case "accessors":
+		return `Usage: vc token accessors [<options>]
+
+List the tokens of the entity of the current token, by accessor, with their
+display name, policies and TTL. Tokens created by a token inherit its entity,
+so these include the children of the current token; Vault doesn't report the
+parent of a token. With -all, all tokens are listed. Listing accessors needs
+sudo on auth/token/accessors.
+
+Options:
+` + defaults(cmd.fs)
+	case "revoke":
+		return `Usage: vc token revoke [<options>] -accessor <accessor>
+
+Revoke the token with accessor, and its children, after confirmation. The
+token is looked up first, and its display name and policies are shown.
+
+Options:
+` + defaults(cmd.fs)
+	}
+	return `Usage: vc token <accessors|revoke> [<options>]`
+}
+
+func (cmd *TokenCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if len(cmd.fs.Args()) != 0 {
+		return Help
+	}
+	if cmd.sub == "revoke" && cmd.accessor == "" {
+		cmd.ui.Error("error: -accessor is required")
+		return SyntaxError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	switch cmd.sub {
+	case "accessors":
+		err = cmd.accessors(client)
+	case "revoke":
+		err = cmd.revoke(client, cmd.accessor)
+	default:
+		return Help
+	}
+	if err != nil {
+		err = classifyError(err)
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return exitCode(err, ServerError)
+	}
+	return Success
+}
+
+// lookupAccessor looks up the token with accessor; Vault reports accessors
+// of tokens that expired as invalid, these are not found
+func lookupAccessor(c *Client, accessor string) (*identityToken, error) {
+	secret, err := c.Write("auth/token/lookup-accessor", map[string]interface{}{"accessor": accessor})
+	if status, errs := client.ErrorDetails(err); status == http.StatusBadRequest && len(errs) == 1 && strings.Contains(errs[0], "invalid accessor") {
+		return nil, notFound("token not found for accessor " + accessor)
+	} else if err != nil {
+		return nil, err
+	} else if secret == nil {
+		return nil, notFound("token not found for accessor " + accessor)
+	}
+	t := newIdentityToken(secret.Data)
+	return &t, nil
+}
+
+func (cmd *TokenCommand) accessors(client *Client) error {
+	self, err := client.Read("auth/token/lookup-self")
+	if err != nil {
+		return err
+	} else if self == nil {
+		return notFound("token not found")
+	}
+	current := newIdentityToken(self.Data)
+	if current.EntityID == "" && !cmd.all {
+		return fmt.Errorf("the current token has no entity, its children can't be told apart; use -all")
+	}
+
+	secret, err := client.List("auth/token/accessors")
+	if err != nil {
+		return err
+	}
+	var accessors []string
+	if secret != nil {
+		accessors = identityStrings(secret.Data["keys"])
+	}
+
+	tokens := []identityToken{}
+	progress := cmd.progress("looking up", len(accessors))
+	for _, accessor := range accessors {
+		t, err := lookupAccessor(client, accessor)
+		progress.Add(1)
+		if ErrorKind(err) == ErrNotFound {
+			// Expired since it was listed
+			continue
+		} else if err != nil {
+			progress.Done()
+			return fmt.Errorf("%s: %v", accessor, err)
+		}
+		if cmd.all || (t.EntityID == current.EntityID && t.Accessor != current.Accessor) {
+			tokens = append(tokens, *t)
+		}
+	}
+	progress.Done()
+
+	if cmd.raw {
+		b, err := json.MarshalIndent(tokens, "", "  ")
+		if err != nil {
+			return err
+		}
+		cmd.ui.Output(string(b))
+		return nil
+	}
+
+	var (
+		b = new(bytes.Buffer)
+		w = tabwriter.NewWriter(b, 0, 8, 2, ' ', 0)
+	)
+	fmt.Fprintln(w, "ACCESSOR\tDISPLAY NAME\tPOLICIES\tTTL")
+	for _, t := range tokens {
+		ttl := "-"
+		if t.TTL > 0 {
+			ttl = mountTTL(t.TTL)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Accessor, t.DisplayName, strings.Join(t.Policies, ","), ttl)
+	}
+	w.Flush()
+	cmd.ui.Output(strings.TrimSuffix(b.String(), "\n"))
+	return nil
+}
+
+func (cmd *TokenCommand) revoke(client *Client, accessor string) error {
+	t, err := lookupAccessor(client, accessor)
+	if err != nil {
+		return err
+	}
+	changes := []string{fmt.Sprintf("- %s (%s, policies %s)", accessor, t.DisplayName, strings.Join(t.Policies, ","))}
+	if ok, err := cmd.confirmChanges(cmd.force, changes, "Revoke the token with accessor %s, and its children?", accessor); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("not confirmed, %s is not revoked", accessor)
+	}
+	if DryRun {
+		cmd.ui.Output("dry run: revoke the token with accessor " + accessor)
+		return nil
+	}
+	if _, err = client.Write("auth/token/revoke-accessor", map[string]interface{}{"accessor": accessor}); err != nil {
+		return err
+	}
+	cmd.ui.Output(cmd.colors(os.Stdout).change(changes[0]))
+	return nil
+}
+
+func (cmd *TokenCommand) Synopsis() string {
+	switch cmd.sub {
+	case "accessors":
+		return "list the tokens of the current entity, by accessor"
+	case "revoke":
+		return "revoke a token by accessor"
+	}
+	return "list and revoke tokens by accessor"
+}
+
+func TokenCommandFactory(ui cli.Ui, sub string) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &TokenCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+			sub: sub,
+		}
+
+		cmd.fs = flag.NewFlagSet("token "+sub, flag.ContinueOnError)
+		switch sub {
+		case "accessors":
+			cmd.fs.BoolVar(&cmd.all, "all", false, "list all tokens")
+			cmd.fs.BoolVar(&cmd.raw, "json", false, "print the tokens as JSON")
+		case "revoke":
+			cmd.fs.StringVar(&cmd.accessor, "accessor", "", "accessor of the token")
+			cmd.fs.BoolVar(&cmd.force, "f", false, "don't ask for confirmation")
+		}
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
@@ -0,0 +1,96 @@
+package vc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestTokenCommand(t *testing.T) {
+	var (
+		tokens = map[string]map[string]interface{}{
+			"self":  {"accessor": "self", "display_name": "approle", "entity_id": "e1", "policies": []string{"deploy"}, "ttl": 3600},
+			"child": {"accessor": "child", "display_name": "token-ci", "entity_id": "e1", "policies": []string{"read"}, "ttl": 600},
+			"other": {"accessor": "other", "display_name": "userpass-alice", "entity_id": "e2", "policies": []string{"admin"}},
+		}
+		revoked []string
+	)
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			body     map[string]interface{}
+			response interface{}
+		)
+		json.NewDecoder(r.Body).Decode(&body)
+		accessor, _ := body["accessor"].(string)
+		request := r.Method + " " + r.URL.Path
+		if r.URL.Query().Get("list") == "true" {
+			request = "LIST " + r.URL.Path
+		}
+		switch request {
+		case "GET /v1/auth/token/lookup-self":
+			response = map[string]interface{}{"data": tokens["self"]}
+		case "LIST /v1/auth/token/accessors", "LIST /v1/auth/token/accessors/":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"child", "gone", "other", "self"}}}
+		case "POST /v1/auth/token/lookup-accessor", "PUT /v1/auth/token/lookup-accessor":
+			if tokens[accessor] == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				response = map[string]interface{}{"errors": []string{"invalid accessor"}}
+				break
+			}
+			response = map[string]interface{}{"data": tokens[accessor]}
+		case "POST /v1/auth/token/revoke-accessor", "PUT /v1/auth/token/revoke-accessor":
+			revoked = append(revoked, accessor)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), nil)
+
+	run := func(sub string, args ...string) (*cli.MockUi, int) {
+		ui := cli.NewMockUi()
+		command, _ := TokenCommandFactory(ui, sub)()
+		cmd := command.(*TokenCommand)
+		cmd.c, cmd.config = c, new(Config)
+		return ui, cmd.Run(args)
+	}
+
+	// The tokens of the entity, without the current token
+	ui, code := run("accessors")
+	if code != Success {
+		t.Fatalf("accessors: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	want := "ACCESSOR  DISPLAY NAME  POLICIES  TTL\n" +
+		"child     token-ci      read      10m0s\n"
+	if got := ui.OutputWriter.String(); got != want {
+		t.Fatalf("accessors: expected\n%s\ngot\n%s", want, got)
+	}
+	if ui, code = run("accessors", "-all"); code != Success {
+		t.Fatalf("accessors -all: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if got := ui.OutputWriter.String(); !strings.Contains(got, "other") || !strings.Contains(got, "self") || strings.Contains(got, "gone") {
+		t.Fatalf("accessors -all: expected all tokens, got\n%s", got)
+	}
+
+	// Revoking needs confirmation
+	if ui, code = run("revoke"); code != SyntaxError {
+		t.Fatalf("revoke: expected syntax error without -accessor, got %d", code)
+	}
+	if ui, code = run("revoke", "-accessor", "child"); code == Success {
+		t.Fatal("revoke: expected error without confirmation")
+	}
+	if ui, code = run("revoke", "-accessor", "gone", "-f"); code == Success {
+		t.Fatal("revoke: expected error for an unknown accessor")
+	}
+	if ui, code = run("revoke", "-accessor", "child", "-f"); code != Success {
+		t.Fatalf("revoke: expected success, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	if len(revoked) != 1 || revoked[0] != "child" {
+		t.Fatalf("expected child to be revoked, got %q", revoked)
+	}
+}
@@ -0,0 +1,357 @@
+package vc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Span kinds, as defined by OTLP
+const (
+	spanInternal = 1
+	spanClient   = 3
+)
+
+// traceTimeout is the timeout for exporting spans
+const traceTimeout = 10 * time.Second
+
+// span is a unit of work in a trace
+type span struct {
+	tracer  *tracer
+	traceID string
+	spanID  string
+	parent  string
+	name    string
+	kind    int
+	start   time.Time
+	end     time.Time
+	attrs   map[string]string
+	err     error
+}
+
+// tracer collects spans, and exports them to an OpenTelemetry collector with
+// OTLP over HTTP (JSON encoding). Spans are parented on the span that was
+// active when they were started; vc doesn't do concurrent requests.
+type tracer struct {
+	endpoint string
+	headers  http.Header
+	service  string
+	traceID  string
+	parent   string
+	mutex    sync.Mutex
+	active   []*span
+	spans    []*span
+}
+
+var (
+	tracing     *tracer
+	tracingOnce sync.Once
+)
+
+// newTracer configures a tracer from the OpenTelemetry environment variables,
+// it returns nil if no OTLP endpoint is configured
+func newTracer() *tracer {
+	if os.Getenv("OTEL_TRACES_EXPORTER") == "none" || os.Getenv("OTEL_SDK_DISABLED") == "true" {
+		return nil
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint == "" {
+			return nil
+		}
+		endpoint = strings.TrimRight(endpoint, "/") + "/v1/traces"
+	}
+
+	t := &tracer{
+		endpoint: endpoint,
+		headers:  make(http.Header),
+		service:  os.Getenv("OTEL_SERVICE_NAME"),
+		traceID:  randomHex(16),
+	}
+	if t.service == "" {
+		t.service = "vc"
+	}
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		for _, header := range strings.Split(os.Getenv(name), ",") {
+			if i := strings.IndexByte(header, '='); i > 0 {
+				value, err := url.QueryUnescape(strings.TrimSpace(header[i+1:]))
+				if err != nil {
+					value = header[i+1:]
+				}
+				t.headers.Set(strings.TrimSpace(header[:i]), value)
+			}
+		}
+	}
+
+	// Continue the trace of the parent process, if any
+	if traceID, parent, ok := parseTraceparent(os.Getenv("TRACEPARENT")); ok {
+		t.traceID, t.parent = traceID, parent
+	}
+	Debugf("trace: exporting spans to %s, trace %s", t.endpoint, t.traceID)
+	return t
+}
+
+// parseTraceparent parses a W3C traceparent header
+func parseTraceparent(value string) (traceID, spanID string, ok bool) {
+	part := strings.Split(strings.TrimSpace(value), "-")
+	if len(part) < 4 || len(part[0]) != 2 || len(part[1]) != 32 || len(part[2]) != 16 {
+		return "", "", false
+	}
+	for _, p := range part[:3] {
+		if _, err := hex.DecodeString(p); err != nil {
+			return "", "", false
+		}
+	}
+	if part[1] == strings.Repeat("0", 32) || part[2] == strings.Repeat("0", 16) {
+		return "", "", false
+	}
+	return part[1], part[2], true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// startSpan starts a span, attrs are key-value pairs. If tracing is not
+// enabled, a nil span is returned, which is safe to use.
+func startSpan(name string, kind int, attrs ...string) *span {
+	tracingOnce.Do(func() {
+		tracing = newTracer()
+	})
+	if tracing == nil {
+		return nil
+	}
+	return tracing.start(name, kind, attrs...)
+}
+
+func (t *tracer) start(name string, kind int, attrs ...string) *span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	s := &span{
+		tracer:  t,
+		traceID: t.traceID,
+		spanID:  randomHex(8),
+		parent:  t.parent,
+		name:    name,
+		kind:    kind,
+		start:   time.Now(),
+		attrs:   make(map[string]string),
+	}
+	if len(t.active) > 0 {
+		s.parent = t.active[len(t.active)-1].spanID
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.attrs[attrs[i]] = attrs[i+1]
+	}
+	t.active = append(t.active, s)
+	return s
+}
+
+// set sets an attribute
+func (s *span) set(key, value string) {
+	if s == nil {
+		return
+	}
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.attrs[key] = value
+}
+
+// inject propagates the span to Vault with a traceparent header
+func (s *span) inject(c *api.Client) {
+	if s == nil {
+		return
+	}
+	headers := c.Headers()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	headers.Set("traceparent", "00-"+s.traceID+"-"+s.spanID+"-01")
+	c.SetHeaders(headers)
+}
+
+// finish ends the span, with an error status if err is not nil
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	t := s.tracer
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	s.end = time.Now()
+	s.err = err
+	if res, ok := err.(*api.ResponseError); ok {
+		s.attrs["http.response.status_code"] = strconv.Itoa(res.StatusCode)
+	}
+	for i := len(t.active) - 1; i >= 0; i-- {
+		if t.active[i] == s {
+			t.active = append(t.active[:i], t.active[i+1:]...)
+			break
+		}
+	}
+	t.spans = append(t.spans, s)
+}
+
+// Trace runs fn, the command line, in a span named name; the collected spans
+// are exported when fn returns, if an OTLP endpoint is configured (see
+// OTEL_EXPORTER_OTLP_ENDPOINT)
+func Trace(name string, fn func() (int, error)) (int, error) {
+	s := startSpan(name, spanInternal)
+	code, err := fn()
+	if err == nil && code != Success {
+		s.set("vc.exit_code", strconv.Itoa(code))
+		s.finish(fmt.Errorf("exit code %d", code))
+	} else {
+		s.finish(err)
+	}
+	if tracing != nil {
+		if exportErr := tracing.export(); exportErr != nil {
+			fmt.Fprintf(os.Stderr, "warning: trace: %v\n", exportErr)
+		}
+	}
+	return code, err
+}
+
+// OTLP JSON export request, see opentelemetry-proto
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpSpan struct {
+		TraceID      string          `json:"traceId"`
+		SpanID       string          `json:"spanId"`
+		ParentSpanID string          `json:"parentSpanId,omitempty"`
+		Name         string          `json:"name"`
+		Kind         int             `json:"kind"`
+		Start        string          `json:"startTimeUnixNano"`
+		End          string          `json:"endTimeUnixNano"`
+		Attributes   []otlpAttribute `json:"attributes,omitempty"`
+		Status       otlpStatus      `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+)
+
+func otlpAttributes(attrs map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]otlpAttribute, len(keys))
+	for i, key := range keys {
+		out[i].Key = key
+		out[i].Value.StringValue = attrs[key]
+	}
+	return out
+}
+
+// payload returns the OTLP export request for the finished spans
+func (t *tracer) payload() (*otlpRequest, int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(t.spans))}
+	scope.Scope.Name = "github.com/tehmaze/vc"
+	for _, s := range t.spans {
+		o := otlpSpan{
+			TraceID:      s.traceID,
+			SpanID:       s.spanID,
+			ParentSpanID: s.parent,
+			Name:         s.name,
+			Kind:         s.kind,
+			Start:        strconv.FormatInt(s.start.UnixNano(), 10),
+			End:          strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:   otlpAttributes(s.attrs),
+		}
+		if s.err != nil {
+			o.Status = otlpStatus{Code: 2, Message: s.err.Error()}
+		}
+		scope.Spans = append(scope.Spans, o)
+	}
+	t.spans = nil
+
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = otlpAttributes(map[string]string{"service.name": t.service})
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{resource}}, len(scope.Spans)
+}
+
+// export sends the finished spans to the collector
+func (t *tracer) export() error {
+	if protocol := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); protocol != "" && protocol != "http/json" {
+		return fmt.Errorf("unsupported OTLP protocol %q, only http/json is supported", protocol)
+	}
+	request, n := t.payload()
+	if n == 0 {
+		return nil
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range t.headers {
+		r.Header[key] = values
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	Debugf("trace: exporting %d spans", n)
+	res, err := (&http.Client{Timeout: traceTimeout}).Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		if len(msg) == 0 {
+			return errors.New(res.Status)
+		}
+		return fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package vc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, spanID, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok || traceID != "4bf92f3577b34da6a3ce929d0e0e4736" || spanID != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected %q %q %t", traceID, spanID, ok)
+	}
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		if _, _, ok := parseTraceparent(value); ok {
+			t.Fatalf("expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestTracerExport(t *testing.T) {
+	var (
+		request otlpRequest
+		header  string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("Authorization")
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &request); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	tr := &tracer{
+		endpoint: server.URL + "/v1/traces",
+		headers:  http.Header{"Authorization": {"Bearer test"}},
+		service:  "vc",
+		traceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+		parent:   "00f067aa0ba902b7",
+	}
+	root := tr.start("vc template", spanInternal)
+	child := tr.start("vault.read", spanClient, "vault.path", "secret/test")
+	child.finish(errors.New("permission denied"))
+	tr.start("vault.read", spanClient).finish(nil)
+	root.finish(nil)
+
+	if err := tr.export(); err != nil {
+		t.Fatal(err)
+	}
+	if header != "Bearer test" {
+		t.Fatalf("expected Authorization header, got %q", header)
+	}
+	if len(request.ResourceSpans) != 1 || len(request.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected request %+v", request)
+	}
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	if spans[2].Name != "vc template" || spans[2].ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected root span %+v", spans[2])
+	}
+	for _, s := range spans[:2] {
+		if s.TraceID != tr.traceID || s.ParentSpanID != spans[2].SpanID {
+			t.Fatalf("expected span %+v to be a child of the root", s)
+		}
+	}
+	if spans[0].Status.Code != 2 || spans[0].Attributes[0].Value.StringValue != "secret/test" {
+		t.Fatalf("unexpected span %+v", spans[0])
+	}
+}
@@ -0,0 +1,213 @@
+package vc
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// transform transforms rendered output before it's written, see
+// parseTransforms
+type transform func([]byte) ([]byte, error)
+
+// parseTransforms parses the transforms, applied in order:
+//
+//	base64-decode   decode base64 (standard or URL encoding, padded or not)
+//	json            pretty-print JSON, indented with two spaces
+//	pem-order       order the certificates in a PEM bundle from the leaf to
+//	                the root, followed by the other blocks such as keys
+//	lf, crlf        normalize line endings
+//	indent <n>      indent each non-empty line with n spaces
+func parseTransforms(specs []string) ([]transform, error) {
+	transforms := make([]transform, 0, len(specs))
+	for _, spec := range specs {
+		fields := strings.Fields(spec)
+		if len(fields) == 0 {
+			return nil, errors.New("empty transform")
+		}
+		name, args := fields[0], fields[1:]
+		if name != "indent" && len(args) > 0 {
+			return nil, fmt.Errorf("transform %s: unexpected arguments %q", name, strings.Join(args, " "))
+		}
+		switch name {
+		case "base64-decode":
+			transforms = append(transforms, transformBase64Decode)
+		case "json":
+			transforms = append(transforms, transformJSON)
+		case "pem-order":
+			transforms = append(transforms, transformPEMOrder)
+		case "lf":
+			transforms = append(transforms, func(b []byte) ([]byte, error) {
+				return bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1), nil
+			})
+		case "crlf":
+			transforms = append(transforms, func(b []byte) ([]byte, error) {
+				lf := bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+				defer wipe(lf)
+				return bytes.Replace(lf, []byte("\n"), []byte("\r\n"), -1), nil
+			})
+		case "indent":
+			if len(args) != 1 {
+				return nil, errors.New("transform indent: expected the number of spaces")
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("transform indent: invalid number of spaces %q", args[0])
+			}
+			transforms = append(transforms, transformIndent(strings.Repeat(" ", n)))
+		default:
+			return nil, fmt.Errorf("unknown transform %q", name)
+		}
+	}
+	return transforms, nil
+}
+
+// applyTransforms applies the transforms to b in order; the intermediate
+// results are wiped
+func applyTransforms(transforms []transform, b []byte) ([]byte, error) {
+	for i, t := range transforms {
+		out, err := t(b)
+		if i > 0 {
+			wipe(b)
+		}
+		if err != nil {
+			return nil, err
+		}
+		b = out
+	}
+	return b, nil
+}
+
+func transformBase64Decode(b []byte) ([]byte, error) {
+	s := strings.Join(strings.Fields(string(b)), "")
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, errors.New("transform base64-decode: invalid base64")
+}
+
+func transformJSON(b []byte) ([]byte, error) {
+	out := new(bytes.Buffer)
+	if err := json.Indent(out, bytes.TrimSpace(b), "", "  "); err != nil {
+		return nil, fmt.Errorf("transform json: %v", err)
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+func transformIndent(prefix string) transform {
+	return func(b []byte) ([]byte, error) {
+		out := new(bytes.Buffer)
+		for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				out.WriteString(prefix)
+			}
+			out.Write(line)
+		}
+		return out.Bytes(), nil
+	}
+}
+
+// transformPEMOrder orders the certificates from the leaf to the root: each
+// certificate is followed by its issuer, if it's in the bundle. Certificates
+// that are not in the chain of the leaf follow, then the other blocks, in the
+// order they were in.
+func transformPEMOrder(b []byte) ([]byte, error) {
+	var (
+		blocks []*pem.Block
+		certs  []*x509.Certificate
+		others []*pem.Block
+	)
+	for rest := b; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			others = append(others, block)
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("transform pem-order: %v", err)
+		}
+		blocks, certs = append(blocks, block), append(certs, cert)
+	}
+	if len(blocks) == 0 && len(others) == 0 {
+		return nil, errors.New("transform pem-order: no PEM blocks")
+	}
+
+	var (
+		out  = new(secureBuffer)
+		done = make(map[int]bool)
+	)
+	defer out.Wipe()
+	if leaf := certLeaf(certs); leaf >= 0 {
+		for _, i := range certChain(certs, leaf) {
+			done[i] = true
+			pem.Encode(out, blocks[i])
+		}
+	}
+	for i, block := range blocks {
+		if !done[i] {
+			pem.Encode(out, block)
+		}
+	}
+	for _, block := range others {
+		pem.Encode(out, block)
+	}
+	return append([]byte(nil), out.Bytes()...), nil
+}
+
+// certIssued reports whether cert was issued (and signed) by issuer
+func certIssued(issuer, cert *x509.Certificate) bool {
+	return issuer != cert && bytes.Equal(cert.RawIssuer, issuer.RawSubject) && cert.CheckSignatureFrom(issuer) == nil
+}
+
+// certLeaf returns the index of the first certificate that issued none of the
+// others, or -1 if there is none
+func certLeaf(certs []*x509.Certificate) int {
+	for i, cert := range certs {
+		leaf := true
+		for _, other := range certs {
+			if certIssued(cert, other) {
+				leaf = false
+				break
+			}
+		}
+		if leaf {
+			return i
+		}
+	}
+	return -1
+}
+
+// certChain returns the indexes of the chain of certs[leaf], from the leaf up
+// to the root, as far as the issuers are in certs
+func certChain(certs []*x509.Certificate, leaf int) []int {
+	var (
+		chain []int
+		done  = make(map[int]bool)
+	)
+	for i := leaf; i >= 0 && !done[i]; {
+		done[i] = true
+		chain = append(chain, i)
+		next := -1
+		for j, cert := range certs {
+			if !done[j] && certIssued(cert, certs[i]) {
+				next = j
+				break
+			}
+		}
+		i = next
+	}
+	return chain
+}
@@ -0,0 +1,61 @@
+package vc
+
+import (
+	"encoding/pem"
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+	tests := []struct {
+		transforms []string
+		in, out    string
+	}{
+		{[]string{"base64-decode"}, "aGVsbG8=\n", "hello"},
+		{[]string{"base64-decode"}, "aGVsbG8", "hello"},
+		{[]string{"json"}, `{"a":[1,2]}`, "{\n  \"a\": [\n    1,\n    2\n  ]\n}\n"},
+		{[]string{"crlf"}, "a\nb\r\n", "a\r\nb\r\n"},
+		{[]string{"lf"}, "a\r\nb\r\n", "a\nb\n"},
+		{[]string{"indent 2"}, "a\n\nb\n", "  a\n\n  b\n"},
+		{[]string{"base64-decode", "json", "indent 4"}, "eyJhIjoxfQ==", "    {\n      \"a\": 1\n    }\n"},
+	}
+	for _, test := range tests {
+		transforms, err := parseTransforms(test.transforms)
+		if err != nil {
+			t.Fatalf("%q: %v", test.transforms, err)
+		}
+		out, err := applyTransforms(transforms, []byte(test.in))
+		if err != nil {
+			t.Fatalf("%q: %v", test.transforms, err)
+		}
+		if string(out) != test.out {
+			t.Fatalf("%q: expected %q, got %q", test.transforms, test.out, out)
+		}
+	}
+
+	for _, specs := range [][]string{{"rot13"}, {"indent"}, {"indent x"}, {"json 2"}, {""}} {
+		if _, err := parseTransforms(specs); err == nil {
+			t.Fatalf("%q: expected an error", specs)
+		}
+	}
+	transforms, _ := parseTransforms([]string{"json"})
+	if _, err := applyTransforms(transforms, []byte("{")); err == nil {
+		t.Fatal("json: expected an error for invalid JSON")
+	}
+}
+
+func TestTransformPEMOrder(t *testing.T) {
+	certs, _ := testCertChain(t)
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}))
+
+	// Bundled as key, root, leaf, intermediate
+	out, err := transformPEMOrder([]byte(privateKey + certs[0] + certs[2] + "\n" + certs[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := certs[2] + certs[1] + certs[0] + privateKey; string(out) != expect {
+		t.Fatalf("expected leaf, intermediate, root and key, got\n%s", out)
+	}
+	if _, err = transformPEMOrder([]byte("not PEM")); err == nil {
+		t.Fatal("expected an error without PEM blocks")
+	}
+}
@@ -0,0 +1,137 @@
+package vc
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// WorkingPathEnv is the environment variable holding the working path, that
+// relative secret paths are resolved against
+const WorkingPathEnv = "VC_PATH"
+
+// workingPath resolves a relative path against the working path; without a
+// working path, paths are returned as-is
+func workingPath(path string) string {
+	wd := os.Getenv(WorkingPathEnv)
+	if wd == "" || strings.HasPrefix(path, "/") {
+		return path
+	}
+	return filepath.Join("/", wd, path)
+}
+
+// UseCommand sets the working path for the current shell
+type UseCommand struct {
+	baseCommand
+	fs    *flag.FlagSet
+	force bool
+	shell string
+}
+
+func (cmd *UseCommand) Help() string {
+	return `Usage: vc use [<options>] [<secret path>]
+
+Prints the shell commands to set the working path, relative secret paths used
+in subsequent commands are resolved against the working path. Without secret
+path, the current working path is shown. Use "/" to unset the working path.
+
+Example:
+
+    eval "$(vc use secret/teams/payments/prod)"
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *UseCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	args = cmd.fs.Args()
+
+	switch len(args) {
+	case 0:
+		if wd := os.Getenv(WorkingPathEnv); wd != "" {
+			cmd.ui.Output(filepath.Join("/", wd))
+		} else {
+			cmd.ui.Output("/")
+		}
+		return Success
+	case 1:
+	default:
+		return Help
+	}
+
+	path := filepath.Join("/", cmd.resolve(args[0]))
+	if path != "/" && !cmd.force {
+		client, err := cmd.Client()
+		if err != nil {
+			cmd.ui.Error(err.Error())
+			return ClientError
+		}
+		info, err := client.Stat(path)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", path, err))
+			return SyntaxError
+		}
+		if !info.IsDir() {
+			cmd.ui.Error(fmt.Sprintf("error: %s: not a directory", path))
+			return SyntaxError
+		}
+	}
+
+	cmd.ui.Output(shellExport(cmd.shell, WorkingPathEnv, path, path == "/"))
+	return Success
+}
+
+// shellExport formats a command to set (or unset) an environment variable
+func shellExport(shell, name, value string, unset bool) string {
+	if shell == "" {
+		shell = filepath.Base(os.Getenv("SHELL"))
+	}
+	quoted := "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+	switch shell {
+	case "fish":
+		if unset {
+			return "set -e " + name
+		}
+		return "set -gx " + name + " " + quoted
+	case "csh", "tcsh":
+		if unset {
+			return "unsetenv " + name
+		}
+		return "setenv " + name + " " + quoted
+	default:
+		if unset {
+			return "unset " + name
+		}
+		return "export " + name + "=" + quoted
+	}
+}
+
+func (cmd *UseCommand) Synopsis() string {
+	return "set the working path"
+}
+
+func UseCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &UseCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("use", flag.ContinueOnError)
+		cmd.fs.BoolVar(&cmd.force, "f", false, "don't check if the path exists")
+		cmd.fs.StringVar(&cmd.shell, "s", "", "shell syntax: sh, fish or csh (default based on $SHELL)")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
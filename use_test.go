@@ -0,0 +1,50 @@
+package vc
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWorkingPath(t *testing.T) {
+	org := os.Getenv(WorkingPathEnv)
+	defer os.Setenv(WorkingPathEnv, org)
+
+	os.Setenv(WorkingPathEnv, "")
+	if path := workingPath("secret/foo"); path != "secret/foo" {
+		t.Fatalf("expected path to be unchanged without working path, got %q", path)
+	}
+
+	os.Setenv(WorkingPathEnv, "secret/teams")
+	tests := []struct {
+		Path string
+		Want string
+	}{
+		{"db", "/secret/teams/db"},
+		{"../other/db", "/secret/other/db"},
+		{"/secret/foo", "/secret/foo"},
+		{".", "/secret/teams"},
+	}
+	for _, test := range tests {
+		if path := workingPath(test.Path); path != test.Want {
+			t.Fatalf("workingPath(%q): expected %q, got %q", test.Path, test.Want, path)
+		}
+	}
+}
+
+func TestShellExport(t *testing.T) {
+	tests := []struct {
+		Shell string
+		Unset bool
+		Want  string
+	}{
+		{"sh", false, `export VC_PATH='/secret/it'\''s'`},
+		{"sh", true, "unset VC_PATH"},
+		{"fish", false, `set -gx VC_PATH '/secret/it'\''s'`},
+		{"tcsh", true, "unsetenv VC_PATH"},
+	}
+	for _, test := range tests {
+		if got := shellExport(test.Shell, "VC_PATH", "/secret/it's", test.Unset); got != test.Want {
+			t.Fatalf("%s: expected %q, got %q", test.Shell, test.Want, got)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package vc
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+)
+
+// VerifyCommand renders the templates in a manifest in memory, and compares
+// them with the files on disk
+type VerifyCommand struct {
+	baseCommand
+	fs       *flag.FlagSet
+	manifest string
+	state    string
+	vars     stringsValue
+}
+
+func (cmd *VerifyCommand) Help() string {
+	return `Usage: vc verify [<options>] -f <manifest>
+
+Render the templates in the manifest of vc sync in memory, and compare them
+with the files on disk, without writing anything. Files that were changed (~),
+are missing (+), or that are in the state file but no longer in the manifest
+(-) are reported, and the exit code is 10.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *VerifyCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if cmd.manifest == "" || cmd.fs.NArg() > 0 {
+		return Help
+	}
+
+	vars, err := parseSyncVars(cmd.vars)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	m, err := loadSyncManifest(cmd.manifest)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+	sync := &SyncCommand{baseCommand: cmd.baseCommand}
+	if err = m.expandOutputs(vars, func(path string) (*api.Secret, error) {
+		return sync.read(&TemplateCommand{baseCommand: cmd.baseCommand}, client, path)
+	}); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %s: %v", cmd.manifest, err))
+		return exitCode(err, SyntaxError)
+	}
+	if cmd.state != "" {
+		m.State = cmd.state
+	}
+	state, err := loadSyncState(m.State)
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+
+	var (
+		ret     int
+		changes []string
+		ok      int
+		outputs = make(map[string]bool)
+	)
+	for _, f := range m.Files {
+		outputs[f.Output] = true
+		change, err := cmd.verify(sync, client, f)
+		if err != nil {
+			cmd.ui.Error(fmt.Sprintf("error: %s: %v", f.Output, err))
+			if code := exitCode(err, ServerError); code > ret {
+				ret = code
+			}
+		} else if change != "" {
+			changes = append(changes, change)
+		} else {
+			ok++
+		}
+	}
+	var extra int
+	for output := range state.Files {
+		if _, err := os.Stat(output); !outputs[output] && err == nil {
+			changes = append(changes, "- "+output)
+			extra++
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i][2:] < changes[j][2:] })
+	var drifted, missing int
+	colors := cmd.colors(os.Stdout)
+	for _, change := range changes {
+		switch change[0] {
+		case '~':
+			drifted++
+		case '+':
+			missing++
+		}
+		cmd.ui.Output(colors.change(change))
+	}
+	cmd.ui.Info(fmt.Sprintf("verify: %d drifted, %d missing, %d extra, %d ok", drifted, missing, extra, ok))
+	if ret == Success && len(changes) > 0 {
+		ret = DriftError
+	}
+	return ret
+}
+
+// verify renders f and compares it with its output file, it returns the
+// change if they differ
+func (cmd *VerifyCommand) verify(sync *SyncCommand, client *Client, f syncFile) (string, error) {
+	mode, err := cmd.fileMode(f)
+	if err != nil {
+		return "", err
+	}
+	owner, err := lookupOwner(f.Owner, f.Group)
+	if err != nil {
+		return "", err
+	}
+	content, _, err := sync.render(client, f)
+	if err != nil {
+		return "", err
+	} else if content == nil {
+		Debugf("verify: %s: a post-processor handled the output", f.Output)
+		return "", nil
+	}
+	defer wipe(content)
+
+	info, err := os.Stat(f.Output)
+	if os.IsNotExist(err) {
+		return "+ " + f.Output, nil
+	} else if err != nil {
+		return "", err
+	}
+	current, err := ioutil.ReadFile(f.Output)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(current)
+	if !bytes.Equal(current, content) {
+		Debugf("verify: %s: contents differ", f.Output)
+		return "~ " + f.Output, nil
+	}
+	if info.Mode().Perm() != mode.Perm() {
+		Debugf("verify: %s: mode is %s, expected %s", f.Output, info.Mode().Perm(), mode.Perm())
+		return "~ " + f.Output, nil
+	}
+	if !attributed(f.Output, owner, outputXattrs(f.SELinux, f.Xattrs)) {
+		Debugf("verify: %s: owner, group or extended attributes differ", f.Output)
+		return "~ " + f.Output, nil
+	}
+	return "", nil
+}
+
+func (cmd *VerifyCommand) Synopsis() string {
+	return "compare the templates in a manifest with the files on disk"
+}
+
+func VerifyCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &VerifyCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("verify", flag.ContinueOnError)
+		cmd.fs.StringVar(&cmd.manifest, "f", "", "manifest file")
+		cmd.fs.StringVar(&cmd.state, "state", "", "state file (default: the manifest name with "+syncStateSuffix+")")
+		cmd.fs.Var(&cmd.vars, "var", "key=value variable for the outputs, can be repeated")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
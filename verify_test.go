@@ -0,0 +1,71 @@
+package vc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestVerifyCommand(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/secret/db":
+			response = map[string]interface{}{"data": map[string]interface{}{"password": "secret"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv"})
+
+	dir, err := ioutil.TempDir(os.TempDir(), "verify")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"db.tpl": `password={{ secret "secret/db" "password" }}`,
+		"verify.yaml": `files:
+  - {template: db.tpl, output: ok.ini, templating: text}
+  - {template: db.tpl, output: drifted.ini, templating: text}
+  - {template: db.tpl, output: mode.ini, templating: text}
+  - {template: db.tpl, output: missing.ini, templating: text}
+`,
+		"verify.yaml.state": `{"files": {"` + filepath.Join(dir, "old.ini") + `": {}}}`,
+		"ok.ini":            "password=secret",
+		"drifted.ini":       "password=other",
+		"old.ini":           "password=secret",
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Skip(err)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "mode.ini"), []byte("password=secret"), 0644); err != nil {
+		t.Skip(err)
+	}
+
+	ui := cli.NewMockUi()
+	command, _ := VerifyCommandFactory(ui)()
+	cmd := command.(*VerifyCommand)
+	cmd.c, cmd.config = c, new(Config)
+	if code := cmd.Run([]string{"-f", filepath.Join(dir, "verify.yaml")}); code != DriftError {
+		t.Fatalf("expected exit code %d, got %d: %s", DriftError, code, ui.ErrorWriter.String())
+	}
+	want := "~ " + filepath.Join(dir, "drifted.ini") + "\n" +
+		"+ " + filepath.Join(dir, "missing.ini") + "\n" +
+		"~ " + filepath.Join(dir, "mode.ini") + "\n" +
+		"- " + filepath.Join(dir, "old.ini") + "\n" +
+		"verify: 2 drifted, 1 missing, 1 extra, 1 ok\n"
+	if out := ui.OutputWriter.String(); out != want {
+		t.Fatalf("expected output %q, got %q", want, out)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "missing.ini")); !os.IsNotExist(err) {
+		t.Fatal("expected missing.ini not to be written")
+	}
+}
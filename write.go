@@ -0,0 +1,234 @@
+package vc
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mitchellh/cli"
+)
+
+// WriteCommand stores key/value pairs in a secret
+type WriteCommand struct {
+	baseCommand
+	fs     *flag.FlagSet
+	force  bool
+	encode bool
+	prompt stringsValue
+	cas    int
+}
+
+func (cmd *WriteCommand) Help() string {
+	return `Usage: vc write [<options>] <secret path> [<key>=<value> ...]
+
+Values given as "-" (key=-) and keys passed with -p are read interactively,
+with echo disabled, so they don't end up in the shell history. Literal values
+that look like secrets are reported, see --allow-plaintext-args. Values starting
+with "@" are read from a file (key=@file.pem) or from stdin (key=@-); use "@@"
+for a literal leading "@". Binary contents (or all contents read from a file,
+with -encode) are stored base64 encoded in key "<key>` + binaryKeySuffix + `".
+
+Secrets in KV v2 are written with check-and-set: without -f, the write fails
+if the secret changed after it was read for the confirmation. Use -cas to only
+write if the current version is n, 0 for a secret that must not exist yet.
+
+Options:
+` + defaults(cmd.fs)
+}
+
+func (cmd *WriteCommand) Run(args []string) int {
+	if err := cmd.fs.Parse(args); err != nil {
+		return SyntaxError
+	}
+	if args = cmd.fs.Args(); len(args) < 1 {
+		return Help
+	}
+	args[0] = cmd.resolve(args[0])
+	if len(args) == 1 && len(cmd.prompt) == 0 {
+		cmd.ui.Error("error: no data to write")
+		return SyntaxError
+	}
+
+	data, err := parseKeyValues(args[1:])
+	if err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	if err = cmd.checkPlaintextArgs(literalValues(data)); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+	for _, key := range cmd.prompt {
+		data[key] = "-"
+	}
+	if data, err = loadValues(data, cmd.encode); err != nil {
+		cmd.ui.Error(fmt.Sprintf("error: %v", err))
+		return SyntaxError
+	}
+
+	client, err := cmd.Client()
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return ClientError
+	}
+
+	cas := -1
+	cmd.fs.Visit(func(f *flag.Flag) {
+		if f.Name == "cas" {
+			cas = cmd.cas
+		}
+	})
+
+	// Check if secret exists, unless force is enabled
+	if !cmd.force {
+		secret, version, err := cmd.readForUpdate(client, args[0])
+		if err != nil {
+			cmd.ui.Error(err.Error())
+			return exitCode(err, ServerError)
+		}
+		if cas < 0 {
+			cas = version
+		}
+		if secret != nil {
+			ok, err := cmd.confirmChanges(false, describeChanges(secret.Data, data), "secret at %s already exists, overwrite?", args[0])
+			if err != nil {
+				cmd.ui.Error(err.Error())
+				return SystemError
+			} else if !ok {
+				return Success
+			}
+		}
+	}
+
+	if err = cmd.writeUpdate(client, args[0], data, cas); err != nil {
+		if ErrorKind(err) == ErrVersionConflict {
+			cmd.ui.Error(fmt.Sprintf("error: secret at %s was changed by another writer, not overwritten", args[0]))
+		} else {
+			cmd.ui.Error(err.Error())
+		}
+		return exitCode(err, ServerError)
+	}
+
+	return Success
+}
+
+// parseKeyValues parses key=value arguments
+func parseKeyValues(args []string) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	for _, arg := range args {
+		i := strings.IndexByte(arg, '=')
+		if i < 1 {
+			return nil, fmt.Errorf("invalid argument %q, expected key=value", arg)
+		}
+		data[arg[:i]] = arg[i+1:]
+	}
+	return data, nil
+}
+
+// literalValues returns the values of data that are given on the command
+// line, not prompted for or read from stdin or a file; see loadValues
+func literalValues(data map[string]interface{}) map[string]interface{} {
+	literal := make(map[string]interface{}, len(data))
+	for key, v := range data {
+		value := v.(string)
+		switch {
+		case value == "-":
+		case strings.HasPrefix(value, "@@"):
+			literal[key] = value[1:]
+		case strings.HasPrefix(value, "@"):
+		default:
+			literal[key] = value
+		}
+	}
+	return literal
+}
+
+// binaryKeySuffix is appended to the key of values that are stored base64
+// encoded, because they are not valid UTF-8
+const binaryKeySuffix = "_base64"
+
+// loadValues resolves values that have to be prompted for (-), or read from
+// stdin (@-) or a file (@<name>); if encode is set, values read from a file
+// are always stored base64 encoded
+func loadValues(data map[string]interface{}, encode bool) (map[string]interface{}, error) {
+	var (
+		out   = make(map[string]interface{}, len(data))
+		stdin bool
+		keys  = make([]string, 0, len(data))
+	)
+	// Prompt in a stable order
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := data[key].(string)
+		switch {
+		case value == "-":
+			var err error
+			if out[key], err = promptSecret(fmt.Sprintf("value for %s", key), true); err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+		case strings.HasPrefix(value, "@@"):
+			out[key] = value[1:]
+		case strings.HasPrefix(value, "@"):
+			var (
+				b   []byte
+				err error
+			)
+			if value == "@-" {
+				if stdin {
+					return nil, errors.New("stdin (@-) can only be used once")
+				}
+				stdin = true
+				b, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				b, err = ioutil.ReadFile(value[1:])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			if utf8.Valid(b) && !encode {
+				out[key] = string(b)
+			} else {
+				Debugf("write: %s: binary value, storing as %s%s", key, key, binaryKeySuffix)
+				out[key+binaryKeySuffix] = base64.StdEncoding.EncodeToString(b)
+			}
+			wipe(b)
+		default:
+			out[key] = value
+		}
+	}
+	return out, nil
+}
+
+func (cmd *WriteCommand) Synopsis() string {
+	return "write a secret"
+}
+
+func WriteCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		cmd := &WriteCommand{
+			baseCommand: baseCommand{
+				ui: ui,
+			},
+		}
+
+		cmd.fs = flag.NewFlagSet("write", flag.ContinueOnError)
+		cmd.fs.IntVar(&cmd.cas, "cas", 0, "only write if the current version is n (KV v2)")
+		cmd.fs.BoolVar(&cmd.encode, "encode", false, "store values read from files base64 encoded")
+		cmd.fs.BoolVar(&cmd.force, "f", false, "force overwrite")
+		cmd.fs.Var(&cmd.prompt, "p", "prompt for the value of key (can be repeated)")
+		cmd.fs.Usage = func() {
+			fmt.Print(cmd.Help())
+		}
+
+		return cmd, nil
+	}
+}
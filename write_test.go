@@ -0,0 +1,161 @@
+package vc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestWriteCommand(t *testing.T) {
+	for _, test := range []testCommand{
+		testCommand{
+			Factory: WriteCommandFactory,
+			Args:    []string{"--help"},
+			Code:    Success,
+		},
+		testCommand{
+			Factory: WriteCommandFactory,
+			Args:    []string{"secret/test", "novalue"},
+			Code:    SyntaxError,
+		},
+	} {
+		if test.Live {
+			if err := testLiveAvailable(); err != nil {
+				t.Skip(err)
+			}
+		}
+		testCommandRun(t, test)
+	}
+}
+
+func TestParseKeyValues(t *testing.T) {
+	data, err := parseKeyValues([]string{"foo=bar", "empty=", "eq=a=b", "prompt=-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"foo":    "bar",
+		"empty":  "",
+		"eq":     "a=b",
+		"prompt": "-",
+	} {
+		if got := data[key]; got != want {
+			t.Fatalf("expected %s=%q, got %q", key, want, got)
+		}
+	}
+
+	for _, arg := range []string{"foo", "=bar"} {
+		if _, err = parseKeyValues([]string{arg}); err == nil {
+			t.Fatalf("expected %q to fail", arg)
+		}
+	}
+}
+
+func TestLoadValues(t *testing.T) {
+	text, err := ioutil.TempFile(os.TempDir(), "text")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.Remove(text.Name())
+	text.WriteString("-----BEGIN TEST-----\n")
+	text.Close()
+
+	blob, err := ioutil.TempFile(os.TempDir(), "blob")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.Remove(blob.Name())
+	blob.Write([]byte{0x00, 0xff, 0xfe})
+	blob.Close()
+
+	data, err := loadValues(map[string]interface{}{
+		"plain":   "value",
+		"literal": "@@home",
+		"text":    "@" + text.Name(),
+		"blob":    "@" + blob.Name(),
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"plain":                  "value",
+		"literal":                "@home",
+		"text":                   "-----BEGIN TEST-----\n",
+		"blob" + binaryKeySuffix: base64.StdEncoding.EncodeToString([]byte{0x00, 0xff, 0xfe}),
+	} {
+		if got := data[key]; got != want {
+			t.Fatalf("expected %s=%q, got %q", key, want, got)
+		}
+	}
+	if _, ok := data["blob"]; ok {
+		t.Fatal("expected binary value to be stored base64 encoded only")
+	}
+
+	if data, err = loadValues(map[string]interface{}{"text": "@" + text.Name()}, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := data["text"+binaryKeySuffix], base64.StdEncoding.EncodeToString([]byte("-----BEGIN TEST-----\n")); got != want {
+		t.Fatalf("expected encoded text %q, got %q", want, got)
+	}
+
+	if _, err = loadValues(map[string]interface{}{"missing": "@/nonexistent"}, false); err == nil {
+		t.Fatal("expected missing file to fail")
+	}
+}
+
+func TestWriteCommandCAS(t *testing.T) {
+	var written []map[string]interface{}
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/secret/data/db":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"password": "old"},
+				"metadata": map[string]interface{}{"version": 2},
+			}}
+		case "PUT /v1/secret/data/db":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if options, ok := body["options"].(map[string]interface{}); ok && options["cas"] != float64(2) {
+				w.WriteHeader(http.StatusBadRequest)
+				response = map[string]interface{}{"errors": []string{"check-and-set parameter did not match the current version"}}
+				break
+			}
+			written = append(written, body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"errors": []string{}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}), testMounts{"secret/": "kv-v2"})
+
+	for _, test := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"-f", "-cas", "1", "secret/db", "password=new"}, ConflictError},
+		{[]string{"-f", "-cas", "2", "secret/db", "password=new"}, Success},
+		{[]string{"-f", "secret/db", "password=new"}, Success},
+	} {
+		ui := cli.NewMockUi()
+		command, _ := WriteCommandFactory(ui)()
+		cmd := command.(*WriteCommand)
+		cmd.c, cmd.config = c, new(Config)
+		if code := cmd.Run(test.args); code != test.code {
+			t.Fatalf("%v: expected exit code %d, got %d: %s", test.args, test.code, code, ui.ErrorWriter.String())
+		}
+	}
+	if len(written) != 2 {
+		t.Fatalf("expected 2 writes, got %v", written)
+	}
+	// Without -cas, the secret is written with check-and-set on the version
+	// that was read, so a retry can't write it twice
+	if options, _ := written[1]["options"].(map[string]interface{}); options["cas"] != float64(2) {
+		t.Fatalf("expected a write with check-and-set on version 2, got %v", written[1])
+	}
+}
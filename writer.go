@@ -1,13 +1,28 @@
 package vc
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
-	"path/filepath"
+	"os/user"
+	"strconv"
 	"sync"
+	"unicode/utf8"
+
+	"github.com/tehmaze/vc/client"
 )
 
+// DefaultOutputMode is the mode of output files with secrets, see
+// Config.OutputMode
+const DefaultOutputMode = "0600"
+
+// InsecureMode allows output files with secrets that are readable by group or
+// others, see checkOutputMode
+var InsecureMode bool
+
 var (
 	stdoutName = map[string]bool{
 		"":            true,
@@ -21,8 +36,9 @@ var (
 
 // SafeOutputWriter implements a io.WriteCloser that uses a temporary
 // file in the same directory as the target file to write to, and then move
-// the temporary file to the final name after closing. If name is "" or "-",
-// it is assumed the output is stdout and no tempfile will be used.
+// the temporary file to the final name after closing (see client.Writer). If
+// name is "" or "-", it is assumed the output is stdout and no tempfile will
+// be used.
 //
 // The tempfile gets created on the first write to the returned Writer.
 func SafeOutputWriter(name string, mode os.FileMode) io.WriteCloser {
@@ -31,64 +47,201 @@ func SafeOutputWriter(name string, mode os.FileMode) io.WriteCloser {
 	} else if stderrName[name] {
 		return os.Stderr
 	}
-	return &safeOutputWriter{
-		name: name,
-		mode: mode,
+	w := &safeOutputWriter{Writer: client.NewWriter(name, mode)}
+	trackWriter(w)
+	return w
+}
+
+// outputMode returns the mode of the output files with secrets of a command:
+// mod, from the -m flag of fs if it was given, or output_mode in the
+// configuration file. The mode is checked with checkOutputMode, unless the
+// command writes to stdout.
+func (cmd *baseCommand) outputMode(fs *flag.FlagSet, mod string) (os.FileMode, error) {
+	var given bool
+	fs.Visit(func(f *flag.Flag) {
+		given = given || f.Name == "m"
+	})
+	if !given {
+		config, err := cmd.Config()
+		if err != nil {
+			return 0, err
+		}
+		if config.OutputMode != "" {
+			mod = config.OutputMode
+		}
+	}
+	mode, err := strconv.ParseUint(mod, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode: %v", err)
 	}
+	if fs.Lookup("o") != nil && stdoutName[cmd.out] {
+		return os.FileMode(mode), nil
+	}
+	return os.FileMode(mode), checkOutputMode(os.FileMode(mode))
 }
 
-type safeOutputWriter struct {
-	name, temp string
-	mode       os.FileMode
-	mutex      sync.Mutex
-	file       *os.File
+// checkOutputMode refuses modes that make output files with secrets readable
+// by group or others, unless InsecureMode is set
+func checkOutputMode(mode os.FileMode) error {
+	if mode&0044 != 0 && !InsecureMode {
+		return fmt.Errorf("mode %04o makes the file readable by group or others, use 0600 or --insecure-mode", mode)
+	}
+	return nil
 }
 
-func (w *safeOutputWriter) Close() error {
-	w.mutex.Lock()
-	defer w.mutex.Unlock()
+// fileOwner is the owner and group of an output file, -1 leaves either
+// unchanged
+type fileOwner struct {
+	uid, gid int
+}
 
-	if w.file != nil {
-		defer func() {
-			w.file = nil
-		}()
-		if err := w.file.Close(); err != nil {
-			return err
+// lookupOwner resolves the user and group, by name or numeric ID; nil is
+// returned if neither is set
+func lookupOwner(owner, group string) (*fileOwner, error) {
+	if owner == "" && group == "" {
+		return nil, nil
+	}
+	o := &fileOwner{uid: -1, gid: -1}
+	if owner != "" {
+		if uid, err := strconv.Atoi(owner); err == nil {
+			o.uid = uid
+		} else if u, err := user.Lookup(owner); err != nil {
+			return nil, err
+		} else if o.uid, err = strconv.Atoi(u.Uid); err != nil {
+			return nil, fmt.Errorf("user %s: unsupported uid %s", owner, u.Uid)
+		}
+	}
+	if group != "" {
+		if gid, err := strconv.Atoi(group); err == nil {
+			o.gid = gid
+		} else if g, err := user.LookupGroup(group); err != nil {
+			return nil, err
+		} else if o.gid, err = strconv.Atoi(g.Gid); err != nil {
+			return nil, fmt.Errorf("group %s: unsupported gid %s", group, g.Gid)
 		}
-		Debugf("writer: rename %s to %s", w.temp, w.name)
-		return os.Rename(w.temp, w.name)
 	}
+	return o, nil
+}
 
-	Debug("writer: nothing was written")
-	return nil
+// owns checks if the named file has the owner and group
+func (o *fileOwner) owns(name string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	uid, gid, ok := client.Owner(info)
+	return ok && (o.uid == -1 || uid == o.uid) && (o.gid == -1 || gid == o.gid)
+}
+
+// outputXattrs returns the extended attributes of an output file, with its
+// SELinux label if set; nil is returned if there are none
+func outputXattrs(label string, attrs map[string]string) map[string]string {
+	if label == "" && len(attrs) == 0 {
+		return nil
+	}
+	xattrs := make(map[string]string, len(attrs)+1)
+	for attr, value := range attrs {
+		xattrs[attr] = value
+	}
+	if label != "" {
+		xattrs["security.selinux"] = label
+	}
+	return xattrs
+}
+
+// attributed checks if the named file has the owner (if not nil) and the
+// extended attributes
+func attributed(name string, owner *fileOwner, xattrs map[string]string) bool {
+	return (owner == nil || owner.owns(name)) && client.HasXattrs(name, xattrs)
+}
+
+type safeOutputWriter struct {
+	*client.Writer
+
+	// changed is called if the file changed, if set
+	changed func(name string)
 }
 
-func (w *safeOutputWriter) Write(p []byte) (int, error) {
-	if err := w.maybeOpenWriter(); err != nil {
-		return 0, err
+func (w *safeOutputWriter) Close() error {
+	defer untrackWriter(w)
+	written, err := w.Commit()
+	if written && w.changed != nil {
+		w.changed(w.Name())
 	}
-	return w.file.Write(p)
+	return err
 }
 
-func (w *safeOutputWriter) maybeOpenWriter() (err error) {
+// abort closes and removes the temporary file, leaving the target untouched
+func (w *safeOutputWriter) abort() {
+	untrackWriter(w)
+	w.Abort()
+}
+
+// DiffOutputWriter implements a io.WriteCloser that leaves the named file
+// untouched, but upon closing writes a diff between the current contents of
+// the file and the data that was written to w. It is used for dry runs. If
+// name is "" or "-", the output is stdout and no diff is produced.
+func DiffOutputWriter(name string, mode os.FileMode, w io.Writer) io.WriteCloser {
+	if stdoutName[name] {
+		return os.Stdout
+	} else if stderrName[name] {
+		return os.Stderr
+	}
+	return &diffOutputWriter{
+		name: name,
+		mode: mode,
+		out:  w,
+	}
+}
+
+type diffOutputWriter struct {
+	name   string
+	mode   os.FileMode
+	out    io.Writer
+	colors colorizer
+	mutex  sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (w *diffOutputWriter) Close() error {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	if w.file == nil {
-		Debugf("writer: creating temporary file for %s", w.name)
-		dir, base := filepath.Split(w.name)
-		base = "." + base + "."
+	oldName := w.name
+	old, err := ioutil.ReadFile(w.name)
+	if os.IsNotExist(err) {
+		oldName = "/dev/null"
+	} else if err != nil {
+		return err
+	} else if info, err := os.Stat(w.name); err == nil && info.Mode().Perm() != w.mode.Perm() {
+		fmt.Fprintf(w.out, "%s: mode %04o -> %04o\n", w.name, info.Mode().Perm(), w.mode.Perm())
+	}
 
-		if w.file, err = ioutil.TempFile(dir, base); err != nil {
-			return
+	if !utf8.Valid(old) || !utf8.Valid(w.buf.Bytes()) {
+		if !bytes.Equal(old, w.buf.Bytes()) {
+			_, err = fmt.Fprintf(w.out, "binary file %s differs\n", w.name)
+			return err
 		}
-		if err = w.file.Chmod(w.mode); err != nil {
-			Debugf("writer: chmod %s failed: %v", w.file.Name(), err)
-			return
+	} else {
+		var diff bytes.Buffer
+		if changed, err := writeDiff(&diff, oldName, w.name, string(old), w.buf.String()); err != nil {
+			return err
+		} else if changed {
+			for _, line := range splitLines(diff.String()) {
+				if _, err = fmt.Fprintln(w.out, w.colors.diff(redactText(line))); err != nil {
+					return err
+				}
+			}
+			return nil
 		}
-		Debugf("writer: using temporary file %s", w.file.Name())
-		w.temp = w.file.Name()
 	}
 
-	return
+	_, err = fmt.Fprintf(w.out, "%s: unchanged\n", w.name)
+	return err
+}
+
+func (w *diffOutputWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.buf.Write(p)
 }
@@ -1,8 +1,12 @@
 package vc
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -77,3 +81,148 @@ func TestStdoutWriter(t *testing.T) {
 
 	os.Remove(tmp.Name())
 }
+
+func TestDiffWriter(t *testing.T) {
+	temp, err := ioutil.TempFile(os.TempDir(), "test")
+	if err != nil {
+		t.Skip(err)
+	}
+	name := temp.Name()
+	defer os.Remove(name)
+	temp.WriteString("hello\nworld\n")
+	temp.Close()
+	os.Chmod(name, 0600)
+
+	out := new(bytes.Buffer)
+	w := DiffOutputWriter(name, 0600, out)
+	if _, err = w.Write([]byte("hello\nvault\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(name); string(b) != "hello\nworld\n" {
+		t.Fatalf("expected %s to be untouched, got %q", name, b)
+	}
+	if !strings.Contains(out.String(), "-world\n+vault\n") {
+		t.Fatalf("expected diff, got %q", out.String())
+	}
+
+	out.Reset()
+	w = DiffOutputWriter(name, 0600, out)
+	w.Write([]byte("hello\nworld\n"))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "unchanged\n") {
+		t.Fatalf("expected unchanged, got %q", out.String())
+	}
+}
+
+func TestWriterOwner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vc-owner")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "key.pem")
+
+	// Without root, files can only be given to the current user and groups
+	owner, err := lookupOwner(strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &baseCommand{owner: owner}
+	w := cmd.outputWriter(name, 0600)
+	if _, err = w.Write([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !owner.owns(name) {
+		t.Fatalf("expected %s to be owned by %d:%d", name, owner.uid, owner.gid)
+	}
+	if (&fileOwner{uid: os.Getuid() + 1, gid: -1}).owns(name) {
+		t.Fatalf("expected %s to not be owned by uid %d", name, os.Getuid()+1)
+	}
+
+	if _, err = lookupOwner("", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = lookupOwner("no-such-user-vc", ""); err == nil {
+		t.Fatal("expected an error for an unknown user")
+	}
+}
+
+func TestWriterXattrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vc-xattr")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.conf")
+
+	xattrs := outputXattrs("", map[string]string{"user.vc": "test"})
+	cmd := &baseCommand{xattrs: xattrs}
+	w := cmd.outputWriter(name, 0600)
+	if _, err = w.Write([]byte("config")); err != nil {
+		// Not all file systems support extended attributes
+		w.(*safeOutputWriter).abort()
+		t.Skip(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !attributed(name, nil, xattrs) {
+		t.Fatalf("expected %s to have %v", name, xattrs)
+	}
+	if attributed(name, nil, map[string]string{"user.vc": "other"}) {
+		t.Fatalf("expected %s to not have user.vc=other", name)
+	}
+	if xattrs = outputXattrs("system_u:object_r:etc_t:s0", nil); xattrs["security.selinux"] != "system_u:object_r:etc_t:s0" {
+		t.Fatalf("expected a SELinux label, got %v", xattrs)
+	}
+}
+
+func TestOutputMode(t *testing.T) {
+	saved := InsecureMode
+	defer func() { InsecureMode = saved }()
+
+	tests := []struct {
+		args     []string
+		config   string
+		insecure bool
+		want     os.FileMode
+		err      bool
+	}{
+		{[]string{"-o", "app.env"}, "", false, 0600, false},
+		{[]string{"-o", "app.env"}, "0400", false, 0400, false},
+		{[]string{"-o", "app.env", "-m", "0640"}, "0400", true, 0640, false},
+		{[]string{"-o", "app.env", "-m", "0644"}, "", false, 0, true},
+		{[]string{"-o", "app.env"}, "0604", false, 0, true},
+		{[]string{"-m", "0644"}, "", false, 0644, false},
+		{[]string{"-o", "app.env", "-m", "06x0"}, "", false, 0, true},
+	}
+	for _, test := range tests {
+		InsecureMode = test.insecure
+		command, _ := CatCommandFactory(nil)()
+		cmd := command.(*CatCommand)
+		cmd.config = &Config{OutputMode: test.config}
+		if err := cmd.fs.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		mode, err := cmd.outputMode(cmd.fs, cmd.mod)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q, config %q: expected error, got mode %04o", test.args, test.config, mode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q, config %q: %v", test.args, test.config, err)
+		} else if mode != test.want {
+			t.Errorf("%q, config %q: expected mode %04o, got %04o", test.args, test.config, test.want, mode)
+		}
+	}
+}